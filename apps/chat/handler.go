@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// newHandler routes:
+//
+//	GET /rooms                      rooms with anyone in them
+//	GET /rooms/{room}/ws?name=alice join room over a websocket
+//
+// Joining is connecting and leaving is disconnecting, and the room is
+// created by whoever joins it first
+func newHandler(h *hub) http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/rooms", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.rooms())
+	})
+	m.HandleFunc("/rooms/", func(w http.ResponseWriter, r *http.Request) {
+		roomName, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/rooms/"), "/ws")
+		if !ok || !validName(roomName) {
+			http.NotFound(w, r)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if !validName(name) {
+			http.Error(w, "name must be 1-32 letters, digits, - or _", http.StatusBadRequest)
+			return
+		}
+
+		// refuse before upgrading, so the client gets a real status code
+		h.mu.Lock()
+		closing := h.closing
+		h.mu.Unlock()
+		if closing {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		websocket.Handler(func(ws *websocket.Conn) {
+			h.serve(ws, roomName, name)
+		}).ServeHTTP(w, r)
+	})
+	return m
+}
+
+func validName(s string) bool {
+	if len(s) == 0 || len(s) > 32 {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
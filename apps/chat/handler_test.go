@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"go.uber.org/goleak"
+	"golang.org/x/net/websocket"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+type testServer struct {
+	*httptest.Server
+	hub *hub
+}
+
+func startChat(t *testing.T, tweak func(*options)) *testServer {
+	opts := defaultOptions()
+	opts.SendBuffer = 256
+	if tweak != nil {
+		tweak(&opts)
+	}
+	h := newHub(clock.NewFake(testNow), opts)
+	srv := httptest.NewServer(newHandler(h))
+	t.Cleanup(func() {
+		h.Shutdown(context.Background())
+		srv.Close()
+	})
+	return &testServer{Server: srv, hub: h}
+}
+
+// join connects name to room, and waits to see its own join message so the
+// subscription is known to be in place
+func (s *testServer) join(t *testing.T, room, name string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + "/rooms/" + room + "/ws?name=" + name
+	ws, err := websocket.Dial(url, "", s.URL)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+
+	for {
+		msg := receive(t, ws)
+		if msg.Type == "join" && msg.User == name {
+			return ws
+		}
+	}
+}
+
+func receive(t *testing.T, ws *websocket.Conn) message {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg message
+	require.NoError(t, websocket.JSON.Receive(ws, &msg))
+	return msg
+}
+
+func say(t *testing.T, ws *websocket.Conn, text string) {
+	t.Helper()
+	require.NoError(t, websocket.JSON.Send(ws, incoming{Text: text}))
+}
+
+func TestRooms(t *testing.T) {
+	s := startChat(t, nil)
+	alice := s.join(t, "go", "alice")
+	bob := s.join(t, "go", "bob")
+	carol := s.join(t, "rust", "carol")
+
+	assert.Equal(t, message{Type: "join", Room: "go", User: "bob", Time: testNow}, receive(t, alice))
+
+	say(t, alice, "hello gophers")
+	for _, ws := range []*websocket.Conn{alice, bob} {
+		assert.Equal(t, message{Type: "message", Room: "go", User: "alice", Text: "hello gophers", Time: testNow}, receive(t, ws))
+	}
+
+	// rooms are separate: carol's next message is her own, not alice's
+	say(t, carol, "hello crabs")
+	assert.Equal(t, "hello crabs", receive(t, carol).Text)
+
+	resp, err := http.Get(s.URL + "/rooms")
+	require.NoError(t, err)
+	var rooms []room
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rooms))
+	resp.Body.Close()
+	assert.Equal(t, []room{{Name: "go", Members: []string{"alice", "bob"}}, {Name: "rust", Members: []string{"carol"}}}, rooms)
+
+	bob.Close()
+	assert.Equal(t, message{Type: "leave", Room: "go", User: "bob", Time: testNow}, receive(t, alice))
+	assert.Eventually(t, func() bool { return len(s.hub.rooms()[0].Members) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestBadRequests(t *testing.T) {
+	s := startChat(t, nil)
+
+	for path, want := range map[string]int{
+		"/rooms/go/ws":               http.StatusBadRequest, // no name
+		"/rooms/go/ws?name=a%20b":    http.StatusBadRequest,
+		"/rooms/a%2Fb/ws?name=alice": http.StatusNotFound,
+		"/rooms/go?name=alice":       http.StatusNotFound,
+		"/rooms/go/ws/x?name=alice":  http.StatusNotFound,
+	} {
+		resp, err := http.Get(s.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, want, resp.StatusCode, path)
+	}
+}
+
+// TestConcurrentClients has every client talking at once. Everyone must
+// hear everything, and each sender's messages in the order they were sent
+func TestConcurrentClients(t *testing.T) {
+	const clients, perClient = 8, 25
+	s := startChat(t, nil)
+
+	conns := make([]*websocket.Conn, clients)
+	for i := range conns {
+		conns[i] = s.join(t, "go", fmt.Sprintf("user%d", i))
+	}
+
+	var wg sync.WaitGroup
+	got := make([]map[string][]string, clients)
+	errs := make(chan error, clients*2)
+	for i, ws := range conns {
+		i, ws := i, ws
+		got[i] = map[string][]string{}
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			for n := 0; n < perClient; n++ {
+				if err := websocket.JSON.Send(ws, incoming{Text: fmt.Sprint(n)}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			for received := 0; received < clients*perClient; {
+				ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+				var msg message
+				if err := websocket.JSON.Receive(ws, &msg); err != nil {
+					errs <- err
+					return
+				}
+				if msg.Type == "message" {
+					got[i][msg.User] = append(got[i][msg.User], msg.Text)
+					received++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	want := make([]string, perClient)
+	for n := range want {
+		want[n] = fmt.Sprint(n)
+	}
+	for i := range conns {
+		require.Len(t, got[i], clients)
+		for sender, texts := range got[i] {
+			assert.Equal(t, want, texts, "user%d hearing %s", i, sender)
+		}
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	s := startChat(t, func(o *options) { o.IdleTimeout = 200 * time.Millisecond })
+	alice := s.join(t, "go", "alice")
+	bob := s.join(t, "go", "bob")
+	receive(t, alice) // bob's join
+
+	// alice keeps talking, bob says nothing and is dropped
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		tick := time.NewTicker(50 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+				websocket.JSON.Send(alice, incoming{}) // keep-alive
+			}
+		}
+	}()
+
+	assert.Equal(t, message{Type: "leave", Room: "go", User: "bob", Time: testNow}, receive(t, alice))
+
+	var msg message
+	bob.SetReadDeadline(time.Now().Add(time.Second))
+	assert.Error(t, websocket.JSON.Receive(bob, &msg), "bob's connection is closed")
+}
+
+func TestShutdown(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	s := startChat(t, nil)
+
+	conns := []*websocket.Conn{s.join(t, "go", "alice"), s.join(t, "go", "bob"), s.join(t, "rust", "carol")}
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.hub.Shutdown(context.Background()) }()
+
+	for _, ws := range conns {
+		for {
+			msg := receive(t, ws)
+			if msg.Type == "system" {
+				assert.Equal(t, "server shutting down", msg.Text)
+				break
+			}
+		}
+		var msg message
+		assert.Error(t, websocket.JSON.Receive(ws, &msg), "closed after the goodbye")
+		ws.Close()
+	}
+	require.NoError(t, <-shutdown)
+	assert.Empty(t, s.hub.rooms())
+
+	// nobody new gets in
+	resp, err := http.Get(s.URL + "/rooms/go/ws?name=dave")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	s.Close()
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s := startChat(t, nil)
+	ws := s.join(t, "go", "alice")
+
+	// with ctx already done there's no waiting for goodbyes, everyone is
+	// closed straight away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, s.hub.Shutdown(ctx), context.Canceled)
+	assert.Empty(t, s.hub.rooms())
+	ws.Close()
+}
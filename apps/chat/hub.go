@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"golang.org/x/net/websocket"
+)
+
+// message is what clients are sent, as JSON
+type message struct {
+	Type string    `json:"type"` // "message", "join", "leave" or "system"
+	Room string    `json:"room"`
+	User string    `json:"user,omitempty"`
+	Text string    `json:"text,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// incoming is what clients send. An empty text is a keep-alive: it resets
+// the idle timer without saying anything to the room
+type incoming struct {
+	Text string `json:"text"`
+}
+
+var (
+	errSlowConsumer = errors.New("chat: client fell behind")
+	errShuttingDown = errors.New("chat: server shutting down")
+)
+
+type options struct {
+	// IdleTimeout disconnects a client that sends nothing for this long.
+	// Clients that only listen are expected to send keep-alives
+	IdleTimeout time.Duration
+	// WriteTimeout bounds each write, so a client that stops reading can't
+	// hold its write pump forever
+	WriteTimeout time.Duration
+	// SendBuffer is how many messages may queue for a client before it
+	// counts as too slow and is disconnected
+	SendBuffer int
+	// MaxMessageBytes caps a single incoming frame
+	MaxMessageBytes int
+}
+
+func defaultOptions() options {
+	return options{
+		IdleTimeout:     time.Minute,
+		WriteTimeout:    10 * time.Second,
+		SendBuffer:      64,
+		MaxMessageBytes: 4 << 10,
+	}
+}
+
+// hub keeps track of who's connected to which room. The messages themselves
+// go through a pubsub bus with a topic per room, so the hub never sends to a
+// client directly - each client's write pump reads its own subscription
+type hub struct {
+	bus  *pubsub.Bus[message]
+	clk  clock.Clock
+	opts options
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	closing bool
+	quit    chan struct{} // closed by Shutdown, tells every write pump to say goodbye
+	wg      sync.WaitGroup
+}
+
+type client struct {
+	room, name string
+	ws         *websocket.Conn
+}
+
+func newHub(clk clock.Clock, opts options) *hub {
+	return &hub{
+		bus:     pubsub.New[message](),
+		clk:     clk,
+		opts:    opts,
+		clients: map[*client]struct{}{},
+		quit:    make(chan struct{}),
+	}
+}
+
+func topic(room string) string { return "room:" + room }
+
+// register adds c, unless the hub is shutting down
+func (h *hub) register(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closing {
+		return false
+	}
+	h.clients[c] = struct{}{}
+	h.wg.Add(1)
+	return true
+}
+
+func (h *hub) unregister(c *client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+	h.wg.Done()
+}
+
+func (h *hub) publish(msg message) {
+	msg.Time = h.clk.Now()
+	// every subscriber uses pubsub.Drop, so this never waits
+	h.bus.Publish(context.Background(), topic(msg.Room), msg)
+}
+
+// room is one entry in the /rooms listing
+type room struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// rooms lists the rooms with anyone in them, and who
+func (h *hub) rooms() []room {
+	h.mu.Lock()
+	members := map[string][]string{}
+	for c := range h.clients {
+		members[c.room] = append(members[c.room], c.name)
+	}
+	h.mu.Unlock()
+
+	rooms := make([]room, 0, len(members))
+	for name, m := range members {
+		sort.Strings(m)
+		rooms = append(rooms, room{Name: name, Members: m})
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	return rooms
+}
+
+/*
+ *
+ * one connection
+ *
+ */
+
+// serve runs a client's connection until it leaves, idles out, falls
+// behind, or the hub shuts down. Two goroutines share the connection:
+//
+//   - this one reads from the client and publishes to the room
+//   - the write pump sends the room's messages to the client. It's the only
+//     goroutine that writes, and the only one that closes the connection
+//
+// Whichever notices the end first makes the other stop: a failed read
+// unsubscribes, which ends the pump; the pump finishing closes the
+// connection, which fails the read
+func (h *hub) serve(ws *websocket.Conn, roomName, name string) {
+	ws.MaxPayloadBytes = h.opts.MaxMessageBytes
+
+	c := &client{room: roomName, name: name, ws: ws}
+	if !h.register(c) {
+		ws.Close()
+		return
+	}
+	defer h.unregister(c)
+
+	sub := h.bus.Subscribe(topic(roomName), pubsub.WithBuffer(h.opts.SendBuffer))
+	h.publish(message{Type: "join", Room: roomName, User: name})
+
+	pumpDone := make(chan struct{})
+	go func() {
+		defer close(pumpDone)
+		pump(sub, roomName, h.quit, h.sender(ws))
+		ws.Close()
+	}()
+
+	h.readLoop(c)
+
+	sub.Unsubscribe()
+	<-pumpDone
+	h.publish(message{Type: "leave", Room: roomName, User: name})
+}
+
+// readLoop publishes what the client says until a read fails. The read
+// deadline is pushed back before every read, which is the idle timeout.
+// Deadlines left over from the http.Server's own timeouts would otherwise
+// still apply - they're set on the connection before it's hijacked
+func (h *hub) readLoop(c *client) {
+	for {
+		c.ws.SetReadDeadline(time.Now().Add(h.opts.IdleTimeout))
+
+		var in incoming
+		if err := websocket.JSON.Receive(c.ws, &in); err != nil {
+			return
+		}
+		if in.Text == "" {
+			continue
+		}
+		h.publish(message{Type: "message", Room: c.room, User: c.name, Text: in.Text})
+	}
+}
+
+func (h *hub) sender(ws *websocket.Conn) func(message) error {
+	return func(msg message) error {
+		ws.SetWriteDeadline(time.Now().Add(h.opts.WriteTimeout))
+		return websocket.JSON.Send(ws, msg)
+	}
+}
+
+// pump sends a client's messages as they arrive. Backpressure is handled by
+// the subscription's buffer: a client that can't keep up has messages
+// dropped, and once that happens it's told so and disconnected. Carrying on
+// would leave it with a conversation that has holes in it, and the room
+// can't slow down for its slowest member
+func pump(sub *pubsub.Subscription[message], room string, quit <-chan struct{}, send func(message) error) error {
+	for {
+		select {
+		case msg, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if sub.Dropped() > 0 {
+				send(message{Type: "system", Room: room, Text: "too slow, disconnecting", Time: msg.Time})
+				return errSlowConsumer
+			}
+			if err := send(msg); err != nil {
+				return err
+			}
+
+		case <-quit:
+			send(message{Type: "system", Room: room, Text: "server shutting down"})
+			return errShuttingDown
+		}
+	}
+}
+
+/*
+ *
+ * shutting down
+ *
+ */
+
+// Shutdown stops new clients joining and tells the connected ones goodbye,
+// then waits for them to go. http.Server.Shutdown can't do this part: a
+// websocket is a hijacked connection, which the server stops tracking. When
+// ctx runs out first, what's left is closed without waiting
+func (h *hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closing {
+		h.closing = true
+		close(h.quit)
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		h.mu.Lock()
+		for c := range h.clients {
+			c.ws.Close()
+		}
+		h.mu.Unlock()
+		<-done
+	}
+
+	h.bus.Close()
+	return err
+}
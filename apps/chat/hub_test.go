@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+)
+
+func TestPumpSends(t *testing.T) {
+	bus := pubsub.New[message]()
+	defer bus.Close()
+	sub := bus.Subscribe(topic("go"))
+
+	var sent []message
+	done := make(chan error, 1)
+	go func() {
+		done <- pump(sub, "go", nil, func(m message) error {
+			sent = append(sent, m)
+			return nil
+		})
+	}()
+
+	bus.Publish(context.Background(), topic("go"), message{Text: "a"})
+	bus.Publish(context.Background(), topic("go"), message{Text: "b"})
+	require.Eventually(t, func() bool { return len(sub.C) == 0 }, time.Second, time.Millisecond)
+	sub.Unsubscribe()
+
+	assert.NoError(t, <-done)
+	require.Len(t, sent, 2)
+	assert.Equal(t, "a", sent[0].Text)
+	assert.Equal(t, "b", sent[1].Text)
+}
+
+func TestPumpDisconnectsSlowConsumer(t *testing.T) {
+	bus := pubsub.New[message]()
+	defer bus.Close()
+	sub := bus.Subscribe(topic("go"), pubsub.WithBuffer(2))
+
+	// the first send blocks, like a client whose TCP buffers are full
+	blocked, release := make(chan struct{}), make(chan struct{})
+	var sent []message
+	done := make(chan error, 1)
+	go func() {
+		done <- pump(sub, "go", nil, func(m message) error {
+			if len(sent) == 0 {
+				close(blocked)
+				<-release
+			}
+			sent = append(sent, m)
+			return nil
+		})
+	}()
+
+	bus.Publish(context.Background(), topic("go"), message{Text: "1"})
+	<-blocked
+	for _, text := range []string{"2", "3", "4"} {
+		bus.Publish(context.Background(), topic("go"), message{Text: text})
+	}
+	assert.Equal(t, uint64(1), sub.Dropped())
+	close(release)
+
+	assert.ErrorIs(t, <-done, errSlowConsumer)
+	require.Len(t, sent, 2)
+	assert.Equal(t, "1", sent[0].Text)
+	assert.Equal(t, message{Type: "system", Room: "go", Text: "too slow, disconnecting"}, sent[1])
+}
+
+func TestPumpStopsOnWriteError(t *testing.T) {
+	bus := pubsub.New[message]()
+	defer bus.Close()
+	sub := bus.Subscribe(topic("go"))
+	bus.Publish(context.Background(), topic("go"), message{Text: "a"})
+
+	broken := errors.New("broken pipe")
+	err := pump(sub, "go", nil, func(message) error { return broken })
+	assert.ErrorIs(t, err, broken)
+}
+
+func TestPumpSaysGoodbye(t *testing.T) {
+	bus := pubsub.New[message]()
+	defer bus.Close()
+	sub := bus.Subscribe(topic("go"))
+
+	quit := make(chan struct{})
+	close(quit)
+	var sent []message
+	err := pump(sub, "go", quit, func(m message) error {
+		sent = append(sent, m)
+		return nil
+	})
+
+	assert.ErrorIs(t, err, errShuttingDown)
+	assert.Equal(t, []message{{Type: "system", Room: "go", Text: "server shutting down"}}, sent)
+}
+
+func TestValidName(t *testing.T) {
+	for _, ok := range []string{"a", "go-nuts", "user_42"} {
+		assert.True(t, validName(ok), ok)
+	}
+	for _, bad := range []string{"", "a b", "a/b", "ünï", string(make([]byte, 33))} {
+		assert.False(t, validName(bad), bad)
+	}
+}
@@ -0,0 +1,84 @@
+// The chat server puts websockets, the pubsub bus and context together.
+// Run it with
+//
+//	go run ./apps/chat
+//
+// then connect to ws://localhost:8080/rooms/{room}/ws?name={you}, for
+// example with websocat, and send {"text":"hi"}. Server settings come from
+// pkg/config, as for the other apps, with CHAT_CONFIG naming the YAML file
+package main
+
+import (
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/admin"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"github.com/thorntonmc/go-practice/pkg/config"
+	"github.com/thorntonmc/go-practice/pkg/envconfig"
+	"github.com/thorntonmc/go-practice/pkg/lifecycle"
+	"github.com/thorntonmc/go-practice/pkg/server"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func main() {
+	var env struct {
+		ConfigPath  string        `env:"CHAT_CONFIG"`
+		IdleTimeout time.Duration `env:"CHAT_IDLE_TIMEOUT,default=1m"`
+	}
+	if err := envconfig.Process(os.LookupEnv, &env); err != nil {
+		log.Fatal(err)
+	}
+
+	path := flag.String("config", env.ConfigPath, "path to a YAML config file")
+	idle := flag.Duration("idle", env.IdleTimeout, "disconnect clients silent for this long")
+	showVersion := version.AddFlag(flag.CommandLine)
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("chat", version.Get())
+		return
+	}
+
+	cfg, err := config.Load(*path, os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := defaultOptions()
+	opts.IdleTimeout = *idle
+	h := newHub(clock.New(), opts)
+	srv := server.FromConfig(cfg.Server, newHandler(h))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// stopping runs backwards: the server stops accepting connections
+	// first, then the hub says goodbye to the websockets, which the server
+	// no longer tracks
+	lc := lifecycle.New(log.Default())
+	stats := admin.New("chat", admin.WithCounter("rooms", expvar.Func(func() any {
+		rooms := h.rooms()
+		clients := 0
+		for _, r := range rooms {
+			clients += len(r.Members)
+		}
+		return map[string]int{"active": len(rooms), "clients": clients}
+	})))
+	if adm := server.Admin(cfg.Server, stats); adm != nil {
+		lc.Append(lifecycle.HTTPServer("admin", adm))
+	}
+	lc.Append(lifecycle.Hook{Name: "hub", Stop: h.Shutdown})
+	lc.Append(lifecycle.HTTPServer("http", srv))
+
+	log.Printf("chat: listening on %s", cfg.Server.Addr)
+	if err := lc.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
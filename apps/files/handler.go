@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/ratelimit"
+	"github.com/thorntonmc/go-practice/pkg/checksum"
+	"github.com/thorntonmc/go-practice/pkg/httplimit"
+	"github.com/thorntonmc/go-practice/pkg/progress"
+)
+
+// multipartOverhead allows for the boundaries and part headers around the
+// file bytes, which count against the request body limit too
+const multipartOverhead = 64 << 10
+
+// uploads log their progress every progressBytes, downloads every
+// progressInterval - a throttled one can take a while
+const (
+	progressBytes    = 8 << 20
+	progressInterval = 5 * time.Second
+)
+
+// newHandler routes:
+//
+//	POST /files       upload, multipart/form-data with one or more "file" parts
+//	GET  /files       list
+//	GET  /files/{id}  download, with Range and conditional request support
+//
+// maxUpload caps a single request, whatever quota is left. downloadRate
+// caps each download at that many bytes a second, 0 for no cap - a way to
+// see how clients cope with a slow link without finding one. Transfers are
+// logged to logger as they go
+func newHandler(s *diskStore, maxUpload int64, downloadRate int, logger *log.Logger) http.Handler {
+	h := &handler{store: s, maxUpload: maxUpload, downloadRate: downloadRate, log: logger}
+
+	m := http.NewServeMux()
+	m.HandleFunc("/files", h.collection)
+	m.HandleFunc("/files/", h.download)
+	return m
+}
+
+type handler struct {
+	store        *diskStore
+	maxUpload    int64
+	downloadRate int
+	log          *log.Logger
+}
+
+func (h *handler) collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		files, err := h.store.List()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, files)
+
+	case http.MethodPost:
+		h.upload(w, r)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// upload streams each file part straight to the store. r.ParseMultipartForm
+// would be simpler, but it reads the whole body first - into memory up to a
+// limit, then temporary files - before the handler sees a byte. The
+// MultipartReader hands over one part at a time as it arrives.
+//
+// A "sha256" field before a file part is the hex sha256 its contents should
+// have, and one that arrives different isn't stored:
+//
+//	curl -F sha256=… -F file=@photo.jpg localhost:8080/files
+//
+// The body limit is whichever is smaller: maxUpload, or what's left of the
+// quota. Going over it fails the read with *http.MaxBytesError, wherever in
+// the stream that happens. Files stored before a later one fails stay stored
+func (h *handler) upload(w http.ResponseWriter, r *http.Request) {
+	limit, quotaBound := h.maxUpload, false
+	if remaining := h.store.Remaining(); remaining < limit {
+		limit, quotaBound = remaining, true
+	}
+	if limit <= 0 {
+		writeError(w, http.StatusInsufficientStorage, errQuota)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit+multipartOverhead)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var stored []file
+	want := "" // from a sha256 field, for the file after it
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			h.uploadError(w, err, quotaBound)
+			return
+		}
+		if part.FormName() == "sha256" {
+			// a sum is 64 bytes, reading a few more is enough to tell
+			// it's too long
+			b, err := io.ReadAll(io.LimitReader(part, 128))
+			if err != nil {
+				h.uploadError(w, err, quotaBound)
+				return
+			}
+			if want = strings.TrimSpace(string(b)); !validID(want) {
+				writeError(w, http.StatusBadRequest, errors.New("sha256 must be 64 lower case hex digits"))
+				return
+			}
+			continue
+		}
+		if part.FormName() != "file" {
+			continue // NextPart skips whatever of it wasn't read
+		}
+
+		name := part.FileName()
+		if name == "" {
+			name = "upload"
+		}
+		body := progress.NewCountingReader(part, progress.EveryBytes(progressBytes), progress.OnProgress(func(total int64) {
+			h.log.Printf("files: receiving %q: %d bytes", name, total)
+		}))
+		f, err := h.store.Put(body, name, want)
+		if err != nil {
+			h.uploadError(w, err, quotaBound)
+			return
+		}
+		stored = append(stored, f)
+		want = ""
+	}
+
+	if len(stored) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New(`no "file" parts in the form`))
+		return
+	}
+	writeJSON(w, http.StatusCreated, stored)
+}
+
+func (h *handler) uploadError(w http.ResponseWriter, err error, quotaBound bool) {
+	switch {
+	case errors.Is(err, errQuota), httplimit.IsTooLarge(err) && quotaBound:
+		writeError(w, http.StatusInsufficientStorage, errQuota)
+	case httplimit.IsTooLarge(err):
+		writeError(w, http.StatusRequestEntityTooLarge, errors.New("upload too large"))
+	case errors.Is(err, checksum.ErrMismatch):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		// a malformed body, or the client going away
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
+
+// download leaves the hard parts to http.ServeContent, which handles Range
+// (one range or several, as multipart/byteranges), If-Range, If-None-Match,
+// If-Modified-Since and HEAD. It needs an io.ReadSeeker to jump to a range
+// and find the size, which an *os.File is.
+//
+// Because the id is the hash of the contents, it makes a strong ETag that
+// never needs recomputing
+func (h *handler) download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	blob, f, err := h.store.Open(strings.TrimPrefix(r.URL.Path, "/files/"))
+	switch {
+	case errors.Is(err, errNotFound):
+		writeError(w, http.StatusNotFound, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, nil)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("ETag", `"`+f.ID+`"`)
+	w.Header().Set("Content-Type", f.ContentType)
+	// FormatMediaType encodes names that aren't plain ASCII the RFC 2231 way
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": f.Name}))
+	// the contents behind an id can't change, so they can be cached forever
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	var body io.Writer = w
+	if h.downloadRate > 0 {
+		// each download gets its own bucket, on the store's clock so tests
+		// can move time along
+		body = ratelimit.NewThrottledWriter(r.Context(), body, ratelimit.Bandwidth(h.downloadRate, h.store.clk))
+	}
+	// a range, or a client that gives up, gets less than the whole file
+	sent := progress.NewCountingWriter(body, progress.EveryInterval(progressInterval), progress.WithClock(h.store.clk), progress.OnProgress(func(total int64) {
+		h.log.Printf("files: sending %s: %d of %d bytes", f.ID, total, f.Size)
+	}))
+	http.ServeContent(bodyWriter{w, sent}, r, f.Name, f.UploadedAt, blob)
+	sent.Done()
+}
+
+// bodyWriter sends the body through another Writer. Headers and status are
+// untouched, they go out before the first Write
+type bodyWriter struct {
+	http.ResponseWriter
+	body io.Writer
+}
+
+func (b bodyWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+// ReadFrom is what ServeContent's io.Copy calls. Passing it on keeps the
+// ResponseWriter's own ReadFrom in reach: with no throttle, body is the
+// counter straight on top of the response, and the file goes out with
+// sendfile rather than through a buffer
+func (b bodyWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := b.body.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{b.body}, src)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes {"error": ...}. A nil err is an internal error, whose
+// details aren't for the client
+func writeError(w http.ResponseWriter, status int, err error) {
+	msg := http.StatusText(status)
+	if err != nil {
+		msg = err.Error()
+	}
+	writeJSON(w, status, map[string]string{"error": msg})
+}
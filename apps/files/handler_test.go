@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+var quiet = log.New(io.Discard, "", 0)
+
+func startFiles(t *testing.T, quota, maxUpload int64) (*httptest.Server, *diskStore) {
+	s := newTestStore(t, quota)
+	srv := httptest.NewServer(newHandler(s, maxUpload, 0, quiet))
+	t.Cleanup(srv.Close)
+	return srv, s
+}
+
+// upload streams a multipart body through a pipe, the way a real client
+// sending a big file would, rather than building it all in memory
+func upload(t *testing.T, url string, files map[string]string) *http.Response {
+	t.Helper()
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		mw.WriteField("note", "fields other than file are ignored")
+		for name, contents := range files {
+			fw, err := mw.CreateFormFile("file", name)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(fw, strings.NewReader(contents)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+
+	resp, err := http.Post(url+"/files", mw.FormDataContentType(), pr)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func uploaded(t *testing.T, resp *http.Response) []file {
+	t.Helper()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var files []file
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&files))
+	return files
+}
+
+func get(t *testing.T, url string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(b)
+}
+
+func TestUploadListDownload(t *testing.T) {
+	srv, _ := startFiles(t, 1<<20, 1<<20)
+
+	files := uploaded(t, upload(t, srv.URL, map[string]string{"hello.txt": "hello, world"}))
+	require.Len(t, files, 1)
+	f := files[0]
+	assert.Equal(t, sum("hello, world"), f.ID)
+	assert.Equal(t, "hello.txt", f.Name)
+
+	resp, body := get(t, srv.URL+"/files", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var list []file
+	require.NoError(t, json.Unmarshal([]byte(body), &list))
+	assert.Equal(t, []file{f}, list)
+
+	resp, body = get(t, srv.URL+"/files/"+f.ID, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello, world", body)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `"`+f.ID+`"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello.txt", params["filename"])
+}
+
+// readFromRecorder is a ResponseRecorder with the ReadFrom a real response
+// has, which is where net/http uses sendfile
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	calls int
+}
+
+func (r *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.calls++
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func TestDownloadReadFrom(t *testing.T) {
+	for _, rate := range []int{0, 1 << 20} {
+		s := newTestStore(t, 1<<20)
+		h := newHandler(s, 1<<20, rate, quiet)
+		srv := httptest.NewServer(h)
+		t.Cleanup(srv.Close)
+		id := uploaded(t, upload(t, srv.URL, map[string]string{"a.txt": "hello, world"}))[0].ID
+
+		w := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/"+id, nil))
+		assert.Equal(t, "hello, world", w.Body.String(), "rate %d", rate)
+		if rate == 0 {
+			assert.Equal(t, 1, w.calls, "the response's ReadFrom, so sendfile, is still reached")
+		} else {
+			assert.Zero(t, w.calls, "a throttled download is paced through Write")
+		}
+	}
+}
+
+func TestUploadSeveral(t *testing.T) {
+	srv, s := startFiles(t, 1<<20, 1<<20)
+
+	files := uploaded(t, upload(t, srv.URL, map[string]string{"a.txt": "aaa", "b.txt": "bbbb", "c.txt": "aaa"}))
+	assert.Len(t, files, 3)
+	assert.Equal(t, int64(7), s.Used(), "c.txt is a duplicate of a.txt")
+}
+
+func TestRanges(t *testing.T) {
+	srv, _ := startFiles(t, 1<<20, 1<<20)
+	contents := "0123456789abcdefghijklmnopqrstuvwxyz"
+	id := uploaded(t, upload(t, srv.URL, map[string]string{"alnum.txt": contents}))[0].ID
+	url := srv.URL + "/files/" + id
+
+	tests := []struct {
+		rng        string
+		wantStatus int
+		wantBody   string
+		wantRange  string
+	}{
+		{"bytes=0-9", http.StatusPartialContent, "0123456789", "bytes 0-9/36"},
+		{"bytes=30-", http.StatusPartialContent, "uvwxyz", "bytes 30-35/36"},
+		{"bytes=-3", http.StatusPartialContent, "xyz", "bytes 33-35/36"},
+		{"bytes=100-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */36"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rng, func(t *testing.T) {
+			resp, body := get(t, url, map[string]string{"Range": tt.rng})
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantRange, resp.Header.Get("Content-Range"))
+			if tt.wantStatus == http.StatusPartialContent {
+				assert.Equal(t, tt.wantBody, body)
+			}
+		})
+	}
+
+	t.Run("several ranges", func(t *testing.T) {
+		resp, body := get(t, url, map[string]string{"Range": "bytes=0-1,10-11"})
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		mt, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/byteranges", mt)
+
+		mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+		var parts []string
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			b, _ := io.ReadAll(p)
+			parts = append(parts, p.Header.Get("Content-Range")+" "+string(b))
+		}
+		assert.Equal(t, []string{"bytes 0-1/36 01", "bytes 10-11/36 ab"}, parts)
+	})
+
+	t.Run("if-range", func(t *testing.T) {
+		resp, body := get(t, url, map[string]string{"Range": "bytes=0-1", "If-Range": `"` + id + `"`})
+		assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		assert.Equal(t, "01", body)
+
+		// a stale validator gets the whole thing instead
+		resp, body = get(t, url, map[string]string{"Range": "bytes=0-1", "If-Range": `"stale"`})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, contents, body)
+	})
+}
+
+func TestThrottledDownload(t *testing.T) {
+	s := newTestStore(t, 1<<20)
+	srv := httptest.NewServer(newHandler(s, 1<<20, 1000, quiet))
+	t.Cleanup(srv.Close)
+	clk := s.clk.(*clock.Fake)
+
+	contents := strings.Repeat("0123456789", 100)
+	id := uploaded(t, upload(t, srv.URL, map[string]string{"slow.txt": contents}))[0].ID
+	url := srv.URL + "/files/" + id
+
+	// 1000 bytes at 1000 a second, 100 at a time: the first 100 go
+	// straight away and the rest need 900ms of fake time
+	done := make(chan string)
+	go func() {
+		_, body := get(t, url, nil)
+		done <- body
+	}()
+	for i := 0; i < 9; i++ {
+		clk.BlockUntil(1)
+		select {
+		case <-done:
+			t.Fatalf("finished after %d00ms", i)
+		default:
+		}
+		clk.Advance(100 * time.Millisecond)
+	}
+	assert.Equal(t, contents, <-done)
+
+	// ranges go through the same writer, and only what's sent is paid for
+	resp, body := get(t, url, map[string]string{"Range": "bytes=10-59"})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, contents[10:60], body)
+}
+
+// logBuffer is a bytes.Buffer for a logger that handlers write to while
+// the test reads it
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTransferLog(t *testing.T) {
+	var logs logBuffer
+	s := newTestStore(t, 1<<20)
+	srv := httptest.NewServer(newHandler(s, 1<<20, 0, log.New(&logs, "", 0)))
+	t.Cleanup(srv.Close)
+
+	id := uploaded(t, upload(t, srv.URL, map[string]string{"a.txt": "hello, world"}))[0].ID
+	assert.Equal(t, "files: receiving \"a.txt\": 12 bytes\n", logs.String(), "a small upload only logs when it's done")
+
+	get(t, srv.URL+"/files/"+id, map[string]string{"Range": "bytes=0-4"})
+	get(t, srv.URL+"/files/"+id, map[string]string{"If-None-Match": `"` + id + `"`})
+	assert.Eventually(t, func() bool {
+		return strings.HasSuffix(logs.String(), "files: sending "+id+": 5 of 12 bytes\n")
+	}, time.Second, time.Millisecond, "a range is logged as part of the file, and a 304 sends nothing to log")
+}
+
+// uploadFields posts fields as one multipart form, in order
+func uploadFields(t *testing.T, url string, fields ...[2]string) *http.Response {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, f := range fields {
+		if f[0] == "file" {
+			fw, err := mw.CreateFormFile("file", "upload.txt")
+			require.NoError(t, err)
+			io.WriteString(fw, f[1])
+			continue
+		}
+		mw.WriteField(f[0], f[1])
+	}
+	require.NoError(t, mw.Close())
+
+	resp, err := http.Post(url+"/files", mw.FormDataContentType(), &buf)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestUploadChecksum(t *testing.T) {
+	srv, s := startFiles(t, 1<<20, 1<<20)
+
+	files := uploaded(t, uploadFields(t, srv.URL,
+		[2]string{"sha256", sum("one")}, [2]string{"file", "one"},
+		[2]string{"file", "no sum, anything goes"},
+	))
+	assert.Len(t, files, 2)
+
+	resp := uploadFields(t, srv.URL, [2]string{"sha256", sum("sent")}, [2]string{"file", "corrupted"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	b, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(b), "checksum: mismatch")
+
+	resp = uploadFields(t, srv.URL, [2]string{"sha256", "not hex"}, [2]string{"file", "x"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// the sum is for the next file only
+	resp = uploadFields(t, srv.URL, [2]string{"sha256", sum("a")}, [2]string{"file", "a"}, [2]string{"file", "b"})
+	assert.Len(t, uploaded(t, resp), 2)
+
+	list, err := s.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 4)
+}
+
+func TestConditionalDownload(t *testing.T) {
+	srv, _ := startFiles(t, 1<<20, 1<<20)
+	id := uploaded(t, upload(t, srv.URL, map[string]string{"a.txt": "aaa"}))[0].ID
+
+	resp, body := get(t, srv.URL+"/files/"+id, map[string]string{"If-None-Match": `"` + id + `"`})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Empty(t, body)
+}
+
+func TestUploadLimits(t *testing.T) {
+	t.Run("too large", func(t *testing.T) {
+		srv, s := startFiles(t, 1<<20, 1000)
+		resp := upload(t, srv.URL, map[string]string{"big.bin": strings.Repeat("x", 200<<10)})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+		assert.Zero(t, s.Used())
+	})
+
+	t.Run("over quota while streaming", func(t *testing.T) {
+		srv, s := startFiles(t, 1000, 1<<20)
+		resp := upload(t, srv.URL, map[string]string{"big.bin": strings.Repeat("x", 200<<10)})
+		assert.Equal(t, http.StatusInsufficientStorage, resp.StatusCode)
+		assert.Zero(t, s.Used())
+	})
+
+	t.Run("over quota at the end", func(t *testing.T) {
+		// small enough to get past the body limit's allowance for multipart
+		// overhead, so it's the store that says no
+		srv, s := startFiles(t, 1000, 1<<20)
+		resp := upload(t, srv.URL, map[string]string{"a.bin": strings.Repeat("x", 1001)})
+		assert.Equal(t, http.StatusInsufficientStorage, resp.StatusCode)
+		assert.Zero(t, s.Used())
+	})
+
+	t.Run("full", func(t *testing.T) {
+		srv, _ := startFiles(t, 3, 1<<20)
+		uploaded(t, upload(t, srv.URL, map[string]string{"a.txt": "aaa"}))
+		resp := upload(t, srv.URL, map[string]string{"b.txt": "b"})
+		assert.Equal(t, http.StatusInsufficientStorage, resp.StatusCode)
+	})
+}
+
+func TestBadRequests(t *testing.T) {
+	srv, _ := startFiles(t, 1<<20, 1<<20)
+
+	resp, err := http.Post(srv.URL+"/files", "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "not multipart")
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("note", "no file here")
+	mw.Close()
+	resp, err = http.Post(srv.URL+"/files", mw.FormDataContentType(), &buf)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "no file part")
+
+	for _, path := range []string{"/files/" + sum("missing"), "/files/..%2F..%2Fetc%2Fpasswd", "/files/nope"} {
+		resp, _ := get(t, srv.URL+path, nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/files/"+sum("x"), nil)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestUnicodeFilename(t *testing.T) {
+	srv, _ := startFiles(t, 1<<20, 1<<20)
+	id := uploaded(t, upload(t, srv.URL, map[string]string{"naïve café.txt": "☕"}))[0].ID
+
+	resp, _ := get(t, srv.URL+"/files/"+id, nil)
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+	require.NoError(t, err)
+	assert.Equal(t, "naïve café.txt", params["filename"], fmt.Sprint(resp.Header))
+}
@@ -0,0 +1,90 @@
+// The file sharing app stores uploads on disk by content hash and serves
+// them back with range support. Run it with
+//
+//	go run ./apps/files -dir ./uploads
+//
+// then upload with curl -F file=@photo.jpg localhost:8080/files. Server
+// settings come from pkg/config, as for the other apps, with FILES_CONFIG
+// naming the YAML file.
+//
+// -download-rate 10000 holds every download to 10KB/s, for watching how a
+// client behaves on a slow link
+package main
+
+import (
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/thorntonmc/go-practice/pkg/admin"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"github.com/thorntonmc/go-practice/pkg/config"
+	"github.com/thorntonmc/go-practice/pkg/envconfig"
+	"github.com/thorntonmc/go-practice/pkg/lifecycle"
+	"github.com/thorntonmc/go-practice/pkg/server"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func main() {
+	var env struct {
+		ConfigPath string `env:"FILES_CONFIG"`
+		Dir        string `env:"FILES_DIR,default=uploads"`
+		Quota      int64  `env:"FILES_QUOTA,default=1073741824"`
+		MaxUpload  int64  `env:"FILES_MAX_UPLOAD,default=104857600"`
+		// bytes per second for each download, 0 for as fast as it goes
+		DownloadRate int `env:"FILES_DOWNLOAD_RATE"`
+	}
+	if err := envconfig.Process(os.LookupEnv, &env); err != nil {
+		log.Fatal(err)
+	}
+
+	path := flag.String("config", env.ConfigPath, "path to a YAML config file")
+	dir := flag.String("dir", env.Dir, "directory to store files in")
+	quota := flag.Int64("quota", env.Quota, "total bytes that may be stored")
+	maxUpload := flag.Int64("max-upload", env.MaxUpload, "largest single upload in bytes")
+	downloadRate := flag.Int("download-rate", env.DownloadRate, "cap each download at this many bytes a second, 0 for no cap")
+	showVersion := version.AddFlag(flag.CommandLine)
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("files", version.Get())
+		return
+	}
+
+	cfg, err := config.Load(*path, os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s, err := openStore(*dir, *quota, clock.New())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := server.FromConfig(cfg.Server, newHandler(s, *maxUpload, *downloadRate, log.Default()))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	lc := lifecycle.New(log.Default())
+	// the admin server is added first so it stops last, and stats can be
+	// watched while the rest winds down
+	stats := admin.New("files",
+		admin.WithCounter("used_bytes", expvar.Func(func() any { return s.Used() })),
+		admin.WithCounter("remaining_bytes", expvar.Func(func() any { return s.Remaining() })),
+	)
+	if adm := server.Admin(cfg.Server, stats); adm != nil {
+		lc.Append(lifecycle.HTTPServer("admin", adm))
+	}
+	// an upload in flight gets to finish, rather than leave a temp file behind
+	lc.Append(lifecycle.HTTPServer("http", srv))
+
+	log.Printf("files: listening on %s, storing in %s (%d of %d bytes used)", cfg.Server.Addr, *dir, s.Used(), *quota)
+	if err := lc.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
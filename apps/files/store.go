@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/checksum"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// file is what's known about an upload, listed as JSON
+type file struct {
+	ID          string    `json:"id"` // sha256 of the contents, in hex
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+var (
+	errNotFound = errors.New("file not found")
+	errQuota    = errors.New("storage quota exceeded")
+)
+
+// diskStore is content-addressable storage: a file is named after the
+// sha256 of its contents rather than anything the uploader chose. That
+// gets a few things for free:
+//
+//   - uploading the same bytes twice stores them once
+//   - names can't collide, or be used to escape the directory
+//   - the id is a perfect ETag, the contents behind it can never change
+//
+// The layout is
+//
+//	dir/tmp/             uploads in progress
+//	dir/blobs/ab/abcd…   contents, fanned out by the first two hex digits
+//	dir/meta/abcd….json  the file record
+//
+// An upload is written to tmp while being hashed, since the name isn't
+// known until the last byte, then renamed into place. Rename within one
+// filesystem is atomic, so a reader never sees half a blob
+type diskStore struct {
+	dir   string
+	quota int64
+	clk   clock.Clock
+
+	mu   sync.Mutex
+	used int64
+}
+
+func openStore(dir string, quota int64, clk clock.Clock) (*diskStore, error) {
+	s := &diskStore{dir: dir, quota: quota, clk: clk}
+
+	// anything left in tmp is from uploads a crash interrupted
+	if err := os.RemoveAll(filepath.Join(dir, "tmp")); err != nil {
+		return nil, err
+	}
+	for _, sub := range []string{"tmp", "blobs", "meta"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		s.used += f.Size
+	}
+	return s, nil
+}
+
+// Used and Remaining are bytes, against the quota
+func (s *diskStore) Used() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+func (s *diskStore) Remaining() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quota - s.used
+}
+
+// validID stops an id from the URL being anything but a file name
+func validID(id string) bool {
+	if len(id) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if !('0' <= id[i] && id[i] <= '9' || 'a' <= id[i] && id[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *diskStore) blobPath(id string) string {
+	return filepath.Join(s.dir, "blobs", id[:2], id)
+}
+
+func (s *diskStore) metaPath(id string) string {
+	return filepath.Join(s.dir, "meta", id+".json")
+}
+
+// Put streams r to disk. Contents that are already stored keep their first
+// record, name and all. errQuota means storing it would go over the quota.
+//
+// With want set to the hex sha256 the uploader says the contents have, a
+// stream that doesn't match - corrupted, or cut short - fails with
+// checksum.ErrMismatch and isn't stored
+func (s *diskStore) Put(r io.Reader, name, want string) (file, error) {
+	// uploads can run at the same time, so each gets its own directory in
+	// tmp to stage in. WriteFileAtomicWithChecksum hashes and syncs it, and
+	// the rename into blobs below makes it visible
+	stage, err := os.MkdirTemp(filepath.Join(s.dir, "tmp"), "upload-*")
+	if err != nil {
+		return file{}, err
+	}
+	defer os.RemoveAll(stage) // empty once the blob's been renamed out
+	staged := filepath.Join(stage, "blob")
+
+	// the first 512 bytes are all http.DetectContentType looks at. Peek
+	// gets them without consuming anything from the stream
+	br := bufio.NewReaderSize(r, 512)
+	head, _ := br.Peek(512)
+	f := file{Name: name, ContentType: http.DetectContentType(head), UploadedAt: s.clk.Now()}
+
+	if f.ID, f.Size, err = checksum.WriteFileAtomicWithChecksum(staged, br, want); err != nil {
+		return file{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, err := s.Get(f.ID); err == nil {
+		return existing, nil
+	}
+	if s.used+f.Size > s.quota {
+		return file{}, errQuota
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.blobPath(f.ID)), 0o755); err != nil {
+		return file{}, err
+	}
+	if err := os.Rename(staged, s.blobPath(f.ID)); err != nil {
+		return file{}, err
+	}
+	if err := s.writeMeta(f); err != nil {
+		os.Remove(s.blobPath(f.ID))
+		return file{}, err
+	}
+	s.used += f.Size
+	return f, nil
+}
+
+// writeMeta goes through tmp and a rename as well, the record existing is
+// what makes a file visible
+func (s *diskStore) writeMeta(f file) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, "tmp", f.ID+".json")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.metaPath(f.ID))
+}
+
+func (s *diskStore) Get(id string) (file, error) {
+	if !validID(id) {
+		return file{}, errNotFound
+	}
+	b, err := os.ReadFile(s.metaPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return file{}, errNotFound
+	}
+	if err != nil {
+		return file{}, err
+	}
+	var f file
+	return f, json.Unmarshal(b, &f)
+}
+
+// Open returns the contents and record for id. The caller closes the file
+func (s *diskStore) Open(id string) (*os.File, file, error) {
+	f, err := s.Get(id)
+	if err != nil {
+		return nil, file{}, err
+	}
+	blob, err := os.Open(s.blobPath(id))
+	if err != nil {
+		return nil, file{}, err
+	}
+	return blob, f, nil
+}
+
+// List returns every file, oldest first
+func (s *diskStore) List() ([]file, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, "meta"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]file, 0, len(entries))
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		f, err := s.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].UploadedAt.Equal(files[j].UploadedAt) {
+			return files[i].UploadedAt.Before(files[j].UploadedAt)
+		}
+		return files[i].ID < files[j].ID
+	})
+	return files, nil
+}
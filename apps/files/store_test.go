@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/checksum"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func newTestStore(t *testing.T, quota int64) *diskStore {
+	s, err := openStore(t.TempDir(), quota, clock.NewFake(testNow))
+	require.NoError(t, err)
+	return s
+}
+
+func TestStorePutAndOpen(t *testing.T) {
+	s := newTestStore(t, 1<<20)
+
+	f, err := s.Put(strings.NewReader("hello, world"), "hello.txt", "")
+	require.NoError(t, err)
+	assert.Equal(t, file{
+		ID:          sum("hello, world"),
+		Name:        "hello.txt",
+		Size:        12,
+		ContentType: "text/plain; charset=utf-8",
+		UploadedAt:  testNow,
+	}, f)
+	assert.Equal(t, int64(12), s.Used())
+
+	blob, got, err := s.Open(f.ID)
+	require.NoError(t, err)
+	defer blob.Close()
+	assert.Equal(t, f, got)
+	b, err := io.ReadAll(blob)
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", string(b))
+
+	assert.FileExists(t, filepath.Join(s.dir, "blobs", f.ID[:2], f.ID))
+	entries, err := os.ReadDir(filepath.Join(s.dir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "nothing left behind")
+}
+
+func TestStoreDeduplicates(t *testing.T) {
+	s := newTestStore(t, 1<<20)
+
+	first, err := s.Put(strings.NewReader("same bytes"), "a.txt", "")
+	require.NoError(t, err)
+	second, err := s.Put(strings.NewReader("same bytes"), "b.txt", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second, "the first upload's record wins")
+	assert.Equal(t, int64(10), s.Used(), "counted once")
+
+	files, err := s.List()
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestStoreQuota(t *testing.T) {
+	s := newTestStore(t, 10)
+
+	_, err := s.Put(strings.NewReader("123456"), "a", "")
+	require.NoError(t, err)
+	_, err = s.Put(strings.NewReader("123456"), "b", "")
+	assert.NoError(t, err, "duplicates cost nothing")
+	_, err = s.Put(strings.NewReader("abcdef"), "c", "")
+	assert.ErrorIs(t, err, errQuota)
+	assert.Equal(t, int64(4), s.Remaining())
+}
+
+func TestStoreChecksum(t *testing.T) {
+	s := newTestStore(t, 1<<20)
+
+	f, err := s.Put(strings.NewReader("checked"), "ok.txt", sum("checked"))
+	require.NoError(t, err)
+	assert.Equal(t, sum("checked"), f.ID)
+
+	// what arrived isn't what was sent, whether changed or cut short
+	for _, got := range []string{"chucked", "check"} {
+		_, err = s.Put(strings.NewReader(got), "bad.txt", sum("checked"))
+		assert.ErrorIs(t, err, checksum.ErrMismatch, got)
+	}
+	assert.Equal(t, int64(7), s.Used())
+	files, err := s.List()
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.NoFileExists(t, s.blobPath(sum("chucked")))
+	entries, err := os.ReadDir(filepath.Join(s.dir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "nothing left behind")
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openStore(dir, 1<<20, clock.NewFake(testNow))
+	require.NoError(t, err)
+	_, err = s.Put(strings.NewReader("one"), "1.txt", "")
+	require.NoError(t, err)
+	_, err = s.Put(strings.NewReader("three"), "3.txt", "")
+	require.NoError(t, err)
+
+	// a crash mid-upload leaves a temporary file
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tmp", "upload-123"), []byte("partial"), 0o644))
+
+	s, err = openStore(dir, 1<<20, clock.NewFake(testNow))
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), s.Used())
+	assert.NoFileExists(t, filepath.Join(dir, "tmp", "upload-123"))
+}
+
+func TestStoreNotFound(t *testing.T) {
+	s := newTestStore(t, 1<<20)
+
+	for _, id := range []string{sum("nothing"), "../../etc/passwd", "abc", strings.ToUpper(sum("x"))} {
+		_, _, err := s.Open(id)
+		assert.ErrorIs(t, err, errNotFound, id)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/url"
+	"strings"
+
+	jsonconcept "github.com/thorntonmc/go-practice/concepts/json"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// maxBodyBytes caps request bodies, a link is a URL and a couple of flags
+const maxBodyBytes = 16 << 10
+
+// maxCodeAttempts bounds retries when a new code is already taken
+const maxCodeAttempts = 5
+
+// metrics are published at /debug/vars by expvar, as JSON. Per-link counts
+// live in the store, these are totals for the whole process
+var metrics = expvar.NewMap("shortener")
+
+// newHandler routes:
+//
+//	POST /api/links         create, 201 with the link
+//	GET  /api/links/{code}  the link, with its hit count
+//	GET  /{code}            redirect to the link's URL
+//	GET  /debug/vars        metrics
+//
+// newCode picks codes for links that didn't ask for one. nil means
+// sequential codes, assigned by the store
+func newHandler(s store, newCode func() (string, error), clk clock.Clock) http.Handler {
+	h := &handler{store: s, newCode: newCode, clk: clk}
+
+	m := http.NewServeMux()
+	m.HandleFunc("/api/links", h.create)
+	m.HandleFunc("/api/links/", h.info)
+	m.Handle("/debug/vars", expvar.Handler())
+	m.HandleFunc("/", h.redirect)
+	return m
+}
+
+type handler struct {
+	store   store
+	newCode func() (string, error)
+	clk     clock.Clock
+}
+
+type createRequest struct {
+	URL       string `json:"url"`
+	Code      string `json:"code"` // optional custom code
+	Permanent bool   `json:"permanent"`
+}
+
+type createResponse struct {
+	link
+	ShortURL string `json:"short_url"`
+}
+
+func (h *handler) create(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := jsonconcept.Decode[createRequest](r.Body, jsonconcept.DisallowUnknownFields(), jsonconcept.MaxBytes(maxBodyBytes))
+	if err != nil {
+		jsonconcept.WriteDecodeError(w, err)
+		return
+	}
+	if err := checkURL(req.URL, r.Host); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Code != "" && !validCode(req.Code) {
+		writeError(w, http.StatusBadRequest, errors.New("code must be 3-32 letters, digits, - or _"))
+		return
+	}
+
+	l := link{URL: req.URL, Code: req.Code, Permanent: req.Permanent, CreatedAt: h.clk.Now()}
+	if req.Code != "" {
+		// a custom code that's taken is the client's problem
+		l, err = h.store.Create(r.Context(), l)
+	} else {
+		l, err = h.createWithNewCode(r, l)
+	}
+	switch {
+	case errors.Is(err, errCodeTaken):
+		writeError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	metrics.Add("created", 1)
+	w.Header().Set("Location", "/api/links/"+l.Code)
+	writeJSON(w, http.StatusCreated, createResponse{link: l, ShortURL: shortURL(r, l.Code)})
+}
+
+// createWithNewCode retries on the rare collision - between random codes,
+// or a sequential code and someone's custom one
+func (h *handler) createWithNewCode(r *http.Request, l link) (link, error) {
+	for i := 0; i < maxCodeAttempts; i++ {
+		if h.newCode != nil {
+			code, err := h.newCode()
+			if err != nil {
+				return link{}, err
+			}
+			l.Code = code
+		}
+		created, err := h.store.Create(r.Context(), l)
+		if !errors.Is(err, errCodeTaken) {
+			return created, err
+		}
+	}
+	return link{}, errCodeTaken
+}
+
+// checkURL only accepts absolute http(s) URLs, and not ones back to the
+// shortener itself - a short link to a short link can loop forever
+func checkURL(raw, host string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if strings.EqualFold(u.Host, host) {
+		return errors.New("url can't point back at this shortener")
+	}
+	return nil
+}
+
+func shortURL(r *http.Request, code string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/" + code
+}
+
+func (h *handler) info(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	l, err := h.store.Get(r.Context(), strings.TrimPrefix(r.URL.Path, "/api/links/"))
+	switch {
+	case errors.Is(err, errNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, nil)
+	default:
+		writeJSON(w, http.StatusOK, l)
+	}
+}
+
+// redirect sends the client on. The status matters more than it looks:
+//
+//   - 302 Found is temporary. The browser asks again every time, so every
+//     visit is counted and the target can be changed later
+//   - 301 Moved Permanently is cached, often forever. Later visits never
+//     reach us - no hit counted, no way to change where the link goes - but
+//     it's one round trip less, and search engines pass ranking on to the
+//     target
+//
+// 307 and 308 are the same pair but promise to keep the method and body,
+// which matters for POSTs, not for links people click
+func (h *handler) redirect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, "/")
+	l, err := h.store.Get(r.Context(), code)
+	switch {
+	case errors.Is(err, errNotFound):
+		metrics.Add("not_found", 1)
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	// a HEAD is a link checker or a preview, not a visit
+	if r.Method == http.MethodGet {
+		if err := h.store.Hit(r.Context(), code); err == nil {
+			metrics.Add("redirects", 1)
+		}
+	}
+
+	status := http.StatusFound
+	if l.Permanent {
+		status = http.StatusMovedPermanently
+	} else {
+		// stop proxies and browsers caching the temporary redirect
+		w.Header().Set("Cache-Control", "private, max-age=0")
+	}
+	w.Header().Set("Location", l.URL)
+	w.WriteHeader(status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes {"error": ...}. A nil err is an internal error, whose
+// details aren't for the client
+func writeError(w http.ResponseWriter, status int, err error) {
+	msg := http.StatusText(status)
+	if err != nil {
+		msg = err.Error()
+	}
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestHandler(newCode func() (string, error)) http.Handler {
+	return newHandler(newMemoryStore(), newCode, clock.NewFake(testNow))
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func create(t *testing.T, h http.Handler, body string) createResponse {
+	t.Helper()
+	rec := do(t, h, http.MethodPost, "/api/links", body)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var got createResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	return got
+}
+
+func counter(name string) int64 {
+	if v, ok := metrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestCreateAndRedirect(t *testing.T) {
+	h := newTestHandler(nil)
+
+	rec := do(t, h, http.MethodPost, "/api/links", `{"url":"https://example.org/some/long/path"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Equal(t, "/api/links/1", rec.Header().Get("Location"))
+	var got createResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "1", got.Code)
+	assert.Equal(t, "http://example.com/1", got.ShortURL) // httptest's Host
+	assert.Equal(t, testNow, got.CreatedAt)
+
+	before := counter("redirects")
+	rec = do(t, h, http.MethodGet, "/1", "")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://example.org/some/long/path", rec.Header().Get("Location"))
+	assert.Equal(t, "private, max-age=0", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, before+1, counter("redirects"))
+
+	assert.Equal(t, "2", create(t, h, `{"url":"https://example.org/b"}`).Code)
+}
+
+func TestPermanentRedirect(t *testing.T) {
+	h := newTestHandler(nil)
+	create(t, h, `{"url":"https://example.org/docs","code":"docs","permanent":true}`)
+
+	rec := do(t, h, http.MethodGet, "/docs", "")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "https://example.org/docs", rec.Header().Get("Location"))
+	assert.Empty(t, rec.Header().Get("Cache-Control"))
+}
+
+func TestHitCounting(t *testing.T) {
+	h := newTestHandler(nil)
+	create(t, h, `{"url":"https://example.org"}`)
+
+	for i := 0; i < 3; i++ {
+		do(t, h, http.MethodGet, "/1", "")
+	}
+	// HEAD redirects too, but isn't a visit
+	rec := do(t, h, http.MethodHead, "/1", "")
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	rec = do(t, h, http.MethodGet, "/api/links/1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var l link
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &l))
+	assert.Equal(t, int64(3), l.Hits)
+}
+
+func TestNotFound(t *testing.T) {
+	h := newTestHandler(nil)
+	before := counter("not_found")
+
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodGet, "/nope", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodGet, "/", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodGet, "/api/links/nope", "").Code)
+	assert.Equal(t, before+2, counter("not_found"))
+}
+
+func TestCreateInvalid(t *testing.T) {
+	h := newTestHandler(nil)
+	create(t, h, `{"url":"https://example.org","code":"taken"}`)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"not json", `{`, http.StatusBadRequest},
+		{"unknown field", `{"url":"https://example.org","title":"x"}`, http.StatusBadRequest},
+		{"no url", `{}`, http.StatusBadRequest},
+		{"relative", `{"url":"/somewhere"}`, http.StatusBadRequest},
+		{"not http", `{"url":"javascript:alert(1)"}`, http.StatusBadRequest},
+		{"loop", `{"url":"http://example.com/1"}`, http.StatusBadRequest},
+		{"bad code", `{"url":"https://example.org","code":"a/b"}`, http.StatusBadRequest},
+		{"taken code", `{"url":"https://example.org","code":"taken"}`, http.StatusConflict},
+		{"too big", `{"url":"https://example.org/` + strings.Repeat("a", maxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(t, h, http.MethodPost, "/api/links", tt.body)
+			assert.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestRandomCodesRetryCollisions(t *testing.T) {
+	codes := []string{"aaaaaaa", "aaaaaaa", "aaaaaaa", "bbbbbbb"}
+	h := newTestHandler(func() (string, error) {
+		c := codes[0]
+		codes = codes[1:]
+		return c, nil
+	})
+
+	assert.Equal(t, "aaaaaaa", create(t, h, `{"url":"https://example.org/1"}`).Code)
+	assert.Equal(t, "bbbbbbb", create(t, h, `{"url":"https://example.org/2"}`).Code)
+}
+
+func TestRandomCodesGiveUp(t *testing.T) {
+	h := newTestHandler(func() (string, error) { return "same", nil })
+	create(t, h, `{"url":"https://example.org/1"}`)
+
+	rec := do(t, h, http.MethodPost, "/api/links", `{"url":"https://example.org/2"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	h = newTestHandler(func() (string, error) { return "", errors.New("no entropy") })
+	rec = do(t, h, http.MethodPost, "/api/links", `{"url":"https://example.org/2"}`)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "entropy")
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	h := newTestHandler(nil)
+
+	rec := do(t, h, http.MethodGet, "/api/links", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "POST", rec.Header().Get("Allow"))
+
+	rec = do(t, h, http.MethodPost, "/abc", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+
+	rec = do(t, h, http.MethodDelete, "/api/links/abc", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestDebugVars(t *testing.T) {
+	h := newTestHandler(nil)
+	rec := do(t, h, http.MethodGet, "/debug/vars", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var vars map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &vars))
+	assert.Contains(t, vars, "shortener")
+}
+
+// the whole thing over a real connection, with a client that doesn't
+// follow redirects so we can look at them
+func TestServer(t *testing.T) {
+	srv := httptest.NewServer(newTestHandler(randomCode))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Post(srv.URL+"/api/links", "application/json", strings.NewReader(`{"url":"https://example.org"}`))
+	require.NoError(t, err)
+	var got createResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Len(t, got.Code, randomCodeLen)
+	assert.Equal(t, srv.URL+"/"+got.Code, got.ShortURL)
+
+	c := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = c.Get(got.ShortURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "https://example.org", resp.Header.Get("Location"))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+type link struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url"`
+	Permanent bool      `json:"permanent"`
+	Hits      int64     `json:"hits"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var (
+	errNotFound  = errors.New("link not found")
+	errCodeTaken = errors.New("code already in use")
+)
+
+/*
+ *
+ * short codes
+ *
+ */
+
+// Codes are written in base 62 - digits and both cases of letters - the
+// densest alphabet that's safe in a URL path without escaping. Six
+// characters give 62^6, about 57 billion codes.
+//
+// There are two ways to pick one:
+//
+//   - sequential: encode the row's auto-increment id. Short, and never
+//     collides with another sequential code, but anyone can walk every link
+//     by counting, and can tell how many links there are
+//   - random: crypto/rand characters. Unguessable, at the cost of a few
+//     more characters and a retry on the rare collision
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func encodeBase62(n uint64) string {
+	if n == 0 {
+		return "0"
+	}
+	var b [11]byte // 62^11 > 2^64
+	i := len(b)
+	for n > 0 {
+		i--
+		b[i] = base62[n%62]
+		n /= 62
+	}
+	return string(b[i:])
+}
+
+func decodeBase62(s string) (uint64, bool) {
+	if s == "" || len(s) > 11 {
+		return 0, false
+	}
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(base62, s[i])
+		if d < 0 {
+			return 0, false
+		}
+		next := n*62 + uint64(d)
+		if next/62 != n {
+			return 0, false // overflowed
+		}
+		n = next
+	}
+	return n, true
+}
+
+// randomCodeLen is long enough that collisions stay rare until there are
+// tens of millions of links
+const randomCodeLen = 7
+
+func randomCode() (string, error) {
+	b := make([]byte, randomCodeLen)
+	max := big.NewInt(int64(len(base62)))
+	for i := range b {
+		// rand.Int rather than byte % 62, which would favour the first
+		// few characters
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = base62[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// validCode is what a client may ask for as a custom code. The "api" prefix
+// is taken by the API's own routes
+func validCode(code string) bool {
+	if len(code) < 3 || len(code) > 32 || code == "api" {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if strings.IndexByte(base62, code[i]) < 0 && code[i] != '-' && code[i] != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ *
+ * storage
+ *
+ */
+
+// store is everything the handlers need from storage
+type store interface {
+	// Create saves l. With an empty Code the store assigns the sequential
+	// code for the new row's id. A code already in use is errCodeTaken
+	Create(ctx context.Context, l link) (link, error)
+	Get(ctx context.Context, code string) (link, error)
+	// Hit counts one redirect through code
+	Hit(ctx context.Context, code string) error
+}
+
+// memoryStore keeps links in a map, which is plenty for trying the app out
+type memoryStore struct {
+	mu     sync.RWMutex
+	links  map[string]*link
+	nextID uint64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{links: map[string]*link{}, nextID: 1}
+}
+
+func (m *memoryStore) Create(ctx context.Context, l link) (link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextID
+	m.nextID++ // used even if the code turns out to be taken, like a database sequence
+	if l.Code == "" {
+		l.Code = encodeBase62(id)
+	}
+	if _, ok := m.links[l.Code]; ok {
+		return link{}, errCodeTaken
+	}
+
+	stored := l
+	m.links[l.Code] = &stored
+	return l, nil
+}
+
+func (m *memoryStore) Get(ctx context.Context, code string) (link, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	l, ok := m.links[code]
+	if !ok {
+		return link{}, errNotFound
+	}
+	return *l, nil
+}
+
+func (m *memoryStore) Hit(ctx context.Context, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.links[code]
+	if !ok {
+		return errNotFound
+	}
+	l.Hits++
+	return nil
+}
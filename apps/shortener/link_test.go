@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBase62(t *testing.T) {
+	for _, n := range []uint64{0, 1, 61, 62, 3843, 3844, 1 << 40, ^uint64(0)} {
+		s := encodeBase62(n)
+		got, ok := decodeBase62(s)
+		require.True(t, ok, s)
+		assert.Equal(t, n, got, s)
+	}
+	assert.Equal(t, "10", encodeBase62(62))
+	assert.Equal(t, "LygHa16AHYF", encodeBase62(^uint64(0)))
+
+	for _, bad := range []string{"", "a-b", "LygHa16AHYG", "000000000000"} {
+		_, ok := decodeBase62(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestRandomCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		c, err := randomCode()
+		require.NoError(t, err)
+		assert.Len(t, c, randomCodeLen)
+		assert.True(t, validCode(c), c)
+		assert.False(t, seen[c], "duplicate %s", c)
+		seen[c] = true
+	}
+}
+
+func TestValidCode(t *testing.T) {
+	for _, ok := range []string{"abc", "my-link", "Go_2024"} {
+		assert.True(t, validCode(ok), ok)
+	}
+	for _, bad := range []string{"", "ab", "api", "has space", "a/b", "ünï", string(make([]byte, 33))} {
+		assert.False(t, validCode(bad), bad)
+	}
+}
+
+// testStore runs the same checks against every store
+func testStore(t *testing.T, s store) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	a, err := s.Create(ctx, link{URL: "https://example.com/a", CreatedAt: now})
+	require.NoError(t, err)
+	assert.Equal(t, "1", a.Code)
+	b, err := s.Create(ctx, link{URL: "https://example.com/b", CreatedAt: now})
+	require.NoError(t, err)
+	assert.Equal(t, "2", b.Code)
+
+	custom, err := s.Create(ctx, link{Code: "docs", URL: "https://example.com/docs", Permanent: true, CreatedAt: now})
+	require.NoError(t, err)
+	assert.Equal(t, "docs", custom.Code)
+
+	_, err = s.Create(ctx, link{Code: "docs", URL: "https://example.com/other", CreatedAt: now})
+	assert.ErrorIs(t, err, errCodeTaken)
+	_, err = s.Create(ctx, link{Code: "1", URL: "https://example.com/other", CreatedAt: now})
+	assert.ErrorIs(t, err, errCodeTaken)
+
+	got, err := s.Get(ctx, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, link{Code: "docs", URL: "https://example.com/docs", Permanent: true, CreatedAt: now}, got)
+
+	_, err = s.Get(ctx, "nope")
+	assert.ErrorIs(t, err, errNotFound)
+	assert.ErrorIs(t, s.Hit(ctx, "nope"), errNotFound)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.Hit(ctx, "1"))
+		}()
+	}
+	wg.Wait()
+
+	got, err = s.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), got.Hits)
+}
+
+// testSequentialCollision checks a custom code that's also the next
+// sequential one: that Create fails, and the one after moves on past it
+// rather than failing the same way every time
+func testSequentialCollision(t *testing.T, s store) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// takes id 1, and the code id 2 will want
+	_, err := s.Create(ctx, link{Code: "2", URL: "https://example.com/custom", CreatedAt: now})
+	require.NoError(t, err)
+
+	_, err = s.Create(ctx, link{URL: "https://example.com/a", CreatedAt: now})
+	assert.ErrorIs(t, err, errCodeTaken)
+
+	for _, want := range []string{"3", "4", "5"} {
+		l, err := s.Create(ctx, link{URL: "https://example.com/" + want, CreatedAt: now})
+		require.NoError(t, err)
+		assert.Equal(t, want, l.Code)
+	}
+
+	got, err := s.Get(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/custom", got.URL, "the custom link is untouched")
+}
+
+func newTestSQLiteStore(t *testing.T) *sqliteStore {
+	s, err := newSQLiteStore(context.Background(), filepath.Join(t.TempDir(), "links.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, newMemoryStore())
+	testSequentialCollision(t, newMemoryStore())
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, newTestSQLiteStore(t))
+	testSequentialCollision(t, newTestSQLiteStore(t))
+}
+
+func TestSQLiteStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "links.db")
+
+	s, err := newSQLiteStore(ctx, path)
+	require.NoError(t, err)
+	_, err = s.Create(ctx, link{URL: "https://example.com", CreatedAt: time.Now()})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s, err = newSQLiteStore(ctx, path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	got, err := s.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", got.URL)
+
+	// ids carry on from the old rows
+	l, err := s.Create(ctx, link{URL: "https://example.com/2", CreatedAt: time.Now()})
+	require.NoError(t, err)
+	assert.Equal(t, "2", l.Code)
+}
@@ -0,0 +1,92 @@
+// The URL shortener turns long URLs into short codes and redirects them back.
+// Run it with
+//
+//	go run ./apps/shortener -db links.db
+//
+// Without -db links are kept in memory. -codes picks sequential or random
+// codes. Server settings come from pkg/config, as for the TODO app, with
+// SHORTENER_CONFIG naming the YAML file
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/thorntonmc/go-practice/pkg/admin"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"github.com/thorntonmc/go-practice/pkg/config"
+	"github.com/thorntonmc/go-practice/pkg/envconfig"
+	"github.com/thorntonmc/go-practice/pkg/lifecycle"
+	"github.com/thorntonmc/go-practice/pkg/server"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func main() {
+	var env struct {
+		ConfigPath string `env:"SHORTENER_CONFIG"`
+		DB         string `env:"SHORTENER_DB"`
+		Codes      string `env:"SHORTENER_CODES,default=sequential"`
+	}
+	if err := envconfig.Process(os.LookupEnv, &env); err != nil {
+		log.Fatal(err)
+	}
+
+	path := flag.String("config", env.ConfigPath, "path to a YAML config file")
+	dbPath := flag.String("db", env.DB, "SQLite database file, in memory if empty")
+	codes := flag.String("codes", env.Codes, "how to pick codes: sequential or random")
+	showVersion := version.AddFlag(flag.CommandLine)
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("shortener", version.Get())
+		return
+	}
+
+	cfg, err := config.Load(*path, os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	lc := lifecycle.New(log.Default())
+
+	var s store = newMemoryStore()
+	if *dbPath != "" {
+		db, err := newSQLiteStore(ctx, *dbPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// added first so it's closed last, once the server has stopped
+		// using it
+		lc.Append(lifecycle.Hook{Name: "db", Stop: func(context.Context) error { return db.Close() }})
+		s = db
+	}
+
+	var newCode func() (string, error)
+	switch *codes {
+	case "sequential":
+	case "random":
+		newCode = randomCode
+	default:
+		log.Fatalf("shortener: unknown -codes %q", *codes)
+	}
+
+	// the same totals /debug/vars has, but on the admin port with the rest
+	stats := admin.New("shortener", admin.WithCounter("shortener", metrics))
+	if adm := server.Admin(cfg.Server, stats); adm != nil {
+		lc.Append(lifecycle.HTTPServer("admin", adm))
+	}
+
+	srv := server.FromConfig(cfg.Server, newHandler(s, newCode, clock.New()))
+	lc.Append(lifecycle.HTTPServer("http", srv))
+
+	log.Printf("shortener: listening on %s", cfg.Server.Addr)
+	if err := lc.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
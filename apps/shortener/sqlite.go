@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteStore keeps links in a SQLite file, so they survive a restart
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// one table is small enough not to need concepts/sql's migrations
+const createLinks = `CREATE TABLE IF NOT EXISTS links (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	code       TEXT UNIQUE,
+	url        TEXT NOT NULL,
+	permanent  BOOLEAN NOT NULL DEFAULT 0,
+	hits       INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL
+)`
+
+func newSQLiteStore(ctx context.Context, path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time, and a pool of connections would
+	// just take turns with "database is locked" errors in between
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, createLinks); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Close() error { return s.db.Close() }
+
+// Create inserts the row, then for a sequential code sets it from the new id.
+// Both happen in one transaction, so a row is never visible without its code.
+//
+// A sequential code can already be someone's custom code. Rolling back then
+// would roll back the id too, and the retry would get the same id and the
+// same taken code, forever. So the row is deleted and the transaction
+// committed instead: the id stays used, as a sequence number should, and
+// the retry gets the next one
+func (s *sqliteStore) Create(ctx context.Context, l link) (link, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return link{}, err
+	}
+	defer tx.Rollback() // a no-op once committed
+
+	var code any
+	if l.Code != "" {
+		code = l.Code
+	}
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO links (code, url, permanent, created_at) VALUES (?, ?, ?, ?)",
+		code, l.URL, l.Permanent, l.CreatedAt.UTC())
+	if err != nil {
+		return link{}, uniqueErr(err)
+	}
+
+	if l.Code == "" {
+		id, err := res.LastInsertId()
+		if err != nil {
+			return link{}, err
+		}
+		l.Code = encodeBase62(uint64(id))
+		if _, err := tx.ExecContext(ctx, "UPDATE links SET code = ? WHERE id = ?", l.Code, id); err != nil {
+			if err := uniqueErr(err); err != errCodeTaken {
+				return link{}, err
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM links WHERE id = ?", id); err != nil {
+				return link{}, err
+			}
+			if err := tx.Commit(); err != nil {
+				return link{}, err
+			}
+			return link{}, errCodeTaken
+		}
+	}
+
+	return l, tx.Commit()
+}
+
+// uniqueErr turns a unique constraint violation into errCodeTaken
+func uniqueErr(err error) error {
+	var se *sqlite.Error
+	if errors.As(err, &se) && se.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return errCodeTaken
+	}
+	return err
+}
+
+func (s *sqliteStore) Get(ctx context.Context, code string) (link, error) {
+	l := link{Code: code}
+	err := s.db.QueryRowContext(ctx,
+		"SELECT url, permanent, hits, created_at FROM links WHERE code = ?", code).
+		Scan(&l.URL, &l.Permanent, &l.Hits, &l.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return link{}, errNotFound
+	}
+	return l, err
+}
+
+// Hit increments in SQL rather than reading, adding and writing back, which
+// would lose counts when two redirects race
+func (s *sqliteStore) Hit(ctx context.Context, code string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE links SET hits = hits + 1 WHERE code = ?", code)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package todo
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jsonconcept "github.com/thorntonmc/go-practice/concepts/json"
+	"github.com/thorntonmc/go-practice/pkg/listparams"
+)
+
+// maxBodyBytes caps request bodies, a todo is a few dozen bytes
+const maxBodyBytes = 64 << 10
+
+// TodoRepository is everything the handlers need from storage. It lives
+// here, next to its only consumer, rather than next to MemoryRepository:
+// the consumer knows which methods it needs, and a second implementation
+// (or a fake in a test) only has to provide those
+type TodoRepository interface {
+	List(ctx context.Context) ([]Todo, error)
+	Get(ctx context.Context, id int64) (Todo, error)
+	Create(ctx context.Context, t Todo) (Todo, error)
+	Update(ctx context.Context, t Todo) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// NewHandler routes:
+//
+//	GET    /todos       list, paged, see listSchema
+//	POST   /todos       create
+//	GET    /todos/{id}  fetch one
+//	PATCH  /todos/{id}  partial update, merge patch or JSON Patch
+//	DELETE /todos/{id}  delete
+//
+// Every dependency is passed in, nothing is looked up from a global. notify
+// hears about todos being completed. Errors the client doesn't get to see
+// are written to logger
+func NewHandler(repo TodoRepository, notify Notifier, logger *log.Logger, opts ...Option) http.Handler {
+	h := &handler{repo: repo, notify: notify, log: logger}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.cursors == nil {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+		h.cursors = listparams.NewCodec(secret)
+	}
+
+	m := http.NewServeMux()
+	m.HandleFunc("/todos", h.collection)
+	m.HandleFunc("/todos/", h.item)
+	return m
+}
+
+// Option configures NewHandler
+type Option func(*handler)
+
+// WithCursorSecret signs paging cursors with secret. Without it each
+// handler makes up its own, which is fine for one process, but behind a
+// load balancer every instance needs the same one or a cursor from one
+// instance is rejected by the next
+func WithCursorSecret(secret []byte) Option {
+	return func(h *handler) { h.cursors = listparams.NewCodec(secret) }
+}
+
+type handler struct {
+	repo    TodoRepository
+	notify  Notifier
+	log     *log.Logger
+	cursors *listparams.Codec
+}
+
+func (h *handler) collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		p, err := listSchema.Parse(r.URL.Query(), h.cursors)
+		if err != nil {
+			h.writeError(w, r, badRequest(err))
+			return
+		}
+		todos, next, err := h.page(r.Context(), p)
+		if errors.Is(err, listparams.ErrInvalidCursor) {
+			err = badRequest(err)
+		}
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		// the body stays a bare array, as it was before paging, and the next
+		// page goes in a header where older clients won't trip over it
+		if next != nil {
+			w.Header().Set("Link", `<`+listparams.NextURL(r.URL, h.cursors.Encode(*next))+`>; rel="next"`)
+		}
+		if todos == nil {
+			todos = []Todo{}
+		}
+		writeJSON(w, http.StatusOK, todos)
+
+	case http.MethodPost:
+		t, err := jsonconcept.Decode[Todo](r.Body, jsonconcept.DisallowUnknownFields(), jsonconcept.MaxBytes(maxBodyBytes))
+		if err != nil {
+			h.writeError(w, r, badRequest(err))
+			return
+		}
+		if t, err = h.repo.Create(r.Context(), t); err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", "/todos/"+strconv.FormatInt(t.ID, 10))
+		writeJSON(w, http.StatusCreated, t)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *handler) item(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/todos/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		t, err := h.repo.Get(r.Context(), id)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+
+	case http.MethodPatch:
+		h.patch(w, r, id)
+
+	case http.MethodDelete:
+		if err := h.repo.Delete(r.Context(), id); err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// patch applies the body to the stored todo as JSON, then decodes the result
+// back into a todo, so the usual unknown-field and validation checks apply to
+// the patched version. The content type picks the format - a plain
+// application/json body is treated as a merge patch, since that's what a
+// client sending {"completed":true} means
+func (h *handler) patch(w http.ResponseWriter, r *http.Request, id int64) {
+	apply := jsonconcept.MergePatch
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "application/merge-patch+json", "application/json", "":
+	case "application/json-patch+json":
+		apply = jsonconcept.ApplyPatch
+	default:
+		w.Header().Set("Accept-Patch", "application/merge-patch+json, application/json-patch+json")
+		http.Error(w, "unsupported patch format", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		h.writeError(w, r, badRequest(err))
+		return
+	}
+
+	current, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	patched, err := apply(doc, body)
+	if err != nil {
+		h.writeError(w, r, badRequest(err))
+		return
+	}
+	updated, err := jsonconcept.Decode[Todo](bytes.NewReader(patched), jsonconcept.DisallowUnknownFields())
+	if err != nil {
+		h.writeError(w, r, badRequest(err))
+		return
+	}
+	if updated.ID != id {
+		h.writeError(w, r, badRequest(errors.New("id can't be changed")))
+		return
+	}
+
+	if err := h.repo.Update(r.Context(), updated); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	// the update has happened whether or not anyone hears about it, so a
+	// failed notification is logged rather than failing the request. Sending
+	// inline keeps it simple; a busier app would queue it (see
+	// concepts/broker) so a slow mail server can't slow the API down
+	if !current.Completed && updated.Completed {
+		if err := h.notify.Completed(r.Context(), updated); err != nil {
+			h.log.Printf("todo: notifying completion of %d: %v", id, err)
+		}
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+/*
+ *
+ * responses
+ *
+ */
+
+// requestError marks an error as the client's fault
+type requestError struct{ err error }
+
+func (e requestError) Error() string { return e.err.Error() }
+func (e requestError) Unwrap() error { return e.err }
+
+func badRequest(err error) error { return requestError{err} }
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps an error to a status and a {"error": ...} body. Anything
+// unrecognised is a 500, and its message isn't shown to the client, only
+// logged. JSON decode errors get their line, column and field included
+func (h *handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		re requestError
+		de *jsonconcept.DecodeError
+	)
+	switch {
+	case errors.As(err, &de), errors.Is(err, jsonconcept.ErrTooLarge):
+		jsonconcept.WriteDecodeError(w, err)
+	case errors.Is(err, ErrNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.As(err, &re):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		h.log.Printf("todo: %s %s: %v", r.Method, r.URL.Path, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": http.StatusText(http.StatusInternalServerError)})
+	}
+}
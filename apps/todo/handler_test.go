@@ -0,0 +1,250 @@
+package todo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var discard = log.New(io.Discard, "", 0)
+
+func do(t *testing.T, h http.Handler, method, path, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeTodo(t *testing.T, rec *httptest.ResponseRecorder) Todo {
+	t.Helper()
+	var got Todo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	return got
+}
+
+func TestCRUD(t *testing.T) {
+	h := NewHandler(NewMemoryRepository(), NopNotifier{}, discard)
+
+	rec := do(t, h, http.MethodPost, "/todos", "application/json", `{"title":"  buy milk "}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Equal(t, "/todos/1", rec.Header().Get("Location"))
+	assert.Equal(t, Todo{ID: 1, Title: "buy milk"}, decodeTodo(t, rec))
+
+	rec = do(t, h, http.MethodGet, "/todos/1", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "buy milk", decodeTodo(t, rec).Title)
+
+	do(t, h, http.MethodPost, "/todos", "application/json", `{"title":"walk dog"}`)
+	rec = do(t, h, http.MethodGet, "/todos", "", "")
+	var list []Todo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(t, list, 2)
+
+	rec = do(t, h, http.MethodDelete, "/todos/1", "", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = do(t, h, http.MethodGet, "/todos/1", "", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCreateInvalid(t *testing.T) {
+	h := NewHandler(NewMemoryRepository(), NopNotifier{}, discard)
+
+	for _, body := range []string{`{"title":""}`, `{"title":"x","priority":1}`, `{`, ``} {
+		rec := do(t, h, http.MethodPost, "/todos", "application/json", body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), `"error"`)
+	}
+
+	rec := do(t, h, http.MethodPost, "/todos", "application/json", "{\n  \"title\": 7\n}")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"line":2,"column":13,"field":"title","error":"title: expected string, got number"}`, rec.Body.String())
+
+	rec = do(t, h, http.MethodPost, "/todos", "application/json", `{"title":"`+strings.Repeat("x", maxBodyBytes)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = do(t, h, http.MethodPut, "/todos", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	rec = do(t, h, http.MethodGet, "/todos/abc", "", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestPatch(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		want        Todo
+	}{
+		{"merge patch", "application/merge-patch+json", `{"completed":true}`, http.StatusOK, Todo{ID: 1, Title: "buy milk", Completed: true}},
+		{"plain json is a merge patch", "application/json", `{"title":"buy oat milk"}`, http.StatusOK, Todo{ID: 1, Title: "buy oat milk"}},
+		{"json patch", "application/json-patch+json", `[{"op":"test","path":"/completed","value":false},{"op":"replace","path":"/completed","value":true}]`, http.StatusOK, Todo{ID: 1, Title: "buy milk", Completed: true}},
+		{"json patch test fails", "application/json-patch+json", `[{"op":"test","path":"/completed","value":true}]`, http.StatusBadRequest, Todo{}},
+		{"null title fails validation", "application/merge-patch+json", `{"title":null}`, http.StatusBadRequest, Todo{}},
+		{"unknown field", "application/merge-patch+json", `{"priority":1}`, http.StatusBadRequest, Todo{}},
+		{"id can't change", "application/merge-patch+json", `{"id":2}`, http.StatusBadRequest, Todo{}},
+		{"wrong type", "application/merge-patch+json", `{"completed":"yes"}`, http.StatusBadRequest, Todo{}},
+		{"unsupported format", "text/plain", `completed=true`, http.StatusUnsupportedMediaType, Todo{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandler(NewMemoryRepository(), NopNotifier{}, discard)
+			do(t, h, http.MethodPost, "/todos", "application/json", `{"title":"buy milk"}`)
+
+			rec := do(t, h, http.MethodPatch, "/todos/1", tc.contentType, tc.body)
+			require.Equal(t, tc.status, rec.Code, rec.Body.String())
+
+			stored := decodeTodo(t, do(t, h, http.MethodGet, "/todos/1", "", ""))
+			if tc.status == http.StatusOK {
+				assert.Equal(t, tc.want, decodeTodo(t, rec))
+				assert.Equal(t, tc.want, stored)
+			} else {
+				assert.Equal(t, Todo{ID: 1, Title: "buy milk"}, stored, "a failed patch changes nothing")
+			}
+		})
+	}
+
+	rec := do(t, NewHandler(NewMemoryRepository(), NopNotifier{}, discard), http.MethodPatch, "/todos/9", "application/json", `{}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+// brokenRepository fails everything, the kind of fake that's only easy to
+// swap in because NewHandler takes its repository as an argument
+type brokenRepository struct{ TodoRepository }
+
+var errDiskOnFire = errors.New("disk on fire")
+
+func (brokenRepository) List(context.Context) ([]Todo, error) { return nil, errDiskOnFire }
+
+func TestInternalErrorsAreLogged(t *testing.T) {
+	var logs bytes.Buffer
+	h := NewHandler(brokenRepository{}, NopNotifier{}, log.New(&logs, "", 0))
+
+	rec := do(t, h, http.MethodGet, "/todos", "", "")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "disk on fire")
+	assert.Equal(t, "todo: GET /todos: disk on fire\n", logs.String())
+}
+
+// listRepository hides MemoryRepository's Page, so the handler pages in
+// memory instead
+type listRepository struct{ TodoRepository }
+
+// nextLink pulls the URL out of a Link: <...>; rel="next" header
+func nextLink(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	link := rec.Header().Get("Link")
+	if link == "" {
+		return ""
+	}
+	url, ok := strings.CutSuffix(link, `>; rel="next"`)
+	require.True(t, ok, link)
+	return strings.TrimPrefix(url, "<")
+}
+
+func TestListPaging(t *testing.T) {
+	for name, repo := range map[string]TodoRepository{
+		"paged":    NewMemoryRepository(),
+		"fallback": listRepository{NewMemoryRepository()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := NewHandler(repo, NopNotifier{}, discard)
+			for _, title := range []string{"walk dog", "buy milk", "call mum", "buy bread", "water plants"} {
+				do(t, h, http.MethodPost, "/todos", "application/json", `{"title":"`+title+`"}`)
+			}
+			do(t, h, http.MethodPatch, "/todos/3", "application/json", `{"completed":true}`)
+
+			var titles []string
+			path := "/todos?limit=2&sort=title"
+			for pages := 0; path != ""; pages++ {
+				require.Less(t, pages, 5)
+				rec := do(t, h, http.MethodGet, path, "", "")
+				require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+				var page []Todo
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+				for _, td := range page {
+					titles = append(titles, td.Title)
+				}
+				path = nextLink(t, rec)
+				if pages == 0 {
+					// a todo added mid-way that sorts before the cursor isn't
+					// seen, and nothing already seen is seen again
+					do(t, h, http.MethodPost, "/todos", "application/json", `{"title":"ask alice"}`)
+				}
+			}
+			assert.Equal(t, []string{"buy bread", "buy milk", "call mum", "walk dog", "water plants"}, titles)
+
+			rec := do(t, h, http.MethodGet, "/todos?filter=completed:eq:false&filter=title:contains:BU&sort=-title", "", "")
+			assert.JSONEq(t, `[{"id":2,"title":"buy milk","completed":false},{"id":4,"title":"buy bread","completed":false}]`, rec.Body.String())
+			assert.Empty(t, rec.Header().Get("Link"))
+
+			rec = do(t, h, http.MethodGet, "/todos?filter=id:gt:99", "", "")
+			assert.Equal(t, "[]\n", rec.Body.String())
+		})
+	}
+}
+
+func TestListUnpaged(t *testing.T) {
+	h := NewHandler(NewMemoryRepository(), NopNotifier{}, discard)
+	for i := 0; i < 120; i++ {
+		do(t, h, http.MethodPost, "/todos", "application/json", fmt.Sprintf(`{"title":"todo %d"}`, i))
+	}
+
+	// more than MaxLimit, since the client didn't ask to page
+	rec := do(t, h, http.MethodGet, "/todos?sort=-id", "", "")
+	var all []Todo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &all))
+	assert.Len(t, all, 120)
+	assert.Equal(t, int64(120), all[0].ID)
+	assert.Empty(t, rec.Header().Get("Link"))
+}
+
+func TestListBadParams(t *testing.T) {
+	var logs bytes.Buffer
+	h := NewHandler(NewMemoryRepository(), NopNotifier{}, log.New(&logs, "", 0))
+
+	for _, q := range []string{"limit=1000", "sort=completed", "filter=title:gt:a", "offset=-1", "cursor=made.up"} {
+		rec := do(t, h, http.MethodGet, "/todos?"+q, "", "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, q)
+		assert.Contains(t, rec.Body.String(), `"error"`, q)
+	}
+	assert.Empty(t, logs.String())
+}
+
+func TestCursorSecret(t *testing.T) {
+	repo := NewMemoryRepository()
+	for _, title := range []string{"one", "two", "three"} {
+		_, err := repo.Create(context.Background(), Todo{Title: title})
+		require.NoError(t, err)
+	}
+
+	// two instances behind a load balancer: a cursor from one works on the
+	// other only if they share a secret
+	a := NewHandler(repo, NopNotifier{}, discard, WithCursorSecret([]byte("shared")))
+	b := NewHandler(repo, NopNotifier{}, discard, WithCursorSecret([]byte("shared")))
+	c := NewHandler(repo, NopNotifier{}, discard)
+
+	next := nextLink(t, do(t, a, http.MethodGet, "/todos?limit=2", "", ""))
+	require.NotEmpty(t, next)
+
+	rec := do(t, b, http.MethodGet, next, "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"id":3,"title":"three","completed":false}]`, rec.Body.String())
+
+	rec = do(t, c, http.MethodGet, next, "", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
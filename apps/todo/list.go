@@ -0,0 +1,72 @@
+package todo
+
+import (
+	"context"
+
+	"github.com/thorntonmc/go-practice/pkg/listparams"
+)
+
+// listSchema is what GET /todos allows:
+//
+//	GET /todos?sort=-completed,title&limit=20
+//	GET /todos?filter=completed:eq:false&filter=title:contains:milk
+//	GET /todos?cursor=...    the next page, from the Link header
+//
+// Without a limit there's no paging: GET /todos is every todo, as it was
+// before paging was added, so older clients don't silently lose all but
+// the first page
+var listSchema = &listparams.Schema[Todo]{
+	Fields: map[string]listparams.Field[Todo]{
+		"id": {
+			Kind:     listparams.Int,
+			Sortable: true,
+			Filters:  []listparams.Op{listparams.Eq, listparams.Ne, listparams.Lt, listparams.Le, listparams.Gt, listparams.Ge},
+			Get:      func(t Todo) any { return t.ID },
+		},
+		"title": {
+			Kind:     listparams.String,
+			Sortable: true,
+			Filters:  []listparams.Op{listparams.Eq, listparams.Ne, listparams.Contains},
+			Get:      func(t Todo) any { return t.Title },
+		},
+		"completed": {
+			Kind:    listparams.Bool,
+			Filters: []listparams.Op{listparams.Eq, listparams.Ne},
+			Get:     func(t Todo) any { return t.Completed },
+		},
+	},
+	Tiebreak: "id",
+	MaxLimit: 100,
+}
+
+// pagedRepository is a repository that can page, sort and filter itself -
+// a database doing it in the query. The handler uses it when the
+// repository has it, and otherwise lists everything and pages in memory,
+// so a TodoRepository doesn't have to implement it
+type pagedRepository interface {
+	Page(ctx context.Context, p listparams.Params) ([]Todo, *listparams.Cursor, error)
+}
+
+// Page returns one page of todos, and the cursor for the next if there is
+// one
+func (m *MemoryRepository) Page(ctx context.Context, p listparams.Params) ([]Todo, *listparams.Cursor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all := make([]Todo, 0, len(m.todos))
+	for _, t := range m.todos {
+		all = append(all, t)
+	}
+	return listSchema.Apply(all, p)
+}
+
+func (h *handler) page(ctx context.Context, p listparams.Params) ([]Todo, *listparams.Cursor, error) {
+	if pr, ok := h.repo.(pagedRepository); ok {
+		return pr.Page(ctx, p)
+	}
+	all, err := h.repo.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return listSchema.Apply(all, p)
+}
@@ -0,0 +1,37 @@
+package todo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thorntonmc/go-practice/concepts/email"
+)
+
+// Notifier hears about todos being completed
+type Notifier interface {
+	Completed(ctx context.Context, t Todo) error
+}
+
+// NopNotifier is the Notifier for when nobody wants to know
+type NopNotifier struct{}
+
+func (NopNotifier) Completed(context.Context, Todo) error { return nil }
+
+// EmailNotifier mails a fixed address when a todo is done
+type EmailNotifier struct {
+	sender   email.Sender
+	from, to string
+}
+
+func NewEmailNotifier(sender email.Sender, from, to string) *EmailNotifier {
+	return &EmailNotifier{sender: sender, from: from, to: to}
+}
+
+func (n *EmailNotifier) Completed(ctx context.Context, t Todo) error {
+	return n.sender.Send(ctx, email.Message{
+		From:    n.from,
+		To:      []string{n.to},
+		Subject: "Done: " + t.Title,
+		Text:    fmt.Sprintf("Todo %d, %q, has been completed.", t.ID, t.Title),
+	})
+}
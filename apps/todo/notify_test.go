@@ -0,0 +1,45 @@
+package todo
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/email"
+)
+
+func TestCompletionEmail(t *testing.T) {
+	mail := &email.Recorder{}
+	h := NewHandler(NewMemoryRepository(), NewEmailNotifier(mail, "todo@example.com", "ada@example.com"), discard)
+	do(t, h, http.MethodPost, "/todos", "application/json", `{"title":"buy milk"}`)
+
+	// renaming isn't completing
+	do(t, h, http.MethodPatch, "/todos/1", "application/json", `{"title":"buy oat milk"}`)
+	assert.Empty(t, mail.Sent())
+
+	rec := do(t, h, http.MethodPatch, "/todos/1", "application/json", `{"completed":true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	sent := mail.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, []string{"ada@example.com"}, sent[0].To)
+	assert.Equal(t, "Done: buy oat milk", sent[0].Subject)
+
+	// already done, no second mail
+	do(t, h, http.MethodPatch, "/todos/1", "application/json", `{"completed":true}`)
+	assert.Len(t, mail.Sent(), 1)
+}
+
+func TestCompletionEmailFails(t *testing.T) {
+	mail := &email.Recorder{Err: errors.New("relay down")}
+	var logs bytes.Buffer
+	h := NewHandler(NewMemoryRepository(), NewEmailNotifier(mail, "todo@example.com", "ada@example.com"), log.New(&logs, "", 0))
+	do(t, h, http.MethodPost, "/todos", "application/json", `{"title":"buy milk"}`)
+
+	rec := do(t, h, http.MethodPatch, "/todos/1", "application/json", `{"completed":true}`)
+	assert.Equal(t, http.StatusOK, rec.Code, "the update still happened")
+	assert.Equal(t, "todo: notifying completion of 1: relay down\n", logs.String())
+}
@@ -0,0 +1,102 @@
+// Package todo is the TODO app: the todo type, an in-memory repository and
+// the JSON API over them. There's no main here - cmd/todo is the composition
+// root that builds these pieces and plugs them together, the pattern
+// concepts/di walks through
+package todo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Todo struct {
+	ID        int64  `json:"id"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+}
+
+var (
+	ErrNotFound   = errors.New("todo not found")
+	errEmptyTitle = errors.New("title is required")
+)
+
+func (t *Todo) Validate() error {
+	t.Title = strings.TrimSpace(t.Title)
+	if t.Title == "" {
+		return errEmptyTitle
+	}
+	return nil
+}
+
+// MemoryRepository keeps todos in a map, which is plenty for trying the app
+// out. It satisfies TodoRepository without mentioning it - Go interfaces
+// don't need declaring on the implementation side
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	todos  map[int64]Todo
+	nextID int64
+}
+
+// NewMemoryRepository returns an empty repository. It returns the concrete
+// type, callers decide which interface they want it as
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{todos: map[int64]Todo{}, nextID: 1}
+}
+
+func (m *MemoryRepository) List(ctx context.Context) ([]Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]Todo, 0, len(m.todos))
+	for _, t := range m.todos {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (m *MemoryRepository) Get(ctx context.Context, id int64) (Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.todos[id]
+	if !ok {
+		return Todo{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (m *MemoryRepository) Create(ctx context.Context, t Todo) (Todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.ID = m.nextID
+	m.nextID++
+	m.todos[t.ID] = t
+	return t, nil
+}
+
+func (m *MemoryRepository) Update(ctx context.Context, t Todo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.todos[t.ID]; !ok {
+		return ErrNotFound
+	}
+	m.todos[t.ID] = t
+	return nil
+}
+
+func (m *MemoryRepository) Delete(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.todos[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.todos, id)
+	return nil
+}
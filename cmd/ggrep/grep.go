@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// binarySniffLen is how much of the start of a file is checked for a NUL
+// byte, which text never has. GNU grep uses the same trick
+const binarySniffLen = 8 << 10
+
+type options struct {
+	IgnoreCase bool
+	LineNumber bool
+	Count      bool
+	// MaxLine is the longest line that can be searched. bufio.Scanner
+	// gives up on anything longer, 64KB by default
+	MaxLine int
+}
+
+var errLineTooLong = errors.New("line too long")
+
+type grepper struct {
+	re   *regexp.Regexp
+	opts options
+	out  *bufio.Writer
+}
+
+// grep searches r, printing matching lines prefixed with prefix (the file
+// name, when there's more than one), and reports how many there were.
+//
+// bufio.Scanner reads a buffer at a time and hands out one line at a time,
+// so memory use depends on the longest line, not the size of the input -
+// a 10GB log is no harder than a 10 line one. Lines are matched as bytes,
+// without converting each to a string
+func (g *grepper) grep(r io.Reader, name, prefix string) (int, error) {
+	br := bufio.NewReaderSize(r, binarySniffLen)
+	head, err := br.Peek(binarySniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return 0, err
+	}
+	binary := bytes.IndexByte(head, 0) >= 0
+
+	sc := bufio.NewScanner(br)
+	// the limit is the larger of max and the buffer's capacity, so a
+	// -max-line under 64KB needs a smaller buffer to mean anything
+	sc.Buffer(make([]byte, 0, min(64<<10, g.opts.MaxLine)), g.opts.MaxLine)
+
+	matches := 0
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := sc.Bytes()
+		if !g.re.Match(line) {
+			continue
+		}
+		matches++
+
+		if g.opts.Count {
+			continue
+		}
+		// a binary file's "lines" are noise on a terminal, so like grep
+		// just say it matched and move on. -c still counts them all
+		if binary {
+			fmt.Fprintf(g.out, "Binary file %s matches\n", name)
+			break
+		}
+
+		g.out.WriteString(prefix)
+		if g.opts.LineNumber {
+			g.out.WriteString(strconv.Itoa(lineNo))
+			g.out.WriteByte(':')
+		}
+		g.out.Write(line)
+		g.out.WriteByte('\n')
+	}
+	if errors.Is(sc.Err(), bufio.ErrTooLong) {
+		return matches, errLineTooLong
+	}
+	if sc.Err() != nil {
+		return matches, sc.Err()
+	}
+
+	if g.opts.Count {
+		fmt.Fprintf(g.out, "%s%d\n", prefix, matches)
+	}
+	return matches, nil
+}
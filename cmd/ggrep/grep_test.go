@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+const poem = `The Go gopher
+is small and blue
+GO is fast
+and so are you
+`
+
+func ggrep(t *testing.T, stdin io.Reader, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = run(args, stdin, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func writeFile(t *testing.T, dir, name string, contents []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, contents, 0o644))
+	return path
+}
+
+func TestStdin(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"Go"}, "The Go gopher\n"},
+		{[]string{"-i", "go"}, "The Go gopher\nGO is fast\n"},
+		{[]string{"-n", "you|blue"}, "2:is small and blue\n4:and so are you\n"},
+		{[]string{"-c", "-i", "go"}, "2\n"},
+		{[]string{"-i", "-n", "^go"}, "3:GO is fast\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			code, stdout, stderr := ggrep(t, strings.NewReader(poem), tt.args...)
+			assert.Equal(t, 0, code)
+			assert.Equal(t, tt.want, stdout)
+			assert.Empty(t, stderr)
+		})
+	}
+}
+
+// TestPipe feeds stdin through an os.Pipe, written a line at a time, the way
+// a shell pipeline would
+func TestPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+
+	go func() {
+		defer w.Close()
+		for i := 0; i < 1000; i++ {
+			if i%100 == 0 {
+				io.WriteString(w, "needle\n")
+			} else {
+				io.WriteString(w, "hay\n")
+			}
+		}
+	}()
+
+	code, stdout, _ := ggrep(t, r, "-c", "needle")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "10\n", stdout)
+}
+
+func TestNoMatch(t *testing.T) {
+	code, stdout, _ := ggrep(t, strings.NewReader(poem), "rust")
+	assert.Equal(t, 1, code)
+	assert.Empty(t, stdout)
+
+	code, stdout, _ = ggrep(t, strings.NewReader(poem), "-c", "rust")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "0\n", stdout)
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.txt", []byte(poem))
+	b := writeFile(t, dir, "b.txt", []byte("no gophers here\r\nGo away\r\n"))
+
+	code, stdout, _ := ggrep(t, nil, "-n", "Go", a, b)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, a+":1:The Go gopher\n"+b+":2:Go away\n", stdout, "named when there's more than one, no \\r")
+
+	code, stdout, _ = ggrep(t, nil, "-c", "Go", a, b)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, a+":1\n"+b+":1\n", stdout)
+
+	code, stdout, _ = ggrep(t, nil, "Go", a)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "The Go gopher\n", stdout, "no name for a single file")
+
+	code, stdout, _ = ggrep(t, strings.NewReader("Go from stdin\n"), "Go", a, "-")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, a+":The Go gopher\n(standard input):Go from stdin\n", stdout)
+}
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.txt", []byte(poem))
+	missing := filepath.Join(dir, "missing.txt")
+
+	code, stdout, stderr := ggrep(t, nil, "Go", missing, a)
+	assert.Equal(t, 2, code, "an error wins over a match")
+	assert.Equal(t, a+":The Go gopher\n", stdout, "the other files are still searched")
+	assert.Equal(t, "ggrep: "+missing+": no such file or directory\n", stderr)
+
+	code, _, stderr = ggrep(t, nil, "Go", dir)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "is a directory")
+
+	code, _, stderr = ggrep(t, strings.NewReader(poem), "(unclosed")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "missing closing )")
+
+	code, _, _ = ggrep(t, strings.NewReader(poem))
+	assert.Equal(t, 2, code, "no pattern")
+
+	code, _, _ = ggrep(t, strings.NewReader(poem), "-x", "Go")
+	assert.Equal(t, 2, code, "unknown flag")
+}
+
+func TestVersion(t *testing.T) {
+	code, stdout, _ := ggrep(t, nil, "-version")
+	assert.Equal(t, 0, code, "no pattern needed")
+	assert.Equal(t, "ggrep "+version.Get().String()+"\n", stdout)
+}
+
+func TestBinaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	bin := writeFile(t, dir, "prog", []byte("\x7fELF\x00\x00\x01 Go build id\n\x00\x00rest"))
+	text := writeFile(t, dir, "text", []byte(poem))
+
+	code, stdout, _ := ggrep(t, nil, "Go", bin, text)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Binary file "+bin+" matches\n"+text+":The Go gopher\n", stdout)
+
+	code, stdout, _ = ggrep(t, nil, "nothing", bin)
+	assert.Equal(t, 1, code)
+	assert.Empty(t, stdout)
+
+	code, stdout, _ = ggrep(t, strings.NewReader("a\x00b\nGo\n"), "Go")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Binary file (standard input) matches\n", stdout)
+
+	// -c counts every matching line, binary or not, as grep -c does
+	code, stdout, _ = ggrep(t, strings.NewReader("x\x00\nx\nx\n"), "-c", "x")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "3\n", stdout)
+
+	// a NUL after the first chunk isn't seen, the file is treated as text
+	late := append(bytes.Repeat([]byte("x\n"), binarySniffLen), "Go\x00\n"...)
+	_, stdout, _ = ggrep(t, bytes.NewReader(late), "Go")
+	assert.Equal(t, "Go\x00\n", stdout)
+}
+
+func TestLongLines(t *testing.T) {
+	long := strings.Repeat("a", 1<<20) + "needle" + strings.Repeat("b", 1<<20)
+	input := "short\n" + long + "\nneedle too\n"
+
+	code, stdout, _ := ggrep(t, strings.NewReader(input), "-n", "needle")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "2:"+long+"\n3:needle too\n", stdout, "well past bufio.Scanner's 64KB default")
+
+	code, stdout, stderr := ggrep(t, strings.NewReader(input), "-max-line", "4096", "-n", "needle")
+	assert.Equal(t, 2, code)
+	assert.Empty(t, stdout, "the scan stops at the long line")
+	assert.Equal(t, "ggrep: (standard input): line too long\n", stderr)
+
+	code, _, stderr = ggrep(t, strings.NewReader(input), "-max-line", "0", "needle")
+	assert.Equal(t, 2, code)
+	assert.Equal(t, "ggrep: -max-line must be positive\n", stderr)
+
+	// under the scanner's 64KB starting buffer too
+	code, _, stderr = ggrep(t, strings.NewReader("short\n"+strings.Repeat("a", 5000)+"\n"), "-max-line", "4096", "a")
+	assert.Equal(t, 2, code)
+	assert.Equal(t, "ggrep: (standard input): line too long\n", stderr)
+}
+
+func BenchmarkGrep(b *testing.B) {
+	var buf bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		buf.WriteString("2024-05-01T12:00:00Z INFO request served path=/api/items status=200\n")
+		if i%100 == 0 {
+			buf.WriteString("2024-05-01T12:00:00Z ERROR database unavailable\n")
+		}
+	}
+	input := buf.Bytes()
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		run([]string{"-c", "ERROR"}, bytes.NewReader(input), io.Discard, io.Discard)
+	}
+}
@@ -0,0 +1,127 @@
+// ggrep is a small grep.
+//
+//	ggrep [-i] [-n] [-c] PATTERN [FILE...]
+//
+// PATTERN is a Go regular expression. With no files, or "-", it reads
+// stdin. Like grep it exits 0 when a line matched, 1 when none did and 2 on
+// an error - even if something else matched, so scripts notice
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is main without the process around it, so tests can call it
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ggrep", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ggrep [flags] PATTERN [FILE...]")
+		fs.PrintDefaults()
+	}
+
+	var opts options
+	fs.BoolVar(&opts.IgnoreCase, "i", false, "ignore case")
+	fs.BoolVar(&opts.LineNumber, "n", false, "print line numbers")
+	fs.BoolVar(&opts.Count, "c", false, "print only a count of matching lines")
+	fs.IntVar(&opts.MaxLine, "max-line", 16<<20, "longest line in bytes that can be searched")
+	showVersion := version.AddFlag(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *showVersion {
+		fmt.Fprintln(stdout, "ggrep", version.Get())
+		return 0
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+	if opts.MaxLine < 1 {
+		fmt.Fprintln(stderr, "ggrep: -max-line must be positive")
+		return 2
+	}
+
+	pattern := fs.Arg(0)
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Fprintln(stderr, "ggrep:", err)
+		return 2
+	}
+
+	files := fs.Args()[1:]
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+	g := &grepper{re: re, opts: opts, out: out}
+
+	matched, failed := false, false
+	for _, name := range files {
+		display := name
+		if name == "-" {
+			display = "(standard input)"
+		}
+		prefix := ""
+		if len(files) > 1 {
+			prefix = display + ":"
+		}
+
+		n, err := grepFile(g, name, display, prefix, stdin)
+		// flushing per file keeps output in order with the errors on stderr
+		out.Flush()
+		if err != nil {
+			fmt.Fprintf(stderr, "ggrep: %s: %v\n", display, err)
+			failed = true
+		}
+		matched = matched || n > 0
+	}
+
+	switch {
+	case failed:
+		return 2
+	case matched:
+		return 0
+	}
+	return 1
+}
+
+func grepFile(g *grepper, name, display, prefix string, stdin io.Reader) (int, error) {
+	if name == "-" {
+		return g.grep(stdin, display, prefix)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		// the name is already printed, "open x:" would repeat it
+		var pe *os.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		return 0, errors.New("is a directory")
+	}
+	return g.grep(f, name, prefix)
+}
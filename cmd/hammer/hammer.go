@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/progress"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+// newClient is tuned for hammering one host. The default transport keeps
+// only 2 idle connections per host, so with more workers than that most
+// requests would open a fresh connection - and the numbers would measure
+// TCP handshakes rather than the server. See concepts/net/http/transport.go.
+//
+// Requests say they're from hammer in their User-Agent, so its traffic is
+// easy to pick out of the server's logs
+func newClient(workers int, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: version.Transport("hammer", &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+			MaxIdleConns:        workers,
+			MaxIdleConnsPerHost: workers,
+			IdleConnTimeout:     90 * time.Second,
+			ForceAttemptHTTP2:   true,
+		}),
+	}
+}
+
+// hammer runs workers goroutines sending req back to back until d is up or
+// ctx is cancelled. The workers send a sample per request down a channel to
+// this goroutine, which is the only one that touches the stats. The channel
+// is buffered so a worker rarely waits on the bookkeeping.
+//
+// Response bodies are all counted by one CountingWriter, which is atomic and
+// so fine to share. opts are for it, to report progress along the way
+func hammer(ctx context.Context, client *http.Client, req *http.Request, workers int, d time.Duration, opts ...progress.Option) *stats {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	received := progress.NewCountingWriter(io.Discard, opts...)
+	samples := make(chan sample, workers*16)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				s, ok := do(ctx, client, req, received)
+				if !ok {
+					return
+				}
+				samples <- s
+			}
+		}()
+	}
+
+	// closing samples once every worker is done ends the range below
+	go func() {
+		wg.Wait()
+		close(samples)
+	}()
+
+	st := newStats()
+	for s := range samples {
+		st.add(s)
+	}
+	st.elapsed = time.Since(start)
+	st.received = received.N()
+	return st
+}
+
+// do sends one request. ok is false when the run ended while it was in
+// flight - that request was cut off, not slow or failed, and counting it
+// would skew the results
+func do(ctx context.Context, client *http.Client, req *http.Request, body io.Writer) (s sample, ok bool) {
+	// Clone shares the body, which the first request would use up
+	r := req.Clone(ctx)
+	if req.GetBody != nil {
+		r.Body, _ = req.GetBody()
+	}
+
+	start := time.Now()
+	resp, err := client.Do(r)
+	if err == nil {
+		// the body has to be read to the end for the connection to be
+		// reused, and the time to read it is part of the latency
+		_, err = io.Copy(body, resp.Body)
+		resp.Body.Close()
+		s.Status = resp.StatusCode
+	}
+	s.Latency = time.Since(start)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return s, false
+		}
+		s.Err = err
+	}
+	return s, true
+}
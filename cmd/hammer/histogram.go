@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math/bits"
+	"time"
+)
+
+// histogram records latencies in buckets rather than keeping every one, so
+// memory stays fixed however long the run. Keeping them all and sorting would
+// give exact percentiles, but a million requests is 8MB of durations and a
+// sort at the end.
+//
+// The buckets are log-linear, the idea behind HdrHistogram: each power of
+// two is split into 16 equal buckets. 1-2ms gets buckets 62.5µs wide, 1-2s
+// gets them 62.5ms wide, so the error is always within 1/16 (about 6%) of
+// the value - precise where latencies are small, coarse where nobody cares
+// about the difference. Values are recorded in microseconds
+type histogram struct {
+	counts   [numBuckets]uint64
+	total    uint64
+	sum      time.Duration
+	min, max time.Duration
+}
+
+const (
+	subBucketBits = 4
+	subBuckets    = 1 << subBucketBits // 16
+	// values below 2*subBuckets get a bucket each, after that every power
+	// of two gets subBuckets of them
+	numBuckets = (64 - subBucketBits + 1) * subBuckets
+)
+
+// bucketOf finds v's bucket. The top subBucketBits+1 bits of v pick it: the
+// position of the highest bit is the power of two, the bits after it which
+// sixteenth
+func bucketOf(v uint64) int {
+	if v < 2*subBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - subBucketBits - 1
+	return (shift+1)*subBuckets + int(v>>shift) - subBuckets
+}
+
+// bucketMax is the largest value that lands in bucket i
+func bucketMax(i int) uint64 {
+	if i < 2*subBuckets {
+		return uint64(i)
+	}
+	shift := i/subBuckets - 1
+	sub := uint64(i%subBuckets + subBuckets)
+	return (sub+1)<<shift - 1
+}
+
+func (h *histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[bucketOf(uint64(d/time.Microsecond))]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+	h.sum += d
+}
+
+func (h *histogram) Count() uint64 { return h.total }
+
+func (h *histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// Percentile returns the latency p percent of requests were at or under,
+// for p from 0 to 100. It's the top of the bucket the rank falls in, so it
+// errs on the slow side, but never past the slowest request actually seen
+func (h *histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.min
+	}
+	if p >= 100 {
+		return h.max
+	}
+	// the rank of the request we want, counting from 1
+	rank := uint64(p / 100 * float64(h.total))
+	if float64(rank) < p/100*float64(h.total) {
+		rank++
+	}
+
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			d := time.Duration(bucketMax(i)) * time.Microsecond
+			if d > h.max {
+				d = h.max
+			}
+			if d < h.min {
+				d = h.min
+			}
+			return d
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuckets(t *testing.T) {
+	// every value is within its bucket, and buckets are contiguous
+	prevMax := int64(-1)
+	for i := 0; i < numBuckets-1; i++ {
+		max := bucketMax(i)
+		assert.Equal(t, i, bucketOf(max), "top of bucket %d", i)
+		assert.Equal(t, i, bucketOf(uint64(prevMax+1)), "bottom of bucket %d", i)
+		prevMax = int64(max)
+		if max > 1<<62 {
+			break
+		}
+	}
+	assert.Less(t, bucketOf(^uint64(0)), numBuckets)
+
+	// the width of a bucket is at most 1/16 of its values
+	for _, v := range []uint64{100, 1000, 12345, 1 << 20, 987654321} {
+		i := bucketOf(v)
+		lo := uint64(0)
+		if i > 0 {
+			lo = bucketMax(i-1) + 1
+		}
+		assert.LessOrEqual(t, float64(bucketMax(i)-lo+1), float64(lo)/subBuckets+1, "%d", v)
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	assert.Equal(t, uint64(100), h.Count())
+	assert.Equal(t, time.Millisecond, h.Percentile(0))
+	assert.Equal(t, 100*time.Millisecond, h.Percentile(100))
+	assert.Equal(t, 50500*time.Microsecond, h.Mean())
+
+	for _, p := range []float64{50, 90, 99} {
+		exact := time.Duration(p) * time.Millisecond
+		got := h.Percentile(p)
+		assert.GreaterOrEqual(t, got, exact, "p%v errs on the slow side", p)
+		assert.LessOrEqual(t, float64(got-exact), float64(exact)/subBuckets, "p%v", p)
+	}
+}
+
+func TestPercentilesMatchSorting(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var h histogram
+	var all []time.Duration
+	for i := 0; i < 100000; i++ {
+		// mostly fast, with a long tail, like real latencies
+		d := time.Duration(r.ExpFloat64() * float64(5*time.Millisecond))
+		h.Record(d)
+		all = append(all, d)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+
+	for _, p := range []float64{50, 90, 99, 99.9} {
+		exact := all[int(p/100*float64(len(all)))-1]
+		got := h.Percentile(p)
+		assert.InEpsilon(t, float64(exact), float64(got), 1.0/subBuckets+0.01, "p%v: exact %v, got %v", p, exact, got)
+	}
+}
+
+func TestEmptyHistogram(t *testing.T) {
+	var h histogram
+	assert.Zero(t, h.Percentile(50))
+	assert.Zero(t, h.Mean())
+}
+
+func TestSubMicrosecond(t *testing.T) {
+	var h histogram
+	h.Record(300 * time.Nanosecond)
+	h.Record(-time.Second) // a clock going backwards isn't a negative latency
+	assert.Equal(t, time.Duration(0), h.Percentile(50))
+	assert.Equal(t, 300*time.Nanosecond, h.Percentile(100))
+}
@@ -0,0 +1,103 @@
+// hammer is a small load generator.
+//
+//	go run ./cmd/hammer -c 50 -d 30s http://localhost:8080/
+//
+// It keeps -c requests in flight for -d, then reports throughput, failures
+// and latency percentiles, with a line on stderr every -progress saying
+// how much has come back so far. Ctrl-C stops early and reports what it has
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/progress"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run is main without the process around it, so tests can call it. It
+// exits 1 when more than -max-failures of the requests failed
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("hammer", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: hammer [flags] URL")
+		fs.PrintDefaults()
+	}
+
+	workers := fs.Int("c", 10, "concurrent requests")
+	d := fs.Duration("d", 10*time.Second, "how long to run for")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout for each request")
+	method := fs.String("method", http.MethodGet, "request method")
+	body := fs.String("body", "", "request body")
+	maxFailures := fs.Float64("max-failures", 1, "percentage of failures allowed before exiting 1")
+	every := fs.Duration("progress", time.Second, "how often to report progress on stderr, 0 for never")
+	showVersion := version.AddFlag(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *showVersion {
+		fmt.Fprintln(stdout, "hammer", version.Get())
+		return 0
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *workers < 1 || *d <= 0 {
+		fmt.Fprintln(stderr, "hammer: -c must be at least 1 and -d positive")
+		return 2
+	}
+	target, err := url.Parse(fs.Arg(0))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		fmt.Fprintf(stderr, "hammer: %q isn't an http or https URL\n", fs.Arg(0))
+		return 2
+	}
+
+	req, err := http.NewRequest(*method, target.String(), nil)
+	if err != nil {
+		fmt.Fprintln(stderr, "hammer:", err)
+		return 2
+	}
+	if *body != "" {
+		// every request gets a fresh reader from GetBody
+		b := *body
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(b)), nil }
+		req.ContentLength = int64(len(b))
+	}
+
+	fmt.Fprintf(stderr, "hammer: %d workers for %v against %s\n", *workers, *d, target)
+	var opts []progress.Option
+	if *every > 0 {
+		start := time.Now()
+		opts = append(opts, progress.EveryInterval(*every), progress.OnProgress(func(total int64) {
+			fmt.Fprintf(stderr, "hammer: %v in, %s received\n", time.Since(start).Round(time.Second), formatBytes(total))
+		}))
+	}
+	st := hammer(ctx, newClient(*workers, *timeout), req, *workers, *d, opts...)
+	if err := st.Report(stdout); err != nil {
+		fmt.Fprintln(stderr, "hammer:", err)
+		return 2
+	}
+
+	if 100*st.FailureRate() > *maxFailures {
+		return 1
+	}
+	return 0
+}
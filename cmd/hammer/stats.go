@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// sample is the outcome of one request
+type sample struct {
+	Latency time.Duration
+	Status  int   // 0 when there was no response
+	Err     error // transport errors only, a 500 is still a response
+}
+
+// failed counts transport errors and 5xx as failures. A 4xx is the server
+// working, and answering a question it didn't like
+func (s sample) failed() bool { return s.Err != nil || s.Status >= 500 }
+
+// stats is everything a run adds up to. Only the aggregating goroutine
+// touches it, the workers send it samples on a channel, so there's no lock
+// on the hot path
+type stats struct {
+	latency  histogram
+	failures uint64
+	statuses map[int]uint64
+	errors   map[string]uint64
+	elapsed  time.Duration
+	received int64 // response body bytes, cut off requests included
+}
+
+func newStats() *stats {
+	return &stats{statuses: map[int]uint64{}, errors: map[string]uint64{}}
+}
+
+func (st *stats) add(s sample) {
+	st.latency.Record(s.Latency)
+	if s.failed() {
+		st.failures++
+	}
+	if s.Err != nil {
+		st.errors[errorKind(s.Err)]++
+	} else {
+		st.statuses[s.Status]++
+	}
+}
+
+// errorKind groups errors that differ only in detail - every refused
+// connection has its own port number in the message
+func errorKind(err error) string {
+	var ne net.Error
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return "timeout"
+	case strings.Contains(err.Error(), "connection refused"):
+		return "connection refused"
+	case strings.Contains(err.Error(), "connection reset"):
+		return "connection reset"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection closed early"
+	}
+	return err.Error()
+}
+
+func (st *stats) Requests() uint64 { return st.latency.Count() }
+
+// Throughput is completed requests per second
+func (st *stats) Throughput() float64 {
+	if st.elapsed <= 0 {
+		return 0
+	}
+	return float64(st.Requests()) / st.elapsed.Seconds()
+}
+
+// Bandwidth is response body bytes per second
+func (st *stats) Bandwidth() float64 {
+	if st.elapsed <= 0 {
+		return 0
+	}
+	return float64(st.received) / st.elapsed.Seconds()
+}
+
+// FailureRate is the fraction of requests that failed, 0 to 1
+func (st *stats) FailureRate() float64 {
+	if st.Requests() == 0 {
+		return 0
+	}
+	return float64(st.failures) / float64(st.Requests())
+}
+
+// percentiles are the ones reported. Averages hide the slow tail, which is
+// what users notice - p99 is the latency one request in a hundred is worse
+// than
+var percentiles = []float64{50, 90, 95, 99, 99.9}
+
+func (st *stats) Report(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "requests\t%d in %v\t%.1f/s\n", st.Requests(), st.elapsed.Round(time.Millisecond), st.Throughput())
+	fmt.Fprintf(tw, "failures\t%d\t%.2f%%\n", st.failures, 100*st.FailureRate())
+	fmt.Fprintf(tw, "received\t%s\t%s/s\n", formatBytes(st.received), formatBytes(int64(st.Bandwidth())))
+
+	if st.Requests() > 0 {
+		h := &st.latency
+		fmt.Fprintf(tw, "latency\tmin %v\tmean %v\tmax %v\n", round(h.min), round(h.Mean()), round(h.max))
+		for _, p := range percentiles {
+			fmt.Fprintf(tw, "\tp%v\t%v\n", p, round(h.Percentile(p)))
+		}
+	}
+
+	for _, code := range sortedKeys(st.statuses) {
+		fmt.Fprintf(tw, "status %d\t%d\n", code, st.statuses[code])
+	}
+	for _, kind := range sortedKeys(st.errors) {
+		fmt.Fprintf(tw, "error\t%d\t%s\n", st.errors[kind], kind)
+	}
+	return tw.Flush()
+}
+
+// round keeps three significant figures or so, 1.234567ms reads as 1.23ms
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// formatBytes is n in B, KB, MB or GB, whichever keeps it short
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	f, suffix := float64(n)/unit, "KB"
+	for _, s := range []string{"MB", "GB"} {
+		if f < unit {
+			break
+		}
+		f, suffix = f/unit, s
+	}
+	return fmt.Sprintf("%.1f%s", f, suffix)
+}
+
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	st := newStats()
+	for i := 0; i < 90; i++ {
+		st.add(sample{Latency: 10 * time.Millisecond, Status: 200})
+	}
+	for i := 0; i < 5; i++ {
+		st.add(sample{Latency: 20 * time.Millisecond, Status: 404})
+		st.add(sample{Latency: 500 * time.Millisecond, Status: 503})
+	}
+	st.add(sample{Latency: time.Second, Err: fmt.Errorf("dial tcp 127.0.0.1:1234: %w", syscall.ECONNREFUSED)})
+	st.add(sample{Latency: time.Second, Err: fmt.Errorf("dial tcp 127.0.0.1:5678: %w", syscall.ECONNREFUSED)})
+	st.add(sample{Latency: 5 * time.Second, Err: fmt.Errorf("read: %w", os.ErrDeadlineExceeded)})
+	st.elapsed = 2 * time.Second
+	st.received = 3 << 20
+
+	assert.Equal(t, uint64(103), st.Requests())
+	assert.InDelta(t, 51.5, st.Throughput(), 0.001)
+	assert.InDelta(t, 8.0/103, st.FailureRate(), 0.0001, "5xx and errors, not 4xx")
+	assert.Equal(t, map[int]uint64{200: 90, 404: 5, 503: 5}, st.statuses)
+	assert.Equal(t, map[string]uint64{"connection refused": 2, "timeout": 1}, st.errors)
+
+	var buf bytes.Buffer
+	require.NoError(t, st.Report(&buf))
+	out := buf.String()
+	for _, want := range []string{
+		"103 in 2s", "51.5/s", "7.77%", "min 10ms", "max 5s", "p50", "p99.9",
+		"status 503  5", "error       2  connection refused", "3.0MB", "1.5MB/s",
+	} {
+		assert.Contains(t, out, want)
+	}
+}
+
+func TestEmptyStats(t *testing.T) {
+	st := newStats()
+	assert.Zero(t, st.Throughput())
+	assert.Zero(t, st.FailureRate())
+
+	var buf bytes.Buffer
+	require.NoError(t, st.Report(&buf))
+	assert.NotContains(t, buf.String(), "latency")
+}
+
+func TestErrorKind(t *testing.T) {
+	assert.Equal(t, "connection closed early", errorKind(fmt.Errorf("read: %w", io.ErrUnexpectedEOF)))
+	assert.Equal(t, "something odd", errorKind(errors.New("something odd")))
+}
+
+func TestHammer(t *testing.T) {
+	var n int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every tenth request fails
+		if atomic.AddInt64(&n, 1)%10 == 0 {
+			http.Error(w, "oops", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	st := hammer(context.Background(), newClient(4, time.Second), req, 4, 200*time.Millisecond)
+
+	// requests cut off at the end reached the server but aren't counted,
+	// there's at most one per worker
+	seen := uint64(atomic.LoadInt64(&n))
+	assert.LessOrEqual(t, st.Requests(), seen)
+	assert.LessOrEqual(t, seen-st.Requests(), uint64(4))
+	assert.Greater(t, st.Requests(), uint64(20))
+	assert.InDelta(t, 0.1, st.FailureRate(), 0.03)
+	assert.GreaterOrEqual(t, st.elapsed, 200*time.Millisecond)
+	assert.Empty(t, st.errors)
+	// "ok" or "oops\n", for every request the server saw
+	assert.GreaterOrEqual(t, st.received, int64(2*st.Requests()))
+	assert.LessOrEqual(t, st.received, int64(5*seen))
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:          "0B",
+		1023:       "1023B",
+		1024:       "1.0KB",
+		1536:       "1.5KB",
+		5 << 20:    "5.0MB",
+		3 << 30:    "3.0GB",
+		4096 << 30: "4096.0GB",
+	} {
+		assert.Equal(t, want, formatBytes(n), n)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var bodies int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		if r.Method == http.MethodPost && buf.String() == `{"x":1}` {
+			atomic.AddInt64(&bodies, 1)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-c", "2", "-d", "100ms", "-method", "POST", "-body", `{"x":1}`, srv.URL}, &stdout, &stderr)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "status 200")
+	assert.Greater(t, atomic.LoadInt64(&bodies), int64(1), "every request gets the body")
+	assert.NotContains(t, stderr.String(), "received", "nothing to report in under the default second")
+
+	stderr.Reset()
+	code = run(context.Background(), []string{"-c", "2", "-d", "100ms", "-progress", "10ms", srv.URL}, &stdout, &stderr)
+	assert.Equal(t, 0, code)
+	assert.Regexp(t, `hammer: 0s in, \d+B received`, stderr.String())
+
+	// nothing listening: all failures
+	srv.Close()
+	stdout.Reset()
+	code = run(context.Background(), []string{"-c", "1", "-d", "50ms", srv.URL}, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout.String(), "connection refused")
+}
+
+func TestRunUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"-c", "0", "http://localhost"},
+		{"-d", "0s", "http://localhost"},
+		{"localhost:8080"},
+		{"-method", "BAD METHOD", "http://localhost"},
+	} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(context.Background(), args, &stdout, &stderr), strings.Join(args, " "))
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/html"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxPageBytes is as much of a page as is read looking for links
+const maxPageBytes = 10 << 20
+
+// result is one checked link
+type result struct {
+	URL    string `json:"url"`
+	Status int    `json:"status,omitempty"`
+	Err    string `json:"error,omitempty"`
+	From   string `json:"from,omitempty"` // the page it was first found on
+	Depth  int    `json:"depth"`
+}
+
+func (r result) Broken() bool { return r.Err != "" || r.Status >= 400 }
+
+type options struct {
+	// Depth is how many links away from the start page to go. 0 checks
+	// only the start page
+	Depth int
+	// Concurrency is how many workers check links, so how many requests
+	// may be in flight at once
+	Concurrency int
+	// External checks links to other hosts too. They're never crawled
+	External bool
+}
+
+// crawler does a breadth first walk of one site with a fixed pool of
+// Concurrency workers. Links waiting to be checked go on a queue, which
+// grows as pages are read, and each worker takes the next one off it. A
+// page with thousands of links is thousands of queue entries rather than
+// thousands of goroutines, and the pool size is both the number of
+// goroutines and the most requests the server sees at once.
+//
+// The crawl is over when the queue is empty and no worker is checking a
+// link - only those could still find more. A worker that finds the queue
+// empty while others are busy waits on wake for them.
+//
+// A failed link is a result, not an error: the only error is ctx's, so
+// Ctrl-C stops everything promptly and what's been checked so far can
+// still be reported
+type crawler struct {
+	client *http.Client
+	opts   options
+	host   string
+
+	mu      sync.Mutex
+	wake    *sync.Cond // broadcast when the queue grows or a worker finishes a link
+	queue   []job
+	active  int // workers checking a link
+	seen    map[string]bool
+	results []result
+}
+
+// job is a link waiting to be checked
+type job struct {
+	link, from string
+	depth      int
+}
+
+// crawl checks start and the links reachable from it. On cancellation it
+// returns what it has, with ctx's error
+func crawl(ctx context.Context, client *http.Client, start *url.URL, opts options) ([]result, error) {
+	// the same page as the start's own links to "/", which would otherwise
+	// be checked twice
+	if start.Path == "" {
+		u := *start
+		u.Path = "/"
+		start = &u
+	}
+
+	c := &crawler{
+		client: client,
+		opts:   opts,
+		host:   start.Host,
+		seen:   map[string]bool{},
+	}
+	c.wake = sync.NewCond(&c.mu)
+	c.push([]string{start.String()}, "", 0)
+
+	// a worker waiting on wake has to hear about cancellation too
+	stop := context.AfterFunc(ctx, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.wake.Broadcast()
+	})
+	defer stop()
+
+	var g errgroup.Group
+	for i := 0; i < opts.Concurrency; i++ {
+		g.Go(func() error { return c.work(ctx) })
+	}
+	err := g.Wait()
+
+	sort.Slice(c.results, func(i, j int) bool { return c.results[i].URL < c.results[j].URL })
+	return c.results, err
+}
+
+// work checks links until there are none left, or ctx is done
+func (c *crawler) work(ctx context.Context) error {
+	for {
+		j, ok := c.next(ctx)
+		if !ok {
+			return ctx.Err()
+		}
+		res, links := c.fetch(ctx, j.link, j.depth)
+
+		c.mu.Lock()
+		c.active--
+		// a request cut off by cancellation isn't a broken link
+		if ctx.Err() == nil {
+			res.From = j.from
+			c.results = append(c.results, res)
+			c.push(links, j.link, j.depth+1)
+		}
+		c.wake.Broadcast()
+		c.mu.Unlock()
+	}
+}
+
+// next takes the next link off the queue, waiting while it's empty but
+// other workers may still add to it. false means there's nothing left to
+// do, or ctx is done
+func (c *crawler) next(ctx context.Context) (job, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.queue) == 0 && c.active > 0 && ctx.Err() == nil {
+		c.wake.Wait()
+	}
+	if len(c.queue) == 0 || ctx.Err() != nil {
+		return job{}, false
+	}
+	j := c.queue[0]
+	c.queue = c.queue[1:]
+	c.active++
+	return j, true
+}
+
+// push queues the links that haven't been seen before. c.mu must be held
+func (c *crawler) push(links []string, from string, depth int) {
+	for _, l := range links {
+		if !c.seen[l] {
+			c.seen[l] = true
+			c.queue = append(c.queue, job{link: l, from: from, depth: depth})
+		}
+	}
+}
+
+// fetch checks one link, and returns the links on it when it's a page of
+// this site that isn't too deep to follow
+func (c *crawler) fetch(ctx context.Context, link string, depth int) (result, []string) {
+	res := result{URL: link, Depth: depth}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		res.Err = err.Error()
+		return res, nil
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		res.Err = err.Error()
+		return res, nil
+	}
+	defer resp.Body.Close()
+	res.Status = resp.StatusCode
+
+	// resp.Request is the last request made, after any redirects - that's
+	// the host that counts, and the URL relative links are relative to
+	final := resp.Request.URL
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != http.StatusOK || final.Host != c.host || mt != "text/html" || depth >= c.opts.Depth {
+		return res, nil
+	}
+
+	var links []string
+	for _, l := range extractLinks(io.LimitReader(resp.Body, maxPageBytes), final) {
+		if l.Host == c.host || c.opts.External {
+			links = append(links, l.String())
+		}
+	}
+	return res, links
+}
+
+// linkAttrs is where links live in HTML, by tag
+var linkAttrs = map[string]string{
+	"a":      "href",
+	"link":   "href",
+	"img":    "src",
+	"script": "src",
+	"iframe": "src",
+}
+
+// extractLinks returns the http(s) links in an HTML page, resolved against
+// base and without fragments, which are all the same page. The tokenizer
+// is enough, there's no need to build the whole document tree
+func extractLinks(r io.Reader, base *url.URL) []*url.URL {
+	var links []*url.URL
+	seen := map[string]bool{}
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links // io.EOF, or a page too broken to go on with
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag, hasAttr := z.TagName()
+			want, ok := linkAttrs[string(tag)]
+			for ok && hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) != want {
+					continue
+				}
+
+				u, err := base.Parse(string(val))
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+					break
+				}
+				u.Fragment, u.RawFragment = "", ""
+				if !seen[u.String()] {
+					seen[u.String()] = true
+					links = append(links, u)
+				}
+				break
+			}
+		}
+	}
+}
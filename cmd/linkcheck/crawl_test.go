@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// site is the fixture the tests crawl. EXTERNAL is replaced with the URL of
+// a second server, standing in for other sites
+var site = map[string]string{
+	"/": `<html><head><link rel="stylesheet" href="/style.css"></head><body>
+		<a href="/about">About</a>
+		<a href="blog/">Blog</a>
+		<a href="/about#team">Team</a>
+		<a href="/missing">Gone</a>
+		<a href="mailto:someone@example.com">Mail</a>
+		<a href="javascript:void(0)">Nothing</a>
+		<a href="EXTERNAL/ok">Elsewhere</a>
+		<a href="EXTERNAL/dead">Dead elsewhere</a>
+	</body></html>`,
+	"/about":       `<html><body><a href="/">Home</a><img src="/logo.png"></body></html>`,
+	"/blog/":       `<html><body><a href="post-1">One</a><a href="/old">Old</a></body></html>`,
+	"/blog/post-1": `<html><body><a href="/blog/post-2">Next</a></body></html>`,
+	"/blog/post-2": `<html><body><a href="/deep">Deeper</a></body></html>`,
+	"/style.css":   `body { color: black }`,
+	"/logo.png":    "\x89PNG",
+}
+
+func startSite(t *testing.T) (*httptest.Server, *int64) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dead" {
+			http.NotFound(w, r)
+			return
+		}
+		// links on other sites are never followed
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/never-checked">x</a>`))
+	}))
+	t.Cleanup(external.Close)
+
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/blog/post-1", http.StatusMovedPermanently)
+			return
+		}
+		page, ok := site[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasPrefix(page, "<html>") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		w.Write([]byte(strings.ReplaceAll(page, "EXTERNAL", external.URL)))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func mustParse(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	require.NoError(t, err)
+	return u
+}
+
+// byPath maps the crawled links to their status, with the test servers'
+// addresses taken out
+func byPath(results []result, srv string) map[string]int {
+	m := map[string]int{}
+	for _, r := range results {
+		p := strings.TrimPrefix(r.URL, srv)
+		if p == r.URL {
+			u, _ := url.Parse(r.URL)
+			p = "external:" + u.Path
+		}
+		m[p] = r.Status
+	}
+	return m
+}
+
+func TestCrawl(t *testing.T) {
+	srv, _ := startSite(t)
+
+	results, err := crawl(context.Background(), srv.Client(), mustParse(t, srv.URL+"/"), options{Depth: 2, Concurrency: 4, External: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{
+		"/":              200,
+		"/about":         200,
+		"/blog/":         200,
+		"/missing":       404,
+		"/style.css":     200,
+		"/logo.png":      200,
+		"/blog/post-1":   200,
+		"/old":           200, // followed the redirect
+		"external:/ok":   200,
+		"external:/dead": 404,
+	}, byPath(results, srv.URL), "post-2 is 3 links away")
+
+	for _, r := range results {
+		if strings.HasSuffix(r.URL, "/missing") {
+			assert.Equal(t, srv.URL+"/", r.From)
+			assert.Equal(t, 1, r.Depth)
+			assert.True(t, r.Broken())
+		}
+	}
+}
+
+func TestCrawlDepth(t *testing.T) {
+	srv, _ := startSite(t)
+	start := mustParse(t, srv.URL+"/")
+
+	results, err := crawl(context.Background(), srv.Client(), start, options{Depth: 0, Concurrency: 1})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"/": 200}, byPath(results, srv.URL))
+
+	results, err = crawl(context.Background(), srv.Client(), start, options{Depth: 10, Concurrency: 4})
+	require.NoError(t, err)
+	got := byPath(results, srv.URL)
+	assert.Equal(t, 404, got["/deep"])
+	assert.NotContains(t, got, "external:/ok", "external links off")
+}
+
+func TestCrawlBoundsConcurrency(t *testing.T) {
+	var inFlight, most, mostGoroutines int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for {
+			g, m := int64(runtime.NumGoroutine()), atomic.LoadInt64(&mostGoroutines)
+			if g <= m || atomic.CompareAndSwapInt64(&mostGoroutines, m, g) {
+				break
+			}
+		}
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			m := atomic.LoadInt64(&most)
+			if n <= m || atomic.CompareAndSwapInt64(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			for i := 0; i < 50; i++ {
+				w.Write([]byte(`<a href="/p` + string(rune('a'+i%26)) + string(rune('a'+i/26)) + `">x</a>`))
+			}
+		}
+	}))
+	defer srv.Close()
+
+	before := int64(runtime.NumGoroutine())
+	results, err := crawl(context.Background(), srv.Client(), mustParse(t, srv.URL+"/"), options{Depth: 1, Concurrency: 3})
+	require.NoError(t, err)
+	assert.Len(t, results, 51)
+	assert.LessOrEqual(t, atomic.LoadInt64(&most), int64(3))
+	// 3 workers, and a few for each connection on both ends - not one per
+	// link on the page
+	assert.Less(t, atomic.LoadInt64(&mostGoroutines)-before, int64(30))
+}
+
+func TestCrawlCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/slow1">x</a><a href="/slow2">x</a>`))
+			return
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	results, err := crawl(ctx, srv.Client(), mustParse(t, srv.URL+"/"), options{Depth: 1, Concurrency: 4})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, map[string]int{"/": 200}, byPath(results, srv.URL), "the cut off requests aren't reported as broken")
+}
+
+func TestExtractLinks(t *testing.T) {
+	page := `<html><body>
+		<a href="/a">A</a> <a href="/a#section">same page</a>
+		<a>no href</a> <a href="https://other.example/b?x=1">B</a>
+		<img src="img/c.png"/> <script src="//cdn.example/d.js"></script>
+		<a href="ftp://files.example/e">ftp</a>
+		<a href="http://[::1:bad">unparseable</a>
+		<p data-href="/not-a-link">text</p>
+	</body></html>`
+
+	var got []string
+	for _, u := range extractLinks(strings.NewReader(page), mustParse(t, "https://site.example/dir/page")) {
+		got = append(got, u.String())
+	}
+	assert.Equal(t, []string{
+		"https://site.example/a",
+		"https://other.example/b?x=1",
+		"https://site.example/dir/img/c.png",
+		"https://cdn.example/d.js",
+	}, got)
+}
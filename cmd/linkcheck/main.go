@@ -0,0 +1,99 @@
+// linkcheck crawls a site and reports broken links.
+//
+//	go run ./cmd/linkcheck -depth 3 https://example.com
+//
+// It exits 0 when every link works, 1 when some are broken, 2 on bad usage
+// and 130 when interrupted - Ctrl-C still prints what was checked so far
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run is main without the process around it, so tests can call it
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("linkcheck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: linkcheck [flags] URL")
+		fs.PrintDefaults()
+	}
+
+	var opts options
+	fs.IntVar(&opts.Depth, "depth", 2, "how many links deep to crawl")
+	fs.IntVar(&opts.Concurrency, "concurrency", 8, "how many links to check at once")
+	fs.BoolVar(&opts.External, "external", true, "check links to other sites too (they're never crawled)")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for each request")
+	format := fs.String("format", "table", "report format: table or json")
+	brokenOnly := fs.Bool("broken", false, "only list broken links in the table")
+	showVersion := version.AddFlag(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *showVersion {
+		fmt.Fprintln(stdout, "linkcheck", version.Get())
+		return 0
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if opts.Depth < 0 || opts.Concurrency < 1 {
+		fmt.Fprintln(stderr, "linkcheck: -depth can't be negative and -concurrency must be at least 1")
+		return 2
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(stderr, "linkcheck: unknown -format %q\n", *format)
+		return 2
+	}
+	start, err := url.Parse(fs.Arg(0))
+	if err != nil || (start.Scheme != "http" && start.Scheme != "https") || start.Host == "" {
+		fmt.Fprintf(stderr, "linkcheck: %q isn't an http or https URL\n", fs.Arg(0))
+		return 2
+	}
+
+	client := &http.Client{Timeout: *timeout, Transport: version.Transport("linkcheck", nil)}
+	results, crawlErr := crawl(ctx, client, start, opts)
+
+	r := newReport(results)
+	if *format == "json" {
+		err = writeJSON(stdout, r)
+	} else {
+		err = writeTable(stdout, r, *brokenOnly)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "linkcheck:", err)
+		return 2
+	}
+
+	switch {
+	case errors.Is(crawlErr, context.Canceled):
+		fmt.Fprintln(stderr, "linkcheck: interrupted, the report is incomplete")
+		return 130
+	case crawlErr != nil:
+		fmt.Fprintln(stderr, "linkcheck:", crawlErr)
+		return 2
+	case r.Broken > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func TestRunTable(t *testing.T) {
+	srv, _ := startSite(t)
+	var stdout, stderr bytes.Buffer
+
+	code := run(context.Background(), []string{"-external=false", "-broken", srv.URL}, &stdout, &stderr)
+	assert.Equal(t, 1, code, "there are broken links")
+	assert.Empty(t, stderr.String())
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, []string{"STATUS", "URL", "FOUND", "ON"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"404", srv.URL + "/missing", srv.URL + "/"}, strings.Fields(lines[1]))
+	assert.Equal(t, "checked 8 links, 1 broken", lines[3])
+}
+
+func TestRunJSON(t *testing.T) {
+	srv, _ := startSite(t)
+	var stdout, stderr bytes.Buffer
+
+	code := run(context.Background(), []string{"-format", "json", "-depth", "0", srv.URL}, &stdout, &stderr)
+	assert.Equal(t, 0, code)
+
+	var r report
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &r))
+	assert.Equal(t, report{Checked: 1, Results: []result{{URL: srv.URL + "/", Status: 200}}}, r)
+}
+
+func TestRunUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"-format", "xml", "http://example.com"},
+		{"-depth", "-1", "http://example.com"},
+		{"-nope", "http://example.com"},
+		{"example.com"},
+		{"http://a.example", "http://b.example"},
+	} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(context.Background(), args, &stdout, &stderr), args)
+		assert.NotEmpty(t, stderr.String(), args)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	srv, _ := startSite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 130, run(ctx, []string{srv.URL}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "interrupted")
+	assert.Contains(t, stdout.String(), "checked 0 links")
+}
+
+func TestRunVersion(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run(context.Background(), []string{"-version"}, &stdout, &stderr), "no URL needed")
+	assert.Equal(t, "linkcheck "+version.Get().String()+"\n", stdout.String())
+
+	// and the crawler says who it is
+	agents := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.Header.Get("User-Agent")
+	}))
+	defer srv.Close()
+	run(context.Background(), []string{"-depth", "0", srv.URL}, &stdout, &stderr)
+	assert.Equal(t, "linkcheck/"+version.Get().Version, <-agents)
+}
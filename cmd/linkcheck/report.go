@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+type report struct {
+	Checked int      `json:"checked"`
+	Broken  int      `json:"broken"`
+	Results []result `json:"results"`
+}
+
+func newReport(results []result) report {
+	r := report{Checked: len(results), Results: results}
+	for _, res := range results {
+		if res.Broken() {
+			r.Broken++
+		}
+	}
+	return r
+}
+
+func writeJSON(w io.Writer, r report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// writeTable lines the columns up with tabwriter, which buffers until Flush
+// to know how wide each one needs to be. brokenOnly leaves out the links
+// that are fine
+func writeTable(w io.Writer, r report, brokenOnly bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tURL\tFOUND ON")
+	for _, res := range r.Results {
+		if brokenOnly && !res.Broken() {
+			continue
+		}
+		status := strconv.Itoa(res.Status)
+		if res.Err != "" {
+			status = "error"
+		}
+		from := res.From
+		if from == "" {
+			from = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", status, res.URL, from)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\nchecked %d links, %d broken\n", r.Checked, r.Broken)
+	return err
+}
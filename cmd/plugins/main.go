@@ -0,0 +1,122 @@
+// plugins lists the middleware compiled into it, and serves a hello world
+// wrapped in a stack of them chosen by a config file.
+//
+//	go run ./cmd/plugins -list
+//	go run ./cmd/plugins -config stack.yaml -addr :8080
+//
+// where stack.yaml names middleware outermost first:
+//
+//	middleware:
+//	  - name: requestid
+//	  - name: timeout
+//	    options:
+//	      after: 2s
+//
+// -check builds the stack and exits without serving, for CI. Which
+// middleware exist is decided by the imports below, see concepts/plugin
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/plugin"
+	_ "github.com/thorntonmc/go-practice/concepts/plugin/all"
+	"github.com/thorntonmc/go-practice/pkg/server"
+	"github.com/thorntonmc/go-practice/pkg/version"
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+type stackFile struct {
+	Middleware []plugin.Spec `yaml:"middleware"`
+}
+
+// run is main without the process around it, so tests can call it
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("plugins", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	list := fs.Bool("list", false, "list the middleware compiled in and exit")
+	path := fs.String("config", "", "YAML file naming the middleware stack")
+	check := fs.Bool("check", false, "build the stack from -config and exit")
+	addr := fs.String("addr", ":8080", "address to serve on")
+	showVersion := version.AddFlag(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *showVersion {
+		fmt.Fprintln(stdout, "plugins", version.Get())
+		return 0
+	}
+
+	if *list {
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		for _, m := range plugin.Middlewares() {
+			fmt.Fprintf(tw, "%s\t%s\n", m.Name, m.Description)
+		}
+		tw.Flush()
+		return 0
+	}
+
+	var stack stackFile
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			fmt.Fprintf(stderr, "plugins: %v\n", err)
+			return 2
+		}
+		d := yaml.NewDecoder(bytes.NewReader(data))
+		d.KnownFields(true)
+		if err := d.Decode(&stack); err != nil && !errors.Is(err, io.EOF) {
+			fmt.Fprintf(stderr, "plugins: %s: %v\n", *path, err)
+			return 2
+		}
+	}
+	mw, err := plugin.Build(stack.Middleware)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *check {
+		fmt.Fprintf(stdout, "ok, %d middleware\n", len(stack.Middleware))
+		return 0
+	}
+
+	srv := server.New(*addr, mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "hello")
+	})))
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+	fmt.Fprintf(stdout, "serving on %s\n", *addr)
+
+	select {
+	case err := <-errs:
+		fmt.Fprintf(stderr, "plugins: %v\n", err)
+		return 1
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(stderr, "plugins: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/concepts/plugin"
+	"github.com/thorntonmc/go-practice/concepts/plugin/ext/requestid"
+)
+
+func runArgs(args ...string) (code int, stdout, stderr string) {
+	var out, errs bytes.Buffer
+	code = run(context.Background(), args, &out, &errs)
+	return code, out.String(), errs.String()
+}
+
+func writeStack(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stack.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	return path
+}
+
+func TestList(t *testing.T) {
+	code, out, _ := runArgs("-list")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `headers    sets fixed response headers, one per option
+requestid  tags each request with an ID, reusing the client's
+timeout    gives up on a request with a 503 after a time limit
+`, out)
+}
+
+func TestCheck(t *testing.T) {
+	path := writeStack(t, `
+middleware:
+  - name: requestid
+  - name: timeout
+    options:
+      after: 2s
+  - name: headers
+    options:
+      Cache-Control: no-store
+`)
+	code, out, errs := runArgs("-config", path, "-check")
+	assert.Equal(t, 0, code, errs)
+	assert.Equal(t, "ok, 3 middleware\n", out)
+
+	for name, contents := range map[string]string{
+		"unknown middleware": "middleware:\n  - name: gzip\n",
+		"bad option value":   "middleware:\n  - name: timeout\n    options:\n      after: soon\n",
+		"unknown option":     "middleware:\n  - name: requestid\n    options:\n      heder: X-Id\n",
+		"no headers":         "middleware:\n  - name: headers\n",
+		"unknown key":        "middlewares: []\n",
+	} {
+		code, _, errs := runArgs("-config", writeStack(t, contents), "-check")
+		assert.Equal(t, 2, code, name)
+		assert.NotEmpty(t, errs, name)
+	}
+}
+
+// the stack a config builds behaves like the middleware it names
+func TestStack(t *testing.T) {
+	mw, err := plugin.Build([]plugin.Spec{
+		{Name: "requestid"},
+		{Name: "headers", Options: map[string]string{"Cache-Control": "no-store"}},
+		{Name: "timeout", Options: map[string]string{"after": "20ms", "message": "too slow"}},
+	})
+	require.NoError(t, err)
+
+	var seen string
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestid.FromContext(r.Context())
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "hello", rec.Body.String())
+	assert.Equal(t, "abc", rec.Header().Get("X-Request-Id"))
+	assert.Equal(t, "abc", seen)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "too slow", rec.Body.String())
+	assert.Len(t, rec.Header().Get("X-Request-Id"), 16, "generated when the client sent none")
+}
@@ -0,0 +1,169 @@
+// todo runs the TODO app, a small JSON API tying together pieces from
+// concepts/ and pkg/. Run it with
+//
+//	go run ./cmd/todo -config todo.yaml
+//
+// or set TODO_CONFIG instead of passing -config. Settings come from
+// pkg/config: defaults, then the optional YAML file, then environment
+// variables such as SERVER_ADDR. -addr :8081 beats all three, for a quick
+// run on another port. Uptime, memory and a count of todos are at
+// /debug/stats on SERVER_ADMIN_ADDR, localhost:6060 unless set, see
+// pkg/admin.
+//
+// Completing a todo sends an email to TODO_NOTIFY_TO, through the SMTP
+// server at TODO_SMTP_ADDR (with TODO_SMTP_USERNAME and TODO_SMTP_PASSWORD
+// if it wants them). Leave either unset and there are no emails.
+//
+// Every /todos request needs a session: POST /auth/register or /auth/login
+// with {"username": ..., "password": ...} sets the cookie, and sessions last
+// TODO_SESSION_TTL (24h by default). See concepts/auth.
+//
+// TODO_CURSOR_SECRET signs the cursors GET /todos pages with. Run more than
+// one instance and they all need the same one; unset, each makes its own.
+//
+// Behind a load balancer, set TODO_TRUSTED_PROXIES to its networks
+// ("10.0.0.0/8,fd00::/8") so login throttling sees clients rather than the
+// proxy. Only those peers' X-Forwarded-For is believed, or their Forwarded
+// with TODO_PROXY_HEADER=Forwarded - never both, see pkg/ip.
+//
+// This file is the app's composition root: the one place that knows which
+// implementation backs each dependency. Everything in apps/todo takes its
+// dependencies as constructor arguments, see concepts/di
+package main
+
+import (
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/thorntonmc/go-practice/apps/todo"
+	"github.com/thorntonmc/go-practice/concepts/auth"
+	"github.com/thorntonmc/go-practice/concepts/email"
+	"github.com/thorntonmc/go-practice/concepts/ratelimit"
+	"github.com/thorntonmc/go-practice/pkg/admin"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"github.com/thorntonmc/go-practice/pkg/config"
+	"github.com/thorntonmc/go-practice/pkg/envconfig"
+	"github.com/thorntonmc/go-practice/pkg/ip"
+	"github.com/thorntonmc/go-practice/pkg/lifecycle"
+	"github.com/thorntonmc/go-practice/pkg/server"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func main() {
+	var env struct {
+		ConfigPath string `env:"TODO_CONFIG"`
+
+		SMTPAddr     string `env:"TODO_SMTP_ADDR"`
+		SMTPUsername string `env:"TODO_SMTP_USERNAME"`
+		SMTPPassword string `env:"TODO_SMTP_PASSWORD"`
+		NotifyFrom   string `env:"TODO_NOTIFY_FROM,default=todo@localhost"`
+		NotifyTo     string `env:"TODO_NOTIFY_TO"`
+
+		CursorSecret string        `env:"TODO_CURSOR_SECRET"`
+		SessionTTL   time.Duration `env:"TODO_SESSION_TTL,default=24h"`
+
+		TrustedProxies []string `env:"TODO_TRUSTED_PROXIES"`
+		ProxyHeader    string   `env:"TODO_PROXY_HEADER,default=X-Forwarded-For"`
+	}
+	if err := envconfig.Process(os.LookupEnv, &env); err != nil {
+		log.Fatal(err)
+	}
+
+	path := flag.String("config", env.ConfigPath, "path to a YAML config file")
+	addr := flag.String("addr", "", "address to listen on, overriding server.addr and SERVER_ADDR")
+	showVersion := version.AddFlag(flag.CommandLine)
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("todo", version.Get())
+		return
+	}
+
+	cfg, err := config.Load(*path, os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *addr != "" {
+		cfg.Server.Addr = *addr
+		// checked again, in case it's now the admin address
+		if err := cfg.Validate(); err != nil {
+			log.Fatalf("config: %v", err)
+		}
+	}
+
+	trusted, err := ip.ParseTrusted(env.TrustedProxies...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	proxyHeader, err := ip.ParseHeader(env.ProxyHeader)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger := log.Default()
+	repo := todo.NewMemoryRepository()
+
+	var notify todo.Notifier = todo.NopNotifier{}
+	if env.SMTPAddr != "" && env.NotifyTo != "" {
+		sender := &email.SMTPSender{Addr: env.SMTPAddr}
+		if env.SMTPUsername != "" {
+			host, _, _ := net.SplitHostPort(env.SMTPAddr)
+			sender.Auth = smtp.PlainAuth("", env.SMTPUsername, env.SMTPPassword, host)
+		}
+		notify = todo.NewEmailNotifier(sender, env.NotifyFrom, env.NotifyTo)
+	}
+
+	var opts []todo.Option
+	if env.CursorSecret != "" {
+		opts = append(opts, todo.WithCursorSecret([]byte(env.CursorSecret)))
+	}
+	todos := todo.NewHandler(repo, notify, logger, opts...)
+
+	// five login attempts, then one a minute, per client and per username
+	// from each client. Registrations get the same per client
+	clk := clock.New()
+	attempts := ratelimit.NewKeyed(10000, func() ratelimit.Limiter { return ratelimit.NewTokenBucket(1.0/60, 5, clk) })
+	sessions := auth.NewSessions(env.SessionTTL, clk)
+	defer sessions.Close()
+	a, err := auth.New(auth.NewMemoryUsers(), sessions, attempts, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/auth/", a.Routes())
+	mux.Handle("/", a.Require(todos))
+	handler := ip.RealIP(trusted, proxyHeader)(mux)
+
+	srv := server.FromConfig(cfg.Server, handler)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	lc := lifecycle.New(logger)
+	stats := admin.New("todo", admin.WithCounter("todos", expvar.Func(func() any {
+		all, err := repo.List(context.Background())
+		if err != nil {
+			return nil
+		}
+		return len(all)
+	})))
+	if adm := server.Admin(cfg.Server, stats); adm != nil {
+		lc.Append(lifecycle.HTTPServer("admin", adm))
+	}
+	lc.Append(lifecycle.HTTPServer("http", srv))
+
+	logger.Printf("todo: listening on %s", cfg.Server.Addr)
+	if err := lc.Run(ctx); err != nil {
+		logger.Fatal(err)
+	}
+}
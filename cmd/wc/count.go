@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// counts is what wc reports for one input
+type counts struct {
+	Lines, Words, Runes, Bytes int64
+}
+
+func (c *counts) add(o counts) {
+	c.Lines += o.Lines
+	c.Words += o.Words
+	c.Runes += o.Runes
+	c.Bytes += o.Bytes
+}
+
+// readSize is how much is read at a time
+const readSize = 64 << 10
+
+// asciiSpace is unicode.IsSpace for the first 128 runes, as a table. Most
+// text is mostly ASCII, and this keeps it off the slow path
+var asciiSpace = [utf8.RuneSelf]bool{'\t': true, '\n': true, '\v': true, '\f': true, '\r': true, ' ': true}
+
+// shard is the counts for a stretch of input, and what's needed to join it
+// to the stretches either side: a word running over the join was counted
+// once by each
+type shard struct {
+	counts
+	empty        bool
+	startsInWord bool // the first rune isn't a space
+	endsInWord   bool // nor is the last
+}
+
+// join appends next to s
+func (s shard) join(next shard) shard {
+	if next.empty {
+		return s
+	}
+	if s.empty {
+		return next
+	}
+	joined := s
+	joined.add(next.counts)
+	if s.endsInWord && next.startsInWord {
+		joined.Words--
+	}
+	joined.endsInWord = next.endsInWord
+	return joined
+}
+
+// count reads r to the end.
+//
+// Runes are decoded as they go past, and a read can end in the middle of
+// one: "é" is two bytes, and nothing stops the first landing at the end of
+// one read and the second at the start of the next. Decoding the first
+// alone would count a bad rune, and the second as another. So a rune that
+// isn't all there yet is carried over - at most three bytes - and finished
+// with the next read. Bytes that aren't UTF-8 at all are a rune each, as
+// they are to range over a string
+func count(r io.Reader) (shard, error) {
+	s := shard{empty: true}
+	inWord := false
+	buf := make([]byte, utf8.UTFMax-1+readSize)
+	carry := 0
+	for {
+		n, err := r.Read(buf[carry : carry+readSize])
+		data := buf[:carry+n]
+		atEOF := err == io.EOF
+		s.Bytes += int64(n)
+		s.Lines += int64(bytes.Count(data[carry:], []byte("\n")))
+
+		i := 0
+		for i < len(data) {
+			c := data[i]
+			space := false
+			if c < utf8.RuneSelf {
+				space = asciiSpace[c]
+				i++
+			} else {
+				if !atEOF && !utf8.FullRune(data[i:]) {
+					break
+				}
+				r, size := utf8.DecodeRune(data[i:])
+				space = unicode.IsSpace(r) // RuneError isn't, so bad bytes are word
+				i += size
+			}
+			s.Runes++
+			if s.empty {
+				s.empty = false
+				s.startsInWord = !space
+			}
+			if !space && !inWord {
+				s.Words++
+			}
+			inWord = !space
+		}
+		carry = copy(buf, data[i:])
+
+		if atEOF {
+			s.endsInWord = inWord
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+	}
+}
+
+// countParallel splits r, size bytes long, into one shard per worker and
+// counts them at the same time.
+//
+// Lines and bytes don't care where the cuts go. Words and runes do, and
+// each has its fix: a cut in the middle of a rune is moved to its end, and
+// a word cut in two is spotted by shard.join and counted once
+func countParallel(r io.ReaderAt, size int64, workers int) (counts, error) {
+	workers = max(1, workers)
+	cuts := make([]int64, workers+1)
+	for i := 1; i < workers; i++ {
+		cut, err := runeStart(r, size, max(cuts[i-1], size*int64(i)/int64(workers)))
+		if err != nil {
+			return counts{}, err
+		}
+		cuts[i] = cut
+	}
+	cuts[workers] = size
+
+	shards := make([]shard, workers)
+	var g errgroup.Group
+	for i := 0; i < workers; i++ {
+		i := i
+		g.Go(func() error {
+			s, err := count(io.NewSectionReader(r, cuts[i], cuts[i+1]-cuts[i]))
+			shards[i] = s
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return counts{}, err
+	}
+
+	total := shards[0]
+	for _, s := range shards[1:] {
+		total = total.join(s)
+	}
+	return total.counts, nil
+}
+
+// runeStart returns off, or if off is in the middle of a rune, the end of
+// that rune - somewhere decoding from the start would begin one.
+//
+// Skipping continuation bytes isn't enough: a continuation byte that isn't
+// part of a valid rune is a bad rune of its own, and decoding starts again
+// right after it. So look back instead, at most three bytes, for a lead
+// byte whose rune reaches past off
+func runeStart(r io.ReaderAt, size, off int64) (int64, error) {
+	from := max(0, off-(utf8.UTFMax-1))
+	var b [2*utf8.UTFMax - 2]byte
+	n, err := r.ReadAt(b[:], from)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	for i := int64(0); from+i < off; i++ {
+		if !utf8.RuneStart(b[i]) {
+			continue
+		}
+		_, width := utf8.DecodeRune(b[i:n])
+		if from+i+int64(width) > off {
+			return from + i + int64(width), nil
+		}
+	}
+	return min(off, size), nil
+}
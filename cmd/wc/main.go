@@ -0,0 +1,163 @@
+// wc counts lines, words, runes and bytes.
+//
+//	wc [-l] [-w] [-m] [-c] [-parallel N] [FILE...]
+//
+// With no flags it prints lines, words and bytes, like wc; -m adds runes,
+// which are what wc calls characters in a UTF-8 locale. A word is anything
+// between unicode.IsSpace runes. With no files, or "-", it reads stdin, and
+// with more than one it adds a total.
+//
+// -parallel splits each regular file of a megabyte or more across that many
+// goroutines. Stdin can't be split - there's no reading it from the middle
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+// parallelMin is the smallest file -parallel splits. Below it, starting
+// the goroutines costs more than they save
+const parallelMin = 1 << 20
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+type columns struct {
+	lines, words, runes, bytes bool
+}
+
+// run is main without the process around it, so tests can call it. Like wc
+// it exits 1 if any file couldn't be read, after counting the rest
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("wc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: wc [flags] [FILE...]")
+		fs.PrintDefaults()
+	}
+
+	var cols columns
+	fs.BoolVar(&cols.lines, "l", false, "count lines")
+	fs.BoolVar(&cols.words, "w", false, "count words")
+	fs.BoolVar(&cols.runes, "m", false, "count runes")
+	fs.BoolVar(&cols.bytes, "c", false, "count bytes")
+	workers := fs.Int("parallel", 1, "goroutines to split each large file across, 0 for one per CPU")
+	showVersion := version.AddFlag(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *showVersion {
+		fmt.Fprintln(stdout, "wc", version.Get())
+		return 0
+	}
+	if cols == (columns{}) {
+		cols = columns{lines: true, words: true, bytes: true}
+	}
+	if *workers < 0 {
+		fmt.Fprintln(stderr, "wc: -parallel can't be negative")
+		return 2
+	}
+	if *workers == 0 {
+		*workers = runtime.GOMAXPROCS(0)
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+
+	var total counts
+	failed := false
+	for _, name := range files {
+		c, err := countFile(name, stdin, *workers)
+		if err != nil {
+			// flushed first so the error comes out after the lines before it
+			out.Flush()
+			fmt.Fprintf(stderr, "wc: %s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		total.add(c)
+		display := name
+		if len(fs.Args()) == 0 {
+			display = ""
+		}
+		printCounts(out, cols, c, display)
+	}
+	if len(files) > 1 {
+		printCounts(out, cols, total, "total")
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func countFile(name string, stdin io.Reader, workers int) (counts, error) {
+	if name == "-" {
+		s, err := count(stdin)
+		return s.counts, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		// the name is already printed, "open x:" would repeat it
+		var pe *os.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return counts{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return counts{}, err
+	}
+	if fi.IsDir() {
+		return counts{}, errors.New("is a directory")
+	}
+	// only a regular file has a size to split by. A pipe or a device
+	// has to be read front to back
+	if workers > 1 && fi.Mode().IsRegular() && fi.Size() >= parallelMin {
+		return countParallel(f, fi.Size(), workers)
+	}
+	s, err := count(f)
+	return s.counts, err
+}
+
+// printCounts writes the chosen columns, each eight wide as BSD wc does,
+// then the name if there is one
+func printCounts(w io.Writer, cols columns, c counts, name string) {
+	for _, col := range []struct {
+		show bool
+		n    int64
+	}{
+		{cols.lines, c.Lines},
+		{cols.words, c.Words},
+		{cols.runes, c.Runes},
+		{cols.bytes, c.Bytes},
+	} {
+		if col.show {
+			fmt.Fprintf(w, "%8d", col.n)
+		}
+	}
+	if name != "" {
+		fmt.Fprintf(w, " %s", name)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func wc(t *testing.T, stdin io.Reader, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = run(args, stdin, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+// fixtures are what GNU wc -lwmc says about testdata, in a UTF-8 locale
+var fixtures = map[string]counts{
+	"ascii.txt":     {Lines: 5, Words: 14, Runes: 61, Bytes: 61},
+	"utf8.txt":      {Lines: 4, Words: 11, Runes: 66, Bytes: 116},
+	"crlf.txt":      {Lines: 2, Words: 3, Runes: 23, Bytes: 23},
+	"empty.txt":     {},
+	"nonewline.txt": {Lines: 0, Words: 5, Runes: 21, Bytes: 21},
+	"spaces.txt":    {Lines: 1, Words: 3, Runes: 6, Bytes: 9},
+	// GNU wc says 6 words and 28 runes: it skips the three bad bytes. Here
+	// they're a rune each, as they are to range over a string, and not
+	// spaces, so "\xff\xfe" and "\xc3" are words too
+	"invalid.txt": {Lines: 3, Words: 8, Runes: 31, Bytes: 31},
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return b
+}
+
+func TestFixtures(t *testing.T) {
+	for name, want := range fixtures {
+		data := readFixture(t, name)
+
+		got, err := count(bytes.NewReader(data))
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got.counts, name)
+
+		// a byte per read splits every multibyte rune across reads
+		got, err = count(iotest.OneByteReader(bytes.NewReader(data)))
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got.counts, "%s a byte at a time", name)
+
+		// and cut into every number of shards there are bytes for, so the
+		// cuts land everywhere: mid-rune, mid-word, on spaces and newlines
+		for workers := 1; workers <= len(data)+1; workers++ {
+			got, err := countParallel(bytes.NewReader(data), int64(len(data)), workers)
+			require.NoError(t, err, name)
+			assert.Equal(t, want, got, "%s in %d shards", name, workers)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	ascii := filepath.Join("testdata", "ascii.txt")
+	utf8 := filepath.Join("testdata", "utf8.txt")
+
+	code, stdout, stderr := wc(t, nil, ascii)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "       5      14      61 "+ascii+"\n", stdout, "lines, words and bytes by default")
+	assert.Empty(t, stderr)
+
+	_, stdout, _ = wc(t, nil, "-m", utf8)
+	assert.Equal(t, "      66 "+utf8+"\n", stdout)
+
+	_, stdout, _ = wc(t, nil, "-c", "-l", "-m", utf8)
+	assert.Equal(t, "       4      66     116 "+utf8+"\n", stdout, "columns in wc's order, whatever the flags' order")
+
+	_, stdout, _ = wc(t, nil, "-l", ascii, utf8)
+	assert.Equal(t, "       5 "+ascii+"\n       4 "+utf8+"\n       9 total\n", stdout)
+}
+
+func TestStdin(t *testing.T) {
+	code, stdout, _ := wc(t, strings.NewReader("héllo wörld\n"))
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "       1       2      14\n", stdout, "no name for stdin alone")
+
+	ascii := filepath.Join("testdata", "ascii.txt")
+	_, stdout, _ = wc(t, strings.NewReader("one two\n"), "-w", ascii, "-")
+	assert.Equal(t, "      14 "+ascii+"\n       2 -\n      16 total\n", stdout)
+}
+
+func TestErrors(t *testing.T) {
+	ascii := filepath.Join("testdata", "ascii.txt")
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+
+	code, stdout, stderr := wc(t, nil, "-l", missing, ascii)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "       5 "+ascii+"\n       5 total\n", stdout, "the other files are still counted")
+	assert.Equal(t, "wc: "+missing+": no such file or directory\n", stderr)
+
+	code, _, stderr = wc(t, nil, "testdata")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "is a directory")
+
+	code, _, _ = wc(t, nil, "-x")
+	assert.Equal(t, 2, code, "unknown flag")
+
+	code, _, _ = wc(t, nil, "-parallel", "-1")
+	assert.Equal(t, 2, code)
+}
+
+func TestVersion(t *testing.T) {
+	code, stdout, _ := wc(t, strings.NewReader("not read"), "--version")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "wc "+version.Get().String()+"\n", stdout)
+}
+
+func TestParallel(t *testing.T) {
+	// a few megabytes of the fixtures over and over, so it's big enough to
+	// be split
+	var buf bytes.Buffer
+	var want counts
+	for buf.Len() < 3*parallelMin {
+		for name, c := range fixtures {
+			buf.Write(readFixture(t, name))
+			want.add(c)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "big.txt")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+
+	// joining the fixtures end to end runs words together where one has no
+	// newline at the end, so the expected words come from counting it whole
+	s, err := count(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	want.Words = s.Words
+	line := fmt.Sprintf("%8d%8d%8d%8d %s\n", want.Lines, want.Words, want.Runes, want.Bytes, path)
+
+	for _, workers := range []string{"1", "2", "7", "0"} {
+		code, stdout, _ := wc(t, nil, "-l", "-w", "-m", "-c", "-parallel", workers, path)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, line, stdout, "-parallel %s", workers)
+	}
+}
+
+func TestRuneStart(t *testing.T) {
+	data := []byte("a日b\x80\x80\x80\x80c")
+	for off, want := range map[int64]int64{
+		0: 0, 1: 1, 2: 4, 3: 4, 4: 4, // 日 is bytes 1 to 3
+		5: 5, 6: 6, 7: 7, // stray continuation bytes are a rune each
+		8: 8, 9: 9,
+	} {
+		got, err := runeStart(bytes.NewReader(data), int64(len(data)), off)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "from %d", off)
+	}
+}
+
+// go test -bench Count ./cmd/wc
+func BenchmarkCount(b *testing.B) {
+	data := bytes.Repeat([]byte("The quick brown 🦊 jumps over the lazy dog, größer als 日本語.\n"), 1<<14)
+	path := filepath.Join(b.TempDir(), "bench.txt")
+	require.NoError(b, os.WriteFile(path, data, 0o644))
+
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := countFile(path, nil, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package algorithms
+
+import "cmp"
+
+// Binary search finds a value in a sorted slice in O(log n) by halving the
+// range it could be in. The idea is simple and the details are famously easy
+// to get wrong - an off-by-one that loops forever, or lo+hi overflowing.
+// Two habits avoid most of it:
+//
+//   - a half-open range [lo, hi), so hi is never a valid index and the loop
+//     runs while lo < hi
+//   - asking "where's the first element that's >= target" rather than "is it
+//     here", which has exactly one answer even with duplicates or when the
+//     target is missing
+//
+// The stdlib has all of this as slices.BinarySearch and sort.Search, these
+// are for seeing how they work
+
+// LowerBound returns the index of the first element >= target, or len(s)
+// when there isn't one. It's where target would be inserted to keep s sorted
+func LowerBound[S ~[]E, E cmp.Ordered](s S, target E) int {
+	return FirstTrue(len(s), func(i int) bool { return cmp.Compare(s[i], target) >= 0 })
+}
+
+// UpperBound returns the index of the first element > target. The elements
+// equal to target are s[LowerBound:UpperBound]
+func UpperBound[S ~[]E, E cmp.Ordered](s S, target E) int {
+	return FirstTrue(len(s), func(i int) bool { return cmp.Compare(s[i], target) > 0 })
+}
+
+// BinarySearch returns where target is in s and true, or where it would go
+// and false - the same contract as slices.BinarySearch
+func BinarySearch[S ~[]E, E cmp.Ordered](s S, target E) (int, bool) {
+	i := LowerBound(s, target)
+	return i, i < len(s) && cmp.Compare(s[i], target) == 0
+}
+
+// FirstTrue returns the smallest i in [0, n) for which pred is true, or n.
+// pred must be false then true - once true it stays true - which is the
+// only thing binary search needs. It doesn't need a slice at all, so it can
+// search a space of answers, see Sqrt
+func FirstTrue(n int, pred func(int) bool) int {
+	lo, hi := 0, n
+	for lo < hi {
+		// (lo+hi)/2 can overflow when both are huge, this can't
+		mid := int(uint(lo+hi) >> 1)
+		if pred(mid) {
+			hi = mid // mid might be the answer, keep it in range
+		} else {
+			lo = mid + 1 // mid definitely isn't
+		}
+	}
+	return lo
+}
+
+// Sqrt is the integer square root of n, found by searching the answers
+// rather than a slice: the first x whose square is too big, minus one
+func Sqrt(n int) int {
+	if n < 2 {
+		return n
+	}
+	// every answer is at most n/2+1, and checking x > n/x instead of x*x > n
+	// avoids overflowing
+	return FirstTrue(n/2+2, func(x int) bool { return x > 0 && x > n/x }) - 1
+}
@@ -0,0 +1,89 @@
+package algorithms
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinarySearch(t *testing.T) {
+	s := []int{1, 3, 3, 3, 5, 8}
+
+	tests := []struct {
+		target       int
+		lower, upper int
+		found        bool
+	}{
+		{0, 0, 0, false},
+		{1, 0, 1, true},
+		{3, 1, 4, true},
+		{4, 4, 4, false},
+		{8, 5, 6, true},
+		{9, 6, 6, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.lower, LowerBound(s, tt.target), "lower %d", tt.target)
+		assert.Equal(t, tt.upper, UpperBound(s, tt.target), "upper %d", tt.target)
+		i, found := BinarySearch(s, tt.target)
+		assert.Equal(t, tt.lower, i)
+		assert.Equal(t, tt.found, found)
+	}
+
+	i, found := BinarySearch([]string{}, "x")
+	assert.Equal(t, 0, i)
+	assert.False(t, found)
+}
+
+func TestBinarySearchMatchesStdlib(t *testing.T) {
+	property := func(s []int16, target int16) bool {
+		slices.Sort(s)
+		wantI, wantFound := slices.BinarySearch(s, target)
+		i, found := BinarySearch(s, target)
+		return i == wantI && found == wantFound &&
+			UpperBound(s, target) == sort.Search(len(s), func(i int) bool { return s[i] > target })
+	}
+	require.NoError(t, quick.Check(property, &quick.Config{MaxCount: 1000}))
+}
+
+func TestFirstTrue(t *testing.T) {
+	assert.Equal(t, 0, FirstTrue(0, func(int) bool { panic("never called") }))
+	assert.Equal(t, 10, FirstTrue(10, func(int) bool { return false }))
+	assert.Equal(t, 0, FirstTrue(10, func(int) bool { return true }))
+	assert.Equal(t, 7, FirstTrue(10, func(i int) bool { return i >= 7 }))
+
+	// no overflow halfway through a huge range
+	assert.Equal(t, math.MaxInt-1, FirstTrue(math.MaxInt, func(i int) bool { return i >= math.MaxInt-1 }))
+}
+
+func TestSqrt(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 4, 15, 16, 17, 1 << 40, math.MaxInt} {
+		r := Sqrt(n)
+		assert.LessOrEqual(t, r, n/max(r, 1), "%d", n)
+		assert.Greater(t, (r + 1), n/(r+1), "%d", n)
+	}
+	assert.Equal(t, 3037000499, Sqrt(math.MaxInt))
+}
+
+var sinkIndex int
+
+func BenchmarkBinarySearch(b *testing.B) {
+	s := make([]int, 1<<20)
+	for i := range s {
+		s[i] = 2 * i
+	}
+	b.Run("ours", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sinkIndex, _ = BinarySearch(s, i%(2<<20))
+		}
+	})
+	b.Run("stdlib", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sinkIndex, _ = slices.BinarySearch(s, i%(2<<20))
+		}
+	})
+}
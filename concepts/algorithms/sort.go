@@ -0,0 +1,152 @@
+package algorithms
+
+import "cmp"
+
+// Sorting by comparison can't beat O(n log n) comparisons in the worst
+// case, so the interesting differences are elsewhere:
+//
+//   - insertion sort is O(n²) but has almost no overhead, and is the fastest
+//     thing going for a handful of elements - both sorts below hand small
+//     ranges to it
+//   - quicksort sorts in place and is usually fastest in practice, but isn't
+//     stable and goes quadratic on unlucky pivots
+//   - merge sort is always O(n log n) and stable (equal elements keep their
+//     order), at the cost of an n-sized buffer
+//
+// slices.Sort is pattern-defeating quicksort, a quicksort that notices when
+// it's going badly and switches to heapsort. slices.SortStableFunc is an
+// in-place merge sort. The tests check these against both
+
+// insertionThreshold is where recursing stops paying for itself. The stdlib
+// uses 12; anything from 8 to 32 performs about the same
+const insertionThreshold = 12
+
+// InsertionSortFunc sorts s by moving each element left past the bigger
+// ones before it. It's stable
+func InsertionSortFunc[S ~[]E, E any](s S, cmp func(a, b E) int) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && cmp(s[j], s[j-1]) < 0; j-- {
+			s[j], s[j-1] = s[j-1], s[j]
+		}
+	}
+}
+
+func QuickSort[S ~[]E, E cmp.Ordered](s S) {
+	QuickSortFunc(s, cmp.Compare[E])
+}
+
+// QuickSortFunc sorts s in place, not stably. The pivot is the median of
+// the first, middle and last elements, so already sorted or reversed input -
+// the classic worst case for "pick the first element" - splits evenly.
+//
+// Partitioning three ways, into less than, equal to and greater than the
+// pivot, is what keeps lots of duplicates fast. With only two ways an all
+// equal slice splits 0 and n-1 every time, and goes quadratic.
+//
+// Recursing into the smaller side and looping on the bigger one keeps the
+// stack O(log n) even when the splits are lopsided
+func QuickSortFunc[S ~[]E, E any](s S, cmp func(a, b E) int) {
+	for len(s) > insertionThreshold {
+		lt, gt := partition(s, cmp)
+		if lt < len(s)-gt {
+			QuickSortFunc(s[:lt], cmp)
+			s = s[gt:]
+		} else {
+			QuickSortFunc(s[gt:], cmp)
+			s = s[:lt]
+		}
+	}
+	InsertionSortFunc(s, cmp)
+}
+
+// partition rearranges s into s[:lt] < pivot, s[lt:gt] == pivot and
+// s[gt:] > pivot - Dijkstra's Dutch national flag. The middle part is
+// already in its final place
+func partition[S ~[]E, E any](s S, cmp func(a, b E) int) (lt, gt int) {
+	last, mid := len(s)-1, len(s)/2
+
+	// sort the three candidates, leaving the median in the middle
+	if cmp(s[mid], s[0]) < 0 {
+		s[mid], s[0] = s[0], s[mid]
+	}
+	if cmp(s[last], s[mid]) < 0 {
+		s[last], s[mid] = s[mid], s[last]
+		if cmp(s[mid], s[0]) < 0 {
+			s[mid], s[0] = s[0], s[mid]
+		}
+	}
+	pivot := s[mid]
+
+	lt, gt = 0, len(s)
+	for i := 0; i < gt; {
+		switch c := cmp(s[i], pivot); {
+		case c < 0:
+			s[lt], s[i] = s[i], s[lt]
+			lt++
+			i++
+		case c > 0:
+			gt--
+			s[i], s[gt] = s[gt], s[i] // s[i] is new, look at it again
+		default:
+			i++
+		}
+	}
+	return lt, gt
+}
+
+func MergeSort[S ~[]E, E cmp.Ordered](s S) {
+	MergeSortFunc(s, cmp.Compare[E])
+}
+
+// MergeSortFunc sorts s stably: sort each half, then merge them by
+// repeatedly taking the smaller front element. Taking from the left half on
+// ties is what makes it stable. One buffer is allocated up front and shared
+// by every merge
+func MergeSortFunc[S ~[]E, E any](s S, cmp func(a, b E) int) {
+	if len(s) <= insertionThreshold {
+		InsertionSortFunc(s, cmp)
+		return
+	}
+	mergeSort(s, make(S, len(s)), cmp)
+}
+
+func mergeSort[S ~[]E, E any](s, buf S, cmp func(a, b E) int) {
+	if len(s) <= insertionThreshold {
+		InsertionSortFunc(s, cmp)
+		return
+	}
+	mid := len(s) / 2
+	mergeSort(s[:mid], buf[:mid], cmp)
+	mergeSort(s[mid:], buf[mid:], cmp)
+
+	// already in order, a common case worth the one comparison
+	if cmp(s[mid-1], s[mid]) <= 0 {
+		return
+	}
+
+	copy(buf, s)
+	left, right := buf[:mid], buf[mid:len(s)]
+	i, j, k := 0, 0, 0
+	for i < len(left) && j < len(right) {
+		if cmp(right[j], left[i]) < 0 {
+			s[k] = right[j]
+			j++
+		} else {
+			s[k] = left[i]
+			i++
+		}
+		k++
+	}
+	k += copy(s[k:], left[i:])
+	copy(s[k:], right[j:])
+}
+
+// IsSorted reports whether s is in ascending order
+func IsSorted[S ~[]E, E cmp.Ordered](s S) bool {
+	for i := 1; i < len(s); i++ {
+		if cmp.Less(s[i], s[i-1]) {
+			return false
+		}
+	}
+	return true
+}
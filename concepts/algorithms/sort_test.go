@@ -0,0 +1,147 @@
+package algorithms
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sorters are checked against slices.Sort, which is the oracle: whatever
+// input quick.Check comes up with, they must agree with it
+var sorters = map[string]func([]int){
+	"quick":     QuickSort[[]int],
+	"merge":     MergeSort[[]int],
+	"insertion": func(s []int) { InsertionSortFunc(s, cmp.Compare[int]) },
+}
+
+func TestSortMatchesStdlib(t *testing.T) {
+	for name, sort := range sorters {
+		t.Run(name, func(t *testing.T) {
+			property := func(s []int) bool {
+				want := slices.Clone(s)
+				slices.Sort(want)
+				sort(s)
+				return slices.Equal(want, s)
+			}
+			require.NoError(t, quick.Check(property, &quick.Config{MaxCount: 500}))
+		})
+	}
+}
+
+// shapes are the inputs that break naive sorts. Random slices rarely have
+// long runs or lots of duplicates, so they're tested on purpose
+func shapes(n int) map[string][]int {
+	r := rand.New(rand.NewSource(int64(n)))
+	random, sorted, reversed, equal, fewValues, sawtooth := make([]int, n), make([]int, n), make([]int, n), make([]int, n), make([]int, n), make([]int, n)
+	for i := 0; i < n; i++ {
+		random[i] = r.Int()
+		sorted[i] = i
+		reversed[i] = n - i
+		equal[i] = 7
+		fewValues[i] = r.Intn(3)
+		sawtooth[i] = i % 10
+	}
+	return map[string][]int{
+		"random": random, "sorted": sorted, "reversed": reversed,
+		"equal": equal, "few values": fewValues, "sawtooth": sawtooth,
+	}
+}
+
+func TestSortShapes(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, insertionThreshold, insertionThreshold + 1, 100, 10000} {
+		for shape, input := range shapes(n) {
+			want := slices.Clone(input)
+			slices.Sort(want)
+
+			for name, sort := range sorters {
+				if name == "insertion" && n > 1000 {
+					continue
+				}
+				got := slices.Clone(input)
+				sort(got)
+				assert.Equal(t, want, got, "%s sort, %d %s", name, n, shape)
+			}
+		}
+	}
+}
+
+func TestSortOtherTypes(t *testing.T) {
+	words := strings.Fields("the quick brown fox jumps over the lazy dog")
+	QuickSort(words)
+	assert.True(t, IsSorted(words))
+	assert.Equal(t, "brown", words[0])
+
+	// NaN sorts first, as with slices.Sort, since cmp.Compare puts it there
+	floats := []float64{3, math.NaN(), -1, math.Inf(1), 0, math.NaN(), math.Inf(-1)}
+	want := slices.Clone(floats)
+	slices.Sort(want)
+	MergeSort(floats)
+	assert.Equal(t, fmt.Sprint(want), fmt.Sprint(floats))
+}
+
+func TestMergeSortIsStable(t *testing.T) {
+	type person struct {
+		name string
+		age  int
+	}
+	byAge := func(a, b person) int { return cmp.Compare(a.age, b.age) }
+
+	property := func(ages []uint8) bool {
+		people := make([]person, len(ages))
+		for i, a := range ages {
+			people[i] = person{name: fmt.Sprint(i), age: int(a % 5)} // plenty of ties
+		}
+		want := slices.Clone(people)
+		slices.SortStableFunc(want, byAge)
+		MergeSortFunc(people, byAge)
+		return slices.Equal(want, people)
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+func TestIsSorted(t *testing.T) {
+	assert.True(t, IsSorted([]int{}))
+	assert.True(t, IsSorted([]int{1, 1, 2}))
+	assert.False(t, IsSorted([]int{2, 1}))
+}
+
+func FuzzQuickSort(f *testing.F) {
+	f.Add([]byte{3, 1, 2})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		want := slices.Clone(b)
+		slices.Sort(want)
+		QuickSort(b)
+		if !slices.Equal(want, b) {
+			t.Fatalf("got %v, want %v", b, want)
+		}
+	})
+}
+
+func BenchmarkSort(b *testing.B) {
+	all := map[string]func([]int){
+		"quick":  QuickSort[[]int],
+		"merge":  MergeSort[[]int],
+		"stdlib": slices.Sort[[]int],
+	}
+	for shape, input := range shapes(10000) {
+		for name, sort := range all {
+			b.Run(shape+"/"+name, func(b *testing.B) {
+				s := make([]int, len(input))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					copy(s, input)
+					sort(s)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package algorithms
+
+import "cmp"
+
+// Two pointers walk a slice at once - from both ends towards the middle, or
+// one behind the other - turning what looks like an O(n²) "check every
+// pair" into a single O(n) pass. It needs a reason to move one pointer and
+// not the other, and that's usually that the slice is sorted
+
+// PairWithSum finds i < j with s[i]+s[j] == target in a sorted slice. If the
+// sum is too small the left element can't be part of any answer - pairing it
+// with anything smaller than the right one only makes it smaller - so left
+// moves in, and the same the other way round
+func PairWithSum[S ~[]E, E cmp.Ordered](s S, target E) (i, j int, ok bool) {
+	i, j = 0, len(s)-1
+	for i < j {
+		switch sum := s[i] + s[j]; {
+		case sum == target:
+			return i, j, true
+		case sum < target:
+			i++
+		default:
+			j--
+		}
+	}
+	return 0, 0, false
+}
+
+// Dedup removes repeats from a sorted slice in place and returns the
+// shortened slice. One pointer reads, the other marks the end of what's
+// kept. It's slices.Compact, which works the same way
+func Dedup[S ~[]E, E comparable](s S) S {
+	if len(s) == 0 {
+		return s
+	}
+	w := 1
+	for r := 1; r < len(s); r++ {
+		if s[r] != s[w-1] {
+			s[w] = s[r]
+			w++
+		}
+	}
+	clear(s[w:]) // let go of anything the dropped elements pointed to
+	return s[:w]
+}
+
+// MergeSorted merges two sorted slices into a new sorted one, taking from a
+// on ties so equal elements keep their order
+func MergeSorted[S ~[]E, E cmp.Ordered](a, b S) S {
+	out := make(S, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if cmp.Less(b[j], a[i]) {
+			out = append(out, b[j])
+			j++
+		} else {
+			out = append(out, a[i])
+			i++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// IsPalindrome reads s from both ends at once
+func IsPalindrome[S ~[]E, E comparable](s S) bool {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		if s[i] != s[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxArea is the "container with most water" puzzle: heights[i] are walls,
+// and the answer is the most water two of them can hold between them. The
+// shorter of the two outer walls limits any container using it, and every
+// other partner is closer, so it can be dropped - move that pointer in
+func MaxArea(heights []int) int {
+	best := 0
+	for i, j := 0, len(heights)-1; i < j; {
+		h := min(heights[i], heights[j])
+		best = max(best, h*(j-i))
+		if heights[i] < heights[j] {
+			i++
+		} else {
+			j--
+		}
+	}
+	return best
+}
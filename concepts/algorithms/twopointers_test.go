@@ -0,0 +1,100 @@
+package algorithms
+
+import (
+	"slices"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPairWithSum(t *testing.T) {
+	i, j, ok := PairWithSum([]int{1, 2, 4, 7, 11, 15}, 15)
+	require.True(t, ok)
+	assert.Equal(t, []int{2, 4}, []int{i, j})
+
+	_, _, ok = PairWithSum([]int{1, 2, 4}, 100)
+	assert.False(t, ok)
+	_, _, ok = PairWithSum([]int{5}, 10)
+	assert.False(t, ok, "one element can't pair with itself")
+
+	// against checking every pair
+	property := func(s []int8, target int8) bool {
+		ints := make([]int, len(s))
+		for k, v := range s {
+			ints[k] = int(v)
+		}
+		slices.Sort(ints)
+
+		want := false
+		for a := range ints {
+			for b := a + 1; b < len(ints); b++ {
+				want = want || ints[a]+ints[b] == int(target)
+			}
+		}
+		i, j, ok := PairWithSum(ints, int(target))
+		return ok == want && (!ok || (i < j && ints[i]+ints[j] == int(target)))
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+func TestDedup(t *testing.T) {
+	assert.Equal(t, []int{1, 2, 3}, Dedup([]int{1, 1, 2, 3, 3, 3}))
+	assert.Empty(t, Dedup([]int{}))
+
+	property := func(s []uint8) bool {
+		slices.Sort(s)
+		want := slices.Compact(slices.Clone(s))
+		return slices.Equal(want, Dedup(s))
+	}
+	require.NoError(t, quick.Check(property, nil))
+
+	// dropped pointers are cleared so they can be collected
+	x, y := 1, 2
+	ptrs := []*int{&x, &x, &y}
+	kept := Dedup(ptrs)
+	assert.Len(t, kept, 2)
+	assert.Nil(t, ptrs[2])
+}
+
+func TestMergeSorted(t *testing.T) {
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, MergeSorted([]int{1, 3, 5}, []int{2, 4}))
+	assert.Equal(t, []int{1}, MergeSorted(nil, []int{1}))
+
+	property := func(a, b []int) bool {
+		slices.Sort(a)
+		slices.Sort(b)
+		want := append(slices.Clone(a), b...)
+		slices.Sort(want)
+		return slices.Equal(want, MergeSorted(a, b))
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+func TestIsPalindrome(t *testing.T) {
+	assert.True(t, IsPalindrome([]rune("racecar")))
+	assert.True(t, IsPalindrome([]int{}))
+	assert.True(t, IsPalindrome([]int{1, 2, 2, 1}))
+	assert.False(t, IsPalindrome([]byte("go")))
+}
+
+func TestMaxArea(t *testing.T) {
+	assert.Equal(t, 49, MaxArea([]int{1, 8, 6, 2, 5, 4, 8, 3, 7}))
+	assert.Equal(t, 0, MaxArea([]int{5}))
+
+	property := func(raw []uint8) bool {
+		h := make([]int, len(raw))
+		for i, v := range raw {
+			h[i] = int(v)
+		}
+		want := 0
+		for i := range h {
+			for j := i + 1; j < len(h); j++ {
+				want = max(want, min(h[i], h[j])*(j-i))
+			}
+		}
+		return MaxArea(h) == want
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
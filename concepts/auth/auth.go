@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	jsonconcept "github.com/thorntonmc/go-practice/concepts/json"
+	"github.com/thorntonmc/go-practice/pkg/httplimit"
+	"github.com/thorntonmc/go-practice/pkg/router"
+)
+
+// Registration, login and logout for a JSON API, and middleware that turns
+// a session cookie into an Identity for the handlers behind it. The pieces,
+// each explained where it lives:
+//
+//   - passwords are hashed with argon2id (password.go)
+//   - login starts a server-side session, and the browser holds its token in
+//     a cookie (store.go)
+//   - login attempts are throttled, per client IP and per username from
+//     that IP, so a password can't be guessed by trying them all - a slow
+//     hash alone only slows that down. Registering is throttled per IP
+//     too, since every one costs a hash
+//   - state-changing requests from another site are refused, see
+//     sameOrigin
+//
+// The cookie is HttpOnly, so script on the page - an XSS hole - can't read
+// the token, Secure, so it's never sent over plain http, and SameSite=Lax,
+// so the browser leaves it off most cross-site requests
+
+// CookieName is the session cookie
+const CookieName = "session"
+
+const (
+	maxBodyBytes      = 4 << 10
+	minPasswordLength = 8
+	// argon2 takes any length, but hashing a megabyte-long password on
+	// every login attempt is a cheap way to burn the server's CPU
+	maxPasswordLength = 256
+)
+
+// Auth serves the /auth endpoints and guards everything else
+type Auth struct {
+	users    UserStore
+	sessions *Sessions
+	limiter  httplimit.Limiter
+	params   Params
+	log      *log.Logger
+
+	dummyHash string
+}
+
+// Option configures New
+type Option func(*Auth)
+
+// WithParams hashes new passwords with p instead of DefaultParams. Existing
+// hashes are upgraded to p as their owners log in
+func WithParams(p Params) Option {
+	return func(a *Auth) { a.params = p }
+}
+
+// New wires Auth up. limiter throttles login attempts, and is asked about
+// two keys for each, "user:<address>/<username>" and "ip:<address>", and
+// registrations, as "register:<address>" - a ratelimit.Keyed fits.
+//
+// The username is never a key on its own: then anyone could lock a user
+// out, from anywhere, by failing their logins on purpose
+func New(users UserStore, sessions *Sessions, limiter httplimit.Limiter, logger *log.Logger, opts ...Option) (*Auth, error) {
+	a := &Auth{users: users, sessions: sessions, limiter: limiter, params: DefaultParams, log: logger}
+	for _, opt := range opts {
+		opt(a)
+	}
+	// checked when the username doesn't exist, so a missing user takes as
+	// long to turn away as a wrong password. Otherwise the response time
+	// tells an attacker which usernames are real
+	var err error
+	if a.dummyHash, err = HashPassword("not anyone's password", a.params); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Routes serves
+//
+//	POST /auth/register  {"username": ..., "password": ...}, and logs in
+//	POST /auth/login     {"username": ..., "password": ...}
+//	POST /auth/logout
+func (a *Auth) Routes() http.Handler {
+	r := router.New()
+	// login CSRF - a forged login into the attacker's account - is a thing
+	// too, so these get the same origin check as everything else
+	r.Use(sameOrigin)
+	r.HandleFunc("POST /auth/register", a.register)
+	r.HandleFunc("POST /auth/login", a.login)
+	r.HandleFunc("POST /auth/logout", a.logout)
+	return r
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (a *Auth) readCredentials(w http.ResponseWriter, r *http.Request) (credentials, bool) {
+	c, err := jsonconcept.Decode[credentials](r.Body, jsonconcept.DisallowUnknownFields(), jsonconcept.MaxBytes(maxBodyBytes))
+	if err != nil {
+		jsonconcept.WriteDecodeError(w, err)
+		return c, false
+	}
+	c.Username = strings.ToLower(strings.TrimSpace(c.Username))
+	return c, true
+}
+
+func (a *Auth) register(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.readCredentials(w, r)
+	if !ok {
+		return
+	}
+	if err := validate(c); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// every registration costs an argon2 hash, so without a limit it's a
+	// way to keep the server's CPU busy
+	if !a.allow(w, "register:"+httplimit.ClientIP(r), "too many registrations, try again later") {
+		return
+	}
+
+	hash, err := HashPassword(c.Password, a.params)
+	if err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+	u, err := a.users.Create(r.Context(), c.Username, hash)
+	switch {
+	case errors.Is(err, ErrUserExists):
+		// this tells anyone which usernames exist. A signup form can't
+		// avoid it without email verification, login can, and does
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		a.internalError(w, r, err)
+		return
+	}
+	a.startSession(w, u, http.StatusCreated)
+}
+
+func validate(c credentials) error {
+	if n := len(c.Username); n < 3 || n > 32 {
+		return errors.New("username must be 3 to 32 characters")
+	}
+	for _, r := range c.Username {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return errors.New("username may only use letters, digits, _ and -")
+		}
+	}
+	if n := len(c.Password); n < minPasswordLength || n > maxPasswordLength {
+		return errors.New("password must be " + strconv.Itoa(minPasswordLength) + " to " + strconv.Itoa(maxPasswordLength) + " characters")
+	}
+	return nil
+}
+
+// errBadLogin is the same whether the username or the password was wrong
+const errBadLogin = "wrong username or password"
+
+func (a *Auth) login(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.readCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	// both keys are spent whether or not the password is right, or an
+	// attacker could tell a right guess by it not being counted
+	ip := httplimit.ClientIP(r)
+	for _, key := range []string{"user:" + ip + "/" + c.Username, "ip:" + ip} {
+		if !a.allow(w, key, "too many login attempts, try again later") {
+			return
+		}
+	}
+
+	u, err := a.users.ByUsername(r.Context(), c.Username)
+	hash := u.PasswordHash
+	switch {
+	case errors.Is(err, ErrNoUser):
+		hash = a.dummyHash
+	case err != nil:
+		a.internalError(w, r, err)
+		return
+	}
+	match, err := VerifyPassword(c.Password, hash)
+	if err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+	if !match || u.ID == 0 {
+		writeError(w, http.StatusUnauthorized, errBadLogin)
+		return
+	}
+
+	if NeedsRehash(u.PasswordHash, a.params) {
+		// failing to upgrade the hash isn't worth failing the login over
+		hash, err := HashPassword(c.Password, a.params)
+		if err == nil {
+			err = a.users.SetPasswordHash(r.Context(), u.ID, hash)
+		}
+		if err != nil {
+			a.log.Printf("auth: rehashing password for %d: %v", u.ID, err)
+		}
+	}
+	a.startSession(w, u, http.StatusOK)
+}
+
+// allow asks the limiter about key, and writes a 429 if it says no
+func (a *Auth) allow(w http.ResponseWriter, key, msg string) bool {
+	ok, retryAfter := a.limiter.Allow(key)
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+		writeError(w, http.StatusTooManyRequests, msg)
+	}
+	return ok
+}
+
+func (a *Auth) startSession(w http.ResponseWriter, u User, status int) {
+	id := Identity{UserID: u.ID, Username: u.Username}
+	token, sess := a.sessions.Issue(id)
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  sess.Expires,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSON(w, status, map[string]any{"id": id.UserID, "username": id.Username})
+}
+
+func (a *Auth) logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(CookieName); err == nil {
+		a.sessions.Revoke(c.Value)
+	}
+	// and tell the browser to drop the cookie
+	http.SetCookie(w, &http.Cookie{Name: CookieName, Path: "/", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+ *
+ * guarding routes
+ *
+ */
+
+type identityKey struct{}
+
+// FromContext is who the request is from, in a handler behind Require
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Require lets through only requests with a live session, and puts their
+// Identity in the context. Anything else is a 401
+func (a *Auth) Require(next http.Handler) http.Handler {
+	return sameOrigin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(CookieName)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "log in first")
+			return
+		}
+		sess, ok := a.sessions.Lookup(c.Value)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "session expired, log in again")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, sess.Identity)))
+	}))
+}
+
+// sameOrigin refuses state-changing requests made by another site. The
+// browser attaches cookies to a request wherever it comes from, so a form
+// on evil.example posting to /todos would arrive logged in - cross-site
+// request forgery. SameSite=Lax stops most of that, but not from a sibling
+// subdomain, which counts as the same site, or from old browsers.
+//
+// Browsers say where a request came from: Sec-Fetch-Site on modern ones,
+// Origin on every cross-origin POST. A request with neither is from
+// something that isn't a browser - curl, another service - and has no
+// ambient cookies to abuse, so it's let through.
+//
+// Safe methods aren't checked: they mustn't change anything, and a GET is
+// allowed to come from anywhere
+func sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.Header.Get("Sec-Fetch-Site") {
+		case "same-origin", "none": // none: typed into the address bar
+			next.ServeHTTP(w, r)
+			return
+		case "same-site", "cross-site":
+			writeError(w, http.StatusForbidden, "cross-origin request refused")
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Host != r.Host {
+				writeError(w, http.StatusForbidden, "cross-origin request refused")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+/*
+ *
+ * responses
+ *
+ */
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func (a *Auth) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	a.log.Printf("auth: %s %s: %v", r.Method, r.URL.Path, err)
+	writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
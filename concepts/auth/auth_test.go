@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/apps/todo"
+	"github.com/thorntonmc/go-practice/concepts/ratelimit"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// fast is far too cheap for real use, and keeps the tests quick
+var fast = Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLen: 16, KeyLen: 32}
+
+func TestPasswordHash(t *testing.T) {
+	h, err := HashPassword("correct horse", fast)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(h, "$argon2id$v=19$m=64,t=1,p=1$"), h)
+
+	ok, err := VerifyPassword("correct horse", h)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = VerifyPassword("correct horsE", h)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	again, err := HashPassword("correct horse", fast)
+	require.NoError(t, err)
+	assert.NotEqual(t, h, again, "every hash has its own salt")
+
+	assert.False(t, NeedsRehash(h, fast))
+	assert.True(t, NeedsRehash(h, DefaultParams))
+
+	for _, bad := range []string{"", "correct horse", "$2a$10$abc", "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=18$m=64,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=19$m=64$c2FsdA$aGFzaA"} {
+		_, err := VerifyPassword("x", bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// app is the TODO app behind Auth, put together as cmd/todo does
+type app struct {
+	http.Handler
+	clk   *clock.Fake
+	users *MemoryUsers
+	logs  *bytes.Buffer
+}
+
+func newApp(t *testing.T) *app {
+	t.Helper()
+	a := &app{clk: clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)), users: NewMemoryUsers(), logs: &bytes.Buffer{}}
+	// three attempts, then one a minute
+	limiter := ratelimit.NewKeyed(100, func() ratelimit.Limiter { return ratelimit.NewTokenBucket(1.0/60, 3, a.clk) })
+	logger := log.New(a.logs, "", 0)
+
+	sessions := NewSessions(time.Hour, a.clk)
+	t.Cleanup(sessions.Close)
+	au, err := New(a.users, sessions, limiter, logger, WithParams(fast))
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/auth/", au.Routes())
+	mux.Handle("/", au.Require(todo.NewHandler(todo.NewMemoryRepository(), todo.NopNotifier{}, logger)))
+	a.Handler = mux
+	return a
+}
+
+// do sends a request, with session's cookie if it's set, and extra headers
+// given as name, value pairs
+func (a *app) do(method, path, body string, session *http.Cookie, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if session != nil {
+		req.AddCookie(session)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	return rec
+}
+
+func sessionCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == CookieName {
+			return c
+		}
+	}
+	t.Fatalf("no %s cookie in %v", CookieName, rec.Header())
+	return nil
+}
+
+func creds(username, password string) string {
+	return `{"username":"` + username + `","password":"` + password + `"}`
+}
+
+func TestRegisterLoginLogout(t *testing.T) {
+	a := newApp(t)
+
+	rec := a.do("POST", "/auth/register", creds(" Alice ", "correct horse"), nil)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"id":1,"username":"alice"}`, rec.Body.String())
+	registered := sessionCookie(t, rec)
+	assert.True(t, registered.HttpOnly)
+	assert.True(t, registered.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, registered.SameSite)
+	assert.Equal(t, a.clk.Now().Add(time.Hour), registered.Expires)
+
+	rec = a.do("POST", "/todos", `{"title":"buy milk"}`, registered)
+	assert.Equal(t, http.StatusCreated, rec.Code, "registering logs in")
+
+	rec = a.do("GET", "/todos", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.JSONEq(t, `{"error":"log in first"}`, rec.Body.String())
+
+	rec = a.do("POST", "/auth/login", creds("alice", "correct horse"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	session := sessionCookie(t, rec)
+	assert.NotEqual(t, registered.Value, session.Value)
+
+	rec = a.do("GET", "/todos", "", session)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "buy milk")
+
+	rec = a.do("POST", "/auth/logout", "", session)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, -1, sessionCookie(t, rec).MaxAge, "the browser is told to forget the cookie")
+
+	rec = a.do("GET", "/todos", "", session)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "a copy of the token kept after logout is useless")
+	rec = a.do("GET", "/todos", "", registered)
+	assert.Equal(t, http.StatusOK, rec.Code, "other sessions are untouched")
+
+	rec = a.do("GET", "/todos", "", &http.Cookie{Name: CookieName, Value: "made-up"})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, a.logs.String())
+}
+
+func TestRegisterInvalid(t *testing.T) {
+	a := newApp(t)
+	require.Equal(t, http.StatusCreated, a.do("POST", "/auth/register", creds("alice", "correct horse"), nil).Code)
+
+	for _, tc := range []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{creds("ALICE", "another password"), http.StatusConflict, "username is taken"},
+		{creds("al", "correct horse"), http.StatusBadRequest, "username must be 3 to 32 characters"},
+		{creds("alice smith", "correct horse"), http.StatusBadRequest, "username may only use"},
+		{creds("bob", "short"), http.StatusBadRequest, "password must be 8 to 256 characters"},
+		{creds("bob", strings.Repeat("x", 257)), http.StatusBadRequest, "password must be 8 to 256 characters"},
+		{`{"username":"bob","password":"correct horse","admin":true}`, http.StatusBadRequest, "admin"},
+	} {
+		rec := a.do("POST", "/auth/register", tc.body, nil)
+		assert.Equal(t, tc.status, rec.Code, tc.body)
+		assert.Contains(t, rec.Body.String(), tc.want, tc.body)
+	}
+}
+
+func TestWrongPassword(t *testing.T) {
+	a := newApp(t)
+	require.Equal(t, http.StatusCreated, a.do("POST", "/auth/register", creds("alice", "correct horse"), nil).Code)
+
+	wrong := a.do("POST", "/auth/login", creds("alice", "battery staple"), nil)
+	assert.Equal(t, http.StatusUnauthorized, wrong.Code)
+	assert.Empty(t, wrong.Result().Cookies())
+
+	// an unknown user gets exactly the same answer, so usernames can't be
+	// discovered by trying them
+	unknown := a.do("POST", "/auth/login", creds("mallory", "battery staple"), nil)
+	assert.Equal(t, wrong.Code, unknown.Code)
+	assert.Equal(t, wrong.Body.String(), unknown.Body.String())
+	assert.JSONEq(t, `{"error":"wrong username or password"}`, wrong.Body.String())
+}
+
+func TestExpiredSession(t *testing.T) {
+	a := newApp(t)
+	session := sessionCookie(t, a.do("POST", "/auth/register", creds("alice", "correct horse"), nil))
+
+	a.clk.Advance(59 * time.Minute)
+	assert.Equal(t, http.StatusOK, a.do("GET", "/todos", "", session).Code)
+
+	a.clk.Advance(time.Minute)
+	rec := a.do("GET", "/todos", "", session)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.JSONEq(t, `{"error":"session expired, log in again"}`, rec.Body.String())
+}
+
+func TestSessionsSweep(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	s := NewSessions(time.Hour, clk)
+	t.Cleanup(s.Close)
+	token, _ := s.Issue(Identity{UserID: 1})
+	s.Issue(Identity{UserID: 2})
+
+	clk.BlockUntil(1)
+	clk.Advance(30 * time.Minute)
+	s.Issue(Identity{UserID: 3})
+	assert.Equal(t, 3, s.Len(), "logging in doesn't sweep")
+
+	clk.Advance(30 * time.Minute)
+	assert.Eventually(t, func() bool { return s.Len() == 1 }, time.Second, time.Millisecond, "the janitor clears out expired sessions")
+	_, ok := s.Lookup(token)
+	assert.False(t, ok)
+}
+
+func TestLoginThrottle(t *testing.T) {
+	a := newApp(t)
+	require.Equal(t, http.StatusCreated, a.do("POST", "/auth/register", creds("alice", "correct horse"), nil).Code)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, a.do("POST", "/auth/login", creds("alice", "guess"), nil).Code)
+	}
+	rec := a.do("POST", "/auth/login", creds("alice", "correct horse"), nil)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "even the right password waits")
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Empty(t, rec.Result().Cookies())
+
+	// the same client trying other usernames is held up by its IP
+	rec = a.do("POST", "/auth/login", creds("bob", "guess"), nil)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// but alice isn't locked out everywhere by someone else's guesses
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(creds("alice", "correct horse")))
+	req.RemoteAddr = "203.0.113.9:4000"
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	a.clk.Advance(time.Minute)
+	rec = a.do("POST", "/auth/login", creds("alice", "correct horse"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRegisterThrottle(t *testing.T) {
+	a := newApp(t)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		require.Equal(t, http.StatusCreated, a.do("POST", "/auth/register", creds(name, "correct horse"), nil).Code)
+	}
+	rec := a.do("POST", "/auth/register", creds("dave", "correct horse"), nil)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+
+	// and it doesn't count against logging in
+	assert.Equal(t, http.StatusOK, a.do("POST", "/auth/login", creds("alice", "correct horse"), nil).Code)
+}
+
+func TestCrossOriginRefused(t *testing.T) {
+	a := newApp(t)
+	session := sessionCookie(t, a.do("POST", "/auth/register", creds("alice", "correct horse"), nil))
+
+	// httptest.NewRequest's host is example.com
+	for _, tc := range []struct {
+		name    string
+		headers []string
+		status  int
+	}{
+		{"not a browser", nil, http.StatusCreated},
+		{"same origin", []string{"Origin", "https://example.com"}, http.StatusCreated},
+		{"same origin, fetch metadata", []string{"Sec-Fetch-Site", "same-origin", "Origin", "https://example.com"}, http.StatusCreated},
+		{"another origin", []string{"Origin", "https://evil.example"}, http.StatusForbidden},
+		{"sibling subdomain", []string{"Sec-Fetch-Site", "same-site"}, http.StatusForbidden},
+		{"cross site", []string{"Sec-Fetch-Site", "cross-site"}, http.StatusForbidden},
+		{"fetch metadata wins", []string{"Sec-Fetch-Site", "cross-site", "Origin", "https://example.com"}, http.StatusForbidden},
+		{"opaque origin", []string{"Origin", "null"}, http.StatusForbidden},
+	} {
+		rec := a.do("POST", "/todos", `{"title":"`+tc.name+`"}`, session, tc.headers...)
+		assert.Equal(t, tc.status, rec.Code, tc.name)
+	}
+
+	list := a.do("GET", "/todos", "", session, "Origin", "https://evil.example", "Sec-Fetch-Site", "cross-site")
+	assert.Equal(t, http.StatusOK, list.Code, "reading is allowed from anywhere")
+	assert.NotContains(t, list.Body.String(), "another origin")
+
+	rec := a.do("POST", "/auth/login", creds("alice", "correct horse"), nil, "Origin", "https://evil.example")
+	assert.Equal(t, http.StatusForbidden, rec.Code, "no logging a victim in to the attacker's account")
+	rec = a.do("POST", "/auth/logout", "", session, "Sec-Fetch-Site", "cross-site")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, http.StatusOK, a.do("GET", "/todos", "", session).Code, "still logged in")
+}
+
+func TestRehashOnLogin(t *testing.T) {
+	a := newApp(t)
+	weak := fast
+	weak.Memory = 32
+	old, err := HashPassword("correct horse", weak)
+	require.NoError(t, err)
+	_, err = a.users.Create(context.Background(), "alice", old)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, a.do("POST", "/auth/login", creds("alice", "correct horse"), nil).Code)
+	u, err := a.users.ByUsername(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.NotEqual(t, old, u.PasswordHash)
+	assert.False(t, NeedsRehash(u.PasswordHash, fast), "upgraded to the current params")
+	assert.Equal(t, http.StatusOK, a.do("POST", "/auth/login", creds("alice", "correct horse"), nil).Code)
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// A password is never stored, only a hash of it - so a leaked user table
+// doesn't hand over everyone's password, which they've likely reused
+// elsewhere. But a fast hash like SHA-256 is the wrong tool: a GPU tries
+// billions of guesses a second against it. A password hash is slow on
+// purpose, and argon2id (winner of the Password Hashing Competition, and
+// OWASP's first choice) is also memory hard: each guess needs tens of
+// megabytes, which is what GPUs and ASICs are short of.
+//
+// Every hash gets its own random salt, so two users with the same password
+// have different hashes and a precomputed table is useless. The salt and
+// the cost settings are stored with the hash, in the PHC string format:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+//
+// so the settings can be raised later and old hashes still verify
+
+// Params are argon2id's costs. Raise them until hashing takes as long as
+// login can afford - tens of milliseconds - on the production machines
+type Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLen     uint32
+	KeyLen      uint32
+}
+
+// DefaultParams are OWASP's minimum recommendation for argon2id
+var DefaultParams = Params{Memory: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLen: 16, KeyLen: 32}
+
+// HashPassword hashes password with a fresh salt
+func HashPassword(password string, p Params) (string, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLen)
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+var errBadHash = errors.New("auth: not an argon2id hash")
+
+// VerifyPassword reports whether password matches encoded, a hash from
+// HashPassword made with any Params
+func VerifyPassword(password, encoded string) (bool, error) {
+	p, salt, key, err := decodeHash(encoded)
+	if err != nil {
+		return false, err
+	}
+	got := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLen)
+	// compare in constant time, so how long it takes doesn't say how much of
+	// the hash matched
+	return subtle.ConstantTimeCompare(got, key) == 1, nil
+}
+
+// NeedsRehash reports whether encoded was made with other Params than p.
+// After a successful login is the only time the password is at hand to
+// hash again, so that's where to check
+func NeedsRehash(encoded string, p Params) bool {
+	have, _, _, err := decodeHash(encoded)
+	return err != nil || have != p
+}
+
+func decodeHash(encoded string) (p Params, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, errBadHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errBadHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, errBadHash
+	}
+	b64 := base64.RawStdEncoding
+	if salt, err = b64.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, errBadHash
+	}
+	if key, err = b64.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return p, nil, nil, errBadHash
+	}
+	p.SaltLen, p.KeyLen = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
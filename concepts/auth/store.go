@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+/*
+ *
+ * users
+ *
+ */
+
+type User struct {
+	ID           int64
+	Username     string
+	PasswordHash string
+}
+
+var (
+	ErrUserExists = errors.New("username is taken")
+	ErrNoUser     = errors.New("no such user")
+)
+
+// UserStore is what Auth needs from wherever users are kept
+type UserStore interface {
+	Create(ctx context.Context, username, passwordHash string) (User, error)
+	ByUsername(ctx context.Context, username string) (User, error)
+	SetPasswordHash(ctx context.Context, id int64, passwordHash string) error
+}
+
+// MemoryUsers is a UserStore in a map
+type MemoryUsers struct {
+	mu     sync.Mutex
+	users  map[string]User
+	nextID int64
+}
+
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{users: map[string]User{}, nextID: 1}
+}
+
+func (m *MemoryUsers) Create(ctx context.Context, username, passwordHash string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[username]; ok {
+		return User{}, ErrUserExists
+	}
+	u := User{ID: m.nextID, Username: username, PasswordHash: passwordHash}
+	m.nextID++
+	m.users[username] = u
+	return u, nil
+}
+
+func (m *MemoryUsers) ByUsername(ctx context.Context, username string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return User{}, ErrNoUser
+	}
+	return u, nil
+}
+
+func (m *MemoryUsers) SetPasswordHash(ctx context.Context, id int64, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, u := range m.users {
+		if u.ID == id {
+			u.PasswordHash = passwordHash
+			m.users[name] = u
+			return nil
+		}
+	}
+	return ErrNoUser
+}
+
+/*
+ *
+ * sessions
+ *
+ */
+
+// Identity is who a request is from, see FromContext
+type Identity struct {
+	UserID   int64
+	Username string
+}
+
+type Session struct {
+	Identity
+	Expires time.Time
+}
+
+// Sessions are server-side: the cookie holds a random token and nothing
+// else, and the session it names lives here. The alternative is a signed
+// token carrying the session itself - a JWT - which needs no lookup, but
+// can't be revoked: logging out deletes the cookie from one browser, and
+// a copy stolen earlier works until it expires. Here logout deletes the
+// session, and every copy of the token stops working at once.
+//
+// The map is keyed by a hash of the token rather than the token, so
+// whoever can read the session store - a backup, a debug endpoint - still
+// can't log in as anyone. The token has 256 random bits, so a plain SHA-256
+// is enough; slow hashing is for things people choose
+type Sessions struct {
+	ttl time.Duration
+	clk clock.Clock
+
+	mu       sync.Mutex
+	sessions map[[sha256.Size]byte]Session
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewSessions makes sessions that last ttl from login. A janitor goroutine
+// sweeps out the expired ones every ttl, until Close
+func NewSessions(ttl time.Duration, clk clock.Clock) *Sessions {
+	s := &Sessions{ttl: ttl, clk: clk, sessions: map[[sha256.Size]byte]Session{}, stop: make(chan struct{})}
+	go s.janitor()
+	return s
+}
+
+// Close stops the janitor. It's safe to call more than once
+func (s *Sessions) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// Sessions nobody uses again - the browser was closed, the cookie cleared -
+// would otherwise stay in the map forever. Sweeping them here rather than
+// on every login keeps the O(n) walk off the login path
+func (s *Sessions) janitor() {
+	for {
+		select {
+		case <-s.clk.After(s.ttl):
+			s.deleteExpired()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *Sessions) deleteExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clk.Now()
+	for k, sess := range s.sessions {
+		if !now.Before(sess.Expires) {
+			delete(s.sessions, k)
+		}
+	}
+}
+
+// Issue starts a session for id and returns its token
+func (s *Sessions) Issue(id Identity) (token string, sess Session) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand doesn't fail on any platform Go supports
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	now := s.clk.Now()
+	sess = Session{Identity: id, Expires: now.Add(s.ttl)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sha256.Sum256([]byte(token))] = sess
+	return token, sess
+}
+
+// Lookup finds token's session, if it exists and hasn't expired
+func (s *Sessions) Lookup(token string) (Session, bool) {
+	key := sha256.Sum256([]byte(token))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[key]
+	if !ok {
+		return Session{}, false
+	}
+	if !s.clk.Now().Before(sess.Expires) {
+		delete(s.sessions, key)
+		return Session{}, false
+	}
+	return sess, true
+}
+
+// Revoke ends token's session
+func (s *Sessions) Revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sha256.Sum256([]byte(token)))
+}
+
+// Len is how many sessions are held, expired ones not yet swept included
+func (s *Sessions) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
@@ -0,0 +1,266 @@
+package bitwise
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+ *
+ * bit flags
+ *
+ */
+
+// A set of on/off options fits in one integer, a bit each. iota with a shift
+// gives each constant its own bit:
+//
+//	read  = 0b001
+//	write = 0b010
+//	exec  = 0b100
+//
+// | combines flags, & tests them, &^ (AND NOT, Go's bit clear) removes them
+// and ^ toggles
+type perm uint8
+
+const (
+	permRead perm = 1 << iota
+	permWrite
+	permExec
+)
+
+func (p perm) Has(f perm) bool    { return p&f == f }
+func (p perm) Set(f perm) perm    { return p | f }
+func (p perm) Clear(f perm) perm  { return p &^ f }
+func (p perm) Toggle(f perm) perm { return p ^ f }
+
+// String prints like ls -l does
+func (p perm) String() string {
+	var b strings.Builder
+	for _, f := range []struct {
+		flag perm
+		c    byte
+	}{{permRead, 'r'}, {permWrite, 'w'}, {permExec, 'x'}} {
+		if p.Has(f.flag) {
+			b.WriteByte(f.c)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+/*
+ *
+ * byte order
+ *
+ */
+
+// A multi-byte number can be stored biggest byte first (big endian, "network
+// byte order", used by most file formats and protocols) or smallest first
+// (little endian, what x86 and ARM use in memory). 0x01020304 is
+//
+//	big endian:    01 02 03 04
+//	little endian: 04 03 02 01
+//
+// Reading with the wrong one doesn't fail, it just gives a different number,
+// which is why a format has to pick one and say so. binary.NativeEndian is
+// whatever this machine uses - only for data that never leaves it
+
+func bothOrders(v uint32) (big, little []byte) {
+	big = binary.BigEndian.AppendUint32(nil, v)
+	little = binary.LittleEndian.AppendUint32(nil, v)
+	return big, little
+}
+
+/*
+ *
+ * fixed size records
+ *
+ */
+
+// binary.Read and binary.Write handle structs made only of fixed-size fields
+// - no strings, slices or ints (whose size depends on the platform). The
+// layout is the fields back to back with no padding, unlike the same struct
+// in memory. Blank fields (_) are skipped over, handy for reserved bytes
+type reading struct {
+	SensorID  uint32
+	Perm      perm
+	_         [3]byte // reserved, keeps Timestamp on an 8 byte boundary in the file
+	Timestamp int64   // unix nanoseconds
+	Celsius   int16   // tenths of a degree
+}
+
+// readingSize is what binary.Size(reading{}) reports: 4+1+3+8+2
+const readingSize = 18
+
+func encodeReadings(rs []reading) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, rs); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeReadings(b []byte) ([]reading, error) {
+	if len(b)%readingSize != 0 {
+		return nil, fmt.Errorf("%d bytes isn't a whole number of readings", len(b))
+	}
+	rs := make([]reading, len(b)/readingSize)
+	return rs, binary.Read(bytes.NewReader(b), binary.BigEndian, rs)
+}
+
+/*
+ *
+ * varints
+ *
+ */
+
+// A varint stores 7 bits per byte, using the top bit to say "more follows",
+// so small numbers take fewer bytes: 1 byte up to 127, 2 up to 16383, and up
+// to 10 bytes for a full uint64. Protocol buffers use the same encoding.
+//
+// Negative numbers are huge as unsigned, so signed varints zigzag-encode
+// first: 0, -1, 1, -2, 2 become 0, 1, 2, 3, 4, keeping small magnitudes small
+
+func appendVarints(b []byte, vs ...int64) []byte {
+	for _, v := range vs {
+		b = binary.AppendVarint(b, v)
+	}
+	return b
+}
+
+func readVarints(b []byte) ([]int64, error) {
+	var out []int64
+	for len(b) > 0 {
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			return out, errors.New("bitwise: malformed varint")
+		}
+		out = append(out, v)
+		b = b[n:]
+	}
+	return out, nil
+}
+
+/*
+ *
+ * a binary header
+ *
+ */
+
+// header is the start of a made-up file format, big endian throughout:
+//
+//	offset  size  field
+//	0       4     magic "GOPH"
+//	4       1     version
+//	5       1     flags
+//	6       2     record count
+//	8       4     payload length
+//	12      n     name, uvarint length then bytes
+type header struct {
+	Version    uint8
+	Flags      headerFlag
+	Records    uint16
+	PayloadLen uint32
+	Name       string
+}
+
+type headerFlag uint8
+
+const (
+	flagCompressed headerFlag = 1 << iota
+	flagEncrypted
+)
+
+var (
+	magic = [4]byte{'G', 'O', 'P', 'H'}
+
+	errBadMagic           = errors.New("bitwise: not a GOPH file")
+	errUnsupportedVersion = errors.New("bitwise: unsupported version")
+	errUnknownFlags       = errors.New("bitwise: unknown flags set")
+	errNameTooLong        = errors.New("bitwise: name too long")
+)
+
+const (
+	currentVersion = 1
+	maxNameLen     = 255
+	knownFlags     = flagCompressed | flagEncrypted
+)
+
+func (h header) MarshalBinary() ([]byte, error) {
+	if len(h.Name) > maxNameLen {
+		return nil, errNameTooLong
+	}
+	b := make([]byte, 0, 12+1+len(h.Name))
+	b = append(b, magic[:]...)
+	b = append(b, h.Version, byte(h.Flags))
+	b = binary.BigEndian.AppendUint16(b, h.Records)
+	b = binary.BigEndian.AppendUint32(b, h.PayloadLen)
+	b = binary.AppendUvarint(b, uint64(len(h.Name)))
+	return append(b, h.Name...), nil
+}
+
+// byteReader adapts an io.Reader for binary.ReadUvarint, which wants an
+// io.ByteReader
+type byteReader struct{ io.Reader }
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r, b[:])
+	return b[0], err
+}
+
+// parseHeader reads a header from r, consuming exactly its bytes so the
+// payload can be read next. Everything read from the outside world is
+// checked before it's trusted - especially lengths, or a four byte field can
+// claim a four gigabyte name
+func parseHeader(r io.Reader) (header, error) {
+	var fixed [12]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return header{}, err
+	}
+	if !bytes.Equal(fixed[:4], magic[:]) {
+		return header{}, errBadMagic
+	}
+
+	h := header{
+		Version:    fixed[4],
+		Flags:      headerFlag(fixed[5]),
+		Records:    binary.BigEndian.Uint16(fixed[6:8]),
+		PayloadLen: binary.BigEndian.Uint32(fixed[8:12]),
+	}
+	if h.Version != currentVersion {
+		return header{}, fmt.Errorf("%w %d", errUnsupportedVersion, h.Version)
+	}
+	if h.Flags&^knownFlags != 0 {
+		return header{}, fmt.Errorf("%w: %08b", errUnknownFlags, h.Flags&^knownFlags)
+	}
+
+	n, err := binary.ReadUvarint(byteReader{r})
+	if err != nil {
+		return header{}, noEOF(err)
+	}
+	if n > maxNameLen {
+		return header{}, errNameTooLong
+	}
+	name := make([]byte, n)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return header{}, noEOF(err)
+	}
+	h.Name = string(name)
+
+	return h, nil
+}
+
+// noEOF turns a clean EOF partway through the header into ErrUnexpectedEOF -
+// only running out of input before the header starts is a plain EOF
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package bitwise
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerm(t *testing.T) {
+	p := permRead | permWrite
+	assert.Equal(t, "rw-", p.String())
+	assert.True(t, p.Has(permRead))
+	assert.False(t, p.Has(permRead|permExec), "Has wants every bit")
+
+	assert.Equal(t, "r--", p.Clear(permWrite).String())
+	assert.Equal(t, "rwx", p.Set(permExec).String())
+	assert.Equal(t, "r--", p.Toggle(permWrite).String())
+	assert.Equal(t, perm(7), permRead|permWrite|permExec)
+}
+
+func TestByteOrder(t *testing.T) {
+	big, little := bothOrders(0x01020304)
+	assert.Equal(t, []byte{1, 2, 3, 4}, big)
+	assert.Equal(t, []byte{4, 3, 2, 1}, little)
+
+	// read with the wrong order and you get a perfectly valid wrong answer
+	assert.Equal(t, uint32(0x04030201), binary.LittleEndian.Uint32(big))
+}
+
+func TestReadingsRoundTrip(t *testing.T) {
+	assert.Equal(t, readingSize, binary.Size(reading{}))
+
+	in := []reading{
+		{SensorID: 1, Perm: permRead, Timestamp: 1700000000000000000, Celsius: 215},
+		{SensorID: math.MaxUint32, Perm: permRead | permWrite, Timestamp: -1, Celsius: -400},
+	}
+	b, err := encodeReadings(in)
+	require.NoError(t, err)
+	assert.Len(t, b, 2*readingSize)
+	assert.Equal(t, []byte{0, 0, 0, 1, 1, 0, 0, 0}, b[:8], "big endian id, perm, reserved")
+
+	out, err := decodeReadings(b)
+	require.NoError(t, err)
+	assert.Equal(t, in, out)
+
+	_, err = decodeReadings(b[:20])
+	assert.Error(t, err)
+}
+
+func TestVarints(t *testing.T) {
+	in := []int64{0, -1, 1, 63, -64, 64, 300, math.MaxInt64, math.MinInt64}
+	b := appendVarints(nil, in...)
+
+	out, err := readVarints(b)
+	require.NoError(t, err)
+	assert.Equal(t, in, out)
+
+	assert.Len(t, appendVarints(nil, -64), 1, "zigzag keeps small negatives small")
+	assert.Len(t, appendVarints(nil, 64), 2)
+	assert.Len(t, appendVarints(nil, math.MaxInt64), 10)
+
+	_, err = readVarints([]byte{0x80, 0x80})
+	assert.Error(t, err)
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	h := header{Version: 1, Flags: flagCompressed, Records: 42, PayloadLen: 1 << 20, Name: "readings.goph"}
+	b, err := h.MarshalBinary()
+	require.NoError(t, err)
+
+	r := bytes.NewReader(append(b, "payload"...))
+	got, err := parseHeader(r)
+	require.NoError(t, err)
+	assert.Equal(t, h, got)
+
+	rest, _ := io.ReadAll(r)
+	assert.Equal(t, "payload", string(rest), "exactly the header is consumed")
+}
+
+func TestHeaderErrors(t *testing.T) {
+	valid, err := header{Version: 1, Name: "x"}.MarshalBinary()
+	require.NoError(t, err)
+
+	corrupt := func(i int, v byte) []byte {
+		b := append([]byte(nil), valid...)
+		b[i] = v
+		return b
+	}
+
+	for name, tc := range map[string]struct {
+		input []byte
+		err   error
+	}{
+		"empty":           {nil, io.EOF},
+		"short fixed":     {valid[:7], io.ErrUnexpectedEOF},
+		"missing name":    {valid[:12], io.ErrUnexpectedEOF},
+		"short name":      {valid[:13], io.ErrUnexpectedEOF},
+		"bad magic":       {corrupt(0, 'X'), errBadMagic},
+		"future version":  {corrupt(4, 2), errUnsupportedVersion},
+		"unknown flag":    {corrupt(5, 0x80), errUnknownFlags},
+		"name overruns":   {corrupt(12, 5), io.ErrUnexpectedEOF},
+		"huge name claim": {corrupt(12, 0xff), errNameTooLong},
+	} {
+		_, err := parseHeader(bytes.NewReader(tc.input))
+		assert.ErrorIs(t, err, tc.err, name)
+	}
+
+	_, err = header{Version: 1, Name: strings.Repeat("x", 256)}.MarshalBinary()
+	assert.ErrorIs(t, err, errNameTooLong)
+}
+
+// go test -fuzz FuzzParseHeader ./concepts/bitwise
+//
+// Whatever the bytes, parseHeader must not panic or allocate absurdly, and
+// anything it accepts must survive a round trip
+func FuzzParseHeader(f *testing.F) {
+	for _, h := range []header{
+		{Version: 1},
+		{Version: 1, Flags: flagEncrypted, Records: 7, PayloadLen: 99, Name: "seed"},
+	} {
+		b, _ := h.MarshalBinary()
+		f.Add(b)
+	}
+	f.Add([]byte("GOPH"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h, err := parseHeader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		b, err := h.MarshalBinary()
+		require.NoError(t, err)
+
+		again, err := parseHeader(bytes.NewReader(b))
+		require.NoError(t, err)
+		assert.Equal(t, h, again)
+	})
+}
+
+func FuzzVarints(f *testing.F) {
+	f.Add(int64(0), int64(-1))
+	f.Add(int64(math.MaxInt64), int64(math.MinInt64))
+
+	f.Fuzz(func(t *testing.T, a, b int64) {
+		out, err := readVarints(appendVarints(nil, a, b))
+		require.NoError(t, err)
+		assert.Equal(t, []int64{a, b}, out)
+	})
+}
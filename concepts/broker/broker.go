@@ -0,0 +1,191 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+)
+
+// A message broker like Kafka sits between services: producers append
+// messages to a topic, consumers read them later, at their own pace, and
+// neither needs the other to be up. Kafka's model is worth learning even
+// without Kafka:
+//
+//   - a topic is split into partitions, each an append-only log. A message
+//     is at an offset in one partition, and stays there whether or not
+//     anyone has read it
+//   - the key picks the partition, so messages with the same key (the same
+//     order id, say) are kept in order. Across partitions there's no order
+//   - a consumer group shares a topic's partitions between its members, so
+//     each message is handled once per group. More partitions, more
+//     members can work in parallel
+//   - consumers commit the offset they've got up to. After a crash or a
+//     restart the group carries on from the last commit
+//
+// Commit after handling and a crash in between means the message is handled
+// again: at-least-once delivery, so handlers have to cope with duplicates.
+// Commit before handling and a crash loses it instead - at-most-once. The
+// first is nearly always what's wanted.
+//
+// Broker is the handful of operations that model needs. Memory implements
+// it in-process, which is what the tests use; a Kafka client would sit
+// behind the same interface in production. Consume, in consumer.go, is the
+// consumer group loop on top
+
+var ErrUnknownPartition = errors.New("broker: unknown partition")
+
+// Message is one record in a partition's log
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+type Broker interface {
+	// Produce appends a message to topic, in the partition its key hashes
+	// to. A nil key spreads messages round robin
+	Produce(ctx context.Context, topic string, key, value []byte) (Message, error)
+
+	// Partitions is how many partitions topic has
+	Partitions(ctx context.Context, topic string) (int, error)
+
+	// Fetch returns the message at offset, waiting for it to be produced
+	// if it hasn't been yet
+	Fetch(ctx context.Context, topic string, partition int, offset int64) (Message, error)
+
+	// Commit records that group has handled everything in m's partition up
+	// to and including m. Committed returns the offset to carry on from,
+	// 0 if the group has never committed
+	Commit(ctx context.Context, group string, m Message) error
+	Committed(ctx context.Context, group, topic string, partition int) (int64, error)
+}
+
+/*
+ *
+ * in memory
+ *
+ */
+
+// Memory is a Broker in a map. Topics are created on first use, all with
+// the same number of partitions
+type Memory struct {
+	mu         sync.Mutex
+	partitions int
+	topics     map[string][]*partition
+	committed  map[groupPartition]int64
+	next       uint64 // round robin for messages without a key
+}
+
+type partition struct {
+	log []Message
+	// grown is closed, and replaced, when a message is appended - Fetch
+	// waits on it
+	grown chan struct{}
+}
+
+type groupPartition struct {
+	group, topic string
+	partition    int
+}
+
+func NewMemory(partitions int) *Memory {
+	if partitions < 1 {
+		partitions = 1
+	}
+	return &Memory{
+		partitions: partitions,
+		topics:     map[string][]*partition{},
+		committed:  map[groupPartition]int64{},
+	}
+}
+
+// topic returns topic's partitions, creating them if needed. m.mu must be held
+func (m *Memory) topic(name string) []*partition {
+	ps, ok := m.topics[name]
+	if !ok {
+		ps = make([]*partition, m.partitions)
+		for i := range ps {
+			ps[i] = &partition{grown: make(chan struct{})}
+		}
+		m.topics[name] = ps
+	}
+	return ps
+}
+
+func (m *Memory) Produce(ctx context.Context, topic string, key, value []byte) (Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ps := m.topic(topic)
+	var i int
+	if key == nil {
+		i = int(m.next % uint64(len(ps)))
+		m.next++
+	} else {
+		h := fnv.New32a()
+		h.Write(key)
+		i = int(h.Sum32() % uint32(len(ps)))
+	}
+
+	p := ps[i]
+	msg := Message{Topic: topic, Partition: i, Offset: int64(len(p.log)), Key: key, Value: value}
+	p.log = append(p.log, msg)
+	close(p.grown)
+	p.grown = make(chan struct{})
+	return msg, nil
+}
+
+func (m *Memory) Partitions(ctx context.Context, topic string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.topic(topic)), nil
+}
+
+func (m *Memory) Fetch(ctx context.Context, topic string, partition int, offset int64) (Message, error) {
+	for {
+		m.mu.Lock()
+		ps := m.topic(topic)
+		if partition < 0 || partition >= len(ps) {
+			m.mu.Unlock()
+			return Message{}, ErrUnknownPartition
+		}
+		p := ps[partition]
+		if offset < int64(len(p.log)) {
+			msg := p.log[offset]
+			m.mu.Unlock()
+			return msg, nil
+		}
+		grown := p.grown
+		m.mu.Unlock()
+
+		select {
+		case <-grown:
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		}
+	}
+}
+
+func (m *Memory) Commit(ctx context.Context, group string, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := groupPartition{group, msg.Topic, msg.Partition}
+	// commits only move forward, a late commit from a slow worker can't
+	// rewind the group
+	if next := msg.Offset + 1; next > m.committed[key] {
+		m.committed[key] = next
+	}
+	return nil
+}
+
+func (m *Memory) Committed(ctx context.Context, group, topic string, partition int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.committed[groupPartition{group, topic, partition}], nil
+}
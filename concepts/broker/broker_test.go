@@ -0,0 +1,96 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryPartitioning(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemory(4)
+
+	first, err := b.Produce(ctx, "orders", []byte("order-1"), []byte("created"))
+	require.NoError(t, err)
+	second, err := b.Produce(ctx, "orders", []byte("order-1"), []byte("paid"))
+	require.NoError(t, err)
+
+	// same key, same partition, next offset
+	assert.Equal(t, first.Partition, second.Partition)
+	assert.Equal(t, first.Offset+1, second.Offset)
+
+	// no key, round robin
+	seen := map[int]bool{}
+	for i := 0; i < 4; i++ {
+		m, err := b.Produce(ctx, "logs", nil, []byte("x"))
+		require.NoError(t, err)
+		seen[m.Partition] = true
+	}
+	assert.Len(t, seen, 4)
+
+	n, err := b.Partitions(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+}
+
+func TestMemoryFetch(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemory(1)
+
+	_, err := b.Fetch(ctx, "t", 3, 0)
+	assert.ErrorIs(t, err, ErrUnknownPartition)
+
+	// waits for a message that hasn't been produced yet
+	got := make(chan Message)
+	go func() {
+		m, err := b.Fetch(ctx, "t", 0, 1)
+		assert.NoError(t, err)
+		got <- m
+	}()
+
+	b.Produce(ctx, "t", nil, []byte("zero"))
+	b.Produce(ctx, "t", nil, []byte("one"))
+	select {
+	case m := <-got:
+		assert.Equal(t, "one", string(m.Value))
+	case <-time.After(time.Second):
+		t.Fatal("Fetch never returned")
+	}
+
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = b.Fetch(short, "t", 0, 5)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMemoryCommit(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemory(1)
+	m, _ := b.Produce(ctx, "t", nil, nil)
+	b.Produce(ctx, "t", nil, nil)
+
+	off, _ := b.Committed(ctx, "g", "t", 0)
+	assert.Equal(t, int64(0), off)
+
+	require.NoError(t, b.Commit(ctx, "g", Message{Topic: "t", Offset: 1}))
+	require.NoError(t, b.Commit(ctx, "g", m), "late commit of an earlier offset")
+	off, _ = b.Committed(ctx, "g", "t", 0)
+	assert.Equal(t, int64(2), off, "commits don't go backwards")
+
+	off, _ = b.Committed(ctx, "other", "t", 0)
+	assert.Equal(t, int64(0), off, "groups are independent")
+}
+
+// produce is the producer loop: n messages spread over keys
+func produce(t *testing.T, b Broker, topic string, from, n, keys int) {
+	t.Helper()
+	for i := from; i < from+n; i++ {
+		key := fmt.Sprintf("key-%d", i%keys)
+		_, err := b.Produce(context.Background(), topic, []byte(key), []byte(fmt.Sprint(i)))
+		require.NoError(t, err)
+	}
+}
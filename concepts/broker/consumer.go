@@ -0,0 +1,169 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Handler processes one message. Returning an error means "not done": the
+// message is tried again, and after MaxAttempts sent to the dead letter
+// topic
+type Handler func(ctx context.Context, m Message) error
+
+// ErrGaveUp is returned by Consume when a message keeps failing and there's
+// no dead letter topic to put it in
+var ErrGaveUp = errors.New("broker: message failed every attempt")
+
+// GroupOptions configures a member of a consumer group
+type GroupOptions struct {
+	// Member and Members split the topic's partitions: this member takes
+	// the partitions p where p % Members == Member. Kafka hands partitions
+	// out dynamically and rebalances as members come and go, this static
+	// split keeps the idea without the protocol. The zero value is a group
+	// of one, with every partition
+	Member, Members int
+
+	// MaxAttempts is how often a message is tried before giving up on it,
+	// 3 by default, with Backoff (100ms by default) doubling in between
+	MaxAttempts int
+	Backoff     time.Duration
+
+	// DeadLetter is the topic for messages that failed every attempt. It
+	// lets the partition move on, and someone can look at them later.
+	// Without one, Consume stops with ErrGaveUp rather than skip a message
+	DeadLetter string
+}
+
+// Validate checks Member is one of the Members. Get it wrong and this
+// member would take no partitions and sit there quietly doing nothing -
+// or, with negative numbers, take partitions another member also has
+func (o GroupOptions) Validate() error {
+	members := max(o.Members, 1)
+	if o.Members < 0 || o.Member < 0 || o.Member >= members {
+		return fmt.Errorf("broker: member %d of %d, want 0 to %d", o.Member, o.Members, members-1)
+	}
+	return nil
+}
+
+func (o GroupOptions) withDefaults() GroupOptions {
+	if o.Members < 1 {
+		o.Members = 1
+	}
+	if o.MaxAttempts < 1 {
+		o.MaxAttempts = 3
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 100 * time.Millisecond
+	}
+	return o
+}
+
+// Consume runs a consumer group member: one worker per assigned partition,
+// each fetching from the group's committed offset, handling messages in
+// order and committing after each. It runs until ctx is cancelled, when it
+// returns nil, or until a worker fails. Options that don't Validate are an
+// error straight away.
+//
+// Shutdown is graceful: cancelling ctx stops workers fetching, but a
+// message already being handled is finished and committed first - the
+// handler's context isn't cancelled by shutdown. Bound how long that can
+// take in the handler itself
+func Consume(ctx context.Context, b Broker, group, topic string, h Handler, opts GroupOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	opts = opts.withDefaults()
+
+	n, err := b.Partitions(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	for p := 0; p < n; p++ {
+		if p%opts.Members != opts.Member {
+			continue
+		}
+		w := &worker{b: b, group: group, topic: topic, partition: p, handle: h, opts: opts}
+		g.Go(func() error { return w.run(gctx) })
+	}
+
+	err = g.Wait()
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil // shut down as asked
+	}
+	return err
+}
+
+// worker consumes one partition
+type worker struct {
+	b         Broker
+	group     string
+	topic     string
+	partition int
+	handle    Handler
+	opts      GroupOptions
+}
+
+func (w *worker) run(ctx context.Context) error {
+	offset, err := w.b.Committed(ctx, w.group, w.topic, w.partition)
+	if err != nil {
+		return err
+	}
+
+	for {
+		// Fetch returns a message that's already there even after
+		// cancellation, so check for shutdown first
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		msg, err := w.b.Fetch(ctx, w.topic, w.partition, offset)
+		if err != nil {
+			return err
+		}
+
+		// from here on the message is seen through, shutdown or not
+		if err := w.process(context.WithoutCancel(ctx), ctx, msg); err != nil {
+			return err
+		}
+		if err := w.b.Commit(context.WithoutCancel(ctx), w.group, msg); err != nil {
+			return fmt.Errorf("committing %s/%d@%d: %w", msg.Topic, msg.Partition, msg.Offset, err)
+		}
+		offset = msg.Offset + 1
+	}
+}
+
+// process handles msg with retries. Backoff waits are cut short by
+// shutdown, in which case the message isn't committed and whoever has the
+// partition next starts with it
+func (w *worker) process(ctx, shutdown context.Context, msg Message) error {
+	backoff := w.opts.Backoff
+	var err error
+	for attempt := 1; attempt <= w.opts.MaxAttempts; attempt++ {
+		if err = w.handle(ctx, msg); err == nil {
+			return nil
+		}
+		if attempt == w.opts.MaxAttempts {
+			break
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-shutdown.Done():
+			t.Stop()
+			return shutdown.Err()
+		}
+		backoff *= 2
+	}
+
+	if w.opts.DeadLetter == "" {
+		return fmt.Errorf("%w: %s/%d@%d: %v", ErrGaveUp, msg.Topic, msg.Partition, msg.Offset, err)
+	}
+	_, dlErr := w.b.Produce(ctx, w.opts.DeadLetter, msg.Key, msg.Value)
+	return dlErr
+}
@@ -0,0 +1,254 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector is a handler that remembers every message by key, in the order
+// handled, and cancels the consumer once it has seen want of them
+type collector struct {
+	mu     sync.Mutex
+	byKey  map[string][]int
+	count  int
+	want   int
+	cancel context.CancelFunc
+}
+
+func newCollector(want int, cancel context.CancelFunc) *collector {
+	return &collector{byKey: map[string][]int{}, want: want, cancel: cancel}
+}
+
+func (c *collector) handle(ctx context.Context, m Message) error {
+	n, _ := strconv.Atoi(string(m.Value))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byKey[string(m.Key)] = append(c.byKey[string(m.Key)], n)
+	c.count++
+	if c.count == c.want {
+		c.cancel()
+	}
+	return nil
+}
+
+func consumeInBackground(ctx context.Context, b Broker, group string, h Handler, opts GroupOptions) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- Consume(ctx, b, group, "events", h, opts) }()
+	return done
+}
+
+func wait(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Consume didn't return")
+		return nil
+	}
+}
+
+func TestConsume(t *testing.T) {
+	b := NewMemory(4)
+	produce(t, b, "events", 0, 100, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newCollector(100, cancel)
+	require.NoError(t, wait(t, consumeInBackground(ctx, b, "g", c.handle, GroupOptions{})))
+
+	// everything arrived, and each key in the order produced
+	assert.Len(t, c.byKey, 10)
+	for key, got := range c.byKey {
+		assert.IsIncreasing(t, got, key)
+		assert.Len(t, got, 10)
+	}
+}
+
+func TestConsumeResumesFromCommit(t *testing.T) {
+	b := NewMemory(2)
+	produce(t, b, "events", 0, 10, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := newCollector(10, cancel)
+	require.NoError(t, wait(t, consumeInBackground(ctx, b, "g", first.handle, GroupOptions{})))
+
+	// a restart only sees what's new
+	produce(t, b, "events", 10, 5, 3)
+	ctx, cancel = context.WithCancel(context.Background())
+	second := newCollector(5, cancel)
+	require.NoError(t, wait(t, consumeInBackground(ctx, b, "g", second.handle, GroupOptions{})))
+	assert.Equal(t, 5, second.count)
+	for _, got := range second.byKey {
+		for _, n := range got {
+			assert.GreaterOrEqual(t, n, 10)
+		}
+	}
+}
+
+// flakyCommits fails the first commit, as if the process died between
+// handling a message and committing it
+type flakyCommits struct {
+	Broker
+	failed atomic.Bool
+}
+
+var errCommit = errors.New("connection lost")
+
+func (f *flakyCommits) Commit(ctx context.Context, group string, m Message) error {
+	if f.failed.CompareAndSwap(false, true) {
+		return errCommit
+	}
+	return f.Broker.Commit(ctx, group, m)
+}
+
+func TestAtLeastOnce(t *testing.T) {
+	mem := NewMemory(1)
+	produce(t, mem, "events", 0, 3, 1)
+	b := &flakyCommits{Broker: mem}
+
+	var handled []string
+	h := func(ctx context.Context, m Message) error {
+		handled = append(handled, string(m.Value))
+		return nil
+	}
+
+	err := wait(t, consumeInBackground(context.Background(), b, "g", h, GroupOptions{}))
+	assert.ErrorIs(t, err, errCommit)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h2 := func(ctx context.Context, m Message) error {
+		h(ctx, m)
+		if len(handled) == 4 {
+			cancel()
+		}
+		return nil
+	}
+	require.NoError(t, wait(t, consumeInBackground(ctx, b, "g", h2, GroupOptions{})))
+
+	// message 0 was handled, not committed, so it came round again
+	assert.Equal(t, []string{"0", "0", "1", "2"}, handled)
+}
+
+func TestRetriesAndDeadLetter(t *testing.T) {
+	b := NewMemory(1)
+	produce(t, b, "events", 0, 3, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts atomic.Int32
+	var handled []string
+	h := func(ctx context.Context, m Message) error {
+		if string(m.Value) == "1" {
+			attempts.Add(1)
+			return errors.New("poison")
+		}
+		handled = append(handled, string(m.Value))
+		if len(handled) == 2 {
+			cancel()
+		}
+		return nil
+	}
+
+	opts := GroupOptions{MaxAttempts: 3, Backoff: time.Millisecond, DeadLetter: "events.dlq"}
+	require.NoError(t, wait(t, consumeInBackground(ctx, b, "g", h, opts)))
+
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Equal(t, []string{"0", "2"}, handled, "the partition moved on")
+
+	dead, err := b.Fetch(context.Background(), "events.dlq", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(dead.Value))
+}
+
+func TestGiveUpWithoutDeadLetter(t *testing.T) {
+	b := NewMemory(1)
+	produce(t, b, "events", 0, 1, 1)
+
+	h := func(context.Context, Message) error { return errors.New("poison") }
+	err := wait(t, consumeInBackground(context.Background(), b, "g", h, GroupOptions{Backoff: time.Millisecond}))
+	assert.ErrorIs(t, err, ErrGaveUp)
+
+	off, _ := b.Committed(context.Background(), "g", "events", 0)
+	assert.Equal(t, int64(0), off, "not skipped")
+}
+
+func TestMembersSplitPartitions(t *testing.T) {
+	b := NewMemory(4)
+	produce(t, b, "events", 0, 40, 8)
+
+	var mu sync.Mutex
+	partitions := map[int]map[int]bool{0: {}, 1: {}}
+	var total atomic.Int32
+
+	ctx, cancel := context.WithCancel(context.Background())
+	member := func(i int) <-chan error {
+		h := func(ctx context.Context, m Message) error {
+			mu.Lock()
+			partitions[i][m.Partition] = true
+			mu.Unlock()
+			if total.Add(1) == 40 {
+				cancel()
+			}
+			return nil
+		}
+		return consumeInBackground(ctx, b, "g", h, GroupOptions{Member: i, Members: 2})
+	}
+	done0, done1 := member(0), member(1)
+	require.NoError(t, wait(t, done0))
+	require.NoError(t, wait(t, done1))
+
+	assert.Equal(t, map[int]bool{0: true, 2: true}, partitions[0])
+	assert.Equal(t, map[int]bool{1: true, 3: true}, partitions[1])
+}
+
+func TestBadMember(t *testing.T) {
+	b := NewMemory(4)
+	nop := func(context.Context, Message) error { return nil }
+	for _, opts := range []GroupOptions{
+		{Member: 2, Members: 2},
+		{Member: 3, Members: 2},
+		{Member: -1, Members: 2},
+		{Member: 1},
+		{Member: 0, Members: -2},
+	} {
+		err := Consume(context.Background(), b, "g", "events", nop, opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+
+	for _, opts := range []GroupOptions{{}, {Member: 1, Members: 2}} {
+		assert.NoError(t, opts.Validate(), "%+v", opts)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	b := NewMemory(1)
+	produce(t, b, "events", 0, 2, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	var finished atomic.Bool
+	h := func(hctx context.Context, m Message) error {
+		close(started)
+		cancel() // shutdown arrives mid-message
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, hctx.Err(), "the handler's context isn't cancelled")
+		finished.Store(true)
+		return nil
+	}
+
+	done := consumeInBackground(ctx, b, "g", h, GroupOptions{})
+	<-started
+	require.NoError(t, wait(t, done))
+
+	assert.True(t, finished.Load())
+	off, _ := b.Committed(context.Background(), "g", "events", 0)
+	assert.Equal(t, int64(1), off, "the in-flight message was committed, the next one never started")
+}
@@ -0,0 +1,58 @@
+package buildtags
+
+import "fmt"
+
+// A //go:build line at the top of a file decides whether the file is part of
+// the build at all. It has to come before the package clause, followed by a
+// blank line, and takes a boolean expression over tags:
+//
+//   - GOOS and GOARCH values (linux, windows, arm64, ...) plus "unix", which
+//     matches every unix-like GOOS
+//   - go1.N, true when building with Go 1.N or later
+//   - anything passed with -tags, e.g. go test -tags integration
+//
+// Files named *_linux.go, *_windows_amd64.go and so on get an implicit
+// constraint from the name, no build line needed. The files in this package:
+//
+//	signals_unix.go     //go:build unix
+//	signals_windows.go  //go:build windows
+//	signals_other.go    //go:build !unix && !windows
+//	integration_test.go //go:build integration && unix
+//
+// Every pair has to cover all cases between them, or some platform or tag
+// combination won't compile. go vet ./... only checks the files the current
+// build includes, so GOOS=windows go vet ./... is worth running now and then
+
+/*
+ *
+ * platform-specific code
+ *
+ */
+
+// shutdownSignals (per platform) lists the signals a server should treat as
+// "please stop". platform names which implementation was compiled in
+
+// describePlatform uses whichever implementation was built
+func describePlatform() string {
+	return fmt.Sprintf("%s: stopping on %v", platform, shutdownSignals())
+}
+
+/*
+ *
+ * feature flags
+ *
+ */
+
+// A tag can also switch a feature on at build time: a const set in a pair of
+// files, one //go:build slow and one //go:build !slow, so with the tag off
+// the compiler sees "if false" and drops the code entirely - no runtime flag
+// to check:
+//
+//	// slow.go                        // fast.go
+//	//go:build slow                   //go:build !slow
+//	const slowExamples = true         const slowExamples = false
+//
+// It's only worth doing when something builds with the tag - a CI job, a
+// Makefile target - or the tagged side rots unnoticed, since go vet and go
+// test never compile it. integration_test.go is the one tag this package
+// really uses
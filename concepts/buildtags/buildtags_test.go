@@ -0,0 +1,25 @@
+package buildtags
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownSignals(t *testing.T) {
+	signals := shutdownSignals()
+	assert.Contains(t, signals, os.Interrupt)
+
+	switch runtime.GOOS {
+	case "windows":
+		assert.Equal(t, "windows", platform)
+		assert.Len(t, signals, 2)
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd":
+		assert.Equal(t, "unix", platform)
+		assert.Len(t, signals, 2)
+	}
+
+	assert.Contains(t, describePlatform(), platform)
+}
@@ -0,0 +1,32 @@
+//go:build integration && unix
+
+package buildtags
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Integration tests touch the real world - here, the process's own signal
+// handling - so they're kept out of a plain go test run:
+//
+//	go test -tags integration ./concepts/buildtags
+func TestShutdownSignalsDelivered(t *testing.T) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, shutdownSignals()...)
+	defer signal.Stop(ch)
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	select {
+	case sig := <-ch:
+		require.Equal(t, syscall.SIGTERM, sig)
+	case <-time.After(2 * time.Second):
+		t.Fatal("SIGTERM never arrived")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package buildtags
+
+import "os"
+
+const platform = "other"
+
+// plan9, js/wasm and wasip1 - os.Interrupt is the only portable signal
+func shutdownSignals() []os.Signal {
+	return []os.Signal{os.Interrupt}
+}
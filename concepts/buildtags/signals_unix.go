@@ -0,0 +1,18 @@
+//go:build unix
+
+package buildtags
+
+import (
+	"os"
+	"syscall"
+)
+
+const platform = "unix"
+
+// SIGTERM is what kill, systemd and Kubernetes send by default, SIGINT
+// (os.Interrupt) is ctrl-c. Both are real signals here, sent by other
+// processes - on windows syscall.SIGTERM compiles, but it only ever comes
+// from Go itself, see signals_windows.go
+func shutdownSignals() []os.Signal {
+	return []os.Signal{os.Interrupt, syscall.SIGTERM}
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package buildtags
+
+import (
+	"os"
+	"syscall"
+)
+
+const platform = "windows"
+
+// windows has no real signals. Go maps ctrl-c and ctrl-break to os.Interrupt,
+// and since Go 1.14 the console window closing, logoff and shutdown to
+// syscall.SIGTERM - which is asking to stop, so it's on the list too
+func shutdownSignals() []os.Signal {
+	return []os.Signal{os.Interrupt, syscall.SIGTERM}
+}
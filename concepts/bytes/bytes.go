@@ -0,0 +1,201 @@
+package bytes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unsafe"
+)
+
+/*
+ *
+ * bytes.Buffer
+ *
+ */
+
+// A Buffer is a growable []byte with a read position. Writes append, reads
+// consume from the front. When it runs out of room it allocates a bigger
+// slice and copies - roughly doubling, so n writes cost O(n) overall but each
+// growth is a fresh allocation the old one leaves for the GC.
+//
+// bufferCaps records the capacity after each write so the pattern is visible
+func bufferCaps(writes int, chunk []byte) []int {
+	var buf bytes.Buffer
+	caps := make([]int, 0, writes)
+	for i := 0; i < writes; i++ {
+		buf.Write(chunk)
+		caps = append(caps, buf.Cap())
+	}
+	return caps
+}
+
+// If the final size is known, Grow allocates once up front
+func joinGrow(parts [][]byte) []byte {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	var buf bytes.Buffer
+	buf.Grow(n)
+	for _, p := range parts {
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+// Bytes doesn't copy - it returns the buffer's own memory, valid only until
+// the next write, Reset or Truncate. Holding on to it past that is a classic
+// bug, e.g. reusing one buffer across loop iterations and keeping the slices
+func bytesAliasing() (before, after string) {
+	var buf bytes.Buffer
+	buf.WriteString("first")
+	b := buf.Bytes()
+	before = string(b)
+
+	buf.Reset() // keeps the memory, just sets the length to zero
+	buf.WriteString("SECOND")
+	return before, string(b) // b now reads "SECON"
+}
+
+/*
+ *
+ * bytes.Reader
+ *
+ */
+
+// A Reader is a read-only view over a []byte that implements io.Reader,
+// io.ReaderAt, io.Seeker, io.ByteScanner and io.WriterTo - useful whenever an
+// API wants one of those and the data is already in memory. Unlike a Buffer
+// it can go backwards
+
+var errShortTrailer = errors.New("bytes: input shorter than trailer")
+
+// readTrailer reads the last n bytes, then rewinds to read the rest: a format
+// with its index at the end, like zip, is read this way
+func readTrailer(r io.ReadSeeker, n int64) (body, trailer []byte, err error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if size < n {
+		return nil, nil, errShortTrailer
+	}
+
+	if _, err := r.Seek(-n, io.SeekEnd); err != nil {
+		return nil, nil, err
+	}
+	trailer = make([]byte, n)
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	body = make([]byte, size-n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, err
+	}
+	return body, trailer, nil
+}
+
+/*
+ *
+ * Cut, Split and Fields
+ *
+ */
+
+// Cut splits around the first separator, the neatest way to parse key=value
+func parseKV(line []byte) (key, value []byte, ok bool) {
+	key, value, ok = bytes.Cut(line, []byte("="))
+	return bytes.TrimSpace(key), bytes.TrimSpace(value), ok
+}
+
+// None of these copy - the results are slices of the input. Split and Fields
+// cap each result's capacity at its length, but Cut's before doesn't: its
+// capacity runs to the end of the input, so appending to it writes straight
+// over the separator and whatever comes after
+func cutAppendClobbers() (input, key string) {
+	line := []byte("name=gopher")
+	k, _, _ := bytes.Cut(line, []byte("="))
+	k = append(k, "!!"...)
+	return string(line), string(k) // "name!!opher", "name!!"
+}
+
+// A full slice expression (or bytes.Clone) caps the capacity so append has
+// to copy
+func cutAppendSafe() (input, key string) {
+	line := []byte("name=gopher")
+	k, _, _ := bytes.Cut(line, []byte("="))
+	k = k[:len(k):len(k)]
+	k = append(k, "!!"...)
+	return string(line), string(k)
+}
+
+// Split keeps empty fields between separators, Fields splits on any run of
+// whitespace and drops them
+func splitVsFields(s []byte) (split, fields [][]byte) {
+	return bytes.Split(s, []byte(" ")), bytes.Fields(s)
+}
+
+/*
+ *
+ * []byte <-> string
+ *
+ */
+
+// Strings are immutable and []byte isn't, so converting either way normally
+// copies. The compiler skips the copy where it can prove nobody can observe
+// the difference:
+//
+//	m[string(b)]          map lookups
+//	string(b) == "x"      comparisons
+//	for i, c := range []byte(s)
+//
+// Everywhere else, unsafe.String and unsafe.Slice make a zero-copy view - and
+// break the immutability the rest of Go relies on. If b changes after
+// unsafeString(b), so does the "immutable" string, including inside any map
+// it was used as a key in
+
+func safeString(b []byte) string { return string(b) }
+
+// unsafeString is only safe if b is never modified again
+func unsafeString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// unsafeBytes must never be written to - string data can live in read-only
+// memory, and writing to it is a crash rather than a wrong answer
+func unsafeBytes(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// unsafeStringMutates shows the hazard: the string changes under our feet
+func unsafeStringMutates() (before, after string) {
+	b := []byte("hello")
+	s := unsafeString(b)
+	before = strings.Clone(s) // a real copy - string(s) would be a no-op
+	b[0] = 'j'
+	return before, s
+}
+
+// countWords looks each word up with m[string(w)], which the compiler
+// optimizes, and only pays for a copy when a new key is stored
+func countWords(text []byte) map[string]int {
+	counts := make(map[string]int)
+	for _, w := range bytes.Fields(text) {
+		if _, ok := counts[string(w)]; ok {
+			counts[string(w)]++
+			continue
+		}
+		counts[string(w)] = 1
+	}
+	return counts
+}
@@ -0,0 +1,150 @@
+package bytes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	sinkString string
+	sinkBytes  []byte
+	sinkBool   bool
+)
+
+func TestBufferGrowth(t *testing.T) {
+	caps := bufferCaps(20, make([]byte, 100))
+
+	grew := 0
+	for i := 1; i < len(caps); i++ {
+		assert.GreaterOrEqual(t, caps[i], caps[i-1])
+		if caps[i] > caps[i-1] {
+			grew++
+		}
+	}
+	assert.Less(t, grew, 10, "capacity grows geometrically, not on every write")
+	assert.GreaterOrEqual(t, caps[len(caps)-1], 2000)
+
+	parts := [][]byte{[]byte("a"), []byte("bb"), []byte("ccc")}
+	assert.Equal(t, "abbccc", string(joinGrow(parts)))
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() { sinkBytes = joinGrow(parts) }),
+		"the Buffer itself stays on the stack, only its bytes escape")
+}
+
+func TestBytesAliasing(t *testing.T) {
+	before, after := bytesAliasing()
+	assert.Equal(t, "first", before)
+	assert.Equal(t, "SECON", after)
+}
+
+func TestReadTrailer(t *testing.T) {
+	body, trailer, err := readTrailer(bytes.NewReader([]byte("payload|IDX")), 4)
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(body))
+	assert.Equal(t, "|IDX", string(trailer))
+
+	// strings.Reader is a ReadSeeker too
+	_, _, err = readTrailer(strings.NewReader("ab"), 4)
+	assert.ErrorIs(t, err, errShortTrailer)
+}
+
+func TestCutAndSplit(t *testing.T) {
+	k, v, ok := parseKV([]byte(" port = 8080 "))
+	assert.True(t, ok)
+	assert.Equal(t, "port", string(k))
+	assert.Equal(t, "8080", string(v))
+
+	_, _, ok = parseKV([]byte("no separator"))
+	assert.False(t, ok)
+
+	input, key := cutAppendClobbers()
+	assert.Equal(t, "name!!opher", input)
+	assert.Equal(t, "name!!", key)
+
+	input, key = cutAppendSafe()
+	assert.Equal(t, "name=gopher", input)
+	assert.Equal(t, "name!!", key)
+
+	split, fields := splitVsFields([]byte("a  b"))
+	assert.Equal(t, [][]byte{[]byte("a"), {}, []byte("b")}, split)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, fields)
+}
+
+func TestConversions(t *testing.T) {
+	b := []byte("gopher")
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() { sinkString = safeString(b) }))
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { sinkString = unsafeString(b) }))
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { sinkBytes = unsafeBytes("gopher") }))
+	assert.Equal(t, "", unsafeString(nil))
+	assert.Nil(t, unsafeBytes(""))
+
+	// the conversions the compiler optimizes away
+	m := map[string]int{"gopher": 1}
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { sinkBool = m[string(b)] == 1 }))
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { sinkBool = string(b) == "gopher" }))
+
+	before, after := unsafeStringMutates()
+	assert.Equal(t, "hello", before)
+	assert.Equal(t, "jello", after, "a string that changed")
+}
+
+func TestCountWords(t *testing.T) {
+	assert.Equal(t, map[string]int{"the": 2, "cat": 1, "hat": 1}, countWords([]byte("the cat the hat")))
+}
+
+func BenchmarkToString(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 1024)
+
+	b.Run("safe", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkString = safeString(data)
+		}
+	})
+	b.Run("unsafe", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkString = unsafeString(data)
+		}
+	})
+}
+
+func BenchmarkToBytes(b *testing.B) {
+	s := strings.Repeat("x", 1024)
+
+	b.Run("safe", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkBytes = []byte(s)
+		}
+	})
+	b.Run("unsafe", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkBytes = unsafeBytes(s)
+		}
+	})
+}
+
+// the compiler already does the zero-copy trick for map lookups, so there's
+// nothing for unsafe to win here
+func BenchmarkMapLookup(b *testing.B) {
+	m := map[string]int{"gopher": 1}
+	key := []byte("gopher")
+
+	b.Run("string(b)", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkBool = m[string(key)] == 1
+		}
+	})
+	b.Run("unsafe", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkBool = m[unsafeString(key)] == 1
+		}
+	})
+}
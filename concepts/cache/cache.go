@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"errors"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// Cache is an in-memory key/value cache where every entry expires ttl after
+// it was set - or never, if ttl is 0 or less. It's safe for concurrent use.
+//
+// Generics let us write it once for any key and value type. K has to be
+// comparable, since it's used as a map key, V can be anything
+type Cache[K comparable, V any] struct {
+	ttl    time.Duration
+	shards []*shard[K, V]
+	hash   func(K) uint64
+
+	// now is swapped out in tests so expiry doesn't depend on sleeping
+	now func() time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type entry[V any] struct {
+	value   V
+	expires time.Time // zero when the cache has no ttl
+}
+
+func (e entry[V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// call is an in-flight loader. Everyone asking for the same key while it's
+// running waits on wg and shares its result instead of calling the loader again
+type call[V any] struct {
+	wg      sync.WaitGroup
+	value   V
+	err     error
+	waiters int // goroutines that joined the call, guarded by the shard's mu
+}
+
+// ErrLoadPanicked is what goroutines waiting on a GetOrLoad get when the
+// loader they were waiting for panicked. The one that called it gets the panic
+var ErrLoadPanicked = errors.New("cache: load panicked")
+
+// A shard is a plain mutex protected map. With one shard every operation
+// contends on the same lock, splitting keys across several shards means
+// goroutines working on different keys rarely block each other
+type shard[K comparable, V any] struct {
+	mu    sync.Mutex
+	items map[K]entry[V]
+	calls map[K]*call[V]
+}
+
+// New returns a single shard cache, which is fine unless lock contention
+// shows up in a profile
+func New[K comparable, V any](ttl time.Duration) *Cache[K, V] {
+	return NewSharded[K, V](ttl, 1, func(K) uint64 { return 0 })
+}
+
+// NewSharded spreads keys across n shards. Go can't hash an arbitrary
+// comparable type for us, so the caller provides the hash function, see
+// StringHash for string keys
+func NewSharded[K comparable, V any](ttl time.Duration, n int, hash func(K) uint64) *Cache[K, V] {
+	if n < 1 {
+		n = 1
+	}
+
+	c := &Cache[K, V]{
+		ttl:    ttl,
+		shards: make([]*shard[K, V], n),
+		hash:   hash,
+		now:    time.Now,
+		stop:   make(chan struct{}),
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard[K, V]{
+			items: map[K]entry[V]{},
+			calls: map[K]*call[V]{},
+		}
+	}
+
+	// with no ttl nothing expires, so there's nothing to sweep - and
+	// time.NewTicker panics on an interval of 0
+	if ttl > 0 {
+		go c.janitor(ttl)
+	}
+
+	return c
+}
+
+var seed = maphash.MakeSeed()
+
+// StringHash is a hash function for NewSharded when keys are strings
+func StringHash(s string) uint64 {
+	return maphash.String(seed, s)
+}
+
+func (c *Cache[K, V]) shardFor(key K) *shard[K, V] {
+	return c.shards[c.hash(key)%uint64(len(c.shards))]
+}
+
+// Get returns the value for key, if it's there and hasn't expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[key]
+	if !ok || e.expired(c.now()) {
+		var zero V
+		return zero, false
+	}
+
+	return e.value, true
+}
+
+// Set stores value under key, replacing anything already there
+func (c *Cache[K, V]) Set(key K, value V) {
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[key] = entry[V]{value: value, expires: c.expiry()}
+}
+
+// expiry is when an entry set now expires
+func (c *Cache[K, V]) expiry() time.Time {
+	if c.ttl <= 0 {
+		return time.Time{}
+	}
+	return c.now().Add(c.ttl)
+}
+
+// Delete removes key from the cache
+func (c *Cache[K, V]) Delete(key K) {
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.items, key)
+}
+
+// Len counts the entries held, including expired ones the janitor hasn't
+// swept yet
+func (c *Cache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += len(s.items)
+		s.mu.Unlock()
+	}
+
+	return n
+}
+
+// GetOrLoad returns the cached value for key, or calls load to fill it.
+// If several goroutines miss on the same key at once, only the first one calls
+// load, the rest wait and get the same result. Errors aren't cached.
+//
+// If load panics, the panic carries on up the goroutine that called it, and
+// the ones waiting get ErrLoadPanicked rather than waiting forever
+func (c *Cache[K, V]) GetOrLoad(key K, load func() (V, error)) (V, error) {
+	if v, ok := c.Get(key); ok {
+		return v, nil
+	}
+
+	s := c.shardFor(key)
+	s.mu.Lock()
+	if cl, ok := s.calls[key]; ok {
+		cl.waiters++
+		s.mu.Unlock()
+		cl.wg.Wait()
+		return cl.value, cl.err
+	}
+
+	cl := &call[V]{}
+	cl.wg.Add(1)
+	s.calls[key] = cl
+	s.mu.Unlock()
+
+	// the call is finished in a defer so a panicking load - or one that calls
+	// runtime.Goexit, as t.FailNow does - still releases the waiters and
+	// clears the way for the next try. Not recovering keeps the panic's stack
+	returned := false
+	defer func() {
+		if !returned {
+			cl.err = ErrLoadPanicked
+		}
+		s.mu.Lock()
+		if cl.err == nil {
+			s.items[key] = entry[V]{value: cl.value, expires: c.expiry()}
+		}
+		delete(s.calls, key)
+		s.mu.Unlock()
+		cl.wg.Done()
+	}()
+
+	cl.value, cl.err = load()
+	returned = true
+
+	return cl.value, cl.err
+}
+
+// Without the janitor, expired entries nobody asks for again would sit in
+// memory forever. It runs in its own goroutine until Close is called
+func (c *Cache[K, V]) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			c.deleteExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Cache[K, V]) deleteExpired() {
+	now := c.now()
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for k, e := range s.items {
+			if e.expired(now) {
+				delete(s.items, k)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Close stops the janitor goroutine. It's safe to call more than once
+func (c *Cache[K, V]) Close() {
+	c.once.Do(func() { close(c.stop) })
+}
@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNow returns a now func for the cache and a way to move it forward
+func fakeNow() (func() time.Time, func(time.Duration)) {
+	var mu sync.Mutex
+	t := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	now := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return t
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		t = t.Add(d)
+	}
+
+	return now, advance
+}
+
+func TestGetSetExpire(t *testing.T) {
+	c := New[string, int](time.Minute)
+	defer c.Close()
+	now, advance := fakeNow()
+	c.now = now
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Set("a", 1)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	advance(time.Minute)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+
+	c.deleteExpired()
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestDelete(t *testing.T) {
+	c := NewSharded[string, int](time.Minute, 4, StringHash)
+	defer c.Close()
+
+	c.Set("a", 1)
+	c.Delete("a")
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+}
+
+func TestJanitorSweeps(t *testing.T) {
+	c := New[string, int](10 * time.Millisecond)
+	defer c.Close()
+
+	c.Set("a", 1)
+	assert.Eventually(t, func() bool { return c.Len() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestGetOrLoadSuppressesDuplicates(t *testing.T) {
+	c := NewSharded[string, int](time.Minute, 8, StringHash)
+	defer c.Close()
+
+	var calls int32
+	release := make(chan struct{})
+	load := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, 50)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.GetOrLoad("answer", load)
+		}(i)
+	}
+
+	// give the goroutines a chance to pile up behind the first loader
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, r := range results {
+		assert.Equal(t, 42, r)
+	}
+}
+
+func TestGetOrLoadDoesNotCacheErrors(t *testing.T) {
+	c := New[string, int](time.Minute)
+	defer c.Close()
+
+	boom := errors.New("boom")
+	_, err := c.GetOrLoad("a", func() (int, error) { return 0, boom })
+	assert.ErrorIs(t, err, boom)
+
+	v, err := c.GetOrLoad("a", func() (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestNoTTL(t *testing.T) {
+	// 0 means no expiry, not a janitor ticking every 0s - which would panic
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		c := New[string, int](ttl)
+		now, advance := fakeNow()
+		c.now = now
+
+		c.Set("a", 1)
+		v, err := c.GetOrLoad("b", func() (int, error) { return 2, nil })
+		assert.NoError(t, err)
+		assert.Equal(t, 2, v)
+
+		advance(24 * 365 * time.Hour)
+		c.deleteExpired()
+		v, ok := c.Get("a")
+		assert.True(t, ok, "ttl %v", ttl)
+		assert.Equal(t, 1, v)
+		_, ok = c.Get("b")
+		assert.True(t, ok, "ttl %v", ttl)
+		c.Close()
+	}
+}
+
+func TestGetOrLoadPanics(t *testing.T) {
+	c := New[string, int](time.Minute)
+	defer c.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	load := func() (int, error) {
+		close(started)
+		<-release
+		panic("loader bug")
+	}
+
+	panicked := make(chan any)
+	go func() {
+		defer func() { panicked <- recover() }()
+		c.GetOrLoad("a", load)
+	}()
+	<-started
+
+	// these wait on the panicking load, and must get an answer
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = c.GetOrLoad("a", func() (int, error) { return 0, errors.New("called the loader again") })
+		}(i)
+	}
+	// the panic waits until every one of them has joined the load
+	s := c.shardFor("a")
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.calls["a"].waiters == len(errs)
+	}, 5*time.Second, time.Millisecond)
+	close(release)
+
+	assert.Equal(t, "loader bug", <-panicked, "the caller gets the panic")
+	wg.Wait()
+	for _, err := range errs {
+		assert.ErrorIs(t, err, ErrLoadPanicked)
+	}
+
+	// nothing was cached, and the next load runs
+	v, err := c.GetOrLoad("a", func() (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+// run with go test -race to check the locking
+func TestConcurrentAccess(t *testing.T) {
+	c := NewSharded[string, int](time.Millisecond, 4, StringHash)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := strconv.Itoa(i % 32)
+				c.Set(k, i)
+				c.Get(k)
+				c.GetOrLoad(k, func() (int, error) { return g, nil })
+				if i%100 == 0 {
+					c.Delete(k)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+/*
+ *
+ * benchmarks
+ *
+ */
+
+// mutexMap is the baseline, a map behind a single RWMutex with no expiry
+type mutexMap struct {
+	mu sync.RWMutex
+	m  map[string]int
+}
+
+func (m *mutexMap) Get(k string) (int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.m[k]
+	return v, ok
+}
+
+func (m *mutexMap) Set(k string, v int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.m[k] = v
+}
+
+type getSetter interface {
+	Get(string) (int, bool)
+	Set(string, int)
+}
+
+var benchKeys = func() []string {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	return keys
+}()
+
+// one write for every nine reads, spread over every P
+func benchmarkMixed(b *testing.B, c getSetter) {
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k := benchKeys[i%len(benchKeys)]
+			if i%10 == 0 {
+				c.Set(k, i)
+			} else {
+				c.Get(k)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkMutexMap(b *testing.B) {
+	benchmarkMixed(b, &mutexMap{m: map[string]int{}})
+}
+
+func BenchmarkCache(b *testing.B) {
+	c := New[string, int](time.Hour)
+	defer c.Close()
+	benchmarkMixed(b, c)
+}
+
+func BenchmarkCacheSharded(b *testing.B) {
+	c := NewSharded[string, int](time.Hour, 32, StringHash)
+	defer c.Close()
+	benchmarkMixed(b, c)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+)
+
+/*
+ *
+ * context.AfterFunc
+ *
+ */
+
+// context.AfterFunc (Go 1.21) runs a function in its own goroutine once ctx is
+// done. It runs at most once however many times ctx is cancelled, and the stop
+// function it returns unregisters it:
+//
+//	stop := context.AfterFunc(ctx, cleanup)
+//	...
+//	if stop() {
+//		// ctx wasn't done yet, and now cleanup will never run
+//	}
+//
+// Before it existed, the same thing took a goroutine sitting in a select on
+// ctx.Done() - one per registration, for as long as the context lived
+
+// closeOnDone closes c when ctx is done. Useful for things that don't take a
+// context themselves, a blocked Read on a connection returns as soon as it's
+// closed. Calling the returned stop after finishing normally means c is left
+// for the caller to close
+func closeOnDone(ctx context.Context, c io.Closer) (stop func() bool) {
+	return context.AfterFunc(ctx, func() {
+		c.Close()
+	})
+}
+
+// acceptUntilDone accepts connections until ctx is done. Accept has no
+// context, but closing the listener makes it return with net.ErrClosed, so
+// that's what we turn cancellation into
+func acceptUntilDone(ctx context.Context, l net.Listener, handle func(net.Conn)) error {
+	stop := closeOnDone(ctx, l)
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go handle(conn)
+	}
+}
+
+// Older code often stops on a channel being closed rather than a context.
+// doneChannel bridges the two. It's only a nicer ctx.Done() if there's no
+// way around the channel type, but it shows the shape of the bridge
+func doneChannel(ctx context.Context) <-chan struct{} {
+	stop := make(chan struct{})
+	context.AfterFunc(ctx, func() {
+		close(stop)
+	})
+
+	return stop
+}
+
+// legacyWorker is the kind of API doneChannel exists for - it predates
+// context and wants a stop channel
+func legacyWorker(stop <-chan struct{}, jobs <-chan int, results chan<- int) {
+	for {
+		select {
+		case j := <-jobs:
+			results <- j * 2
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCloser counts Close calls and signals each one
+type countingCloser struct {
+	n      int32
+	closed chan struct{}
+}
+
+func newCountingCloser() *countingCloser {
+	return &countingCloser{closed: make(chan struct{}, 10)}
+}
+
+func (c *countingCloser) Close() error {
+	atomic.AddInt32(&c.n, 1)
+	c.closed <- struct{}{}
+	return nil
+}
+
+func TestCloseOnDoneFiresOnce(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parent)
+	c := newCountingCloser()
+
+	closeOnDone(ctx, c)
+	cancel()
+	cancel()
+	cancelParent()
+
+	<-c.closed
+	// give a second call the chance to show up, if there was going to be one
+	select {
+	case <-c.closed:
+		t.Fatal("Close called twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&c.n))
+}
+
+func TestCloseOnDoneStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newCountingCloser()
+
+	stop := closeOnDone(ctx, c)
+	assert.True(t, stop(), "stop before cancel prevents the hook")
+	assert.False(t, stop(), "a second stop has nothing left to stop")
+	cancel()
+
+	select {
+	case <-c.closed:
+		t.Fatal("Close called after stop")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestAcceptUntilDone(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handled := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- acceptUntilDone(ctx, l, func(c net.Conn) {
+			c.Close()
+			handled <- struct{}{}
+		})
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+	<-handled
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestDoneChannelBridge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan int)
+	results := make(chan int)
+	finished := make(chan struct{})
+
+	go func() {
+		legacyWorker(doneChannel(ctx), jobs, results)
+		close(finished)
+	}()
+
+	jobs <- 21
+	assert.Equal(t, 42, <-results)
+
+	cancel()
+	<-finished
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+/*
+ *
+ * cancellation causes
+ *
+ */
+
+// ctx.Err() only ever says context.Canceled or context.DeadlineExceeded, it
+// can't say why. Since Go 1.20 the code doing the cancelling can attach its
+// own error, and anyone holding the context can read it back with
+// context.Cause:
+//
+//	ctx, cancel := context.WithCancelCause(parent)
+//	cancel(errServerShuttingDown)
+//	ctx.Err()           // context.Canceled, as before
+//	context.Cause(ctx)  // errServerShuttingDown
+//
+// Cancelling without a cause (cancel(nil)), or a context that was never
+// cancelled with one, makes Cause return the same thing as Err
+
+var (
+	errServerShuttingDown = errors.New("server shutting down")
+	errUpstreamTooSlow    = errors.New("upstream too slow")
+)
+
+// Go 1.21 added the same for deadlines. When the timer fires, Err is still
+// context.DeadlineExceeded, Cause is errUpstreamTooSlow
+func withUpstreamTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ctx, d, errUpstreamTooSlow)
+}
+
+// shutdownMiddleware cancels every request still running when stop is closed,
+// with a cause handlers can tell apart from the client going away
+func shutdownMiddleware(stop <-chan struct{}) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithCancelCause(r.Context())
+			defer cancel(nil)
+
+			go func() {
+				select {
+				case <-stop:
+					cancel(errServerShuttingDown)
+				case <-ctx.Done():
+				}
+			}()
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// slowHandler waits for ready, but gives up after timeout
+func slowHandler(ready <-chan struct{}, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := withUpstreamTimeout(r.Context(), timeout)
+		defer cancel()
+
+		select {
+		case <-ready:
+			w.Write([]byte("done\n"))
+		case <-ctx.Done():
+			w.WriteHeader(statusForCause(ctx))
+		}
+	}
+}
+
+// The causes are plain errors, so errors.Is works on them - including when the
+// cause was wrapped with fmt.Errorf("...: %w", err) on the way. Note it has to
+// be used on context.Cause(ctx), not ctx.Err(), which never wraps the cause
+func statusForCause(ctx context.Context) int {
+	cause := context.Cause(ctx)
+	switch {
+	case errors.Is(cause, errServerShuttingDown):
+		return http.StatusServiceUnavailable
+	case errors.Is(cause, errUpstreamTooSlow):
+		return http.StatusGatewayTimeout
+	default:
+		// the client gave up, nobody will see this
+		return http.StatusRequestTimeout
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelCause(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	assert.Nil(t, context.Cause(ctx))
+
+	cancel(errServerShuttingDown)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.ErrorIs(t, context.Cause(ctx), errServerShuttingDown)
+	assert.False(t, errors.Is(ctx.Err(), errServerShuttingDown))
+
+	// only the first cancel counts
+	cancel(errUpstreamTooSlow)
+	assert.ErrorIs(t, context.Cause(ctx), errServerShuttingDown)
+}
+
+func TestCancelWithoutCause(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(nil)
+	assert.Equal(t, context.Canceled, context.Cause(ctx))
+
+	plain, cancelPlain := context.WithCancel(context.Background())
+	cancelPlain()
+	assert.Equal(t, context.Canceled, context.Cause(plain))
+}
+
+func TestCauseIsInherited(t *testing.T) {
+	parent, cancel := context.WithCancelCause(context.Background())
+	child, cancelChild := context.WithTimeout(parent, time.Hour)
+	defer cancelChild()
+
+	cancel(fmt.Errorf("deploying: %w", errServerShuttingDown))
+	assert.ErrorIs(t, context.Cause(child), errServerShuttingDown)
+}
+
+func TestDeadlineCause(t *testing.T) {
+	ctx, cancel := withUpstreamTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+	assert.ErrorIs(t, context.Cause(ctx), errUpstreamTooSlow)
+}
+
+func TestHandlerStatusFromCause(t *testing.T) {
+	t.Run("deadline", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		slowHandler(make(chan struct{}), time.Millisecond).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		stop := make(chan struct{})
+		close(stop)
+		h := shutdownMiddleware(stop)(slowHandler(make(chan struct{}), time.Hour))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	t.Run("ready in time", func(t *testing.T) {
+		ready := make(chan struct{})
+		close(ready)
+		h := shutdownMiddleware(make(chan struct{}))(slowHandler(ready, time.Hour))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+/*
+ *
+ * work that outlives the request
+ *
+ */
+
+// r.Context() is cancelled as soon as ServeHTTP returns. That's usually what
+// we want, but not for work kicked off to happen after the response - writing
+// an audit log, sending a webhook. Passing r.Context() to that goroutine means
+// it gets cancelled almost straight away, passing context.Background() loses
+// the request ID, the trace, and anything else stored in the context.
+//
+// context.WithoutCancel (Go 1.21) is the middle ground: a context with all the
+// values of its parent, but none of its cancellation or deadline
+
+type requestIDKey struct{}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Before 1.21 it had to be written by hand. Context is an interface, so
+// anything with these four methods is one - this one answers Value from the
+// parent and otherwise acts like context.Background()
+type detachedContext struct {
+	parent context.Context
+}
+
+func withoutCancel(parent context.Context) context.Context {
+	return detachedContext{parent}
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// auditMiddleware calls audit after every response has been written, in the
+// background. The detached context should still be given a deadline of its
+// own - nothing else will ever cancel it
+func auditMiddleware(audit func(ctx context.Context, event string)) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r)
+
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+			go func() {
+				defer cancel()
+				audit(ctx, r.Method+" "+r.URL.Path)
+			}()
+		})
+	}
+}
+
+// requestIDMiddleware gives every request an ID, for the audit log to pick up
+func requestIDMiddleware(newID func() string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(withRequestID(r.Context(), newID())))
+		})
+	}
+}
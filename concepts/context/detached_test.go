@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithoutCancel(t *testing.T) {
+	detachers := map[string]func(context.Context) context.Context{
+		"context.WithoutCancel": context.WithoutCancel,
+		"hand-rolled":           withoutCancel,
+	}
+
+	for name, detach := range detachers {
+		t.Run(name, func(t *testing.T) {
+			parent, cancel := context.WithTimeout(withRequestID(context.Background(), "req-1"), time.Hour)
+			ctx := detach(parent)
+			cancel()
+
+			assert.Error(t, parent.Err())
+			assert.NoError(t, ctx.Err())
+			assert.Nil(t, ctx.Done())
+			_, ok := ctx.Deadline()
+			assert.False(t, ok)
+			assert.Equal(t, "req-1", requestIDFrom(ctx))
+
+			// it can still be cancelled by giving it a parent of its own making
+			child, cancelChild := context.WithCancel(ctx)
+			cancelChild()
+			assert.ErrorIs(t, child.Err(), context.Canceled)
+		})
+	}
+}
+
+func TestAuditAfterResponse(t *testing.T) {
+	type audited struct {
+		event     string
+		requestID string
+		err       error
+	}
+	release := make(chan struct{})
+	got := make(chan audited)
+
+	audit := func(ctx context.Context, event string) {
+		// don't look at the context until the request is long finished
+		<-release
+		got <- audited{event, requestIDFrom(ctx), ctx.Err()}
+	}
+
+	h := requestIDMiddleware(func() string { return "req-42" })(
+		auditMiddleware(audit)(http.HandlerFunc(helloHandler)))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/todos")
+	require.NoError(t, err)
+	resp.Body.Close()
+	srv.Close()
+
+	close(release)
+	a := <-got
+	assert.Equal(t, "GET /todos", a.event)
+	assert.Equal(t, "req-42", a.requestID)
+	assert.NoError(t, a.err)
+}
+
+func helloHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("hello\n"))
+}
@@ -22,7 +22,7 @@ func takeContext(ctx context.Context) {
 // when there is no existing context, like at the beginning of
 // your program, create one with conext.Background()
 
-func _main() {
+func main() {
 	// this returns empty context.Context interface
 	ctx := context.Background()
 	takeContext(ctx)
@@ -0,0 +1,149 @@
+package values
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A context only does anything if it's passed all the way down. This chapter
+// follows one request through three layers:
+//
+//	handler  - takes r.Context() and tightens it with its own deadline
+//	service  - does nothing with the context but pass it on
+//	storage  - hands it to database/sql, and to the outgoing http.Request
+//
+// When the client hangs up, or the deadline passes, the context is cancelled
+// and the query and the outgoing request both stop - nothing keeps working on
+// a response nobody will read
+
+/*
+ *
+ * storage
+ *
+ */
+
+const countTodosQuery = "SELECT count(*) FROM todos WHERE user_id = ? AND completed = FALSE"
+
+type todoStore struct {
+	db *sql.DB
+	// query is a field so the tests can swap in something slow enough to
+	// cancel halfway through
+	query string
+}
+
+func newTodoStore(db *sql.DB) *todoStore {
+	return &todoStore{db: db, query: countTodosQuery}
+}
+
+// QueryRowContext stops the query when ctx is done, and Scan returns ctx.Err()
+func (s *todoStore) OpenTodos(ctx context.Context, userID int64) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, s.query, userID).Scan(&n)
+	return n, err
+}
+
+type userClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+type user struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// NewRequestWithContext ties the outgoing request to ctx, when it's cancelled
+// the transport closes the connection and Do returns
+func (c *userClient) User(ctx context.Context, id int64) (user, error) {
+	var u user
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/users/%d", c.baseURL, id), nil)
+	if err != nil {
+		return u, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return u, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return u, fmt.Errorf("fetching user %d: %s", id, resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&u)
+	return u, err
+}
+
+/*
+ *
+ * service
+ *
+ */
+
+type summary struct {
+	Name      string `json:"name"`
+	OpenTodos int64  `json:"openTodos"`
+}
+
+type summaryService struct {
+	todos *todoStore
+	users *userClient
+}
+
+// Summary doesn't need to know anything about deadlines or cancellation, it
+// just accepts a context and passes it to everything it calls
+func (s *summaryService) Summary(ctx context.Context, userID int64) (summary, error) {
+	u, err := s.users.User(ctx, userID)
+	if err != nil {
+		return summary{}, err
+	}
+
+	n, err := s.todos.OpenTodos(ctx, userID)
+	if err != nil {
+		return summary{}, err
+	}
+
+	return summary{Name: u.Name, OpenTodos: n}, nil
+}
+
+/*
+ *
+ * handler
+ *
+ */
+
+// summaryHandler gives every request at most timeout to finish. The context
+// from WithTimeout is a child of r.Context(), so it's cancelled by whichever
+// comes first, the deadline or the client going away
+func summaryHandler(svc *summaryService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		// always call cancel, it releases the timer as soon as we're done
+		defer cancel()
+
+		id, err := strconv.ParseInt(r.URL.Query().Get("user"), 10, 64)
+		if err != nil {
+			http.Error(w, "bad user id", http.StatusBadRequest)
+			return
+		}
+
+		s, err := svc.Summary(ctx, id)
+		switch {
+		case err == nil:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(s)
+		case ctx.Err() == context.DeadlineExceeded:
+			http.Error(w, "timed out", http.StatusGatewayTimeout)
+		case r.Context().Err() != nil:
+			// the client has gone, there's nobody to write a response to
+		default:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package values
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sqlconcept "github.com/thorntonmc/go-practice/concepts/sql"
+)
+
+// slowCountQuery counts to a billion before answering, long enough that it's
+// always still running when the context is cancelled
+const slowCountQuery = `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000)
+SELECT count(*) FROM c WHERE ? > 0`
+
+type fixture struct {
+	svc      *summaryService
+	store    *todoStore
+	entered  chan struct{}
+	aborted  chan struct{}
+	upstream *httptest.Server
+}
+
+// newFixture wires the layers together against a real sqlite database and an
+// upstream user service. When block is set, the upstream holds every request
+// until the client gives up, and reports that it saw it give up
+func newFixture(t *testing.T, block bool) *fixture {
+	ctx := context.Background()
+	db, err := sqlconcept.Open(ctx, filepath.Join(t.TempDir(), "todos.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec("INSERT INTO todos (user_id, title, completed) VALUES (1, 'a', FALSE), (1, 'b', TRUE), (1, 'c', FALSE)")
+	require.NoError(t, err)
+
+	f := &fixture{entered: make(chan struct{}, 1), aborted: make(chan struct{}, 1)}
+	f.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if block {
+			f.entered <- struct{}{}
+			<-r.Context().Done()
+			f.aborted <- struct{}{}
+			return
+		}
+		w.Write([]byte(`{"id":1,"name":"michael"}`))
+	}))
+	t.Cleanup(f.upstream.Close)
+
+	f.store = newTodoStore(db)
+	f.svc = &summaryService{
+		todos: f.store,
+		users: &userClient{client: f.upstream.Client(), baseURL: f.upstream.URL},
+	}
+
+	return f
+}
+
+func TestSummary(t *testing.T) {
+	f := newFixture(t, false)
+	srv := httptest.NewServer(summaryHandler(f.svc, time.Second))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?user=1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var s summary
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&s))
+	assert.Equal(t, summary{Name: "michael", OpenTodos: 2}, s)
+}
+
+func TestClientCancelAbortsOutgoingRequest(t *testing.T) {
+	f := newFixture(t, true)
+	srv := httptest.NewServer(summaryHandler(f.svc, time.Minute))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?user=1", nil)
+
+	errc := make(chan error)
+	go func() {
+		_, err := http.DefaultClient.Do(req)
+		errc <- err
+	}()
+
+	// once our request is waiting on the upstream, hang up
+	<-f.entered
+	cancel()
+
+	assert.ErrorIs(t, <-errc, context.Canceled)
+	select {
+	case <-f.aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream request was not cancelled")
+	}
+}
+
+func TestServiceCancelMidQuery(t *testing.T) {
+	f := newFixture(t, false)
+	f.store.query = slowCountQuery
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := f.svc.Summary(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second, "query kept running after cancel")
+}
+
+func TestHandlerDeadlineAbortsQuery(t *testing.T) {
+	f := newFixture(t, false)
+	f.store.query = slowCountQuery
+
+	w := httptest.NewRecorder()
+	summaryHandler(f.svc, 50*time.Millisecond).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?user=1", nil))
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
@@ -0,0 +1,144 @@
+package datastructures
+
+// LinkedList is a doubly linked list, container/list with type parameters.
+// Inserting or removing next to an element you already hold is O(1), with
+// no shifting - but finding an element is O(n), and every node is its own
+// allocation scattered around the heap, which CPU caches hate. A slice wins
+// for almost everything; a list is for when you hold on to elements and move
+// them around, like the recency order in an LRU cache.
+//
+// The list is a ring around a sentinel root element. The sentinel means
+// there's always a prev and a next, so no insert or remove needs a nil check
+// for the ends. The zero value is an empty list ready to use
+type LinkedList[T any] struct {
+	root Element[T]
+	len  int
+}
+
+// Element is a node in a LinkedList
+type Element[T any] struct {
+	Value T
+
+	next, prev *Element[T]
+	list       *LinkedList[T]
+}
+
+// Next returns the element after e, or nil at the end
+func (e *Element[T]) Next() *Element[T] {
+	if e.list == nil || e.next == &e.list.root {
+		return nil
+	}
+	return e.next
+}
+
+// Prev returns the element before e, or nil at the start
+func (e *Element[T]) Prev() *Element[T] {
+	if e.list == nil || e.prev == &e.list.root {
+		return nil
+	}
+	return e.prev
+}
+
+// lazyInit makes the zero value usable: an empty ring is the root pointing
+// at itself
+func (l *LinkedList[T]) lazyInit() {
+	if l.root.next == nil {
+		l.root.next = &l.root
+		l.root.prev = &l.root
+	}
+}
+
+func (l *LinkedList[T]) Len() int { return l.len }
+
+// Front returns the first element, or nil if the list is empty
+func (l *LinkedList[T]) Front() *Element[T] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.next
+}
+
+// Back returns the last element, or nil if the list is empty
+func (l *LinkedList[T]) Back() *Element[T] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+// insert puts e after at
+func (l *LinkedList[T]) insert(e, at *Element[T]) *Element[T] {
+	e.prev = at
+	e.next = at.next
+	e.prev.next = e
+	e.next.prev = e
+	e.list = l
+	l.len++
+	return e
+}
+
+func (l *LinkedList[T]) PushFront(v T) *Element[T] {
+	l.lazyInit()
+	return l.insert(&Element[T]{Value: v}, &l.root)
+}
+
+func (l *LinkedList[T]) PushBack(v T) *Element[T] {
+	l.lazyInit()
+	return l.insert(&Element[T]{Value: v}, l.root.prev)
+}
+
+// InsertAfter adds v after mark, which must be in l
+func (l *LinkedList[T]) InsertAfter(v T, mark *Element[T]) *Element[T] {
+	if mark.list != l {
+		return nil
+	}
+	return l.insert(&Element[T]{Value: v}, mark)
+}
+
+// Remove takes e out of l and returns its value. Removing an element that
+// isn't in l does nothing
+func (l *LinkedList[T]) Remove(e *Element[T]) T {
+	if e.list == l {
+		e.prev.next = e.next
+		e.next.prev = e.prev
+		// clear the links so the removed element can't keep the rest of
+		// the list alive, or be used to walk it
+		e.next, e.prev, e.list = nil, nil, nil
+		l.len--
+	}
+	return e.Value
+}
+
+// MoveToFront moves e to the front of l without allocating
+func (l *LinkedList[T]) MoveToFront(e *Element[T]) {
+	if e.list != l || l.root.next == e {
+		return
+	}
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	l.len--
+	l.insert(e, &l.root)
+}
+
+// Reverse reverses the list in place by swapping every element's links,
+// the root's included
+func (l *LinkedList[T]) Reverse() {
+	l.lazyInit()
+	e := &l.root
+	for {
+		e.next, e.prev = e.prev, e.next
+		e = e.prev // what was next
+		if e == &l.root {
+			return
+		}
+	}
+}
+
+// Values returns the list's values in order
+func (l *LinkedList[T]) Values() []T {
+	vs := make([]T, 0, l.len)
+	for e := l.Front(); e != nil; e = e.Next() {
+		vs = append(vs, e.Value)
+	}
+	return vs
+}
@@ -0,0 +1,105 @@
+package datastructures
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkedList(t *testing.T) {
+	var l LinkedList[string]
+	assert.Nil(t, l.Front())
+	assert.Nil(t, l.Back())
+
+	b := l.PushBack("b")
+	a := l.PushFront("a")
+	l.PushBack("d")
+	l.InsertAfter("c", b)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, l.Values())
+	assert.Equal(t, 4, l.Len())
+
+	assert.Nil(t, a.Prev())
+	assert.Equal(t, "b", a.Next().Value)
+	assert.Equal(t, "d", l.Back().Value)
+	assert.Nil(t, l.Back().Next())
+
+	assert.Equal(t, "b", l.Remove(b))
+	assert.Equal(t, []string{"a", "c", "d"}, l.Values())
+	assert.Nil(t, b.Next(), "removed elements are unlinked")
+	l.Remove(b) // a second time is a no-op
+	assert.Equal(t, 3, l.Len())
+
+	l.MoveToFront(l.Back())
+	assert.Equal(t, []string{"d", "a", "c"}, l.Values())
+	l.MoveToFront(l.Front())
+	assert.Equal(t, []string{"d", "a", "c"}, l.Values())
+
+	l.Reverse()
+	assert.Equal(t, []string{"c", "a", "d"}, l.Values())
+	assert.Equal(t, "a", l.Back().Prev().Value)
+}
+
+func TestLinkedListForeignElements(t *testing.T) {
+	var l1, l2 LinkedList[int]
+	e := l1.PushBack(1)
+	l2.PushBack(2)
+
+	l2.Remove(e)
+	l2.MoveToFront(e)
+	assert.Nil(t, l2.InsertAfter(3, e))
+	assert.Equal(t, []int{1}, l1.Values())
+	assert.Equal(t, []int{2}, l2.Values())
+}
+
+func TestLinkedListEmptyReverse(t *testing.T) {
+	var l LinkedList[int]
+	l.Reverse()
+	assert.Empty(t, l.Values())
+
+	l.PushBack(1)
+	l.Reverse()
+	require.Equal(t, []int{1}, l.Values())
+}
+
+func BenchmarkLinkedList(b *testing.B) {
+	b.Run("generic", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var l LinkedList[int]
+			for j := 0; j < 100; j++ {
+				l.PushBack(j)
+			}
+			for e := l.Front(); e != nil; e = e.Next() {
+				sinkInt += e.Value
+			}
+		}
+	})
+	// container/list stores values as any, so every int is boxed and every
+	// read needs a type assertion
+	b.Run("container/list", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l := list.New()
+			for j := 0; j < 100; j++ {
+				l.PushBack(j)
+			}
+			for e := l.Front(); e != nil; e = e.Next() {
+				sinkInt += e.Value.(int)
+			}
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var s []int
+			for j := 0; j < 100; j++ {
+				s = append(s, j)
+			}
+			for _, v := range s {
+				sinkInt += v
+			}
+		}
+	})
+}
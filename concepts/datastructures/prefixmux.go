@@ -0,0 +1,65 @@
+package datastructures
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/thorntonmc/go-practice/pkg/trie"
+)
+
+// PrefixMux routes a request to the handler registered for the longest
+// prefix of its path, compared a whole segment at a time - so "/api" covers
+// "/api/users" but not "/apiv2". It's a trie.Trie[string, http.Handler]
+// keyed by segments, and finding the handler is one LongestPrefix walk,
+// however many routes there are.
+//
+// http.ServeMux makes a similar choice differently:
+//
+//   - before Go 1.22, "/api/" (trailing slash) matches the subtree and "/api"
+//     only itself, and finding the longest match means checking the subtree
+//     patterns one by one, longest first
+//   - Go 1.22 patterns add methods, {wildcards} and a precedence rule of
+//     "most specific wins", which is why it needs a smarter structure - a
+//     tree of segments, much like this one
+//   - ServeMux also cleans paths, redirecting /a/../b to /b, and
+//     redirects /api to /api/ when only the subtree is registered. PrefixMux
+//     does neither, it just ignores empty segments
+//
+// pkg/router builds a full router, with methods and parameters, on the same
+// trie
+type PrefixMux struct {
+	routes   trie.Trie[string, http.Handler]
+	NotFound http.Handler // http.NotFoundHandler() when nil
+}
+
+func segments(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// Handle registers h for prefix and everything below it. "/" is the
+// catch-all
+func (m *PrefixMux) Handle(prefix string, h http.Handler) {
+	m.routes.Put(segments(prefix), h)
+}
+
+// Handler returns the handler for path and the prefix it was registered
+// with, or nil
+func (m *PrefixMux) Handler(path string) (h http.Handler, prefix string) {
+	segs := segments(path)
+	n, h, ok := m.routes.LongestPrefix(segs)
+	if !ok {
+		return nil, ""
+	}
+	return h, "/" + strings.Join(segs[:n], "/")
+}
+
+func (m *PrefixMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, _ := m.Handler(r.URL.Path)
+	if h == nil {
+		h = m.NotFound
+	}
+	if h == nil {
+		h = http.NotFoundHandler()
+	}
+	h.ServeHTTP(w, r)
+}
@@ -0,0 +1,112 @@
+package datastructures
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func named(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	})
+}
+
+func TestPrefixMux(t *testing.T) {
+	var m PrefixMux
+	m.Handle("/", named("root"))
+	m.Handle("/api", named("api"))
+	m.Handle("/api/users/", named("users"))
+	m.Handle("/static", named("static"))
+
+	tests := []struct {
+		path, want, prefix string
+	}{
+		{"/", "root", "/"},
+		{"/about", "root", "/"},
+		{"/api", "api", "/api"},
+		{"/api/", "api", "/api"},
+		{"/api/orders/1", "api", "/api"},
+		{"/api/users", "users", "/api/users"},
+		{"/api/users/42", "users", "/api/users"},
+		{"//api//users", "users", "/api/users"},
+		{"/apiv2", "root", "/"}, // whole segments only
+		{"/static/css/app.css", "static", "/static"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.want, w.Body.String())
+
+			_, prefix := m.Handler(tt.path)
+			assert.Equal(t, tt.prefix, prefix)
+		})
+	}
+}
+
+func TestPrefixMuxNotFound(t *testing.T) {
+	var m PrefixMux
+	m.Handle("/api", named("api"))
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	m.NotFound = named("custom")
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other", nil))
+	assert.Equal(t, "custom", w.Body.String())
+}
+
+// TestServeMuxDifferences shows where http.ServeMux, with this module's Go
+// 1.21 semantics, behaves differently for the same routes
+func TestServeMuxDifferences(t *testing.T) {
+	sm := http.NewServeMux()
+	sm.Handle("/api/", named("api"))
+	sm.Handle("/", named("root"))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sm.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// only the subtree was registered, so /api is redirected to /api/
+	w := get("/api")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/api/", w.Header().Get("Location"))
+
+	// and unclean paths are redirected to their clean form
+	w = get("/api/../static")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/static", w.Header().Get("Location"))
+
+	// subtree matching is by prefix like PrefixMux
+	assert.Equal(t, "api", get("/api/users/42").Body.String())
+	assert.Equal(t, "root", get("/apiv2").Body.String())
+}
+
+func BenchmarkPrefixMux(b *testing.B) {
+	var m PrefixMux
+	sm := http.NewServeMux()
+	for _, p := range []string{"/", "/api", "/api/users", "/api/orders", "/static", "/admin", "/admin/settings"} {
+		m.Handle(p, named(p))
+		sm.Handle(p+"/", named(p))
+	}
+
+	b.Run("trie", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.Handler("/api/users/42/posts")
+		}
+	})
+	b.Run("servemux", func(b *testing.B) {
+		r := httptest.NewRequest(http.MethodGet, "/api/users/42/posts", nil)
+		for i := 0; i < b.N; i++ {
+			sm.Handler(r)
+		}
+	})
+}
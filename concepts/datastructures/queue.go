@@ -0,0 +1,62 @@
+package datastructures
+
+// Queue is first in, first out. The obvious slice version - append to
+// enqueue, s = s[1:] to dequeue - never reuses the space at the front, so a
+// long-lived queue keeps reallocating as it walks through memory. A ring
+// buffer wraps around instead: head is where the next item comes out, and
+// the tail is head+count, modulo the capacity. It only grows when it's
+// actually full, doubling, so both operations are O(1) amortised.
+//
+// Capacities are kept at powers of two, so "modulo the capacity" is a mask.
+// The zero value is an empty queue
+type Queue[T any] struct {
+	buf   []T
+	head  int
+	count int
+}
+
+func (q *Queue[T]) Len() int { return q.count }
+
+func (q *Queue[T]) Enqueue(v T) {
+	if q.count == len(q.buf) {
+		q.grow()
+	}
+	q.buf[(q.head+q.count)&(len(q.buf)-1)] = v
+	q.count++
+}
+
+// Dequeue removes and returns the oldest item, false when the queue is empty
+func (q *Queue[T]) Dequeue() (T, bool) {
+	var zero T
+	if q.count == 0 {
+		return zero, false
+	}
+	v := q.buf[q.head]
+	q.buf[q.head] = zero // don't keep it reachable
+	q.head = (q.head + 1) & (len(q.buf) - 1)
+	q.count--
+	return v, true
+}
+
+// Peek returns the oldest item without removing it
+func (q *Queue[T]) Peek() (T, bool) {
+	if q.count == 0 {
+		var zero T
+		return zero, false
+	}
+	return q.buf[q.head], true
+}
+
+// grow doubles the buffer. The items may wrap round the end of the old
+// one, so they're copied in two parts, oldest first, to the start of the
+// new one
+func (q *Queue[T]) grow() {
+	size := 2 * len(q.buf)
+	if size == 0 {
+		size = 8
+	}
+	buf := make([]T, size)
+	n := copy(buf, q.buf[q.head:])
+	copy(buf[n:], q.buf[:q.head])
+	q.buf, q.head = buf, 0
+}
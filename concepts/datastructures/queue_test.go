@@ -0,0 +1,83 @@
+package datastructures
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	var q Queue[int]
+	_, ok := q.Dequeue()
+	assert.False(t, ok)
+
+	// interleave so the ring wraps around the end of its buffer before it
+	// has to grow, then grows while wrapped
+	next, want := 0, 0
+	for round := 0; round < 50; round++ {
+		for i := 0; i < 5; i++ {
+			q.Enqueue(next)
+			next++
+		}
+		for i := 0; i < 3; i++ {
+			v, ok := q.Dequeue()
+			assert.True(t, ok)
+			assert.Equal(t, want, v)
+			want++
+		}
+	}
+	assert.Equal(t, 100, q.Len())
+
+	head, _ := q.Peek()
+	assert.Equal(t, want, head)
+	for q.Len() > 0 {
+		v, _ := q.Dequeue()
+		assert.Equal(t, want, v)
+		want++
+	}
+	assert.Equal(t, next, want)
+}
+
+func TestQueueReusesSpace(t *testing.T) {
+	var q Queue[int]
+	for i := 0; i < 10000; i++ {
+		q.Enqueue(i)
+		q.Dequeue()
+	}
+	assert.Equal(t, 8, len(q.buf), "never more than one item at a time, never grew")
+}
+
+// The naive slice queue never reuses the front of its array, so it keeps
+// allocating even when it never holds more than a few items
+func BenchmarkQueue(b *testing.B) {
+	b.Run("ring", func(b *testing.B) {
+		b.ReportAllocs()
+		var q Queue[int]
+		for i := 0; i < b.N; i++ {
+			q.Enqueue(i)
+			q.Enqueue(i)
+			v, _ := q.Dequeue()
+			sinkInt += v
+			v, _ = q.Dequeue()
+			sinkInt += v
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		var q []int
+		for i := 0; i < b.N; i++ {
+			q = append(q, i, i)
+			sinkInt += q[0] + q[1]
+			q = q[2:]
+		}
+	})
+	b.Run("channel", func(b *testing.B) {
+		b.ReportAllocs()
+		q := make(chan int, 2)
+		for i := 0; i < b.N; i++ {
+			q <- i
+			q <- i
+			sinkInt += <-q + <-q
+		}
+	})
+}
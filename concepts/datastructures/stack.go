@@ -0,0 +1,35 @@
+package datastructures
+
+// Stack is last in, first out, on top of a slice: push appends, pop
+// truncates. Both are O(1) - amortised for push, which occasionally has to
+// grow the backing array. The zero value is an empty stack
+type Stack[T any] struct {
+	items []T
+}
+
+func (s *Stack[T]) Push(v T) { s.items = append(s.items, v) }
+
+// Pop removes and returns the top item, false when the stack is empty
+func (s *Stack[T]) Pop() (T, bool) {
+	var zero T
+	if len(s.items) == 0 {
+		return zero, false
+	}
+	v := s.items[len(s.items)-1]
+	// the slot is past the end after truncating, but the backing array still
+	// holds it - zero it so a popped pointer can be garbage collected
+	s.items[len(s.items)-1] = zero
+	s.items = s.items[:len(s.items)-1]
+	return v, true
+}
+
+// Peek returns the top item without removing it
+func (s *Stack[T]) Peek() (T, bool) {
+	if len(s.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return s.items[len(s.items)-1], true
+}
+
+func (s *Stack[T]) Len() int { return len(s.items) }
@@ -0,0 +1,75 @@
+package datastructures
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sinkInt int
+
+func TestStack(t *testing.T) {
+	var s Stack[int]
+	_, ok := s.Pop()
+	assert.False(t, ok)
+	_, ok = s.Peek()
+	assert.False(t, ok)
+
+	for i := 1; i <= 3; i++ {
+		s.Push(i)
+	}
+	top, _ := s.Peek()
+	assert.Equal(t, 3, top)
+	assert.Equal(t, 3, s.Len())
+
+	for want := 3; want >= 1; want-- {
+		v, ok := s.Pop()
+		assert.True(t, ok)
+		assert.Equal(t, want, v)
+	}
+	assert.Zero(t, s.Len())
+}
+
+func TestStackClearsPopped(t *testing.T) {
+	var s Stack[*int]
+	s.Push(new(int))
+	s.Pop()
+	assert.Nil(t, s.items[:1][0], "the backing array doesn't keep it alive")
+}
+
+// balanced is the textbook use: every closer must match the most recent
+// unmatched opener
+func balanced(s string) bool {
+	pairs := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	var open Stack[rune]
+	for _, r := range s {
+		switch r {
+		case '(', '[', '{':
+			open.Push(r)
+		case ')', ']', '}':
+			if top, ok := open.Pop(); !ok || top != pairs[r] {
+				return false
+			}
+		}
+	}
+	return open.Len() == 0
+}
+
+func TestBalanced(t *testing.T) {
+	assert.True(t, balanced("func() { return m[f(x)] }"))
+	assert.False(t, balanced("(]"))
+	assert.False(t, balanced("(("))
+	assert.False(t, balanced("}"))
+}
+
+func BenchmarkStack(b *testing.B) {
+	b.ReportAllocs()
+	var s Stack[int]
+	for i := 0; i < b.N; i++ {
+		s.Push(i)
+		if i%2 == 1 {
+			v, _ := s.Pop()
+			sinkInt += v
+		}
+	}
+}
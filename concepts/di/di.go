@@ -0,0 +1,206 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// Dependency injection sounds like it needs a framework, but in Go it's
+// mostly a habit: a piece of code is handed the things it depends on,
+// instead of reaching out for them. Concretely:
+//
+//   - constructors take dependencies as arguments. NewSignup can't be
+//     called without a user store, a mailer and a clock, so it can't be
+//     built half wired
+//   - the consumer declares the interface it needs, small, next to the code
+//     that uses it. Signup only needs two methods from a user store, so
+//     that's all UserStore has. Implementations don't mention it at all
+//   - constructors return concrete types, and callers pick the interface
+//   - one place, the composition root, decides which implementation backs
+//     each interface and builds the graph. In an app that's main - see
+//     cmd/todo. Build below plays the part here
+//
+// What that buys is tests: a fake mailer that records what was sent, or a
+// fake clock, goes in through the same constructor as the real thing.
+//
+// The alternative is a dependency fetched from a global:
+//
+//	var mailer Mailer = smtpMailer{...}
+//
+//	func Register(email string) error {
+//		...
+//		return mailer.Send(...)
+//	}
+//
+// Register's signature no longer says it sends mail, and a test has to
+// overwrite the global (and remember to put it back, and not run in
+// parallel with another test doing the same). Frameworks like wire or fx
+// generate or automate the wiring in the composition root - worth it when
+// the graph gets big, but the graph here, and in most services, fits on a
+// screen
+
+type User struct {
+	Email  string
+	Joined time.Time
+}
+
+var (
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrTaken        = errors.New("email already registered")
+)
+
+/*
+ *
+ * the consumer
+ *
+ */
+
+// UserStore is what Signup needs from storage, and no more
+type UserStore interface {
+	Add(ctx context.Context, u User) error
+	Exists(ctx context.Context, email string) (bool, error)
+}
+
+// Mailer sends an email. One method is the ideal size for an interface -
+// anything can be adapted to it, a func included
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// MailerFunc turns a function into a Mailer, the way http.HandlerFunc does
+// for handlers
+type MailerFunc func(ctx context.Context, to, subject, body string) error
+
+func (f MailerFunc) Send(ctx context.Context, to, subject, body string) error {
+	return f(ctx, to, subject, body)
+}
+
+// Signup registers users and welcomes them
+type Signup struct {
+	users UserStore
+	mail  Mailer
+	clock clock.Clock
+}
+
+func NewSignup(users UserStore, mail Mailer, clk clock.Clock) *Signup {
+	return &Signup{users: users, mail: mail, clock: clk}
+}
+
+// Register adds a user and sends the welcome mail. A mail that fails to
+// send doesn't undo the signup, but the error is still returned so the
+// caller can decide whether to retry it
+func (s *Signup) Register(ctx context.Context, email string) (User, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" {
+		return User{}, ErrInvalidEmail
+	}
+	email = strings.ToLower(addr.Address)
+
+	taken, err := s.users.Exists(ctx, email)
+	if err != nil {
+		return User{}, err
+	}
+	if taken {
+		return User{}, ErrTaken
+	}
+
+	u := User{Email: email, Joined: s.clock.Now()}
+	if err := s.users.Add(ctx, u); err != nil {
+		return User{}, err
+	}
+
+	if err := s.mail.Send(ctx, u.Email, "welcome", "thanks for signing up"); err != nil {
+		return u, fmt.Errorf("welcome mail: %w", err)
+	}
+	return u, nil
+}
+
+/*
+ *
+ * implementations
+ *
+ */
+
+// MemoryUsers is a UserStore in a map
+type MemoryUsers struct {
+	mu    sync.Mutex
+	users map[string]User
+}
+
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{users: map[string]User{}}
+}
+
+func (m *MemoryUsers) Add(ctx context.Context, u User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[u.Email]; ok {
+		return ErrTaken
+	}
+	m.users[u.Email] = u
+	return nil
+}
+
+func (m *MemoryUsers) Exists(ctx context.Context, email string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.users[email]
+	return ok, nil
+}
+
+// LogMailer "sends" mail by writing it to w - enough for local development,
+// where nobody wants real emails going out
+type LogMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w: w}
+}
+
+func (m *LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "to: %s\nsubject: %s\n\n%s\n", to, subject, body)
+	return err
+}
+
+/*
+ *
+ * the composition root
+ *
+ */
+
+// Config is what the composition root reads to decide what to build
+type Config struct {
+	MailLog io.Writer // where LogMailer writes
+}
+
+// App is the built graph - just Signup here, a real app would have its
+// handlers, server and so on
+type App struct {
+	Signup *Signup
+}
+
+// Build wires everything up. Every decision about which implementation to
+// use is made here, and only here. It would normally be in main, it's a
+// function so the test can check the wiring
+func Build(cfg Config) *App {
+	users := NewMemoryUsers()
+	mailer := NewLogMailer(cfg.MailLog)
+	return &App{
+		Signup: NewSignup(users, mailer, clock.New()),
+	}
+}
@@ -0,0 +1,107 @@
+package di
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// sentMail is what the fake mailer remembers about each send
+type sentMail struct {
+	to, subject string
+}
+
+// recordingMailer is a hand-written fake: a few lines, and the test can
+// check exactly what would have gone out
+type recordingMailer struct {
+	sent []sentMail
+	err  error
+}
+
+func (m *recordingMailer) Send(ctx context.Context, to, subject, body string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, sentMail{to, subject})
+	return nil
+}
+
+var start = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestRegister(t *testing.T) {
+	users := NewMemoryUsers()
+	mailer := &recordingMailer{}
+	s := NewSignup(users, mailer, clock.NewFake(start))
+
+	u, err := s.Register(context.Background(), "Ada@Example.com")
+	require.NoError(t, err)
+	assert.Equal(t, User{Email: "ada@example.com", Joined: start}, u)
+	assert.Equal(t, []sentMail{{"ada@example.com", "welcome"}}, mailer.sent)
+
+	_, err = s.Register(context.Background(), "ada@example.com")
+	assert.ErrorIs(t, err, ErrTaken)
+	assert.Len(t, mailer.sent, 1, "no second welcome")
+
+	for _, email := range []string{"", "ada", "Ada <ada@example.com>"} {
+		_, err = s.Register(context.Background(), email)
+		assert.ErrorIs(t, err, ErrInvalidEmail, email)
+	}
+}
+
+func TestRegisterMailFails(t *testing.T) {
+	users := NewMemoryUsers()
+	down := errors.New("smtp down")
+	s := NewSignup(users, &recordingMailer{err: down}, clock.NewFake(start))
+
+	u, err := s.Register(context.Background(), "ada@example.com")
+	assert.ErrorIs(t, err, down)
+	assert.Equal(t, "ada@example.com", u.Email)
+
+	ok, _ := users.Exists(context.Background(), "ada@example.com")
+	assert.True(t, ok, "the signup stands")
+}
+
+// failingUsers embeds the interface to satisfy it, and overrides only what
+// the test needs - calling anything else panics on the nil embedded value,
+// which is the right outcome for a call the test didn't expect
+type failingUsers struct{ UserStore }
+
+func (failingUsers) Exists(context.Context, string) (bool, error) {
+	return false, errors.New("db gone")
+}
+
+func TestRegisterStoreFails(t *testing.T) {
+	mailer := &recordingMailer{}
+	s := NewSignup(failingUsers{}, mailer, clock.NewFake(start))
+
+	_, err := s.Register(context.Background(), "ada@example.com")
+	assert.EqualError(t, err, "db gone")
+	assert.Empty(t, mailer.sent)
+}
+
+func TestMailerFunc(t *testing.T) {
+	var got string
+	s := NewSignup(NewMemoryUsers(), MailerFunc(func(ctx context.Context, to, subject, body string) error {
+		got = to
+		return nil
+	}), clock.NewFake(start))
+
+	_, err := s.Register(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", got)
+}
+
+func TestBuild(t *testing.T) {
+	var mailLog bytes.Buffer
+	app := Build(Config{MailLog: &mailLog})
+
+	_, err := app.Signup.Register(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "to: ada@example.com\nsubject: welcome\n\nthanks for signing up\n", mailLog.String())
+}
@@ -0,0 +1,277 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// An email is a block of text: headers, a blank line, a body. Anything
+// more than plain ASCII text - accented letters, an HTML version, a PDF -
+// is layered on with MIME. The body becomes a tree of parts, each with its
+// own headers, separated by a boundary string:
+//
+//	multipart/mixed                   the message and its attachments
+//	├── multipart/alternative         the same content, the client picks one
+//	│   ├── text/plain
+//	│   └── text/html                 last is preferred
+//	└── application/pdf               an attachment
+//
+// SMTP is old enough to want 7-bit lines of at most 998 bytes, so text is
+// quoted-printable encoded (readable, with =XX escapes for anything odd)
+// and attachments base64 encoded. Headers have their own encoding for
+// non-ASCII, "=?utf-8?q?...?=", which mime.QEncoding does.
+//
+// Message builds that tree from a plain struct, with the parts it doesn't
+// need left out: a text-only message is just text/plain
+
+// Message is one email. To get its raw bytes, as an SMTP server wants
+// them, use Bytes or WriteTo
+type Message struct {
+	From    string // an address, "Name <addr>" works too
+	To      []string
+	Subject string
+	Date    time.Time // now when zero
+
+	Text string // plain text body
+	HTML string // optional HTML body
+
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string // application/octet-stream when empty
+	Data        []byte
+}
+
+var errNoRecipients = errors.New("email: no recipients")
+
+// Validate checks the addresses parse, which is also what stops a newline
+// in one being used to inject extra headers
+func (m Message) Validate() error {
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return fmt.Errorf("email: from: %w", err)
+	}
+	if len(m.To) == 0 {
+		return errNoRecipients
+	}
+	for _, to := range m.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("email: to %q: %w", to, err)
+		}
+	}
+	return nil
+}
+
+// Bytes returns the message ready to send
+func (m Message) Bytes() ([]byte, error) {
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteTo writes the message, with CRLF line endings as SMTP expects
+func (m Message) WriteTo(w io.Writer) (int64, error) {
+	if err := m.Validate(); err != nil {
+		return 0, err
+	}
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("From", m.From)
+	h.Set("To", strings.Join(m.To, ", "))
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	h.Set("Date", date.Format(time.RFC1123Z))
+	h.Set("Message-Id", messageID(m.From))
+	h.Set("Mime-Version", "1.0")
+
+	var err error
+	switch {
+	case len(m.Attachments) > 0:
+		err = m.writeMixed(bw, h)
+	case m.HTML != "":
+		err = m.writeAlternative(bw, h)
+	default:
+		err = writeTextPart(bw, h, "text/plain", m.Text)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	return cw.n, err
+}
+
+// writeMixed writes the body, then each attachment
+func (m Message) writeMixed(w io.Writer, h textproto.MIMEHeader) error {
+	mw := multipart.NewWriter(w)
+	h.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	if err := writeHeader(w, h); err != nil {
+		return err
+	}
+
+	body := textproto.MIMEHeader{}
+	if m.HTML != "" {
+		// the nested boundary goes in the part's header, before there's a
+		// part to write the nested multipart.Writer to, so pick it first
+		boundary := multipart.NewWriter(io.Discard).Boundary()
+		body.Set("Content-Type", "multipart/alternative; boundary="+boundary)
+		pw, err := mw.CreatePart(body)
+		if err != nil {
+			return err
+		}
+		inner := multipart.NewWriter(pw)
+		if err := inner.SetBoundary(boundary); err != nil {
+			return err
+		}
+		if err := m.writeAlternativeParts(inner); err != nil {
+			return err
+		}
+	} else {
+		body.Set("Content-Type", `text/plain; charset="utf-8"`)
+		body.Set("Content-Transfer-Encoding", "quoted-printable")
+		pw, err := mw.CreatePart(body)
+		if err != nil {
+			return err
+		}
+		if err := writeQuotedPrintable(pw, m.Text); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range m.Attachments {
+		if err := writeAttachment(mw, a); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (m Message) writeAlternative(w io.Writer, h textproto.MIMEHeader) error {
+	mw := multipart.NewWriter(w)
+	h.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	if err := writeHeader(w, h); err != nil {
+		return err
+	}
+	return m.writeAlternativeParts(mw)
+}
+
+// writeAlternativeParts writes text then HTML, and closes mw. Clients show
+// the last alternative they understand, so the richest goes last
+func (m Message) writeAlternativeParts(mw *multipart.Writer) error {
+	for _, p := range []struct{ contentType, body string }{
+		{"text/plain", m.Text},
+		{"text/html", m.HTML},
+	} {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", p.contentType+`; charset="utf-8"`)
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		pw, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if err := writeQuotedPrintable(pw, p.body); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func writeTextPart(w io.Writer, h textproto.MIMEHeader, contentType, body string) error {
+	h.Set("Content-Type", contentType+`; charset="utf-8"`)
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	if err := writeHeader(w, h); err != nil {
+		return err
+	}
+	return writeQuotedPrintable(w, body)
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qw, s); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+func writeAttachment(mw *multipart.Writer, a Attachment) error {
+	ct := a.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", ct)
+	h.Set("Content-Transfer-Encoding", "base64")
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	pw, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	// base64 in lines of 76, the MIME limit
+	enc := base64.StdEncoding.EncodeToString(a.Data)
+	for len(enc) > 0 {
+		n := min(76, len(enc))
+		if _, err := io.WriteString(pw, enc[:n]+"\r\n"); err != nil {
+			return err
+		}
+		enc = enc[n:]
+	}
+	return nil
+}
+
+// writeHeader writes the top-level headers in a fixed order, so messages
+// are easy to read and to compare
+func writeHeader(w io.Writer, h textproto.MIMEHeader) error {
+	for _, k := range []string{"From", "To", "Subject", "Date", "Message-Id", "Mime-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if v := h.Get(k); v != "" {
+			if _, err := fmt.Fprintf(w, "%s: %s\r\n", k, v); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+// messageID makes a unique id at the sender's domain
+func messageID(from string) string {
+	domain := "localhost"
+	if a, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(a.Address, "@"); ok {
+			domain = d
+		}
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return "<" + hex.EncodeToString(b[:]) + "@" + domain + ">"
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,143 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sent = time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+
+// parse reads a message back the way a mail client would
+func parse(t *testing.T, m Message) *mail.Message {
+	t.Helper()
+	raw, err := m.Bytes()
+	require.NoError(t, err)
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998, "SMTP line limit")
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	return msg
+}
+
+// part is a leaf of the MIME tree, decoded
+type part struct {
+	contentType string
+	filename    string
+	body        string
+}
+
+// walk flattens the MIME tree. multipart.Reader undoes quoted-printable by
+// itself, base64 it leaves alone
+func walk(t *testing.T, contentType string, body io.Reader) []part {
+	t.Helper()
+	mt, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	if !strings.HasPrefix(mt, "multipart/") {
+		b, err := io.ReadAll(body)
+		require.NoError(t, err)
+		return []part{{contentType: mt, body: string(b)}}
+	}
+
+	var parts []part
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		require.NoError(t, err)
+
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			b, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+			require.NoError(t, err)
+			pmt, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+			parts = append(parts, part{contentType: pmt, filename: p.FileName(), body: string(b)})
+			continue
+		}
+		parts = append(parts, walk(t, p.Header.Get("Content-Type"), p)...)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	msg := parse(t, Message{
+		From:    "Todo <todo@example.com>",
+		To:      []string{"ada@example.com"},
+		Subject: "Café ☕",
+		Date:    sent,
+		Text:    "naïve résumé, and a line that is rather long so that quoted-printable has to wrap it somewhere sensible",
+	})
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Café ☕", subject)
+	assert.Equal(t, "Fri, 01 Mar 2024 09:30:00 +0000", msg.Header.Get("Date"))
+	assert.True(t, strings.HasSuffix(msg.Header.Get("Message-Id"), "@example.com>"))
+
+	parts := walk(t, msg.Header.Get("Content-Type"), msg.Body)
+	require.Len(t, parts, 1)
+	assert.Equal(t, "text/plain", parts[0].contentType)
+	// a lone part isn't read through a multipart.Reader, so it's still
+	// quoted-printable
+	assert.Contains(t, parts[0].body, "na=C3=AFve")
+}
+
+func TestAlternative(t *testing.T) {
+	msg := parse(t, Message{
+		From: "todo@example.com", To: []string{"ada@example.com"}, Date: sent,
+		Text: "hello", HTML: "<p>hello</p>",
+	})
+
+	assert.Equal(t, []part{
+		{contentType: "text/plain", body: "hello"},
+		{contentType: "text/html", body: "<p>hello</p>"},
+	}, walk(t, msg.Header.Get("Content-Type"), msg.Body))
+}
+
+func TestAttachments(t *testing.T) {
+	pdf := bytes.Repeat([]byte("%PDF-1.7 binary\x00\xff"), 50)
+	msg := parse(t, Message{
+		From: "todo@example.com", To: []string{"ada@example.com", "bob@example.com"}, Date: sent,
+		Text: "attached", HTML: "<b>attached</b>",
+		Attachments: []Attachment{
+			{Filename: "report 1.pdf", ContentType: "application/pdf", Data: pdf},
+			{Filename: "notes", Data: []byte("x")},
+		},
+	})
+
+	assert.Equal(t, "ada@example.com, bob@example.com", msg.Header.Get("To"))
+	assert.Equal(t, []part{
+		{contentType: "text/plain", body: "attached"},
+		{contentType: "text/html", body: "<b>attached</b>"},
+		{contentType: "application/pdf", filename: "report 1.pdf", body: string(pdf)},
+		{contentType: "application/octet-stream", filename: "notes", body: "x"},
+	}, walk(t, msg.Header.Get("Content-Type"), msg.Body))
+}
+
+func TestValidate(t *testing.T) {
+	ok := Message{From: "a@example.com", To: []string{"b@example.com"}}
+	require.NoError(t, ok.Validate())
+
+	for name, m := range map[string]Message{
+		"no recipients":    {From: "a@example.com"},
+		"bad from":         {From: "nope", To: []string{"b@example.com"}},
+		"header injection": {From: "a@example.com", To: []string{"b@example.com\r\nBcc: everyone@example.com"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, m.Validate())
+			_, err := m.Bytes()
+			assert.Error(t, err)
+		})
+	}
+}
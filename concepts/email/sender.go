@@ -0,0 +1,144 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sync"
+)
+
+// Sender sends messages. Code that sends mail depends on this rather than
+// on SMTP, so tests use a Recorder and nothing leaves the machine
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+/*
+ *
+ * SMTP
+ *
+ */
+
+// SMTPSender sends through an SMTP server with net/smtp. The package is
+// frozen - it works, but won't grow features - which is fine for talking to
+// a relay or a provider's submission port.
+//
+// smtp.SendMail takes no context, so Send dials itself and puts a deadline
+// on the connection from ctx. Everything after that is the same protocol
+// SendMail speaks
+type SMTPSender struct {
+	Addr string    // host:port, usually port 587
+	Auth smtp.Auth // nil for none, smtp.PlainAuth for most providers
+
+	// TLSConfig is used for STARTTLS, which is done whenever the server
+	// offers it. PlainAuth refuses to send a password without it, except
+	// to localhost
+	TLSConfig *tls.Config
+}
+
+func (s *SMTPSender) Send(ctx context.Context, m Message) error {
+	msg, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(s.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		cfg := s.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: host}
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return err
+		}
+	}
+	if s.Auth != nil {
+		if err := c.Auth(s.Auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := c.Rcpt(addr.Address); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+/*
+ *
+ * the fake
+ *
+ */
+
+// Recorder is a Sender that keeps what it's given, for tests. Err, when
+// set, is returned instead
+type Recorder struct {
+	mu   sync.Mutex
+	sent []Message
+	Err  error
+}
+
+func (r *Recorder) Send(ctx context.Context, m Message) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Err != nil {
+		return r.Err
+	}
+	r.sent = append(r.sent, m)
+	return nil
+}
+
+// Sent returns the messages sent so far
+func (r *Recorder) Sent() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Message(nil), r.sent...)
+}
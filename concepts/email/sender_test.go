@@ -0,0 +1,122 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpServer speaks just enough SMTP to take one message, and remembers
+// what it was given
+type smtpServer struct {
+	addr string
+	got  chan received
+}
+
+type received struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	s := &smtpServer{addr: l.Addr().String(), got: make(chan received, 1)}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(c *textproto.Conn) {
+	var r received
+	c.PrintfLine("220 localhost test server")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			c.PrintfLine("250 localhost")
+		case "MAIL":
+			r.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			c.PrintfLine("250 ok")
+		case "RCPT":
+			r.to = append(r.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			c.PrintfLine("250 ok")
+		case "DATA":
+			c.PrintfLine("354 go ahead")
+			b, _ := io.ReadAll(c.DotReader())
+			r.data = string(b)
+			c.PrintfLine("250 queued")
+			s.got <- r
+		case "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	srv := newSMTPServer(t)
+	s := &SMTPSender{Addr: srv.addr}
+
+	err := s.Send(context.Background(), Message{
+		From:    "Todo <todo@example.com>",
+		To:      []string{"Ada <ada@example.com>", "bob@example.com"},
+		Subject: "hello",
+		Text:    "hi there\n.\nA line with just a dot survives",
+	})
+	require.NoError(t, err)
+
+	r := <-srv.got
+	assert.Equal(t, "todo@example.com", r.from)
+	assert.Equal(t, []string{"ada@example.com", "bob@example.com"}, r.to)
+	assert.Contains(t, r.data, "Subject: hello\n")
+	// the DATA dot-stuffing round trips
+	assert.Contains(t, r.data, "\n.\n")
+}
+
+func TestSMTPSenderUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	s := &SMTPSender{Addr: addr}
+	err = s.Send(context.Background(), Message{From: "a@example.com", To: []string{"b@example.com"}})
+	assert.Error(t, err)
+}
+
+func TestRecorder(t *testing.T) {
+	var r Recorder
+	m := Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "one"}
+	require.NoError(t, r.Send(context.Background(), m))
+	assert.Equal(t, []Message{m}, r.Sent())
+
+	assert.Error(t, r.Send(context.Background(), Message{}), "invalid messages are rejected, as a real sender would")
+
+	r.Err = errors.New("relay down")
+	assert.ErrorIs(t, r.Send(context.Background(), m), r.Err)
+	assert.Len(t, r.Sent(), 1)
+}
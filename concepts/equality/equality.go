@@ -0,0 +1,256 @@
+package equality
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// "Are these equal?" has at least four answers in Go, and they disagree:
+//
+//   - == is built in and fast, but only for comparable types, and it means
+//     "the same bits" for pointers and floats in ways that surprise
+//   - reflect.DeepEqual goes inside slices, maps and pointers, but is
+//     strict about things nobody cares about - nil against empty, a
+//     time.Time's location - and lenient about nothing
+//   - github.com/google/go-cmp is DeepEqual made configurable, for tests:
+//     tell it what to ignore and how close is close enough, and it says
+//     what differs, not just that something does
+//   - an Equal method is the type saying what equality means for it, and
+//     go-cmp uses it when there is one
+//
+// The rule of thumb: == for comparable values, slices.Equal and maps.Equal
+// for one level of collection, an Equal method when the type has opinions,
+// and go-cmp in tests. reflect.DeepEqual is rarely the right answer
+
+/*
+ *
+ * ==
+ *
+ */
+
+// point is comparable: every field is, so == compares them one by one
+type point struct{ X, Y int }
+
+// A struct with a slice, map or func field isn't comparable. p == q won't
+// compile - but put them in interfaces and it does, and panics when it runs.
+// The same goes for using one as a map key through an interface
+type path struct {
+	Name   string
+	Points []point
+}
+
+// equalAny is == on interfaces, with the panic turned into an error
+func equalAny(a, b any) (eq bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return a == b, nil
+}
+
+// Pointers are equal when they point at the same thing, not at equal
+// things. Two &point{1, 2} are two different points
+func samePointer() (samePlace, sameValue bool) {
+	a, b := &point{1, 2}, &point{1, 2}
+	return a == b, *a == *b
+}
+
+// Floats follow IEEE 754, not intuition:
+//
+//   - NaN isn't equal to anything, itself included. A struct holding a NaN
+//     isn't == to itself either, and a NaN map key can be added over and
+//     over and never found
+//   - +0 and -0 are equal, though they print differently and 1/x tells them
+//     apart
+//   - 0.1 + 0.2 isn't 0.3, because none of the three is exact in binary.
+//     Compare within a tolerance instead
+type reading struct {
+	Sensor string
+	Value  float64
+}
+
+func nanNotSelf() bool {
+	r := reading{"t1", math.NaN()}
+	return r == r
+}
+
+func nanMapKeys() (size int, found bool) {
+	m := map[float64]int{}
+	for i := 0; i < 3; i++ {
+		m[math.NaN()]++
+	}
+	_, found = m[math.NaN()]
+	return len(m), found
+}
+
+func signedZero() (equal bool, inverses string) {
+	pos, neg := 0.0, math.Copysign(0, -1)
+	return pos == neg, fmt.Sprint(1/pos, " ", 1/neg)
+}
+
+// approxEqual is |a-b| within an absolute tolerance near zero, or a
+// relative one for big numbers, where the gaps between floats are wider
+// than any fixed tolerance
+func approxEqual(a, b, tolerance float64) bool {
+	if a == b {
+		return true // infinities, and it's quick
+	}
+	diff := math.Abs(a - b)
+	return diff <= tolerance || diff <= tolerance*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// time.Time is comparable, and == is still wrong for it: it compares the
+// wall clock, the monotonic reading and the location pointer, so the same
+// instant in two time zones - or one with a monotonic reading and one
+// without - isn't ==. Equal compares instants
+func sameInstant() (eq, equal bool) {
+	utc := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	berlin := utc.In(time.FixedZone("CEST", 2*60*60))
+	return utc == berlin, utc.Equal(berlin)
+}
+
+/*
+ *
+ * reflect.DeepEqual
+ *
+ */
+
+// DeepEqual follows pointers, and compares slices and maps element by
+// element. Its gotchas are where it's stricter than you'd be:
+//
+//   - a nil slice isn't equal to an empty one, nor a nil map to an empty
+//     map - though len, range and JSON's omitempty treat them the same
+//   - unexported fields count, so two time.Times for the same instant in
+//     different locations are unequal, deep inside a struct where the
+//     failure is hard to read
+//   - NaN is unequal to itself here too - unless it's the very same slice,
+//     which DeepEqual doesn't look inside
+//   - funcs are only equal if both are nil
+//   - it says false, and nothing about where
+//
+// slices.Equal and maps.Equal (Go 1.21) are one level deep and call nil
+// and empty equal, which is usually what's meant
+func deepEqualNilEmpty() (nilVsEmptySlice, nilVsEmptyMap bool) {
+	var nilSlice []int
+	var nilMap map[string]int
+	return reflect.DeepEqual(nilSlice, []int{}), reflect.DeepEqual(nilMap, map[string]int{})
+}
+
+type event struct {
+	Name string
+	At   time.Time
+}
+
+func deepEqualTime() bool {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return reflect.DeepEqual(event{"deploy", at}, event{"deploy", at.Local()})
+}
+
+func deepEqualNaN() (sameSlice, copied bool) {
+	s := []float64{math.NaN()}
+	return reflect.DeepEqual(s, s), reflect.DeepEqual(s, []float64{math.NaN()})
+}
+
+func deepEqualFuncs() bool {
+	f := func() {}
+	return reflect.DeepEqual(f, f)
+}
+
+/*
+ *
+ * go-cmp
+ *
+ */
+
+// cmp.Equal is DeepEqual with options, and cmp.Diff says what differs. It
+// has its own opinions too: it panics on a struct with unexported fields
+// rather than quietly compare them, so you have to choose - AllowUnexported
+// to look inside, cmpopts.IgnoreUnexported to skip them, or an Equal method
+// on the type. And it calls a type's Equal method when there is one, which
+// is how time.Time comes out right without any option at all
+
+// account has an unexported field, which go-cmp won't touch unasked
+type account struct {
+	ID        string
+	Balance   float64
+	Tags      []string
+	UpdatedAt time.Time
+	version   int
+}
+
+// cmpUnexported reports what cmp.Equal does with account as it is
+func cmpUnexported(a, b account) (eq bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return cmp.Equal(a, b), nil
+}
+
+// accountOpts is how a test would compare accounts: version is a detail of
+// the storage layer, UpdatedAt changes on every save, balances are close
+// enough within a hundredth of a cent, and no tags is no tags whether the
+// slice is nil or empty
+var accountOpts = cmp.Options{
+	cmpopts.IgnoreUnexported(account{}),
+	cmpopts.IgnoreFields(account{}, "UpdatedAt"),
+	cmpopts.EquateApprox(0, 0.0001),
+	cmpopts.EquateEmpty(),
+}
+
+// Two more worth knowing: cmpopts.EquateNaNs, since EquateApprox leaves NaN
+// unequal like == does, and SortSlices, for when order doesn't matter. It
+// sorts copies, the values compared are left as they were
+var unorderedTags = cmpopts.SortSlices(func(a, b string) bool { return a < b })
+
+/*
+ *
+ * Equal methods
+ *
+ */
+
+// measurement says for itself what equal means: the same sensor and
+// instant, values within a thousandth, the same labels in any order. Its
+// cache is nobody's business.
+//
+// The method takes the type itself, not an interface, and has a value
+// receiver - that's the shape go-cmp looks for, and it then uses it for
+// measurements anywhere: in slices, in maps, in fields of other structs
+type measurement struct {
+	Sensor string
+	At     time.Time
+	Value  float64
+	Labels []string
+
+	cache map[string]string
+}
+
+func (m measurement) Equal(o measurement) bool {
+	if m.Sensor != o.Sensor || !m.At.Equal(o.At) || !approxEqual(m.Value, o.Value, 0.001) {
+		return false
+	}
+	if len(m.Labels) != len(o.Labels) {
+		return false
+	}
+	a, b := sortedCopy(m.Labels), sortedCopy(o.Labels)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedCopy(s []string) []string {
+	c := append([]string(nil), s...)
+	sort.Strings(c)
+	return c
+}
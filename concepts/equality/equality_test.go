@@ -0,0 +1,191 @@
+package equality
+
+import (
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComparableStructs(t *testing.T) {
+	assert.True(t, point{1, 2} == point{1, 2})
+	assert.True(t, map[point]string{{1, 2}: "a"}[point{1, 2}] == "a", "comparable, so a fine map key")
+
+	eq, err := equalAny(point{1, 2}, point{1, 2})
+	require.NoError(t, err)
+	assert.True(t, eq)
+
+	eq, err = equalAny(point{1, 2}, "not a point")
+	require.NoError(t, err)
+	assert.False(t, eq, "different dynamic types are just unequal")
+
+	// path has a slice in it: fine to compile through any, a panic to run
+	_, err = equalAny(path{Name: "a"}, path{Name: "a"})
+	assert.ErrorContains(t, err, "comparing uncomparable type")
+
+	samePlace, sameValue := samePointer()
+	assert.False(t, samePlace)
+	assert.True(t, sameValue)
+}
+
+func TestFloats(t *testing.T) {
+	assert.False(t, nanNotSelf(), "a NaN field makes a struct unequal to itself")
+
+	size, found := nanMapKeys()
+	assert.Equal(t, 3, size, "three NaN keys, each a new entry")
+	assert.False(t, found)
+
+	equal, inverses := signedZero()
+	assert.True(t, equal)
+	assert.Equal(t, "+Inf -Inf", inverses)
+
+	// as constants 0.1+0.2 == 0.3 is true: constant arithmetic is exact.
+	// It's float64 variables that round
+	a, b := 0.1, 0.2
+	assert.False(t, a+b == 0.3)
+	assert.True(t, approxEqual(a+b, 0.3, 1e-9))
+	assert.True(t, approxEqual(1e20, 1e20+1e5, 1e-9), "relative for big numbers: 1e5 is a rounding error at 1e20")
+	assert.False(t, approxEqual(1, 1.1, 1e-9))
+	assert.True(t, approxEqual(math.Inf(1), math.Inf(1), 1e-9))
+	assert.False(t, approxEqual(math.NaN(), math.NaN(), 1e-9))
+}
+
+func TestTimeEquality(t *testing.T) {
+	eq, equal := sameInstant()
+	assert.False(t, eq, "== sees two locations")
+	assert.True(t, equal, "Equal sees one instant")
+
+	// the monotonic reading counts for == too: Round(0) strips it
+	now := time.Now()
+	assert.False(t, now == now.Round(0))
+	assert.True(t, now.Equal(now.Round(0)))
+}
+
+func TestDeepEqualGotchas(t *testing.T) {
+	nilVsEmptySlice, nilVsEmptyMap := deepEqualNilEmpty()
+	assert.False(t, nilVsEmptySlice)
+	assert.False(t, nilVsEmptyMap)
+
+	// slices.Equal and maps.Equal go by length and elements, so they don't
+	// mind. testify's assert.Equal is DeepEqual underneath, so it does
+	var nilSlice []int
+	var nilMap map[string]int
+	assert.True(t, slices.Equal(nilSlice, []int{}))
+	assert.True(t, maps.Equal(nilMap, map[string]int{}))
+	assert.False(t, assert.ObjectsAreEqual(nilSlice, []int{}))
+
+	assert.False(t, deepEqualTime(), "the same instant, but a different *Location inside")
+
+	sameSlice, copied := deepEqualNaN()
+	assert.True(t, sameSlice, "the same backing array is equal without looking")
+	assert.False(t, copied)
+
+	assert.False(t, deepEqualFuncs(), "not even a func with itself")
+	assert.True(t, reflect.DeepEqual((func())(nil), (func())(nil)))
+
+	// the classic: a nil *T in an error isn't a nil error
+	var p *point
+	var a any = p
+	assert.False(t, a == nil)
+	assert.False(t, reflect.DeepEqual(a, nil))
+}
+
+func testAccounts() (account, account) {
+	a := account{
+		ID:        "acc-1",
+		Balance:   100.10,
+		UpdatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		version:   3,
+	}
+	b := a
+	b.Balance = 100.00000001 + 0.1 // float noise from some arithmetic
+	b.Tags = []string{}
+	b.UpdatedAt = b.UpdatedAt.Add(time.Minute)
+	b.version = 4
+	return a, b
+}
+
+func TestCmpOptions(t *testing.T) {
+	a, b := testAccounts()
+
+	_, err := cmpUnexported(a, b)
+	assert.ErrorContains(t, err, "cannot handle unexported field", "go-cmp makes you choose")
+
+	assert.False(t, reflect.DeepEqual(a, b))
+	assert.True(t, cmp.Equal(a, b, accountOpts...), cmp.Diff(a, b, accountOpts...))
+
+	// each option takes away one difference; without any one of them
+	// they're unequal again
+	for i := 1; i < len(accountOpts); i++ {
+		fewer := append(cmp.Options{accountOpts[0]}, accountOpts[1:i]...)
+		fewer = append(fewer, accountOpts[i+1:]...)
+		assert.False(t, cmp.Equal(a, b, fewer...), "without option %d", i)
+	}
+
+	// looking inside instead of ignoring: now version differs
+	withVersion := cmp.Options{cmp.AllowUnexported(account{}), accountOpts[1], accountOpts[2], accountOpts[3]}
+	assert.False(t, cmp.Equal(a, b, withVersion...))
+	b.version = a.version
+	assert.True(t, cmp.Equal(a, b, withVersion...))
+}
+
+func TestCmpDiff(t *testing.T) {
+	a, b := testAccounts()
+	b.ID = "acc-2"
+
+	// Diff names the field and both sides, where DeepEqual only says
+	// false. go-cmp keeps the exact layout unstable on purpose - it even
+	// swaps in non-breaking spaces at random - so only the gist is checked
+	diff := cmp.Diff(a, b, accountOpts...)
+	assert.Regexp(t, `-.*ID:.*"acc-1"`, diff)
+	assert.Regexp(t, `\+.*ID:.*"acc-2"`, diff)
+	assert.NotContains(t, diff, "UpdatedAt", "ignored fields aren't named")
+	assert.Contains(t, diff, "2 ignored fields")
+
+	assert.Empty(t, cmp.Diff(a, a, accountOpts...))
+}
+
+func TestCmpFloatsAndSlices(t *testing.T) {
+	nan := []float64{1, math.NaN()}
+	assert.False(t, cmp.Equal(nan, []float64{1, math.NaN()}))
+	assert.True(t, cmp.Equal(nan, []float64{1, math.NaN()}, cmpopts.EquateNaNs()))
+
+	x, y := []string{"b", "a"}, []string{"a", "b"}
+	assert.False(t, cmp.Equal(x, y))
+	assert.True(t, cmp.Equal(x, y, unorderedTags))
+	assert.Equal(t, []string{"b", "a"}, x, "SortSlices sorts copies")
+
+	// time.Time has an Equal method, so go-cmp gets it right with no
+	// options, where DeepEqual didn't
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.True(t, cmp.Equal(event{"deploy", at}, event{"deploy", at.Local()}))
+}
+
+func TestEqualMethod(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m := measurement{Sensor: "t1", At: at, Value: 21.5, Labels: []string{"lab", "north"}, cache: map[string]string{"k": "v"}}
+	o := measurement{Sensor: "t1", At: at.Local(), Value: 21.5004, Labels: []string{"north", "lab"}}
+
+	assert.True(t, m.Equal(o))
+	assert.False(t, reflect.DeepEqual(m, o), "DeepEqual doesn't know about Equal methods")
+
+	// go-cmp finds the method, unexported cache and all, and uses it at
+	// every level
+	assert.True(t, cmp.Equal(m, o))
+	assert.True(t, cmp.Equal([]measurement{m}, []measurement{o}))
+	assert.True(t, cmp.Equal(map[string]measurement{"a": m}, map[string]measurement{"a": o}))
+
+	o.Value = 22
+	assert.False(t, m.Equal(o))
+	assert.NotEmpty(t, cmp.Diff(m, o))
+
+	o.Value, o.Labels = m.Value, []string{"lab"}
+	assert.False(t, m.Equal(o))
+}
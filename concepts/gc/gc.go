@@ -0,0 +1,182 @@
+package gc
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Go decides for you whether a value lives on the stack or the heap. Stack
+// allocation is nearly free and gone when the function returns, heap
+// allocation costs more up front and leaves work for the garbage collector.
+// The compiler's escape analysis puts a value on the heap when it can't prove
+// it doesn't outlive the function - to see its reasoning:
+//
+//	go build -gcflags=-m ./concepts/gc
+//
+// testing.AllocsPerRun counts heap allocations, which is how the tests below
+// check each claim
+
+type point struct {
+	X, Y int
+}
+
+/*
+ *
+ * stack vs heap
+ *
+ */
+
+// sumPoints never lets p leave the function, so it stays on the stack: 0 allocations
+func sumPoints() int {
+	p := point{1, 2}
+	q := &p // taking the address doesn't make it escape by itself
+	return q.X + q.Y
+}
+
+// newPoint returns a pointer, so p must outlive the call: 1 allocation.
+// noinline stops the compiler inlining it into the caller, where it might be
+// able to keep p on the caller's stack after all
+//
+//go:noinline
+func newPoint(x, y int) *point {
+	p := point{x, y}
+	return &p
+}
+
+// Storing a value in an interface usually escapes it too - the compiler can't
+// see what the code holding the interface will do with it
+//
+//go:noinline
+func boxed(n int) interface{} {
+	return n
+}
+
+/*
+ *
+ * growing vs preallocating
+ *
+ */
+
+// appendGrow starts with an empty slice. Every time it fills up append
+// allocates a bigger array (about double) and copies everything across
+func appendGrow(n int) []int {
+	var s []int
+	for i := 0; i < n; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+// appendPrealloc knows the final size, so one allocation does it
+func appendPrealloc(n int) []int {
+	s := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+// Maps grow the same way, and the size hint to make works the same
+func mapGrow(n int) map[int]int {
+	m := map[int]int{}
+	for i := 0; i < n; i++ {
+		m[i] = i
+	}
+	return m
+}
+
+func mapPrealloc(n int) map[int]int {
+	m := make(map[int]int, n)
+	for i := 0; i < n; i++ {
+		m[i] = i
+	}
+	return m
+}
+
+/*
+ *
+ * watching the GC
+ *
+ */
+
+// memSnapshot is the handful of runtime.MemStats fields worth watching.
+// ReadMemStats briefly stops the world, so don't call it in a hot loop
+type memSnapshot struct {
+	HeapAlloc    uint64        // bytes of live (and not yet collected) heap objects
+	TotalAlloc   uint64        // bytes ever allocated, it only goes up
+	Mallocs      uint64        // heap objects ever allocated
+	NumGC        uint32        // completed GC cycles
+	PauseTotal   time.Duration // total stop-the-world pause time
+	NextGCTarget uint64        // heap size the next GC will start at
+}
+
+func readMemSnapshot() memSnapshot {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	return memSnapshot{
+		HeapAlloc:    ms.HeapAlloc,
+		TotalAlloc:   ms.TotalAlloc,
+		Mallocs:      ms.Mallocs,
+		NumGC:        ms.NumGC,
+		PauseTotal:   time.Duration(ms.PauseTotalNs),
+		NextGCTarget: ms.NextGC,
+	}
+}
+
+// since returns what changed between two snapshots
+func (after memSnapshot) since(before memSnapshot) memSnapshot {
+	return memSnapshot{
+		HeapAlloc:    after.HeapAlloc,
+		TotalAlloc:   after.TotalAlloc - before.TotalAlloc,
+		Mallocs:      after.Mallocs - before.Mallocs,
+		NumGC:        after.NumGC - before.NumGC,
+		PauseTotal:   after.PauseTotal - before.PauseTotal,
+		NextGCTarget: after.NextGCTarget,
+	}
+}
+
+// GOGC sets how much the heap may grow over the live heap before the next
+// collection: 100 (the default) lets it double, 50 collects sooner and more
+// often, -1 turns collection off. GOMEMLIMIT (Go 1.19) is a soft cap on total
+// memory - as it gets close the GC runs as often as it needs to, whatever GOGC
+// says. GOGC=off with a GOMEMLIMIT means "don't collect until you have to".
+//
+// Both can be set as environment variables, or from code with runtime/debug,
+// which is what gcExperiment does. It runs work with the given settings,
+// restores the old ones, and reports what the GC did meanwhile
+type gcSettings struct {
+	GCPercent   int   // -1 is off
+	MemoryLimit int64 // bytes, math.MaxInt64 is no limit
+}
+
+var defaultGCSettings = gcSettings{GCPercent: 100, MemoryLimit: math.MaxInt64}
+
+func gcExperiment(s gcSettings, work func()) memSnapshot {
+	oldPercent := debug.SetGCPercent(s.GCPercent)
+	oldLimit := debug.SetMemoryLimit(s.MemoryLimit)
+	defer func() {
+		debug.SetGCPercent(oldPercent)
+		debug.SetMemoryLimit(oldLimit)
+	}()
+
+	// start from a clean heap so runs are comparable
+	runtime.GC()
+	before := readMemSnapshot()
+	work()
+	return readMemSnapshot().since(before)
+}
+
+// churn allocates lots of short-lived garbage while keeping a small working
+// set alive - the shape of a typical request handler
+func churn() {
+	keep := make([][]byte, 64)
+	for i := 0; i < 20000; i++ {
+		b := make([]byte, 4096)
+		b[0] = byte(i)
+		keep[i%len(keep)] = b
+	}
+	runtime.KeepAlive(keep)
+}
@@ -0,0 +1,107 @@
+package gc
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	sinkInt   int
+	sinkPoint *point
+	sinkIface interface{}
+	sinkSlice []int
+	sinkMap   map[int]int
+)
+
+func TestStackAndHeap(t *testing.T) {
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { sinkInt = sumPoints() }))
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() { sinkPoint = newPoint(1, 2) }))
+
+	// small integers are a special case, the runtime has them preallocated
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { sinkIface = boxed(7) }))
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() { sinkIface = boxed(1 << 20) }))
+}
+
+func TestPreallocation(t *testing.T) {
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() { sinkSlice = appendPrealloc(1000) }))
+	assert.Greater(t, testing.AllocsPerRun(100, func() { sinkSlice = appendGrow(1000) }), 5.0)
+
+	assert.Equal(t, appendGrow(100), appendPrealloc(100))
+
+	grow := testing.AllocsPerRun(20, func() { sinkMap = mapGrow(1000) })
+	prealloc := testing.AllocsPerRun(20, func() { sinkMap = mapPrealloc(1000) })
+	assert.Less(t, prealloc, grow)
+}
+
+func TestMemSnapshot(t *testing.T) {
+	before := readMemSnapshot()
+	sinkSlice = make([]int, 1<<20)
+	d := readMemSnapshot().since(before)
+
+	assert.GreaterOrEqual(t, d.TotalAlloc, uint64(8<<20))
+	assert.GreaterOrEqual(t, d.Mallocs, uint64(1))
+}
+
+func TestGCExperiment(t *testing.T) {
+	normal := gcExperiment(defaultGCSettings, churn)
+	off := gcExperiment(gcSettings{GCPercent: -1, MemoryLimit: math.MaxInt64}, churn)
+
+	assert.Greater(t, normal.NumGC, uint32(0))
+	assert.Equal(t, uint32(0), off.NumGC)
+
+	// a tight memory limit forces collections even with GOGC off
+	limited := gcExperiment(gcSettings{GCPercent: -1, MemoryLimit: 16 << 20}, churn)
+	assert.Greater(t, limited.NumGC, uint32(0))
+}
+
+func BenchmarkAppend(b *testing.B) {
+	b.Run("grow", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkSlice = appendGrow(10000)
+		}
+	})
+	b.Run("prealloc", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkSlice = appendPrealloc(10000)
+		}
+	})
+}
+
+func BenchmarkMap(b *testing.B) {
+	b.Run("grow", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkMap = mapGrow(10000)
+		}
+	})
+	b.Run("prealloc", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkMap = mapPrealloc(10000)
+		}
+	})
+}
+
+// go test -bench GOGC ./concepts/gc shows the tradeoff: fewer collections
+// (gcs/op) in exchange for a bigger heap
+func BenchmarkGOGC(b *testing.B) {
+	for _, percent := range []int{25, 100, 400, -1} {
+		s := gcSettings{GCPercent: percent, MemoryLimit: math.MaxInt64}
+		if percent == -1 {
+			s.MemoryLimit = 64 << 20
+		}
+
+		b.Run(fmt.Sprintf("GOGC=%d", percent), func(b *testing.B) {
+			var gcs uint32
+			for i := 0; i < b.N; i++ {
+				gcs += gcExperiment(s, churn).NumGC
+			}
+			b.ReportMetric(float64(gcs)/float64(b.N), "gcs/op")
+		})
+	}
+}
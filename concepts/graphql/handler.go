@@ -0,0 +1,75 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/thorntonmc/go-practice/apps/todo"
+)
+
+// ViewerHeader names the user making the request. A real API would get it
+// from a verified session or token; trusting a header keeps the example
+// about getting the value to the resolvers, not about auth
+const ViewerHeader = "X-User"
+
+// maxBodyBytes caps request bodies. Queries are small, and MaxDepth below
+// stops a small query asking for a huge response
+const maxBodyBytes = 64 << 10
+
+type ctxKey int
+
+const (
+	viewerKey ctxKey = iota
+	loaderKey
+)
+
+func WithViewer(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, viewerKey, id)
+}
+
+// ViewerFrom returns who's making the request, if anyone said
+func ViewerFrom(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(viewerKey).(string)
+	return id, ok && id != ""
+}
+
+func withLoader(ctx context.Context, l *Loader[string, User]) context.Context {
+	return context.WithValue(ctx, loaderKey, l)
+}
+
+// loaderFrom panics if there's no loader, since that means the schema was
+// run without going through NewHandler
+func loaderFrom(ctx context.Context) *Loader[string, User] {
+	return ctx.Value(loaderKey).(*Loader[string, User])
+}
+
+// NewHandler serves the schema over HTTP: a POST of
+// {"query": ..., "variables": ...} gets {"data": ..., "errors": ...} back.
+//
+// The schema and root resolver are built once. What belongs to one request
+// is put in its context on the way in - the viewer, and a fresh Loader so
+// batching and memoising never cross requests
+func NewHandler(repo todo.TodoRepository, users UserStore) http.Handler {
+	root := &resolver{repo: repo, users: users, assignees: make(map[int64]string)}
+	schema := graphqlgo.MustParseSchema(Schema, root, graphqlgo.MaxDepth(8))
+	h := &relay.Handler{Schema: schema}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+		ctx := r.Context()
+		if v := r.Header.Get(ViewerHeader); v != "" {
+			ctx = WithViewer(ctx, v)
+		}
+		ctx = withLoader(ctx, NewLoader(users.Users, 2*time.Millisecond, 100))
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,168 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/apps/todo"
+)
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+		Path    []any  `json:"path"`
+	} `json:"errors"`
+}
+
+// post sends a query the way a client would, as viewer if it isn't empty
+func post(t *testing.T, srv *httptest.Server, viewer, query string, vars map[string]any) response {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if viewer != "" {
+		req.Header.Set(ViewerHeader, viewer)
+	}
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var out response
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	return out
+}
+
+func newServer(t *testing.T) (*httptest.Server, *MemoryUsers) {
+	users := NewMemoryUsers(
+		User{ID: "ada", Name: "Ada Lovelace"},
+		User{ID: "grace", Name: "Grace Hopper"},
+		User{ID: "alan", Name: "Alan Turing"},
+	)
+	srv := httptest.NewServer(NewHandler(todo.NewMemoryRepository(), users))
+	t.Cleanup(srv.Close)
+	return srv, users
+}
+
+const createTodo = `
+	mutation($title: String!, $assignee: ID) {
+		createTodo(title: $title, assignee: $assignee) { id title completed assignee { id } }
+	}`
+
+func TestQueriesAndMutations(t *testing.T) {
+	srv, _ := newServer(t)
+
+	resp := post(t, srv, "ada", createTodo, map[string]any{"title": "  write docs "})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"createTodo": {"id": "1", "title": "write docs", "completed": false, "assignee": {"id": "ada"}}}`, string(resp.Data))
+
+	resp = post(t, srv, "ada", createTodo, map[string]any{"title": "review", "assignee": "grace"})
+	require.Empty(t, resp.Errors)
+
+	resp = post(t, srv, "ada", `mutation { completeTodo(id: "2") { id completed } }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"completeTodo": {"id": "2", "completed": true}}`, string(resp.Data))
+
+	// the client picks the fields, and nothing else comes back
+	resp = post(t, srv, "", `{ todos { title completed assignee { name } } }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"todos": [
+		{"title": "write docs", "completed": false, "assignee": {"name": "Ada Lovelace"}},
+		{"title": "review", "completed": true, "assignee": {"name": "Grace Hopper"}}
+	]}`, string(resp.Data))
+
+	resp = post(t, srv, "", `query($id: ID!) { todo(id: $id) { title } }`, map[string]any{"id": "2"})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"todo": {"title": "review"}}`, string(resp.Data))
+
+	resp = post(t, srv, "ada", `mutation { deleteTodo(id: "1") }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"deleteTodo": true}`, string(resp.Data))
+
+	resp = post(t, srv, "", `{ todo(id: "1") { title } }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"todo": null}`, string(resp.Data), "a missing todo is null, not an error")
+}
+
+func TestErrorsComeBackInTheBody(t *testing.T) {
+	srv, _ := newServer(t)
+
+	t.Run("no viewer", func(t *testing.T) {
+		resp := post(t, srv, "", createTodo, map[string]any{"title": "sneaky"})
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, ErrUnauthenticated.Error(), resp.Errors[0].Message)
+		assert.Equal(t, []any{"createTodo"}, resp.Errors[0].Path)
+	})
+
+	t.Run("invalid todo", func(t *testing.T) {
+		resp := post(t, srv, "ada", createTodo, map[string]any{"title": "   "})
+		require.Len(t, resp.Errors, 1)
+		assert.Contains(t, resp.Errors[0].Message, "title is required")
+	})
+
+	t.Run("not in the schema", func(t *testing.T) {
+		resp := post(t, srv, "", `{ todos { priority } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Contains(t, resp.Errors[0].Message, `Cannot query field "priority"`)
+	})
+
+	t.Run("only POST", func(t *testing.T) {
+		resp, err := srv.Client().Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
+
+func TestAssigneesAreBatched(t *testing.T) {
+	srv, users := newServer(t)
+
+	owners := []string{"ada", "grace", "ada", "alan", "grace", "ada", "gone"}
+	for _, owner := range owners {
+		resp := post(t, srv, "ada", `mutation($a: ID) { createTodo(title: "x", assignee: $a) { id } }`, map[string]any{"a": owner})
+		require.Empty(t, resp.Errors)
+	}
+	require.Empty(t, users.Batches(), "creating doesn't look anyone up unless asked")
+
+	resp := post(t, srv, "", `{ todos { assignee { id } } }`, nil)
+	require.Empty(t, resp.Errors)
+
+	var data struct {
+		Todos []struct {
+			Assignee *struct{ ID string }
+		}
+	}
+	require.NoError(t, json.Unmarshal(resp.Data, &data))
+	require.Len(t, data.Todos, len(owners))
+	for i, owner := range owners[:len(owners)-1] {
+		assert.Equal(t, owner, data.Todos[i].Assignee.ID)
+	}
+	assert.Nil(t, data.Todos[len(owners)-1].Assignee, "an unknown user is null")
+
+	// seven todos, one lookup, each user once
+	assert.Equal(t, [][]string{{"ada", "alan", "gone", "grace"}}, users.Batches())
+
+	// and the memo doesn't outlive the request
+	post(t, srv, "", `{ todos { assignee { id } } }`, nil)
+	assert.Len(t, users.Batches(), 2)
+}
+
+func TestViewerFrom(t *testing.T) {
+	_, ok := ViewerFrom(context.Background())
+	assert.False(t, ok)
+
+	v, ok := ViewerFrom(WithViewer(context.Background(), "ada"))
+	assert.True(t, ok)
+	assert.Equal(t, "ada", v)
+}
@@ -0,0 +1,140 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// The N+1 problem: a query asks for every todo and each todo's assignee.
+// The todos come back in one repository call, then the assignee resolver
+// runs once per todo and, written the obvious way, makes one user lookup
+// each - N+1 round trips for one query. GraphQL makes it easy to walk into,
+// because each resolver only sees its own object and has no idea its
+// siblings are about to ask for the same kind of thing.
+//
+// A dataloader fixes it without the resolvers having to know. Load doesn't
+// fetch straight away: it adds the key to the current batch and waits. The
+// first key starts a short timer, and when it fires (or the batch fills
+// up) one fetch goes out for every key collected, and each caller is
+// handed its own value. graphql-go resolves list items concurrently, so by
+// the time the timer fires every sibling has asked.
+//
+// It also remembers what it's loaded, so the same user assigned to five
+// todos is fetched once. That memo is why a Loader lives for one request
+// and no longer - it isn't a cache, and two requests shouldn't see each
+// other's data, or stale data, through it. See NewHandler
+
+// ErrNoValue is what Load returns for a key the batch fetch didn't return
+var ErrNoValue = errors.New("graphql: no value for key")
+
+// BatchFunc fetches many keys at once. Keys it has nothing for are simply
+// left out of the map
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader batches and memoises calls to a BatchFunc. It's safe for
+// concurrent use, which is the whole point
+type Loader[K comparable, V any] struct {
+	fetch    BatchFunc[K, V]
+	wait     time.Duration
+	maxBatch int
+
+	mu      sync.Mutex
+	pending *batch[K, V]
+	loaded  map[K]*batch[K, V] // which batch each key was, or is being, fetched in
+}
+
+type batch[K comparable, V any] struct {
+	keys   []K
+	done   chan struct{} // closed once values and err are set
+	values map[K]V
+	err    error
+}
+
+// NewLoader returns a loader that waits up to wait for more keys before
+// fetching, and fetches at most maxBatch keys at a time. A few milliseconds
+// is plenty for wait: it only has to cover resolvers that are already
+// running
+func NewLoader[K comparable, V any](fetch BatchFunc[K, V], wait time.Duration, maxBatch int) *Loader[K, V] {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	return &Loader[K, V]{
+		fetch:    fetch,
+		wait:     wait,
+		maxBatch: maxBatch,
+		loaded:   make(map[K]*batch[K, V]),
+	}
+}
+
+// Load returns the value for key, joining the batch being collected or
+// starting one. The batch is fetched with the context of whichever Load
+// started it - they all come from the same request, so that's the one
+// whose deadline matters anyway
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	b, ok := l.loaded[key]
+	if !ok {
+		b = l.pending
+		if b == nil {
+			b = &batch[K, V]{done: make(chan struct{})}
+			l.pending = b
+			time.AfterFunc(l.wait, func() { l.dispatch(ctx, b) })
+		}
+		b.keys = append(b.keys, key)
+		l.loaded[key] = b
+		if len(b.keys) >= l.maxBatch {
+			// full, send it now rather than waiting for the timer. The
+			// timer still fires later, and finds nothing to do
+			l.pending = nil
+			go l.fetchBatch(ctx, b)
+		}
+	}
+	l.mu.Unlock()
+
+	var zero V
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+	if b.err != nil {
+		return zero, b.err
+	}
+	v, ok := b.values[key]
+	if !ok {
+		return zero, ErrNoValue
+	}
+	return v, nil
+}
+
+// dispatch is the timer going off. The batch may already have been sent
+// for being full
+func (l *Loader[K, V]) dispatch(ctx context.Context, b *batch[K, V]) {
+	l.mu.Lock()
+	if l.pending != b {
+		l.mu.Unlock()
+		return
+	}
+	l.pending = nil
+	l.mu.Unlock()
+
+	l.fetchBatch(ctx, b)
+}
+
+func (l *Loader[K, V]) fetchBatch(ctx context.Context, b *batch[K, V]) {
+	values, err := l.fetch(ctx, b.keys)
+	if err != nil {
+		// don't remember failures, a later Load should try again
+		l.mu.Lock()
+		for _, k := range b.keys {
+			if l.loaded[k] == b {
+				delete(l.loaded, k)
+			}
+		}
+		l.mu.Unlock()
+	}
+	b.values, b.err = values, err
+	close(b.done)
+}
@@ -0,0 +1,135 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingFetch doubles each key, leaving out negative ones, and records
+// each batch it was asked for
+type recordingFetch struct {
+	mu      sync.Mutex
+	batches [][]int
+	err     error
+}
+
+func (f *recordingFetch) fetch(ctx context.Context, keys []int) (map[int]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b := append([]int(nil), keys...)
+	sort.Ints(b)
+	f.batches = append(f.batches, b)
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := make(map[int]string, len(keys))
+	for _, k := range keys {
+		if k >= 0 {
+			out[k] = strconv.Itoa(k * 2)
+		}
+	}
+	return out, nil
+}
+
+func (f *recordingFetch) calls() [][]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.batches
+}
+
+// loadAll loads every key at once, the way sibling resolvers do
+func loadAll(l *Loader[int, string], keys ...int) ([]string, []error) {
+	vals := make([]string, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Add(1)
+		go func(i, k int) {
+			defer wg.Done()
+			vals[i], errs[i] = l.Load(context.Background(), k)
+		}(i, k)
+	}
+	wg.Wait()
+	return vals, errs
+}
+
+func TestLoaderBatches(t *testing.T) {
+	f := &recordingFetch{}
+	l := NewLoader(f.fetch, 10*time.Millisecond, 100)
+
+	vals, errs := loadAll(l, 1, 2, 3, 2, 1)
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"2", "4", "6", "4", "2"}, vals)
+	assert.Equal(t, [][]int{{1, 2, 3}}, f.calls(), "one fetch, each key once")
+
+	// already loaded, so no fetch at all
+	v, err := l.Load(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, "6", v)
+	assert.Len(t, f.calls(), 1)
+}
+
+func TestLoaderMaxBatch(t *testing.T) {
+	f := &recordingFetch{}
+	l := NewLoader(f.fetch, 10*time.Millisecond, 2)
+
+	_, errs := loadAll(l, 1, 2, 3, 4, 5)
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	calls := f.calls()
+	assert.Len(t, calls, 3)
+	for _, b := range calls {
+		assert.LessOrEqual(t, len(b), 2)
+	}
+}
+
+func TestLoaderMissingKey(t *testing.T) {
+	f := &recordingFetch{}
+	l := NewLoader(f.fetch, time.Millisecond, 100)
+
+	_, err := l.Load(context.Background(), -1)
+	assert.ErrorIs(t, err, ErrNoValue)
+}
+
+func TestLoaderErrorsAreRetried(t *testing.T) {
+	errDown := errors.New("user service down")
+	f := &recordingFetch{err: errDown}
+	l := NewLoader(f.fetch, time.Millisecond, 100)
+
+	_, errs := loadAll(l, 1, 2)
+	for _, err := range errs {
+		assert.ErrorIs(t, err, errDown)
+	}
+
+	f.mu.Lock()
+	f.err = nil
+	f.mu.Unlock()
+
+	v, err := l.Load(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "2", v)
+	assert.Len(t, f.calls(), 2)
+}
+
+func TestLoaderContextCancelled(t *testing.T) {
+	f := &recordingFetch{}
+	l := NewLoader(f.fetch, time.Hour, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := l.Load(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+}
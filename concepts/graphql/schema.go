@@ -0,0 +1,267 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"github.com/thorntonmc/go-practice/apps/todo"
+)
+
+// GraphQL puts one endpoint in front of the API and lets the client say, in
+// the query, exactly which fields it wants and how deep to follow the
+// relationships. The server publishes a typed schema, and writes a resolver
+// for each field.
+//
+// graphql-go is schema first: the schema is the SDL below, and resolvers
+// are found by reflection - a Query field "todos" is resolved by a Todos
+// method on the root resolver, "assignee" on Todo by an Assignee method on
+// whatever resolves a Todo. Arguments come in as a struct with matching
+// field names. Every resolver may take a context.Context first, and that's
+// the request's context, which is how request scoped things like the
+// viewer and the dataloader reach them.
+//
+// Errors don't change the status code. A failing resolver adds an entry to
+// "errors" in the response, its field comes back null, and the rest of
+// the query still gets its data - so a client has to check errors even on
+// a 200
+
+// Schema is the SDL for the TODO API
+const Schema = `
+	schema {
+		query: Query
+		mutation: Mutation
+	}
+
+	type Query {
+		todos: [Todo!]!
+		# null when there's no such todo
+		todo(id: ID!): Todo
+	}
+
+	type Mutation {
+		# assigned to the caller, unless assignee is given
+		createTodo(title: String!, assignee: ID): Todo!
+		completeTodo(id: ID!): Todo!
+		deleteTodo(id: ID!): Boolean!
+	}
+
+	type Todo {
+		id: ID!
+		title: String!
+		completed: Boolean!
+		assignee: User
+	}
+
+	type User {
+		id: ID!
+		name: String!
+	}
+`
+
+var ErrUnauthenticated = errors.New("sign in to change todos")
+
+type User struct {
+	ID   string
+	Name string
+}
+
+// UserStore looks up users in bulk. There's deliberately no single-user
+// method: the resolvers go through a Loader, which only ever asks for
+// batches
+type UserStore interface {
+	Users(ctx context.Context, ids []string) (map[string]User, error)
+}
+
+// MemoryUsers is a UserStore that counts its calls, so the tests can see
+// the batching happen
+type MemoryUsers struct {
+	mu      sync.Mutex
+	users   map[string]User
+	batches [][]string
+}
+
+func NewMemoryUsers(users ...User) *MemoryUsers {
+	m := &MemoryUsers{users: make(map[string]User, len(users))}
+	for _, u := range users {
+		m.users[u.ID] = u
+	}
+	return m
+}
+
+func (m *MemoryUsers) Users(ctx context.Context, ids []string) (map[string]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.batches = append(m.batches, append([]string(nil), ids...))
+	out := make(map[string]User, len(ids))
+	for _, id := range ids {
+		if u, ok := m.users[id]; ok {
+			out[id] = u
+		}
+	}
+	return out, nil
+}
+
+// Batches returns the ids of every call to Users so far, each sorted
+func (m *MemoryUsers) Batches() [][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([][]string, len(m.batches))
+	for i, b := range m.batches {
+		out[i] = append([]string(nil), b...)
+		sort.Strings(out[i])
+	}
+	return out
+}
+
+/*
+ *
+ * resolvers
+ *
+ */
+
+// resolver is the root, resolving Query and Mutation fields. todo.Todo has
+// no assignee, so who's assigned what is kept here - standing in for a
+// column the TODO app doesn't have
+type resolver struct {
+	repo  todo.TodoRepository
+	users UserStore
+
+	mu        sync.Mutex
+	assignees map[int64]string
+}
+
+func (r *resolver) Todos(ctx context.Context) ([]*todoResolver, error) {
+	todos, err := r.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*todoResolver, len(todos))
+	for i, t := range todos {
+		out[i] = &todoResolver{root: r, t: t}
+	}
+	return out, nil
+}
+
+func (r *resolver) Todo(ctx context.Context, args struct{ ID graphqlgo.ID }) (*todoResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, nil // no todo has that id
+	}
+	t, err := r.repo.Get(ctx, id)
+	if errors.Is(err, todo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &todoResolver{root: r, t: t}, nil
+}
+
+func (r *resolver) CreateTodo(ctx context.Context, args struct {
+	Title    string
+	Assignee *graphqlgo.ID
+}) (*todoResolver, error) {
+	viewer, ok := ViewerFrom(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	assignee := viewer
+	if args.Assignee != nil {
+		assignee = string(*args.Assignee)
+	}
+
+	t := todo.Todo{Title: args.Title}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	t, err := r.repo.Create(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.assignees[t.ID] = assignee
+	r.mu.Unlock()
+	return &todoResolver{root: r, t: t}, nil
+}
+
+func (r *resolver) CompleteTodo(ctx context.Context, args struct{ ID graphqlgo.ID }) (*todoResolver, error) {
+	if _, ok := ViewerFrom(ctx); !ok {
+		return nil, ErrUnauthenticated
+	}
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	t, err := r.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	t.Completed = true
+	if err := r.repo.Update(ctx, t); err != nil {
+		return nil, err
+	}
+	return &todoResolver{root: r, t: t}, nil
+}
+
+func (r *resolver) DeleteTodo(ctx context.Context, args struct{ ID graphqlgo.ID }) (bool, error) {
+	if _, ok := ViewerFrom(ctx); !ok {
+		return false, ErrUnauthenticated
+	}
+	id, err := parseID(args.ID)
+	if err != nil {
+		return false, err
+	}
+	if err := r.repo.Delete(ctx, id); err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	delete(r.assignees, id)
+	r.mu.Unlock()
+	return true, nil
+}
+
+type todoResolver struct {
+	root *resolver
+	t    todo.Todo
+}
+
+func (t *todoResolver) ID() graphqlgo.ID { return graphqlgo.ID(strconv.FormatInt(t.t.ID, 10)) }
+func (t *todoResolver) Title() string    { return t.t.Title }
+func (t *todoResolver) Completed() bool  { return t.t.Completed }
+
+// Assignee is the resolver that would cause N+1 lookups. It goes through
+// the request's loader instead, so a list of todos costs one Users call
+func (t *todoResolver) Assignee(ctx context.Context) (*userResolver, error) {
+	t.root.mu.Lock()
+	id, ok := t.root.assignees[t.t.ID]
+	t.root.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	u, err := loaderFrom(ctx).Load(ctx, id)
+	if errors.Is(err, ErrNoValue) {
+		return nil, nil // assigned to someone who's since gone
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &userResolver{u}, nil
+}
+
+type userResolver struct{ u User }
+
+func (u *userResolver) ID() graphqlgo.ID { return graphqlgo.ID(u.u.ID) }
+func (u *userResolver) Name() string     { return u.u.Name }
+
+func parseID(id graphqlgo.ID) (int64, error) {
+	return strconv.ParseInt(string(id), 10, 64)
+}
@@ -0,0 +1,191 @@
+package hash
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Go has a few non-cryptographic hashes in the standard library, and which to
+// use depends on who else needs to agree on the result:
+//
+//   - hash/maphash is what Go's own maps use: fast and well distributed, but
+//     seeded randomly per process, so the same string hashes differently in
+//     every run. Perfect for in-memory hash tables, useless for anything
+//     shared between processes or saved to disk
+//   - hash/fnv (FNV-1a) is tiny and stable forever - the same bytes give the
+//     same hash on every machine - but its output isn't very well mixed, so
+//     similar inputs ("node-1", "node-2") land near each other
+//   - crypto/sha256 and friends are stable and excellent, and much slower
+//     than either. Only pay for them when someone might attack the hash
+
+// fnv64a is FNV-1a, 64 bit
+func fnv64a(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// mix runs a hash through the splitmix64 finalizer. FNV's weakness is poor
+// avalanche - flipping one input bit doesn't flip half the output bits - and
+// a couple of multiply-xorshift rounds fix that cheaply
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// StableHash is FNV-1a followed by mix: stable across processes, and well
+// enough distributed to place nodes on a ring
+func StableHash(b []byte) uint64 {
+	return mix(fnv64a(b))
+}
+
+/*
+ *
+ * consistent hashing
+ *
+ */
+
+// Spreading keys over N servers with hash(key) % N works until N changes:
+// then nearly every key moves, and every cache goes cold at once.
+//
+// A consistent hash ring puts the servers at points on a circle of hash
+// values. A key belongs to the first server clockwise from its own hash, so
+// adding or removing a server only moves the keys in that server's arcs -
+// about 1/N of them. One point per server makes for very uneven arcs, so each
+// server gets many "virtual nodes" scattered around the ring
+
+// Ring is a consistent hash ring, safe for concurrent use
+type Ring struct {
+	replicas int
+	hash     func([]byte) uint64
+
+	mu     sync.RWMutex
+	points []uint64          // sorted
+	owners map[uint64]string // point -> node
+	nodes  map[string]bool
+}
+
+// NewRing creates a ring placing replicas virtual nodes per node. A nil hash
+// uses StableHash - it has to be stable if several processes are going to
+// agree on where keys live
+func NewRing(replicas int, hash func([]byte) uint64) *Ring {
+	if replicas < 1 {
+		replicas = 1
+	}
+	if hash == nil {
+		hash = StableHash
+	}
+	return &Ring{
+		replicas: replicas,
+		hash:     hash,
+		owners:   map[uint64]string{},
+		nodes:    map[string]bool{},
+	}
+}
+
+func (r *Ring) virtualPoint(node string, i int) uint64 {
+	return r.hash([]byte(node + "#" + strconv.Itoa(i)))
+}
+
+// Add puts nodes on the ring. Adding a node twice does nothing
+func (r *Ring) Add(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, n := range nodes {
+		if r.nodes[n] {
+			continue
+		}
+		r.nodes[n] = true
+		for i := 0; i < r.replicas; i++ {
+			p := r.virtualPoint(n, i)
+			// on the (astronomically rare) collision the first owner keeps it
+			if _, taken := r.owners[p]; !taken {
+				r.owners[p] = n
+				r.points = append(r.points, p)
+			}
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Remove takes a node off the ring, its keys move to the next node clockwise
+func (r *Ring) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.nodes[node] {
+		return
+	}
+	delete(r.nodes, node)
+
+	kept := r.points[:0]
+	for _, p := range r.points {
+		if r.owners[p] == node {
+			delete(r.owners, p)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	r.points = kept
+}
+
+// Len is the number of nodes on the ring
+func (r *Ring) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.nodes)
+}
+
+// search finds the index of the first point at or after h, wrapping around
+func (r *Ring) search(h uint64) int {
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return i
+}
+
+// Get returns the node owning key, or "" if the ring is empty
+func (r *Ring) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return ""
+	}
+	return r.owners[r.points[r.search(r.hash([]byte(key)))]]
+}
+
+// GetN returns up to n distinct nodes for key, in ring order: the owner
+// first, then the nodes that would take over if it went away. That's the
+// fallback order for a down node, or the replica set for storing n copies
+func (r *Ring) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	out := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	start := r.search(r.hash([]byte(key)))
+	for i := 0; len(out) < n; i++ {
+		node := r.owners[r.points[(start+i)%len(r.points)]]
+		if !seen[node] {
+			seen[node] = true
+			out = append(out, node)
+		}
+	}
+	return out
+}
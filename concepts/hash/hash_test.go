@@ -0,0 +1,188 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/maphash"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStableHash(t *testing.T) {
+	// stable means stable: these values must never change
+	assert.Equal(t, uint64(0xaf63dc4c8601ec8c), fnv64a([]byte("a")))
+	assert.Equal(t, StableHash([]byte("hello")), StableHash([]byte("hello")))
+	assert.NotEqual(t, StableHash([]byte("node-1")), StableHash([]byte("node-2")))
+}
+
+// mix should flip about half the output bits for a one bit change in input
+func TestMixAvalanche(t *testing.T) {
+	var raw, mixed float64
+	const n = 1000
+	for i := 0; i < n; i++ {
+		a, b := fmt.Sprintf("key-%d", i), fmt.Sprintf("key-%d", i+1)
+		raw += float64(popcount(fnv64a([]byte(a)) ^ fnv64a([]byte(b))))
+		mixed += float64(popcount(StableHash([]byte(a)) ^ StableHash([]byte(b))))
+	}
+
+	assert.InDelta(t, 32, mixed/n, 2)
+	assert.Less(t, raw/n, mixed/n)
+}
+
+func popcount(x uint64) int {
+	n := 0
+	for ; x != 0; x &= x - 1 {
+		n++
+	}
+	return n
+}
+
+func nodes(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("10.0.0.%d:8000", i+1)
+	}
+	return out
+}
+
+func TestRingDistribution(t *testing.T) {
+	r := NewRing(200, nil)
+	r.Add(nodes(10)...)
+
+	counts := map[string]int{}
+	const keys = 100000
+	for i := 0; i < keys; i++ {
+		counts[r.Get(fmt.Sprintf("user:%d", i))]++
+	}
+
+	require.Len(t, counts, 10)
+	mean := float64(keys) / 10
+	for node, c := range counts {
+		assert.InDelta(t, mean, c, mean*0.2, "%s got %d keys", node, c)
+	}
+}
+
+func TestRingFewReplicasIsUneven(t *testing.T) {
+	spread := func(replicas int) float64 {
+		r := NewRing(replicas, nil)
+		r.Add(nodes(10)...)
+		counts := map[string]float64{}
+		for i := 0; i < 50000; i++ {
+			counts[r.Get(fmt.Sprintf("user:%d", i))]++
+		}
+		var sum, sq float64
+		for _, c := range counts {
+			sum += c
+			sq += c * c
+		}
+		mean := sum / 10
+		return math.Sqrt(sq/10-mean*mean) / mean
+	}
+
+	assert.Greater(t, spread(1), spread(200))
+}
+
+func TestRingAddMovesFewKeys(t *testing.T) {
+	r := NewRing(200, nil)
+	r.Add(nodes(10)...)
+
+	const keys = 20000
+	before := make([]string, keys)
+	for i := range before {
+		before[i] = r.Get(fmt.Sprintf("k%d", i))
+	}
+
+	r.Add("10.0.0.99:8000")
+	moved := 0
+	for i := range before {
+		now := r.Get(fmt.Sprintf("k%d", i))
+		if now != before[i] {
+			moved++
+			assert.Equal(t, "10.0.0.99:8000", now, "keys only move to the new node")
+		}
+	}
+	assert.InDelta(t, keys/11, moved, keys*0.05)
+
+	// and modulo hashing, for comparison, moves nearly everything
+	modMoved := 0
+	for i := 0; i < keys; i++ {
+		h := StableHash([]byte(fmt.Sprintf("k%d", i)))
+		if h%10 != h%11 {
+			modMoved++
+		}
+	}
+	assert.Greater(t, modMoved, keys*8/10)
+}
+
+func TestRingRemoveAndGetN(t *testing.T) {
+	r := NewRing(50, nil)
+	assert.Equal(t, "", r.Get("x"))
+	assert.Nil(t, r.GetN("x", 2))
+
+	r.Add("a", "b", "c")
+	r.Add("a") // no-op
+	assert.Equal(t, 3, r.Len())
+
+	order := r.GetN("some-key", 5)
+	require.Len(t, order, 3)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, order)
+	assert.Equal(t, r.Get("some-key"), order[0])
+
+	// removing the owner hands the key to the next node in the fallback order
+	r.Remove(order[0])
+	assert.Equal(t, order[1], r.Get("some-key"))
+	assert.Equal(t, 2, r.Len())
+
+	r.Remove("nope")
+	assert.Equal(t, 2, r.Len())
+}
+
+func BenchmarkHash(b *testing.B) {
+	key := []byte("user:1234567890:session")
+	b.Run("fnv64a", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fnv64a(key)
+		}
+	})
+	b.Run("stable", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			StableHash(key)
+		}
+	})
+	b.Run("maphash", func(b *testing.B) {
+		seed, s := maphash.MakeSeed(), string(key)
+		for i := 0; i < b.N; i++ {
+			maphash.String(seed, s)
+		}
+	})
+	b.Run("crc32", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			crc32.ChecksumIEEE(key)
+		}
+	})
+	b.Run("sha256", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s := sha256.Sum256(key)
+			binary.BigEndian.Uint64(s[:8])
+		}
+	})
+}
+
+func BenchmarkRingGet(b *testing.B) {
+	r := NewRing(200, nil)
+	r.Add(nodes(50)...)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user:%d", i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Get(keys[i%len(keys)])
+	}
+}
@@ -0,0 +1,221 @@
+package heap
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// A heap is a tree kept in a slice where every parent sorts before its
+// children, so the smallest item is always at index 0. Push and Pop are
+// O(log n) and peeking at the minimum is O(1) - ideal when you keep needing
+// "the next most important thing" from a changing set, which is exactly what
+// a priority queue is.
+//
+// container/heap has the algorithms but no storage. You bring a type
+// implementing heap.Interface (sort.Interface plus Push and Pop) and call
+// heap.Push/heap.Pop/heap.Fix on it - never your own Push and Pop directly,
+// those only append and truncate
+
+/*
+ *
+ * container/heap directly
+ *
+ */
+
+type task struct {
+	name     string
+	priority int // higher runs first
+	index    int // position in the heap, maintained by taskQueue for update
+}
+
+type taskQueue []*task
+
+func (q taskQueue) Len() int { return len(q) }
+
+// Less is "should i come out first", so > gives highest priority first
+func (q taskQueue) Less(i, j int) bool { return q[i].priority > q[j].priority }
+
+func (q taskQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *taskQueue) Push(x any) {
+	t := x.(*task)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+
+func (q *taskQueue) Pop() any {
+	old := *q
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil // don't keep the popped task alive through the backing array
+	t.index = -1
+	*q = old[:n-1]
+	return t
+}
+
+// update changes a queued task's priority. heap.Fix re-sorts just that one
+// item in O(log n), which is why each task tracks its index
+func (q *taskQueue) update(t *task, priority int) {
+	t.priority = priority
+	heap.Fix(q, t.index)
+}
+
+/*
+ *
+ * generic wrapper
+ *
+ */
+
+// PriorityQueue hides the heap.Interface boilerplate behind a less function.
+// It is not safe for concurrent use
+type PriorityQueue[T any] struct {
+	h *items[T]
+}
+
+// items is the heap.Interface implementation. It's a separate type so its
+// Push and Pop - which must not be called directly - aren't on PriorityQueue
+type items[T any] struct {
+	data []T
+	less func(a, b T) bool
+}
+
+func (h *items[T]) Len() int           { return len(h.data) }
+func (h *items[T]) Less(i, j int) bool { return h.less(h.data[i], h.data[j]) }
+func (h *items[T]) Swap(i, j int)      { h.data[i], h.data[j] = h.data[j], h.data[i] }
+func (h *items[T]) Push(x any)         { h.data = append(h.data, x.(T)) }
+func (h *items[T]) Pop() any {
+	var zero T
+	n := len(h.data)
+	x := h.data[n-1]
+	h.data[n-1] = zero
+	h.data = h.data[:n-1]
+	return x
+}
+
+// NewPriorityQueue returns a queue where Pop returns the item that sorts
+// first according to less
+func NewPriorityQueue[T any](less func(a, b T) bool) *PriorityQueue[T] {
+	return &PriorityQueue[T]{h: &items[T]{less: less}}
+}
+
+func (q *PriorityQueue[T]) Len() int { return q.h.Len() }
+
+func (q *PriorityQueue[T]) Push(v T) { heap.Push(q.h, v) }
+
+// Pop removes and returns the first item, false when empty
+func (q *PriorityQueue[T]) Pop() (T, bool) {
+	if q.h.Len() == 0 {
+		var zero T
+		return zero, false
+	}
+	return heap.Pop(q.h).(T), true
+}
+
+// Peek returns the first item without removing it
+func (q *PriorityQueue[T]) Peek() (T, bool) {
+	if q.h.Len() == 0 {
+		var zero T
+		return zero, false
+	}
+	return q.h.data[0], true
+}
+
+/*
+ *
+ * scheduler
+ *
+ */
+
+// scheduler runs functions at given times. Jobs sit in a priority queue
+// ordered by due time, and Run only ever waits for the earliest one - no
+// timer per job, no polling
+type scheduler struct {
+	clk clock.Clock
+
+	mu   sync.Mutex
+	jobs *PriorityQueue[job]
+	seq  uint64
+
+	// wake interrupts Run's wait when a job is added that might be due
+	// sooner than the one it's waiting for
+	wake chan struct{}
+}
+
+type job struct {
+	at  time.Time
+	seq uint64 // ties run in the order they were scheduled
+	fn  func()
+}
+
+func newScheduler(clk clock.Clock) *scheduler {
+	return &scheduler{
+		clk: clk,
+		jobs: NewPriorityQueue(func(a, b job) bool {
+			if a.at.Equal(b.at) {
+				return a.seq < b.seq
+			}
+			return a.at.Before(b.at)
+		}),
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// At schedules fn to run at t. Jobs in the past run as soon as possible
+func (s *scheduler) At(t time.Time, fn func()) {
+	s.mu.Lock()
+	s.seq++
+	s.jobs.Push(job{at: t, seq: s.seq, fn: fn})
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default: // a wake-up is already pending
+	}
+}
+
+// After schedules fn to run d from now
+func (s *scheduler) After(d time.Duration, fn func()) {
+	s.At(s.clk.Now().Add(d), fn)
+}
+
+// Pending is the number of jobs not yet run
+func (s *scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs.Len()
+}
+
+// Run executes jobs as they come due until ctx is done. Jobs run one at a
+// time on Run's goroutine, so a slow job delays the ones behind it
+func (s *scheduler) Run(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		var wait <-chan time.Time
+		if next, ok := s.jobs.Peek(); ok {
+			now := s.clk.Now()
+			if !next.at.After(now) {
+				s.jobs.Pop()
+				s.mu.Unlock()
+				next.fn()
+				continue
+			}
+			wait = s.clk.After(next.at.Sub(now))
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-s.wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package heap
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+func TestTaskQueue(t *testing.T) {
+	tasks := map[string]*task{}
+	q := &taskQueue{}
+	for name, p := range map[string]int{"email": 1, "invoice": 5, "backup": 3} {
+		tasks[name] = &task{name: name, priority: p}
+		heap.Push(q, tasks[name])
+	}
+
+	q.update(tasks["email"], 10)
+
+	var order []string
+	for q.Len() > 0 {
+		order = append(order, heap.Pop(q).(*task).name)
+	}
+	assert.Equal(t, []string{"email", "invoice", "backup"}, order)
+	assert.Equal(t, -1, tasks["email"].index)
+}
+
+func TestPriorityQueue(t *testing.T) {
+	q := NewPriorityQueue(func(a, b int) bool { return a < b })
+
+	_, ok := q.Pop()
+	assert.False(t, ok)
+	_, ok = q.Peek()
+	assert.False(t, ok)
+
+	in := rand.Perm(100)
+	for _, v := range in {
+		q.Push(v)
+	}
+	assert.Equal(t, 100, q.Len())
+
+	top, _ := q.Peek()
+	assert.Equal(t, 0, top)
+
+	var out []int
+	for q.Len() > 0 {
+		v, _ := q.Pop()
+		out = append(out, v)
+	}
+	assert.True(t, sort.IntsAreSorted(out))
+	assert.Len(t, out, 100)
+}
+
+func TestSchedulerRunsInDueOrder(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := newScheduler(clk)
+
+	ran := make(chan string, 10)
+	record := func(name string) func() { return func() { ran <- name } }
+	s.After(3*time.Second, record("third"))
+	s.After(time.Second, record("first"))
+	s.After(2*time.Second, record("second"))
+	s.After(2*time.Second, record("second again"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	clk.BlockUntil(1)
+	assert.Empty(t, ran, "nothing is due yet")
+
+	clk.Advance(5 * time.Second)
+	var order []string
+	for i := 0; i < 4; i++ {
+		order = append(order, <-ran)
+	}
+	assert.Equal(t, []string{"first", "second", "second again", "third"}, order)
+	assert.Equal(t, 0, s.Pending())
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestSchedulerWakesForEarlierJob(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := newScheduler(clk)
+
+	ran := make(chan string, 10)
+	s.After(time.Hour, func() { ran <- "later" })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// Run is waiting an hour, a new job due in a second has to interrupt it
+	clk.BlockUntil(1)
+	s.After(time.Second, func() { ran <- "sooner" })
+	clk.BlockUntil(2)
+
+	clk.Advance(time.Second)
+	assert.Equal(t, "sooner", <-ran)
+	assert.Equal(t, 1, s.Pending())
+
+	// a job already due runs without the clock moving
+	s.At(time.Unix(0, 0), func() { ran <- "overdue" })
+	assert.Equal(t, "overdue", <-ran)
+}
+
+// Keeping the smallest item available while items keep arriving: a heap does
+// O(log n) work per item, re-sorting does O(n log n)
+func BenchmarkPriorityQueue(b *testing.B) {
+	values := rand.Perm(2000)
+
+	b.Run("heap", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			q := NewPriorityQueue(func(a, b int) bool { return a < b })
+			for j, v := range values {
+				q.Push(v)
+				if j%2 == 1 {
+					q.Pop()
+				}
+			}
+		}
+	})
+
+	b.Run("sort", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var s []int
+			for j, v := range values {
+				s = append(s, v)
+				sort.Ints(s)
+				if j%2 == 1 {
+					s = s[1:]
+				}
+			}
+		}
+	})
+}
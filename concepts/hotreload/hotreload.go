@@ -0,0 +1,180 @@
+package hotreload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"gopkg.in/yaml.v3"
+)
+
+// Some settings are worth changing without a restart: turning debug logging
+// on while something is going wrong, or loosening a rate limit that turned
+// out too tight. A restart drops connections and in-flight work, and
+// pkg/config only reads its file once.
+//
+// The trick is making the swap safe while every request is reading the
+// config. A mutex would work but puts a lock on the hot path. Instead the
+// config is immutable: a reload builds a whole new *Config and swaps the
+// pointer with atomic.Pointer. A reader gets either the old config or the
+// new one, never half of each, and never waits. The one rule is that
+// nobody changes a Config after it's been stored - callers get a pointer
+// to share, not a copy to edit.
+//
+// Code that keeps state derived from the config - a rate limiter built
+// with the old rate, a logger's level - can't just reread a pointer, it
+// has to rebuild. So every reload is also published on a pubsub.Bus, and
+// those parts subscribe.
+//
+// Reloads are triggered two ways: SIGHUP, the Unix convention for "reread
+// your config" (nginx, sshd, prometheus), and polling the file, which
+// catches edits nobody remembered to signal about
+
+// Config is the reloadable part of the server's settings
+type Config struct {
+	// LogLevel is debug, info, warn or error
+	LogLevel  string    `yaml:"log_level"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+}
+
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"` // requests per second
+	Burst int     `yaml:"burst"`
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	if _, err := parseLevel(c.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	if c.RateLimit.Rate <= 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.rate must be positive, got %v", c.RateLimit.Rate))
+	}
+	if c.RateLimit.Burst < 1 {
+		errs = append(errs, fmt.Errorf("rate_limit.burst must be at least 1, got %d", c.RateLimit.Burst))
+	}
+	return errors.Join(errs...)
+}
+
+// parse decodes strictly, so a misspelt key fails the reload instead of
+// quietly falling back to zero
+func parse(data []byte) (*Config, error) {
+	c := &Config{}
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+	if err := d.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Topic is where each new *Config is published
+const Topic = "config"
+
+// Store holds the current config and reloads it from a file
+type Store struct {
+	path string
+	bus  *pubsub.Bus[*Config]
+	cur  atomic.Pointer[Config]
+
+	mu   sync.Mutex // one reload at a time, so two can't publish out of order
+	last []byte     // the file's contents when cur was loaded
+}
+
+// Open loads path, failing if it's missing or invalid - at startup there's
+// no previous config to fall back on
+func Open(path string, bus *pubsub.Bus[*Config]) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("hotreload: %w", err)
+	}
+	c, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("hotreload: %s: %w", path, err)
+	}
+	s := &Store{path: path, bus: bus, last: data}
+	s.cur.Store(c)
+	return s, nil
+}
+
+// Load returns the current config. It's a single atomic load, cheap enough
+// to call on every request. The Config must not be modified
+func (s *Store) Load() *Config { return s.cur.Load() }
+
+// Reload rereads the file. A file that hasn't changed is left alone; a
+// file that's broken is an error and the current config stays - a typo
+// shouldn't take the server's settings with it. Otherwise the new config
+// is swapped in and published, and changed is true. The swap happens
+// first, so a subscriber that calls Load sees what it was sent
+func (s *Store) Reload(ctx context.Context) (changed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, fmt.Errorf("hotreload: %w", err)
+	}
+	if bytes.Equal(data, s.last) {
+		return false, nil
+	}
+	c, err := parse(data)
+	if err != nil {
+		return false, fmt.Errorf("hotreload: %s: %w", s.path, err)
+	}
+	s.cur.Store(c)
+	s.last = data
+
+	if _, err := s.bus.Publish(ctx, Topic, c); err != nil {
+		return true, fmt.Errorf("hotreload: publishing: %w", err)
+	}
+	return true, nil
+}
+
+// Watch reloads whenever a signal arrives on hup, and every interval,
+// until ctx is done. Failed reloads are logged and watching carries on
+func (s *Store) Watch(ctx context.Context, hup <-chan os.Signal, interval time.Duration, clk clock.Clock, logger *log.Logger) {
+	for {
+		tick := clk.After(interval)
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-hup:
+			logger.Printf("hotreload: %v, reloading %s", sig, s.path)
+		case <-tick:
+		}
+
+		changed, err := s.Reload(ctx)
+		switch {
+		case err != nil:
+			logger.Printf("%v", err)
+		case changed:
+			logger.Printf("hotreload: reloaded %s", s.path)
+		}
+	}
+}
+
+// NotifyReload returns a channel receiving the platform's reload signal -
+// SIGHUP where there is one - for Watch, and a func to stop
+func NotifyReload() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	sigs := reloadSignals()
+	if len(sigs) == 0 {
+		// signal.Notify with no signals means every signal, not none
+		return ch, func() {}
+	}
+	signal.Notify(ch, sigs...)
+	return ch, func() { signal.Stop(ch) }
+}
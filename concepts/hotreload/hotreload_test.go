@@ -0,0 +1,282 @@
+package hotreload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var levels = []string{"debug", "info", "warn", "error"}
+
+// generation writes config number n. Every field is derived from n, so a
+// reader that sees fields from two different generations can tell
+func generation(t *testing.T, path string, n int) {
+	t.Helper()
+	contents := fmt.Sprintf("log_level: %s\nrate_limit:\n  rate: %d\n  burst: %d\n", levels[n%len(levels)], n, n*10)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+}
+
+func consistent(c *Config) bool {
+	n := int(c.RateLimit.Rate)
+	return c.RateLimit.Burst == n*10 && c.LogLevel == levels[n%len(levels)]
+}
+
+func open(t *testing.T) (*Store, *pubsub.Bus[*Config], string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	generation(t, path, 1)
+	bus := pubsub.New[*Config]()
+	t.Cleanup(bus.Close)
+	s, err := Open(path, bus)
+	require.NoError(t, err)
+	return s, bus, path
+}
+
+func TestReload(t *testing.T) {
+	s, bus, path := open(t)
+	sub := bus.Subscribe(Topic)
+	ctx := context.Background()
+	assert.Equal(t, &Config{LogLevel: "info", RateLimit: RateLimit{Rate: 1, Burst: 10}}, s.Load())
+
+	changed, err := s.Reload(ctx)
+	require.NoError(t, err)
+	assert.False(t, changed, "same file")
+
+	old := s.Load()
+	generation(t, path, 2)
+	changed, err = s.Reload(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "warn", s.Load().LogLevel)
+	assert.Same(t, s.Load(), <-sub.C)
+	assert.Equal(t, "info", old.LogLevel, "a reload makes a new Config, the old one is untouched")
+
+	for name, contents := range map[string]string{
+		"unknown key":   "log_level: info\nrate_limt:\n  rate: 1\n",
+		"invalid level": "log_level: loud\nrate_limit:\n  rate: 1\n  burst: 1\n",
+		"zero rate":     "log_level: info\nrate_limit:\n  rate: 0\n  burst: 1\n",
+		"not yaml":      "log_level: [",
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+		changed, err := s.Reload(ctx)
+		assert.Error(t, err, name)
+		assert.False(t, changed, name)
+		assert.Equal(t, "warn", s.Load().LogLevel, "%s keeps the last good config", name)
+	}
+	assert.Empty(t, sub.C, "nothing published for a failed reload")
+
+	require.NoError(t, os.Remove(path))
+	_, err = s.Reload(ctx)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = Open(path, bus)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidateReportsEverything(t *testing.T) {
+	err := (&Config{LogLevel: "loud"}).Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "log_level")
+	assert.Contains(t, err.Error(), "rate_limit.rate")
+	assert.Contains(t, err.Error(), "rate_limit.burst")
+}
+
+// run with -race: readers hammer Load while the config is reloaded over and
+// over, and none of them may see a torn config
+func TestReloadUnderConcurrentReads(t *testing.T) {
+	s, bus, path := open(t)
+	sub := bus.Subscribe(Topic, pubsub.WithPolicy(pubsub.Block))
+
+	const reloads = 50
+	stop := make(chan struct{})
+	var reads atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := 0.0
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				c := s.Load()
+				if !consistent(c) {
+					t.Errorf("torn config: %+v", c)
+					return
+				}
+				if c.RateLimit.Rate < last {
+					t.Errorf("went back from generation %v to %v", last, c.RateLimit.Rate)
+					return
+				}
+				last = c.RateLimit.Rate
+				reads.Add(1)
+			}
+		}()
+	}
+
+	// the subscriber gets every reload, in order
+	received := make(chan []float64)
+	go func() {
+		var rates []float64
+		for c := range sub.C {
+			rates = append(rates, c.RateLimit.Rate)
+		}
+		received <- rates
+	}()
+
+	for n := 2; n <= reloads+1; n++ {
+		generation(t, path, n)
+		changed, err := s.Reload(context.Background())
+		require.NoError(t, err)
+		require.True(t, changed)
+	}
+	// the reloads can be over before a reader has been scheduled at all
+	for reads.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(stop)
+	wg.Wait()
+	sub.Unsubscribe()
+
+	rates := <-received
+	require.Len(t, rates, reloads)
+	for i, r := range rates {
+		assert.Equal(t, float64(i+2), r)
+	}
+	assert.Equal(t, float64(reloads+1), s.Load().RateLimit.Rate)
+	assert.Positive(t, reads.Load())
+}
+
+func TestWatch(t *testing.T) {
+	s, bus, path := open(t)
+	sub := bus.Subscribe(Topic)
+	clk := clock.NewFake(epoch)
+	hup := make(chan os.Signal)
+	var logs syncBuffer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Watch(ctx, hup, 10*time.Second, clk, log.New(&logs, "", 0))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// a signal reloads straight away, without the clock moving
+	generation(t, path, 2)
+	hup <- os.Interrupt
+	assert.Equal(t, 2.0, (<-sub.C).RateLimit.Rate)
+
+	// and so does the poll
+	generation(t, path, 3)
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Second)
+	assert.Equal(t, 3.0, (<-sub.C).RateLimit.Rate)
+
+	// a bad file is logged and watching carries on
+	require.NoError(t, os.WriteFile(path, []byte("log_level: [\n"), 0o644))
+	hup <- os.Interrupt
+	// hup is unbuffered, so this send waits for the reload above to finish
+	hup <- os.Interrupt
+	generation(t, path, 4)
+	hup <- os.Interrupt
+	assert.Equal(t, 4.0, (<-sub.C).RateLimit.Rate)
+	assert.Contains(t, logs.String(), "hotreload: "+path)
+}
+
+func TestServerFollowsReloads(t *testing.T) {
+	s, bus, path := open(t)
+	clk := clock.NewFake(epoch)
+	var logs syncBuffer
+
+	// generation 1: info, 1 per second, burst 10
+	srv := NewServer(s, bus, clk, &logs)
+	defer srv.Close()
+	get := func() int {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Code
+	}
+	codes := func(n int) []int {
+		var cs []int
+		for i := 0; i < n; i++ {
+			cs = append(cs, get())
+		}
+		return cs
+	}
+	reload := func(n int) {
+		generation(t, path, n)
+		_, err := s.Reload(context.Background())
+		require.NoError(t, err)
+		// Publish returns once the server has the config in its buffer, it
+		// may not have applied it yet
+		require.Eventually(t, func() bool { return srv.Applied() == s.Load() }, time.Second, time.Millisecond)
+	}
+
+	assert.Equal(t, []int{200, 200, 200, 200, 200, 200, 200, 200, 200, 200, 429}, codes(11))
+	assert.NotContains(t, logs.String(), "level=DEBUG")
+
+	// generation 4 is debug, 4 per second, burst 40. The new limiter
+	// starts full
+	reload(4)
+	assert.Len(t, filter(codes(41), 200), 40)
+	assert.Contains(t, logs.String(), "level=DEBUG msg=request")
+
+	// generation 6 is warn: the debug lines stop
+	reload(6)
+	before := strings.Count(logs.String(), "msg=request")
+	codes(5)
+	assert.Equal(t, before, strings.Count(logs.String(), "msg=request"))
+}
+
+func filter(codes []int, want int) []int {
+	var out []int
+	for _, c := range codes {
+		if c == want {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// syncBuffer is a log destination the test and the goroutines can share
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package hotreload
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyReload(t *testing.T) {
+	ch, stop := NotifyReload()
+	defer stop()
+
+	assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+	select {
+	case sig := <-ch:
+		assert.Equal(t, syscall.SIGHUP, sig)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no SIGHUP")
+	}
+}
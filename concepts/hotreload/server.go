@@ -0,0 +1,106 @@
+package hotreload
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+	"github.com/thorntonmc/go-practice/concepts/ratelimit"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// Server is a handler whose log level and rate limit follow the config.
+// Neither is read from the Store per request: slog.LevelVar is made for
+// changing a running logger's level, and the limiter is rebuilt with the
+// new rate and swapped in - the same atomic pointer trick one level down
+type Server struct {
+	clk     clock.Clock
+	level   slog.LevelVar
+	logger  *slog.Logger
+	limiter atomic.Pointer[ratelimit.TokenBucket]
+
+	sub  *pubsub.Subscription[*Config]
+	done chan struct{}
+
+	mu      sync.Mutex
+	applied *Config // the last config applied, for tests and a debug page
+}
+
+// NewServer applies store's current config and follows every one published
+// on bus afterwards, until Close. It subscribes with Block: a dropped
+// reload would leave the server on the old settings until the next one
+func NewServer(store *Store, bus *pubsub.Bus[*Config], clk clock.Clock, logs io.Writer) *Server {
+	s := &Server{clk: clk, done: make(chan struct{})}
+	s.logger = slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: &s.level}))
+
+	// subscribe before reading the current config, so a reload in between
+	// isn't missed. Applying the same config twice does no harm
+	s.sub = bus.Subscribe(Topic, pubsub.WithPolicy(pubsub.Block), pubsub.WithBuffer(1))
+	s.apply(store.Load())
+	go func() {
+		defer close(s.done)
+		for c := range s.sub.C {
+			s.apply(c)
+		}
+	}()
+	return s
+}
+
+func (s *Server) apply(c *Config) {
+	level, _ := parseLevel(c.LogLevel) // validated when it was loaded
+	s.level.Set(level)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a new bucket starts full, so a reload is a free burst. Keeping the
+	// old one when only the log level changed at least avoids that
+	if s.applied == nil || s.applied.RateLimit != c.RateLimit {
+		s.limiter.Store(ratelimit.NewTokenBucket(c.RateLimit.Rate, c.RateLimit.Burst, s.clk))
+	}
+	s.applied = c
+	s.logger.Info("config applied", "log_level", c.LogLevel, "rate", c.RateLimit.Rate, "burst", c.RateLimit.Burst)
+}
+
+// Applied is the config the server is running with
+func (s *Server) Applied() *Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applied
+}
+
+// Close stops following reloads
+func (s *Server) Close() {
+	s.sub.Unsubscribe()
+	<-s.done
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ok, retry := s.limiter.Load().Allow(); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		s.logger.Warn("rate limited", "path", r.URL.Path)
+		return
+	}
+	s.logger.Debug("request", "method", r.Method, "path", r.URL.Path)
+	fmt.Fprintln(w, "ok")
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	switch s {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("log_level must be debug, info, warn or error, got %q", s)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package hotreload
+
+import "os"
+
+// no SIGHUP off unix, polling the file is the only trigger
+func reloadSignals() []os.Signal {
+	return nil
+}
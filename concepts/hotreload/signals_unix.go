@@ -0,0 +1,14 @@
+//go:build unix
+
+package hotreload
+
+import (
+	"os"
+	"syscall"
+)
+
+// SIGHUP was "your terminal hung up". Daemons have no terminal, so it was
+// free to reuse, and "reread your config" is what it came to mean
+func reloadSignals() []os.Signal {
+	return []os.Signal{syscall.SIGHUP}
+}
@@ -0,0 +1,276 @@
+package httputil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// net/http/httputil has DumpRequest, DumpRequestOut and DumpResponse, which
+// turn a request or response into the exact bytes that go over the wire.
+// Great for debugging, and since http.ReadResponse can parse those bytes back,
+// also enough to build a record and replay ("VCR") tool for tests: record real
+// responses once, save them as a fixture, and replay them forever after
+// without the network
+
+/*
+ *
+ * dumping
+ *
+ */
+
+// DumpRequest is for requests a client is about to send. DumpRequestOut
+// includes the headers the transport adds, like User-Agent and
+// Accept-Encoding. On a server, httputil.DumpRequest is the one to use
+func DumpRequest(r *http.Request) (string, error) {
+	b, err := httputil.DumpRequestOut(r, true)
+	return string(b), err
+}
+
+// DumpResponse reads the whole body to dump it, and then swaps in a copy so
+// resp can still be read afterwards
+func DumpResponse(resp *http.Response) (string, error) {
+	b, err := httputil.DumpResponse(resp, true)
+	return string(b), err
+}
+
+/*
+ *
+ * cassettes
+ *
+ */
+
+// Interaction is one recorded request and its response, as wire dumps
+type Interaction struct {
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+	Request  string `json:"request"`
+	Response string `json:"response"`
+}
+
+// A Cassette is a list of interactions, saved as JSON so the fixtures are
+// readable in a diff
+type Cassette struct {
+	mu           sync.Mutex
+	Interactions []Interaction `json:"interactions"`
+	played       map[int]bool
+}
+
+// ErrNoInteraction is returned when replaying a request that was never recorded
+var ErrNoInteraction = errors.New("no recorded interaction for request")
+
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cassette{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("loading cassette %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o644)
+}
+
+func (c *Cassette) add(i Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Interactions = append(c.Interactions, i)
+}
+
+// next finds the first interaction for method and url that hasn't been played
+// yet, so a URL that was requested several times replays its responses in order.
+// Once they've all been played, the last one keeps being returned
+func (c *Cassette) next(method, url string) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.played == nil {
+		c.played = map[int]bool{}
+	}
+
+	last := -1
+	for i, in := range c.Interactions {
+		if in.Method != method || in.URL != url {
+			continue
+		}
+		last = i
+		if !c.played[i] {
+			c.played[i] = true
+			return in, true
+		}
+	}
+
+	if last == -1 {
+		return Interaction{}, false
+	}
+	return c.Interactions[last], true
+}
+
+/*
+ *
+ * record
+ *
+ */
+
+// Recorder is a RoundTripper that passes requests on to next, adding every
+// request and response to Cassette
+type Recorder struct {
+	next     http.RoundTripper
+	Cassette *Cassette
+}
+
+func NewRecorder(next http.RoundTripper) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &Recorder{next: next, Cassette: &Cassette{}}
+}
+
+func (rec *Recorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	// dumping reads the body, so dump a copy and send the original
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dumpReq := r.Clone(r.Context())
+	dumpReq.Body = io.NopCloser(bytes.NewReader(body))
+	reqDump, err := DumpRequest(dumpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	sent := r.Clone(r.Context())
+	if r.Body != nil {
+		sent.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := rec.next.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+
+	respDump, err := DumpResponse(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	rec.Cassette.add(Interaction{
+		Method:   r.Method,
+		URL:      r.URL.String(),
+		Request:  reqDump,
+		Response: respDump,
+	})
+
+	return resp, nil
+}
+
+/*
+ *
+ * replay
+ *
+ */
+
+// Transport replays the cassette to a client. Nothing goes over the network
+func (c *Cassette) Transport() http.RoundTripper {
+	return replayTransport{c}
+}
+
+type replayTransport struct {
+	c *Cassette
+}
+
+func (t replayTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	in, ok := t.c.next(r.Method, r.URL.String())
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, r.Method, r.URL)
+	}
+
+	return http.ReadResponse(bufio.NewReader(strings.NewReader(in.Response)), r)
+}
+
+// Handler is a tiny replay server. It matches on method and path+query only,
+// so a cassette recorded against one host can be served from httptest
+func (c *Cassette) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in, ok := c.nextByRequestURI(r.Method, r.URL.RequestURI())
+		if !ok {
+			http.Error(w, ErrNoInteraction.Error(), http.StatusNotFound)
+			return
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(in.Response)), r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer resp.Body.Close()
+
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		// the body is written unchunked, whatever it was recorded as
+		w.Header().Del("Transfer-Encoding")
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	})
+}
+
+func (c *Cassette) nextByRequestURI(method, requestURI string) (Interaction, bool) {
+	c.mu.Lock()
+	var url string
+	for _, in := range c.Interactions {
+		if in.Method == method && hostless(in.URL) == requestURI {
+			url = in.URL
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if url == "" {
+		return Interaction{}, false
+	}
+	return c.next(method, url)
+}
+
+// hostless turns http://host/path?q into /path?q
+func hostless(url string) string {
+	rest := url
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		return rest[i:]
+	}
+	return "/"
+}
@@ -0,0 +1,110 @@
+package httputil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCountingServer(t *testing.T) (*httptest.Server, *int32) {
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := atomic.AddInt32(&n, 1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Call", string(rune('0'+count)))
+		io.WriteString(w, r.Method+" "+r.URL.RequestURI()+" "+string(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+// reader returns a function that can be called directly with the results of
+// client.Get and friends
+func reader(t *testing.T) func(*http.Response, error) (*http.Response, string) {
+	return func(resp *http.Response, err error) (*http.Response, string) {
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(b)
+	}
+}
+
+func TestDump(t *testing.T) {
+	srv, _ := newCountingServer(t)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/todos", strings.NewReader("title=learn"))
+	dump, err := DumpRequest(req)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dump, "POST /todos HTTP/1.1\r\n"))
+	assert.True(t, strings.HasSuffix(dump, "\r\n\r\ntitle=learn"))
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	dump, err = DumpResponse(resp)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dump, "HTTP/1.1 200 OK\r\n"))
+
+	// the body survives being dumped
+	_, body := reader(t)(resp, nil)
+	assert.Equal(t, "POST /todos title=learn", body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	readAll := reader(t)
+	srv, calls := newCountingServer(t)
+	rec := NewRecorder(srv.Client().Transport)
+	c := &http.Client{Transport: rec}
+
+	_, first := readAll(c.Get(srv.URL + "/todos/1"))
+	_, second := readAll(c.Get(srv.URL + "/todos/1"))
+	_, posted := readAll(c.Post(srv.URL+"/todos", "text/plain", strings.NewReader("new")))
+	assert.Equal(t, "POST /todos new", posted)
+
+	path := filepath.Join(t.TempDir(), "todos.json")
+	require.NoError(t, rec.Cassette.Save(path))
+	srv.Close()
+
+	cassette, err := LoadCassette(path)
+	require.NoError(t, err)
+	require.Len(t, cassette.Interactions, 3)
+	replay := &http.Client{Transport: cassette.Transport()}
+
+	resp, got := readAll(replay.Get(srv.URL + "/todos/1"))
+	assert.Equal(t, first, got)
+	assert.Equal(t, "1", resp.Header.Get("X-Call"))
+	resp, got = readAll(replay.Get(srv.URL + "/todos/1"))
+	assert.Equal(t, second, got)
+	assert.Equal(t, "2", resp.Header.Get("X-Call"))
+	_, got = readAll(replay.Post(srv.URL+"/todos", "text/plain", nil))
+	assert.Equal(t, posted, got)
+
+	_, err = replay.Get(srv.URL + "/never")
+	assert.ErrorIs(t, err, ErrNoInteraction)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestReplayServer(t *testing.T) {
+	readAll := reader(t)
+	srv, _ := newCountingServer(t)
+	rec := NewRecorder(srv.Client().Transport)
+	_, want := readAll((&http.Client{Transport: rec}).Get(srv.URL + "/todos?done=true"))
+
+	replay := httptest.NewServer(rec.Cassette.Handler())
+	defer replay.Close()
+
+	resp, got := readAll(http.Get(replay.URL + "/todos?done=true"))
+	assert.Equal(t, want, got)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+
+	resp, _ = readAll(http.Get(replay.URL + "/todos"))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
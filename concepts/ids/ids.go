@@ -0,0 +1,201 @@
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// An ID has to be unique, and it's nice if it can be made without asking
+// anyone - no database sequence, no coordinator - so any process can mint
+// one offline. The ways of doing that trade off differently:
+//
+//   - UUIDv4 is 122 random bits. Collisions are as close to impossible as
+//     matters (a billion a second for 85 years before a 50% chance of
+//     one), and it gives nothing away. But random means every new row
+//     lands somewhere random in a B-tree index: a different page each
+//     insert, so the working set is the whole index, pages split all
+//     over, and the cache does nothing
+//   - UUIDv7 (RFC 9562) starts with a 48-bit millisecond timestamp and
+//     fills the rest with random bits. New ids sort after old ones, so
+//     inserts go to the right-hand edge of the index like an
+//     auto-increment would, and it still fits a uuid column. The price is
+//     that an id tells anyone when it was made
+//   - a ULID is the same idea - 48-bit time, 80 random bits - written as 26
+//     characters of Crockford base32 instead of 36 of hex and dashes, so
+//     its string form sorts the same as its bytes. Handy as a text key or
+//     in a URL
+//   - a snowflake (Twitter's scheme, also Discord's and Instagram's) packs
+//     a timestamp, a worker number and a per-worker sequence into an int64.
+//     Half the size, fits a bigint, and strictly ordered per worker - but
+//     every worker needs a distinct number, which is coordination of a kind
+//
+// Time-ordered ids made in the same millisecond need something else to
+// keep them in order. The generators here count within a millisecond (v7's
+// 12-bit counter, ULID's random part plus one, the snowflake sequence), and
+// if that runs out, or the clock steps backwards, they carry on from the
+// last timestamp they used rather than go backwards themselves. Order
+// holds within one generator; between machines it's only as good as their
+// clocks
+
+// UUID is 16 bytes, printed as 8-4-4-4-12 hex
+type UUID [16]byte
+
+// random fills b from crypto/rand, which doesn't fail on any platform Go
+// supports. math/rand would be faster, and predictable: someone who sees a
+// few ids could work out the next
+func random(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("ids: crypto/rand: %v", err))
+	}
+}
+
+// NewV4 is a random UUID
+func NewV4() UUID {
+	var u UUID
+	random(u[:])
+	u.setVersion(4)
+	return u
+}
+
+// setVersion sets the four version bits, and the two variant bits that say
+// this is an RFC 9562 UUID at all
+func (u *UUID) setVersion(v byte) {
+	u[6] = u[6]&0x0f | v<<4
+	u[8] = u[8]&0x3f | 0x80
+}
+
+// Version is 4 or 7 for the UUIDs made here
+func (u UUID) Version() int { return int(u[6] >> 4) }
+
+// Time is when a v7 UUID was made, to the millisecond. It's zero for other
+// versions, which don't record one
+func (u UUID) Time() time.Time {
+	if u.Version() != 7 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(getUint48(u[:6])))
+}
+
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+var errBadUUID = errors.New("ids: a UUID is 36 characters, 8-4-4-4-12 hex digits")
+
+// ParseUUID reads the String form, in either case
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, errBadUUID
+	}
+	src := []byte(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+	if _, err := hex.Decode(u[:], src); err != nil {
+		return u, errBadUUID
+	}
+	return u, nil
+}
+
+func (u UUID) MarshalText() ([]byte, error) { return []byte(u.String()), nil }
+
+func (u *UUID) UnmarshalText(b []byte) (err error) {
+	*u, err = ParseUUID(string(b))
+	return err
+}
+
+/*
+ *
+ * time-ordered
+ *
+ */
+
+// Generator makes UUIDv7s and ULIDs from clk, each in strictly increasing
+// order. It's safe for concurrent use
+type Generator struct {
+	clk clock.Clock
+
+	mu   sync.Mutex
+	v7   struct{ ms, counter uint64 }
+	ulid struct {
+		ms   uint64
+		rand [10]byte
+	}
+}
+
+func NewGenerator(clk clock.Clock) *Generator {
+	return &Generator{clk: clk}
+}
+
+// std backs NewV7 and NewULID
+var std = NewGenerator(clock.New())
+
+// NewV7 is a time-ordered UUID, increasing across every call in this
+// process
+func NewV7() UUID { return std.V7() }
+
+// counterBits is v7's counter, which starts each millisecond at a random
+// value below half its range, leaving room for at least 2048 more
+const counterBits = 12
+
+// V7 is a UUIDv7: 48 bits of unix milliseconds, the version, a 12-bit
+// counter, the variant, and 62 random bits
+func (g *Generator) V7() UUID {
+	now := uint64(g.clk.Now().UnixMilli())
+
+	g.mu.Lock()
+	switch {
+	case now > g.v7.ms:
+		g.v7.ms, g.v7.counter = now, randomCounter()
+	case g.v7.counter < 1<<counterBits-1:
+		g.v7.counter++
+	default:
+		// the counter is used up: borrow the next millisecond
+		g.v7.ms, g.v7.counter = g.v7.ms+1, randomCounter()
+	}
+	ms, counter := g.v7.ms, g.v7.counter
+	g.mu.Unlock()
+
+	var u UUID
+	random(u[8:])
+	putUint48(u[:6], ms)
+	u[6] = byte(counter >> 8)
+	u[7] = byte(counter)
+	u.setVersion(7)
+	return u
+}
+
+func randomCounter() uint64 {
+	var b [2]byte
+	random(b[:])
+	return (uint64(b[0])<<8 | uint64(b[1])) & (1<<(counterBits-1) - 1)
+}
+
+func putUint48(b []byte, v uint64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
+
+func getUint48(b []byte) uint64 {
+	var v uint64
+	for _, c := range b[:6] {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
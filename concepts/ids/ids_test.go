@@ -0,0 +1,309 @@
+package ids
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+var start = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestV4(t *testing.T) {
+	seen := make(map[UUID]bool)
+	for i := 0; i < 100000; i++ {
+		u := NewV4()
+		require.False(t, seen[u], "collision")
+		seen[u] = true
+	}
+
+	u := NewV4()
+	assert.Equal(t, 4, u.Version())
+	assert.True(t, u.Time().IsZero())
+
+	// google/uuid agrees on the format, version and variant
+	g, err := uuid.Parse(u.String())
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Version(4), g.Version())
+	assert.Equal(t, uuid.RFC4122, g.Variant())
+	assert.Equal(t, [16]byte(u), [16]byte(g))
+}
+
+func TestParseUUID(t *testing.T) {
+	u, err := ParseUUID("0190F4A2-7C3E-7B11-8F00-00000000ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, "0190f4a2-7c3e-7b11-8f00-00000000abcd", u.String())
+	assert.Equal(t, 7, u.Version())
+
+	for _, bad := range []string{"", "0190f4a27c3e7b118f0000000000abcd", "0190f4a2-7c3e-7b11-8f00-00000000abcg", "0190f4a2-7c3e-7b118-f00-00000000abcd"} {
+		_, err := ParseUUID(bad)
+		assert.Error(t, err, bad)
+	}
+
+	b, err := json.Marshal(struct{ ID UUID }{u})
+	require.NoError(t, err)
+	assert.Equal(t, `{"ID":"0190f4a2-7c3e-7b11-8f00-00000000abcd"}`, string(b))
+	var back struct{ ID UUID }
+	require.NoError(t, json.Unmarshal(b, &back))
+	assert.Equal(t, u, back.ID)
+}
+
+func TestV7(t *testing.T) {
+	clk := clock.NewFake(start)
+	g := NewGenerator(clk)
+
+	u := g.V7()
+	assert.Equal(t, 7, u.Version())
+	assert.Equal(t, start, u.Time().UTC())
+
+	gu, err := uuid.Parse(u.String())
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Version(7), gu.Version())
+	assert.Equal(t, uuid.RFC4122, gu.Variant())
+	sec, nsec := gu.Time().UnixTime()
+	assert.Equal(t, start, time.Unix(sec, nsec).UTC(), "google/uuid reads the same time")
+}
+
+func TestMonotonic(t *testing.T) {
+	// 10000 ids in one frozen millisecond is more than v7's counter holds,
+	// then the clock steps back a second: every id is still larger than the
+	// one before, as bytes and as a string
+	clk := clock.NewFake(start)
+	g := NewGenerator(clk)
+	sf, err := NewSnowflake(3, clk)
+	require.NoError(t, err)
+
+	var (
+		lastV7   UUID
+		lastULID ULID
+		lastSF   int64
+	)
+	for i := 0; i < 20000; i++ {
+		if i == 10000 {
+			clk = clock.NewFake(start.Add(-time.Second))
+			g.clk, sf.clk = clk, clk
+		}
+		v7, ulid, id := g.V7(), g.ULID(), sf.Next()
+
+		require.Positive(t, bytes.Compare(v7[:], lastV7[:]), "v7 %d", i)
+		require.Greater(t, v7.String(), lastV7.String())
+		require.Positive(t, bytes.Compare(ulid[:], lastULID[:]), "ulid %d", i)
+		require.Greater(t, ulid.String(), lastULID.String())
+		require.Greater(t, id, lastSF, "snowflake %d", i)
+		lastV7, lastULID, lastSF = v7, ulid, id
+	}
+
+	// the borrowed milliseconds don't run far ahead: 4096 per ms for the
+	// snowflake, at least 2048 for v7
+	assert.WithinDuration(t, start, lastV7.Time(), 20*time.Millisecond)
+	ts, _, _ := SnowflakeParts(lastSF)
+	assert.WithinDuration(t, start, ts, 5*time.Millisecond)
+	assert.Equal(t, start, lastULID.Time().UTC(), "80 random bits don't run out")
+}
+
+func TestULIDEncoding(t *testing.T) {
+	var zero, ones ULID
+	for i := range ones {
+		ones[i] = 0xff
+	}
+	assert.Equal(t, "00000000000000000000000000", zero.String())
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", ones.String())
+
+	// the spec's example: its time part is 1469918176385
+	id, err := ParseULID("01ARYZ6S41TSV4RRFFQ69G5FAV")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1469918176385), id.Time().UnixMilli())
+	assert.Equal(t, "01ARYZ6S41TSV4RRFFQ69G5FAV", id.String())
+
+	lower, err := ParseULID("01aryz6s41tsv4rrffq69g5fav")
+	require.NoError(t, err)
+	assert.Equal(t, id, lower)
+	lookalike, err := ParseULID("O1ARYZ6S4ITSV4RRFFQ69G5FAV")
+	require.NoError(t, err)
+	assert.Equal(t, id, lookalike, "O reads as 0, I as 1")
+
+	for _, bad := range []string{"", "01ARYZ6S41TSV4RRFFQ69G5FA", "81ARYZ6S41TSV4RRFFQ69G5FAV", "01ARYZ6S41TSV4RRFFQ69G5FAU"} {
+		_, err := ParseULID(bad)
+		assert.Error(t, err, bad)
+	}
+
+	for i := 0; i < 1000; i++ {
+		id := NewULID()
+		back, err := ParseULID(id.String())
+		require.NoError(t, err)
+		require.Equal(t, id, back)
+	}
+}
+
+func TestSnowflake(t *testing.T) {
+	_, err := NewSnowflake(MaxWorker+1, clock.New())
+	assert.Error(t, err)
+	_, err = NewSnowflake(-1, clock.New())
+	assert.Error(t, err)
+
+	clk := clock.NewFake(start)
+	a, err := NewSnowflake(1, clk)
+	require.NoError(t, err)
+	b, err := NewSnowflake(2, clk)
+	require.NoError(t, err)
+
+	idA, idB := a.Next(), b.Next()
+	assert.NotEqual(t, idA, idB, "same millisecond, different workers")
+	ts, worker, seq := SnowflakeParts(a.Next())
+	assert.Equal(t, start, ts)
+	assert.Equal(t, int64(1), worker)
+	assert.Equal(t, int64(1), seq)
+
+	clk.Advance(time.Millisecond)
+	ts, _, seq = SnowflakeParts(a.Next())
+	assert.Equal(t, start.Add(time.Millisecond), ts)
+	assert.Equal(t, int64(0), seq, "the sequence starts again each millisecond")
+}
+
+func TestSnowflakeBeforeEpoch(t *testing.T) {
+	_, err := NewSnowflake(1, clock.NewFake(Epoch.Add(-time.Millisecond)))
+	assert.Error(t, err)
+
+	// a clock stepped back past Epoch later on still makes positive,
+	// increasing ids
+	clk := clock.NewFake(Epoch)
+	sf, err := NewSnowflake(1, clk)
+	require.NoError(t, err)
+	last := sf.Next()
+	clk.Advance(-time.Hour)
+	for i := 0; i < 10; i++ {
+		id := sf.Next()
+		assert.Greater(t, id, last)
+		last = id
+	}
+}
+
+func TestNoCollisionsConcurrently(t *testing.T) {
+	const goroutines, each = 8, 5000
+	g := NewGenerator(clock.New())
+	var sfs [goroutines]*Snowflake
+	for i := range sfs {
+		var err error
+		sfs[i], err = NewSnowflake(int64(i), clock.New())
+		require.NoError(t, err)
+	}
+
+	var (
+		mu   sync.Mutex
+		seen = map[string]bool{}
+		dups int
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(sf *Snowflake) {
+			defer wg.Done()
+			ids := make([]string, 0, 4*each)
+			for j := 0; j < each; j++ {
+				ids = append(ids, NewV4().String(), g.V7().String(), g.ULID().String(), strconv.FormatInt(sf.Next(), 10))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				if seen[id] {
+					dups++
+				}
+				seen[id] = true
+			}
+		}(sfs[i])
+	}
+	wg.Wait()
+	assert.Zero(t, dups)
+	assert.Len(t, seen, goroutines*each*4)
+}
+
+// outOfOrder is the fraction of ids that aren't the largest yet when made.
+// In a B-tree index each of those is an insert into the middle, on a page
+// that may not be in cache and may have to split; the rest append at the
+// right-hand edge
+func outOfOrder(n int, next func() string) float64 {
+	var max string
+	late := 0
+	for i := 0; i < n; i++ {
+		id := next()
+		if id < max {
+			late++
+		} else {
+			max = id
+		}
+	}
+	return float64(late) / float64(n)
+}
+
+func TestIndexLocality(t *testing.T) {
+	g := NewGenerator(clock.New())
+	sf, err := NewSnowflake(1, clock.New())
+	require.NoError(t, err)
+
+	assert.Greater(t, outOfOrder(10000, func() string { return NewV4().String() }), 0.9, "v4 lands anywhere")
+	assert.Zero(t, outOfOrder(10000, func() string { return g.V7().String() }))
+	assert.Zero(t, outOfOrder(10000, func() string { return g.ULID().String() }))
+	// zero-padded so string order is numeric order
+	assert.Zero(t, outOfOrder(10000, func() string { return fmt.Sprintf("%020d", sf.Next()) }))
+}
+
+// BenchmarkSortedInsert keeps a sorted slice, the way an index does, and
+// shows the cost of inserting into the middle: every random v4 shifts half
+// the slice, every time-ordered id appends
+func BenchmarkSortedInsert(b *testing.B) {
+	g := NewGenerator(clock.New())
+	for _, bc := range []struct {
+		name string
+		next func() [16]byte
+	}{
+		{"v4", func() [16]byte { return NewV4() }},
+		{"v7", func() [16]byte { return g.V7() }},
+		{"ulid", func() [16]byte { return g.ULID() }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			index := make([][16]byte, 0, b.N)
+			for i := 0; i < b.N; i++ {
+				id := bc.next()
+				at := sort.Search(len(index), func(j int) bool { return bytes.Compare(index[j][:], id[:]) > 0 })
+				index = append(index, [16]byte{})
+				copy(index[at+1:], index[at:])
+				index[at] = id
+			}
+		})
+	}
+}
+
+func BenchmarkNew(b *testing.B) {
+	g := NewGenerator(clock.New())
+	sf, _ := NewSnowflake(1, clock.New())
+	b.Run("v4", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewV4()
+		}
+	})
+	b.Run("v7", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			g.V7()
+		}
+	})
+	b.Run("ulid", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			g.ULID()
+		}
+	})
+	b.Run("snowflake", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sf.Next()
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package ids
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// ULID is 48 bits of unix milliseconds then 80 random bits, printed as 26
+// characters of Crockford base32:
+//
+//	01ARYZ6S41TSV4RRFFQ69G5FAV
+//	|--------||--------------|
+//	   time       random
+type ULID [16]byte
+
+// NewULID is a ULID, increasing across every call in this process
+func NewULID() ULID { return std.ULID() }
+
+// ULID follows the spec's monotonic mode: within a millisecond the random
+// part of the last ULID plus one, so a burst still sorts in the order it
+// was made
+func (g *Generator) ULID() ULID {
+	now := uint64(g.clk.Now().UnixMilli())
+
+	g.mu.Lock()
+	if now > g.ulid.ms || !increment(g.ulid.rand[:]) {
+		// a new millisecond, or - once in 2^80 - the random part wrapped
+		// round, and the next millisecond is borrowed
+		g.ulid.ms = max(now, g.ulid.ms+1)
+		random(g.ulid.rand[:])
+	}
+	var id ULID
+	putUint48(id[:6], g.ulid.ms)
+	copy(id[6:], g.ulid.rand[:])
+	g.mu.Unlock()
+	return id
+}
+
+// increment adds one to b, big-endian. false means it overflowed to zero
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (id ULID) Time() time.Time { return time.UnixMilli(int64(getUint48(id[:6]))) }
+
+// crockford leaves out I, L, O and U: the first three look like 1 and 0,
+// and U avoids accidental obscenity
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// String is 26 characters of 5 bits each. That's 130 bits for 128, so the
+// first character only holds 3 and is never above 7
+func (id ULID) String() string {
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	var b [26]byte
+	for i := range b {
+		shift := uint(125 - 5*i) // where this character's bits start
+		var v uint64
+		switch {
+		case shift >= 64:
+			v = hi >> (shift - 64)
+		case shift+5 <= 64:
+			v = lo >> shift
+		default: // straddles the two halves
+			v = lo>>shift | hi<<(64-shift)
+		}
+		b[i] = crockford[v&31]
+	}
+	return string(b[:])
+}
+
+var errBadULID = errors.New("ids: a ULID is 26 characters of Crockford base32, starting 0-7")
+
+// decoding maps a character to its 5 bits, or 0xff. Lower case and the
+// letters Crockford treats as lookalikes are accepted too
+var decoding = func() (d [256]byte) {
+	for i := range d {
+		d[i] = 0xff
+	}
+	for i, c := range crockford {
+		d[c] = byte(i)
+		d[c|0x20] = byte(i) // lower case; digits are unchanged by it
+	}
+	for c, v := range map[byte]byte{'O': 0, 'o': 0, 'I': 1, 'i': 1, 'L': 1, 'l': 1} {
+		d[c] = v
+	}
+	return d
+}()
+
+func ParseULID(s string) (ULID, error) {
+	var id ULID
+	if len(s) != 26 || decoding[s[0]] > 7 {
+		return id, errBadULID
+	}
+	var hi, lo uint64
+	for i := 0; i < len(s); i++ {
+		v := decoding[s[i]]
+		if v == 0xff {
+			return id, errBadULID
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	binary.BigEndian.PutUint64(id[:8], hi)
+	binary.BigEndian.PutUint64(id[8:], lo)
+	return id, nil
+}
+
+func (id ULID) MarshalText() ([]byte, error) { return []byte(id.String()), nil }
+
+func (id *ULID) UnmarshalText(b []byte) (err error) {
+	*id, err = ParseULID(string(b))
+	return err
+}
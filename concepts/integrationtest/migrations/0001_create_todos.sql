@@ -0,0 +1,5 @@
+CREATE TABLE todos (
+	id        BIGSERIAL PRIMARY KEY,
+	title     TEXT    NOT NULL,
+	completed BOOLEAN NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,125 @@
+package integrationtest
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+
+	"github.com/thorntonmc/go-practice/apps/todo"
+	sqlconcept "github.com/thorntonmc/go-practice/concepts/sql"
+
+	// registers the "pgx" driver with database/sql
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// A fake or an in-memory sqlite database covers most of what a repository
+// does, but not all of it: the SQL dialect, constraints, how the real
+// server reports errors. Integration tests run against the real thing, and
+// testcontainers-go makes that a test helper rather than a docker-compose
+// file someone has to remember to start - the test starts a throwaway
+// Postgres in Docker, points the code at it, and removes it afterwards.
+//
+// They're slower and need Docker, so they sit behind a build tag, like
+// concepts/buildtags' integration test:
+//
+//	go test -tags integration ./concepts/integrationtest
+//
+// and skip rather than fail when Docker isn't running. The same
+// repository suite runs against todo.MemoryRepository in a plain go test,
+// so the two implementations are held to one standard
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open returns a pool for the Postgres database at dsn, with the schema
+// migrated by concepts/sql's migration runner
+func Open(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := sqlconcept.MigrateFS(ctx, db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Repository is a todo.TodoRepository in Postgres
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) List(ctx context.Context) ([]todo.Todo, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, title, completed FROM todos ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []todo.Todo{}
+	for rows.Next() {
+		var t todo.Todo
+		if err := rows.Scan(&t.ID, &t.Title, &t.Completed); err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, rows.Err()
+}
+
+func (r *Repository) Get(ctx context.Context, id int64) (todo.Todo, error) {
+	var t todo.Todo
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id, title, completed FROM todos WHERE id = $1", id).
+		Scan(&t.ID, &t.Title, &t.Completed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo.Todo{}, todo.ErrNotFound
+	}
+	return t, err
+}
+
+// Create uses RETURNING, Postgres drivers don't support LastInsertId
+func (r *Repository) Create(ctx context.Context, t todo.Todo) (todo.Todo, error) {
+	err := r.db.QueryRowContext(ctx,
+		"INSERT INTO todos (title, completed) VALUES ($1, $2) RETURNING id",
+		t.Title, t.Completed).
+		Scan(&t.ID)
+	return t, err
+}
+
+func (r *Repository) Update(ctx context.Context, t todo.Todo) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE todos SET title = $1, completed = $2 WHERE id = $3",
+		t.Title, t.Completed, t.ID)
+	return notFoundIfNone(res, err)
+}
+
+func (r *Repository) Delete(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM todos WHERE id = $1", id)
+	return notFoundIfNone(res, err)
+}
+
+// notFoundIfNone turns "changed no rows" into todo.ErrNotFound
+func notFoundIfNone(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return todo.ErrNotFound
+	}
+	return nil
+}
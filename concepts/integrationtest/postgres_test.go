@@ -0,0 +1,132 @@
+//go:build integration
+
+package integrationtest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/thorntonmc/go-practice/apps/todo"
+	sqlconcept "github.com/thorntonmc/go-practice/concepts/sql"
+)
+
+// One container serves the whole package - starting Postgres takes a few
+// seconds, creating a database in it a few milliseconds. Each test gets its
+// own database, so tests can't see each other's rows and can run in
+// parallel
+var pg struct {
+	dsn  string // the container's default database
+	skip string // why there's no container, when Docker isn't there
+	err  error  // the container failed to start, which is a real failure
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(runWithPostgres(m))
+}
+
+// runWithPostgres starts the container, runs the tests, and removes the
+// container again. If the process dies before Terminate runs,
+// testcontainers' reaper container removes it anyway
+func runWithPostgres(m *testing.M) int {
+	ctx := context.Background()
+
+	provider, err := testcontainers.ProviderDocker.GetProvider()
+	if err == nil {
+		err = provider.Health(ctx)
+	}
+	if err != nil {
+		pg.skip = fmt.Sprintf("docker isn't available: %v", err)
+		return m.Run()
+	}
+
+	c, err := postgres.RunContainer(ctx,
+		testcontainers.WithImage("postgres:16-alpine"),
+		postgres.WithDatabase("todos"),
+		postgres.WithUsername("todos"),
+		postgres.WithPassword("todos"),
+		// the server restarts once after running its init scripts, so
+		// wait for the second "ready"
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute)),
+	)
+	if err != nil {
+		pg.err = err
+		return m.Run()
+	}
+	defer c.Terminate(ctx)
+
+	pg.dsn, pg.err = c.ConnectionString(ctx, "sslmode=disable")
+	return m.Run()
+}
+
+var databases atomic.Int64
+
+// newDatabase creates an empty, migrated database for the test and drops
+// it when the test ends
+func newDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	if pg.skip != "" {
+		t.Skip(pg.skip)
+	}
+	require.NoError(t, pg.err, "starting postgres")
+
+	ctx := context.Background()
+	admin, err := sql.Open("pgx", pg.dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+
+	name := fmt.Sprintf("test_%d", databases.Add(1))
+	_, err = admin.ExecContext(ctx, "CREATE DATABASE "+name)
+	require.NoError(t, err)
+
+	u, err := url.Parse(pg.dsn)
+	require.NoError(t, err)
+	u.Path = "/" + name
+	db, err := Open(ctx, u.String())
+	require.NoError(t, err)
+
+	// cleanups run last-in first-out: close the pool, then drop
+	t.Cleanup(func() {
+		_, err := admin.ExecContext(ctx, "DROP DATABASE "+name+" WITH (FORCE)")
+		assert.NoError(t, err)
+	})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPostgresRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) todo.TodoRepository {
+		return NewRepository(newDatabase(t))
+	})
+}
+
+// what the in-memory repository can't show: the database enforcing its
+// schema
+func TestPostgresConstraints(t *testing.T) {
+	db := newDatabase(t)
+	_, err := db.ExecContext(context.Background(), "INSERT INTO todos (title) VALUES (NULL)")
+	assert.ErrorContains(t, err, "violates not-null constraint")
+}
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	db := newDatabase(t)
+	ctx := context.Background()
+	require.NoError(t, sqlconcept.MigrateFS(ctx, db, migrations))
+
+	var n int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*) FROM schema_migrations").Scan(&n))
+	assert.Equal(t, 1, n)
+}
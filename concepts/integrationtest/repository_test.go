@@ -0,0 +1,73 @@
+package integrationtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/apps/todo"
+)
+
+// testRepository is the behaviour every todo.TodoRepository should share.
+// newRepo returns an empty repository
+func testRepository(t *testing.T, newRepo func(t *testing.T) todo.TodoRepository) {
+	ctx := context.Background()
+
+	t.Run("create and get", func(t *testing.T) {
+		r := newRepo(t)
+		created, err := r.Create(ctx, todo.Todo{Title: "buy milk"})
+		require.NoError(t, err)
+		assert.NotZero(t, created.ID)
+
+		got, err := r.Get(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, created, got)
+	})
+
+	t.Run("list in id order", func(t *testing.T) {
+		r := newRepo(t)
+		empty, err := r.List(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, empty)
+
+		a, _ := r.Create(ctx, todo.Todo{Title: "a"})
+		b, _ := r.Create(ctx, todo.Todo{Title: "b", Completed: true})
+		got, err := r.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []todo.Todo{a, b}, got)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		r := newRepo(t)
+		created, _ := r.Create(ctx, todo.Todo{Title: "a"})
+		created.Completed = true
+		require.NoError(t, r.Update(ctx, created))
+
+		got, _ := r.Get(ctx, created.ID)
+		assert.True(t, got.Completed)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		r := newRepo(t)
+		created, _ := r.Create(ctx, todo.Todo{Title: "a"})
+		require.NoError(t, r.Delete(ctx, created.ID))
+
+		_, err := r.Get(ctx, created.ID)
+		assert.ErrorIs(t, err, todo.ErrNotFound)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		r := newRepo(t)
+		_, err := r.Get(ctx, 404)
+		assert.ErrorIs(t, err, todo.ErrNotFound)
+		assert.ErrorIs(t, r.Update(ctx, todo.Todo{ID: 404, Title: "x"}), todo.ErrNotFound)
+		assert.ErrorIs(t, r.Delete(ctx, 404), todo.ErrNotFound)
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) todo.TodoRepository {
+		return todo.NewMemoryRepository()
+	})
+}
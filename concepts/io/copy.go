@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io"
+)
+
+/*
+ *
+ * io.Copy, io.WriterTo and io.ReaderFrom
+ *
+ */
+
+// io.Copy(dst, src) looks like a loop of src.Read into a buffer and
+// dst.Write out of it, and that's the last thing it tries:
+//
+//  1. src is an io.WriterTo: return src.WriteTo(dst)
+//  2. dst is an io.ReaderFrom: return dst.ReadFrom(src)
+//  3. otherwise allocate a 32KB buffer (smaller for an io.LimitedReader
+//     with less left) and loop
+//
+// WriterTo means "I already have the bytes, I'll hand them to a Writer
+// myself" - a bytes.Reader writes its whole slice in one Write, no buffer,
+// no copy. ReaderFrom means "give me the Reader, I know a better way to fill
+// myself" - a bytes.Buffer reads straight into its own spare capacity.
+//
+// The big win is in the OS. *net.TCPConn's ReadFrom, handed an *os.File,
+// asks the kernel to sendfile(2) it: the bytes go from the page cache to the
+// socket without ever coming up into the process (newer Go versions give
+// *os.File a WriteTo that does the same from the other end). *os.File's
+// ReadFrom does copy_file_range(2) for file to file on Linux, and
+// http.ResponseWriter passes ReadFrom through to the connection, which is
+// how http.ServeContent can serve a file without reading it.
+//
+// The catch: every one of these is found by a type assertion, and wrapping
+// hides them. struct{ io.Writer }{conn} has only Write, so io.Copy falls
+// back to the loop - a counting or logging wrapper silently turns sendfile
+// into read and write. A wrapper that cares passes ReadFrom through, as
+// bufio.Writer does.
+//
+// Which way round matters too: io.Copy checks src first, so a src with
+// WriteTo wins even when dst has a ReadFrom that would have been better
+
+// chunkSize is how much chunkBuffer allocates at a time
+const chunkSize = 32 << 10
+
+// chunkBuffer is a FIFO of bytes, like bytes.Buffer, that grows by adding
+// chunks rather than reallocating and copying everything it holds. It has
+// both fast paths: WriteTo hands each chunk to the Writer as it is, and
+// ReadFrom reads straight into the chunks. Neither needs io.Copy's buffer,
+// and neither copies a byte more than once.
+//
+// Like bytes.Buffer it's for one goroutine at a time
+type chunkBuffer struct {
+	chunks [][]byte // the first chunk starts off bytes in, the last may have room
+	off    int
+	size   int64
+}
+
+// Len is the bytes held, unread
+func (c *chunkBuffer) Len() int64 { return c.size }
+
+// room returns the last chunk's unused capacity, adding a chunk if it's
+// full
+func (c *chunkBuffer) room() []byte {
+	if len(c.chunks) == 0 || len(c.chunks[len(c.chunks)-1]) == chunkSize {
+		c.chunks = append(c.chunks, make([]byte, 0, chunkSize))
+	}
+	last := c.chunks[len(c.chunks)-1]
+	return last[len(last):chunkSize]
+}
+
+// grew records that n bytes were put in the room room returned
+func (c *chunkBuffer) grew(n int) {
+	last := &c.chunks[len(c.chunks)-1]
+	*last = (*last)[:len(*last)+n]
+	c.size += int64(n)
+}
+
+// Write copies p in. It has to: p belongs to the caller, who may reuse it
+// as soon as Write returns
+func (c *chunkBuffer) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(c.room(), p)
+		c.grew(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// ReadFrom reads from r until io.EOF, straight into the chunks. io.Copy
+// calls this when dst is a chunkBuffer and src isn't a WriterTo
+func (c *chunkBuffer) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		n, err := r.Read(c.room())
+		c.grew(n)
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// Read copies out of the first chunk, dropping chunks as they're used up
+func (c *chunkBuffer) Read(p []byte) (int, error) {
+	if c.size == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	read := 0
+	for read < len(p) && c.size > 0 {
+		n := copy(p[read:], c.chunks[0][c.off:])
+		read += n
+		c.consume(n)
+	}
+	return read, nil
+}
+
+// WriteTo writes each chunk to w in one Write, without copying it first.
+// io.Copy calls this whenever src is a chunkBuffer
+func (c *chunkBuffer) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for c.size > 0 {
+		chunk := c.chunks[0][c.off:]
+		n, err := w.Write(chunk)
+		total += int64(n)
+		c.consume(n)
+		if err != nil {
+			return total, err
+		}
+		if n < len(chunk) {
+			return total, io.ErrShortWrite
+		}
+	}
+	return total, nil
+}
+
+// consume drops n bytes from the front, and the first chunk with them once
+// it's been read to the end. Only the last chunk is ever empty, so while
+// size is above 0 the first chunk has bytes to read
+func (c *chunkBuffer) consume(n int) {
+	c.off += n
+	c.size -= int64(n)
+	if c.off == len(c.chunks[0]) {
+		c.chunks[0] = nil // for the garbage collector, the array stays alive otherwise
+		c.chunks = c.chunks[1:]
+		c.off = 0
+	}
+}
+
+// onlyReader and onlyWriter hide every method but Read or Write, the way an
+// innocent wrapper does by accident. Here they do it on purpose, to see what
+// io.Copy does without the fast paths
+type onlyReader struct{ io.Reader }
+
+type onlyWriter struct{ io.Writer }
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+// inChunks reports whether p is memory belonging to one of chunks. Every
+// slice of an array ends its capacity at the array's last element, so that
+// element's address identifies the array
+func inChunks(chunks [][]byte, p []byte) bool {
+	end := func(b []byte) *byte { return &b[:cap(b)][cap(b)-1] }
+	for _, chunk := range chunks {
+		if cap(chunk) > 0 && cap(p) > 0 && end(chunk) == end(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestChunkBuffer(t *testing.T) {
+	data := randomBytes(100_000)
+
+	var c chunkBuffer
+	// pieces of awkward sizes, so writes straddle chunks
+	for p := data; len(p) > 0; {
+		n := min(len(p), 7919)
+		c.Write(p[:n])
+		p = p[n:]
+	}
+	assert.Equal(t, int64(len(data)), c.Len())
+	assert.Len(t, c.chunks, 4, "100,000 bytes is three full chunks and some")
+
+	got, err := io.ReadAll(iotest.HalfReader(&c))
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.Zero(t, c.Len())
+	assert.Empty(t, c.chunks, "read chunks are let go")
+
+	// reused after being emptied
+	c.Write([]byte("again"))
+	got, err = io.ReadAll(&c)
+	require.NoError(t, err)
+	assert.Equal(t, "again", string(got))
+
+	n, err := c.Read(nil)
+	assert.Zero(t, n)
+	assert.NoError(t, err, "an empty read isn't EOF")
+}
+
+// chunkWriter records the slices it's given, without copying them
+type chunkWriter struct{ writes [][]byte }
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, p)
+	return len(p), nil
+}
+
+func TestCopyUsesWriteTo(t *testing.T) {
+	data := randomBytes(80_000)
+
+	var c chunkBuffer
+	c.Write(data)
+	chunks := append([][]byte(nil), c.chunks...)
+	var w chunkWriter
+	n, err := io.Copy(&w, &c)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	// WriteTo hands over the chunks themselves: one Write each, and the
+	// very same memory, nothing copied on the way
+	require.Len(t, w.writes, len(chunks))
+	for i := range chunks {
+		assert.True(t, &w.writes[i][0] == &chunks[i][0], "write %d is chunk %d", i, i)
+	}
+	assert.True(t, inChunks(chunks, w.writes[0]))
+
+	// hiding WriteTo: io.Copy reads into a buffer of its own and writes
+	// that, so nothing written is the chunks' memory
+	c.Write(data)
+	chunks = append([][]byte(nil), c.chunks...)
+	w = chunkWriter{}
+	_, err = io.Copy(&w, onlyReader{&c})
+	require.NoError(t, err)
+	for i, p := range w.writes {
+		assert.False(t, inChunks(chunks, p), "write %d came from io.Copy's buffer", i)
+	}
+}
+
+// readSpy records the buffers Read is asked to fill
+type readSpy struct {
+	r    io.Reader
+	bufs [][]byte
+}
+
+func (s *readSpy) Read(p []byte) (int, error) {
+	s.bufs = append(s.bufs, p)
+	return s.r.Read(p)
+}
+
+func TestCopyUsesReadFrom(t *testing.T) {
+	data := randomBytes(80_000)
+
+	// bytes.Reader is a WriterTo, which would win. The spy hides it
+	spy := &readSpy{r: bytes.NewReader(data)}
+	var c chunkBuffer
+	_, err := io.Copy(&c, spy)
+	require.NoError(t, err)
+	for i, p := range spy.bufs {
+		if len(p) > 0 {
+			assert.True(t, inChunks(c.chunks, p), "read %d went straight into a chunk", i)
+		}
+	}
+	got, _ := io.ReadAll(&c)
+	assert.Equal(t, data, got)
+
+	spy = &readSpy{r: bytes.NewReader(data)}
+	_, err = io.Copy(onlyWriter{&c}, spy)
+	require.NoError(t, err)
+	for i, p := range spy.bufs {
+		assert.False(t, inChunks(c.chunks, p), "read %d went into io.Copy's buffer", i)
+	}
+}
+
+// fromSpy notes whether io.Copy used its ReadFrom
+type fromSpy struct {
+	chunkBuffer
+	used bool
+}
+
+func (s *fromSpy) ReadFrom(r io.Reader) (int64, error) {
+	s.used = true
+	return s.chunkBuffer.ReadFrom(r)
+}
+
+func TestCopyPrefersWriteTo(t *testing.T) {
+	var dst fromSpy
+	io.Copy(&dst, strings.NewReader("src is a WriterTo"))
+	assert.False(t, dst.used, "src's WriteTo is asked first")
+
+	io.Copy(&dst, onlyReader{strings.NewReader("src isn't")})
+	assert.True(t, dst.used)
+}
+
+func TestCopyAllocs(t *testing.T) {
+	data := randomBytes(64 << 10)
+	r := bytes.NewReader(data)
+	// io.Discard is a ReaderFrom, hide it. Both go in interfaces up front,
+	// or making them into one inside the loop would be an allocation too
+	var w io.Writer = onlyWriter{io.Discard}
+
+	fast := testing.AllocsPerRun(100, func() {
+		r.Reset(data)
+		io.Copy(w, r)
+	})
+	assert.Zero(t, fast, "WriteTo: one Write of the whole slice, no buffer")
+
+	var src io.Reader = onlyReader{r}
+	slow := testing.AllocsPerRun(100, func() {
+		r.Reset(data)
+		io.Copy(w, src)
+	})
+	assert.GreaterOrEqual(t, slow, 1.0, "a fresh 32KB buffer every time")
+}
+
+// tempFile is n random bytes in a file, opened for reading
+func tempFile(tb testing.TB, n int) *os.File {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "data")
+	require.NoError(tb, os.WriteFile(path, randomBytes(n), 0o644))
+	f, err := os.Open(path)
+	require.NoError(tb, err)
+	tb.Cleanup(func() { f.Close() })
+	return f
+}
+
+// sink accepts one connection and hashes everything sent on it. The sum
+// comes down the channel once the sender closes
+func sink(tb testing.TB) (addr string, sums <-chan [32]byte) {
+	tb.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	tb.Cleanup(func() { l.Close() })
+
+	ch := make(chan [32]byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		h := sha256.New()
+		io.Copy(h, conn)
+		var sum [32]byte
+		copy(sum[:], h.Sum(nil))
+		ch <- sum
+	}()
+	return l.Addr().String(), ch
+}
+
+func TestFileToSocket(t *testing.T) {
+	f := tempFile(t, 1<<20)
+	want := sha256.New()
+	io.Copy(want, f)
+
+	// a bare *os.File gets sendfile, a wrapped one gets read and write.
+	// Both arrive the same, only the cost differs - see BenchmarkCopy
+	for name, src := range map[string]func() io.Reader{
+		"sendfile": func() io.Reader { return f },
+		"buffered": func() io.Reader { return onlyReader{f} },
+	} {
+		addr, sums := sink(t)
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		_, err = f.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+
+		n, err := io.Copy(conn, src())
+		require.NoError(t, err, name)
+		assert.Equal(t, int64(1<<20), n, name)
+		conn.Close()
+		got := <-sums
+		assert.Equal(t, want.Sum(nil), got[:], name)
+	}
+}
+
+// go test -bench Copy ./concepts/io
+func BenchmarkCopy(b *testing.B) {
+	data := randomBytes(1 << 20)
+
+	b.Run("chunkBuffer/WriteTo", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		var c chunkBuffer
+		for i := 0; i < b.N; i++ {
+			c.Write(data)
+			io.Copy(onlyWriter{io.Discard}, &c)
+		}
+	})
+	b.Run("chunkBuffer/buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		var c chunkBuffer
+		for i := 0; i < b.N; i++ {
+			c.Write(data)
+			io.Copy(onlyWriter{io.Discard}, onlyReader{&c})
+		}
+	})
+
+	f := tempFile(b, 8<<20)
+	for name, src := range map[string]io.Reader{
+		"sendfile": f,
+		"buffered": onlyReader{f},
+	} {
+		b.Run("file to socket/"+name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(8 << 20)
+			addr, _ := sink(b)
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(b, err)
+			defer conn.Close()
+			for i := 0; i < b.N; i++ {
+				f.Seek(0, io.SeekStart)
+				if _, err := io.Copy(conn, src); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
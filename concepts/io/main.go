@@ -4,26 +4,46 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 )
 
+// readBufs are countLetter's read buffers. A fresh one per call would be
+// 32KB of garbage each time; a pool hands back one an earlier call finished
+// with. Pools hold pointers, a []byte put in one would itself be allocated
+// to fit in the interface
+var readBufs = sync.Pool{New: func() any { b := make([]byte, 32<<10); return &b }}
+
+// countLetter counts each ASCII letter in r. Counting goes into an array
+// indexed by the byte - no hashing, nothing to allocate - and only the
+// answer is a map, so what it allocates doesn't grow with the input
 func countLetter(r io.Reader) (map[string]int, error) {
-	buf := make([]byte, 2048)
-	out := map[string]int{}
+	bp := readBufs.Get().(*[]byte)
+	defer readBufs.Put(bp)
+	buf := *bp
+
+	var counts [256]int
 	for {
 		n, err := r.Read(buf)
 		for _, b := range buf[:n] {
-			if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') {
-				out[string(b)]++
-			}
+			counts[b]++
 		}
 		if err == io.EOF {
-			return out, nil
+			break
 		}
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	out := map[string]int{}
+	for b, n := range counts {
+		if n > 0 && (b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z') {
+			// converting a one byte slice to a string doesn't allocate, Go
+			// keeps a table of them
+			out[string([]byte{byte(b)})] = n
+		}
+	}
+	return out, nil
 }
 
 type ourReader struct{}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountLetter(t *testing.T) {
+	got, err := countLetter(iotest.HalfReader(strings.NewReader("Hello, World! ünïcode 123")))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"H": 1, "W": 1, "c": 1, "d": 2, "e": 2, "l": 3, "n": 1, "o": 3, "r": 1}, got, "only ASCII letters")
+
+	_, err = countLetter(io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(errFull)))
+	assert.True(t, errors.Is(err, errFull))
+}
+
+func TestCountLetterAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector empties pools at random")
+	}
+	// what it allocates is the map it returns, however long the input
+	small := strings.Repeat("the quick brown fox jumps over the lazy dog ", 20)
+	big := strings.Repeat(small, 1000)
+	r := strings.NewReader("")
+	allocs := func(s string) float64 {
+		return testing.AllocsPerRun(20, func() {
+			r.Reset(s)
+			countLetter(r)
+		})
+	}
+	assert.Equal(t, allocs(small), allocs(big), "%d bytes vs %d", len(small), len(big))
+}
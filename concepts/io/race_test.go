@@ -0,0 +1,6 @@
+//go:build race
+
+package main
+
+// raceEnabled is set by -race, which makes sync.Pool drop items at random
+const raceEnabled = true
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+/*
+ *
+ * random access: io.ReaderAt, io.Seeker and a record file
+ *
+ */
+
+// The transforming readers and writers take a stream front to back. A file
+// on disk needn't be read that way - it's all there, and the OS can start
+// anywhere. io has two ways to say where:
+//
+//	io.Seeker    Seek(offset, whence) moves a position that the next Read
+//	             starts from, like lseek. One position, shared, so two
+//	             goroutines reading the same *os.File with it tread on each
+//	             other
+//	io.ReaderAt  ReadAt(p, off) reads from off without any position at all,
+//	             like pread. Calls don't affect each other, and the io docs
+//	             promise ReaderAts can be used in parallel
+//
+// Either one only helps if you know where to look. A file of lines means
+// reading every line before the one you want; a file of records that are all
+// the same size means record i starts at header + i*size, and that's one
+// multiply instead of a scan. Databases lay pages out exactly like this.
+//
+// io.SectionReader puts the two together: a window onto part of a ReaderAt,
+// with its own Read, Seek and ReadAt that can't see past the ends. Handing
+// out a SectionReader per record gives each caller a little file of its own,
+// and they all share the one underlying file safely
+
+// A record file is a header, then records back to back:
+//
+//	header  "RECS" | version uint32 | record size uint32 | reserved uint32
+//	record  id uint64 | at int64, unix nanoseconds | value float64 | name, zero padded
+//
+// everything big endian. The record size is in the header so a reader can
+// check it's looking at the layout it expects
+const (
+	recordMagic    = "RECS"
+	recordVersion  = 1
+	headerSize     = 16
+	recordSize     = 64
+	recordNameSize = recordSize - 24
+)
+
+var (
+	errNotRecordFile = errors.New("records: not a record file")
+	errNoRecord      = errors.New("records: no such record")
+	errBadName       = fmt.Errorf("records: names are at most %d bytes, none of them zero", recordNameSize)
+)
+
+// entry is what a record holds
+type entry struct {
+	ID    uint64
+	At    time.Time
+	Value float64
+	Name  string
+}
+
+// appendEntry encodes e as exactly recordSize bytes
+func appendEntry(dst []byte, e entry) ([]byte, error) {
+	// the padding is zeroes, so a name with a zero in it would come back
+	// shorter
+	if len(e.Name) > recordNameSize || strings.IndexByte(e.Name, 0) >= 0 {
+		return dst, errBadName
+	}
+	dst = binary.BigEndian.AppendUint64(dst, e.ID)
+	dst = binary.BigEndian.AppendUint64(dst, uint64(e.At.UnixNano()))
+	dst = binary.BigEndian.AppendUint64(dst, math.Float64bits(e.Value))
+	dst = append(dst, e.Name...)
+	for i := len(e.Name); i < recordNameSize; i++ {
+		dst = append(dst, 0)
+	}
+	return dst, nil
+}
+
+func parseEntry(b []byte) entry {
+	name := b[24:recordSize]
+	for i, c := range name {
+		if c == 0 {
+			name = name[:i]
+			break
+		}
+	}
+	return entry{
+		ID:    binary.BigEndian.Uint64(b[0:]),
+		At:    time.Unix(0, int64(binary.BigEndian.Uint64(b[8:]))).UTC(),
+		Value: math.Float64frombits(binary.BigEndian.Uint64(b[16:])),
+		Name:  string(name),
+	}
+}
+
+// writeRecords writes a whole record file to w
+func writeRecords(w io.Writer, entries []entry) error {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 0, headerSize)
+	header = append(header, recordMagic...)
+	header = binary.BigEndian.AppendUint32(header, recordVersion)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = binary.BigEndian.AppendUint32(header, 0)
+	bw.Write(header)
+
+	buf := make([]byte, 0, recordSize)
+	for _, e := range entries {
+		var err error
+		if buf, err = appendEntry(buf[:0], e); err != nil {
+			return err
+		}
+		// bufio.Writer remembers an error and returns it from Flush
+		bw.Write(buf)
+	}
+	return bw.Flush()
+}
+
+// recordFile reads records by number from a ReaderAt - an *os.File, or a
+// bytes.Reader in tests. It holds no position, so one recordFile can serve
+// any number of goroutines at once
+type recordFile struct {
+	r io.ReaderAt
+	n int64
+}
+
+// openRecords checks the header. size is the file's size, which ReaderAt
+// has no way to tell: Stat it, or Len on a bytes.Reader
+func openRecords(r io.ReaderAt, size int64) (*recordFile, error) {
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return nil, errNotRecordFile
+		}
+		return nil, err
+	}
+	if string(header[:4]) != recordMagic ||
+		binary.BigEndian.Uint32(header[4:]) != recordVersion ||
+		binary.BigEndian.Uint32(header[8:]) != recordSize {
+		return nil, errNotRecordFile
+	}
+	// a torn last record is ignored rather than an error, it's what a
+	// crash part way through appending leaves
+	return &recordFile{r: r, n: (size - headerSize) / recordSize}, nil
+}
+
+// Len is the number of records
+func (f *recordFile) Len() int64 { return f.n }
+
+func offset(i int64) int64 { return headerSize + i*recordSize }
+
+// Get reads record i with a single ReadAt. ReadAt reads all of len(p) or
+// returns an error saying why not - unlike Read, there's no short read to
+// loop on
+func (f *recordFile) Get(i int64) (entry, error) {
+	if i < 0 || i >= f.n {
+		return entry{}, errNoRecord
+	}
+	var buf [recordSize]byte
+	if _, err := f.r.ReadAt(buf[:], offset(i)); err != nil {
+		return entry{}, err
+	}
+	return parseEntry(buf[:]), nil
+}
+
+// Section is record i as a reader of its own, recordSize bytes long.
+// Seeking to 0 in it is seeking to the start of the record, and reading
+// stops with io.EOF at its end even though the file goes on
+func (f *recordFile) Section(i int64) (*io.SectionReader, error) {
+	if i < 0 || i >= f.n {
+		return nil, errNoRecord
+	}
+	return io.NewSectionReader(f.r, offset(i), recordSize), nil
+}
+
+// getSeek is Get the io.Seeker way: move the position, then read from it.
+// It works on anything that can Seek, but rs is left somewhere new, and two
+// goroutines doing this to one file at once can each read from where the
+// other seeked to
+func getSeek(rs io.ReadSeeker, i int64) (entry, error) {
+	if _, err := rs.Seek(offset(i), io.SeekStart); err != nil {
+		return entry{}, err
+	}
+	var buf [recordSize]byte
+	// Read may return less than asked for, ReadFull keeps going
+	if _, err := io.ReadFull(rs, buf[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return entry{}, errNoRecord
+		}
+		return entry{}, err
+	}
+	return parseEntry(buf[:]), nil
+}
+
+// getScan is what a file without fixed-size records is stuck with: read
+// everything up to record i. It's here for the benchmark to compare with
+func getScan(r io.Reader, i int64) (entry, error) {
+	br := bufio.NewReader(r)
+	if _, err := br.Discard(headerSize); err != nil {
+		return entry{}, errNotRecordFile
+	}
+	var buf [recordSize]byte
+	for n := int64(0); n <= i; n++ {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return entry{}, errNoRecord
+		}
+	}
+	return parseEntry(buf[:]), nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var recordsEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testEntries(n int) []entry {
+	entries := make([]entry, n)
+	for i := range entries {
+		entries[i] = entry{
+			ID:    uint64(i),
+			At:    recordsEpoch.Add(time.Duration(i) * time.Second),
+			Value: float64(i) / 4,
+			Name:  fmt.Sprintf("record %d", i),
+		}
+	}
+	return entries
+}
+
+// recordsOnDisk writes entries to a file and opens it, for tests that want
+// a real *os.File under the ReaderAt
+func recordsOnDisk(tb testing.TB, entries []entry) *os.File {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "records")
+	f, err := os.Create(path)
+	require.NoError(tb, err)
+	require.NoError(tb, writeRecords(f, entries))
+	require.NoError(tb, f.Close())
+
+	f, err = os.Open(path)
+	require.NoError(tb, err)
+	tb.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	entries := testEntries(100)
+	entries[7].Name = strings.Repeat("n", recordNameSize)
+	entries[8].Name = ""
+	entries[9].Value = -1e300
+
+	var buf bytes.Buffer
+	require.NoError(t, writeRecords(&buf, entries))
+	assert.Equal(t, headerSize+100*recordSize, buf.Len())
+
+	rf, err := openRecords(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Equal(t, int64(100), rf.Len())
+
+	// any order, no scanning
+	for _, i := range []int64{99, 0, 50, 7, 8, 9, 1} {
+		got, err := rf.Get(i)
+		require.NoError(t, err)
+		assert.Equal(t, entries[i], got, "record %d", i)
+	}
+	for _, i := range []int64{-1, 100} {
+		_, err := rf.Get(i)
+		assert.ErrorIs(t, err, errNoRecord)
+		_, err = rf.Section(i)
+		assert.ErrorIs(t, err, errNoRecord)
+	}
+}
+
+func TestBadRecords(t *testing.T) {
+	for _, e := range []entry{{Name: strings.Repeat("n", recordNameSize+1)}, {Name: "nul\x00"}} {
+		assert.ErrorIs(t, writeRecords(io.Discard, []entry{e}), errBadName)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeRecords(&buf, testEntries(3)))
+	good := buf.Bytes()
+
+	for name, data := range map[string][]byte{
+		"empty":        nil,
+		"short header": good[:10],
+		"wrong magic":  append([]byte("JSON"), good[4:]...),
+		"other size":   append(append([]byte{}, good[:8]...), append([]byte{0, 0, 0, 32}, good[12:]...)...),
+	} {
+		_, err := openRecords(bytes.NewReader(data), int64(len(data)))
+		assert.ErrorIs(t, err, errNotRecordFile, name)
+	}
+
+	// half a record on the end is left out
+	torn := good[:len(good)-recordSize/2]
+	rf, err := openRecords(bytes.NewReader(torn), int64(len(torn)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), rf.Len())
+}
+
+func TestRecordSection(t *testing.T) {
+	entries := testEntries(10)
+	f := recordsOnDisk(t, entries)
+	st, err := f.Stat()
+	require.NoError(t, err)
+	rf, err := openRecords(f, st.Size())
+	require.NoError(t, err)
+
+	sec, err := rf.Section(3)
+	require.NoError(t, err)
+	b, err := io.ReadAll(sec)
+	require.NoError(t, err, "EOF at the end of the record, not the file")
+	require.Len(t, b, recordSize)
+	assert.Equal(t, entries[3], parseEntry(b))
+
+	// offsets are relative to the record
+	pos, err := sec.Seek(24, io.SeekStart)
+	require.NoError(t, err)
+	assert.Equal(t, int64(24), pos)
+	name := make([]byte, len("record 3"))
+	_, err = io.ReadFull(sec, name)
+	require.NoError(t, err)
+	assert.Equal(t, "record 3", string(name))
+
+	_, err = sec.ReadAt(make([]byte, 8), recordSize-4)
+	assert.Equal(t, io.EOF, err, "can't read into the next record")
+}
+
+func TestGetSeek(t *testing.T) {
+	entries := testEntries(10)
+	f := recordsOnDisk(t, entries)
+
+	for _, i := range []int64{5, 0, 9} {
+		got, err := getSeek(f, i)
+		require.NoError(t, err)
+		assert.Equal(t, entries[i], got)
+	}
+	_, err := getSeek(f, 10)
+	assert.ErrorIs(t, err, errNoRecord)
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	got, err := getScan(f, 6)
+	require.NoError(t, err)
+	assert.Equal(t, entries[6], got, "scanning gets there too, the long way")
+}
+
+func TestRecordsConcurrent(t *testing.T) {
+	// many goroutines, one file, no lock: ReadAt carries its offset with
+	// each call, so nothing is shared to race on
+	entries := testEntries(1000)
+	f := recordsOnDisk(t, entries)
+	rf, err := openRecords(f, headerSize+1000*recordSize)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := int64(g); i < 1000; i += 8 {
+				got, err := rf.Get(i)
+				assert.NoError(t, err)
+				assert.Equal(t, entries[i].ID, got.ID)
+
+				sec, _ := rf.Section(999 - i)
+				b, err := io.ReadAll(sec)
+				assert.NoError(t, err)
+				assert.Equal(t, entries[999-i], parseEntry(b))
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// go test -bench Records ./concepts/io
+//
+// Record i near the end of a 10,000 record file: ReadAt and Seek each read
+// 64 bytes, the scan reads the 640KB before them
+func BenchmarkRecords(b *testing.B) {
+	const n = 10000
+	f := recordsOnDisk(b, testEntries(n))
+	rf, err := openRecords(f, headerSize+n*recordSize)
+	require.NoError(b, err)
+
+	b.Run("ReadAt", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := rf.Get(n - 1 - int64(i%100)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Seek", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := getSeek(f, n-1-int64(i%100)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			f.Seek(0, io.SeekStart)
+			if _, err := getScan(f, n-1-int64(i%100)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ *
+ * transforming readers and writers
+ *
+ */
+
+// A Reader or Writer that wraps another and changes the bytes on the way
+// through is the io version of a Unix pipe: each one does one thing, and they
+// stack. gzip.NewReader, bufio.NewWriter and base64.NewEncoder all work this
+// way, and so does anything taking an io.Reader - it can't tell the
+// difference.
+//
+//	w := newUpperWriter(newLineNumberWriter(os.Stdout))
+//	io.Copy(w, newRot13Reader(f))
+//	w.Close()
+//
+// The catch is that the bytes arrive in chunks of whatever size the caller
+// or the layer below picked. A transformation that looks at more than one
+// byte at a time has to cope with its input being cut anywhere - in the
+// middle of a line, or of a multi-byte character
+
+// rot13Reader rotates ASCII letters 13 places as they're read. Each byte is
+// transformed on its own, so chunk boundaries don't matter, and everything
+// that isn't an ASCII letter - including every byte of a multi-byte UTF-8
+// character, which are all 0x80 and up - is left alone
+type rot13Reader struct {
+	r io.Reader
+}
+
+func newRot13Reader(r io.Reader) io.Reader {
+	return &rot13Reader{r: r}
+}
+
+func (r *rot13Reader) Read(p []byte) (int, error) {
+	// the bytes before an error are still data, Read may return both
+	n, err := r.r.Read(p)
+	for i, b := range p[:n] {
+		p[i] = rot13(b)
+	}
+	return n, err
+}
+
+func rot13(b byte) byte {
+	switch {
+	case b >= 'a' && b <= 'z':
+		return 'a' + (b-'a'+13)%26
+	case b >= 'A' && b <= 'Z':
+		return 'A' + (b-'A'+13)%26
+	}
+	return b
+}
+
+// upperWriter upper-cases UTF-8 text on its way to w. A character can be up
+// to 4 bytes, and a Write can end part way through one - upper-casing the
+// pieces separately would see two invalid sequences and change neither. So
+// an incomplete character at the end of a Write is held back until the next
+// one completes it, and Close writes out anything still held.
+//
+// Bytes that aren't valid UTF-8 are passed through as they are
+type upperWriter struct {
+	w        io.Writer
+	pending  [utf8.UTFMax - 1]byte // the start of a character the last Write cut off
+	npending int
+	in       []byte // reused to join pending to the next Write
+	buf      []byte // reused for the output
+}
+
+func newUpperWriter(w io.Writer) *upperWriter {
+	return &upperWriter{w: w}
+}
+
+// Write consumes all of p, or returns an error. Upper and lower case aren't
+// always the same length ('ı' is two bytes, 'I' one), so the bytes written
+// to w don't line up with p and a failed Write reports 0 rather than a
+// count that would mean nothing.
+//
+// Once in and buf have grown to fit the Writes they're given, Write doesn't
+// allocate
+func (u *upperWriter) Write(p []byte) (int, error) {
+	in := p
+	if u.npending > 0 {
+		u.in = append(append(u.in[:0], u.pending[:u.npending]...), p...)
+		in = u.in
+	}
+
+	// hold back a trailing character that's started but not finished. At
+	// most the last 3 bytes can be one: a 4 byte one would be complete
+	cut := len(in)
+	for i := len(in) - 1; i >= 0 && i >= len(in)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(in[i]) {
+			if !utf8.FullRune(in[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+
+	u.buf = appendUpper(u.buf[:0], in[:cut])
+	u.npending = copy(u.pending[:], in[cut:])
+
+	if _, err := u.w.Write(u.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes out a character left unfinished by the last Write as it is,
+// there's nothing to complete it now. It doesn't close w, the same as
+// gzip.Writer and base64's encoder
+func (u *upperWriter) Close() error {
+	if u.npending == 0 {
+		return nil
+	}
+	_, err := u.w.Write(u.pending[:u.npending])
+	u.npending = 0
+	return err
+}
+
+// appendUpper appends s upper-cased to dst. Unlike bytes.ToUpper it keeps
+// invalid bytes as they are rather than turning them into U+FFFD
+func appendUpper(dst, s []byte) []byte {
+	for len(s) > 0 {
+		if s[0] < utf8.RuneSelf {
+			b := s[0]
+			if b >= 'a' && b <= 'z' {
+				b -= 'a' - 'A'
+			}
+			dst = append(dst, b)
+			s = s[1:]
+			continue
+		}
+		r, size := utf8.DecodeRune(s)
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[0])
+		} else {
+			dst = utf8.AppendRune(dst, unicode.ToUpper(r))
+		}
+		s = s[size:]
+	}
+	return dst
+}
+
+// lineNumberWriter numbers lines the way cat -n does: a right-aligned number
+// and a tab in front of each. A line's number is written when its first byte
+// is, not when the newline before it is, so output that ends with a newline
+// doesn't end with a number on a line of its own
+type lineNumberWriter struct {
+	w       io.Writer
+	line    int
+	midLine bool   // the current line's number has been started
+	prefix  []byte // reused for the number
+	pending []byte // what's left of the number after a short write
+}
+
+func newLineNumberWriter(w io.Writer) *lineNumberWriter {
+	return &lineNumberWriter{w: w}
+}
+
+// Write returns how many bytes of p made it to w, not counting the numbers,
+// so that n < len(p) exactly when there's an error. After an error it picks
+// up where it stopped, even part way through a number
+func (l *lineNumberWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if !l.midLine {
+			l.line++
+			l.prefix = appendLineNumber(l.prefix[:0], l.line)
+			l.pending = l.prefix
+			l.midLine = true
+		}
+		if len(l.pending) > 0 {
+			n, err := l.w.Write(l.pending)
+			l.pending = l.pending[n:]
+			if err != nil {
+				return written, err
+			}
+		}
+
+		end := len(p)
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			end = i + 1
+		}
+		n, err := l.w.Write(p[:end])
+		written += n
+		// the next byte starts a new line only if this one's newline made it
+		l.midLine = n == 0 || p[n-1] != '\n'
+		if err != nil {
+			return written, err
+		}
+		p = p[end:]
+	}
+	return written, nil
+}
+
+// appendLineNumber is fmt.Appendf(dst, "%6d\t", line) without fmt. Passing
+// line to Appendf puts it in an interface, and an int bigger than 255 in an
+// interface is an allocation - one for every line numbered
+func appendLineNumber(dst []byte, line int) []byte {
+	var digits [20]byte
+	num := strconv.AppendInt(digits[:0], int64(line), 10)
+	for i := len(num); i < 6; i++ {
+		dst = append(dst, ' ')
+	}
+	dst = append(dst, num...)
+	return append(dst, '\t')
+}
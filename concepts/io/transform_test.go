@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeAt writes data to w in pieces, cut at each of cuts
+func writeAt(t *testing.T, w io.Writer, data []byte, cuts ...int) {
+	t.Helper()
+	prev := 0
+	for _, c := range append(cuts, len(data)) {
+		n, err := w.Write(data[prev:c])
+		require.NoError(t, err)
+		require.Equal(t, c-prev, n)
+		prev = c
+	}
+}
+
+// failAfter accepts n bytes, then fails
+type failAfter struct {
+	n   int
+	buf bytes.Buffer
+}
+
+var errFull = errors.New("full")
+
+func (f *failAfter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		f.buf.Write(p[:f.n])
+		n := f.n
+		f.n = 0
+		return n, errFull
+	}
+	f.n -= len(p)
+	return f.buf.Write(p)
+}
+
+func TestRot13Reader(t *testing.T) {
+	in := "Hello, World! ünïcode 123 xyz ABC"
+	want := "Uryyb, Jbeyq! üaïpbqr 123 klm NOP"
+
+	// TestReader tries all sorts of buffer sizes, and Seek/ReadAt if it had them
+	require.NoError(t, iotest.TestReader(newRot13Reader(strings.NewReader(in)), []byte(want)))
+
+	for name, r := range map[string]io.Reader{
+		"one byte at a time": iotest.OneByteReader(strings.NewReader(in)),
+		"half at a time":     iotest.HalfReader(strings.NewReader(in)),
+		"data with EOF":      iotest.DataErrReader(strings.NewReader(in)),
+	} {
+		got, err := io.ReadAll(newRot13Reader(r))
+		require.NoError(t, err, name)
+		assert.Equal(t, want, string(got), name)
+	}
+
+	twice, err := io.ReadAll(newRot13Reader(newRot13Reader(strings.NewReader(in))))
+	require.NoError(t, err)
+	assert.Equal(t, in, string(twice))
+
+	// bytes before an error are kept
+	got, err := io.ReadAll(newRot13Reader(io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(errFull))))
+	assert.ErrorIs(t, err, errFull)
+	assert.Equal(t, "nop", string(got))
+}
+
+// upperCases covers every length of UTF-8 character, ones that change
+// length when upper-cased, and bytes that aren't UTF-8 at all
+var upperCases = []string{
+	"",
+	"hello, world",
+	"héllo wörld",              // 2 byte characters
+	"ǆ ǉ ǌ",                    // title case digraphs
+	"ıi",                       // dotless i: 2 bytes lower, 1 upper
+	"ⱥ ɐ",                      // 2 bytes lower, 3 upper
+	"€uro ☃ snow",              // 3 bytes
+	"𐐨𐐩 deseret 😀",             // 4 bytes, the first two with upper cases
+	"bad \xff byte \xc3 alone", // invalid bytes, passed through
+	"\xe2\x82 truncated in the middle",
+	"ends mid character \xf0\x9f\x98",
+}
+
+func TestUpperWriterSplits(t *testing.T) {
+	for _, in := range upperCases {
+		data := []byte(in)
+		want := string(appendUpper(nil, data))
+		if utf8.ValidString(in) {
+			require.Equal(t, strings.ToUpper(in), want, "appendUpper agrees with strings.ToUpper on valid text")
+		}
+
+		// every place one cut can go, and every pair of places
+		for i := 0; i <= len(data); i++ {
+			for j := i; j <= len(data); j++ {
+				var buf bytes.Buffer
+				w := newUpperWriter(&buf)
+				writeAt(t, w, data, i, j)
+				require.NoError(t, w.Close())
+				require.Equal(t, want, buf.String(), "%q cut at %d and %d", in, i, j)
+			}
+		}
+
+		var buf bytes.Buffer
+		w := newUpperWriter(&buf)
+		for i := range data {
+			writeAt(t, w, data[i:i+1])
+		}
+		require.NoError(t, w.Close())
+		require.Equal(t, want, buf.String(), "%q a byte at a time", in)
+	}
+}
+
+func TestUpperWriterHoldsBack(t *testing.T) {
+	var buf bytes.Buffer
+	w := newUpperWriter(&buf)
+	smile := []byte("😀")
+
+	writeAt(t, w, []byte("ok "))
+	writeAt(t, w, smile[:2])
+	assert.Equal(t, "OK ", buf.String(), "half a character waits")
+	writeAt(t, w, smile[2:3])
+	assert.Equal(t, "OK ", buf.String())
+	writeAt(t, w, smile[3:])
+	assert.Equal(t, "OK 😀", buf.String())
+
+	writeAt(t, w, []byte("é")[:1])
+	assert.Equal(t, "OK 😀", buf.String())
+	require.NoError(t, w.Close())
+	assert.Equal(t, "OK 😀\xc3", buf.String(), "Close gives up waiting")
+	require.NoError(t, w.Close())
+
+	f := &failAfter{n: 2}
+	n, err := newUpperWriter(f).Write([]byte("abc"))
+	assert.ErrorIs(t, err, errFull)
+	assert.Zero(t, n)
+}
+
+func TestLineNumberWriter(t *testing.T) {
+	for in, want := range map[string]string{
+		"":              "",
+		"one":           "     1\tone",
+		"one\n":         "     1\tone\n",
+		"one\ntwo":      "     1\tone\n     2\ttwo",
+		"\n\nthree\n":   "     1\t\n     2\t\n     3\tthree\n",
+		"a\r\nb\n":      "     1\ta\r\n     2\tb\n",
+		"ü\nnïcode\n\n": "     1\tü\n     2\tnïcode\n     3\t\n",
+	} {
+		data := []byte(in)
+		for i := 0; i <= len(data); i++ {
+			for j := i; j <= len(data); j++ {
+				var buf bytes.Buffer
+				writeAt(t, newLineNumberWriter(&buf), data, i, j)
+				require.Equal(t, want, buf.String(), "%q cut at %d and %d", in, i, j)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := newLineNumberWriter(&buf)
+	for i := 0; i < 12; i++ {
+		writeAt(t, w, []byte("x\n"))
+	}
+	assert.True(t, strings.HasSuffix(buf.String(), "    10\tx\n    11\tx\n    12\tx\n"))
+}
+
+func TestLineNumberWriterErrors(t *testing.T) {
+	// prefixes are 7 bytes. Run out of room everywhere there is, and check
+	// that n counts only bytes of p that got through, and that carrying on
+	// afterwards numbers the right line
+	data := []byte("ab\ncd\n")
+	for room := 0; room < 20; room++ {
+		f := &failAfter{n: room}
+		w := newLineNumberWriter(f)
+		n, err := w.Write(data)
+		if err == nil {
+			assert.Equal(t, len(data), n)
+			continue
+		}
+		assert.Equal(t, string(data[:n]), stripNumbers(f.buf.String()), "room %d", room)
+
+		// with room again, the rest follows on as if nothing happened
+		f.n = 100
+		rest, err := w.Write(data[n:])
+		require.NoError(t, err)
+		assert.Equal(t, len(data)-n, rest)
+		assert.Equal(t, "     1\tab\n     2\tcd\n", f.buf.String(), "room %d", room)
+	}
+}
+
+// stripNumbers undoes lineNumberWriter, for output that's whole lines or
+// cut off anywhere
+func stripNumbers(s string) string {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if _, rest, ok := strings.Cut(line, "\t"); ok {
+			out.WriteString(rest)
+		}
+	}
+	return out.String()
+}
+
+func TestComposed(t *testing.T) {
+	var buf bytes.Buffer
+	w := newUpperWriter(newLineNumberWriter(&buf))
+	_, err := io.Copy(w, newRot13Reader(iotest.OneByteReader(strings.NewReader("uryyb\njbeyq, üaïpbqr\n"))))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "     1\tHELLO\n     2\tWORLD, ÜNÏCODE\n", buf.String())
+}
+
+// go test -fuzz FuzzUpperWriter ./concepts/io
+//
+// However the input is cut, the output is the same as in one piece
+func FuzzUpperWriter(f *testing.F) {
+	for _, s := range upperCases {
+		f.Add([]byte(s), uint(len(s)/2), uint(len(s)/3))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, i, j uint) {
+		i %= uint(len(data) + 1)
+		j %= uint(len(data) + 1)
+		if i > j {
+			i, j = j, i
+		}
+
+		var buf bytes.Buffer
+		w := newUpperWriter(&buf)
+		writeAt(t, w, data, int(i), int(j))
+		require.NoError(t, w.Close())
+
+		require.Equal(t, string(appendUpper(nil, data)), buf.String())
+		if utf8.Valid(data) {
+			require.Equal(t, string(bytes.ToUpper(data)), buf.String())
+		}
+	})
+}
+
+func FuzzLineNumberWriter(f *testing.F) {
+	f.Add([]byte("one\ntwo\n"), uint(2))
+	f.Add([]byte("\n\n\n"), uint(1))
+	f.Add([]byte("no newline"), uint(0))
+
+	f.Fuzz(func(t *testing.T, data []byte, i uint) {
+		i %= uint(len(data) + 1)
+
+		var buf bytes.Buffer
+		writeAt(t, newLineNumberWriter(&buf), data, int(i))
+
+		lines := bytes.Count(data, []byte("\n"))
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			lines++
+		}
+		// every line has a number, and with them taken off it's the input
+		require.Equal(t, lines, bytes.Count(buf.Bytes(), []byte("\t"))-bytes.Count(data, []byte("\t")))
+		require.Equal(t, string(data), stripNumbers(buf.String()))
+	})
+}
+
+func FuzzRot13(f *testing.F) {
+	f.Add([]byte("Hello, World!"))
+	f.Add([]byte("\xff\x00ünïcode"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		once, err := io.ReadAll(newRot13Reader(iotest.HalfReader(bytes.NewReader(data))))
+		require.NoError(t, err)
+		require.Len(t, once, len(data))
+		for k := range data {
+			isLetter := (data[k]|0x20) >= 'a' && (data[k]|0x20) <= 'z'
+			require.Equal(t, isLetter, once[k] != data[k], "only letters change, and they always do")
+		}
+
+		twice, err := io.ReadAll(newRot13Reader(bytes.NewReader(once)))
+		require.NoError(t, err)
+		require.Equal(t, data, twice)
+	})
+}
+
+func TestTransformAllocs(t *testing.T) {
+	// rot13 works in place
+	text := strings.Repeat("Hello, wörld 😀\n", 1000)
+	src := strings.NewReader(text)
+	r := newRot13Reader(src)
+	buf := make([]byte, 4096)
+	assert.Zero(t, testing.AllocsPerRun(10, func() {
+		src.Reset(text)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				break
+			}
+		}
+	}), "rot13")
+
+	// the writers' buffers grow to fit the first few Writes, and after
+	// that they're reused. Cutting every write mid-character exercises
+	// pending, and 1000 lines takes the numbers past 255
+	data := []byte(text)
+	writeAll := func(w io.Writer) {
+		for p := data; len(p) > 0; {
+			n := min(len(p), 37)
+			w.Write(p[:n])
+			p = p[n:]
+		}
+	}
+	u := newUpperWriter(io.Discard)
+	writeAll(u)
+	assert.Zero(t, testing.AllocsPerRun(10, func() { writeAll(u) }), "upper")
+
+	l := newLineNumberWriter(io.Discard)
+	writeAll(l)
+	assert.Zero(t, testing.AllocsPerRun(10, func() { writeAll(l) }), "line numbers")
+}
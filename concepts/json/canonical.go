@@ -0,0 +1,147 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Signing or hashing JSON needs every encoder to produce the same bytes for
+// the same data, and encoding/json nearly does - map keys are sorted - but:
+//
+//   - struct fields come out in declaration order, so a struct and the
+//     equivalent map encode differently
+//   - <, > and & are escaped by default (as \u003c and so on), other
+//     encoders don't
+//   - 1, 1.0 and 1e0 are the same number written three ways, and whichever
+//     way the input used survives a round trip through json.Number
+//
+// CanonicalMarshal fixes all three, loosely following RFC 8785 (JCS): no
+// whitespace, object keys sorted, no HTML escaping, numbers in one fixed
+// form. JCS sorts keys by UTF-16 code units, this sorts by bytes - they only
+// differ for keys outside the basic multilingual plane
+
+// CanonicalMarshal encodes v as canonical JSON. It marshals normally first,
+// then re-encodes the generic form, so MarshalJSON methods and struct tags
+// are respected
+func CanonicalMarshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(&buf)
+	d.UseNumber()
+	var generic any
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := writeCanonical(&out, generic); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func writeCanonical(b *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		n, err := canonicalNumber(v)
+		if err != nil {
+			return err
+		}
+		b.WriteString(n)
+	case string:
+		writeCanonicalString(b, v)
+	case []any:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonical(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeCanonicalString(b, k)
+			b.WriteByte(':')
+			if err := writeCanonical(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return fmt.Errorf("canonical json: unexpected %T", v)
+	}
+	return nil
+}
+
+func writeCanonicalString(b *bytes.Buffer, s string) {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s) // a string always encodes
+	b.Truncate(b.Len() - 1)
+}
+
+// canonicalNumber writes integers that fit in an int64 or a uint64 as plain
+// digits, so large IDs aren't squeezed through a float64. Everything else goes through
+// float64 and comes out the way JavaScript (and JCS) would print it: the
+// shortest form that round-trips, plain notation from 1e-6 up to 1e21 and
+// exponent notation outside it
+func canonicalNumber(n json.Number) (string, error) {
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		return strconv.FormatInt(i, 10), nil
+	}
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return strconv.FormatUint(u, 10), nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return "", fmt.Errorf("canonical json: number %s: %w", n, err)
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("canonical json: number %s out of range", n)
+	}
+	if f == 0 {
+		return "0", nil // including -0
+	}
+
+	if abs := math.Abs(f); abs < 1e21 && abs >= 1e-6 {
+		if f == math.Trunc(f) && abs < 1<<63 {
+			return strconv.FormatInt(int64(f), 10), nil
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+
+	// 1e-07 -> 1e-7, 1e+21 -> 1e+21
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	mant, exp, _ := strings.Cut(s, "e")
+	sign := exp[0]
+	exp = strings.TrimLeft(exp[1:], "0")
+	return mant + "e" + string(sign) + exp, nil
+}
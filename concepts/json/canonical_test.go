@@ -0,0 +1,120 @@
+package json
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/golden"
+)
+
+type order struct {
+	Total    float64           `json:"total"`
+	ID       int64             `json:"id"`
+	Customer customer          `json:"customer"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Note     string            `json:"note"`
+}
+
+type customer struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func canonical(t *testing.T, v any) string {
+	t.Helper()
+	b, err := CanonicalMarshal(v)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestCanonicalMarshal(t *testing.T) {
+	o := order{
+		Total:    10.5,
+		ID:       9007199254740993,
+		Customer: customer{Name: "Ann", Email: "ann@example.com"},
+		Tags:     map[string]string{"z": "1", "a": "2"},
+		Note:     "<b>fragile</b> & heavy",
+	}
+	want := `{"customer":{"email":"ann@example.com","name":"Ann"},"id":9007199254740993,"note":"<b>fragile</b> & heavy","tags":{"a":"2","z":"1"},"total":10.5}`
+	assert.Equal(t, want, canonical(t, o))
+
+	// the same data as a map, built in a different order, gives the same bytes
+	var m map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"total": 1.05e1, "note": "<b>fragile</b> & heavy",
+		"tags": {"z": "1", "a": "2"}, "id": 9007199254740993,
+		"customer": {"name": "Ann", "email": "ann@example.com"}
+	}`), &m))
+	// m's id went through float64 and lost precision, put it back
+	m["id"] = json.Number("9007199254740993")
+	assert.Equal(t, want, canonical(t, m))
+
+	// and so the same hash, every time
+	first := sha256.Sum256([]byte(canonical(t, o)))
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, first, sha256.Sum256([]byte(canonical(t, o))))
+	}
+}
+
+func TestCanonicalNumbers(t *testing.T) {
+	for in, want := range map[string]string{
+		`1`:                    `1`,
+		`1.0`:                  `1`,
+		`1e2`:                  `100`,
+		`-0`:                   `0`,
+		`-0.0`:                 `0`,
+		`0.1`:                  `0.1`,
+		`1.5e-3`:               `0.0015`,
+		`1e-7`:                 `1e-7`,
+		`123e20`:               `1.23e+22`,
+		`1e21`:                 `1e+21`,
+		`999999999999999999e3`: `1e+21`,
+		`9223372036854775807`:  `9223372036854775807`,
+		`18446744073709551615`: `18446744073709551615`,
+		`18446744073709551616`: `18446744073709552000`,
+		`-42`:                  `-42`,
+	} {
+		got, err := canonicalNumber(json.Number(in))
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err := canonicalNumber(json.Number("1e400"))
+	assert.Error(t, err)
+}
+
+func TestCanonicalEdgeCases(t *testing.T) {
+	assert.Equal(t, `null`, canonical(t, nil))
+	assert.Equal(t, `[]`, canonical(t, []int{}))
+	assert.Equal(t, `{}`, canonical(t, map[string]int{}))
+	assert.Equal(t, `[true,null,"\"quoted\"\n"]`, canonical(t, []any{true, nil, "\"quoted\"\n"}))
+	assert.Equal(t, `{"a":{"b":[1,{"c":2,"d":3}]}}`, canonical(t, map[string]any{
+		"a": map[string]any{"b": []any{1, map[string]int{"d": 3, "c": 2}}},
+	}))
+
+	_, err := CanonicalMarshal(func() {})
+	assert.Error(t, err)
+}
+
+// The canonical form is a format: once a signature has been made over it,
+// any change - a key sorted differently, a number written another way -
+// breaks that signature. The golden file pins it byte for byte, so a
+// change to CanonicalMarshal shows up as a diff here before it shows up as
+// a failed verification somewhere else
+func TestCanonicalGolden(t *testing.T) {
+	in, err := os.ReadFile(filepath.Join("testdata", "canonical_input.json"))
+	require.NoError(t, err)
+
+	d := json.NewDecoder(bytes.NewReader(in))
+	d.UseNumber()
+	var v any
+	require.NoError(t, d.Decode(&v))
+
+	golden.Assert(t, []byte(canonical(t, v)), "canonical.golden")
+}
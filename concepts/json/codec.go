@@ -0,0 +1,46 @@
+package json
+
+import (
+	"encoding/json"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Codec is the part of a JSON library most code actually uses. Putting it
+// behind an interface lets the same tests and benchmarks run against each
+// implementation, which beats arguing about which one is faster or stricter.
+//
+// The implementations here:
+//
+//   - encoding/json, always
+//   - github.com/json-iterator/go, a drop-in replacement that's usually faster
+//   - encoding/json/v2, when the jsonv2 experiment is on (see codec_v2.go)
+//
+// To compare them:
+//
+//	go test -bench Codec ./concepts/json
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// codecs lists every implementation compiled in
+var codecs = []Codec{stdCodec{}, jsoniterCodec{}}
+
+type stdCodec struct{}
+
+func (stdCodec) Name() string                       { return "encoding/json" }
+func (stdCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (stdCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// jsoniterCodec uses json-iterator's standard-library-compatible config. Its
+// faster default config sorts nothing and escapes less, so output would differ
+// from encoding/json
+type jsoniterCodec struct{}
+
+var jsoniterStd = jsoniter.ConfigCompatibleWithStandardLibrary
+
+func (jsoniterCodec) Name() string                       { return "json-iterator" }
+func (jsoniterCodec) Marshal(v any) ([]byte, error)      { return jsoniterStd.Marshal(v) }
+func (jsoniterCodec) Unmarshal(data []byte, v any) error { return jsoniterStd.Unmarshal(data, v) }
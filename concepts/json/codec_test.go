@@ -0,0 +1,173 @@
+package json
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codecSample struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	Tags      []string          `json:"tags"`
+	Attrs     map[string]string `json:"attrs"`
+	Score     float64           `json:"score"`
+	Active    bool              `json:"active"`
+	CreatedAt time.Time         `json:"created_at"`
+	Parent    *codecSample      `json:"parent,omitempty"`
+	Price     money             `json:"price"`
+}
+
+func newCodecSample() codecSample {
+	return codecSample{
+		ID:        42,
+		Name:      "widget <b>",
+		Tags:      []string{"a", "b", "c"},
+		Attrs:     map[string]string{"color": "red", "size": "L"},
+		Score:     98.6,
+		Active:    true,
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Parent:    &codecSample{ID: 1, Name: "root", Tags: []string{}, Attrs: map[string]string{}},
+		Price:     1999,
+	}
+}
+
+// What every codec has to agree on
+func TestCodecConformance(t *testing.T) {
+	for _, c := range codecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			in := newCodecSample()
+			b, err := c.Marshal(in)
+			require.NoError(t, err)
+
+			// each codec must read what every other codec writes
+			for _, other := range codecs {
+				var out codecSample
+				require.NoError(t, other.Unmarshal(b, &out), other.Name())
+				assert.Equal(t, in, out, other.Name())
+			}
+
+			var unknown testJSON
+			require.NoError(t, c.Unmarshal([]byte(badJSONString), &unknown), "unknown fields are ignored")
+			assert.Equal(t, "michael", unknown.Name)
+
+			var n int
+			assert.Error(t, c.Unmarshal([]byte(`"seven"`), &n))
+			assert.Error(t, c.Unmarshal([]byte(`{"id":`), &n))
+
+			_, err = c.Marshal(func() {})
+			assert.Error(t, err)
+		})
+	}
+}
+
+// Where they don't agree. A codec missing from want isn't compiled in
+func TestCodecDifferences(t *testing.T) {
+	type nilSlice struct {
+		S []int `json:"s"`
+	}
+	// v1 on top of v2 writes the replacement character as it is, the
+	// original escaped it
+	stdInvalidUTF8 := "\"a\ufffdb\""
+	if !jsonv2Enabled {
+		stdInvalidUTF8 = `"a\ufffdb"`
+	}
+
+	for _, tc := range []struct {
+		name string
+		run  func(c Codec) string
+		want map[string]string
+	}{
+		{
+			name: "nil slice",
+			run: func(c Codec) string {
+				b, err := c.Marshal(nilSlice{})
+				return result(string(b), err)
+			},
+			want: map[string]string{"encoding/json": `{"s":null}`, "json-iterator": `{"s":null}`, "encoding/json/v2": `{"s":[]}`},
+		},
+		{
+			name: "case-insensitive field names",
+			run: func(c Codec) string {
+				var v testJSON
+				err := c.Unmarshal([]byte(`{"NAME":"michael"}`), &v)
+				return result(v.Name, err)
+			},
+			want: map[string]string{"encoding/json": "michael", "json-iterator": "michael", "encoding/json/v2": ""},
+		},
+		{
+			name: "duplicate keys",
+			run: func(c Codec) string {
+				var v testJSON
+				err := c.Unmarshal([]byte(`{"name":"a","name":"b"}`), &v)
+				return result(v.Name, err)
+			},
+			want: map[string]string{"encoding/json": "b", "json-iterator": "b", "encoding/json/v2": "error"},
+		},
+		{
+			name: "invalid UTF-8",
+			run: func(c Codec) string {
+				b, err := c.Marshal("a\xffb")
+				return result(string(b), err)
+			},
+			want: map[string]string{"encoding/json": stdInvalidUTF8, "json-iterator": `"a\ufffdb"`, "encoding/json/v2": "error"},
+		},
+		{
+			name: "HTML escaping",
+			run: func(c Codec) string {
+				b, err := c.Marshal("<b>")
+				return result(string(b), err)
+			},
+			want: map[string]string{"encoding/json": `"\u003cb\u003e"`, "json-iterator": `"\u003cb\u003e"`, "encoding/json/v2": `"<b>"`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, c := range codecs {
+				want, ok := tc.want[c.Name()]
+				require.True(t, ok, "no expectation for %s", c.Name())
+				assert.Equal(t, want, tc.run(c), c.Name())
+			}
+		})
+	}
+}
+
+func result(s string, err error) string {
+	if err != nil {
+		return "error"
+	}
+	return s
+}
+
+func BenchmarkCodec(b *testing.B) {
+	items := make([]codecSample, 100)
+	for i := range items {
+		items[i] = newCodecSample()
+		items[i].ID = int64(i)
+		items[i].Name = strings.Repeat("x", i%20)
+	}
+
+	for _, c := range codecs {
+		data, err := c.Marshal(items)
+		require.NoError(b, err)
+
+		b.Run(fmt.Sprintf("%s/marshal", c.Name()), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				_, _ = c.Marshal(items)
+			}
+		})
+		b.Run(fmt.Sprintf("%s/unmarshal", c.Name()), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				var out []codecSample
+				_ = c.Unmarshal(data, &out)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+//go:build goexperiment.jsonv2 && go1.27
+
+package json
+
+import jsonv2 "encoding/json/v2"
+
+// encoding/json/v2 is still an experiment. It arrived in Go 1.25 behind
+// GOEXPERIMENT=jsonv2, and the package only exists while the experiment is
+// on, which is what the goexperiment.jsonv2 build tag says. Go 1.27 turns
+// it on by default and is the release its API is recorded in, so that's
+// the version vet holds this file to. Build with GOEXPERIMENT=nojsonv2, or
+// an older toolchain, and this codec is left out.
+//
+// Its defaults are stricter than v1's: field names match case-sensitively,
+// duplicate keys and invalid UTF-8 are errors, and nil slices and maps
+// encode as [] and {} rather than null. The conformance tests show each of
+// these
+
+type v2Codec struct{}
+
+func (v2Codec) Name() string                       { return "encoding/json/v2" }
+func (v2Codec) Marshal(v any) ([]byte, error)      { return jsonv2.Marshal(v) }
+func (v2Codec) Unmarshal(data []byte, v any) error { return jsonv2.Unmarshal(data, v) }
+
+func init() {
+	codecs = append(codecs, v2Codec{})
+}
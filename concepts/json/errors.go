@@ -0,0 +1,123 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// encoding/json's errors point at a byte offset - "invalid character '}'
+// looking for beginning of value" after 2041 bytes - which is no help to
+// someone looking at their request body in an editor. DecodeError turns the
+// offset into a line and column, and pulls out the field path when the
+// problem is a value of the wrong type
+
+// DecodeError describes where and why a JSON body couldn't be decoded
+type DecodeError struct {
+	Line   int    `json:"line,omitempty"`   // 1-based, 0 when unknown
+	Column int    `json:"column,omitempty"` // 1-based, in characters
+	Field  string `json:"field,omitempty"`  // dotted path, e.g. "items.1.price"
+	Msg    string `json:"error"`
+	Err    error  `json:"-"`
+}
+
+func (e *DecodeError) Error() string {
+	var b strings.Builder
+	b.WriteString("json: ")
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d, column %d: ", e.Line, e.Column)
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// position converts a byte offset into input into a line and column
+func position(input []byte, offset int64) (line, col int) {
+	if offset > int64(len(input)) {
+		offset = int64(len(input))
+	}
+	before := input[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	lastLine := before[bytes.LastIndexByte(before, '\n')+1:]
+	return line, utf8.RuneCount(lastLine) + 1
+}
+
+// newDecodeError wraps an error from json.Decoder. input is what was read so
+// far - at least everything up to the error
+func newDecodeError(input []byte, err error) error {
+	var (
+		syntax   *json.SyntaxError
+		typeErr  *json.UnmarshalTypeError
+		de       = &DecodeError{Err: err}
+		atOffset = func(off int64) { de.Line, de.Column = position(input, off) }
+	)
+
+	switch {
+	case errors.As(err, &syntax):
+		// the offset is just past the bad character, point at it instead
+		atOffset(syntax.Offset - 1)
+		de.Msg = syntax.Error()
+	case errors.As(err, &typeErr):
+		// this offset is just past the offending value, which is close enough
+		atOffset(typeErr.Offset)
+		de.Field = typeErr.Field
+		de.Msg = fmt.Sprintf("%s: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		if typeErr.Field == "" {
+			de.Msg = fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		atOffset(int64(len(input)))
+		de.Msg = "unexpected end of input"
+	case errors.Is(err, io.EOF):
+		de.Msg = "empty body"
+	case errors.Is(err, ErrTrailingData), errors.Is(err, ErrTooLarge):
+		return err
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// DisallowUnknownFields' error has no type of its own, just text
+		de.Field = strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		de.Msg = "unknown field " + fmt.Sprintf("%q", de.Field)
+	default:
+		return err
+	}
+	return de
+}
+
+// trailingDataError points at the first thing after the value
+func trailingDataError(input []byte, valueEnd int64) error {
+	off := valueEnd
+	for off < int64(len(input)) && strings.ContainsRune(" \t\r\n", rune(input[off])) {
+		off++
+	}
+	de := &DecodeError{Err: ErrTrailingData, Msg: "unexpected data after value"}
+	de.Line, de.Column = position(input, off)
+	return de
+}
+
+// WriteDecodeError writes err as a JSON error response: 413 for a body over
+// MaxBytes, 400 for anything else. A DecodeError's position and field come
+// along so the client can find the problem
+//
+//	{"line":3,"column":15,"field":"completed","error":"completed: expected bool, got string"}
+func WriteDecodeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, ErrTooLarge) {
+		status = http.StatusRequestEntityTooLarge
+	}
+
+	var body any = map[string]string{"error": err.Error()}
+	var de *DecodeError
+	if errors.As(err, &de) {
+		body = de
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,122 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lineItems struct {
+	Customer string `json:"customer"`
+	Items    []struct {
+		SKU      string `json:"sku"`
+		Quantity int    `json:"quantity"`
+	} `json:"items"`
+}
+
+func TestDecodeErrorPositions(t *testing.T) {
+	// the original v1 leaves array indexes out of the path
+	deepField := "items.1.quantity"
+	if !jsonv2Enabled {
+		deepField = "items.quantity"
+	}
+
+	for _, tc := range []struct {
+		name   string
+		input  string
+		opts   []Option
+		line   int
+		column int
+		field  string
+		msg    string
+	}{
+		{
+			name:  "syntax error points at the bad character",
+			input: "{\n  \"customer\": \"ann\",\n  \"items\": [}\n}",
+			line:  3, column: 13,
+			msg: "invalid character '}'",
+		},
+		{
+			name:  "truncated",
+			input: "{\n  \"customer\": \"ann\",\n  \"items\": [",
+			line:  3, column: 13,
+			msg: "unexpected end of input",
+		},
+		{
+			name:  "type mismatch deep in the document",
+			input: "{\"customer\":\"ann\",\n\"items\":[\n  {\"sku\":\"a\",\"quantity\":1},\n  {\"sku\":\"b\",\"quantity\":\"two\"}\n]}",
+			line:  4, column: 30,
+			field: deepField,
+			msg:   deepField + ": expected int, got string",
+		},
+		{
+			name:  "unknown field",
+			input: `{"customer":"ann","coupon":"SAVE10"}`,
+			opts:  []Option{DisallowUnknownFields()},
+			field: "coupon",
+			msg:   `unknown field "coupon"`,
+		},
+		{
+			name:  "trailing data",
+			input: "{\"customer\":\"ann\"}\n\n  {}",
+			line:  3, column: 3,
+			msg: "unexpected data after value",
+		},
+		{
+			name:  "columns count characters, not bytes",
+			input: `{"customer":"ünïcödé",}`,
+			line:  1, column: 23,
+			msg: "invalid character '}'",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decode[lineItems](strings.NewReader(tc.input), tc.opts...)
+
+			var de *DecodeError
+			require.True(t, errors.As(err, &de), "%T %v", err, err)
+			assert.Equal(t, tc.line, de.Line)
+			assert.Equal(t, tc.column, de.Column)
+			assert.Equal(t, tc.field, de.Field)
+			assert.Contains(t, de.Msg, tc.msg)
+		})
+	}
+}
+
+func TestDecodeErrorUnwraps(t *testing.T) {
+	_, err := Decode[lineItems](strings.NewReader(`{"customer":1}`))
+
+	var typeErr *json.UnmarshalTypeError
+	assert.True(t, errors.As(err, &typeErr))
+
+	_, err = Decode[lineItems](strings.NewReader(`{} []`))
+	assert.ErrorIs(t, err, ErrTrailingData)
+}
+
+func TestWriteDecodeError(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		opts   []Option
+		status int
+		want   string
+	}{
+		{"{\n\"customer\": true}", nil, http.StatusBadRequest, `{"line":2,"column":17,"field":"customer","error":"customer: expected string, got bool"}`},
+		{`{"customer":"` + strings.Repeat("x", 100) + `"}`, []Option{MaxBytes(50)}, http.StatusRequestEntityTooLarge, `{"error":"json: input too large: limit is 50 bytes"}`},
+		{``, nil, http.StatusBadRequest, `{"error":"empty body"}`},
+	} {
+		_, err := Decode[lineItems](strings.NewReader(tc.input), tc.opts...)
+		require.Error(t, err)
+
+		rec := httptest.NewRecorder()
+		WriteDecodeError(rec, err)
+
+		assert.Equal(t, tc.status, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		assert.JSONEq(t, tc.want, rec.Body.String())
+	}
+}
@@ -3,24 +3,134 @@ package json
 import (
 	"bytes"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 )
 
-type testJSON struct {
-	Name string `json:"name"`
+// Validator is implemented by types that can check themselves once decoded.
+// Decode calls it automatically, so a T that comes back without an error is
+// both well-formed and valid
+type Validator interface {
+	Validate() error
 }
 
-func marshal(b []byte, tj *testJSON) error {
-	d := json.NewDecoder(bytes.NewReader(b))
-	d.DisallowUnknownFields()
+type decodeOptions struct {
+	disallowUnknown bool
+	maxBytes        int64
+	useNumber       bool
+}
+
+// Option changes how Decode behaves
+type Option func(*decodeOptions)
+
+// DisallowUnknownFields makes keys that don't match a struct field an error,
+// rather than silently dropping them
+func DisallowUnknownFields() Option {
+	return func(o *decodeOptions) { o.disallowUnknown = true }
+}
+
+// MaxBytes caps how much of r is read. Anything longer is an ErrTooLarge
+func MaxBytes(n int64) Option {
+	return func(o *decodeOptions) { o.maxBytes = n }
+}
+
+// UseNumber decodes numbers inside interface{} values as json.Number instead
+// of float64, so big integers don't lose precision
+func UseNumber() Option {
+	return func(o *decodeOptions) { o.useNumber = true }
+}
 
-	err := d.Decode(tj)
-	if err != nil {
-		log.Println("got an err ", err)
+var (
+	// ErrTooLarge is returned when the input is longer than MaxBytes
+	ErrTooLarge = errors.New("json: input too large")
+
+	// ErrTrailingData is returned when there's anything but whitespace after
+	// the value - json.Decoder would happily leave it for the next Decode
+	ErrTrailingData = errors.New("json: unexpected data after value")
+)
+
+// limitedReader is io.LimitReader, except it notices going over the limit
+// rather than just stopping there - a truncated body would otherwise come back
+// as a confusing syntax error
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		l.exceeded = true
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// Decode reads one JSON value from r into a T. It replaces a helper that was
+// hardwired to a single struct - with generics the same checks work for any
+// type, and the caller gets the value back instead of passing a pointer in.
+//
+//	tj, err := Decode[testJSON](r.Body, DisallowUnknownFields(), MaxBytes(1<<20))
+func Decode[T any](r io.Reader, opts ...Option) (T, error) {
+	var (
+		o decodeOptions
+		v T
+	)
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var lr *limitedReader
+	if o.maxBytes > 0 {
+		// one spare byte lets a value of exactly maxBytes through
+		lr = &limitedReader{r: r, n: o.maxBytes + 1}
+		r = lr
+	}
+
+	// keep a copy of what the decoder reads, to turn error offsets into
+	// lines and columns
+	var input bytes.Buffer
+	r = io.TeeReader(r, &input)
+
+	d := json.NewDecoder(r)
+	if o.disallowUnknown {
+		d.DisallowUnknownFields()
+	}
+	if o.useNumber {
+		d.UseNumber()
+	}
+
+	tooLarge := func(err error) error {
+		if lr != nil && lr.exceeded {
+			return fmt.Errorf("%w: limit is %d bytes", ErrTooLarge, o.maxBytes)
+		}
 		return err
 	}
 
-	log.Println("no error")
+	if err := d.Decode(&v); err != nil {
+		return v, newDecodeError(input.Bytes(), tooLarge(err))
+	}
+
+	end := d.InputOffset()
+	if _, err := d.Token(); err != io.EOF {
+		if err == nil {
+			return v, trailingDataError(input.Bytes(), end)
+		}
+		return v, newDecodeError(input.Bytes(), tooLarge(err))
+	}
+	// *T has both T's value and pointer methods, so this finds Validate
+	// whichever receiver it was declared on
+	if vv, ok := any(&v).(Validator); ok {
+		if err := vv.Validate(); err != nil {
+			return v, err
+		}
+	}
 
-	return nil
+	return v, nil
 }
@@ -1,22 +1,99 @@
 package json
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+type testJSON struct {
+	Name string `json:"name"`
+}
+
+var errNoName = errors.New("name is required")
+
+func (tj *testJSON) Validate() error {
+	if tj.Name == "" {
+		return errNoName
+	}
+	return nil
+}
+
+// valueValidated has Validate on the value receiver
+type valueValidated struct {
+	N int `json:"n"`
+}
+
+func (v valueValidated) Validate() error {
+	if v.N < 0 {
+		return errors.New("n must not be negative")
+	}
+	return nil
+}
+
 var goodJSONString = `{"name":"michael"}`
 var badJSONString = `{"name":"michael","address": "1234 Shady Lane Boston, MA"}`
 
-func TestMarshal(t *testing.T) {
-	var err error
-	tj := &testJSON{}
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		opts    []Option
+		want    testJSON
+		wantErr error  // checked with errors.Is when set
+		errText string // checked with Contains when set
+	}{
+		{name: "good", input: goodJSONString, want: testJSON{Name: "michael"}},
+		{name: "unknown fields allowed by default", input: badJSONString, want: testJSON{Name: "michael"}},
+		{name: "unknown fields disallowed", input: badJSONString, opts: []Option{DisallowUnknownFields()}, errText: `unknown field "address"`},
+		{name: "validation fails", input: `{}`, wantErr: errNoName},
+		{name: "syntax error", input: `{"name":`, errText: "line 1, column 9: unexpected end of input"},
+		{name: "wrong type", input: `{"name":7}`, errText: "line 1, column 10: name: expected string, got number"},
+		{name: "trailing data", input: goodJSONString + `{}`, wantErr: ErrTrailingData},
+		{name: "trailing whitespace is fine", input: goodJSONString + "\n\t ", want: testJSON{Name: "michael"}},
+		{name: "under the limit", input: goodJSONString, opts: []Option{MaxBytes(int64(len(goodJSONString)))}, want: testJSON{Name: "michael"}},
+		{name: "over the limit", input: goodJSONString, opts: []Option{MaxBytes(10)}, wantErr: ErrTooLarge},
+		{name: "over the limit with padding", input: goodJSONString + strings.Repeat(" ", 100), opts: []Option{MaxBytes(20)}, wantErr: ErrTooLarge},
+		{name: "empty", input: ``, errText: "empty body"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Decode[testJSON](strings.NewReader(tc.input), tc.opts...)
+
+			if tc.wantErr == nil && tc.errText == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tc.want, got)
+				return
+			}
 
-	err = marshal([]byte(goodJSONString), tj)
-	assert.NoError(t, err)
-	assert.Equal(t, "michael", tj.Name)
+			require.Error(t, err)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+			if tc.errText != "" {
+				assert.Contains(t, err.Error(), tc.errText)
+			}
+		})
+	}
+}
 
-	err = marshal([]byte(badJSONString), tj)
+func TestDecodeValueReceiverValidator(t *testing.T) {
+	_, err := Decode[valueValidated](strings.NewReader(`{"n":-1}`))
 	assert.Error(t, err)
+
+	v, err := Decode[valueValidated](strings.NewReader(`{"n":1}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, v.N)
+}
+
+func TestDecodeNonStruct(t *testing.T) {
+	m, err := Decode[map[string]any](strings.NewReader(`{"id":12345678901234567890}`), UseNumber())
+	require.NoError(t, err)
+	assert.Equal(t, "12345678901234567890", m["id"].(interface{ String() string }).String())
+
+	s, err := Decode[[]int](strings.NewReader(`[1,2,3]`))
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, s)
 }
@@ -0,0 +1,8 @@
+//go:build goexperiment.jsonv2
+
+package json
+
+// jsonv2Enabled is whether encoding/json is running on top of v2, which it
+// does whenever the experiment is on. Its errors and allocations differ
+// from the original v1's, and some tests depend on them
+const jsonv2Enabled = true
@@ -0,0 +1,192 @@
+package json
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// NDJSON (newline-delimited JSON, aka JSON Lines) is one JSON value per line:
+//
+//	{"id":1,"name":"a"}
+//	{"id":2,"name":"b"}
+//
+// Unlike one big array it can be written a record at a time and read a record
+// at a time, so neither side needs the whole thing in memory, and a client
+// can start on the first record while the server is still producing the rest.
+// The content type is usually application/x-ndjson
+
+/*
+ *
+ * writing
+ *
+ */
+
+type ndjsonWriter struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// newNDJSONWriter wraps w. json.Encoder already ends each value with a
+// newline, and compact output has no other newlines in it, so it's most of
+// the way there on its own
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &ndjsonWriter{w: w, enc: enc}
+}
+
+// Write encodes v as one line and flushes it, so it's sent now rather than
+// when some buffer happens to fill up. Both http.ResponseWriter (via
+// http.Flusher) and *bufio.Writer are handled.
+//
+// Pass a pointer. A struct passed by value is copied into the interface,
+// and copied again so reflect can address it - two allocations a line that
+// a pointer doesn't need. The Encoder's own buffers are pooled already
+func (n *ndjsonWriter) Write(v any) error {
+	if err := n.enc.Encode(v); err != nil {
+		return err
+	}
+
+	switch f := n.w.(type) {
+	case http.Flusher:
+		f.Flush()
+	case interface{ Flush() error }:
+		return f.Flush()
+	}
+	return nil
+}
+
+/*
+ *
+ * reading
+ *
+ */
+
+// ndjsonLineError says which line couldn't be decoded
+type ndjsonLineError struct {
+	Line int
+	Err  error
+}
+
+func (e *ndjsonLineError) Error() string { return fmt.Sprintf("ndjson line %d: %v", e.Line, e.Err) }
+func (e *ndjsonLineError) Unwrap() error { return e.Err }
+
+// ndjsonReader iterates over the values in a stream, bufio.Scanner style:
+//
+//	r := newNDJSONReader[todo](body)
+//	for r.Next() {
+//		t := r.Value()
+//	}
+//	if err := r.Err(); err != nil { ... }
+type ndjsonReader[T any] struct {
+	s    *bufio.Scanner
+	buf  *[]byte // from scanBufs, until the end
+	line int
+	v    T
+	err  error
+
+	// SkipInvalid makes malformed lines get recorded in Skipped instead of
+	// stopping the iteration - useful for log files, where one bad line
+	// shouldn't lose the rest
+	SkipInvalid bool
+	Skipped     []*ndjsonLineError
+}
+
+// maxNDJSONLine is the longest line the reader accepts. bufio.Scanner's
+// default of 64KB is too small for some records
+const maxNDJSONLine = 1 << 20
+
+// scanBufs saves each reader allocating a 64KB line buffer of its own - a
+// server reading an NDJSON body per request would make one per request.
+// A reader puts its buffer back when it gets to the end
+var scanBufs = sync.Pool{New: func() any { b := make([]byte, 64<<10); return &b }}
+
+func newNDJSONReader[T any](r io.Reader) *ndjsonReader[T] {
+	buf := scanBufs.Get().(*[]byte)
+	s := bufio.NewScanner(r)
+	s.Buffer(*buf, maxNDJSONLine)
+	return &ndjsonReader[T]{s: s, buf: buf}
+}
+
+// release gives the line buffer back. The Scanner may have moved on to a
+// bigger one for a long line, but the one it started with is still fine to
+// reuse
+func (n *ndjsonReader[T]) release() {
+	if n.buf != nil {
+		scanBufs.Put(n.buf)
+		n.buf = nil
+	}
+}
+
+// Next decodes the next value, returning false at the end of the stream or
+// on an error. Blank lines are skipped
+func (n *ndjsonReader[T]) Next() bool {
+	// no buffer means it's finished, and the Scanner mustn't touch the
+	// buffer it gave back
+	if n.err != nil || n.buf == nil {
+		return false
+	}
+
+	for n.s.Scan() {
+		n.line++
+		line := bytes.TrimSpace(n.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		// decoding straight into n.v rather than a local saves the local
+		// escaping to the heap on every line. It's zeroed first because
+		// Unmarshal fills in maps and slices that are already there rather
+		// than replacing them
+		var zero T
+		n.v = zero
+		if err := json.Unmarshal(line, &n.v); err != nil {
+			lerr := &ndjsonLineError{Line: n.line, Err: err}
+			if n.SkipInvalid {
+				n.Skipped = append(n.Skipped, lerr)
+				continue
+			}
+			n.err = lerr
+			n.release()
+			return false
+		}
+		return true
+	}
+
+	if err := n.s.Err(); err != nil {
+		n.err = &ndjsonLineError{Line: n.line + 1, Err: err}
+	}
+	n.release()
+	return false
+}
+
+// Value is the value decoded by the last successful Next
+func (n *ndjsonReader[T]) Value() T { return n.v }
+
+// Err is the error that stopped iteration, if any - nil at a clean end
+func (n *ndjsonReader[T]) Err() error { return n.err }
+
+/*
+ *
+ * streaming over HTTP
+ *
+ */
+
+// ndjsonHandler streams whatever produce emits, one line per value. Once the
+// first line is out the status is already 200, so a failure partway through
+// can only be reported in-band, as a final {"error": ...} line
+func ndjsonHandler(produce func(r *http.Request, emit func(v any) error) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		nw := newNDJSONWriter(w)
+
+		if err := produce(r, nw.Write); err != nil {
+			_ = nw.Write(map[string]string{"error": err.Error()})
+		}
+	})
+}
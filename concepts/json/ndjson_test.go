@@ -0,0 +1,191 @@
+package json
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestNDJSONRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := newNDJSONWriter(&buf)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, w.Write(record{ID: i, Name: fmt.Sprintf("r<%d>", i)}))
+	}
+	assert.Equal(t, "{\"id\":1,\"name\":\"r<1>\"}\n", strings.SplitAfter(buf.String(), "\n")[0])
+
+	r := newNDJSONReader[record](&buf)
+	var got []record
+	for r.Next() {
+		got = append(got, r.Value())
+	}
+	require.NoError(t, r.Err())
+	assert.Len(t, got, 3)
+	assert.Equal(t, "r<3>", got[2].Name)
+}
+
+func TestNDJSONWriterFlushesBufio(t *testing.T) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+
+	require.NoError(t, newNDJSONWriter(bw).Write(record{ID: 1}))
+	assert.Equal(t, "{\"id\":1,\"name\":\"\"}\n", buf.String())
+}
+
+func TestNDJSONMalformed(t *testing.T) {
+	input := "{\"id\":1}\n\n{\"id\":2\n{\"id\":\"three\"}\n{\"id\":4}\n"
+
+	r := newNDJSONReader[record](strings.NewReader(input))
+	var ids []int
+	for r.Next() {
+		ids = append(ids, r.Value().ID)
+	}
+	assert.Equal(t, []int{1}, ids)
+
+	var lerr *ndjsonLineError
+	require.True(t, errors.As(r.Err(), &lerr))
+	assert.Equal(t, 3, lerr.Line)
+	assert.False(t, r.Next(), "stays stopped after an error")
+
+	r = newNDJSONReader[record](strings.NewReader(input))
+	r.SkipInvalid = true
+	ids = nil
+	for r.Next() {
+		ids = append(ids, r.Value().ID)
+	}
+	require.NoError(t, r.Err())
+	assert.Equal(t, []int{1, 4}, ids)
+	require.Len(t, r.Skipped, 2)
+	assert.Equal(t, 4, r.Skipped[1].Line)
+}
+
+func TestNDJSONLineTooLong(t *testing.T) {
+	long := `{"name":"` + strings.Repeat("x", maxNDJSONLine) + `"}`
+	r := newNDJSONReader[record](strings.NewReader("{\"id\":1}\n" + long))
+
+	assert.True(t, r.Next())
+	assert.False(t, r.Next())
+	assert.ErrorIs(t, r.Err(), bufio.ErrTooLong)
+}
+
+func TestNDJSONHandler(t *testing.T) {
+	h := ndjsonHandler(func(r *http.Request, emit func(any) error) error {
+		for i := 1; i <= 3; i++ {
+			if err := emit(record{ID: i}); err != nil {
+				return err
+			}
+		}
+		if r.URL.Query().Get("fail") != "" {
+			return errors.New("database went away")
+		}
+		return nil
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+
+	r := newNDJSONReader[record](res.Body)
+	n := 0
+	for r.Next() {
+		n++
+		assert.Equal(t, n, r.Value().ID)
+	}
+	require.NoError(t, r.Err())
+	assert.Equal(t, 3, n)
+
+	res, err = http.Get(srv.URL + "?fail=1")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	lines := newNDJSONReader[map[string]any](res.Body)
+	var last map[string]any
+	for lines.Next() {
+		last = lines.Value()
+	}
+	assert.Equal(t, "database went away", last["error"])
+}
+
+func TestNDJSONAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector empties pools at random")
+	}
+	if !jsonv2Enabled {
+		t.Skip("the original v1 decoder allocates for every value")
+	}
+
+	rec := &record{ID: 1000, Name: "allocation free"}
+	w := newNDJSONWriter(io.Discard)
+	assert.Zero(t, testing.AllocsPerRun(100, func() { w.Write(rec) }), "writing a pointer")
+
+	// reading allocates the reader, and nothing per line. Numbers only,
+	// since every string decoded is a new one
+	type point struct{ X, Y int }
+	lines := func(n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, "{\"X\":%d,\"Y\":%d}\n", i, -i)
+		}
+		return b.String()
+	}
+	src := strings.NewReader("")
+	read := func(s string) float64 {
+		return testing.AllocsPerRun(20, func() {
+			src.Reset(s)
+			r := newNDJSONReader[point](src)
+			for r.Next() {
+			}
+		})
+	}
+	few, many := read(lines(10)), read(lines(1000))
+	assert.Equal(t, few, many, "10 lines vs 1000")
+	assert.LessOrEqual(t, many, 3.0, "the reader and its Scanner, the buffer comes from the pool")
+}
+
+func BenchmarkNDJSON(b *testing.B) {
+	var buf bytes.Buffer
+	w := newNDJSONWriter(&buf)
+	for i := 0; i < 1000; i++ {
+		_ = w.Write(record{ID: i, Name: "benchmark record"})
+	}
+	data := buf.Bytes()
+
+	b.Run("write", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var out bytes.Buffer
+			w := newNDJSONWriter(&out)
+			rec := &record{Name: "benchmark record"}
+			for j := 0; j < 1000; j++ {
+				rec.ID = j
+				_ = w.Write(rec)
+			}
+		}
+	})
+	b.Run("read", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			r := newNDJSONReader[record](bytes.NewReader(data))
+			for r.Next() {
+			}
+		}
+	})
+}
@@ -0,0 +1,5 @@
+//go:build !goexperiment.jsonv2
+
+package json
+
+const jsonv2Enabled = false
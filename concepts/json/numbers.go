@@ -0,0 +1,154 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// JSON numbers have no size or precision of their own, but decoding one into
+// interface{} gives a float64, which only holds integers exactly up to 2^53.
+// Past that, neighbouring IDs collapse onto the same float:
+//
+//	9007199254740993 -> 9007199254740992
+//
+// Twitter famously hit this and started sending every ID twice, once as a
+// string ("id_str") - JavaScript clients have the same float64 limit
+
+/*
+ *
+ * big integers
+ *
+ */
+
+// idAsAny decodes the way most code accidentally does, through interface{}
+func idAsAny(data []byte) (any, error) {
+	var v map[string]any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v["id"], nil
+}
+
+// idAsNumber uses Decoder.UseNumber, which keeps numbers in interface{}
+// values as json.Number - the original text - so nothing's lost until the
+// caller picks a type with Int64, Float64 or String
+func idAsNumber(data []byte) (json.Number, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v map[string]any
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+	n, ok := v["id"].(json.Number)
+	if !ok {
+		return "", fmt.Errorf("id is %T, not a number", v["id"])
+	}
+	return n, nil
+}
+
+// With a struct none of this comes up: decoding straight into int64 parses
+// the digits as an integer. The ",string" option goes further and puts the
+// number in quotes on the wire, so clients that only have float64 can still
+// pass it around intact
+type account struct {
+	ID       int64 `json:"id"`
+	ExternID int64 `json:"extern_id,string"`
+}
+
+/*
+ *
+ * money
+ *
+ */
+
+// Floats can't hold most decimal fractions - 0.1 + 0.2 != 0.3 - so money is
+// kept as an integer count of the smallest unit. money marshals as a decimal
+// string ("12.34") so no client ever parses it as a float, and unmarshals
+// from either a string or a bare number, working on the digits directly
+// rather than going through float64
+type money int64 // cents
+
+var errBadMoney = errors.New("invalid money amount")
+
+func (m money) String() string {
+	sign := ""
+	c := int64(m)
+	if c < 0 {
+		sign = "-"
+		if c == math.MinInt64 {
+			return "-92233720368547758.08"
+		}
+		c = -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+func (m money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+func (m *money) UnmarshalJSON(data []byte) error {
+	// null leaves m alone, as it does for every built-in type
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+
+	v, err := parseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// parseMoney parses "12", "12.3" or "-12.34" exactly. More than two decimal
+// places is an error rather than a silent rounding
+func parseMoney(s string) (money, error) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(frac) > 2 || strings.ContainsAny(whole+frac, "+-eE") {
+		return 0, fmt.Errorf("%w: %q", errBadMoney, s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	// the sign goes in before parsing: MinInt64 has no positive twin to
+	// negate
+	digits := whole + frac
+	if neg {
+		digits = "-" + digits
+	}
+	cents, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errBadMoney, err)
+	}
+	return money(cents), nil
+}
+
+type lineItem struct {
+	Description string `json:"description"`
+	Price       money  `json:"price"`
+	Quantity    int    `json:"quantity"`
+}
+
+// total adds in cents, so it's exact however many items there are
+func total(items []lineItem) money {
+	var t money
+	for _, it := range items {
+		t += it.Price * money(it.Quantity)
+	}
+	return t
+}
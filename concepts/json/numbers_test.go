@@ -0,0 +1,96 @@
+package json
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const bigID = `{"id":9007199254740993}`
+
+func TestFloatLosesPrecision(t *testing.T) {
+	v, err := idAsAny([]byte(bigID))
+	require.NoError(t, err)
+	assert.Equal(t, float64(9007199254740992), v)
+
+	n, err := idAsNumber([]byte(bigID))
+	require.NoError(t, err)
+	assert.Equal(t, "9007199254740993", n.String())
+
+	i, err := n.Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(9007199254740993), i)
+
+	// and it goes back out exactly as it came in
+	out, err := json.Marshal(map[string]any{"id": n})
+	require.NoError(t, err)
+	assert.Equal(t, bigID, string(out))
+}
+
+func TestAccountIDs(t *testing.T) {
+	in := `{"id":9007199254740993,"extern_id":"9223372036854775807"}`
+
+	var a account
+	require.NoError(t, json.Unmarshal([]byte(in), &a))
+	assert.Equal(t, int64(9007199254740993), a.ID)
+	assert.Equal(t, int64(9223372036854775807), a.ExternID)
+
+	out, err := json.Marshal(a)
+	require.NoError(t, err)
+	assert.Equal(t, in, string(out))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"extern_id":12}`), &a), ",string wants quotes")
+}
+
+func TestMoney(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want money
+		out  string
+	}{
+		{`"12.34"`, 1234, `"12.34"`},
+		{`12.34`, 1234, `"12.34"`},
+		{`"12.3"`, 1230, `"12.30"`},
+		{`12`, 1200, `"12.00"`},
+		{`"-0.05"`, -5, `"-0.05"`},
+		{`"92233720368547758.07"`, 9223372036854775807, `"92233720368547758.07"`},
+		{`"-92233720368547758.08"`, -9223372036854775808, `"-92233720368547758.08"`},
+		{`0.1`, 10, `"0.10"`},
+	} {
+		var m money
+		require.NoError(t, json.Unmarshal([]byte(tc.in), &m), tc.in)
+		assert.Equal(t, tc.want, m, tc.in)
+
+		out, err := json.Marshal(m)
+		require.NoError(t, err)
+		assert.Equal(t, tc.out, string(out), tc.in)
+	}
+
+	for _, bad := range []string{`"1.234"`, `"abc"`, `"1e3"`, `".5"`, `"92233720368547758.08"`, `true`} {
+		var m money
+		assert.Error(t, json.Unmarshal([]byte(bad), &m), bad)
+	}
+
+	assert.Equal(t, "-92233720368547758.08", money(-9223372036854775808).String())
+
+	// null is no value, so there's nothing to set
+	m := money(1234)
+	require.NoError(t, json.Unmarshal([]byte(`null`), &m))
+	assert.Equal(t, money(1234), m)
+	var item struct{ Price *money }
+	require.NoError(t, json.Unmarshal([]byte(`{"Price":null}`), &item))
+	assert.Nil(t, item.Price)
+}
+
+func TestMoneyTotalIsExact(t *testing.T) {
+	var items []lineItem
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"description":"a","price":"0.10","quantity":1},
+		{"description":"b","price":"0.20","quantity":1}
+	]`), &items))
+
+	assert.Equal(t, money(30), total(items))
+	assert.NotEqual(t, 0.3, 0.1+func() float64 { return 0.2 }(), "while floats are not")
+}
@@ -0,0 +1,343 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// There are two standard ways to describe a partial update to a JSON document.
+//
+// JSON Merge Patch (RFC 7386, application/merge-patch+json) is a document
+// shaped like the target: keys present are set, null deletes, objects merge
+// recursively, anything else (arrays included) replaces wholesale. Simple,
+// but it can't set a value to null or touch a single array element.
+//
+// JSON Patch (RFC 6902, application/json-patch+json) is a list of operations
+// on paths. More verbose, but it can do anything, and "test" makes an update
+// conditional on the current value
+
+/*
+ *
+ * merge patch
+ *
+ */
+
+// mergePatch is the RFC 7386 algorithm, nearly line for line
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// MergePatch applies a merge patch document to doc and returns the result
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("merge patch: document: %w", err)
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("merge patch: patch: %w", err)
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+/*
+ *
+ * JSON Patch
+ *
+ */
+
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+var (
+	errPatchPath   = errors.New("json patch: path not found")
+	errPatchTest   = errors.New("json patch: test failed")
+	errPatchBadOp  = errors.New("json patch: invalid operation")
+	errBadPointer  = errors.New("json pointer: invalid")
+	errPatchBounds = errors.New("json patch: array index out of range")
+)
+
+// ApplyPatch applies a JSON Patch document to doc. Operations run in order
+// and the whole patch fails if any one does - doc itself is never modified
+func ApplyPatch(doc, patch []byte) ([]byte, error) {
+	var ops []patchOp
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", errPatchBadOp, err)
+	}
+	var target any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("json patch: document: %w", err)
+	}
+
+	for i, op := range ops {
+		var err error
+		if target, err = applyOp(target, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOp(doc any, op patchOp) (any, error) {
+	value := func() (any, error) {
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", errPatchBadOp)
+		}
+		var v any
+		err := json.Unmarshal(op.Value, &v)
+		return v, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return addAt(doc, op.Path, v)
+	case "remove":
+		doc, _, err := removeAt(doc, op.Path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if doc, _, err = removeAt(doc, op.Path); err != nil {
+			return nil, err
+		}
+		return addAt(doc, op.Path, v)
+	case "move":
+		doc, v, err := removeAt(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return addAt(doc, op.Path, v)
+	case "copy":
+		v, err := getAt(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return addAt(doc, op.Path, deepCopy(v))
+	case "test":
+		want, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := getAt(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return nil, errPatchTest
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: unknown op %q", errPatchBadOp, op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its reference tokens.
+// "" is the whole document, "/a/b" is two tokens, and ~1 and ~0 escape / and ~
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("%w: %q", errBadPointer, p)
+	}
+
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array token. "-" means one past the end, which is only
+// valid when adding
+func arrayIndex(tok string, length int, adding bool) (int, error) {
+	if tok == "-" && adding {
+		return length, nil
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || (len(tok) > 1 && tok[0] == '0') {
+		return 0, fmt.Errorf("%w: bad array index %q", errBadPointer, tok)
+	}
+
+	max := length - 1
+	if adding {
+		max = length
+	}
+	if i < 0 || i > max {
+		return 0, errPatchBounds
+	}
+	return i, nil
+}
+
+func getAt(doc any, path string) (any, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cur := doc
+	for _, tok := range tokens {
+		switch c := cur.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				return nil, errPatchPath
+			}
+			cur = v
+		case []any:
+			i, err := arrayIndex(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			cur = c[i]
+		default:
+			return nil, errPatchPath
+		}
+	}
+	return cur, nil
+}
+
+// addAt and removeAt find the parent of path, then change it. Arrays have to
+// be rebuilt rather than changed in place, and the new slice stored back in
+// the grandparent, which is why both return the (possibly new) document
+func addAt(doc any, path string, v any) (any, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return v, nil
+	}
+
+	return modifyParent(doc, tokens, func(parent any, last string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			p[last] = v
+			return p, nil
+		case []any:
+			i, err := arrayIndex(last, len(p), true)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = v
+			return p, nil
+		}
+		return nil, errPatchPath
+	})
+}
+
+func removeAt(doc any, path string) (any, any, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed any
+	doc, err = modifyParent(doc, tokens, func(parent any, last string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			v, ok := p[last]
+			if !ok {
+				return nil, errPatchPath
+			}
+			removed = v
+			delete(p, last)
+			return p, nil
+		case []any:
+			i, err := arrayIndex(last, len(p), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = p[i]
+			return append(p[:i:i], p[i+1:]...), nil
+		}
+		return nil, errPatchPath
+	})
+	return doc, removed, err
+}
+
+func modifyParent(doc any, tokens []string, change func(parent any, last string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return change(doc, tokens[0])
+	}
+
+	tok, rest := tokens[0], tokens[1:]
+	switch c := doc.(type) {
+	case map[string]any:
+		child, ok := c[tok]
+		if !ok {
+			return nil, errPatchPath
+		}
+		updated, err := modifyParent(child, rest, change)
+		if err != nil {
+			return nil, err
+		}
+		c[tok] = updated
+		return c, nil
+	case []any:
+		i, err := arrayIndex(tok, len(c), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := modifyParent(c[i], rest, change)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = updated
+		return c, nil
+	}
+	return nil, errPatchPath
+}
+
+// deepCopy copies a decoded JSON value, so a "copy" op doesn't leave two
+// paths sharing one map
+func deepCopy(v any) any {
+	switch c := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(c))
+		for k, v := range c {
+			m[k] = deepCopy(v)
+		}
+		return m
+	case []any:
+		s := make([]any, len(c))
+		for i, v := range c {
+			s[i] = deepCopy(v)
+		}
+		return s
+	}
+	return v
+}
@@ -0,0 +1,180 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// JSON arrays can hold objects of different shapes, with a field saying which
+// is which:
+//
+//	[{"type":"circle","radius":2},{"type":"rect","width":3,"height":4}]
+//
+// encoding/json can't decode that into []shape on its own - shape is an
+// interface, and it has no idea which concrete type to create. The trick is
+// two passes: decode just enough to read the discriminator, keeping the rest
+// as json.RawMessage, then decode the raw bytes again into the right type
+
+type shape interface {
+	Area() float64
+}
+
+type circle struct {
+	Radius float64 `json:"radius"`
+}
+
+func (c circle) Area() float64 { return math.Pi * c.Radius * c.Radius }
+
+type rect struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func (r rect) Area() float64 { return r.Width * r.Height }
+
+var errUnknownShape = errors.New("unknown shape type")
+
+// envelope is the first pass. Only Type gets decoded, the whole object stays
+// raw for the second pass (the type field is decoded again there, and ignored)
+type envelope struct {
+	Type string `json:"type"`
+}
+
+/*
+ *
+ * the switch
+ *
+ */
+
+// decodeShapesSwitch is the simplest version: a switch on the type. Adding a
+// shape means editing this function
+func decodeShapesSwitch(data []byte) ([]shape, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+
+	shapes := make([]shape, 0, len(raws))
+	for i, raw := range raws {
+		var env envelope
+		if err := json.Unmarshal(raw, &env); err != nil {
+			return nil, fmt.Errorf("shape %d: %w", i, err)
+		}
+
+		var s shape
+		switch env.Type {
+		case "circle":
+			var c circle
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return nil, fmt.Errorf("shape %d: %w", i, err)
+			}
+			s = c
+		case "rect":
+			var r rect
+			if err := json.Unmarshal(raw, &r); err != nil {
+				return nil, fmt.Errorf("shape %d: %w", i, err)
+			}
+			s = r
+		default:
+			return nil, fmt.Errorf("shape %d: %w %q", i, errUnknownShape, env.Type)
+		}
+		shapes = append(shapes, s)
+	}
+
+	return shapes, nil
+}
+
+/*
+ *
+ * the registry
+ *
+ */
+
+// shapeRegistry maps a type name to a function that decodes the raw object.
+// New shapes register themselves and the decoder never changes - the same
+// idea as database/sql drivers or image formats registering in init
+type shapeRegistry struct {
+	mu       sync.RWMutex
+	decoders map[string]func(json.RawMessage) (shape, error)
+}
+
+func newShapeRegistry() *shapeRegistry {
+	return &shapeRegistry{decoders: map[string]func(json.RawMessage) (shape, error){}}
+}
+
+// registerShape adds a decoder for T under name. It's generic so callers
+// don't each write the same unmarshal-into-a-new-T closure
+func registerShape[T shape](r *shapeRegistry, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, dup := r.decoders[name]; dup {
+		panic("json: shape registered twice: " + name)
+	}
+	r.decoders[name] = func(raw json.RawMessage) (shape, error) {
+		var v T
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+}
+
+func (r *shapeRegistry) decodeOne(raw json.RawMessage) (shape, error) {
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	decode, ok := r.decoders[env.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownShape, env.Type)
+	}
+
+	return decode(raw)
+}
+
+// Decode reads a JSON array of shapes
+func (r *shapeRegistry) Decode(data []byte) ([]shape, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+
+	shapes := make([]shape, 0, len(raws))
+	for i, raw := range raws {
+		s, err := r.decodeOne(raw)
+		if err != nil {
+			return nil, fmt.Errorf("shape %d: %w", i, err)
+		}
+		shapes = append(shapes, s)
+	}
+
+	return shapes, nil
+}
+
+// shapes is the default registry with the built-in shapes
+var shapes = newShapeRegistry()
+
+func init() {
+	registerShape[circle](shapes, "circle")
+	registerShape[rect](shapes, "rect")
+}
+
+// shapeList decodes itself through the default registry, so it can sit inside
+// a bigger struct and json.Unmarshal does the right thing
+type shapeList []shape
+
+func (l *shapeList) UnmarshalJSON(data []byte) error {
+	s, err := shapes.Decode(data)
+	if err != nil {
+		return err
+	}
+	*l = s
+	return nil
+}
@@ -0,0 +1,71 @@
+package json
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var shapesJSON = `[{"type":"circle","radius":1},{"type":"rect","width":3,"height":4}]`
+
+func TestDecodeShapes(t *testing.T) {
+	for name, decode := range map[string]func([]byte) ([]shape, error){
+		"switch":   decodeShapesSwitch,
+		"registry": shapes.Decode,
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := decode([]byte(shapesJSON))
+			require.NoError(t, err)
+
+			assert.Equal(t, []shape{circle{Radius: 1}, rect{Width: 3, Height: 4}}, got)
+			assert.Equal(t, 12.0, got[1].Area())
+
+			_, err = decode([]byte(`[{"type":"circle","radius":1},{"type":"hexagon"}]`))
+			require.Error(t, err)
+			assert.ErrorIs(t, err, errUnknownShape)
+			assert.Contains(t, err.Error(), `shape 1: unknown shape type "hexagon"`)
+
+			_, err = decode([]byte(`[{"radius":1}]`))
+			assert.ErrorIs(t, err, errUnknownShape)
+
+			_, err = decode([]byte(`[{"type":"rect","width":"wide"}]`))
+			assert.Error(t, err)
+		})
+	}
+}
+
+type triangle struct {
+	Base   float64 `json:"base"`
+	Height float64 `json:"height"`
+}
+
+func (t triangle) Area() float64 { return t.Base * t.Height / 2 }
+
+func TestRegistryExtends(t *testing.T) {
+	r := newShapeRegistry()
+	registerShape[triangle](r, "triangle")
+
+	got, err := r.Decode([]byte(`[{"type":"triangle","base":4,"height":3}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []shape{triangle{Base: 4, Height: 3}}, got)
+
+	// the new registry knows nothing about the defaults
+	_, err = r.Decode([]byte(shapesJSON))
+	assert.ErrorIs(t, err, errUnknownShape)
+
+	assert.Panics(t, func() { registerShape[triangle](r, "triangle") })
+}
+
+func TestShapeListField(t *testing.T) {
+	var drawing struct {
+		Name   string    `json:"name"`
+		Shapes shapeList `json:"shapes"`
+	}
+
+	err := json.Unmarshal([]byte(`{"name":"doodle","shapes":`+shapesJSON+`}`), &drawing)
+	require.NoError(t, err)
+	assert.Equal(t, "doodle", drawing.Name)
+	assert.Len(t, drawing.Shapes, 2)
+}
@@ -0,0 +1,135 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+ *
+ * lazy fields
+ *
+ */
+
+// json.RawMessage is just []byte holding an undecoded chunk of the input.
+// As a field type it says "keep this as-is and I'll decide later", which is
+// handy when one field is large and you only sometimes need it, or when its
+// shape depends on another field (see polymorphic.go)
+
+type event struct {
+	ID      string          `json:"id"`
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Decoding an event validates the payload is well-formed JSON (and copies the
+// bytes), but doesn't build any maps or structs for it. decodePayload does
+// that, once the caller knows it wants to
+func (e event) decodePayload(v any) error {
+	if len(e.Payload) == 0 {
+		return fmt.Errorf("event %s: no payload", e.ID)
+	}
+	return json.Unmarshal(e.Payload, v)
+}
+
+// eventsOfKind decodes a batch of events but only fully decodes the payloads
+// of the kind the caller asked for
+func eventsOfKind[T any](data []byte, kind string) ([]T, error) {
+	var events []event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+
+	var out []T
+	for _, e := range events {
+		if e.Kind != kind {
+			continue
+		}
+		var v T
+		if err := e.decodePayload(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+/*
+ *
+ * absent vs null
+ *
+ */
+
+// A PATCH body has three states for each field:
+//
+//	{}                     absent - leave it alone
+//	{"nickname": null}     null - clear it
+//	{"nickname": "mike"}   a value - set it
+//
+// A plain *string only has two: nil for both absent and null. encoding/json
+// leaves the field nil when the key is missing and sets it to nil on null.
+//
+// The fix is a wrapper type. encoding/json only calls UnmarshalJSON when the
+// key is present - and it does call it for null - so Set records presence and
+// Value stays nil for null
+
+type field[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (f *field[T]) UnmarshalJSON(data []byte) error {
+	f.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		f.Value = nil
+		return nil
+	}
+
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	f.Value = &v
+	return nil
+}
+
+// Null reports whether the field was explicitly set to null
+func (f field[T]) Null() bool { return f.Set && f.Value == nil }
+
+type profile struct {
+	Name     string  `json:"name"`
+	Nickname *string `json:"nickname"`
+	Age      int     `json:"age"`
+}
+
+// profilePatch is a partial update. Name and Age can't be null - a missing
+// key leaves them alone, a pointer is enough for that. Nickname is nullable,
+// so it needs all three states
+type profilePatch struct {
+	Name     *string       `json:"name"`
+	Nickname field[string] `json:"nickname"`
+	Age      *int          `json:"age"`
+}
+
+func (p profilePatch) apply(to *profile) {
+	if p.Name != nil {
+		to.Name = *p.Name
+	}
+	if p.Nickname.Set {
+		to.Nickname = p.Nickname.Value
+	}
+	if p.Age != nil {
+		to.Age = *p.Age
+	}
+}
+
+// patchProfile decodes a patch body and applies it
+func patchProfile(p profile, body []byte) (profile, error) {
+	var patch profilePatch
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return p, err
+	}
+	patch.apply(&p)
+	return p, nil
+}
@@ -0,0 +1,93 @@
+package json
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventPayload(t *testing.T) {
+	data := []byte(`[
+		{"id":"1","kind":"signup","payload":{"email":"a@example.com"}},
+		{"id":"2","kind":"pageview","payload":{"path":"/","referrers":["x","y","z"]}},
+		{"id":"3","kind":"signup","payload":{"email":"b@example.com"}}
+	]`)
+
+	type signup struct {
+		Email string `json:"email"`
+	}
+	got, err := eventsOfKind[signup](data, "signup")
+	require.NoError(t, err)
+	assert.Equal(t, []signup{{"a@example.com"}, {"b@example.com"}}, got)
+
+	// the raw bytes are kept exactly as they arrived
+	var events []event
+	require.NoError(t, json.Unmarshal(data, &events))
+	assert.JSONEq(t, `{"path":"/","referrers":["x","y","z"]}`, string(events[1].Payload))
+
+	assert.Error(t, event{ID: "4"}.decodePayload(&signup{}))
+
+	// a kind whose payload doesn't fit T fails only when it's decoded
+	_, err = eventsOfKind[[]int](data, "pageview")
+	assert.Error(t, err)
+}
+
+func TestFieldStates(t *testing.T) {
+	for _, tc := range []struct {
+		body  string
+		set   bool
+		null  bool
+		value string
+	}{
+		{`{}`, false, false, ""},
+		{`{"nickname":null}`, true, true, ""},
+		{`{"nickname":"mike"}`, true, false, "mike"},
+	} {
+		var p profilePatch
+		require.NoError(t, json.Unmarshal([]byte(tc.body), &p), tc.body)
+
+		assert.Equal(t, tc.set, p.Nickname.Set, tc.body)
+		assert.Equal(t, tc.null, p.Nickname.Null(), tc.body)
+		if tc.value != "" {
+			require.NotNil(t, p.Nickname.Value)
+			assert.Equal(t, tc.value, *p.Nickname.Value)
+		}
+	}
+
+	// a plain pointer can't tell the first two apart
+	var absent, null struct {
+		Nickname *string `json:"nickname"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{}`), &absent))
+	require.NoError(t, json.Unmarshal([]byte(`{"nickname":null}`), &null))
+	assert.Equal(t, absent, null)
+}
+
+func TestPatchProfile(t *testing.T) {
+	nick := "mike"
+	base := profile{Name: "michael", Nickname: &nick, Age: 30}
+
+	for _, tc := range []struct {
+		name string
+		body string
+		want profile
+	}{
+		{"absent leaves everything", `{}`, base},
+		{"null clears", `{"nickname":null}`, profile{Name: "michael", Age: 30}},
+		{"value sets", `{"nickname":"mick","age":31}`, profile{Name: "michael", Nickname: strPtr("mick"), Age: 31}},
+		{"null on a non-nullable field is ignored", `{"name":null}`, base},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := patchProfile(base, []byte(tc.body))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := patchProfile(base, []byte(`{"nickname":7}`))
+	assert.Error(t, err)
+}
+
+func strPtr(s string) *string { return &s }
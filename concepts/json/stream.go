@@ -0,0 +1,169 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Building a big response in memory and then writing it means holding all of
+// it at once and the client waiting for all of it. json.Encoder can write
+// straight to the ResponseWriter instead, one element at a time, with the
+// array's brackets and commas written by hand around it.
+//
+// The catch: the status line and headers go out with the first write. If the
+// database dies halfway through, it's too late to send a 500 - the client
+// has a 200 and half an array
+
+// source produces the elements of a stream, calling emit for each. It stops
+// early if emit returns an error (the client went away)
+type source func(ctx context.Context, emit func(v any) error) error
+
+// streamFlushEvery is how many elements are written between flushes. Flushing
+// every element costs a syscall and a TCP packet each, never flushing leaves
+// them sitting in the server's buffer
+const streamFlushEvery = 100
+
+// arrayWriter writes a JSON array element by element
+type arrayWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+	enc *json.Encoder
+	n   int
+}
+
+func newArrayWriter(w io.Writer) *arrayWriter {
+	a := &arrayWriter{w: w}
+	a.enc = json.NewEncoder(&a.buf)
+	return a
+}
+
+// Write adds one element. It's encoded into a reused buffer first, so a value
+// that fails to marshal leaves nothing behind - not even the comma. Encode
+// also adds a newline, which is just whitespace between elements
+func (a *arrayWriter) Write(v any) error {
+	a.buf.Reset()
+	if err := a.enc.Encode(v); err != nil {
+		return err
+	}
+
+	sep := ","
+	if a.n == 0 {
+		sep = "["
+	}
+	if _, err := io.WriteString(a.w, sep); err != nil {
+		return err
+	}
+	if _, err := a.w.Write(a.buf.Bytes()); err != nil {
+		return err
+	}
+
+	a.n++
+	if f, ok := a.w.(http.Flusher); ok && a.n%streamFlushEvery == 0 {
+		f.Flush()
+	}
+	return nil
+}
+
+// Close writes the closing bracket (or the whole of an empty array)
+func (a *arrayWriter) Close() error {
+	end := "]"
+	if a.n == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(a.w, end)
+	return err
+}
+
+/*
+ *
+ * the problem
+ *
+ */
+
+// streamArrayNaive streams a bare array. When src fails partway, the only
+// thing left to do is write an error - but WriteHeader is ignored (the server
+// logs "superfluous response.WriteHeader call") and the message lands in the
+// middle of the JSON. The client sees a 200 and a syntax error. Had this just
+// closed the array instead, it would have been worse: a valid, short array
+// that looks like the complete answer
+func streamArrayNaive(src source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		aw := newArrayWriter(w)
+
+		if err := src(r.Context(), aw.Write); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = aw.Close()
+	})
+}
+
+/*
+ *
+ * mitigations
+ *
+ */
+
+// streamTrailer is the HTTP trailer set when a stream fails. Trailers are
+// headers sent after the body; they have to be announced up front in a
+// Trailer header. Plenty of clients and proxies ignore them, so they're a
+// nice extra rather than something to rely on
+const streamTrailer = "Stream-Error"
+
+// streamArray wraps the array in an object that ends with a termination
+// marker: "complete":true when everything was sent, "error" when it wasn't.
+// A client that doesn't find "complete" knows the result is partial - which
+// also covers the connection dropping, where nothing gets written at all
+//
+//	{"items":[...],"complete":true}
+//	{"items":[...],"error":"database went away"}
+func streamArray(src source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Trailer", streamTrailer)
+
+		if _, err := io.WriteString(w, `{"items":`); err != nil {
+			return
+		}
+		aw := newArrayWriter(w)
+
+		err := src(r.Context(), aw.Write)
+		_ = aw.Close()
+
+		if err != nil {
+			w.Header().Set(streamTrailer, err.Error())
+			msg, _ := json.Marshal(err.Error())
+			_, _ = io.WriteString(w, `,"error":`+string(msg)+`}`)
+			return
+		}
+		_, _ = io.WriteString(w, `,"complete":true}`)
+	})
+}
+
+var errIncompleteStream = errors.New("stream ended without completing")
+
+// decodeStream is the client side of streamArray. It returns whatever items
+// arrived along with an error if the stream didn't complete
+func decodeStream[T any](r io.Reader) ([]T, error) {
+	var body struct {
+		Items    []T     `json:"items"`
+		Complete bool    `json:"complete"`
+		Error    *string `json:"error"`
+	}
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return body.Items, errors.Join(errIncompleteStream, err)
+	}
+
+	switch {
+	case body.Error != nil:
+		return body.Items, errors.Join(errIncompleteStream, errors.New(*body.Error))
+	case !body.Complete:
+		return body.Items, errIncompleteStream
+	}
+	return body.Items, nil
+}
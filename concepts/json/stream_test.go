@@ -0,0 +1,103 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counting emits n records, then fails with err if it's set
+func counting(n int, err error) source {
+	return func(ctx context.Context, emit func(any) error) error {
+		for i := 0; i < n; i++ {
+			if err := emit(record{ID: i}); err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+}
+
+func get(t *testing.T, h http.Handler) (*http.Response, []byte) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	res, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, body
+}
+
+func TestStreamArrayNaive(t *testing.T) {
+	res, body := get(t, streamArrayNaive(counting(250, nil)))
+	var got []record
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Len(t, got, 250)
+
+	res, body = get(t, streamArrayNaive(counting(0, nil)))
+	assert.JSONEq(t, `[]`, string(body))
+
+	// the failure: a 200 with garbage at the end
+	res, body = get(t, streamArrayNaive(counting(250, errors.New("database went away"))))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Error(t, json.Unmarshal(body, &got))
+	assert.Contains(t, string(body), "database went away")
+}
+
+func TestStreamArray(t *testing.T) {
+	res, body := get(t, streamArray(counting(250, nil)))
+	assert.Empty(t, res.Trailer.Get(streamTrailer))
+
+	got, err := decodeStream[record](bytes.NewReader(body))
+	require.NoError(t, err)
+	assert.Len(t, got, 250)
+	assert.Equal(t, 249, got[249].ID)
+
+	res, body = get(t, streamArray(counting(250, errors.New("database went away"))))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "database went away", res.Trailer.Get(streamTrailer))
+
+	got, err = decodeStream[record](bytes.NewReader(body))
+	assert.ErrorIs(t, err, errIncompleteStream)
+	assert.Contains(t, err.Error(), "database went away")
+	assert.Len(t, got, 250, "the partial results are still there")
+}
+
+func TestDecodeStreamTruncated(t *testing.T) {
+	_, body := get(t, streamArray(counting(10, nil)))
+
+	// a connection that dropped partway never gets to the marker
+	_, err := decodeStream[record](bytes.NewReader(body[:len(body)/2]))
+	assert.ErrorIs(t, err, errIncompleteStream)
+
+	// and a body without one at all doesn't count as complete
+	_, err = decodeStream[record](bytes.NewReader([]byte(`{"items":[]}`)))
+	assert.ErrorIs(t, err, errIncompleteStream)
+}
+
+func TestArrayWriterBadValue(t *testing.T) {
+	rec := httptest.NewRecorder()
+	aw := newArrayWriter(rec)
+
+	require.NoError(t, aw.Write(1))
+	assert.Error(t, aw.Write(func() {}))
+	require.NoError(t, aw.Write(2))
+	require.NoError(t, aw.Close())
+
+	assert.JSONEq(t, `[1,2]`, rec.Body.String())
+}
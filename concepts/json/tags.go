@@ -0,0 +1,191 @@
+package json
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// "Why isn't this field in my JSON?" usually comes down to one of a handful
+// of rules encoding/json applies to struct fields:
+//
+//   - unexported fields are skipped
+//   - `json:"-"` skips a field (but `json:"-,"` names it "-")
+//   - fields of an embedded struct are promoted as if declared in the outer
+//     struct - unless the embedded field has a tag name, then it's nested
+//   - when two fields end up with the same name, the shallowest wins; at the
+//     same depth a tagged field beats untagged ones; otherwise they're all
+//     dropped, silently
+//
+// fieldMappings walks a struct type with reflect and applies the same rules,
+// reporting what happened to every field - including the ones that vanished
+
+type fieldMapping struct {
+	Path      string // Go path from the outer struct, e.g. "Base.ID"
+	JSONName  string // empty when ignored
+	OmitEmpty bool
+	String    bool   // the ",string" option
+	Ignored   string // why the field isn't encoded, empty when it is
+
+	depth  int
+	tagged bool
+}
+
+func fieldMappings(t reflect.Type) []fieldMapping {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var all []fieldMapping
+	walkFields(t, "", 0, map[reflect.Type]bool{}, &all)
+	resolveConflicts(all)
+	return all
+}
+
+func walkFields(t reflect.Type, prefix string, depth int, seen map[reflect.Type]bool, out *[]fieldMapping) {
+	// an embedded type that embeds itself (through a pointer) would loop forever
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		m := fieldMapping{Path: prefix + f.Name, depth: depth}
+
+		tag := f.Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		switch {
+		case tag == "-":
+			m.Ignored = `tag "-"`
+		case f.Anonymous && ft.Kind() == reflect.Struct && name == "":
+			// promoted fields - note this happens even for unexported
+			// embedded types, their exported fields still count
+			walkFields(ft, m.Path+".", depth+1, seen, out)
+			continue
+		case !f.IsExported():
+			m.Ignored = "unexported"
+		}
+
+		if m.Ignored == "" {
+			m.JSONName = f.Name
+			if name != "" {
+				m.JSONName = name
+				m.tagged = true
+			}
+			m.OmitEmpty = hasOption(opts, "omitempty")
+			m.String = hasOption(opts, "string")
+		}
+		*out = append(*out, m)
+	}
+}
+
+func hasOption(opts, want string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == want {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConflicts applies encoding/json's dominance rules to fields sharing
+// a JSON name
+func resolveConflicts(all []fieldMapping) {
+	byName := map[string][]int{}
+	for i, m := range all {
+		if m.Ignored == "" {
+			byName[m.JSONName] = append(byName[m.JSONName], i)
+		}
+	}
+
+	for _, idx := range byName {
+		if len(idx) == 1 {
+			continue
+		}
+
+		minDepth := all[idx[0]].depth
+		for _, i := range idx {
+			if all[i].depth < minDepth {
+				minDepth = all[i].depth
+			}
+		}
+
+		var shallow, tagged []int
+		for _, i := range idx {
+			if all[i].depth == minDepth {
+				shallow = append(shallow, i)
+				if all[i].tagged {
+					tagged = append(tagged, i)
+				}
+			}
+		}
+
+		winner := -1
+		switch {
+		case len(shallow) == 1:
+			winner = shallow[0]
+		case len(tagged) == 1:
+			winner = tagged[0]
+		}
+
+		for _, i := range idx {
+			if i == winner {
+				continue
+			}
+			if winner == -1 {
+				all[i].Ignored = fmt.Sprintf("conflicts on %q, nothing wins", all[i].JSONName)
+			} else {
+				all[i].Ignored = fmt.Sprintf("shadowed by %s", all[winner].Path)
+			}
+			all[i].JSONName = ""
+		}
+	}
+}
+
+// describeFields writes the mappings as a table, encoded fields first in JSON
+// order, then the ignored ones
+func describeFields(w io.Writer, v any) error {
+	ms := fieldMappings(reflect.TypeOf(v))
+	sort.SliceStable(ms, func(i, j int) bool {
+		return ms[i].Ignored == "" && ms[j].Ignored != ""
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tJSON\tOPTIONS\tIGNORED")
+	for _, m := range ms {
+		var opts []string
+		if m.OmitEmpty {
+			opts = append(opts, "omitempty")
+		}
+		if m.String {
+			opts = append(opts, "string")
+		}
+		name := "-"
+		if m.Ignored == "" {
+			name = fmt.Sprintf("%q", m.JSONName)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Path, name, dash(strings.Join(opts, ",")), dash(m.Ignored))
+	}
+	return tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,98 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/golden"
+)
+
+type timestamps struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+type base struct {
+	ID    int64  `json:"id,string"`
+	Name  string `json:"name"` // shadowed by the shallower tagged.Name
+	Owner string `json:"owner"`
+}
+
+type audit struct {
+	Owner string `json:"owner"` // ties with base.Owner, so neither is encoded
+	By    string `json:"by"`
+}
+
+type hidden struct {
+	Visible string // promoted even though hidden is unexported
+}
+
+type tagged struct {
+	*base
+	audit
+	hidden
+	Meta timestamps `json:"meta"` // a tag name nests instead of promoting
+
+	Name     string `json:"name"`
+	Password string `json:"-"`
+	Dash     string `json:"-,"`
+	Notes    string `json:",omitempty"`
+	secret   string
+}
+
+type selfRef struct {
+	*selfRef
+	Value int `json:"value"`
+}
+
+func TestDescribeFieldsGolden(t *testing.T) {
+	for name, v := range map[string]any{
+		"tagged":     tagged{},
+		"timestamps": &timestamps{},
+		"selfref":    selfRef{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, describeFields(&buf, v))
+			golden.Assert(t, buf.Bytes(), "fields_"+name+".golden")
+		})
+	}
+}
+
+// The explorer is only useful if it agrees with encoding/json
+func TestFieldMappingsMatchEncoder(t *testing.T) {
+	v := tagged{
+		base:   &base{ID: 1, Name: "n", Owner: "o"},
+		audit:  audit{Owner: "o", By: "b"},
+		hidden: hidden{Visible: "v"},
+		Name:   "n", Password: "p", Dash: "d", Notes: "x", secret: "s",
+	}
+	out, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	var encoded map[string]any
+	require.NoError(t, json.Unmarshal(out, &encoded))
+
+	var keys, names []string
+	for k := range encoded {
+		keys = append(keys, k)
+	}
+	for _, m := range fieldMappings(reflect.TypeOf(v)) {
+		if m.Ignored == "" {
+			names = append(names, m.JSONName)
+		}
+	}
+	sort.Strings(keys)
+	sort.Strings(names)
+	assert.Equal(t, keys, names)
+}
+
+func TestFieldMappingsNonStruct(t *testing.T) {
+	assert.Nil(t, fieldMappings(reflect.TypeOf(42)))
+}
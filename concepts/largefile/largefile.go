@@ -0,0 +1,395 @@
+package largefile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// A file too big for memory, or just too big to read on one core in good
+// time. The work here is the classic one: lines of
+//
+//	Hamburg;12.0
+//	Bulawayo;8.9
+//
+// and the min, mean and max for each station.
+//
+// Read sequentially with a bufio.Reader, one core parses while the rest
+// idle, and the disk - or more likely the page cache - can go much faster
+// than that. The fix is to cut the file into one chunk per worker and
+// parse them at the same time, which takes two things:
+//
+//   - random access. Each worker reads its own chunk through an
+//     io.SectionReader on the shared *os.File; ReadAt has no shared
+//     position, so they don't get in each other's way
+//   - lines that cross a chunk boundary. Cuts are made at byte offsets,
+//     which will land mid-line. The rule that fixes it: a line belongs to
+//     the chunk it starts in. So a worker skips the partial line it starts
+//     in - the worker before finishes it - and reads past its own end to
+//     finish its last line
+//
+// Each worker fills its own map, and they're merged at the end - no locks
+// in the hot loop.
+//
+// Memory mapping (mmap_unix.go) goes one step further: the file becomes a
+// []byte, and the kernel pages it in as it's touched. No read calls, no
+// copying into buffers, and bytes.IndexByte runs straight over the page
+// cache. The price is platform specific code, and a SIGBUS rather than an
+// error if the file shrinks underneath
+
+// Stats is one station's readings, in tenths of a degree so the sums are
+// exact
+type Stats struct {
+	Min, Max int
+	Sum      int64
+	Count    int64
+}
+
+// Mean is in degrees
+func (s *Stats) Mean() float64 { return float64(s.Sum) / float64(s.Count) / 10 }
+
+func (s *Stats) add(t int) {
+	if s.Count == 0 || t < s.Min {
+		s.Min = t
+	}
+	if s.Count == 0 || t > s.Max {
+		s.Max = t
+	}
+	s.Sum += int64(t)
+	s.Count++
+}
+
+func (s *Stats) merge(o *Stats) {
+	if o.Count == 0 {
+		return
+	}
+	if s.Count == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Count == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.Sum += o.Sum
+	s.Count += o.Count
+}
+
+// Result is the stats by station
+type Result map[string]*Stats
+
+func (r Result) merge(o Result) {
+	for name, s := range o {
+		if mine, ok := r[name]; ok {
+			mine.merge(s)
+		} else {
+			r[name] = s
+		}
+	}
+}
+
+// String is the stations in order with min/mean/max, one decimal each
+func (r Result) String() string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		s := r[name]
+		fmt.Fprintf(&b, "%s=%.1f/%.1f/%.1f\n", name, float64(s.Min)/10, s.Mean(), float64(s.Max)/10)
+	}
+	return b.String()
+}
+
+var errMalformed = errors.New("largefile: malformed line")
+
+// maxLine is the longest line accepted. A bufio.Reader this size always
+// holds a whole line, so ReadSlice never has to copy
+const maxLine = 64 << 10
+
+// addLine parses "name;-12.3" into r. Empty lines are skipped
+func (r Result) addLine(line []byte) error {
+	if len(line) == 0 {
+		return nil
+	}
+	i := bytes.LastIndexByte(line, ';')
+	if i < 0 {
+		return fmt.Errorf("%w: %q", errMalformed, line)
+	}
+	t, ok := parseTenths(line[i+1:])
+	if !ok {
+		return fmt.Errorf("%w: %q", errMalformed, line)
+	}
+	// r[string(b)] is special cased by the compiler to look up without
+	// allocating a string. Only a new station costs one
+	s, found := r[string(line[:i])]
+	if !found {
+		s = &Stats{}
+		r[string(line[:i])] = s
+	}
+	s.add(t)
+	return nil
+}
+
+// parseTenths parses a temperature with exactly one decimal, -99.9 to 99.9,
+// as tenths. strconv.ParseFloat would do, but it's a third of the time
+// spent and this is the hot loop
+func parseTenths(b []byte) (int, bool) {
+	neg := len(b) > 0 && b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	if len(b) < 3 || len(b) > 4 || b[len(b)-2] != '.' {
+		return 0, false
+	}
+	t := 0
+	for i, c := range b {
+		if i == len(b)-2 {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		t = t*10 + int(c-'0')
+	}
+	if neg {
+		t = -t
+	}
+	return t, true
+}
+
+// trimLine takes the newline, and a carriage return before it, off a line
+func trimLine(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
+
+/*
+ *
+ * sequential
+ *
+ */
+
+// Sequential reads r front to back on one goroutine. It's the baseline
+func Sequential(r io.Reader) (Result, error) {
+	res := Result{}
+	br := bufio.NewReaderSize(r, maxLine)
+	for {
+		// ReadSlice returns a view of br's buffer rather than a copy, good
+		// until the next read
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("%w: longer than %d bytes", errMalformed, maxLine)
+		}
+		if len(line) > 0 {
+			if err := res.addLine(trimLine(line)); err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+/*
+ *
+ * chunks in parallel
+ *
+ */
+
+// Chunks splits r, which is size bytes long, into one chunk per worker and
+// processes them at the same time
+func Chunks(r io.ReaderAt, size int64, workers int) (Result, error) {
+	workers = max(1, workers)
+	chunk := (size + int64(workers) - 1) / int64(workers)
+
+	results := make([]Result, workers)
+	var g errgroup.Group
+	for i := 0; i < workers; i++ {
+		i := i
+		start, end := int64(i)*chunk, min(int64(i+1)*chunk, size)
+		g.Go(func() error {
+			res, err := processRange(r, size, start, end)
+			results[i] = res
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	res := results[0]
+	for _, o := range results[1:] {
+		res.merge(o)
+	}
+	return res, nil
+}
+
+// processRange does the lines that start in [start, end)
+func processRange(r io.ReaderAt, size, start, end int64) (Result, error) {
+	res := Result{}
+	if start >= end {
+		return res, nil
+	}
+
+	// start one byte early and skip through the first newline. If start is
+	// the beginning of a line, the byte before is the newline ending the
+	// last one and only that is skipped; if it's mid-line, the rest of the
+	// line goes, and the worker before does it
+	pos := start
+	if start > 0 {
+		pos = start - 1
+	}
+	// the section runs to the end of the file, not the chunk, so the last
+	// line can be read to its end
+	br := bufio.NewReaderSize(io.NewSectionReader(r, pos, size-pos), maxLine)
+	if start > 0 {
+		skipped, err := br.ReadSlice('\n')
+		pos += int64(len(skipped))
+		switch {
+		case err == io.EOF:
+			return res, nil // the rest was all one line, the previous chunk's
+		case err == bufio.ErrBufferFull:
+			return nil, fmt.Errorf("%w: longer than %d bytes", errMalformed, maxLine)
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	for pos < end {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("%w: longer than %d bytes", errMalformed, maxLine)
+		}
+		pos += int64(len(line))
+		if err := res.addLine(trimLine(line)); err != nil {
+			return nil, err
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// ChunksFile opens path and runs Chunks over it
+func ChunksFile(path string, workers int) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Chunks(f, st.Size(), workers)
+}
+
+// processBytes does every line in data. The mmap version hands it chunks of
+// the mapped file, already cut at newlines
+func processBytes(data []byte) (Result, error) {
+	res := Result{}
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		if err := res.addLine(bytes.TrimSuffix(line, []byte("\r"))); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// splitLines cuts data into about n pieces, each ending just after a
+// newline (or at the end of data)
+func splitLines(data []byte, n int) [][]byte {
+	chunk := max(1, len(data)/max(1, n))
+	var out [][]byte
+	for len(data) > 0 {
+		end := min(chunk, len(data))
+		if i := bytes.IndexByte(data[end-1:], '\n'); i >= 0 {
+			end += i
+		} else {
+			end = len(data)
+		}
+		out = append(out, data[:end])
+		data = data[end:]
+	}
+	return out
+}
+
+// processParallel runs processBytes over data's pieces at the same time
+func processParallel(data []byte, workers int) (Result, error) {
+	pieces := splitLines(data, max(1, workers))
+	results := make([]Result, len(pieces))
+	var g errgroup.Group
+	for i, p := range pieces {
+		i, p := i, p
+		g.Go(func() error {
+			res, err := processBytes(p)
+			results[i] = res
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	res := Result{}
+	for _, o := range results {
+		res.merge(o)
+	}
+	return res, nil
+}
+
+/*
+ *
+ * fixtures
+ *
+ */
+
+// stations for Generate, and the typical temperature at each
+var stations = []struct {
+	name string
+	mean float64
+}{
+	{"Abha", 18.0}, {"Abidjan", 26.0}, {"Accra", 26.4}, {"Adelaide", 17.3},
+	{"Anchorage", 2.8}, {"Athens", 19.2}, {"Bangkok", 28.6}, {"Bergen", 7.7},
+	{"Bulawayo", 18.9}, {"Cairo", 21.4}, {"Dhaka", 25.9}, {"Dublin", 9.8},
+	{"Edinburgh", 9.3}, {"Hamburg", 9.7}, {"Istanbul", 13.9}, {"Kyiv", 8.4},
+	{"Lima", 19.6}, {"Montréal", 6.8}, {"Nuuk", -1.4}, {"Oslo", 5.7},
+	{"Reykjavík", 4.3}, {"São Paulo", 19.8}, {"Tokyo", 15.4}, {"Yakutsk", -8.8},
+}
+
+// Generate writes lines of readings to w, the same ones for the same seed
+func Generate(w io.Writer, lines int, seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+	bw := bufio.NewWriter(w)
+	for i := 0; i < lines; i++ {
+		st := stations[rng.Intn(len(stations))]
+		t := st.mean + rng.NormFloat64()*10
+		t = max(-99.9, min(99.9, t))
+		fmt.Fprintf(bw, "%s;%.1f\n", st.name, t)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,188 @@
+package largefile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixture generates lines of readings into a file and returns its path
+func fixture(tb testing.TB, lines int) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "readings.txt")
+	f, err := os.Create(path)
+	require.NoError(tb, err)
+	require.NoError(tb, Generate(f, lines, 1))
+	require.NoError(tb, f.Close())
+	return path
+}
+
+// strategies all run over the file at path
+var strategies = map[string]func(path string, workers int) (Result, error){
+	"sequential": func(path string, _ int) (Result, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return Sequential(f)
+	},
+	"chunks": ChunksFile,
+	"mmap":   Mmap,
+}
+
+func TestStrategiesAgree(t *testing.T) {
+	path := fixture(t, 50_000)
+	want, err := strategies["sequential"](path, 1)
+	require.NoError(t, err)
+	require.Len(t, want, len(stations))
+	var count int64
+	for _, s := range want {
+		count += s.Count
+	}
+	require.Equal(t, int64(50_000), count)
+
+	for name, run := range strategies {
+		for _, workers := range []int{1, 3, 8} {
+			got, err := run(path, workers)
+			if name == "mmap" && runtime.GOOS == "windows" {
+				assert.Error(t, err)
+				continue
+			}
+			require.NoError(t, err, "%s with %d workers", name, workers)
+			assert.Equal(t, want.String(), got.String(), "%s with %d workers", name, workers)
+		}
+	}
+}
+
+func TestChunkBoundaries(t *testing.T) {
+	// short input and every worker count up to well past the number of
+	// lines, so cuts fall on every byte: before a newline, on it, just
+	// after it, and in the middle of a line
+	for name, input := range map[string]string{
+		"plain":      "a;1.0\nbb;-2.5\na;3.0\nccc;0.0\nbb;12.3\n",
+		"no newline": "a;1.0\nbb;-2.5\na;3.0\nccc;0.0\nbb;12.3",
+		"empty":      "\n\na;1.0\n\nbb;-2.5\n\n\na;3.0\n",
+		"crlf":       "a;1.0\r\nbb;-2.5\r\na;3.0\r\n",
+		"one line":   "a;1.0",
+	} {
+		want, err := Sequential(strings.NewReader(input))
+		require.NoError(t, err, name)
+
+		for workers := 1; workers <= 17; workers++ {
+			got, err := Chunks(strings.NewReader(input), int64(len(input)), workers)
+			require.NoError(t, err, "%s, %d workers", name, workers)
+			assert.Equal(t, want.String(), got.String(), "%s, %d workers", name, workers)
+
+			got, err = processParallel([]byte(input), workers)
+			require.NoError(t, err, "%s, %d workers", name, workers)
+			assert.Equal(t, want.String(), got.String(), "%s, %d workers", name, workers)
+		}
+	}
+
+	res, err := Chunks(strings.NewReader(""), 0, 4)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func TestSplitLines(t *testing.T) {
+	data := []byte("aaaa\nbb\ncccccc\nd\n")
+	for n := 1; n <= 8; n++ {
+		pieces := splitLines(data, n)
+		assert.Equal(t, data, bytes.Join(pieces, nil), "nothing lost or repeated with %d", n)
+		for _, p := range pieces[:len(pieces)-1] {
+			assert.Equal(t, byte('\n'), p[len(p)-1], "pieces end on a newline")
+		}
+	}
+	assert.Empty(t, splitLines(nil, 4))
+}
+
+func TestStats(t *testing.T) {
+	res, err := Sequential(strings.NewReader("Oslo;-3.4\nOslo;5.0\nOslo;1.4\nCairo;21.0\n"))
+	require.NoError(t, err)
+	assert.Equal(t, &Stats{Min: -34, Max: 50, Sum: 30, Count: 3}, res["Oslo"])
+	assert.InDelta(t, 1.0, res["Oslo"].Mean(), 1e-9)
+	assert.Equal(t, "Cairo=21.0/21.0/21.0\nOslo=-3.4/1.0/5.0\n", res.String())
+}
+
+func TestMalformed(t *testing.T) {
+	for _, line := range []string{
+		"no semicolon",
+		"a;",
+		"a;1",
+		"a;1.23",
+		"a;x.0",
+		"a;-",
+		"a;100.0",
+		strings.Repeat("x", maxLine+1) + ";1.0",
+	} {
+		input := "ok;1.0\n" + line + "\nok;2.0\n"
+		_, err := Sequential(strings.NewReader(input))
+		assert.ErrorIs(t, err, errMalformed, "%.20q", line)
+		_, err = Chunks(strings.NewReader(input), int64(len(input)), 3)
+		assert.ErrorIs(t, err, errMalformed, "%.20q", line)
+		_, err = processParallel([]byte(input), 3)
+		if len(line) <= maxLine {
+			assert.ErrorIs(t, err, errMalformed, "%.20q", line)
+		}
+	}
+}
+
+func TestParseTenths(t *testing.T) {
+	for in, want := range map[string]int{"0.0": 0, "-0.0": 0, "9.9": 99, "-12.3": -123, "99.9": 999} {
+		got, ok := parseTenths([]byte(in))
+		assert.True(t, ok, in)
+		assert.Equal(t, want, got, in)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	var a, b bytes.Buffer
+	require.NoError(t, Generate(&a, 100, 7))
+	require.NoError(t, Generate(&b, 100, 7))
+	assert.Equal(t, a.String(), b.String(), "same seed, same file")
+	assert.Equal(t, 100, bytes.Count(a.Bytes(), []byte("\n")))
+}
+
+// go test -bench Strategies -benchtime 5x ./concepts/largefile
+//
+// The fixture is a million lines, about 12MB; LARGEFILE_LINES sets another
+// size. The first run of each pulls the file into the page cache, after
+// that it's all CPU - which is the point, sequential is parsing bound
+func BenchmarkStrategies(b *testing.B) {
+	lines := 1_000_000
+	if s := os.Getenv("LARGEFILE_LINES"); s != "" {
+		n, err := strconv.Atoi(s)
+		require.NoError(b, err)
+		lines = n
+	}
+	path := fixture(b, lines)
+	st, err := os.Stat(path)
+	require.NoError(b, err)
+
+	run := func(name string, workers int) {
+		b.Run(fmt.Sprintf("%s/workers=%d", name, workers), func(b *testing.B) {
+			b.SetBytes(st.Size())
+			for i := 0; i < b.N; i++ {
+				if _, err := strategies[name](path, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	run("sequential", 1)
+	for _, workers := range []int{1, 4, max(8, runtime.NumCPU())} {
+		run("chunks", workers)
+		if runtime.GOOS != "windows" {
+			run("mmap", workers)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package largefile
+
+import "errors"
+
+// Mmap needs syscall.Mmap, which only unix systems have. Windows can map
+// files too, with CreateFileMapping and MapViewOfFile, but that's a
+// different API for the same idea
+func Mmap(path string, workers int) (Result, error) {
+	return nil, errors.New("largefile: mmap isn't supported on this platform")
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package largefile
+
+import (
+	"os"
+	"syscall"
+)
+
+// Mmap maps the file at path into memory and processes it with workers
+// goroutines, each on its own stretch of the mapping.
+//
+// The mapping is read-only and shared, so it's the page cache itself, not a
+// copy. Nothing in the Result points into it - station names are copied
+// into strings as they're first seen - so unmapping at the end is safe
+func Mmap(path string, workers int) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() == 0 {
+		return Result{}, nil // mapping nothing is EINVAL
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(st.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Munmap(data)
+	return processParallel(data, workers)
+}
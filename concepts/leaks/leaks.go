@@ -0,0 +1,137 @@
+package leaks
+
+import (
+	"context"
+)
+
+// A goroutine that never returns is a leak. It holds its stack and everything
+// it references for the life of the program, and nothing will ever tell you -
+// there's no error and no crash, just memory and goroutine counts creeping up.
+// Almost every leak is a goroutine blocked forever on a channel operation.
+//
+// runtime.NumGoroutine shows the count going up, go.uber.org/goleak goes
+// further and lists the stacks of goroutines that shouldn't be there
+
+type search func(query string) string
+
+/*
+ *
+ * the forgotten sender
+ *
+ */
+
+// firstResultLeaky asks every backend and returns whichever answers first.
+// The other goroutines finish their search, try to send on results, and block
+// forever - nobody will ever receive from it again
+func firstResultLeaky(query string, backends ...search) string {
+	results := make(chan string)
+	for _, b := range backends {
+		go func(b search) {
+			results <- b(query)
+		}(b)
+	}
+
+	return <-results
+}
+
+// firstResult gives the channel room for every result, so every send succeeds
+// whether or not anyone reads it, and the goroutines all exit. The buffered
+// channel is then garbage collected like anything else
+func firstResult(query string, backends ...search) string {
+	results := make(chan string, len(backends))
+	for _, b := range backends {
+		go func(b search) {
+			results <- b(query)
+		}(b)
+	}
+
+	return <-results
+}
+
+// When the buffer size isn't known up front, select on a context the caller
+// cancels once it has what it needs
+func firstResultContext(ctx context.Context, query string, backends ...search) string {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan string)
+	for _, b := range backends {
+		go func(b search) {
+			select {
+			case results <- b(query):
+			case <-ctx.Done():
+			}
+		}(b)
+	}
+
+	return <-results
+}
+
+/*
+ *
+ * the nil channel
+ *
+ */
+
+// Receiving from a nil channel blocks forever. In a select that's useful - a
+// nil case is never chosen, so setting a channel to nil switches its case off.
+// Anywhere else it's a bug waiting to happen.
+//
+// mergeLeaky copies a and b into one channel, closing it when both are closed.
+// It turns off a's case once a is closed, as it should, but a caller passing nil
+// for an input it doesn't have means that input is never "closed" - the
+// goroutine waits on it forever and the output is never closed either
+func mergeLeaky(a, b <-chan int) <-chan int {
+	out := make(chan int)
+
+	go func() {
+		defer close(out)
+		aDone, bDone := false, false
+		for !aDone || !bDone {
+			select {
+			case v, ok := <-a:
+				if !ok {
+					aDone, a = true, nil
+					continue
+				}
+				out <- v
+			case v, ok := <-b:
+				if !ok {
+					bDone, b = true, nil
+					continue
+				}
+				out <- v
+			}
+		}
+	}()
+
+	return out
+}
+
+// merge decides it's finished by the channels themselves: a nil channel is one
+// that's done, whether it was passed in that way or set to nil once closed
+func merge(a, b <-chan int) <-chan int {
+	out := make(chan int)
+
+	go func() {
+		defer close(out)
+		for a != nil || b != nil {
+			select {
+			case v, ok := <-a:
+				if !ok {
+					a = nil
+					continue
+				}
+				out <- v
+			case v, ok := <-b:
+				if !ok {
+					b = nil
+					continue
+				}
+				out <- v
+			}
+		}
+	}()
+
+	return out
+}
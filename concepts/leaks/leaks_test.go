@@ -0,0 +1,83 @@
+package leaks
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func fast(q string) string { return "fast: " + q }
+func slow(q string) string {
+	time.Sleep(10 * time.Millisecond)
+	return "slow: " + q
+}
+
+func collect(ch <-chan int) []int {
+	var out []int
+	for v := range ch {
+		out = append(out, v)
+	}
+	return out
+}
+
+func closedWith(vs ...int) <-chan int {
+	ch := make(chan int, len(vs))
+	for _, v := range vs {
+		ch <- v
+	}
+	close(ch)
+	return ch
+}
+
+// The leaky versions leave goroutines behind for good, so every test only
+// checks for goroutines it started itself
+
+func TestFirstResultLeaky(t *testing.T) {
+	before := goleak.IgnoreCurrent()
+	n := runtime.NumGoroutine()
+
+	assert.Equal(t, "fast: go", firstResultLeaky("go", fast, slow, slow, slow))
+
+	// the three slow searches finish, and then block on their send forever.
+	// goleak retries for a while before giving up, plenty of time for them
+	assert.Error(t, goleak.Find(before))
+	assert.GreaterOrEqual(t, runtime.NumGoroutine(), n+3)
+}
+
+func TestFirstResult(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	assert.Equal(t, "fast: go", firstResult("go", fast, slow, slow, slow))
+	assert.Equal(t, "fast: go", firstResultContext(context.Background(), "go", fast, slow, slow, slow))
+}
+
+func TestMergeLeaky(t *testing.T) {
+	before := goleak.IgnoreCurrent()
+
+	// with both inputs the leaky version works fine
+	assert.ElementsMatch(t, []int{1, 2, 3}, collect(mergeLeaky(closedWith(1, 2), closedWith(3))))
+	assert.NoError(t, goleak.Find(before))
+
+	// with a nil input it hands over everything from a, and then hangs
+	out := mergeLeaky(closedWith(1, 2), nil)
+	assert.Equal(t, 1, <-out)
+	assert.Equal(t, 2, <-out)
+	select {
+	case <-out:
+		t.Fatal("out should never be closed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.Error(t, goleak.Find(before))
+}
+
+func TestMerge(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	assert.ElementsMatch(t, []int{1, 2, 3}, collect(merge(closedWith(1, 2), closedWith(3))))
+	assert.Equal(t, []int{1, 2}, collect(merge(closedWith(1, 2), nil)))
+	assert.Empty(t, collect(merge(nil, nil)))
+}
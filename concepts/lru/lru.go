@@ -0,0 +1,174 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// An LRU (least recently used) cache holds at most a fixed number of entries,
+// and when it's full, adding one evicts whichever entry was used longest ago.
+// Unlike concepts/cache, where entries live until their TTL runs out however
+// many there are, memory use here has a hard ceiling.
+//
+// The classic O(1) design is two structures pointing into each other:
+//
+//   - a doubly linked list of entries in use order, most recent at the front.
+//     Moving an entry to the front or dropping the back is O(1) given the
+//     element, which container/list hands out
+//   - a map from key to list element, so finding an entry is O(1) too
+//
+// Even Get changes the list, so every operation takes the full lock - an
+// RWMutex would buy nothing
+
+// Cache is an LRU cache, safe for concurrent use
+type Cache[K comparable, V any] struct {
+	capacity int
+	ttl      time.Duration // 0 means entries don't expire
+	clk      clock.Clock
+
+	mu    sync.Mutex
+	ll    *list.List // of *entry[K, V], front is most recently used
+	items map[K]*list.Element
+	stats Stats
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// Stats counts what the cache has been doing. A low hit rate means the cache
+// is too small for the working set, or the keys just don't repeat
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64 // removed to make room
+	Expired   uint64 // removed because their TTL ran out
+}
+
+// HitRate is Hits as a fraction of all lookups
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// New returns a cache holding up to capacity entries
+func New[K comparable, V any](capacity int) *Cache[K, V] {
+	return NewWithTTL[K, V](capacity, 0, clock.New())
+}
+
+// NewWithTTL is New, plus entries expire ttl after they were last Put. An
+// expired entry is only removed when it's next looked at - it still counts
+// toward capacity until then, and will be among the first evicted anyway
+// unless something keeps reading it
+func NewWithTTL[K comparable, V any](capacity int, ttl time.Duration, clk clock.Clock) *Cache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Cache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		clk:      clk,
+		ll:       list.New(),
+		items:    make(map[K]*list.Element, capacity),
+	}
+}
+
+// Get returns the value for key and marks it as recently used
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+
+	e := el.Value.(*entry[K, V])
+	if c.ttl > 0 && !c.clk.Now().Before(e.expires) {
+		c.remove(el)
+		c.stats.Expired++
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+	return e.value, true
+}
+
+// Put adds or replaces key, evicting the least recently used entry if the
+// cache is full
+func (c *Cache[K, V]) Put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = c.clk.Now().Add(c.ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+	if c.ll.Len() > c.capacity {
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Delete removes key, reporting whether it was there
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if ok {
+		c.remove(el)
+	}
+	return ok
+}
+
+// remove drops an element from both structures. c.mu must be held
+func (c *Cache[K, V]) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Keys returns the keys from most to least recently used
+func (c *Cache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]K, 0, c.ll.Len())
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*entry[K, V]).key)
+	}
+	return keys
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,149 @@
+package lru
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thorntonmc/go-practice/concepts/cache"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](3)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	c.Put("c", 3)
+
+	// reading a makes b the oldest
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	c.Put("d", 4)
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"d", "a", "c"}, c.Keys())
+
+	// replacing counts as a use, and doesn't grow the cache
+	c.Put("c", 30)
+	assert.Equal(t, []string{"c", "d", "a"}, c.Keys())
+	assert.Equal(t, 3, c.Len())
+
+	assert.True(t, c.Delete("d"))
+	assert.False(t, c.Delete("d"))
+	assert.Equal(t, []string{"c", "a"}, c.Keys())
+
+	s := c.Stats()
+	assert.Equal(t, Stats{Hits: 1, Misses: 1, Evictions: 1}, s)
+	assert.Equal(t, 0.5, s.HitRate())
+}
+
+func TestTTL(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	c := NewWithTTL[string, int](10, time.Minute, clk)
+
+	c.Put("a", 1)
+	clk.Advance(30 * time.Second)
+	c.Put("b", 2)
+
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	clk.Advance(30 * time.Second)
+	_, ok = c.Get("a")
+	assert.False(t, ok, "a expired a minute after it was put, reading it didn't extend it")
+	_, ok = c.Get("b")
+	assert.True(t, ok)
+
+	// putting again resets the clock
+	clk.Advance(20 * time.Second)
+	c.Put("b", 3)
+	clk.Advance(50 * time.Second)
+	v, ok := c.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+
+	assert.Equal(t, uint64(1), c.Stats().Expired)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCapacityFloor(t *testing.T) {
+	c := New[int, int](0)
+	c.Put(1, 1)
+	c.Put(2, 2)
+	assert.Equal(t, []int{2}, c.Keys())
+}
+
+// Run with -race, which is where this test earns its keep
+func TestConcurrentUse(t *testing.T) {
+	c := New[int, int](100)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 2000; i++ {
+				k := r.Intn(200)
+				switch r.Intn(3) {
+				case 0:
+					c.Put(k, k)
+				case 1:
+					if v, ok := c.Get(k); ok && v != k {
+						t.Errorf("key %d has value %d", k, v)
+					}
+				case 2:
+					c.Delete(k)
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+	assert.Len(t, c.Keys(), c.Len())
+}
+
+// The LRU against the TTL cache, with more keys than the LRU can hold. The
+// TTL cache grows to fit every key, the LRU stays at its capacity and pays
+// for it in misses
+func BenchmarkVsTTLCache(b *testing.B) {
+	const keys = 10000
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = fmt.Sprintf("key-%d", i)
+	}
+
+	b.Run("lru", func(b *testing.B) {
+		c := New[string, int](keys / 2)
+		b.RunParallel(func(pb *testing.PB) {
+			r := rand.New(rand.NewSource(1))
+			for pb.Next() {
+				k := names[r.Intn(keys)]
+				if _, ok := c.Get(k); !ok {
+					c.Put(k, 1)
+				}
+			}
+		})
+		b.ReportMetric(c.Stats().HitRate(), "hit-rate")
+	})
+
+	b.Run("ttl", func(b *testing.B) {
+		c := cache.New[string, int](time.Minute)
+		defer c.Close()
+		b.RunParallel(func(pb *testing.PB) {
+			r := rand.New(rand.NewSource(1))
+			for pb.Next() {
+				k := names[r.Intn(keys)]
+				if _, ok := c.Get(k); !ok {
+					c.Set(k, 1)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The Prometheus text format is one line per series, with HELP and TYPE
+// comments per family:
+//
+//	# HELP http_requests_total Requests served.
+//	# TYPE http_requests_total counter
+//	http_requests_total{code="200",method="GET"} 1027
+//	http_requests_total{code="500",method="GET"} 3
+//
+// A histogram becomes several series: one _bucket per upper bound with
+// the cumulative count, labelled le, then _sum and _count. Prometheus
+// scrapes it over plain HTTP, which is all Handler is
+
+// ContentType is the text format's, version 0.0.4
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler serves the registry for scraping
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	})
+}
+
+// WriteTo writes every family in the text format, families sorted by name
+// and series by label values, so the output is stable
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (f *family) write(w *countingWriter) {
+	f.mu.RLock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.RUnlock()
+	if len(all) == 0 {
+		return // a family nobody has used yet has nothing to say
+	}
+
+	// labels are written sorted by name, whatever order they were
+	// declared in, and series sorted by their values in that order, as
+	// client_golang does
+	order := make([]int, len(f.labels))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return f.labels[order[i]] < f.labels[order[j]] })
+	names := make([]string, len(order))
+	for i, j := range order {
+		names[i] = f.labels[j]
+	}
+	sort.Slice(all, func(a, b int) bool {
+		for _, j := range order {
+			if x, y := all[a].values[j], all[b].values[j]; x != y {
+				return x < y
+			}
+		}
+		return false
+	})
+	values := make([]string, len(order))
+
+	w.write("# HELP ", f.name, " ", escapeHelp(f.help), "\n")
+	w.write("# TYPE ", f.name, " ", string(f.kind), "\n")
+	for _, s := range all {
+		for i, j := range order {
+			values[i] = s.values[j]
+		}
+		switch m := s.metric.(type) {
+		case *Counter:
+			w.sample(f.name, names, values, "", "", m.Value())
+		case *Gauge:
+			w.sample(f.name, names, values, "", "", m.Value())
+		case *Histogram:
+			snap := m.Snapshot()
+			for i, bound := range snap.Bounds {
+				w.sample(f.name+"_bucket", names, values, "le", formatFloat(bound), float64(snap.Cumulative[i]))
+			}
+			w.sample(f.name+"_bucket", names, values, "le", "+Inf", float64(snap.Cumulative[len(snap.Bounds)]))
+			w.sample(f.name+"_sum", names, values, "", "", snap.Sum)
+			// _count is taken from the buckets rather than the separate
+			// count, so a racing Observe can't make them disagree
+			w.sample(f.name+"_count", names, values, "", "", float64(snap.Cumulative[len(snap.Bounds)]))
+		}
+	}
+}
+
+// countingWriter remembers the first error, so the writing code above can
+// get on with it and check once at the end
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) write(parts ...string) {
+	for _, p := range parts {
+		if c.err != nil {
+			return
+		}
+		n, err := c.w.WriteString(p)
+		c.n += int64(n)
+		c.err = err
+	}
+}
+
+// sample writes one line. extraName/extraValue is a label added on the
+// end, le for histogram buckets
+func (c *countingWriter) sample(name string, labels, values []string, extraName, extraValue string, v float64) {
+	c.write(name)
+	if len(labels) > 0 || extraName != "" {
+		c.write("{")
+		for i, l := range labels {
+			if i > 0 {
+				c.write(",")
+			}
+			c.write(l, `="`, escapeLabel(values[i]), `"`)
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				c.write(",")
+			}
+			c.write(extraName, `="`, extraValue, `"`)
+		}
+		c.write("}")
+	}
+	c.write(" ", formatFloat(v), "\n")
+}
+
+// formatFloat writes numbers the way client_golang does, so the two
+// registries' output can be compared line for line
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,343 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metrics are numbers a service keeps about itself, cheap enough to update
+// on every request and read by something outside - Prometheus, here -
+// every few seconds. Where a trace (concepts/tracing) tells the story of
+// one request, metrics are aggregates: how many, how fast, how full.
+//
+// There are three kinds worth having:
+//
+//   - a counter only goes up: requests served, bytes sent. What's
+//     interesting is its rate, which the scraper works out, and a restart
+//     resetting it to zero is expected and handled there
+//   - a gauge goes up and down: requests in flight, queue length
+//   - a histogram counts observations into fixed buckets: how many
+//     requests took under 5ms, under 10ms, and so on. Percentiles come out
+//     of it afterwards, approximately, and - unlike keeping every latency
+//     and sorting them - histograms from many instances can be added up
+//
+// Each can have labels, so http_requests_total{method="GET",code="200"}
+// and {method="POST",code="500"} are separate series under one name. Every
+// distinct combination of label values is another series held in memory
+// forever, so labels must come from a small fixed set: a route pattern,
+// never a raw path or a user id.
+//
+// This is a small educational version of what github.com/prometheus/
+// client_golang provides, producing the same text format. Updates are
+// lock free - an atomic add on the hot path - and only creating a new
+// series, or scraping, takes a lock
+
+// kind is a metric family's type, as the exposition format names it
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+// DefBuckets suit request latencies in seconds, and match client_golang's
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metric families, and writes them all out for a scrape.
+// It's safe for concurrent use
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// family is every series under one name
+type family struct {
+	name, help string
+	kind       kind
+	labels     []string
+	buckets    []float64 // histograms only
+
+	mu     sync.RWMutex
+	series map[string]*series // by joined label values
+}
+
+type series struct {
+	values []string
+	metric any // *Counter, *Gauge or *Histogram
+}
+
+// register panics on a bad or repeated name, like client_golang's
+// MustRegister: it's a programming mistake, found the first time the
+// service starts
+func (r *Registry) register(name, help string, k kind, buckets []float64, labels []string) *family {
+	if !validName(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, l := range labels {
+		if !validName(l) || strings.HasPrefix(l, "__") || (k == histogramKind && l == "le") {
+			panic(fmt.Sprintf("metrics: invalid label name %q", l))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[name]; ok {
+		panic(fmt.Sprintf("metrics: %q is already registered", name))
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    k,
+		labels:  append([]string(nil), labels...),
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+// with finds or creates the series for values. The common case, a series
+// that already exists, only takes the read lock
+func (f *family) with(values []string, create func() any) any {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s.metric
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s.metric // someone else got there first
+	}
+	s = &series{values: append([]string(nil), values...), metric: create()}
+	f.series[key] = s
+	return s.metric
+}
+
+/*
+ *
+ * counters and gauges
+ *
+ */
+
+// atomicFloat is a float64 updated with compare-and-swap, since there's no
+// atomic float add. Under heavy contention the loop retries, but each try
+// is a few nanoseconds
+type atomicFloat struct{ bits atomic.Uint64 }
+
+func (a *atomicFloat) Load() float64   { return math.Float64frombits(a.bits.Load()) }
+func (a *atomicFloat) Store(v float64) { a.bits.Store(math.Float64bits(v)) }
+
+func (a *atomicFloat) Add(delta float64) {
+	for {
+		old := a.bits.Load()
+		if a.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+type Counter struct{ v atomicFloat }
+
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add panics on a negative delta - a counter that goes down is a gauge
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters can't decrease")
+	}
+	c.v.Add(delta)
+}
+
+func (c *Counter) Value() float64 { return c.v.Load() }
+
+type Gauge struct{ v atomicFloat }
+
+func (g *Gauge) Set(v float64)     { g.v.Store(v) }
+func (g *Gauge) Add(delta float64) { g.v.Add(delta) }
+func (g *Gauge) Inc()              { g.v.Add(1) }
+func (g *Gauge) Dec()              { g.v.Add(-1) }
+func (g *Gauge) Value() float64    { return g.v.Load() }
+
+// CounterVec is a counter family. With picks the series for a set of label
+// values, in the order the labels were declared
+type CounterVec struct{ f *family }
+
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, counterKind, nil, labels)}
+}
+
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.f.with(values, func() any { return &Counter{} }).(*Counter)
+}
+
+type GaugeVec struct{ f *family }
+
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, gaugeKind, nil, labels)}
+}
+
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.f.with(values, func() any { return &Gauge{} }).(*Gauge)
+}
+
+/*
+ *
+ * histograms
+ *
+ */
+
+// Histogram counts observations into buckets by upper bound. counts[i] is
+// observations in (bounds[i-1], bounds[i]], and the last counts anything
+// above the highest bound. The exposition format wants cumulative counts
+// - everything <= le - which are added up when scraping instead of on
+// every Observe
+type Histogram struct {
+	bounds []float64
+	counts []atomic.Uint64
+	sum    atomicFloat
+	count  atomic.Uint64
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]atomic.Uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) Observe(v float64) {
+	// first bound >= v. Binary search, though for a dozen buckets a linear
+	// scan would do as well
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i].Add(1)
+	h.sum.Add(v)
+	h.count.Add(1)
+}
+
+// HistogramSnapshot is a histogram at one moment. The fields are read one
+// at a time without a lock, so an Observe racing with the snapshot may be
+// in some of them and not others. A scrape every few seconds doesn't mind
+type HistogramSnapshot struct {
+	Bounds     []float64
+	Cumulative []uint64 // observations <= Bounds[i], then the total
+	Sum        float64
+	Count      uint64
+}
+
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{
+		Bounds:     h.bounds,
+		Cumulative: make([]uint64, len(h.counts)),
+		Sum:        h.sum.Load(),
+		Count:      h.count.Load(),
+	}
+	var total uint64
+	for i := range h.counts {
+		total += h.counts[i].Load()
+		s.Cumulative[i] = total
+	}
+	return s
+}
+
+// Quantile estimates the q-quantile (0.99 for p99) the way Prometheus's
+// histogram_quantile does: find the bucket the rank falls in and assume
+// observations are spread evenly across it. The answer is only as good as
+// the buckets - with bounds 0.1 and 0.25, all Quantile can say about a
+// value in between is where it would be if they were uniform. A rank in
+// the overflow bucket returns the highest bound, since there's no upper
+// edge to interpolate to. NaN if there are no observations, or no bounds
+// to place them by - a zero HistogramSnapshot has neither
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if len(s.Bounds) == 0 || len(s.Cumulative) != len(s.Bounds)+1 {
+		return math.NaN()
+	}
+	total := s.Cumulative[len(s.Cumulative)-1]
+	if total == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := q * float64(total)
+
+	i := sort.Search(len(s.Cumulative), func(i int) bool { return float64(s.Cumulative[i]) >= rank })
+	if i == len(s.Bounds) {
+		return s.Bounds[len(s.Bounds)-1]
+	}
+
+	lower, below := 0.0, uint64(0)
+	if i > 0 {
+		lower, below = s.Bounds[i-1], s.Cumulative[i-1]
+	}
+	inBucket := s.Cumulative[i] - below
+	if inBucket == 0 {
+		return lower
+	}
+	return lower + (s.Bounds[i]-lower)*(rank-float64(below))/float64(inBucket)
+}
+
+type HistogramVec struct{ f *family }
+
+// Histogram registers a histogram family with the given bucket upper
+// bounds, DefBuckets if nil. They must be strictly increasing, with at
+// least one below +Inf
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	// +Inf is implied, so a trailing one is dropped rather than doubled up
+	if len(buckets) > 0 && math.IsInf(buckets[len(buckets)-1], 1) {
+		buckets = buckets[:len(buckets)-1]
+	}
+	if !increasing(buckets) {
+		panic(fmt.Sprintf("metrics: %s buckets must be strictly increasing, with at least one below +Inf", name))
+	}
+	buckets = append([]float64(nil), buckets...)
+	return &HistogramVec{r.register(name, help, histogramKind, buckets, labels)}
+}
+
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.f.with(values, func() any { return newHistogram(v.f.buckets) }).(*Histogram)
+}
+
+// increasing reports whether bounds is non-empty and strictly increasing.
+// Two equal bounds would make an empty bucket that Quantile divides by, and
+// a NaN isn't greater than anything, so it fails too
+func increasing(bounds []float64) bool {
+	if len(bounds) == 0 || math.IsNaN(bounds[0]) {
+		return false
+	}
+	for i := 1; i < len(bounds); i++ {
+		if !(bounds[i] > bounds[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// validName checks a metric or label name: letters, digits and
+// underscores, not starting with a digit. Metric names may have colons
+// too, but those are for recording rules, so they're left out here
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterAndGauge(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.Counter("jobs_total", "Jobs run.", "queue")
+	c.With("email").Inc()
+	c.With("email").Add(2.5)
+	c.With("sms").Inc()
+	assert.Equal(t, 3.5, c.With("email").Value())
+	assert.Equal(t, 1.0, c.With("sms").Value())
+	assert.Panics(t, func() { c.With("email").Add(-1) })
+
+	g := reg.Gauge("queue_depth", "Jobs waiting.")
+	g.With().Set(10)
+	g.With().Inc()
+	g.With().Dec()
+	g.With().Add(-4)
+	assert.Equal(t, 6.0, g.With().Value())
+}
+
+func TestRegisterPanics(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("ok_total", "")
+
+	assert.Panics(t, func() { reg.Counter("ok_total", "") }, "duplicate")
+	assert.Panics(t, func() { reg.Gauge("ok_total", "") }, "duplicate of another kind")
+	assert.Panics(t, func() { reg.Counter("bad-name", "") })
+	assert.Panics(t, func() { reg.Counter("9lives", "") })
+	assert.Panics(t, func() { reg.Counter("x_total", "", "__reserved") })
+	assert.Panics(t, func() { reg.Histogram("h", "", nil, "le") })
+	assert.Panics(t, func() { reg.Histogram("h2", "", []float64{1, 0.5}) })
+	assert.Panics(t, func() { reg.Histogram("h3", "", []float64{0.5, 1, 1}) }, "not strictly increasing")
+	assert.Panics(t, func() { reg.Histogram("h4", "", []float64{math.Inf(1)}) }, "only the implied +Inf")
+	assert.Panics(t, func() { reg.Histogram("h5", "", []float64{}) })
+	assert.Panics(t, func() { reg.Histogram("h6", "", []float64{math.NaN(), 1}) })
+
+	c := reg.Counter("labelled_total", "", "a", "b")
+	assert.Panics(t, func() { c.With("only one") })
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.Counter("hits_total", "", "shard")
+	h := reg.Histogram("size", "", []float64{1, 10, 100})
+
+	const workers, each = 16, 1000
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			shard := string(rune('a' + w%4))
+			for i := 0; i < each; i++ {
+				c.With(shard).Inc()
+				h.With().Observe(float64(i % 200))
+			}
+		}(w)
+	}
+
+	// scraping while the updates happen must be safe too
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			_, err := reg.WriteTo(&strings.Builder{})
+			assert.NoError(t, err)
+		}
+	}()
+	wg.Wait()
+	<-done
+
+	var total float64
+	for _, shard := range []string{"a", "b", "c", "d"} {
+		assert.Equal(t, float64(workers*each/4), c.With(shard).Value())
+		total += c.With(shard).Value()
+	}
+	assert.Equal(t, float64(workers*each), total)
+
+	snap := h.With().Snapshot()
+	assert.Equal(t, uint64(workers*each), snap.Count)
+	assert.Equal(t, snap.Count, snap.Cumulative[len(snap.Cumulative)-1])
+	// each worker's 1000 observations are 0..199 five times
+	assert.Equal(t, []uint64{2 * 5 * workers, 11 * 5 * workers, 101 * 5 * workers, 200 * 5 * workers}, snap.Cumulative)
+	assert.Equal(t, float64(workers*5*(199*200/2)), snap.Sum)
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	reg := NewRegistry()
+	h := reg.Histogram("latency_seconds", "", []float64{0.1, 0.2, 0.4, math.Inf(1)}).With()
+	assert.True(t, math.IsNaN(h.Snapshot().Quantile(0.5)), "no observations")
+
+	// 50 in (0, 0.1], 30 in (0.1, 0.2], 20 in (0.2, 0.4]
+	for i := 0; i < 50; i++ {
+		h.Observe(0.05)
+	}
+	for i := 0; i < 30; i++ {
+		h.Observe(0.15)
+	}
+	for i := 0; i < 20; i++ {
+		h.Observe(0.3)
+	}
+	snap := h.Snapshot()
+	assert.Equal(t, []float64{0.1, 0.2, 0.4}, snap.Bounds, "a trailing +Inf is implied")
+
+	assert.InDelta(t, 0.1, snap.Quantile(0.5), 1e-9)
+	// rank 65 is halfway through the 30 in the second bucket
+	assert.InDelta(t, 0.15, snap.Quantile(0.65), 1e-9)
+	// rank 90 is halfway through the last 20
+	assert.InDelta(t, 0.3, snap.Quantile(0.9), 1e-9)
+	assert.InDelta(t, 0.0, snap.Quantile(0), 1e-9)
+	assert.True(t, math.IsNaN(snap.Quantile(1.5)))
+
+	// anything above the highest bound can only be reported as that bound
+	for i := 0; i < 100; i++ {
+		h.Observe(7)
+	}
+	assert.Equal(t, 0.4, h.Snapshot().Quantile(0.99))
+
+	// a zero snapshot, or one with nothing but the overflow bucket, has no
+	// bounds to answer with
+	assert.True(t, math.IsNaN(HistogramSnapshot{}.Quantile(0.5)))
+	assert.True(t, math.IsNaN(HistogramSnapshot{Cumulative: []uint64{3}, Count: 3}.Quantile(0.5)))
+}
+
+func TestWriteTo(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("unused_total", "Never touched, so never written.")
+	req := reg.Counter("requests_total", "Requests.\nBy code.", "method", "code")
+	req.With("GET", "200").Add(3)
+	req.With("GET", "500").Inc()
+	req.With("POST", `a "quoted"\path`).Inc()
+	reg.Gauge("temperature", "Degrees.").With().Set(-2.5)
+	h := reg.Histogram("wait_seconds", "Waits.", []float64{0.5, 1}, "queue")
+	h.With("q").Observe(0.25)
+	h.With("q").Observe(2)
+
+	var b strings.Builder
+	n, err := reg.WriteTo(&b)
+	require.NoError(t, err)
+	assert.Equal(t, int64(b.Len()), n)
+
+	// families sorted by name, labels by name, series by value
+	assert.Equal(t, `# HELP requests_total Requests.\nBy code.
+# TYPE requests_total counter
+requests_total{code="200",method="GET"} 3
+requests_total{code="500",method="GET"} 1
+requests_total{code="a \"quoted\"\\path",method="POST"} 1
+# HELP temperature Degrees.
+# TYPE temperature gauge
+temperature -2.5
+# HELP wait_seconds Waits.
+# TYPE wait_seconds histogram
+wait_seconds_bucket{queue="q",le="0.5"} 1
+wait_seconds_bucket{queue="q",le="1"} 1
+wait_seconds_bucket{queue="q",le="+Inf"} 2
+wait_seconds_sum{queue="q"} 2.25
+wait_seconds_count{queue="q"} 2
+`, b.String())
+}
+
+func BenchmarkCounterInc(b *testing.B) {
+	c := NewRegistry().Counter("bench_total", "", "route").With("/todos")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc()
+		}
+	})
+}
+
+// the lookup by label values is most of the cost when a series isn't held
+// onto, which is how the middleware uses it
+func BenchmarkCounterWithInc(b *testing.B) {
+	c := NewRegistry().Counter("bench_total", "", "method", "route")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.With("GET", "/todos").Inc()
+		}
+	})
+}
+
+func BenchmarkHistogramObserve(b *testing.B) {
+	h := NewRegistry().Histogram("bench_seconds", "", nil).With()
+	b.RunParallel(func(pb *testing.PB) {
+		v := 0.0
+		for pb.Next() {
+			h.Observe(v)
+			v += 0.001
+		}
+	})
+}
+
+// the same two, through client_golang, for comparison
+
+func BenchmarkPrometheusCounterInc(b *testing.B) {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "bench_total"}, []string{"route"}).WithLabelValues("/todos")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc()
+		}
+	})
+}
+
+func BenchmarkPrometheusHistogramObserve(b *testing.B) {
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "bench_seconds"})
+	b.RunParallel(func(pb *testing.PB) {
+		v := 0.0
+		for pb.Next() {
+			h.Observe(v)
+			v += 0.001
+		}
+	})
+}
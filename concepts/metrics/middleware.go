@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPRecorder is what Middleware needs from a metrics library. There are
+// two here: HTTPMetrics over this package's Registry, and PrometheusHTTP
+// over client_golang. The middleware doesn't know which it has, so a
+// service can start on one and move to the other without touching it
+type HTTPRecorder interface {
+	// Started and Finished bracket each request
+	Started(method, route string)
+	Finished(method, route string, status int, elapsed time.Duration)
+}
+
+// Middleware records every request: a count by method, route and status,
+// a latency histogram, and how many are in flight. route names the
+// request's route pattern - router.Pattern, if it runs inside a pkg/router
+// group. It mustn't be the raw path, or every todo id becomes a series of
+// its own
+func Middleware(rec HTTPRecorder, route func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt := route(r)
+			if rt == "" {
+				rt = "unmatched"
+			}
+
+			start := time.Now()
+			rec.Started(r.Method, rt)
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				rec.Finished(r.Method, rt, sw.status, time.Since(start))
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// statusWriter notes the status code a handler sends. A handler that
+// never calls WriteHeader has sent 200
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = code, true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusWriter) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+// The series both recorders produce. The names and labels follow the
+// Prometheus conventions: a _total suffix on counters, base units
+// (seconds, not milliseconds) in the name
+const (
+	requestsName = "http_requests_total"
+	requestsHelp = "HTTP requests served, by method, route and status code."
+	durationName = "http_request_duration_seconds"
+	durationHelp = "How long HTTP requests took to serve."
+	inFlightName = "http_requests_in_flight"
+	inFlightHelp = "HTTP requests being served right now."
+)
+
+// HTTPMetrics is an HTTPRecorder over a Registry
+type HTTPMetrics struct {
+	requests *CounterVec
+	duration *HistogramVec
+	inFlight *GaugeVec
+}
+
+func NewHTTPMetrics(reg *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: reg.Counter(requestsName, requestsHelp, "method", "route", "code"),
+		duration: reg.Histogram(durationName, durationHelp, nil, "method", "route"),
+		inFlight: reg.Gauge(inFlightName, inFlightHelp),
+	}
+}
+
+func (m *HTTPMetrics) Started(method, route string) { m.inFlight.With().Inc() }
+
+func (m *HTTPMetrics) Finished(method, route string, status int, elapsed time.Duration) {
+	m.inFlight.With().Dec()
+	m.requests.With(method, route, strconv.Itoa(status)).Inc()
+	m.duration.With(method, route).Observe(elapsed.Seconds())
+}
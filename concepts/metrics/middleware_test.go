@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/pkg/router"
+)
+
+// backend is one HTTPRecorder and the handler that scrapes it
+type backend struct {
+	name   string
+	rec    HTTPRecorder
+	scrape http.Handler
+}
+
+func backends() []backend {
+	reg := NewRegistry()
+	prom := prometheus.NewRegistry()
+	return []backend{
+		{"hand-rolled", NewHTTPMetrics(reg), reg.Handler()},
+		{"client_golang", NewPrometheusHTTP(prom), promhttp.HandlerFor(prom, promhttp.HandlerOpts{})},
+	}
+}
+
+func newServer(rec HTTPRecorder, inFlight func()) http.Handler {
+	r := router.New()
+	r.Use(Middleware(rec, router.Pattern))
+	r.HandleFunc("GET /todos", func(w http.ResponseWriter, r *http.Request) {
+		if inFlight != nil {
+			inFlight()
+		}
+		io.WriteString(w, "[]")
+	})
+	r.HandleFunc("GET /todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if router.Param(r, "id") == "404" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "{}")
+	})
+	r.HandleFunc("POST /todos", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	return r
+}
+
+// scrape scrapes h and keeps the lines that aren't comments and aren't
+// timing dependent, _sum being the wall clock
+func scrape(t *testing.T, h http.Handler, prefix string) []string {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var lines []string
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		l := sc.Text()
+		if strings.HasPrefix(l, prefix) && !strings.Contains(l, "_sum") {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+func TestMiddleware(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			var during []string
+			srv := newServer(b.rec, func() {
+				during = scrape(t, b.scrape, inFlightName)
+			})
+
+			for _, req := range []struct{ method, path string }{
+				{"GET", "/todos"},
+				{"GET", "/todos/1"},
+				{"GET", "/todos/2"},
+				{"GET", "/todos/404"},
+				{"POST", "/todos"},
+			} {
+				srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+			}
+
+			// by pattern, not path, so the two ids share a series
+			assert.Equal(t, []string{
+				`http_requests_total{code="200",method="GET",route="/todos"} 1`,
+				`http_requests_total{code="200",method="GET",route="/todos/{id}"} 2`,
+				`http_requests_total{code="201",method="POST",route="/todos"} 1`,
+				`http_requests_total{code="404",method="GET",route="/todos/{id}"} 1`,
+			}, scrape(t, b.scrape, requestsName))
+			assert.Contains(t, scrape(t, b.scrape, durationName),
+				`http_request_duration_seconds_count{method="GET",route="/todos/{id}"} 3`)
+
+			assert.Equal(t, []string{inFlightName + " 1"}, during)
+			assert.Equal(t, []string{inFlightName + " 0"}, scrape(t, b.scrape, inFlightName))
+		})
+	}
+}
+
+func TestMiddlewareUnmatched(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			// outside a router there's no pattern
+			h := Middleware(b.rec, router.Pattern)(http.NotFoundHandler())
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/wp-login.php", nil))
+
+			assert.Equal(t, []string{
+				`http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+			}, scrape(t, b.scrape, requestsName))
+		})
+	}
+}
+
+// the point of the shared interface: the same traffic, scraped from
+// either, reads the same
+func TestBackendsAgree(t *testing.T) {
+	var scrapes [][]string
+	for _, b := range backends() {
+		srv := newServer(b.rec, nil)
+		for i := 0; i < 3; i++ {
+			srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/todos/1", nil))
+		}
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/todos", nil))
+		// bucket counts depend on timing, but _count and +Inf don't
+		var lines []string
+		for _, l := range scrape(t, b.scrape, "http_") {
+			if !strings.Contains(l, "_bucket") || strings.Contains(l, `le="+Inf"`) {
+				lines = append(lines, l)
+			}
+		}
+		scrapes = append(scrapes, lines)
+	}
+	require.NotEmpty(t, scrapes[0])
+	assert.Equal(t, scrapes[0], scrapes[1])
+}
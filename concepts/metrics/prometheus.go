@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusHTTP is an HTTPRecorder over the real client library. Side by
+// side with HTTPMetrics it shows how little changes: the same three
+// families, registered with a prometheus.Registerer, updated through the
+// same Vec.With pattern
+type PrometheusHTTP struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// NewPrometheusHTTP registers the families with reg. Like Registry, a
+// name registered twice panics
+func NewPrometheusHTTP(reg prometheus.Registerer) *PrometheusHTTP {
+	m := &PrometheusHTTP{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: requestsName,
+			Help: requestsHelp,
+		}, []string{"method", "route", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    durationName,
+			Help:    durationHelp,
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: inFlightName,
+			Help: inFlightHelp,
+		}),
+	}
+	reg.MustRegister(m.requests, m.duration, m.inFlight)
+	return m
+}
+
+func (m *PrometheusHTTP) Started(method, route string) { m.inFlight.Inc() }
+
+func (m *PrometheusHTTP) Finished(method, route string, status int, elapsed time.Duration) {
+	m.inFlight.Dec()
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,133 @@
+package mocking
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/apps/todo"
+)
+
+// fakeRepository is a hand-written fake: a real, if simple, implementation.
+// Failures are injected through fields, per id, so a test can say exactly
+// which delete goes wrong
+type fakeRepository struct {
+	todos     map[int64]todo.Todo
+	deleteErr map[int64]error
+	writes    int
+}
+
+func newFakeRepository(todos ...todo.Todo) *fakeRepository {
+	f := &fakeRepository{todos: map[int64]todo.Todo{}, deleteErr: map[int64]error{}}
+	for _, t := range todos {
+		f.todos[t.ID] = t
+	}
+	return f
+}
+
+func (f *fakeRepository) List(ctx context.Context) ([]todo.Todo, error) {
+	out := make([]todo.Todo, 0, len(f.todos))
+	for _, t := range f.todos {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (f *fakeRepository) Get(ctx context.Context, id int64) (todo.Todo, error) {
+	t, ok := f.todos[id]
+	if !ok {
+		return todo.Todo{}, todo.ErrNotFound
+	}
+	return t, nil
+}
+
+func (f *fakeRepository) Create(ctx context.Context, t todo.Todo) (todo.Todo, error) {
+	t.ID = int64(len(f.todos) + 1)
+	f.todos[t.ID] = t
+	f.writes++
+	return t, nil
+}
+
+func (f *fakeRepository) Update(ctx context.Context, t todo.Todo) error {
+	if _, ok := f.todos[t.ID]; !ok {
+		return todo.ErrNotFound
+	}
+	f.todos[t.ID] = t
+	f.writes++
+	return nil
+}
+
+func (f *fakeRepository) Delete(ctx context.Context, id int64) error {
+	if err := f.deleteErr[id]; err != nil {
+		return err
+	}
+	if _, ok := f.todos[id]; !ok {
+		return todo.ErrNotFound
+	}
+	delete(f.todos, id)
+	f.writes++
+	return nil
+}
+
+// the fake had better behave like the real thing, or tests against it
+// prove nothing. Checking it is as easy as building both
+var _ todo.TodoRepository = (*fakeRepository)(nil)
+
+var (
+	milk = todo.Todo{ID: 1, Title: "buy milk"}
+	dog  = todo.Todo{ID: 2, Title: "walk dog", Completed: true}
+	post = todo.Todo{ID: 3, Title: "post letter", Completed: true}
+
+	errDB = errors.New("database is down")
+)
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("complete", func(t *testing.T) {
+		repo := newFakeRepository(milk)
+		got, err := NewService(repo).Complete(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, got.Completed)
+
+		stored, _ := repo.Get(ctx, 1)
+		assert.True(t, stored.Completed)
+	})
+
+	t.Run("complete twice", func(t *testing.T) {
+		repo := newFakeRepository(dog)
+		_, err := NewService(repo).Complete(ctx, 2)
+		assert.ErrorIs(t, err, ErrAlreadyCompleted)
+		assert.Zero(t, repo.writes)
+	})
+
+	t.Run("complete missing", func(t *testing.T) {
+		_, err := NewService(newFakeRepository()).Complete(ctx, 9)
+		assert.ErrorIs(t, err, todo.ErrNotFound)
+	})
+
+	t.Run("clear completed", func(t *testing.T) {
+		repo := newFakeRepository(milk, dog, post)
+		n, err := NewService(repo).ClearCompleted(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		left, _ := repo.List(ctx)
+		assert.Equal(t, []todo.Todo{milk}, left)
+	})
+
+	t.Run("clear stops on error", func(t *testing.T) {
+		repo := newFakeRepository(milk, dog, post)
+		repo.deleteErr[2] = errDB
+		n, err := NewService(repo).ClearCompleted(ctx)
+		assert.ErrorIs(t, err, errDB)
+		assert.Zero(t, n)
+
+		left, _ := repo.List(ctx)
+		assert.Len(t, left, 3)
+	})
+}
@@ -0,0 +1,114 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/thorntonmc/go-practice/apps/todo (interfaces: TodoRepository)
+//
+// Generated by this command:
+//
+//	mockgen -destination=gomock_repository_test.go -package=mocking github.com/thorntonmc/go-practice/apps/todo TodoRepository
+//
+
+// Package mocking is a generated GoMock package.
+package mocking
+
+import (
+	context "context"
+	reflect "reflect"
+
+	todo "github.com/thorntonmc/go-practice/apps/todo"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockTodoRepository is a mock of TodoRepository interface.
+type MockTodoRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockTodoRepositoryMockRecorder
+}
+
+// MockTodoRepositoryMockRecorder is the mock recorder for MockTodoRepository.
+type MockTodoRepositoryMockRecorder struct {
+	mock *MockTodoRepository
+}
+
+// NewMockTodoRepository creates a new mock instance.
+func NewMockTodoRepository(ctrl *gomock.Controller) *MockTodoRepository {
+	mock := &MockTodoRepository{ctrl: ctrl}
+	mock.recorder = &MockTodoRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTodoRepository) EXPECT() *MockTodoRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockTodoRepository) Create(arg0 context.Context, arg1 todo.Todo) (todo.Todo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", arg0, arg1)
+	ret0, _ := ret[0].(todo.Todo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockTodoRepositoryMockRecorder) Create(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockTodoRepository)(nil).Create), arg0, arg1)
+}
+
+// Delete mocks base method.
+func (m *MockTodoRepository) Delete(arg0 context.Context, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockTodoRepositoryMockRecorder) Delete(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockTodoRepository)(nil).Delete), arg0, arg1)
+}
+
+// Get mocks base method.
+func (m *MockTodoRepository) Get(arg0 context.Context, arg1 int64) (todo.Todo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", arg0, arg1)
+	ret0, _ := ret[0].(todo.Todo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockTodoRepositoryMockRecorder) Get(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockTodoRepository)(nil).Get), arg0, arg1)
+}
+
+// List mocks base method.
+func (m *MockTodoRepository) List(arg0 context.Context) ([]todo.Todo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0)
+	ret0, _ := ret[0].([]todo.Todo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockTodoRepositoryMockRecorder) List(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockTodoRepository)(nil).List), arg0)
+}
+
+// Update mocks base method.
+func (m *MockTodoRepository) Update(arg0 context.Context, arg1 todo.Todo) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockTodoRepositoryMockRecorder) Update(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockTodoRepository)(nil).Update), arg0, arg1)
+}
@@ -0,0 +1,72 @@
+package mocking
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/apps/todo"
+	"go.uber.org/mock/gomock"
+)
+
+// MockTodoRepository is generated into gomock_repository_test.go, run go
+// generate ./concepts/mocking after changing todo.TodoRepository. The
+// controller fails the test on any call nobody EXPECTed, and on any
+// expectation left unmet when the test ends
+func TestGomock(t *testing.T) {
+	ctx := context.Background()
+	anyCtx := gomock.Any()
+
+	t.Run("complete", func(t *testing.T) {
+		repo := NewMockTodoRepository(gomock.NewController(t))
+		done := milk
+		done.Completed = true
+		gomock.InOrder(
+			repo.EXPECT().Get(anyCtx, int64(1)).Return(milk, nil),
+			repo.EXPECT().Update(anyCtx, done).Return(nil),
+		)
+
+		got, err := NewService(repo).Complete(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, got.Completed)
+	})
+
+	t.Run("complete twice", func(t *testing.T) {
+		repo := NewMockTodoRepository(gomock.NewController(t))
+		repo.EXPECT().Get(anyCtx, int64(2)).Return(dog, nil)
+		// no Update expected, so calling it would fail the test
+
+		_, err := NewService(repo).Complete(ctx, 2)
+		assert.ErrorIs(t, err, ErrAlreadyCompleted)
+	})
+
+	t.Run("complete missing", func(t *testing.T) {
+		repo := NewMockTodoRepository(gomock.NewController(t))
+		repo.EXPECT().Get(anyCtx, int64(9)).Return(todo.Todo{}, todo.ErrNotFound)
+
+		_, err := NewService(repo).Complete(ctx, 9)
+		assert.ErrorIs(t, err, todo.ErrNotFound)
+	})
+
+	t.Run("clear completed", func(t *testing.T) {
+		repo := NewMockTodoRepository(gomock.NewController(t))
+		repo.EXPECT().List(anyCtx).Return([]todo.Todo{milk, dog, post}, nil)
+		repo.EXPECT().Delete(anyCtx, int64(2)).Return(nil)
+		repo.EXPECT().Delete(anyCtx, int64(3)).Return(nil)
+
+		n, err := NewService(repo).ClearCompleted(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+	})
+
+	t.Run("clear stops on error", func(t *testing.T) {
+		repo := NewMockTodoRepository(gomock.NewController(t))
+		repo.EXPECT().List(anyCtx).Return([]todo.Todo{milk, dog, post}, nil)
+		repo.EXPECT().Delete(anyCtx, int64(2)).Return(errDB)
+
+		n, err := NewService(repo).ClearCompleted(ctx)
+		assert.ErrorIs(t, err, errDB)
+		assert.Zero(t, n)
+	})
+}
@@ -0,0 +1,87 @@
+package mocking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/thorntonmc/go-practice/apps/todo"
+)
+
+//go:generate go run go.uber.org/mock/mockgen -destination=gomock_repository_test.go -package=mocking github.com/thorntonmc/go-practice/apps/todo TodoRepository
+
+// A test double stands in for a dependency so the code around it can be
+// tested alone. There are three common ways to write one in Go, and the
+// tests here use each against the same interface, todo.TodoRepository, with
+// the same scenarios, so they can be read side by side:
+//
+//   - fake_test.go: a hand-written fake. A working, simplified
+//     implementation - a map instead of a database. Tests check the end
+//     state ("is the todo completed now?") rather than the calls made to
+//     get there. No library, no magic, and it survives refactoring of how
+//     the code uses the repository. The cost is writing and maintaining it
+//   - testify_test.go: testify/mock. Each method is a few lines forwarding
+//     to m.Called, and tests script calls with On(...).Return(...). Checks
+//     are by interaction ("Update was called with this todo"). Arguments
+//     go through interface{}, so a wrong type is a runtime failure
+//   - gomock_test.go: go.uber.org/mock, with the mock generated by mockgen
+//     (see the go:generate line above). Typed EXPECT() calls, the mock
+//     fails the test on any call it wasn't told about, and the controller
+//     checks every expectation was met at the end
+//
+// The usual advice holds up in the comparison: prefer fakes for things with
+// state (repositories, caches), and reach for mocks when the interaction is
+// the point - "the email was sent exactly once" - or the dependency is
+// awkward to fake. Mocks written for every call tend to test how the code
+// is written rather than what it does, and break on harmless refactors
+
+// ErrAlreadyCompleted is returned when completing a todo twice
+var ErrAlreadyCompleted = errors.New("todo already completed")
+
+// Service is the code under test, a couple of operations on top of a
+// repository
+type Service struct {
+	repo todo.TodoRepository
+}
+
+func NewService(repo todo.TodoRepository) *Service {
+	return &Service{repo: repo}
+}
+
+// Complete marks a todo as done
+func (s *Service) Complete(ctx context.Context, id int64) (todo.Todo, error) {
+	t, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return todo.Todo{}, err
+	}
+	if t.Completed {
+		return t, ErrAlreadyCompleted
+	}
+
+	t.Completed = true
+	if err := s.repo.Update(ctx, t); err != nil {
+		return todo.Todo{}, err
+	}
+	return t, nil
+}
+
+// ClearCompleted deletes every completed todo and reports how many went. It
+// stops at the first failure
+func (s *Service) ClearCompleted(ctx context.Context) (int, error) {
+	todos, err := s.repo.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, t := range todos {
+		if !t.Completed {
+			continue
+		}
+		if err := s.repo.Delete(ctx, t.ID); err != nil {
+			return n, fmt.Errorf("deleting %d: %w", t.ID, err)
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,101 @@
+package mocking
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/apps/todo"
+)
+
+// testifyRepository is a testify mock: every method hands its arguments to
+// Called and unpacks whatever the test told it to return. The type
+// assertions are where the interface{} shows through
+type testifyRepository struct {
+	mock.Mock
+}
+
+func (m *testifyRepository) List(ctx context.Context) ([]todo.Todo, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]todo.Todo), args.Error(1)
+}
+
+func (m *testifyRepository) Get(ctx context.Context, id int64) (todo.Todo, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(todo.Todo), args.Error(1)
+}
+
+func (m *testifyRepository) Create(ctx context.Context, t todo.Todo) (todo.Todo, error) {
+	args := m.Called(ctx, t)
+	return args.Get(0).(todo.Todo), args.Error(1)
+}
+
+func (m *testifyRepository) Update(ctx context.Context, t todo.Todo) error {
+	return m.Called(ctx, t).Error(0)
+}
+
+func (m *testifyRepository) Delete(ctx context.Context, id int64) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func TestTestify(t *testing.T) {
+	ctx := context.Background()
+	anyCtx := mock.Anything // the context, which these tests don't care about
+
+	t.Run("complete", func(t *testing.T) {
+		repo := &testifyRepository{}
+		repo.On("Get", anyCtx, int64(1)).Return(milk, nil)
+		done := milk
+		done.Completed = true
+		repo.On("Update", anyCtx, done).Return(nil).Once()
+
+		got, err := NewService(repo).Complete(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, got.Completed)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("complete twice", func(t *testing.T) {
+		repo := &testifyRepository{}
+		repo.On("Get", anyCtx, int64(2)).Return(dog, nil)
+
+		_, err := NewService(repo).Complete(ctx, 2)
+		assert.ErrorIs(t, err, ErrAlreadyCompleted)
+		// an unexpected Update would have panicked already, this just says
+		// so out loud
+		repo.AssertNotCalled(t, "Update", anyCtx, mock.Anything)
+	})
+
+	t.Run("complete missing", func(t *testing.T) {
+		repo := &testifyRepository{}
+		repo.On("Get", anyCtx, int64(9)).Return(todo.Todo{}, todo.ErrNotFound)
+
+		_, err := NewService(repo).Complete(ctx, 9)
+		assert.ErrorIs(t, err, todo.ErrNotFound)
+	})
+
+	t.Run("clear completed", func(t *testing.T) {
+		repo := &testifyRepository{}
+		repo.On("List", anyCtx).Return([]todo.Todo{milk, dog, post}, nil)
+		repo.On("Delete", anyCtx, int64(2)).Return(nil).Once()
+		repo.On("Delete", anyCtx, int64(3)).Return(nil).Once()
+
+		n, err := NewService(repo).ClearCompleted(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("clear stops on error", func(t *testing.T) {
+		repo := &testifyRepository{}
+		repo.On("List", anyCtx).Return([]todo.Todo{milk, dog, post}, nil)
+		repo.On("Delete", anyCtx, int64(2)).Return(errDB)
+
+		n, err := NewService(repo).ClearCompleted(ctx)
+		assert.ErrorIs(t, err, errDB)
+		assert.Zero(t, n)
+		repo.AssertNotCalled(t, "Delete", anyCtx, int64(3))
+	})
+}
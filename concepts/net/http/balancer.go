@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/hash"
+)
+
+/*
+ *
+ * client side load balancing
+ *
+ */
+
+// When there are several copies of a service and no load balancer in front of
+// them, the client can spread requests itself. A RoundTripper is the perfect
+// place for this - callers make requests to any host they like and the
+// transport rewrites them to point at one of the backends
+
+type Strategy int
+
+const (
+	// RoundRobin sends each request to the next backend in turn
+	RoundRobin Strategy = iota
+	// LeastPending sends each request to the backend with the fewest requests
+	// still in flight, which steers traffic away from slow backends
+	LeastPending
+	// Sticky sends every request with the same key (see StickyKey) to the same
+	// backend, using a consistent hash ring. Backend caches stay warm, and
+	// when a backend is ejected only its keys move - to the next backend
+	// round the ring - while everyone else's stay put
+	Sticky
+)
+
+// stickyReplicas is how many points each backend gets on the hash ring
+const stickyReplicas = 100
+
+// ErrNoHealthyBackends is returned when every backend has been ejected
+var ErrNoHealthyBackends = errors.New("no healthy backends")
+
+type backend struct {
+	url     *url.URL
+	pending int64 // accessed atomically
+
+	// guarded by LoadBalancer.mu
+	healthy  bool
+	failures int
+}
+
+type LoadBalancer struct {
+	// ProbePath is requested on every backend by CheckHealth. A backend is
+	// ejected after UnhealthyAfter consecutive failed probes, and let back in
+	// after its next successful one
+	ProbePath      string
+	UnhealthyAfter int
+
+	// StickyKey picks the routing key for the Sticky strategy. The default is
+	// the URL path, so each resource is always served by the same backend
+	StickyKey func(*http.Request) string
+
+	next     http.RoundTripper
+	strategy Strategy
+	backends []*backend
+	byURL    map[string]*backend
+	ring     *hash.Ring
+	counter  uint64
+
+	mu sync.RWMutex
+}
+
+// NewLoadBalancer balances across targets, which are base URLs such as
+// http://10.0.0.1:8000. A nil next uses http.DefaultTransport
+func NewLoadBalancer(next http.RoundTripper, targets []string, strategy Strategy) (*LoadBalancer, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("at least one target is required")
+	}
+
+	lb := &LoadBalancer{
+		ProbePath:      "/healthz",
+		UnhealthyAfter: 2,
+		StickyKey:      func(r *http.Request) string { return r.URL.Path },
+		next:           next,
+		strategy:       strategy,
+		byURL:          map[string]*backend{},
+		ring:           hash.NewRing(stickyReplicas, nil),
+	}
+	for _, t := range targets {
+		u, err := url.Parse(t)
+		if err != nil {
+			return nil, err
+		}
+		b := &backend{url: u, healthy: true}
+		lb.backends = append(lb.backends, b)
+		lb.byURL[u.String()] = b
+		lb.ring.Add(u.String())
+	}
+
+	return lb, nil
+}
+
+func (lb *LoadBalancer) RoundTrip(r *http.Request) (*http.Response, error) {
+	b, err := lb.pick(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// a RoundTripper must not modify the request it was given, so work on a copy
+	out := r.Clone(r.Context())
+	out.URL.Scheme = b.url.Scheme
+	out.URL.Host = b.url.Host
+	out.URL.Path = strings.TrimSuffix(b.url.Path, "/") + r.URL.Path
+	// RawPath has to be rewritten alongside Path, or an escaped path like
+	// /files/a%2Fb would either lose its %2F or be sent without the base
+	out.URL.RawPath = strings.TrimSuffix(b.url.EscapedPath(), "/") + r.URL.EscapedPath()
+	out.Host = ""
+
+	// the request is pending until the caller is done with the body, not
+	// just until the headers arrive - a slow download is still load
+	atomic.AddInt64(&b.pending, 1)
+	resp, err := lb.next.RoundTrip(out)
+	if err != nil {
+		atomic.AddInt64(&b.pending, -1)
+		return nil, err
+	}
+	resp.Body = &pendingBody{ReadCloser: resp.Body, pending: &b.pending}
+
+	return resp, nil
+}
+
+// pendingBody takes its request off the backend's pending count when it's
+// closed. Close may be called more than once, so only the first counts
+type pendingBody struct {
+	io.ReadCloser
+	pending *int64
+	once    sync.Once
+}
+
+func (p *pendingBody) Close() error {
+	p.once.Do(func() { atomic.AddInt64(p.pending, -1) })
+	return p.ReadCloser.Close()
+}
+
+func (lb *LoadBalancer) pick(r *http.Request) (*backend, error) {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	if lb.strategy == Sticky {
+		return lb.pickSticky(lb.StickyKey(r))
+	}
+
+	healthy := make([]*backend, 0, len(lb.backends))
+	for _, b := range lb.backends {
+		if b.healthy {
+			healthy = append(healthy, b)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil, ErrNoHealthyBackends
+	}
+
+	if lb.strategy == LeastPending {
+		best := healthy[0]
+		for _, b := range healthy[1:] {
+			if atomic.LoadInt64(&b.pending) < atomic.LoadInt64(&best.pending) {
+				best = b
+			}
+		}
+		return best, nil
+	}
+
+	n := atomic.AddUint64(&lb.counter, 1) - 1
+	return healthy[n%uint64(len(healthy))], nil
+}
+
+// pickSticky walks the ring from the key's owner, taking the first healthy
+// backend. Ejected backends stay on the ring, so when one comes back its
+// keys return to it. Called with mu held
+func (lb *LoadBalancer) pickSticky(key string) (*backend, error) {
+	for _, u := range lb.ring.GetN(key, len(lb.backends)) {
+		if b := lb.byURL[u]; b.healthy {
+			return b, nil
+		}
+	}
+	return nil, ErrNoHealthyBackends
+}
+
+// Healthy returns the base URLs currently receiving traffic
+func (lb *LoadBalancer) Healthy() []string {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	var out []string
+	for _, b := range lb.backends {
+		if b.healthy {
+			out = append(out, b.url.String())
+		}
+	}
+
+	return out
+}
+
+// CheckHealth probes every backend once, concurrently. The probes go straight
+// to next, not through the balancer, otherwise they'd be load balanced too
+func (lb *LoadBalancer) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range lb.backends {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+			lb.recordProbe(b, lb.probe(ctx, b))
+		}(b)
+	}
+	wg.Wait()
+}
+
+func (lb *LoadBalancer) probe(ctx context.Context, b *backend) bool {
+	u := *b.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + lb.ProbePath
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := lb.next.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode < 300
+}
+
+func (lb *LoadBalancer) recordProbe(b *backend, ok bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if ok {
+		b.failures = 0
+		b.healthy = true
+		return
+	}
+
+	b.failures++
+	if b.failures >= lb.UnhealthyAfter {
+		b.healthy = false
+	}
+}
+
+// WatchHealth calls CheckHealth every interval until ctx is done
+func (lb *LoadBalancer) WatchHealth(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			lb.CheckHealth(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBackend answers requests with its name, and /healthz with whatever
+// status health is set to
+type testBackend struct {
+	*httptest.Server
+	health int32
+}
+
+func newTestBackend(t *testing.T, name string, handler http.HandlerFunc) *testBackend {
+	b := &testBackend{health: http.StatusOK}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(int(atomic.LoadInt32(&b.health)))
+			return
+		}
+		if handler != nil {
+			handler(w, r)
+		}
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(b.Close)
+
+	return b
+}
+
+func fetchName(t *testing.T, c *http.Client) string {
+	resp, err := c.Get("http://todo-service/todos")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestLoadBalancerRoundRobin(t *testing.T) {
+	a, b, c := newTestBackend(t, "a", nil), newTestBackend(t, "b", nil), newTestBackend(t, "c", nil)
+	lb, err := NewLoadBalancer(nil, []string{a.URL, b.URL, c.URL}, RoundRobin)
+	require.NoError(t, err)
+	client := &http.Client{Transport: lb}
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, fetchName(t, client))
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, got)
+}
+
+func TestLoadBalancerEjectsAndReadmits(t *testing.T) {
+	a, b := newTestBackend(t, "a", nil), newTestBackend(t, "b", nil)
+	lb, err := NewLoadBalancer(nil, []string{a.URL, b.URL}, RoundRobin)
+	require.NoError(t, err)
+	client := &http.Client{Transport: lb}
+	ctx := context.Background()
+
+	atomic.StoreInt32(&b.health, http.StatusServiceUnavailable)
+
+	// one failed probe isn't enough to eject
+	lb.CheckHealth(ctx)
+	assert.Len(t, lb.Healthy(), 2)
+
+	lb.CheckHealth(ctx)
+	assert.Equal(t, []string{a.URL}, lb.Healthy())
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "a", fetchName(t, client))
+	}
+
+	atomic.StoreInt32(&b.health, http.StatusOK)
+	lb.CheckHealth(ctx)
+	assert.Len(t, lb.Healthy(), 2)
+}
+
+func TestLoadBalancerNoHealthyBackends(t *testing.T) {
+	a := newTestBackend(t, "a", nil)
+	lb, err := NewLoadBalancer(nil, []string{a.URL}, RoundRobin)
+	require.NoError(t, err)
+	lb.UnhealthyAfter = 1
+
+	a.Close()
+	lb.CheckHealth(context.Background())
+
+	_, err = (&http.Client{Transport: lb}).Get("http://todo-service/")
+	assert.ErrorIs(t, err, ErrNoHealthyBackends)
+}
+
+func TestLoadBalancerLeastPending(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	slow := newTestBackend(t, "slow", func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	fast := newTestBackend(t, "fast", nil)
+
+	lb, err := NewLoadBalancer(nil, []string{slow.URL, fast.URL}, LeastPending)
+	require.NoError(t, err)
+	client := &http.Client{Transport: lb}
+
+	// with nothing pending the first backend wins, and gets stuck
+	done := make(chan string)
+	go func() {
+		resp, err := client.Get("http://todo-service/todos")
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		done <- string(body)
+	}()
+	<-entered
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "fast", fetchName(t, client))
+	}
+
+	close(release)
+	assert.Equal(t, "slow", <-done)
+}
+
+func TestLoadBalancerPendingUntilBodyClosed(t *testing.T) {
+	backend := newTestBackend(t, "a", nil)
+	lb, err := NewLoadBalancer(nil, []string{backend.URL}, LeastPending)
+	require.NoError(t, err)
+	b := lb.backends[0]
+
+	resp, err := (&http.Client{Transport: lb}).Get("http://todo-service/todos")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&b.pending), "the body hasn't been read yet")
+
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body.Close()
+	assert.Equal(t, int64(0), atomic.LoadInt64(&b.pending))
+}
+
+func TestLoadBalancerEscapedPath(t *testing.T) {
+	var got string
+	backend := newTestBackend(t, "a", func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.EscapedPath()
+	})
+	lb, err := NewLoadBalancer(nil, []string{backend.URL + "/api/"}, RoundRobin)
+	require.NoError(t, err)
+	client := &http.Client{Transport: lb}
+
+	resp, err := client.Get("http://todo-service/files/a%2Fb")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "/api/files/a%2Fb", got)
+
+	resp, err = client.Get("http://todo-service/files/a%20b")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "/api/files/a%20b", got)
+}
+
+func TestLoadBalancerSticky(t *testing.T) {
+	backends := map[string]*testBackend{}
+	var urls []string
+	for _, name := range []string{"a", "b", "c"} {
+		b := newTestBackend(t, name, nil)
+		backends[name] = b
+		urls = append(urls, b.URL)
+	}
+	lb, err := NewLoadBalancer(nil, urls, Sticky)
+	require.NoError(t, err)
+	lb.UnhealthyAfter = 1
+	client := &http.Client{Transport: lb}
+
+	fetch := func(path string) string {
+		resp, err := client.Get("http://todo-service" + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	// the same key always lands on the same backend, and the keys spread out
+	owners := map[string]string{}
+	used := map[string]bool{}
+	for i := 0; i < 30; i++ {
+		path := fmt.Sprintf("/todos/%d", i)
+		owners[path] = fetch(path)
+		used[owners[path]] = true
+		assert.Equal(t, owners[path], fetch(path))
+	}
+	assert.Len(t, used, 3)
+
+	// eject one backend: only its keys move
+	atomic.StoreInt32(&backends["b"].health, http.StatusServiceUnavailable)
+	lb.CheckHealth(context.Background())
+	for path, owner := range owners {
+		got := fetch(path)
+		if owner == "b" {
+			assert.NotEqual(t, "b", got)
+		} else {
+			assert.Equal(t, owner, got, path)
+		}
+	}
+
+	// and when it's back, they return
+	atomic.StoreInt32(&backends["b"].health, http.StatusOK)
+	lb.CheckHealth(context.Background())
+	for path, owner := range owners {
+		assert.Equal(t, owner, fetch(path), path)
+	}
+}
+
+func TestLoadBalancerStickyKey(t *testing.T) {
+	a, b := newTestBackend(t, "a", nil), newTestBackend(t, "b", nil)
+	lb, err := NewLoadBalancer(nil, []string{a.URL, b.URL}, Sticky)
+	require.NoError(t, err)
+	lb.StickyKey = func(r *http.Request) string { return r.Header.Get("X-User") }
+	client := &http.Client{Transport: lb}
+
+	get := func(path, user string) string {
+		req, _ := http.NewRequest(http.MethodGet, "http://todo-service"+path, nil)
+		req.Header.Set("X-User", user)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// one user, many paths, one backend
+	first := get("/todos/1", "ann")
+	for i := 2; i < 10; i++ {
+		assert.Equal(t, first, get(fmt.Sprintf("/todos/%d", i), "ann"))
+	}
+}
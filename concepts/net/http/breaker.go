@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/statemachine"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+/*
+ *
+ * circuit breaker
+ *
+ */
+
+// Retrying a request to a server that's already struggling only adds to its
+// load. A circuit breaker stops calling it for a while after too many failures:
+//
+//	closed    - requests go through, consecutive failures are counted
+//	open      - requests fail immediately with ErrCircuitOpen, until the cool-down passes
+//	half-open - a single trial request is let through. If it succeeds the breaker
+//	            closes again, if it fails it opens for another cool-down
+//
+// Because the client only ever talks to an http.RoundTripper, the breaker can
+// wrap the transport and every request made with the client goes through it.
+//
+// Those three states and the moves between them are a state machine, so the
+// rules live in breakerTable rather than in switch statements - the
+// RoundTripper just reports what happened
+
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen is returned without making a request while the breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerEvent int
+
+const (
+	breakerSuccess breakerEvent = iota
+	breakerFailure
+	breakerCooledDown
+)
+
+var breakerTable = statemachine.NewTable[BreakerState, breakerEvent, *CircuitBreaker]().
+	Permit(StateClosed, breakerFailure, StateOpen, (*CircuitBreaker).tripped).
+	Permit(StateClosed, breakerFailure, StateClosed).
+	Permit(StateClosed, breakerSuccess, StateClosed).
+	Permit(StateOpen, breakerCooledDown, StateHalfOpen, (*CircuitBreaker).cooledDown).
+	Permit(StateHalfOpen, breakerSuccess, StateClosed).
+	Permit(StateHalfOpen, breakerFailure, StateOpen).
+	OnEnter(StateClosed, func(_ breakerTransition, b *CircuitBreaker) { b.failures = 0 }).
+	OnEnter(StateOpen, func(_ breakerTransition, b *CircuitBreaker) { b.openedAt = b.clock.Now() }).
+	// the request that moves the breaker to half-open is the trial
+	OnEnter(StateHalfOpen, func(_ breakerTransition, b *CircuitBreaker) { b.trial = true }).
+	OnExit(StateHalfOpen, func(_ breakerTransition, b *CircuitBreaker) { b.trial = false }).
+	OnTransition(func(t breakerTransition, b *CircuitBreaker) {
+		if t.From != t.To {
+			b.generation++
+		}
+	})
+
+type breakerTransition = statemachine.Transition[BreakerState, breakerEvent]
+
+func (b *CircuitBreaker) tripped() bool    { return b.failures >= b.threshold }
+func (b *CircuitBreaker) cooledDown() bool { return b.clock.Now().Sub(b.openedAt) >= b.coolDown }
+
+type CircuitBreaker struct {
+	next      http.RoundTripper
+	threshold int
+	coolDown  time.Duration
+	clock     clock.Clock
+
+	mu       sync.Mutex
+	fsm      *statemachine.Machine[BreakerState, breakerEvent, *CircuitBreaker]
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial request is in flight
+
+	// generation counts state changes. A request remembers the generation
+	// it was let through in, and its result only counts if nothing has
+	// changed since - otherwise a slow request from before the breaker
+	// opened could finish during half-open and be taken for the trial
+	generation uint64
+}
+
+// NewCircuitBreaker opens after threshold consecutive failures and stays open
+// for coolDown. A nil next uses http.DefaultTransport
+func NewCircuitBreaker(next http.RoundTripper, threshold int, coolDown time.Duration, clk clock.Clock) *CircuitBreaker {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &CircuitBreaker{
+		next:      next,
+		threshold: threshold,
+		coolDown:  coolDown,
+		clock:     clk,
+		fsm:       statemachine.NewMachine(breakerTable, StateClosed),
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.fsm.State()
+}
+
+func (b *CircuitBreaker) RoundTrip(r *http.Request) (*http.Response, error) {
+	gen, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	// recorded in a defer so a panicking transport still counts, as a
+	// failure - otherwise a panicking trial would leave the breaker half-open
+	// with the trial taken, turning everyone away for good
+	success := false
+	defer func() { b.record(gen, success) }()
+
+	resp, err := b.next.RoundTrip(r)
+
+	// transport errors and 5xx count as failures, a 4xx is the caller's fault
+	// and says nothing about the health of the server
+	success = err == nil && resp.StatusCode < http.StatusInternalServerError
+
+	return resp, err
+}
+
+// allow lets a request through or turns it away, returning the generation
+// to record its result against
+func (b *CircuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.fsm.State() {
+	case StateOpen:
+		// the guard turns this away until the cool-down has passed
+		if err := b.fsm.Fire(breakerCooledDown, b); err != nil {
+			return 0, ErrCircuitOpen
+		}
+	case StateHalfOpen:
+		// only one trial at a time, everyone else is still turned away
+		if b.trial {
+			return 0, ErrCircuitOpen
+		}
+		b.trial = true
+	}
+
+	return b.generation, nil
+}
+
+func (b *CircuitBreaker) record(gen uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// let through before the last state change, so it says nothing about now
+	if gen != b.generation {
+		return
+	}
+
+	ev := breakerSuccess
+	if success {
+		b.failures = 0
+	} else {
+		b.failures++
+		ev = breakerFailure
+	}
+
+	_ = b.fsm.Fire(ev, b)
+}
+
+// Plugging it into the client is just setting the Transport
+func newBreakerClient() *http.Client {
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: NewCircuitBreaker(http.DefaultTransport, 5, 10*time.Second, clock.New()),
+	}
+}
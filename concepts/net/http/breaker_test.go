@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/statemachine"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// roundTripFunc lets a plain function stand in for the real transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// fakeUpstream returns whatever status is set, counting the calls it sees
+type fakeUpstream struct {
+	status int
+	err    error
+	calls  int
+}
+
+func (u *fakeUpstream) RoundTrip(r *http.Request) (*http.Response, error) {
+	u.calls++
+	if u.err != nil {
+		return nil, u.err
+	}
+	return &http.Response{StatusCode: u.status, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func newTestBreaker() (*CircuitBreaker, *fakeUpstream, *clock.Fake) {
+	up := &fakeUpstream{status: http.StatusOK}
+	clk := clock.NewFake(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	return NewCircuitBreaker(up, 3, time.Minute, clk), up, clk
+}
+
+func get(b *CircuitBreaker) error {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	resp, err := b.RoundTrip(req)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, up, _ := newTestBreaker()
+	up.status = http.StatusInternalServerError
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, get(b))
+		assert.Equal(t, StateClosed, b.State())
+	}
+
+	// a 5xx is still a response, so the caller gets it back, but the
+	// third one trips the breaker
+	assert.NoError(t, get(b))
+	assert.Equal(t, StateOpen, b.State())
+	assert.ErrorIs(t, get(b), ErrCircuitOpen)
+	assert.Equal(t, 3, up.calls, "open breaker must not call upstream")
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b, up, _ := newTestBreaker()
+
+	up.err = errors.New("connection refused")
+	get(b)
+	get(b)
+	up.err = nil
+	get(b)
+	up.err = errors.New("connection refused")
+	get(b)
+	get(b)
+
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerIgnoresClientErrors(t *testing.T) {
+	b, up, _ := newTestBreaker()
+	up.status = http.StatusNotFound
+
+	for i := 0; i < 10; i++ {
+		get(b)
+	}
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name        string
+		trialStatus int
+		want        BreakerState
+	}{
+		{"trial succeeds", http.StatusOK, StateClosed},
+		{"trial fails", http.StatusServiceUnavailable, StateOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, up, clk := newTestBreaker()
+			up.status = http.StatusInternalServerError
+			for i := 0; i < 3; i++ {
+				get(b)
+			}
+			require.Equal(t, StateOpen, b.State())
+
+			clk.Advance(59 * time.Second)
+			assert.ErrorIs(t, get(b), ErrCircuitOpen)
+
+			clk.Advance(time.Second)
+			up.status = tt.trialStatus
+			assert.NoError(t, get(b))
+			assert.Equal(t, 4, up.calls)
+			assert.Equal(t, tt.want, b.State())
+		})
+	}
+}
+
+func TestBreakerSingleTrial(t *testing.T) {
+	b, up, clk := newTestBreaker()
+	up.status = http.StatusInternalServerError
+	for i := 0; i < 3; i++ {
+		get(b)
+	}
+	clk.Advance(time.Minute)
+
+	// hold the trial request in flight while a second request arrives
+	inTrial := make(chan struct{})
+	finish := make(chan struct{})
+	b.next = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		close(inTrial)
+		<-finish
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	done := make(chan error)
+	go func() { done <- get(b) }()
+
+	<-inTrial
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.ErrorIs(t, get(b), ErrCircuitOpen)
+
+	close(finish)
+	assert.NoError(t, <-done)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerIgnoresStaleResults(t *testing.T) {
+	b, up, clk := newTestBreaker()
+
+	// a slow request is let through while the breaker is still closed
+	inSlow := make(chan struct{})
+	finishSlow := make(chan struct{})
+	b.next = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.URL.Path == "/slow" {
+			close(inSlow)
+			<-finishSlow
+		}
+		return up.RoundTrip(r)
+	})
+	slow := make(chan error)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/slow", nil)
+		resp, err := b.RoundTrip(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		slow <- err
+	}()
+	<-inSlow
+
+	// the breaker opens and cools down, and a trial is let through, which
+	// finishes after the slow request
+	up.status = http.StatusInternalServerError
+	for i := 0; i < 3; i++ {
+		get(b)
+	}
+	require.Equal(t, StateOpen, b.State())
+	clk.Advance(time.Minute)
+
+	inTrial := make(chan struct{})
+	finishTrial := make(chan struct{})
+	b.next = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		close(inTrial)
+		<-finishTrial
+		return up.RoundTrip(r)
+	})
+	trial := make(chan error)
+	go func() { trial <- get(b) }()
+	<-inTrial
+
+	// the slow request succeeding says nothing about the trial
+	up.status = http.StatusOK
+	close(finishSlow)
+	assert.NoError(t, <-slow)
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.ErrorIs(t, get(b), ErrCircuitOpen, "the trial is still in flight")
+
+	up.status = http.StatusInternalServerError
+	close(finishTrial)
+	assert.NoError(t, <-trial)
+	assert.Equal(t, StateOpen, b.State(), "the trial failed")
+}
+
+func TestBreakerTrialPanics(t *testing.T) {
+	b, up, clk := newTestBreaker()
+	up.status = http.StatusInternalServerError
+	for i := 0; i < 3; i++ {
+		get(b)
+	}
+	clk.Advance(time.Minute)
+
+	b.next = roundTripFunc(func(r *http.Request) (*http.Response, error) { panic("boom") })
+	assert.Panics(t, func() { get(b) })
+	assert.Equal(t, StateOpen, b.State(), "a panic is a failed trial")
+
+	// and the next cool-down lets another trial through
+	b.next = up
+	up.status = http.StatusOK
+	clk.Advance(time.Minute)
+	assert.NoError(t, get(b))
+	assert.Equal(t, StateClosed, b.State())
+}
+
+// TestBreakerTransitionTable fires every event in every state. Anything not
+// listed has no transition at all
+func TestBreakerTransitionTable(t *testing.T) {
+	type want struct {
+		tripped, notTripped BreakerState // with the guards passing and failing
+	}
+	table := map[BreakerState]map[breakerEvent]want{
+		StateClosed: {
+			breakerSuccess: {StateClosed, StateClosed},
+			breakerFailure: {StateOpen, StateClosed},
+		},
+		StateOpen: {
+			breakerCooledDown: {StateHalfOpen, StateOpen},
+		},
+		StateHalfOpen: {
+			breakerSuccess: {StateClosed, StateClosed},
+			breakerFailure: {StateOpen, StateOpen},
+		},
+	}
+
+	for _, from := range []BreakerState{StateClosed, StateOpen, StateHalfOpen} {
+		for _, ev := range []breakerEvent{breakerSuccess, breakerFailure, breakerCooledDown} {
+			for _, guardsPass := range []bool{true, false} {
+				b, _, clk := newTestBreaker()
+				b.fsm = statemachine.NewMachine(breakerTable, from)
+				b.openedAt = clk.Now()
+				if guardsPass {
+					b.failures = b.threshold
+					clk.Advance(b.coolDown)
+				}
+
+				err := b.fsm.Fire(ev, b)
+				w, ok := table[from][ev]
+				switch {
+				case !ok:
+					assert.ErrorIs(t, err, statemachine.ErrInvalidTransition, "%s + %d", from, ev)
+					assert.Equal(t, from, b.State())
+				case guardsPass:
+					assert.NoError(t, err, "%s + %d", from, ev)
+					assert.Equal(t, w.tripped, b.State(), "%s + %d", from, ev)
+				default:
+					assert.Equal(t, w.notTripped, b.State(), "%s + %d with guards failing", from, ev)
+				}
+			}
+		}
+	}
+}
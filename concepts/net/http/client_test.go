@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/httputil"
+)
+
+// record sends TestClient to the real API and saves what came back over its
+// fixture, instead of replaying the fixture:
+//
+//	go test ./concepts/net/http -run TestClient -record
+var record = flag.Bool("record", false, "record testdata/jsonplaceholder.json from the real API instead of replaying it")
+
+// replay loads testdata/name
+func replay(t *testing.T, name string) *httputil.Cassette {
+	t.Helper()
+	c, err := httputil.LoadCassette(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := newClient()
+	if *record {
+		rec := httputil.NewRecorder(nil)
+		c.Transport = rec
+		t.Cleanup(func() {
+			require.NoError(t, rec.Cassette.Save(filepath.Join("testdata", "jsonplaceholder.json")))
+		})
+	} else {
+		c.Transport = replay(t, "jsonplaceholder.json").Transport()
+	}
+
+	resp := makeReq(c)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, todo{UserID: 1, ID: 1, Title: "delectus aut autem"}, parseJson(resp))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ *
+ * graceful shutdown and draining
+ *
+ */
+
+// Server.Shutdown stops listening, closes idle connections, and then waits for
+// active ones to go idle before returning - requests already being handled get
+// to finish. Two hooks let us watch that happen:
+//
+//   - ConnState is called every time a connection changes state: StateNew,
+//     StateActive (reading or handling a request), StateIdle (keep-alive,
+//     waiting for the next request), StateHijacked and StateClosed
+//   - RegisterOnShutdown adds functions that run when Shutdown starts, which is
+//     where anything the server can't close itself (websockets, hijacked
+//     connections) should be told to wrap up
+
+// connTracker counts connections by state, and requests in flight
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[net.Conn]http.ConnState
+
+	inFlight int64
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: map[net.Conn]http.ConnState{}}
+}
+
+// ConnState has the signature http.Server.ConnState wants
+func (t *connTracker) ConnState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		delete(t.conns, c)
+	default:
+		t.conns[c] = state
+	}
+}
+
+// Conns returns how many connections are active and idle
+func (t *connTracker) Conns() (active, idle int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.conns {
+		switch s {
+		case http.StateActive:
+			active++
+		case http.StateIdle:
+			idle++
+		}
+	}
+
+	return active, idle
+}
+
+// Middleware keeps the in-flight gauge up to date
+func (t *connTracker) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&t.inFlight, 1)
+		defer atomic.AddInt64(&t.inFlight, -1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (t *connTracker) InFlight() int64 {
+	return atomic.LoadInt64(&t.inFlight)
+}
+
+func newDrainingServer(addr string, h http.Handler) (*http.Server, *connTracker) {
+	t := newConnTracker()
+	s := &http.Server{
+		Addr:         addr,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  120 * time.Second,
+		Handler:      t.Middleware(h),
+		ConnState:    t.ConnState,
+	}
+	s.RegisterOnShutdown(func() {
+		log.Printf("shutting down, %d requests in flight", t.InFlight())
+	})
+
+	return s, t
+}
+
+// shutdownWithProgress calls Shutdown, logging what's left to drain every
+// interval until it's done or ctx expires. When ctx expires first, whatever
+// is still running is cut off with Close
+func shutdownWithProgress(ctx context.Context, s *http.Server, t *connTracker, interval time.Duration) error {
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(ctx) }()
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				s.Close()
+			}
+			return err
+		case <-tick.C:
+			active, idle := t.Conns()
+			log.Printf("draining: %d requests in flight, %d active and %d idle connections", t.InFlight(), active, idle)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	s, tracker := newDrainingServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.Write([]byte("finished"))
+	}))
+	shutdownStarted := make(chan struct{})
+	s.RegisterOnShutdown(func() { close(shutdownStarted) })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(l)
+	url := "http://" + l.Addr().String()
+
+	type result struct {
+		body string
+		err  error
+	}
+	got := make(chan result)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		got <- result{string(b), err}
+	}()
+
+	<-entered
+	assert.Equal(t, int64(1), tracker.InFlight())
+	active, _ := tracker.Conns()
+	assert.Equal(t, 1, active)
+
+	shutdown := make(chan error)
+	go func() { shutdown <- shutdownWithProgress(context.Background(), s, tracker, 10*time.Millisecond) }()
+	<-shutdownStarted
+
+	// no new connections are accepted while draining
+	assert.Eventually(t, func() bool {
+		_, err := net.Dial("tcp", l.Addr().String())
+		return err != nil
+	}, time.Second, 5*time.Millisecond)
+
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown returned with a request still in flight")
+	default:
+	}
+
+	close(release)
+	r := <-got
+	require.NoError(t, r.err)
+	assert.Equal(t, "finished", r.body)
+	assert.NoError(t, <-shutdown)
+	assert.Equal(t, int64(0), tracker.InFlight())
+}
+
+func TestShutdownDeadlineCutsOff(t *testing.T) {
+	entered := make(chan struct{})
+	s, tracker := newDrainingServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-r.Context().Done()
+	}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(l)
+
+	go http.Get("http://" + l.Addr().String())
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, shutdownWithProgress(ctx, s, tracker, 10*time.Millisecond), context.DeadlineExceeded)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/thorntonmc/go-practice/concepts/lru"
+)
+
+/*
+ *
+ * ETags and conditional requests
+ *
+ */
+
+// An ETag is an identifier for one version of a resource. The server sends it
+// in the ETag header, the client sends it back in If-None-Match next time, and
+// if it still matches the server answers 304 Not Modified with no body.
+//
+// A strong ETag ("abc") promises the bytes are identical, a weak one (W/"abc")
+// only that they're equivalent. Hashing the body gives us strong ones for free
+
+// ETag buffers the response of h, and sets a strong ETag made from the hash of
+// its body. GETs whose If-None-Match matches get a 304 instead of the body.
+//
+// A HEAD is handled as a GET and the body dropped afterwards. Handlers are
+// allowed to skip the body for HEAD, and hashing that empty body would give
+// HEAD a different ETag from the GET it's meant to describe
+func ETag(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		head := r.Method == http.MethodHead
+		if head {
+			r = r.Clone(r.Context())
+			r.Method = http.MethodGet
+		}
+		buf := &bufferedWriter{header: http.Header{}, status: http.StatusOK}
+		h.ServeHTTP(buf, r)
+
+		for k, v := range buf.header {
+			w.Header()[k] = v
+		}
+
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			if !head {
+				w.Write(buf.body.Bytes())
+			}
+			return
+		}
+
+		sum := sha256.Sum256(buf.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			// a 304 has no body, and shouldn't describe one either
+			w.Header().Del("Content-Length")
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if !head {
+			w.Write(buf.body.Bytes())
+		}
+	})
+}
+
+// If-None-Match can be "*" or a list of ETags, and uses the weak comparison -
+// W/"x" matches "x"
+func etagMatches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bufferedWriter is an http.ResponseWriter that writes nowhere, so the body can
+// be inspected before anything goes to the client
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedWriter) Header() http.Header         { return b.header }
+func (b *bufferedWriter) WriteHeader(status int)      { b.status = status }
+func (b *bufferedWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+// On the client side a conditional GET is just a header. notModified tells the
+// caller to keep using the copy they already have
+func conditionalGet(c *http.Client, url, etag string) (body []byte, newETag string, notModified bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, true, nil
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	return body, resp.Header.Get("ETag"), false, err
+}
+
+/*
+ *
+ * a caching transport
+ *
+ */
+
+// CachingTransport remembers GET responses that came with an ETag. The next
+// GET for the same URL is sent as a conditional request, and on a 304 the
+// cached response is handed back as if the server had sent it in full - the
+// caller never sees the 304. A HEAD is made conditional on the same entry,
+// and gets its headers back without the body. It holds at most
+// cachingTransportEntries responses, dropping the least recently used
+type CachingTransport struct {
+	next    http.RoundTripper
+	entries *lru.Cache[string, *cachedResponse]
+}
+
+const cachingTransportEntries = 1000
+
+type cachedResponse struct {
+	etag   string
+	status int
+	header http.Header
+	body   []byte
+}
+
+// NewCachingTransport wraps next, or http.DefaultTransport if it's nil
+func NewCachingTransport(next http.RoundTripper) *CachingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &CachingTransport{next: next, entries: lru.New[string, *cachedResponse](cachingTransportEntries)}
+}
+
+// Stats reports the cache's hits and misses. A hit here means a conditional
+// request was sent, not that the network was skipped
+func (c *CachingTransport) Stats() lru.Stats {
+	return c.entries.Stats()
+}
+
+func (c *CachingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return c.next.RoundTrip(r)
+	}
+
+	key := r.URL.String()
+	cached, _ := c.entries.Get(key)
+
+	if cached != nil && r.Header.Get("If-None-Match") == "" {
+		r = r.Clone(r.Context())
+		r.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := c.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		return cached.response(r), nil
+	}
+
+	// a HEAD has no body to cache
+	etag := resp.Header.Get("ETag")
+	if r.Method != http.MethodGet || resp.StatusCode != http.StatusOK || etag == "" {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	c.entries.Put(key, &cachedResponse{etag: etag, status: resp.StatusCode, header: resp.Header.Clone(), body: body})
+
+	// the body has been read, so the caller gets a fresh reader over the bytes
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// response rebuilds the cached response for r. Status is written the way
+// net/http's client fills it in, "200 OK", not just the text
+func (c *cachedResponse) response(r *http.Request) *http.Response {
+	var body io.ReadCloser = io.NopCloser(bytes.NewReader(c.body))
+	if r.Method == http.MethodHead {
+		body = http.NoBody
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.status, http.StatusText(c.status)),
+		StatusCode:    c.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.header.Clone(),
+		Body:          body,
+		ContentLength: int64(len(c.body)),
+		Request:       r,
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/lru"
+)
+
+func TestETagHandler(t *testing.T) {
+	h := ETag(http.HandlerFunc(helloWorldHandler))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "hello, world!", w.Body.String())
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{"matching", etag, http.StatusNotModified},
+		{"weak matches strong", "W/" + etag, http.StatusNotModified},
+		{"in a list", `"other", ` + etag, http.StatusNotModified},
+		{"wildcard", "*", http.StatusNotModified},
+		{"stale", `"other"`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+			assert.Equal(t, etag, w.Header().Get("ETag"))
+			if tt.want == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestETagHead(t *testing.T) {
+	// a handler that doesn't bother with the body for HEAD, as it may
+	h := ETag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if r.Method != http.MethodHead {
+			w.Write([]byte("hello, world!"))
+		}
+	}))
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/", nil))
+	head := httptest.NewRecorder()
+	h.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/", nil))
+
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, get.Header().Get("ETag"), head.Header().Get("ETag"))
+	assert.Empty(t, head.Body.String())
+
+	r := httptest.NewRequest(http.MethodHead, "/", nil)
+	r.Header.Set("If-None-Match", get.Header().Get("ETag"))
+	head = httptest.NewRecorder()
+	h.ServeHTTP(head, r)
+	assert.Equal(t, http.StatusNotModified, head.Code)
+}
+
+func TestETagSkipsErrors(t *testing.T) {
+	h := ETag(http.NotFoundHandler())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+}
+
+// countingETagServer counts full responses and 304s separately
+func countingETagServer(t *testing.T, body *atomic.Value) (*httptest.Server, *int32, *int32) {
+	var full, notModified int32
+	h := ETag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code == http.StatusNotModified {
+			atomic.AddInt32(&notModified, 1)
+		} else {
+			atomic.AddInt32(&full, 1)
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &full, &notModified
+}
+
+func TestConditionalGet(t *testing.T) {
+	var body atomic.Value
+	body.Store("v1")
+	srv, _, _ := countingETagServer(t, &body)
+	c := srv.Client()
+
+	got, etag, notModified, err := conditionalGet(c, srv.URL, "")
+	require.NoError(t, err)
+	assert.False(t, notModified)
+	assert.Equal(t, "v1", string(got))
+
+	_, _, notModified, err = conditionalGet(c, srv.URL, etag)
+	require.NoError(t, err)
+	assert.True(t, notModified)
+
+	body.Store("v2")
+	got, _, notModified, err = conditionalGet(c, srv.URL, etag)
+	require.NoError(t, err)
+	assert.False(t, notModified)
+	assert.Equal(t, "v2", string(got))
+}
+
+func TestCachingTransport(t *testing.T) {
+	var body atomic.Value
+	body.Store("v1")
+	srv, full, notModified := countingETagServer(t, &body)
+	c := &http.Client{Transport: NewCachingTransport(srv.Client().Transport)}
+
+	read := func() (int, string) {
+		resp, err := c.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	for i := 0; i < 3; i++ {
+		status, got := read()
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "v1", got)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(full))
+	assert.Equal(t, int32(2), atomic.LoadInt32(notModified))
+
+	body.Store("v2")
+	_, got := read()
+	assert.Equal(t, "v2", got)
+	assert.Equal(t, int32(2), atomic.LoadInt32(full))
+}
+
+func TestCachingTransportResponse(t *testing.T) {
+	var body atomic.Value
+	body.Store("v1")
+	srv, full, notModified := countingETagServer(t, &body)
+	c := &http.Client{Transport: NewCachingTransport(srv.Client().Transport)}
+
+	resp, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+
+	resp, err = c.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "200 OK", resp.Status, "a cached response looks like a real one")
+
+	// HEAD is conditional on the GET's entry, and comes back with its
+	// headers and no body
+	resp, err = c.Head(srv.URL)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "200 OK", resp.Status)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+	assert.Equal(t, int64(2), resp.ContentLength)
+	assert.Empty(t, b)
+	assert.Equal(t, int32(1), atomic.LoadInt32(full))
+	assert.Equal(t, int32(2), atomic.LoadInt32(notModified))
+}
+
+func TestCachingTransportEvictsOldest(t *testing.T) {
+	var body atomic.Value
+	body.Store("v1")
+	srv, full, notModified := countingETagServer(t, &body)
+
+	ct := NewCachingTransport(srv.Client().Transport)
+	ct.entries = lru.New[string, *cachedResponse](2)
+	c := &http.Client{Transport: ct}
+
+	get := func(path string) {
+		resp, err := c.Get(srv.URL + path)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	get("/a")
+	get("/b")
+	get("/a") // conditional, and makes /b the oldest
+	get("/c") // evicts /b
+	get("/a") // still cached
+	get("/b") // full fetch again, evicting /c
+
+	assert.Equal(t, int32(4), atomic.LoadInt32(full))
+	assert.Equal(t, int32(2), atomic.LoadInt32(notModified))
+	assert.Equal(t, uint64(2), ct.Stats().Hits)
+	assert.Equal(t, uint64(2), ct.Stats().Evictions)
+}
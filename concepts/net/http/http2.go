@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+/*
+ *
+ * HTTP/2
+ *
+ */
+
+// net/http speaks HTTP/2 out of the box, as long as the connection is TLS.
+// The protocol is agreed during the TLS handshake (ALPN), so an http.Server
+// started with ListenAndServeTLS, and an http.Client with the default
+// transport, will use HTTP/2 without any extra code
+func listenTLS(s *http.Server, certFile, keyFile string) {
+	err := s.ListenAndServeTLS(certFile, keyFile)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Which protocol was used for a request shows up in r.Proto on the server
+// and resp.Proto on the client, "HTTP/1.1" or "HTTP/2.0"
+func protoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.Proto))
+}
+
+// Cleartext HTTP/2, called h2c, is mostly used between services behind a load
+// balancer that has already terminated TLS. The standard library doesn't do it
+// on its own, golang.org/x/net/http2/h2c wraps a handler so it understands
+// both HTTP/1.1 and h2c on the same plain TCP port
+func newH2CServer() *http.Server {
+	return &http.Server{
+		Addr:         ":8000",
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  120 * time.Second,
+		Handler:      h2c.NewHandler(http.HandlerFunc(protoHandler), &http2.Server{}),
+	}
+}
+
+// The client side of h2c needs an http2.Transport told that plain http:// URLs
+// are fine, and a DialTLSContext that doesn't actually do any TLS
+func newH2CClient() *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// HTTP/2 multiplexes many requests over one connection as streams, so a
+// response that trickles out doesn't hold up anything else. Flushing after
+// each write sends a DATA frame straight away instead of waiting for the buffer
+// to fill up.
+//
+// http.Pusher was HTTP/2's server push, sending resources before the client
+// asked for them. Browsers have since dropped support and Go's own client
+// refuses pushes, so it's shown here only to recognize it in older code
+func streamHandler(ticks <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := w.(http.Pusher); ok {
+			p.Push("/style.css", nil)
+		}
+
+		f, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		// headers are only sent with the first write, flush them now so the
+		// client isn't left waiting for the first tick
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		f.Flush()
+
+		i := 0
+		for {
+			select {
+			case _, ok := <-ticks:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "tick %d\n", i)
+				f.Flush()
+				i++
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func getProto(t *testing.T, c *http.Client, url string) (string, string) {
+	resp, err := c.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.Proto, string(body)
+}
+
+func TestHTTP2OverTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(protoHandler))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	clientProto, serverProto := getProto(t, srv.Client(), srv.URL)
+	assert.Equal(t, "HTTP/2.0", clientProto)
+	assert.Equal(t, "HTTP/2.0", serverProto)
+}
+
+func TestH2C(t *testing.T) {
+	srv := httptest.NewServer(newH2CServer().Handler)
+	defer srv.Close()
+
+	clientProto, serverProto := getProto(t, newH2CClient(), srv.URL)
+	assert.Equal(t, "HTTP/2.0", clientProto)
+	assert.Equal(t, "HTTP/2.0", serverProto)
+
+	// the same port still speaks HTTP/1.1 to a normal client
+	clientProto, serverProto = getProto(t, srv.Client(), srv.URL)
+	assert.Equal(t, "HTTP/1.1", clientProto)
+	assert.Equal(t, "HTTP/1.1", serverProto)
+}
+
+func TestStreamingOverH2C(t *testing.T) {
+	ticks := make(chan struct{})
+	srv := httptest.NewServer(h2c.NewHandler(streamHandler(ticks), &http2.Server{}))
+	defer srv.Close()
+
+	resp, err := newH2CClient().Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+
+	// each line arrives before the next one is even written
+	r := bufio.NewReader(resp.Body)
+	for _, want := range []string{"tick 0\n", "tick 1\n", "tick 2\n"} {
+		ticks <- struct{}{}
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, want, line)
+	}
+
+	close(ticks)
+	rest, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Empty(t, rest)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/retry"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+/*
+ *
+ * long polling
+ *
+ */
+
+// Before websockets and server-sent events, the way to push to a browser was
+// the long poll: the client makes a request, and the server doesn't answer
+// until it has something to say. As soon as the client gets an answer it asks
+// again.
+//
+// The handler has to give up in three situations:
+//   - an event arrives, which it sends with a 200
+//   - the client goes away, which cancels r.Context()
+//   - it has waited maxWait, which it answers with 204 No Content so the
+//     client knows to just ask again. Without this, proxies and load balancers
+//     in between would eventually time the request out themselves
+func longPollHandler(events <-chan string, maxWait time.Duration, clk clock.Clock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case e := <-events:
+			w.Write([]byte(e))
+		case <-clk.After(maxWait):
+			w.WriteHeader(http.StatusNoContent)
+		case <-r.Context().Done():
+			// nobody is listening, there's no point writing anything
+		}
+	}
+}
+
+// pollLoop long-polls url until ctx is done, calling handle with every event.
+// A 204 is polled again straight away, errors back off exponentially so a
+// server that's down isn't hammered by every client at once. It never gives
+// up, so rather than retry.Retry it only borrows the policy's delays
+func pollLoop(ctx context.Context, c *http.Client, url string, handle func(string), clk clock.Clock) {
+	backoff := retry.Policy{Initial: 100 * time.Millisecond, Max: 10 * time.Second}
+	failures := 0
+
+	for {
+		event, ok, err := poll(ctx, c, url)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			failures++
+			select {
+			case <-clk.After(backoff.Delay(failures)):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		failures = 0
+		if ok {
+			handle(event)
+		}
+	}
+}
+
+// poll makes a single long-poll request. ok is false when the server timed out
+func poll(ctx context.Context, c *http.Client, url string) (event string, ok bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", false, err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err == nil, err
+	case http.StatusNoContent:
+		return "", false, nil
+	default:
+		return "", false, fmt.Errorf("polling %s: %s", url, resp.Status)
+	}
+}
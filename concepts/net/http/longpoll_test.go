@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+var epoch = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestLongPollDeliversEvent(t *testing.T) {
+	events := make(chan string)
+	h := longPollHandler(events, time.Minute, clock.NewFake(epoch))
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/poll", nil))
+		close(done)
+	}()
+
+	events <- "todo created"
+	<-done
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "todo created", w.Body.String())
+}
+
+func TestLongPollTimesOut(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	h := longPollHandler(make(chan string), time.Minute, clk)
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/poll", nil))
+		close(done)
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	<-done
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestLongPollClientGone(t *testing.T) {
+	h := longPollHandler(make(chan string), time.Minute, clock.NewFake(epoch))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/poll", nil).WithContext(ctx))
+		close(done)
+	}()
+
+	cancel()
+	<-done
+	assert.Empty(t, w.Body.String())
+}
+
+func TestPollLoopBacksOff(t *testing.T) {
+	// fail twice, then time out once, then deliver an event
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1, 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 3:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Write([]byte("todo created"))
+		}
+	}))
+	defer srv.Close()
+
+	clk := clock.NewFake(epoch)
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan string)
+	stopped := make(chan struct{})
+	go func() {
+		pollLoop(ctx, srv.Client(), srv.URL, func(e string) {
+			select {
+			case got <- e:
+			case <-ctx.Done():
+			}
+		}, clk)
+		close(stopped)
+	}()
+
+	// after the first failure it waits 100ms, after the second 200ms
+	clk.BlockUntil(1)
+	clk.Advance(99 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	clk.Advance(time.Millisecond)
+
+	clk.BlockUntil(1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	clk.Advance(200 * time.Millisecond)
+
+	// the 204 is retried straight away, no clock needed
+	assert.Equal(t, "todo created", <-got)
+
+	cancel()
+	<-stopped
+}
@@ -49,8 +49,7 @@ func newReq() *http.Request {
 // Headers firled of the instance. Once you're done, you can use the Do()
 // method on the http.Client with your http.Request which returns an
 // http.Response
-func makeReq() *http.Response {
-	c := newClient()
+func makeReq(c *http.Client) *http.Response {
 	req := newReq()
 	req.Header.Add("X-My-Client", "Learning Go")
 	resp, err := c.Do(req)
@@ -72,22 +71,25 @@ func handleResponse(r *http.Response) {
 	fmt.Printf("%d\n%s\n%s", code, codeText, contentType)
 }
 
+type todo struct {
+	UserID   int    `json:"userId"`
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Complete bool   `json:"completed"`
+}
+
 // Response bodies can be used json.Decoder to process REST API responses
-func parseJson(r *http.Response) {
+func parseJson(r *http.Response) todo {
 	// the response body is an io.ReadCloser, which means it can be used to parse json
 	body := r.Body
 
-	var data struct {
-		UserID   int    `json:"userId"`
-		ID       int    `json:"id"`
-		Title    string `json:"title"`
-		Complete bool   `json:"completed"`
-	}
-
+	var data todo
 	err := json.NewDecoder(body).Decode(&data)
 	if err != nil {
 		panic(err)
 	}
+
+	return data
 }
 
 /*
@@ -136,8 +138,8 @@ func (n NewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // Now that we have our server, we can make our handler
-func newServer() http.Server {
-	s := http.Server{
+func newServer() *http.Server {
+	s := &http.Server{
 		Addr:         ":8000",           // TCP address to listen. host:port - if not provided, listen on all hosts on port 80
 		ReadTimeout:  30 * time.Second,  // Time to wait to read request headers
 		WriteTimeout: 30 * time.Second,  // Time to wait for the write of the response
@@ -149,7 +151,8 @@ func newServer() http.Server {
 }
 
 // The ListenAndServeMethod starts the the HTTP server
-func listen(s http.Server) {
+// http.Server must not be copied once it's in use, so always pass it around as a pointer
+func listen(s *http.Server) {
 	err := s.ListenAndServe()
 	if err != nil {
 		panic(err)
@@ -362,3 +365,7 @@ func aliceWithMiddleWare() {
 //
 // which allows easy use of creating dynamic paths such as
 // /user/{user_id}/name
+
+func main() {
+	listen(newServer())
+}
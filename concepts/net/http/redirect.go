@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+)
+
+/*
+ *
+ * redirects and cookies
+ *
+ */
+
+// http.Client follows redirects on its own, up to 10 of them. CheckRedirect is
+// called before each one with the request about to be made and the requests
+// made so far (via, oldest first). Returning an error stops and Do returns it,
+// returning http.ErrUseLastResponse stops and Do returns the redirect response
+// itself, unfollowed
+
+// limitRedirects follows at most n redirects
+func limitRedirects(n int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > n {
+			return fmt.Errorf("stopped after %d redirects", n)
+		}
+		return nil
+	}
+}
+
+var errCrossHostCredentials = errors.New("refusing to follow a redirect to another host with credentials")
+
+// The client already drops Authorization and Cookie headers when a redirect
+// goes to an unrelated domain, but it still follows it. When the first request
+// carried credentials, noCrossHostCredentials refuses to leave the host at all -
+// a redirect elsewhere is more likely a mistake (or an attack) than something
+// we want to follow anonymously
+func noCrossHostCredentials(req *http.Request, via []*http.Request) error {
+	first := via[0]
+	if req.URL.Host != first.URL.Host && first.Header.Get("Authorization") != "" {
+		return errCrossHostCredentials
+	}
+	return nil
+}
+
+// redirectChain remembers every URL a client was redirected through.
+// Its CheckRedirect method can be used directly as the client's
+type redirectChain struct {
+	urls []string
+}
+
+func (c *redirectChain) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(c.urls) == 0 {
+		c.urls = append(c.urls, via[0].URL.String())
+	}
+	c.urls = append(c.urls, req.URL.String())
+
+	return limitRedirects(10)(req, via)
+}
+
+// http.Client has no cookie handling unless it's given a Jar. cookiejar is the
+// standard library's implementation, it stores cookies set by responses and
+// adds the matching ones to later requests - including the requests made while
+// following redirects, which is how a login that sets a cookie and redirects
+// to a profile page works
+func newJarClient() *http.Client {
+	// cookiejar.New only fails when given a broken PublicSuffixList
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Jar:     jar,
+	}
+}
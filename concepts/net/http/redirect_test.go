@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/httpmock"
+)
+
+// newRedirectServer redirects /a -> /b -> /c, and /loop to itself
+func newRedirectServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusFound))
+	mux.Handle("/b", http.RedirectHandler("/c", http.StatusMovedPermanently))
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("arrived"))
+	})
+	mux.Handle("/loop", http.RedirectHandler("/loop", http.StatusFound))
+
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/"})
+		http.Redirect(w, r, "/me", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(c.Value))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRedirectChain(t *testing.T) {
+	srv := newRedirectServer(t)
+	chain := &redirectChain{}
+	c := &http.Client{CheckRedirect: chain.CheckRedirect}
+
+	resp, err := c.Get(srv.URL + "/a")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Equal(t, "arrived", string(body))
+	assert.Equal(t, []string{srv.URL + "/a", srv.URL + "/b", srv.URL + "/c"}, chain.urls)
+}
+
+func TestLimitRedirects(t *testing.T) {
+	srv := newRedirectServer(t)
+	c := &http.Client{CheckRedirect: limitRedirects(3)}
+
+	_, err := c.Get(srv.URL + "/loop")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stopped after 3 redirects")
+
+	// ErrUseLastResponse hands back the redirect itself
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := c.Get(srv.URL + "/a")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/b", resp.Header.Get("Location"))
+}
+
+func TestNoCrossHostCredentials(t *testing.T) {
+	other := httpmock.New(t)
+	other.On(http.MethodGet, "/").Body("elsewhere")
+	bouncer := httptest.NewServer(http.RedirectHandler(other.URL+"/", http.StatusFound))
+	defer bouncer.Close()
+
+	c := &http.Client{CheckRedirect: noCrossHostCredentials}
+
+	req, _ := http.NewRequest(http.MethodGet, bouncer.URL, nil)
+	req.Header.Set("Authorization", "Bearer token")
+	_, err := c.Do(req)
+	assert.ErrorIs(t, err, errCrossHostCredentials)
+
+	// without credentials there's nothing to leak
+	resp, err := c.Get(bouncer.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	other.AssertCalled(http.MethodGet, "/", 1)
+}
+
+func TestCookieJar(t *testing.T) {
+	srv := newRedirectServer(t)
+
+	// without a jar the cookie set by /login is lost on the way to /me
+	resp, err := srv.Client().Get(srv.URL + "/login")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	c := newJarClient()
+	resp, err = c.Get(srv.URL + "/login")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "s3cr3t", string(body))
+
+	// and it's still there for later requests
+	u, _ := url.Parse(srv.URL)
+	require.Len(t, c.Jar.Cookies(u), 1)
+	resp, err = c.Get(srv.URL + "/me")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,189 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+ *
+ * zero downtime restarts
+ *
+ */
+
+// Draining (drain.go) lets a server stop without cutting anyone off, but
+// while the new version starts up nobody is listening, and connections in
+// that gap are refused. To deploy without the gap the new process has to be
+// accepting before the old one stops. Two ways to get there:
+//
+//   - SO_REUSEPORT: both processes bind the same port and the kernel spreads
+//     new connections between them. No coordination needed, but
+//     connections already queued on the old socket when it closes are reset,
+//     and it's not available everywhere
+//   - inheriting the socket: the old process starts the new one with its
+//     listening socket as an extra file descriptor. There's only ever one
+//     socket, so nothing queued on it is lost - whoever calls accept next gets
+//     it. This is what nginx, haproxy and systemd socket activation do
+//
+// This does the second. On SIGUSR2 (the nginx convention) the running server
+// starts a copy of itself with the listener as fd 3 and the write end of a
+// pipe as fd 4. The child serves on the inherited listener and writes to the
+// pipe once it's accepting. Only then does the parent stop accepting and
+// drain its in-flight requests - and if the child never says it's ready, the
+// parent carries on as if nothing happened
+
+const (
+	// inheritEnv tells a process it was started by restartChild, and
+	// should use fd 3 instead of listening itself
+	inheritEnv = "RESTART_INHERITED"
+
+	// the first three are stdin, stdout and stderr
+	listenerFD = 3
+	readyFD    = 4
+)
+
+// listenOrInherit returns the listener our parent passed down, or a new one
+// on addr when there's no parent
+func listenOrInherit(addr string) (net.Listener, error) {
+	if os.Getenv(inheritEnv) == "" {
+		return net.Listen("tcp", addr)
+	}
+
+	f := os.NewFile(listenerFD, "listener")
+	defer f.Close() // FileListener dups it, this copy isn't needed
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inheriting listener: %w", err)
+	}
+	return l, nil
+}
+
+// notifyReady tells the parent, if there is one, that we're accepting. It
+// runs once, later calls do nothing
+func notifyReady() error {
+	if os.Getenv(inheritEnv) == "" {
+		return nil
+	}
+	// unset it, so a restart of ours isn't confused and nothing writes to
+	// fd 4 twice
+	os.Unsetenv(inheritEnv)
+
+	f := os.NewFile(readyFD, "ready")
+	defer f.Close()
+	_, err := f.Write([]byte("ready\n"))
+	return err
+}
+
+// fileListener is a listener whose socket can be handed to a child process,
+// *net.TCPListener and *net.UnixListener both are
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+// restartChild starts path with args and l's socket, and waits up to
+// timeout for it to be ready. On any failure the child is killed, and the
+// caller should keep serving
+func restartChild(l net.Listener, path string, args []string, timeout time.Duration) (*os.Process, error) {
+	fl, ok := l.(fileListener)
+	if !ok {
+		return nil, fmt.Errorf("restart: %T can't be passed to a child", l)
+	}
+	// File returns a dup, closing it doesn't affect l
+	lf, err := fl.File()
+	if err != nil {
+		return nil, fmt.Errorf("restart: %w", err)
+	}
+	defer lf.Close()
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("restart: %w", err)
+	}
+	defer ready.Close()
+
+	p, err := os.StartProcess(path, args, &os.ProcAttr{
+		Env:   append(environWithout(inheritEnv), inheritEnv+"=1"),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr, lf, readyW},
+	})
+	// the child has its own copy now. Ours has to go, or a child that dies
+	// would never give us EOF
+	readyW.Close()
+	if err != nil {
+		return nil, fmt.Errorf("restart: %w", err)
+	}
+
+	ready.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, len("ready\n"))
+	if _, err := ready.Read(buf); err != nil {
+		p.Kill()
+		p.Wait()
+		return nil, fmt.Errorf("restart: child never became ready: %w", err)
+	}
+	return p, nil
+}
+
+func environWithout(key string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, key+"=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// serveWithRestart serves s on addr, or the listener it inherited, until a
+// signal arrives on stop or restart. A stop drains and returns. A restart
+// hands the listener to a new copy of this program first, and drains once
+// it's accepting; if that fails we keep serving and wait for the next signal
+func serveWithRestart(s *http.Server, t *connTracker, addr string, restart, stop <-chan os.Signal, drain time.Duration) error {
+	l, err := listenOrInherit(addr)
+	if err != nil {
+		return err
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	if err := notifyReady(); err != nil {
+		log.Printf("restart: telling the parent we're ready: %v", err)
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case err := <-served:
+			return err
+		case <-stop:
+		case <-restart:
+			p, err := restartChild(l, path, os.Args, 10*time.Second)
+			if err != nil {
+				log.Printf("%v, carrying on", err)
+				continue
+			}
+			log.Printf("restart: pid %d is serving, draining", p.Pid)
+			// the child isn't ours to wait for, it outlives us
+			p.Release()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), drain)
+		defer cancel()
+		err := shutdownWithProgress(ctx, s, t, time.Second)
+		if serr := <-served; !errors.Is(serr, http.ErrServerClosed) {
+			return serr
+		}
+		return err
+	}
+}
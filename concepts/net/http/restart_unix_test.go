@@ -0,0 +1,176 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// helperEnv makes the test binary run TestRestartHelper as a server rather
+// than a test, the trick os/exec's own tests use to get a child process
+// without building a second binary
+const helperEnv = "RESTART_HELPER"
+
+// TestRestartHelper is the server the restart test runs, and restarts
+func TestRestartHelper(t *testing.T) {
+	if os.Getenv(helperEnv) == "" {
+		t.Skip("run by TestZeroDowntimeRestart")
+	}
+
+	restart := make(chan os.Signal, 1)
+	signal.Notify(restart, syscall.SIGUSR2)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM)
+
+	pid := strconv.Itoa(os.Getpid())
+	s, tracker := newDrainingServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// long enough that a restart always catches some requests in flight
+		time.Sleep(5 * time.Millisecond)
+		io.WriteString(w, pid)
+	}))
+	if err := serveWithRestart(s, tracker, "", restart, stop, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestZeroDowntimeRestart keeps requests going while the server restarts,
+// and checks that none of them fail and that the new process took over.
+// The test plays the part of whatever started the first server - systemd,
+// say - and hands it a listener the same way a restart would
+func TestZeroDowntimeRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts processes")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lf, err := l.(*net.TCPListener).File()
+	require.NoError(t, err)
+	url := "http://" + l.Addr().String()
+	l.Close() // the socket stays open, lf has it
+
+	ready, readyW, err := os.Pipe()
+	require.NoError(t, err)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestartHelper$")
+	cmd.Env = append(os.Environ(), helperEnv+"=1", inheritEnv+"=1")
+	cmd.ExtraFiles = []*os.File{lf, readyW} // fds 3 and 4
+	cmd.Stderr = os.Stderr
+	require.NoError(t, cmd.Start())
+	lf.Close()
+	readyW.Close()
+	t.Cleanup(func() { cmd.Process.Kill() })
+
+	_, err = ready.Read(make([]byte, 16))
+	require.NoError(t, err, "server never became ready")
+	ready.Close()
+	parent := strconv.Itoa(cmd.Process.Pid)
+
+	var (
+		stopLoad = make(chan struct{})
+		wg       sync.WaitGroup
+		requests atomic.Int64
+
+		mu       sync.Mutex
+		failures []error
+		pids     = map[string]int{}
+	)
+	client := &http.Client{Timeout: 5 * time.Second}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stopLoad:
+					return
+				default:
+				}
+				resp, err := client.Get(url)
+				var body []byte
+				if err == nil {
+					body, err = io.ReadAll(resp.Body)
+					resp.Body.Close()
+				}
+				requests.Add(1)
+				mu.Lock()
+				if err != nil {
+					failures = append(failures, err)
+				} else {
+					pids[string(body)]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// let the load get going, restart, and keep it going until the parent
+	// has drained and gone
+	assert.Eventually(t, func() bool { return requests.Load() > 50 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, cmd.Process.Signal(syscall.SIGUSR2))
+	require.NoError(t, cmd.Wait(), "the old server exits cleanly once drained")
+	before := requests.Load()
+	assert.Eventually(t, func() bool { return requests.Load() > before+50 }, 5*time.Second, 10*time.Millisecond)
+	close(stopLoad)
+	wg.Wait()
+
+	assert.Empty(t, failures)
+	require.Len(t, pids, 2, "requests were answered by the old process and then the new one: %v", pids)
+	var child int
+	for pid := range pids {
+		if pid != parent {
+			child, _ = strconv.Atoi(pid)
+		}
+	}
+	t.Logf("%d requests, %v", requests.Load(), pids)
+
+	// the child isn't ours, it belongs to whoever reaps orphans, so the
+	// way to tell it's gone is that nobody answers
+	require.NoError(t, syscall.Kill(child, syscall.SIGTERM))
+	t.Cleanup(func() { syscall.Kill(child, syscall.SIGKILL) })
+	assert.Eventually(t, func() bool {
+		_, err := net.Dial("tcp", l.Addr().String())
+		return err != nil
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestRestartChildNeverReady(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+
+	start := time.Now()
+	_, err = restartChild(l, sh, []string{"sh", "-c", "exit 0"}, 10*time.Second)
+	assert.ErrorContains(t, err, "never became ready")
+	assert.Less(t, time.Since(start), 5*time.Second, "a child that exits is noticed straight away")
+
+	_, err = restartChild(l, sh, []string{"sh", "-c", "exec sleep 10"}, 50*time.Millisecond)
+	assert.ErrorContains(t, err, "never became ready", "one that hangs is killed")
+
+	_, err = restartChild(l, "/does/not/exist", nil, time.Second)
+	assert.Error(t, err)
+
+	// the listener is untouched by any of that
+	c, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	c.Close()
+}
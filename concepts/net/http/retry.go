@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/retry"
+	"github.com/thorntonmc/go-practice/pkg/idempotency"
+)
+
+/*
+ *
+ * retrying requests
+ *
+ */
+
+// RetryTransport retries requests that failed in a way worth retrying:
+// connection errors, and 429, 502, 503 and 504 responses. When a server sends
+// Retry-After, that's how long it waits; otherwise the retry.Policy's backoff
+// decides.
+//
+// Only requests that are safe to send twice are retried. GET, HEAD, OPTIONS,
+// PUT and DELETE are idempotent by definition; a POST is only retried if it
+// carries an Idempotency-Key, meaning the server will spot the repeat (see
+// pkg/idempotency). A request body has to be sent again each attempt, which
+// is what Request.GetBody is for - http.NewRequest sets it for the common
+// body types.
+//
+// Put it outside a CircuitBreaker, not inside - once the breaker opens,
+// ErrCircuitOpen isn't worth retrying and the retries stop hammering the
+// breaker too
+type RetryTransport struct {
+	next   http.RoundTripper
+	policy retry.Policy
+}
+
+// NewRetryTransport wraps next, http.DefaultTransport if nil
+func NewRetryTransport(next http.RoundTripper, policy retry.Policy) *RetryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = retryableRoundTripError
+	}
+	return &RetryTransport{next: next, policy: policy}
+}
+
+// statusError is a response worth retrying, turned into an error so
+// retry.Do will go round again
+type statusError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e statusError) Error() string             { return fmt.Sprintf("retryable status %d", e.status) }
+func (e statusError) RetryAfter() time.Duration { return e.retryAfter }
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func retryableRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	case http.MethodPost:
+		if r.Header.Get(idempotency.Header) == "" {
+			return false
+		}
+	default:
+		return false
+	}
+	return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+}
+
+// retryableRoundTripError retries bad statuses and transport errors, but not
+// an open breaker or the request's own context ending
+func retryableRoundTripError(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	return retry.Policy{}.ShouldRetry(err)
+}
+
+// parseRetryAfter handles the seconds form of Retry-After. The date form
+// is rare from APIs and falls back to the backoff
+func parseRetryAfter(h string) time.Duration {
+	secs, err := strconv.Atoi(h)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+func (t *RetryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !retryableRequest(r) {
+		return t.next.RoundTrip(r)
+	}
+
+	// the last retryable response is kept, so if every attempt gets a 503 the
+	// caller sees that 503 rather than an error
+	var last *http.Response
+	discard := func() {
+		if last != nil {
+			io.Copy(io.Discard, last.Body)
+			last.Body.Close()
+			last = nil
+		}
+	}
+
+	attempt := 0
+	resp, err := retry.Do(r.Context(), t.policy, func() (*http.Response, error) {
+		discard()
+		attempt++
+
+		req := r
+		if attempt > 1 && r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, retry.Permanent(err)
+			}
+			req = r.Clone(r.Context())
+			req.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if retryableStatus(resp.StatusCode) {
+			last = resp
+			return nil, statusError{resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After"))}
+		}
+		return resp, nil
+	})
+
+	if err != nil && last != nil && r.Context().Err() == nil {
+		return last, nil
+	}
+	discard()
+	return resp, err
+}
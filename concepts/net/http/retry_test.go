@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/httputil"
+	"github.com/thorntonmc/go-practice/concepts/retry"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"github.com/thorntonmc/go-practice/pkg/idempotency"
+)
+
+// scriptedUpstream answers with each status in turn, repeating the last, and
+// records the bodies it was sent
+type scriptedUpstream struct {
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header
+	bodies   []string
+}
+
+func (u *scriptedUpstream) RoundTrip(r *http.Request) (*http.Response, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	body := ""
+	if r.Body != nil {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}
+	u.bodies = append(u.bodies, body)
+
+	status := u.statuses[0]
+	if len(u.statuses) > 1 {
+		u.statuses = u.statuses[1:]
+	}
+	h := u.header
+	if h == nil {
+		h = http.Header{}
+	}
+	return &http.Response{StatusCode: status, Header: h, Body: io.NopCloser(strings.NewReader(http.StatusText(status)))}, nil
+}
+
+func (u *scriptedUpstream) calls() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.bodies)
+}
+
+var fastRetries = retry.Policy{Initial: time.Microsecond}
+
+func do(t *testing.T, rt http.RoundTripper, req *http.Request) (int, string) {
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(b)
+}
+
+// The cassettes replay a URL's responses in order and then repeat the last,
+// which is an upstream that's down for a while. Recording the replay counts
+// what was sent to it
+func TestRetryTransportRecovers(t *testing.T) {
+	up := httputil.NewRecorder(replay(t, "retry_recovers.json").Transport())
+	rt := NewRetryTransport(up, fastRetries)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	status, body := do(t, rt, req)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "OK", body)
+	assert.Len(t, up.Cassette.Interactions, 3)
+}
+
+func TestRetryTransportGivesUp(t *testing.T) {
+	up := httputil.NewRecorder(replay(t, "retry_gives_up.json").Transport())
+	rt := NewRetryTransport(up, retry.Policy{MaxAttempts: 4, Initial: time.Microsecond})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	status, body := do(t, rt, req)
+	assert.Equal(t, http.StatusServiceUnavailable, status, "the last response, not an error")
+	assert.Equal(t, "Service Unavailable", body)
+	assert.Len(t, up.Cassette.Interactions, 4)
+}
+
+func TestRetryTransportWhatIsRetried(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		key     string
+		status  int
+		retried bool
+	}{
+		{"get 503", http.MethodGet, "", 503, true},
+		{"get 429", http.MethodGet, "", 429, true},
+		{"get 500", http.MethodGet, "", 500, false},
+		{"get 404", http.MethodGet, "", 404, false},
+		{"put 503", http.MethodPut, "", 503, true},
+		{"post 503", http.MethodPost, "", 503, false},
+		{"post 503 with key", http.MethodPost, "k1", 503, true},
+		{"patch 503", http.MethodPatch, "", 503, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up := &scriptedUpstream{statuses: []int{tt.status, 200}}
+			rt := NewRetryTransport(up, fastRetries)
+
+			req, _ := http.NewRequest(tt.method, "http://example.com", strings.NewReader("payload"))
+			if tt.key != "" {
+				req.Header.Set(idempotency.Header, tt.key)
+			}
+			status, _ := do(t, rt, req)
+
+			if tt.retried {
+				assert.Equal(t, http.StatusOK, status)
+				assert.Equal(t, []string{"payload", "payload"}, up.bodies, "the body is sent again")
+			} else {
+				assert.Equal(t, tt.status, status)
+				assert.Equal(t, 1, up.calls())
+			}
+		})
+	}
+}
+
+func TestRetryTransportErrors(t *testing.T) {
+	errDial := errors.New("connection refused")
+	calls := 0
+	rt := NewRetryTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		if calls < 3 {
+			return nil, errDial
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}), fastRetries)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 3, calls)
+
+	// an open breaker isn't worth waiting on
+	calls = 0
+	rt = NewRetryTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return nil, ErrCircuitOpen
+	}), fastRetries)
+	_, err = rt.RoundTrip(req)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	up := &scriptedUpstream{statuses: []int{429, 200}, header: http.Header{"Retry-After": {"2"}}}
+	rt := NewRetryTransport(up, retry.Policy{Clock: clk})
+
+	done := make(chan int)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(1999 * time.Millisecond)
+	assert.Equal(t, 1, clk.Waiters(), "waits what the server asked, not the 100ms backoff")
+	clk.Advance(time.Millisecond)
+	assert.Equal(t, http.StatusOK, <-done)
+}
+
+func TestRetryTransportContextCancelled(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	up := &scriptedUpstream{statuses: []int{503}}
+	rt := NewRetryTransport(up, retry.Policy{Clock: clk})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+		_, err := rt.RoundTrip(req)
+		done <- err
+	}()
+
+	clk.BlockUntil(1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, 1, up.calls())
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+)
+
+/*
+ *
+ * server-sent events
+ *
+ */
+
+// Server-sent events are the simple way to push from server to browser: one
+// long GET that the server never finishes, writing events as they happen.
+// The browser's EventSource reconnects by itself if it drops. Each event is
+// "data:" lines ended by a blank line:
+//
+//	data: first line
+//	data: second line
+//
+// It only goes one way - for the browser to talk back, see the websocket
+// example.
+//
+// The handler subscribes to a topic on a pubsub.Bus, so whatever publishes to
+// it doesn't need to know how many browsers are connected. Subscriptions use
+// the Drop policy: a browser on a slow connection misses events rather than
+// holding up the publisher, and every other browser with it
+func sseHandler(bus *pubsub.Bus[string], topic string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+
+		sub := bus.Subscribe(topic, pubsub.WithBuffer(16))
+		defer sub.Unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return // can't stream through this ResponseWriter
+		}
+
+		for {
+			select {
+			case msg, ok := <-sub.C:
+				if !ok {
+					return // the bus was closed
+				}
+				if err := writeSSE(w, msg); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+// writeSSE writes one event. A newline in the data would end the field
+// early, so each line gets its own "data:" and the browser joins them back
+// up with newlines
+func writeSSE(w io.Writer, data string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
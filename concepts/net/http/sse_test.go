@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+)
+
+// readEvent reads "data:" lines up to the blank line ending an event
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestSSEBroadcast(t *testing.T) {
+	bus := pubsub.New[string]()
+	defer bus.Close()
+	srv := httptest.NewServer(sseHandler(bus, "todos"))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var streams []*bufio.Reader
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		streams = append(streams, bufio.NewReader(resp.Body))
+	}
+	require.Eventually(t, func() bool { return bus.Subscribers("todos") == 2 }, time.Second, time.Millisecond)
+
+	bus.Publish(ctx, "todos", "created")
+	bus.Publish(ctx, "todos", "two\nlines")
+	for _, s := range streams {
+		assert.Equal(t, []string{"data: created"}, readEvent(t, s))
+		assert.Equal(t, []string{"data: two", "data: lines"}, readEvent(t, s))
+	}
+
+	// disconnecting unsubscribes
+	cancel()
+	assert.Eventually(t, func() bool { return bus.Subscribers("todos") == 0 }, time.Second, time.Millisecond)
+}
+
+func TestSSEBusClosed(t *testing.T) {
+	bus := pubsub.New[string]()
+	srv := httptest.NewServer(sseHandler(bus, "todos"))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Eventually(t, func() bool { return bus.Subscribers("todos") == 1 }, time.Second, time.Millisecond)
+
+	bus.Close()
+	_, err = bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Error(t, err, "the stream ends")
+}
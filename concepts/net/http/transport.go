@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ *
+ * tuning the transport
+ *
+ */
+
+// http.Client does the redirects, cookies and timeouts, but the connections
+// themselves are managed by its Transport. The zero value of http.Client uses
+// http.DefaultTransport, which keeps at most 2 idle connections per host.
+// Under concurrent load to a single host that means most requests finish, find
+// the idle pool full, and close their connection - the next request then pays
+// for a new TCP (and TLS) handshake
+
+func newTunedTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+
+		// The total idle pool, and the part of it any single host may use.
+		// MaxIdleConnsPerHost is the one that matters when talking to one API
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 64,
+
+		// How long an idle connection stays in the pool before being closed.
+		// Keep this below the server's own idle timeout, or you'll pick up
+		// connections the server is about to close
+		IdleConnTimeout: 90 * time.Second,
+
+		// A custom DialContext turns off HTTP/2 unless you ask for it back
+		ForceAttemptHTTP2: true,
+
+		// By default the transport asks for gzip and transparently decompresses.
+		// Turn that off when the bodies are already compressed, or you want the
+		// raw bytes
+		DisableCompression: false,
+
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+func newTunedClient() *http.Client {
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: newTunedTransport(),
+	}
+}
+
+// httptrace lets us hook into the life of a single request - DNS, dialing,
+// TLS, and getting a connection out of the pool. connCounter uses GotConn to
+// count how many requests reused a pooled connection
+type connCounter struct {
+	created int64
+	reused  int64
+}
+
+// withConnCounter returns a context that reports every connection obtained for
+// a request made with it to c
+func withConnCounter(ctx context.Context, c *connCounter) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&c.reused, 1)
+				return
+			}
+			atomic.AddInt64(&c.created, 1)
+		},
+	})
+}
+
+func (c *connCounter) Created() int64 { return atomic.LoadInt64(&c.created) }
+func (c *connCounter) Reused() int64  { return atomic.LoadInt64(&c.reused) }
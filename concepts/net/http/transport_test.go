@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hammer makes n requests to url from workers goroutines
+func hammer(ctx context.Context, c *http.Client, url string, workers, n int) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	jobs := make(chan struct{})
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+				resp, err := c.Do(req)
+				if err != nil {
+					errs <- err
+					return
+				}
+				// the connection only goes back in the pool once the body has
+				// been read to the end and closed
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+func newHelloServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(helloWorldHandler))
+}
+
+func TestTunedTransportReusesConnections(t *testing.T) {
+	srv := newHelloServer()
+	defer srv.Close()
+
+	var cc connCounter
+	ctx := withConnCounter(context.Background(), &cc)
+	c := newTunedClient()
+
+	require.NoError(t, hammer(ctx, c, srv.URL, 8, 400))
+
+	// at most one connection per worker, everything else came from the pool
+	assert.LessOrEqual(t, cc.Created(), int64(8))
+	assert.Equal(t, int64(400), cc.Created()+cc.Reused())
+}
+
+// go test -bench Transport ./concepts/net/http shows the default transport
+// opening far more connections than the tuned one for the same load
+func BenchmarkTransport(b *testing.B) {
+	transports := map[string]func() http.RoundTripper{
+		"default": func() http.RoundTripper { return http.DefaultTransport.(*http.Transport).Clone() },
+		"tuned":   func() http.RoundTripper { return newTunedTransport() },
+	}
+
+	for name, newTransport := range transports {
+		b.Run(name, func(b *testing.B) {
+			srv := newHelloServer()
+			defer srv.Close()
+
+			tr := newTransport()
+			c := &http.Client{Transport: tr}
+			var cc connCounter
+			ctx := withConnCounter(context.Background(), &cc)
+
+			b.ResetTimer()
+			if err := hammer(ctx, c, srv.URL, 32, b.N); err != nil {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(cc.Created())/float64(b.N), "newconns/op")
+			tr.(interface{ CloseIdleConnections() }).CloseIdleConnections()
+		})
+	}
+}
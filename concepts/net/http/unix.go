@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+/*
+ *
+ * unix domain sockets
+ *
+ */
+
+// An http.Server doesn't care where its connections come from. ListenAndServe
+// is just net.Listen("tcp", addr) followed by Serve, and Serve takes any
+// net.Listener - including one on a unix socket. Daemons and sidecars use
+// these for local-only APIs (the Docker daemon is the famous one), access is
+// controlled with file permissions and nothing is exposed on the network
+
+// listenUnix serves s on the socket at path until the server is shut down
+func listenUnix(s *http.Server, path string) error {
+	l, err := unixListener(path)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+func unixListener(path string) (net.Listener, error) {
+	// the socket file outlives a crashed process, and listening fails with
+	// "address already in use" while it's there
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return net.Listen("unix", path)
+}
+
+// On the client side the transport still needs a URL to build requests from,
+// but DialContext ignores the address and always connects to the socket.
+// Requests are then made to any made-up host, e.g. http://unix/alive
+func newUnixClient(path string) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSocket(t *testing.T) {
+	// socket paths are limited to around 100 bytes, t.TempDir can be longer
+	dir, err := os.MkdirTemp("", "sock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "concept.sock")
+
+	// a stale file from a previous run is cleaned up
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+	s := &http.Server{Handler: http.HandlerFunc(helloWorldHandler)}
+	l, err := unixListener(path)
+	require.NoError(t, err)
+
+	served := make(chan error)
+	go func() { served <- s.Serve(l) }()
+
+	resp, err := newUnixClient(path).Get("http://unix/anything")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world!", string(body))
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.ErrorIs(t, <-served, http.ErrServerClosed)
+}
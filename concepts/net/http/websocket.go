@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+	"golang.org/x/net/websocket"
+)
+
+/*
+ *
+ * websockets
+ *
+ */
+
+// A websocket starts as an HTTP request that asks to be upgraded, then
+// becomes a two way connection carrying whole messages rather than a byte
+// stream. golang.org/x/net/websocket is the smallest implementation to learn
+// from; real projects mostly use github.com/coder/websocket or
+// github.com/gorilla/websocket, which do ping/pong, compression and close
+// codes properly.
+//
+// wsBroadcastHandler is a chat room: every message a client sends is
+// published to topic, and every client connected is sent everything
+// published there. Each connection has two loops - one reading from the
+// client, one writing to it - because a websocket can receive while it's
+// waiting to send and the other way round
+func wsBroadcastHandler(bus *pubsub.Bus[string], topic string) http.Handler {
+	return websocket.Handler(func(ws *websocket.Conn) {
+		sub := bus.Subscribe(topic, pubsub.WithBuffer(64))
+		defer sub.Unsubscribe()
+
+		go func() {
+			// when the client goes away, unsubscribing closes sub.C, which
+			// ends the write loop below and with it the handler
+			defer sub.Unsubscribe()
+			for {
+				var msg string
+				if err := websocket.Message.Receive(ws, &msg); err != nil {
+					return
+				}
+				bus.Publish(ws.Request().Context(), topic, msg)
+			}
+		}()
+
+		for msg := range sub.C {
+			if err := websocket.Message.Send(ws, msg); err != nil {
+				return
+			}
+		}
+	})
+}
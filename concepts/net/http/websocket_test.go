@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+	"golang.org/x/net/websocket"
+)
+
+func TestWebsocketBroadcast(t *testing.T) {
+	bus := pubsub.New[string]()
+	defer bus.Close()
+	srv := httptest.NewServer(wsBroadcastHandler(bus, "chat"))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	dial := func() *websocket.Conn {
+		ws, err := websocket.Dial(url, "", srv.URL)
+		require.NoError(t, err)
+		return ws
+	}
+
+	alice, bob := dial(), dial()
+	defer bob.Close()
+	require.Eventually(t, func() bool { return bus.Subscribers("chat") == 2 }, time.Second, time.Millisecond)
+
+	require.NoError(t, websocket.Message.Send(alice, "hi bob"))
+	for _, ws := range []*websocket.Conn{alice, bob} {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var got string
+		require.NoError(t, websocket.Message.Receive(ws, &got))
+		assert.Equal(t, "hi bob", got, "everyone gets it, the sender too")
+	}
+
+	// messages published elsewhere reach websocket clients as well
+	bus.Publish(context.Background(), "chat", "server notice")
+	var got string
+	bob.SetReadDeadline(time.Now().Add(time.Second))
+	require.NoError(t, websocket.Message.Receive(bob, &got))
+	assert.Equal(t, "server notice", got)
+
+	alice.Close()
+	assert.Eventually(t, func() bool { return bus.Subscribers("chat") == 1 }, time.Second, time.Millisecond)
+}
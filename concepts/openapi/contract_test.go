@@ -0,0 +1,244 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/apps/todo"
+	"github.com/thorntonmc/go-practice/pkg/golden"
+)
+
+// contractDoer sits between the generated client and the server, checking
+// every request against the spec on the way out and every response on the
+// way back. The tests then just use the client, and anything either side
+// does that the document doesn't allow fails them
+type contractDoer struct {
+	fail   func(format string, args ...any) // t.Errorf, normally
+	client *http.Client
+	router routers.Router
+	checks int
+}
+
+func newContractDoer(t *testing.T, client *http.Client) *contractDoer {
+	doc, err := Load(context.Background())
+	require.NoError(t, err)
+	router, err := legacy.NewRouter(doc)
+	require.NoError(t, err)
+	return &contractDoer{fail: t.Errorf, client: client, router: router}
+}
+
+func (d *contractDoer) Do(req *http.Request) (*http.Response, error) {
+	route, params, err := d.router.FindRoute(req)
+	if err != nil {
+		d.fail("%s %s isn't in the spec: %v", req.Method, req.URL.Path, err)
+		return d.client.Do(req)
+	}
+
+	in := &openapi3filter.RequestValidationInput{Request: req, PathParams: params, Route: route}
+	if err := openapi3filter.ValidateRequest(req.Context(), in); err != nil {
+		d.fail("request doesn't match the spec: %v", err)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	err = openapi3filter.ValidateResponse(req.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: in,
+		Status:                 resp.StatusCode,
+		Header:                 resp.Header,
+		Body:                   io.NopCloser(bytes.NewReader(body)),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	if err != nil {
+		d.fail("%s %s: response doesn't match the spec: %v\n%s", req.Method, req.URL.Path, err, body)
+	}
+	d.checks++
+	return resp, nil
+}
+
+func newClient(t *testing.T, h http.Handler) (*ClientWithResponses, *contractDoer) {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	doer := newContractDoer(t, srv.Client())
+	c, err := NewClientWithResponses(srv.URL, WithHTTPClient(doer))
+	require.NoError(t, err)
+	return c, doer
+}
+
+func TestSpecIsValid(t *testing.T) {
+	_, err := Load(context.Background())
+	require.NoError(t, err)
+}
+
+func TestContract(t *testing.T) {
+	var logs bytes.Buffer
+	c, doer := newClient(t, NewHandler(todo.NewMemoryRepository(), log.New(&logs, "", 0)))
+	ctx := context.Background()
+
+	created, err := c.CreateTodoWithResponse(ctx, NewTodo{Title: "write the spec"})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, created.StatusCode())
+	require.NotNil(t, created.JSON201)
+	assert.Equal(t, Todo{Id: 1, Title: "write the spec"}, *created.JSON201)
+	assert.Equal(t, "/todos/1", created.HTTPResponse.Header.Get("Location"))
+
+	done := true
+	updated, err := c.UpdateTodoWithApplicationMergePatchPlusJSONBodyWithResponse(ctx, 1, TodoPatch{Completed: &done})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, updated.StatusCode())
+	assert.Equal(t, Todo{Id: 1, Title: "write the spec", Completed: true}, *updated.JSON200)
+
+	got, err := c.GetTodoWithResponse(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, *updated.JSON200, *got.JSON200)
+
+	list, err := c.ListTodosWithResponse(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, list.JSON200)
+	assert.Len(t, *list.JSON200, 1)
+
+	deleted, err := c.DeleteTodoWithResponse(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, deleted.StatusCode())
+
+	missing, err := c.GetTodoWithResponse(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, missing.StatusCode())
+	require.NotNil(t, missing.JSON404)
+	assert.Equal(t, todo.ErrNotFound.Error(), missing.JSON404.Error)
+
+	assert.Equal(t, 6, doer.checks, "every call was checked")
+	assert.Empty(t, logs.String())
+}
+
+// The server's own checks answer in the spec's Error shape too. These
+// requests are invalid, so they go around the contract doer's request check
+func TestBadRequests(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(todo.NewMemoryRepository(), log.New(io.Discard, "", 0)))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name, method, path, contentType, body string
+		want                                  int
+	}{
+		{"blank title", http.MethodPost, "/todos", "application/json", `{"title": "  "}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/todos", "application/json", `{"title": "x", "priority": 1}`, http.StatusBadRequest},
+		{"id isn't a number", http.MethodGet, "/todos/abc", "", "", http.StatusBadRequest},
+		{"plain json patch", http.MethodPatch, "/todos/1", "application/json", `{}`, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			resp, err := srv.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.want, resp.StatusCode)
+			b, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(b), `"error":`)
+		})
+	}
+}
+
+// exchange is one request and its response, as TestWireGolden records them
+type exchange struct {
+	Request     string          `json:"request"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Location    string          `json:"location,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// TestWireGolden pins what the API looks like from outside - status codes,
+// headers, bodies - for a script of calls, good and bad. The contract test
+// says the responses fit the spec; this says which of the shapes the spec
+// allows they actually are, so a change to an error message or a field
+// shows up as a diff in testdata/wire.golden
+func TestWireGolden(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(todo.NewMemoryRepository(), log.New(io.Discard, "", 0)))
+	t.Cleanup(srv.Close)
+
+	script := []struct{ method, path, contentType, body string }{
+		{http.MethodPost, "/todos", "application/json", `{"title": "write the spec"}`},
+		{http.MethodPost, "/todos", "application/json", `{"title": "  "}`},
+		{http.MethodPatch, "/todos/1", "application/merge-patch+json", `{"completed": true}`},
+		{http.MethodPatch, "/todos/1", "application/json", `{}`},
+		{http.MethodGet, "/todos", "", ""},
+		{http.MethodGet, "/todos/abc", "", ""},
+		{http.MethodDelete, "/todos/1", "", ""},
+		{http.MethodGet, "/todos/1", "", ""},
+	}
+
+	var transcript []exchange
+	for _, step := range script {
+		req, err := http.NewRequest(step.method, srv.URL+step.path, strings.NewReader(step.body))
+		require.NoError(t, err)
+		if step.contentType != "" {
+			req.Header.Set("Content-Type", step.contentType)
+		}
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		transcript = append(transcript, exchange{
+			Request:     step.method + " " + step.path,
+			Status:      resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Location:    resp.Header.Get("Location"),
+			Body:        bytes.TrimSpace(body),
+		})
+	}
+
+	got, err := json.Marshal(transcript)
+	require.NoError(t, err)
+	golden.Assert(t, got, "wire.golden", golden.JSON())
+}
+
+// driftingServer is what the contract test is for catching: it compiles
+// against ServerInterface fine, but answers a shape the spec doesn't allow
+type driftingServer struct{ Unimplemented }
+
+func (driftingServer) GetTodo(w http.ResponseWriter, r *http.Request, id int64) {
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "name": "renamed the title field"})
+}
+
+func TestContractCatchesDrift(t *testing.T) {
+	c, doer := newClient(t, Handler(driftingServer{}))
+	var failures []string
+	doer.fail = func(format string, args ...any) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	_, err := c.GetTodoWithResponse(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, failures, 1)
+	assert.Contains(t, failures[0], "response doesn't match the spec")
+}
@@ -0,0 +1,205 @@
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/thorntonmc/go-practice/apps/todo"
+	jsonconcept "github.com/thorntonmc/go-practice/concepts/json"
+)
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -config oapi-codegen.yaml openapi.yaml
+
+// An OpenAPI document describes an HTTP API as data: the paths, what each
+// accepts and what it can answer, with JSON Schema for the bodies. It's
+// written once and everything else comes from it - docs, clients in other
+// languages, and here, Go code.
+//
+// This is the spec first way round. openapi.yaml is the source of truth,
+// and oapi-codegen (see the go:generate line above, and oapi-codegen.yaml
+// for what it's asked to produce) turns it into api.gen.go:
+//
+//   - a struct per schema - Todo, NewTodo, TodoPatch, Error
+//   - ServerInterface, one method per operation with the path parameters
+//     already parsed into their types. Server below implements it, and
+//     HandlerWithOptions routes requests to it (chi underneath)
+//   - a client, Client and the friendlier ClientWithResponses, which
+//     decodes each response into the struct for its status
+//
+// The generated code never gets edited - change the yaml and regenerate.
+// A field added to the spec and not to the server is then a compile error
+// rather than a surprise, though only as far as types go: the compiler
+// can't tell the server answers 201 where the spec says 200, or leaves out
+// a required field. The contract test checks that, by validating real
+// responses against the document
+//
+// The other way round, code first, generates the document from annotated
+// handlers. It's quicker to start, but the document ends up describing
+// whatever the code happens to do
+
+//go:embed openapi.yaml
+var spec []byte
+
+// Spec returns the OpenAPI document, as YAML
+func Spec() []byte { return spec }
+
+// Load parses and validates the document, ready for kin-openapi's request
+// and response validation
+func Load(ctx context.Context) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: loading spec: %w", err)
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("openapi: invalid spec: %w", err)
+	}
+	return doc, nil
+}
+
+// maxBodyBytes caps request bodies, as apps/todo does
+const maxBodyBytes = 64 << 10
+
+// Server implements the generated ServerInterface over a todo repository
+type Server struct {
+	repo todo.TodoRepository
+	log  *log.Logger
+}
+
+var _ ServerInterface = (*Server)(nil)
+
+func NewServer(repo todo.TodoRepository, logger *log.Logger) *Server {
+	return &Server{repo: repo, log: logger}
+}
+
+// NewHandler routes the spec's operations to a Server. A path parameter
+// that doesn't parse - /todos/abc - never reaches the Server, the
+// generated wrapper hands it to the error func instead
+func NewHandler(repo todo.TodoRepository, logger *log.Logger) http.Handler {
+	return HandlerWithOptions(NewServer(repo, logger), ChiServerOptions{
+		ErrorHandlerFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeJSON(w, http.StatusBadRequest, Error{Error: err.Error()})
+		},
+	})
+}
+
+func (s *Server) ListTodos(w http.ResponseWriter, r *http.Request) {
+	todos, err := s.repo.List(r.Context())
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	out := make([]Todo, len(todos))
+	for i, t := range todos {
+		out[i] = fromTodo(t)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) CreateTodo(w http.ResponseWriter, r *http.Request) {
+	body, err := jsonconcept.Decode[NewTodo](r.Body, jsonconcept.DisallowUnknownFields(), jsonconcept.MaxBytes(maxBodyBytes))
+	if err != nil {
+		jsonconcept.WriteDecodeError(w, err)
+		return
+	}
+
+	t := todo.Todo{Title: body.Title}
+	if body.Completed != nil {
+		t.Completed = *body.Completed
+	}
+	if err := t.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, Error{Error: err.Error()})
+		return
+	}
+	if t, err = s.repo.Create(r.Context(), t); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/todos/"+strconv.FormatInt(t.ID, 10))
+	writeJSON(w, http.StatusCreated, fromTodo(t))
+}
+
+func (s *Server) GetTodo(w http.ResponseWriter, r *http.Request, id int64) {
+	t, err := s.repo.Get(r.Context(), id)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, fromTodo(t))
+}
+
+// UpdateTodo applies a merge patch. TodoPatch's fields are pointers, so a
+// field left out of the body is nil and stays as it was
+func (s *Server) UpdateTodo(w http.ResponseWriter, r *http.Request, id int64) {
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/merge-patch+json" {
+		w.Header().Set("Accept-Patch", "application/merge-patch+json")
+		writeJSON(w, http.StatusUnsupportedMediaType, Error{Error: "patches must be application/merge-patch+json"})
+		return
+	}
+	patch, err := jsonconcept.Decode[TodoPatch](r.Body, jsonconcept.DisallowUnknownFields(), jsonconcept.MaxBytes(maxBodyBytes))
+	if err != nil {
+		jsonconcept.WriteDecodeError(w, err)
+		return
+	}
+
+	t, err := s.repo.Get(r.Context(), id)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if patch.Title != nil {
+		t.Title = *patch.Title
+	}
+	if patch.Completed != nil {
+		t.Completed = *patch.Completed
+	}
+	if err := t.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, Error{Error: err.Error()})
+		return
+	}
+	if err := s.repo.Update(r.Context(), t); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, fromTodo(t))
+}
+
+func (s *Server) DeleteTodo(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := s.repo.Delete(r.Context(), id); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fromTodo converts to the generated type. The two look alike, but keeping
+// them apart means the wire format is whatever the spec says, even if
+// todo.Todo grows fields or changes its tags
+func fromTodo(t todo.Todo) Todo {
+	return Todo{Id: t.ID, Title: t.Title, Completed: t.Completed}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with the spec's Error schema. Anything but a missing
+// todo is a 500, logged and not shown to the client
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, todo.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, Error{Error: err.Error()})
+		return
+	}
+	s.log.Printf("openapi: %s %s: %v", r.Method, r.URL.Path, err)
+	writeJSON(w, http.StatusInternalServerError, Error{Error: http.StatusText(http.StatusInternalServerError)})
+}
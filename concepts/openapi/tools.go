@@ -0,0 +1,7 @@
+//go:build tools
+
+package openapi
+
+// keeps oapi-codegen in go.mod, so the go:generate line runs the version
+// the generated code was made with
+import _ "github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen"
@@ -0,0 +1,207 @@
+package openapi
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// Generating code from the spec keeps the types honest, but it only goes
+// so far: nothing in api.gen.go stops a title of "" or an id of 0, even
+// though the schema says minLength 1 and minimum 1, and nothing checks
+// what the server sends back. Validate closes that gap at runtime, holding
+// every request, and optionally every response, up against the document
+// itself.
+//
+// Requests that don't match are answered straight away with a 400 that
+// lists every problem, before a handler sees them - so handlers can trust
+// their input's shape, and clients get the same errors whichever endpoint
+// they call:
+//
+//	{"error": "request doesn't match the API spec",
+//	 "problems": [{"in": "body", "field": "/title", "message": "minimum string length is 1"}]}
+//
+// Responses are a different matter. A response that breaks the contract is
+// a bug in the server, not something the client can fix, and it's already
+// been computed - so it's sent as it is, and the violation is logged for a
+// developer to see. Checking means buffering a copy of every body, which
+// is why it's meant for development and tests and is off by default
+
+func init() {
+	// kin-openapi only reads the content types it's told about, and merge
+	// patches are JSON
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.JSONBodyDecoder)
+}
+
+type ValidateOptions struct {
+	// Responses turns on checking responses too, logging any that don't
+	// match. Dev mode, in other words
+	Responses bool
+	// Log is where response violations go, log.Default() if nil
+	Log *log.Logger
+}
+
+// Problem is one way a request didn't match the spec
+type Problem struct {
+	In      string `json:"in"`              // body, path, query or header
+	Field   string `json:"field,omitempty"` // parameter name, or JSON pointer into the body
+	Message string `json:"message"`
+}
+
+// ValidationError is the 400 body
+type ValidationError struct {
+	Error    string    `json:"error"`
+	Problems []Problem `json:"problems"`
+}
+
+// Validate returns middleware checking traffic against doc. Paths the
+// document doesn't have get a 404, and methods it doesn't list a 405, so
+// the spec is also the routing table's allow list
+func Validate(doc *openapi3.T, opts ValidateOptions) (func(http.Handler) http.Handler, error) {
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	logger := opts.Log
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	filterOpts := &openapi3filter.Options{
+		MultiError: true, // report every problem, not just the first
+		// a status the spec doesn't list is a violation too. Operations
+		// with a default response allow any status, but then the body
+		// still has to be an Error
+		IncludeResponseStatus: true,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, params, err := router.FindRoute(r)
+			if err != nil {
+				if allow := allowed(router, r); len(allow) > 0 {
+					w.Header().Set("Allow", strings.Join(allow, ", "))
+					writeJSON(w, http.StatusMethodNotAllowed, Error{Error: http.StatusText(http.StatusMethodNotAllowed)})
+					return
+				}
+				writeJSON(w, http.StatusNotFound, Error{Error: http.StatusText(http.StatusNotFound)})
+				return
+			}
+
+			in := &openapi3filter.RequestValidationInput{Request: r, PathParams: params, Route: route, Options: filterOpts}
+			if err := openapi3filter.ValidateRequest(r.Context(), in); err != nil {
+				writeJSON(w, http.StatusBadRequest, ValidationError{
+					Error:    "request doesn't match the API spec",
+					Problems: problems(err),
+				})
+				return
+			}
+
+			if !opts.Responses {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &teeWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: in,
+				Status:                 rec.status,
+				Header:                 w.Header(),
+				Body:                   rec,
+				Options:                filterOpts,
+			})
+			if err != nil {
+				logger.Printf("openapi: response to %s %s breaks the spec: %v", r.Method, r.URL.Path, err)
+			}
+		})
+	}, nil
+}
+
+// allowed lists the methods the spec has for r's path. The legacy router
+// only tells a wrong method from a wrong path when the path has no
+// parameters, so this asks it again with each method instead
+func allowed(router routers.Router, r *http.Request) []string {
+	var allow []string
+	for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		probe := r.Clone(r.Context())
+		probe.Method = m
+		if _, _, err := router.FindRoute(probe); err == nil {
+			allow = append(allow, m)
+		}
+	}
+	return allow
+}
+
+// problems flattens kin-openapi's errors - a MultiError of RequestErrors,
+// each maybe wrapping a MultiError of SchemaErrors - into a flat list
+func problems(err error) []Problem {
+	var out []Problem
+
+	// a type switch rather than errors.As, since a RequestError unwraps to
+	// the MultiError inside it and As would skip straight past it
+	var walk func(err error, in, field string)
+	walk = func(err error, in, field string) {
+		switch e := err.(type) {
+		case openapi3.MultiError:
+			for _, err := range e {
+				walk(err, in, field)
+			}
+		case *openapi3filter.RequestError:
+			in, field := "body", ""
+			if e.Parameter != nil {
+				in, field = e.Parameter.In, e.Parameter.Name
+			}
+			if e.Err == nil {
+				out = append(out, Problem{In: in, Field: field, Message: e.Reason})
+				return
+			}
+			walk(e.Err, in, field)
+		case *openapi3.SchemaError:
+			if p := e.JSONPointer(); in == "body" && len(p) > 0 {
+				field = "/" + strings.Join(p, "/")
+			}
+			out = append(out, Problem{In: in, Field: field, Message: e.Reason})
+		default:
+			out = append(out, Problem{In: in, Field: field, Message: err.Error()})
+		}
+	}
+	walk(err, "", "")
+	return out
+}
+
+// teeWriter passes the response through as it's written, keeping a copy
+// of the body to check afterwards. The client isn't kept waiting for the
+// check, and a streaming response still streams
+type teeWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (t *teeWriter) WriteHeader(status int) {
+	if !t.wroteHeader {
+		t.status, t.wroteHeader = status, true
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *teeWriter) Write(b []byte) (int, error) {
+	t.wroteHeader = true
+	t.body.Write(b)
+	return t.ResponseWriter.Write(b)
+}
+
+// Read and Close make it the io.ReadCloser ResponseValidationInput wants
+func (t *teeWriter) Read(b []byte) (int, error) { return t.body.Read(b) }
+func (t *teeWriter) Close() error               { return nil }
+
+func (t *teeWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
@@ -0,0 +1,167 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/apps/todo"
+)
+
+func validated(t *testing.T, h http.Handler, opts ValidateOptions) http.Handler {
+	doc, err := Load(context.Background())
+	require.NoError(t, err)
+	mw, err := Validate(doc, opts)
+	require.NoError(t, err)
+	return mw(h)
+}
+
+func send(h http.Handler, method, path, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestValidateRequests(t *testing.T) {
+	reached := false
+	h := validated(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusNoContent)
+	}), ValidateOptions{})
+
+	tests := []struct {
+		name, method, path, contentType, body string
+		want                                  []Problem
+	}{
+		{
+			name: "blank title", method: http.MethodPost, path: "/todos",
+			contentType: "application/json", body: `{"title": ""}`,
+			want: []Problem{{In: "body", Field: "/title", Message: "minimum string length is 1"}},
+		},
+		{
+			name: "every problem at once", method: http.MethodPost, path: "/todos",
+			contentType: "application/json", body: `{"completed": "yes", "priority": 1}`,
+			want: []Problem{
+				{In: "body", Field: "/title", Message: `property "title" is missing`},
+				{In: "body", Field: "/completed", Message: `value must be a boolean`},
+				{In: "body", Message: `property "priority" is unsupported`},
+			},
+		},
+		{
+			name: "id below minimum", method: http.MethodGet, path: "/todos/0",
+			want: []Problem{{In: "path", Field: "id", Message: "number must be at least 1"}},
+		},
+		{
+			name: "id not a number", method: http.MethodDelete, path: "/todos/abc",
+			want: []Problem{{In: "path", Field: "id", Message: `value abc: an invalid integer: invalid syntax`}},
+		},
+		{
+			name: "wrong content type", method: http.MethodPatch, path: "/todos/1",
+			contentType: "text/plain", body: `hello`,
+			want: []Problem{{In: "body", Message: `header Content-Type has unexpected value "text/plain"`}},
+		},
+		{
+			name: "missing body", method: http.MethodPost, path: "/todos",
+			want: []Problem{{In: "body", Message: "value is required but missing"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			w := send(h, tt.method, tt.path, tt.contentType, tt.body)
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.False(t, reached, "the handler never sees an invalid request")
+
+			var got ValidationError
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equal(t, "request doesn't match the API spec", got.Error)
+			assert.ElementsMatch(t, tt.want, got.Problems)
+		})
+	}
+
+	t.Run("not in the spec", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send(h, http.MethodGet, "/users", "", "").Code)
+
+		w := send(h, http.MethodPut, "/todos/1", "application/json", `{}`)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "GET, PATCH, DELETE", w.Header().Get("Allow"))
+		assert.False(t, reached)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		w := send(h, http.MethodPatch, "/todos/1", "application/merge-patch+json", `{"completed": true}`)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.True(t, reached)
+	})
+}
+
+// the body survives being validated, so the handler can still read it
+func TestValidatePreservesBody(t *testing.T) {
+	var got string
+	h := validated(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}), ValidateOptions{})
+
+	send(h, http.MethodPost, "/todos", "application/json", `{"title": "x"}`)
+	assert.JSONEq(t, `{"title": "x"}`, got)
+}
+
+func TestValidateResponses(t *testing.T) {
+	drifting := Handler(driftingServer{})
+
+	t.Run("dev mode logs violations", func(t *testing.T) {
+		var logs bytes.Buffer
+		h := validated(t, drifting, ValidateOptions{Responses: true, Log: log.New(&logs, "", 0)})
+
+		w := send(h, http.MethodGet, "/todos/1", "", "")
+		assert.Equal(t, http.StatusOK, w.Code, "the response still goes out")
+		assert.Contains(t, w.Body.String(), "renamed the title field")
+		assert.Contains(t, logs.String(), "openapi: response to GET /todos/1 breaks the spec")
+		assert.Contains(t, logs.String(), `property "title" is missing`)
+	})
+
+	t.Run("errors have a shape too", func(t *testing.T) {
+		var logs bytes.Buffer
+		h := validated(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"message": "boom"})
+		}), ValidateOptions{Responses: true, Log: log.New(&logs, "", 0)})
+
+		send(h, http.MethodDelete, "/todos/1", "", "")
+		assert.Contains(t, logs.String(), `property "error" is missing`)
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		var logs bytes.Buffer
+		h := validated(t, drifting, ValidateOptions{Log: log.New(&logs, "", 0)})
+
+		assert.Equal(t, http.StatusOK, send(h, http.MethodGet, "/todos/1", "", "").Code)
+		assert.Empty(t, logs.String())
+	})
+
+	t.Run("the real server passes", func(t *testing.T) {
+		var logs bytes.Buffer
+		h := validated(t, NewHandler(todo.NewMemoryRepository(), log.New(io.Discard, "", 0)),
+			ValidateOptions{Responses: true, Log: log.New(&logs, "", 0)})
+
+		require.Equal(t, http.StatusCreated, send(h, http.MethodPost, "/todos", "application/json", `{"title": "x"}`).Code)
+		require.Equal(t, http.StatusOK, send(h, http.MethodPatch, "/todos/1", "application/merge-patch+json", `{"completed": true}`).Code)
+		require.Equal(t, http.StatusOK, send(h, http.MethodGet, "/todos", "", "").Code)
+		require.Equal(t, http.StatusNotFound, send(h, http.MethodGet, "/todos/2", "", "").Code)
+		require.Equal(t, http.StatusNoContent, send(h, http.MethodDelete, "/todos/1", "", "").Code)
+		assert.Empty(t, logs.String())
+	})
+}
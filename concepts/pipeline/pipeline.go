@@ -0,0 +1,259 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// A pipeline is a chain of stages connected by channels: a generator produces
+// values, transforms turn them into other values, and a sink consumes them.
+// Each stage runs in its own goroutine(s), so they all work at the same time.
+//
+// Three things make one well behaved:
+//
+//   - bounded buffers: every channel has a fixed capacity, so a slow stage
+//     makes the ones before it block rather than piling up values in memory.
+//     That's backpressure
+//   - teardown: when any stage fails, every other stage has to stop, or the
+//     goroutines leak blocked on a channel nobody reads. errgroup cancels a
+//     shared context on the first error, and every send and receive below
+//     selects on it
+//   - Wait: the caller waits for every goroutine to exit and gets the first error
+
+// Pipeline holds the stages' goroutines. Go doesn't allow type parameters on
+// methods, so the stages are functions that take the Pipeline, rather than
+// methods on it
+type Pipeline struct {
+	g   *errgroup.Group
+	ctx context.Context
+}
+
+// New returns a pipeline whose stages stop when ctx is done or any stage fails
+func New(ctx context.Context) *Pipeline {
+	g, ctx := errgroup.WithContext(ctx)
+	return &Pipeline{g: g, ctx: ctx}
+}
+
+// Wait blocks until every stage has finished, and returns the first error
+func (p *Pipeline) Wait() error {
+	return p.g.Wait()
+}
+
+// send is the one way values move between stages. It gives up when the
+// pipeline is being torn down, instead of blocking forever
+func send[T any](ctx context.Context, ch chan<- T, v T) error {
+	select {
+	case ch <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ErrBadStage is what Wait returns when a stage was built with fewer than one
+// worker or a negative buffer. Zero workers would never read in, and
+// MapOrdered's queue would have no room, so nothing would ever move
+var ErrBadStage = errors.New("pipeline: stage needs at least 1 worker and a buffer of at least 0")
+
+// checkStage fails the pipeline if a stage's workers or buf can't work, and
+// reports whether it did. The stages return channels rather than errors, so
+// the error goes to Wait, and the stage hands back a closed channel so
+// whatever reads from it stops
+func checkStage[T any](p *Pipeline, name string, workers, buf int) (<-chan T, bool) {
+	if workers >= 1 && buf >= 0 {
+		return nil, true
+	}
+	err := fmt.Errorf("%s with %d workers and buffer %d: %w", name, workers, buf, ErrBadStage)
+	p.g.Go(func() error { return err })
+	out := make(chan T)
+	close(out)
+	return out, false
+}
+
+/*
+ *
+ * generators
+ *
+ */
+
+// Generate calls next until it returns false or an error, sending each value
+// on the returned channel, which holds at most buf values
+func Generate[T any](p *Pipeline, buf int, next func() (T, bool, error)) <-chan T {
+	if closed, ok := checkStage[T](p, "Generate", 1, buf); !ok {
+		return closed
+	}
+	out := make(chan T, buf)
+
+	p.g.Go(func() error {
+		defer close(out)
+		for {
+			v, ok, err := next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			if err := send(p.ctx, out, v); err != nil {
+				return err
+			}
+		}
+	})
+
+	return out
+}
+
+// FromSlice generates the values in items, in order
+func FromSlice[T any](p *Pipeline, buf int, items []T) <-chan T {
+	i := 0
+	return Generate(p, buf, func() (T, bool, error) {
+		if i == len(items) {
+			var zero T
+			return zero, false, nil
+		}
+		i++
+		return items[i-1], true, nil
+	})
+}
+
+/*
+ *
+ * transforms
+ *
+ */
+
+// Map applies fn to every value, one at a time
+func Map[In, Out any](p *Pipeline, in <-chan In, buf int, fn func(context.Context, In) (Out, error)) <-chan Out {
+	return MapUnordered(p, in, 1, buf, fn)
+}
+
+// MapUnordered fans fn out across workers goroutines. Results are sent as soon
+// as they're ready, so they come out in whatever order the workers finish
+func MapUnordered[In, Out any](p *Pipeline, in <-chan In, workers, buf int, fn func(context.Context, In) (Out, error)) <-chan Out {
+	if closed, ok := checkStage[Out](p, "MapUnordered", workers, buf); !ok {
+		return closed
+	}
+	out := make(chan Out, buf)
+	done := make(chan struct{})
+
+	for w := 0; w < workers; w++ {
+		p.g.Go(func() error {
+			defer func() { done <- struct{}{} }()
+			for v := range in {
+				r, err := fn(p.ctx, v)
+				if err != nil {
+					return err
+				}
+				if err := send(p.ctx, out, r); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	// out can only be closed once every worker is done with it
+	p.g.Go(func() error {
+		for w := 0; w < workers; w++ {
+			<-done
+		}
+		close(out)
+		return nil
+	})
+
+	return out
+}
+
+// MapOrdered fans fn out across workers goroutines, but sends results in the
+// same order their inputs arrived.
+//
+// Every input gets its own result channel, and those channels are queued in
+// input order. The workers fill them in any order, and a collector drains the
+// queue front to back, waiting on each one in turn. The queue's capacity bounds
+// how far ahead of the slowest item the workers can get
+func MapOrdered[In, Out any](p *Pipeline, in <-chan In, workers, buf int, fn func(context.Context, In) (Out, error)) <-chan Out {
+	type job struct {
+		v      In
+		result chan Out
+	}
+
+	if closed, ok := checkStage[Out](p, "MapOrdered", workers, buf); !ok {
+		return closed
+	}
+	out := make(chan Out, buf)
+	jobs := make(chan job)
+	queue := make(chan chan Out, workers)
+
+	p.g.Go(func() error {
+		defer close(jobs)
+		defer close(queue)
+		for v := range in {
+			j := job{v: v, result: make(chan Out, 1)}
+			if err := send(p.ctx, queue, j.result); err != nil {
+				return err
+			}
+			if err := send(p.ctx, jobs, j); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	for w := 0; w < workers; w++ {
+		p.g.Go(func() error {
+			for j := range jobs {
+				r, err := fn(p.ctx, j.v)
+				if err != nil {
+					return err
+				}
+				j.result <- r
+			}
+			return nil
+		})
+	}
+
+	p.g.Go(func() error {
+		defer close(out)
+		for result := range queue {
+			select {
+			case r := <-result:
+				if err := send(p.ctx, out, r); err != nil {
+					return err
+				}
+			case <-p.ctx.Done():
+				return p.ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return out
+}
+
+/*
+ *
+ * sinks
+ *
+ */
+
+// ForEach calls fn with every value that reaches the end of the pipeline
+func ForEach[T any](p *Pipeline, in <-chan T, fn func(T) error) {
+	p.g.Go(func() error {
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return nil
+				}
+				if err := fn(v); err != nil {
+					return err
+				}
+			case <-p.ctx.Done():
+				return p.ctx.Err()
+			}
+		}
+	})
+}
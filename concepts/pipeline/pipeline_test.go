@@ -0,0 +1,221 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func double(_ context.Context, n int) (int, error) { return n * 2, nil }
+
+func ints(n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = i
+	}
+	return out
+}
+
+func collect[T any](p *Pipeline, in <-chan T) *[]T {
+	var out []T
+	ForEach(p, in, func(v T) error {
+		out = append(out, v)
+		return nil
+	})
+	return &out
+}
+
+func TestMap(t *testing.T) {
+	p := New(context.Background())
+	got := collect(p, Map(p, FromSlice(p, 2, ints(5)), 2, double))
+
+	assert.NoError(t, p.Wait())
+	assert.Equal(t, []int{0, 2, 4, 6, 8}, *got)
+}
+
+func TestMapOrderedKeepsOrder(t *testing.T) {
+	// make the early items the slowest, so workers finish out of order
+	slowFirst := func(_ context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(10-n%10) * time.Millisecond / 10)
+		return n * 2, nil
+	}
+
+	p := New(context.Background())
+	got := collect(p, MapOrdered(p, FromSlice(p, 4, ints(100)), 8, 4, slowFirst))
+
+	assert.NoError(t, p.Wait())
+	want := make([]int, 100)
+	for i := range want {
+		want[i] = i * 2
+	}
+	assert.Equal(t, want, *got)
+}
+
+func TestMapUnorderedDeliversEverything(t *testing.T) {
+	p := New(context.Background())
+	got := collect(p, MapUnordered(p, FromSlice(p, 4, ints(100)), 8, 4, double))
+
+	assert.NoError(t, p.Wait())
+	sort.Ints(*got)
+	assert.Len(t, *got, 100)
+	assert.Equal(t, 198, (*got)[99])
+}
+
+func TestBadStage(t *testing.T) {
+	tests := []struct {
+		name  string
+		stage func(p *Pipeline, in <-chan int) <-chan int
+	}{
+		{"ordered, no workers", func(p *Pipeline, in <-chan int) <-chan int { return MapOrdered(p, in, 0, 1, double) }},
+		{"unordered, no workers", func(p *Pipeline, in <-chan int) <-chan int { return MapUnordered(p, in, 0, 1, double) }},
+		{"negative workers", func(p *Pipeline, in <-chan int) <-chan int { return MapOrdered(p, in, -1, 1, double) }},
+		{"negative buffer", func(p *Pipeline, in <-chan int) <-chan int { return Map(p, in, -1, double) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a deadlock would hang here rather than fail, so Wait runs
+			// with a generous limit
+			p := New(context.Background())
+			got := collect(p, tt.stage(p, FromSlice(p, 0, ints(10))))
+
+			errc := make(chan error)
+			go func() { errc <- p.Wait() }()
+			select {
+			case err := <-errc:
+				assert.ErrorIs(t, err, ErrBadStage)
+			case <-time.After(5 * time.Second):
+				t.Fatal("pipeline deadlocked")
+			}
+			assert.Empty(t, *got)
+		})
+	}
+
+	p := New(context.Background())
+	collect(p, FromSlice(p, -1, ints(10)))
+	assert.ErrorIs(t, p.Wait(), ErrBadStage)
+}
+
+func TestErrorTearsDownPipeline(t *testing.T) {
+	boom := errors.New("boom")
+
+	for name, stage := range map[string]func(*Pipeline, <-chan int, int, int, func(context.Context, int) (int, error)) <-chan int{
+		"ordered":   MapOrdered[int, int],
+		"unordered": MapUnordered[int, int],
+	} {
+		t.Run(name, func(t *testing.T) {
+			// an endless generator, which only stops because of the teardown
+			var produced int64
+			p := New(context.Background())
+			src := Generate(p, 1, func() (int, bool, error) {
+				return int(atomic.AddInt64(&produced, 1)), true, nil
+			})
+			mapped := stage(p, src, 4, 1, func(_ context.Context, n int) (int, error) {
+				if n == 50 {
+					return 0, boom
+				}
+				return n, nil
+			})
+			ForEach(p, mapped, func(int) error { return nil })
+
+			// Wait only returns once every goroutine has exited
+			assert.ErrorIs(t, p.Wait(), boom)
+		})
+	}
+}
+
+func TestSinkErrorTearsDownPipeline(t *testing.T) {
+	boom := errors.New("sink full")
+	p := New(context.Background())
+
+	src := Generate(p, 0, func() (int, bool, error) { return 1, true, nil })
+	n := 0
+	ForEach(p, Map(p, src, 0, double), func(int) error {
+		n++
+		if n == 10 {
+			return boom
+		}
+		return nil
+	})
+
+	assert.ErrorIs(t, p.Wait(), boom)
+}
+
+func TestParentCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx)
+
+	src := Generate(p, 0, func() (int, bool, error) { return 1, true, nil })
+	seen := make(chan struct{})
+	ForEach(p, src, func(int) error {
+		select {
+		case seen <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	<-seen
+	cancel()
+	assert.ErrorIs(t, p.Wait(), context.Canceled)
+}
+
+func TestBackpressure(t *testing.T) {
+	var produced int64
+	p := New(context.Background())
+	src := Generate(p, 3, func() (int, bool, error) {
+		return int(atomic.AddInt64(&produced, 1)), true, nil
+	})
+	mapped := Map(p, src, 3, double)
+
+	block := make(chan struct{})
+	ForEach(p, mapped, func(int) error {
+		<-block
+		return errors.New("stop")
+	})
+
+	// the sink holds one value, each buffer holds 3, the mapper holds one
+	// while it's blocked sending, and the generator one more - then everything stalls
+	const bound = 1 + 3 + 1 + 3 + 1
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&produced) == bound }, time.Second, time.Millisecond)
+	assert.Never(t, func() bool { return atomic.LoadInt64(&produced) > bound }, 20*time.Millisecond, time.Millisecond)
+
+	close(block)
+	assert.Error(t, p.Wait())
+}
+
+func BenchmarkPipeline(b *testing.B) {
+	work := func(_ context.Context, n int) (int, error) {
+		x := n
+		for i := 0; i < 1000; i++ {
+			x = x*31 + i
+		}
+		return x, nil
+	}
+
+	stages := map[string]func(*Pipeline, <-chan int) <-chan int{
+		"serial":    func(p *Pipeline, in <-chan int) <-chan int { return Map(p, in, 64, work) },
+		"ordered":   func(p *Pipeline, in <-chan int) <-chan int { return MapOrdered(p, in, 8, 64, work) },
+		"unordered": func(p *Pipeline, in <-chan int) <-chan int { return MapUnordered(p, in, 8, 64, work) },
+	}
+
+	for name, stage := range stages {
+		b.Run(name, func(b *testing.B) {
+			i := 0
+			p := New(context.Background())
+			src := Generate(p, 64, func() (int, bool, error) {
+				i++
+				return i, i <= b.N, nil
+			})
+			ForEach(p, stage(p, src), func(int) error { return nil })
+			if err := p.Wait(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
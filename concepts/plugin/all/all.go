@@ -0,0 +1,11 @@
+// Package all compiles in every middleware under concepts/plugin/ext. A
+// program that only wants some imports those instead
+//
+//	import _ "github.com/thorntonmc/go-practice/concepts/plugin/all"
+package all
+
+import (
+	_ "github.com/thorntonmc/go-practice/concepts/plugin/ext/headers"
+	_ "github.com/thorntonmc/go-practice/concepts/plugin/ext/requestid"
+	_ "github.com/thorntonmc/go-practice/concepts/plugin/ext/timeout"
+)
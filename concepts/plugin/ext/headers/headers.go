@@ -0,0 +1,35 @@
+// Package headers registers the "headers" middleware, which sets fixed
+// response headers - every option is a header name and its value
+package headers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thorntonmc/go-practice/concepts/plugin"
+)
+
+func init() {
+	plugin.RegisterMiddleware("headers", "sets fixed response headers, one per option", New)
+}
+
+// New takes any options, there's no knowing header names in advance. All
+// reports them as used
+func New(opts plugin.Options) (plugin.Middleware, error) {
+	set := opts.All()
+	if len(set) == 0 {
+		return nil, errors.New("no headers given")
+	}
+	h := make(http.Header, len(set))
+	for name, value := range set {
+		h.Set(name, value)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, values := range h {
+				w.Header()[name] = values
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
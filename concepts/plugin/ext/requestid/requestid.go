@@ -0,0 +1,42 @@
+// Package requestid registers the "requestid" middleware, which gives each
+// request an ID - the client's, if it sent one - and echoes it back
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/thorntonmc/go-practice/concepts/plugin"
+)
+
+func init() {
+	plugin.RegisterMiddleware("requestid", "tags each request with an ID, reusing the client's", New)
+}
+
+type key struct{}
+
+// FromContext returns the request's ID, "" outside the middleware
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
+
+// New reads one option, header, the header carrying the ID. X-Request-Id
+// by default
+func New(opts plugin.Options) (plugin.Middleware, error) {
+	header := opts.Get("header", "X-Request-Id")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if id == "" || len(id) > 128 {
+				var b [8]byte
+				rand.Read(b[:])
+				id = hex.EncodeToString(b[:])
+			}
+			w.Header().Set(header, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key{}, id)))
+		})
+	}, nil
+}
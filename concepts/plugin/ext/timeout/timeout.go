@@ -0,0 +1,31 @@
+// Package timeout registers the "timeout" middleware, http.TimeoutHandler
+// with its settings from config
+package timeout
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/plugin"
+)
+
+func init() {
+	plugin.RegisterMiddleware("timeout", "gives up on a request with a 503 after a time limit", New)
+}
+
+// New reads after, a duration (10s by default), and message, the body of
+// the 503
+func New(opts plugin.Options) (plugin.Middleware, error) {
+	after, err := time.ParseDuration(opts.Get("after", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("after: %w", err)
+	}
+	if after <= 0 {
+		return nil, fmt.Errorf("after must be positive, got %v", after)
+	}
+	msg := opts.Get("message", "timed out")
+	return func(next http.Handler) http.Handler {
+		return http.TimeoutHandler(next, after, msg)
+	}, nil
+}
@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Go's plugin package loads a .so built with -buildmode=plugin, but it's
+// Linux and macOS only, the plugin has to be built with exactly the same
+// toolchain and versions of every shared dependency as the program, and a
+// loaded plugin can never be unloaded. In practice almost nobody uses it.
+//
+// What Go programs do instead is decide at compile time which extensions
+// are in the binary, and at run time which of those to use. database/sql
+// is the famous example: a driver package calls sql.Register in its init,
+// main blank-imports the drivers it wants,
+//
+//	import _ "github.com/jackc/pgx/v5/stdlib"
+//
+// and sql.Open("pgx", ...) finds it by name. image.RegisterFormat and
+// encoding/gob's Register work the same way.
+//
+// Here the extensions are HTTP middleware. Each package under ext/
+// registers a Factory by name; Build turns a list of names and options from
+// a config file into one middleware stack; and cmd/plugins lists what's
+// compiled in. Adding middleware to the stack is a config change, adding a
+// new kind of middleware is a new package and one import line
+
+// Middleware is the usual shape, see pkg/router
+type Middleware = func(http.Handler) http.Handler
+
+// Factory makes a middleware from its options - the settings given with
+// its name in the config. A bad value should be an error, so the mistake
+// fails at startup rather than on the first request
+type Factory func(opts Options) (Middleware, error)
+
+// Registry maps names to values, registered by init functions and looked up
+// later. It's generic so the same pattern could hold storage backends or
+// notifiers; this package only uses it for middleware
+type Registry[T any] struct {
+	kind string // for messages: "middleware"
+
+	mu    sync.RWMutex
+	items map[string]Registered[T]
+}
+
+// Registered is an entry and what it's for, the description shown when
+// listing
+type Registered[T any] struct {
+	Name        string
+	Description string
+	Value       T
+}
+
+func NewRegistry[T any](kind string) *Registry[T] {
+	return &Registry[T]{kind: kind, items: make(map[string]Registered[T])}
+}
+
+// Register adds value under name. Like sql.Register it panics on an empty
+// or duplicate name: both mean two packages disagree about who's who, which
+// is a mistake in the build, not something to handle at run time
+func (r *Registry[T]) Register(name, description string, value T) {
+	if name == "" {
+		panic(fmt.Sprintf("plugin: %s registered without a name", r.kind))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.items[name]; dup {
+		panic(fmt.Sprintf("plugin: %s %q registered twice", r.kind, name))
+	}
+	r.items[name] = Registered[T]{Name: name, Description: description, Value: value}
+}
+
+// Lookup finds name. The error names everything that is registered, since
+// the usual cause is a misspelling or a missing import
+func (r *Registry[T]) Lookup(name string) (T, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	item, ok := r.items[name]
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("plugin: unknown %s %q, have %s", r.kind, name, strings.Join(r.names(), ", "))
+	}
+	return item.Value, nil
+}
+
+// List is every entry, sorted by name
+func (r *Registry[T]) List() []Registered[T] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Registered[T], 0, len(r.items))
+	for _, name := range r.names() {
+		list = append(list, r.items[name])
+	}
+	return list
+}
+
+// names is sorted. r.mu must be held
+func (r *Registry[T]) names() []string {
+	names := make([]string, 0, len(r.items))
+	for name := range r.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+ *
+ * middleware
+ *
+ */
+
+var middleware = NewRegistry[Factory]("middleware")
+
+// RegisterMiddleware is what ext packages call from init
+func RegisterMiddleware(name, description string, f Factory) {
+	middleware.Register(name, description, f)
+}
+
+// Middlewares lists the registered middleware
+func Middlewares() []Registered[Factory] { return middleware.List() }
+
+// Spec names one middleware in a stack, with its options:
+//
+//	middleware:
+//	  - name: timeout
+//	    options:
+//	      after: 5s
+type Spec struct {
+	Name    string            `yaml:"name"`
+	Options map[string]string `yaml:"options"`
+}
+
+// Build makes the stack specs describe, the first spec outermost. Every
+// spec is checked before anything is returned, and all the problems are
+// reported together
+func Build(specs []Spec) (Middleware, error) {
+	mws := make([]Middleware, 0, len(specs))
+	var problems []string
+	for i, s := range specs {
+		f, err := middleware.Lookup(s.Name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%d: %v", i, err))
+			continue
+		}
+		opts := Options{values: s.Options, used: map[string]bool{}}
+		mw, err := f(opts)
+		if err == nil {
+			err = opts.unused()
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%d: %s: %v", i, s.Name, err))
+			continue
+		}
+		mws = append(mws, mw)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("plugin: bad middleware stack:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+
+	return func(h http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return h
+	}, nil
+}
+
+// Options are a middleware's settings. Reading one marks it used, and
+// Build fails if any are left unread - the factory doesn't have to check
+// for typos itself
+type Options struct {
+	values map[string]string
+	used   map[string]bool
+}
+
+// Get returns the option key, or def if it isn't set
+func (o Options) Get(key, def string) string {
+	o.used[key] = true
+	if v, ok := o.values[key]; ok {
+		return v
+	}
+	return def
+}
+
+// All returns every option and marks them used, for a middleware that
+// takes arbitrary keys
+func (o Options) All() map[string]string {
+	all := make(map[string]string, len(o.values))
+	for k, v := range o.values {
+		o.used[k] = true
+		all[k] = v
+	}
+	return all
+}
+
+func (o Options) unused() error {
+	var unknown []string
+	for k := range o.values {
+		if !o.used[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown options %s", strings.Join(unknown, ", "))
+}
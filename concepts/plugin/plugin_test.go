@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tag registers middleware that appends its name to a response header, so
+// the order a stack runs in shows up in the response
+func tag(opts Options) (Middleware, error) {
+	name := opts.Get("as", "")
+	if name == "" {
+		return nil, errors.New("as is required")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Order", name)
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func init() {
+	RegisterMiddleware("test-tag", "adds X-Order", tag)
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry[int]("number")
+	r.Register("two", "the second", 2)
+	r.Register("one", "the first", 1)
+
+	v, err := r.Lookup("one")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	_, err = r.Lookup("three")
+	assert.EqualError(t, err, `plugin: unknown number "three", have one, two`)
+
+	assert.Equal(t, []Registered[int]{
+		{Name: "one", Description: "the first", Value: 1},
+		{Name: "two", Description: "the second", Value: 2},
+	}, r.List(), "sorted by name")
+
+	assert.PanicsWithValue(t, `plugin: number "one" registered twice`, func() { r.Register("one", "", 11) })
+	assert.Panics(t, func() { r.Register("", "", 0) })
+}
+
+func TestBuild(t *testing.T) {
+	mw, err := Build([]Spec{
+		{Name: "test-tag", Options: map[string]string{"as": "outer"}},
+		{Name: "test-tag", Options: map[string]string{"as": "inner"}},
+	})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	mw(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, []string{"outer", "inner"}, rec.Header().Values("X-Order"), "first spec outermost")
+
+	empty, err := Build(nil)
+	require.NoError(t, err)
+	h := http.NotFoundHandler()
+	rec = httptest.NewRecorder()
+	empty(h).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestBuildReportsEveryProblem(t *testing.T) {
+	_, err := Build([]Spec{
+		{Name: "test-tag", Options: map[string]string{"as": "fine"}},
+		{Name: "test-tga"},
+		{Name: "test-tag"},
+		{Name: "test-tag", Options: map[string]string{"as": "x", "colour": "red", "size": "9"}},
+	})
+	require.Error(t, err)
+	lines := strings.Split(err.Error(), "\n\t")
+	assert.Equal(t, "plugin: bad middleware stack:", lines[0])
+	assert.Len(t, lines, 4)
+	assert.Contains(t, lines[1], `1: plugin: unknown middleware "test-tga", have `)
+	assert.Equal(t, "2: test-tag: as is required", lines[2])
+	assert.Equal(t, "3: test-tag: unknown options colour, size", lines[3])
+}
+
+func TestMiddlewaresListsRegistered(t *testing.T) {
+	var names []string
+	for _, m := range Middlewares() {
+		names = append(names, m.Name)
+	}
+	assert.Contains(t, names, "test-tag")
+}
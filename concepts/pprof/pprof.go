@@ -0,0 +1,176 @@
+package pprof
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Guessing where a program spends its time is a losing game, profiling tells
+// you. runtime/pprof writes profiles from inside the program, which you then
+// look at with:
+//
+//	go tool pprof -http=:8080 cpu.pprof
+//
+// For benchmarks the test runner does the same thing with flags:
+//
+//	go test -bench JSON -cpuprofile cpu.pprof -memprofile mem.pprof ./concepts/pprof
+//
+// Below is a function with a classic performance bug, the code to profile it,
+// and the fixed version the profile points you to
+
+type todo struct {
+	ID        int
+	Title     string
+	Completed bool
+}
+
+/*
+ *
+ * the hot function
+ *
+ */
+
+// buildJSONSlow builds the JSON with +=. Strings are immutable, so every += allocates a new
+// string and copies everything built so far into it - the work grows with the
+// square of the output size. The profile shows it as time in runtime.concatstrings
+// and runtime.mallocgc, and the heap profile as a mountain of short-lived strings
+func buildJSONSlow(todos []todo) string {
+	s := "["
+	for i, t := range todos {
+		if i > 0 {
+			s += ","
+		}
+		title, _ := json.Marshal(t.Title)
+		s += fmt.Sprintf(`{"id":%d,"title":%s,"completed":%t}`, t.ID, title, t.Completed)
+	}
+	s += "]"
+
+	return s
+}
+
+// buildJSONFast appends into one growing []byte. Growing doubles the capacity,
+// so the copying is amortized constant per byte, and the strconv Append
+// functions write straight into the buffer instead of returning new strings
+func buildJSONFast(todos []todo) string {
+	b := make([]byte, 0, 64*len(todos)+2)
+	b = append(b, '[')
+	for i, t := range todos {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, `{"id":`...)
+		b = strconv.AppendInt(b, int64(t.ID), 10)
+		b = append(b, `,"title":`...)
+		b = appendJSONString(b, t.Title)
+		b = append(b, `,"completed":`...)
+		b = strconv.AppendBool(b, t.Completed)
+		b = append(b, '}')
+	}
+	b = append(b, ']')
+
+	return string(b)
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString quotes s the way encoding/json does, including escaping
+// <, > and & for safe embedding in HTML. Control characters with a short
+// escape get it - \b and \f as well as \n, \r and \t, as encoding/json
+// has written them since Go 1.22 - and the rest are \u00XX
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			switch {
+			case r == utf8.RuneError && size == 1:
+				b = append(b, "\uFFFD"...)
+			case r == '\u2028' || r == '\u2029':
+				b = append(b, `\u202`...)
+				b = append(b, hex[r&0xF])
+			default:
+				b = append(b, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+
+		switch {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c == '\n':
+			b = append(b, `\n`...)
+		case c == '\r':
+			b = append(b, `\r`...)
+		case c == '\t':
+			b = append(b, `\t`...)
+		case c == '\b':
+			b = append(b, `\b`...)
+		case c == '\f':
+			b = append(b, `\f`...)
+		case c < 0x20 || c == '<' || c == '>' || c == '&':
+			b = append(b, `\u00`...)
+			b = append(b, hex[c>>4], hex[c&0xF])
+		default:
+			b = append(b, c)
+		}
+		i++
+	}
+
+	return append(b, '"')
+}
+
+/*
+ *
+ * writing profiles
+ *
+ */
+
+// profileCPU samples where fn spends its CPU time, about 100 times a second,
+// and writes the profile to w
+func profileCPU(w io.Writer, fn func()) error {
+	if err := pprof.StartCPUProfile(w); err != nil {
+		return err
+	}
+	defer pprof.StopCPUProfile()
+
+	fn()
+	return nil
+}
+
+// profileHeap writes a snapshot of the heap. The heap profile only reflects
+// the last completed GC, so run one first to make it current
+func profileHeap(w io.Writer) error {
+	runtime.GC()
+	return pprof.WriteHeapProfile(w)
+}
+
+// writeProfiles runs fn under the CPU profiler and then takes a heap profile,
+// writing cpu.pprof and heap.pprof into dir
+func writeProfiles(dir string, fn func()) error {
+	cpu, err := os.Create(filepath.Join(dir, "cpu.pprof"))
+	if err != nil {
+		return err
+	}
+	defer cpu.Close()
+
+	if err := profileCPU(cpu, fn); err != nil {
+		return err
+	}
+
+	heap, err := os.Create(filepath.Join(dir, "heap.pprof"))
+	if err != nil {
+		return err
+	}
+	defer heap.Close()
+
+	return profileHeap(heap)
+}
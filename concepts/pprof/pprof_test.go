@@ -0,0 +1,81 @@
+package pprof
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTodos(n int) []todo {
+	titles := []string{"buy milk", `quote "this"`, "a <b> & c", "tab\there", "newline\n", "form\ffeed\b", "ünïcödé", "\x01ctrl", " sep", "bad \xff utf8"}
+	out := make([]todo, n)
+	for i := range out {
+		out[i] = todo{ID: i, Title: titles[i%len(titles)], Completed: i%2 == 0}
+	}
+	return out
+}
+
+func TestBuildJSONMatches(t *testing.T) {
+	for _, n := range []int{0, 1, 9, 100} {
+		todos := makeTodos(n)
+		slow, fast := buildJSONSlow(todos), buildJSONFast(todos)
+
+		assert.Equal(t, slow, fast)
+		assert.True(t, json.Valid([]byte(fast)))
+	}
+}
+
+func TestAppendJSONStringMatchesEncodingJSON(t *testing.T) {
+	for _, s := range []string{"", "plain", "\"\\", "<>&", "\x00\x1f", "  ", "\xff", "日本語"} {
+		want, err := json.Marshal(s)
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(appendJSONString(nil, s)), "%q", s)
+	}
+
+	assert.Equal(t, `"\b\f\u0001"`, string(appendJSONString(nil, "\b\f\x01")))
+}
+
+func TestWriteProfiles(t *testing.T) {
+	dir := t.TempDir()
+	todos := makeTodos(2000)
+
+	err := writeProfiles(dir, func() {
+		for i := 0; i < 5; i++ {
+			buildJSONSlow(todos)
+		}
+	})
+	require.NoError(t, err)
+
+	// profiles are gzipped protocol buffers
+	for _, name := range []string{"cpu.pprof", "heap.pprof"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.Greater(t, len(b), 2, name)
+		assert.True(t, strings.HasPrefix(string(b), "\x1f\x8b"), "%s should be gzipped", name)
+	}
+}
+
+var sink string
+
+func BenchmarkBuildJSON(b *testing.B) {
+	todos := makeTodos(1000)
+
+	b.Run("slow", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sink = buildJSONSlow(todos)
+		}
+	})
+
+	b.Run("fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sink = buildJSONFast(todos)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// A Bus fans messages out to whoever is subscribed to a topic, inside one
+// process. Publishers and subscribers never know about each other - the
+// thing sending "order created" doesn't need a list of everyone who cares.
+//
+// Each subscriber reads from its own buffered channel, so the interesting
+// question is what to do when one falls behind and its buffer fills up:
+//
+//   - Drop: skip the message for that subscriber and count it. One slow
+//     reader can't hold anyone else up, at the cost of gaps. Right for live
+//     feeds where only recent messages matter
+//   - Block: make the publisher wait until there's room. Nothing is lost, but
+//     the slowest subscriber sets the pace for everybody
+//
+// The policy belongs to the subscriber, since it's the one that knows
+// whether it can afford to miss messages
+
+// Policy decides what happens when a subscriber's buffer is full
+type Policy int
+
+const (
+	Drop Policy = iota
+	Block
+)
+
+var ErrClosed = errors.New("pubsub: bus closed")
+
+// Bus is a topic based publish/subscribe hub for messages of type T. The
+// zero value isn't usable, create one with New
+type Bus[T any] struct {
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription[T]]struct{}
+	closed bool
+}
+
+func New[T any]() *Bus[T] {
+	return &Bus[T]{topics: make(map[string]map[*Subscription[T]]struct{})}
+}
+
+// Subscription receives a topic's messages on C until Unsubscribe, which
+// closes C - so a subscriber can simply range over it
+type Subscription[T any] struct {
+	C <-chan T
+
+	bus    *Bus[T]
+	topic  string
+	policy Policy
+	ch     chan T
+
+	// done is closed first on Unsubscribe, to release any publisher
+	// blocked on a full buffer. sending is held by publishers while they
+	// send, so ch is only closed once none are
+	done    chan struct{}
+	once    sync.Once
+	sending sync.RWMutex
+
+	dropped atomic.Uint64
+}
+
+// Option configures a Subscription
+type Option func(*subConfig)
+
+type subConfig struct {
+	buffer int
+	policy Policy
+}
+
+// WithBuffer sets the channel's buffer, 16 by default
+func WithBuffer(n int) Option {
+	return func(c *subConfig) { c.buffer = n }
+}
+
+// WithPolicy sets what happens when the buffer is full, Drop by default
+func WithPolicy(p Policy) Option {
+	return func(c *subConfig) { c.policy = p }
+}
+
+// Subscribe starts receiving messages published to topic from now on.
+// Subscribing to a closed bus returns an already closed Subscription
+func (b *Bus[T]) Subscribe(topic string, opts ...Option) *Subscription[T] {
+	cfg := subConfig{buffer: 16, policy: Drop}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ch := make(chan T, cfg.buffer)
+	s := &Subscription[T]{
+		C:      ch,
+		bus:    b,
+		topic:  topic,
+		policy: cfg.policy,
+		ch:     ch,
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		s.close()
+		return s
+	}
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[*Subscription[T]]struct{})
+	}
+	b.topics[topic][s] = struct{}{}
+	return s
+}
+
+// Publish sends msg to every subscriber of topic and reports how many got
+// it. The subscriber list is copied first, so slow sends don't hold the lock.
+// A Block subscriber can make Publish wait; ctx bounds that wait, and if it
+// runs out the error is returned once every other subscriber has been tried
+func (b *Bus[T]) Publish(ctx context.Context, topic string, msg T) (int, error) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return 0, ErrClosed
+	}
+	subs := make([]*Subscription[T], 0, len(b.topics[topic]))
+	for s := range b.topics[topic] {
+		subs = append(subs, s)
+	}
+	b.mu.RUnlock()
+
+	var (
+		delivered int
+		err       error
+	)
+	for _, s := range subs {
+		ok, sendErr := s.send(ctx, msg)
+		if ok {
+			delivered++
+		}
+		if sendErr != nil {
+			err = sendErr
+		}
+	}
+	return delivered, err
+}
+
+// Subscribers is how many subscriptions topic has
+func (b *Bus[T]) Subscribers(topic string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.topics[topic])
+}
+
+// Close unsubscribes everyone. Publishing afterwards returns ErrClosed
+func (b *Bus[T]) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	topics := b.topics
+	b.topics = nil
+	b.mu.Unlock()
+
+	for _, subs := range topics {
+		for s := range subs {
+			s.close()
+		}
+	}
+}
+
+// send reports whether msg was delivered, and the context's error if a
+// Block subscriber was given up on
+func (s *Subscription[T]) send(ctx context.Context, msg T) (bool, error) {
+	s.sending.RLock()
+	defer s.sending.RUnlock()
+
+	select {
+	case <-s.done:
+		return false, nil
+	default:
+	}
+
+	if s.policy == Drop {
+		select {
+		case s.ch <- msg:
+			return true, nil
+		default:
+			s.dropped.Add(1)
+			return false, nil
+		}
+	}
+
+	select {
+	case s.ch <- msg:
+		return true, nil
+	case <-s.done:
+		return false, nil
+	case <-ctx.Done():
+		s.dropped.Add(1)
+		return false, ctx.Err()
+	}
+}
+
+// Topic is the topic this subscription is for
+func (s *Subscription[T]) Topic() string { return s.topic }
+
+// Dropped is how many messages never reached this subscriber because its
+// buffer was full
+func (s *Subscription[T]) Dropped() uint64 { return s.dropped.Load() }
+
+// Unsubscribe stops delivery and closes C. Messages already buffered can
+// still be read. It's safe to call more than once, and from any goroutine -
+// including while a publisher is blocked sending to this subscription
+func (s *Subscription[T]) Unsubscribe() {
+	s.bus.mu.Lock()
+	if subs := s.bus.topics[s.topic]; subs != nil {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(s.bus.topics, s.topic)
+		}
+	}
+	s.bus.mu.Unlock()
+
+	s.close()
+}
+
+func (s *Subscription[T]) close() {
+	s.once.Do(func() {
+		close(s.done)
+
+		// wait out any send in progress, then nothing can send again
+		s.sending.Lock()
+		close(s.ch)
+		s.sending.Unlock()
+	})
+}
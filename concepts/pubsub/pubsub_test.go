@@ -0,0 +1,205 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	b := New[string]()
+	defer b.Close()
+
+	orders := b.Subscribe("orders")
+	orders2 := b.Subscribe("orders")
+	users := b.Subscribe("users")
+	assert.Equal(t, 2, b.Subscribers("orders"))
+
+	n, err := b.Publish(context.Background(), "orders", "created")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Equal(t, "created", <-orders.C)
+	assert.Equal(t, "created", <-orders2.C)
+	assert.Empty(t, users.C, "other topics don't see it")
+
+	n, err = b.Publish(context.Background(), "nobody-listening", "x")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestOrderPreserved(t *testing.T) {
+	b := New[int]()
+	defer b.Close()
+	s := b.Subscribe("t", WithBuffer(100))
+
+	for i := 0; i < 100; i++ {
+		b.Publish(context.Background(), "t", i)
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, i, <-s.C)
+	}
+}
+
+func TestDropPolicy(t *testing.T) {
+	b := New[int]()
+	defer b.Close()
+
+	slow := b.Subscribe("t", WithBuffer(2))
+	fast := b.Subscribe("t", WithBuffer(10))
+
+	for i := 0; i < 5; i++ {
+		_, err := b.Publish(context.Background(), "t", i)
+		require.NoError(t, err, "never blocks")
+	}
+
+	assert.Equal(t, uint64(3), slow.Dropped())
+	assert.Equal(t, uint64(0), fast.Dropped())
+	assert.Equal(t, 0, <-slow.C, "keeps the oldest, drops the newest")
+	assert.Equal(t, 1, <-slow.C)
+	assert.Len(t, fast.C, 5)
+}
+
+func TestBlockPolicy(t *testing.T) {
+	b := New[int]()
+	defer b.Close()
+	s := b.Subscribe("t", WithBuffer(1), WithPolicy(Block))
+
+	_, err := b.Publish(context.Background(), "t", 1)
+	require.NoError(t, err)
+
+	published := make(chan struct{})
+	go func() {
+		b.Publish(context.Background(), "t", 2)
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("Publish didn't wait for the full subscriber")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	assert.Equal(t, 1, <-s.C)
+	<-published
+	assert.Equal(t, 2, <-s.C)
+	assert.Equal(t, uint64(0), s.Dropped())
+}
+
+func TestBlockPolicyTimeout(t *testing.T) {
+	b := New[int]()
+	defer b.Close()
+	blocked := b.Subscribe("t", WithBuffer(0), WithPolicy(Block))
+	other := b.Subscribe("t")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	n, err := b.Publish(ctx, "t", 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, n, "the other subscriber still got it")
+	assert.Equal(t, 1, <-other.C)
+	assert.Equal(t, uint64(1), blocked.Dropped())
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := New[string]()
+	defer b.Close()
+	s := b.Subscribe("t")
+
+	b.Publish(context.Background(), "t", "before")
+	s.Unsubscribe()
+	s.Unsubscribe() // safe twice
+
+	n, err := b.Publish(context.Background(), "t", "after")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, b.Subscribers("t"))
+
+	// buffered messages are still readable, then the channel is closed
+	var got []string
+	for msg := range s.C {
+		got = append(got, msg)
+	}
+	assert.Equal(t, []string{"before"}, got)
+}
+
+func TestUnsubscribeReleasesBlockedPublisher(t *testing.T) {
+	b := New[int]()
+	defer b.Close()
+	s := b.Subscribe("t", WithBuffer(0), WithPolicy(Block))
+
+	published := make(chan int)
+	go func() {
+		n, _ := b.Publish(context.Background(), "t", 1)
+		published <- n
+	}()
+
+	time.Sleep(10 * time.Millisecond) // let Publish block
+	s.Unsubscribe()
+	assert.Equal(t, 0, <-published)
+}
+
+func TestClose(t *testing.T) {
+	b := New[int]()
+	s := b.Subscribe("t")
+	b.Close()
+	b.Close()
+
+	_, ok := <-s.C
+	assert.False(t, ok)
+	s.Unsubscribe()
+
+	_, err := b.Publish(context.Background(), "t", 1)
+	assert.ErrorIs(t, err, ErrClosed)
+
+	late := b.Subscribe("t")
+	_, ok = <-late.C
+	assert.False(t, ok, "subscribing to a closed bus gives a closed subscription")
+}
+
+// TestConcurrent is mostly for the race detector: publishers, subscribers
+// coming and going, and a Close at the end, all at once
+func TestConcurrent(t *testing.T) {
+	b := New[int]()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				b.Publish(ctx, fmt.Sprint("topic", i%3), p*1000+i)
+			}
+		}(p)
+	}
+
+	for c := 0; c < 8; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				policy := Drop
+				if c%2 == 0 {
+					policy = Block
+				}
+				s := b.Subscribe(fmt.Sprint("topic", c%3), WithBuffer(c), WithPolicy(policy))
+				for j := 0; j < 3; j++ {
+					select {
+					case <-s.C:
+					case <-time.After(time.Millisecond):
+					}
+				}
+				s.Unsubscribe()
+			}
+		}(c)
+	}
+
+	wg.Wait()
+	b.Close()
+}
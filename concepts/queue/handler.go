@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	jsonconcept "github.com/thorntonmc/go-practice/concepts/json"
+)
+
+// Offloading slow work from an HTTP handler: rather than making the client
+// wait while a report is generated or an email sent, accept the request,
+// queue it and answer 202 Accepted with somewhere to check on it
+//
+//	POST /tasks       enqueue the JSON body, 202 with Location: /tasks/{id}
+//	GET  /tasks/{id}  the task's Info
+//	GET  /tasks/dead  the dead letters
+//
+// A full or shut down queue is a 503 with Retry-After, so clients slow down
+// instead of piling on
+func newTaskHandler[T any](q *Queue[T]) http.Handler {
+	m := http.NewServeMux()
+
+	m.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		payload, err := jsonconcept.Decode[T](r.Body, jsonconcept.DisallowUnknownFields(), jsonconcept.MaxBytes(64<<10))
+		if err != nil {
+			jsonconcept.WriteDecodeError(w, err)
+			return
+		}
+
+		id, err := q.Enqueue(payload)
+		switch {
+		case errors.Is(err, ErrFull), errors.Is(err, ErrClosed):
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": http.StatusText(http.StatusInternalServerError)})
+			return
+		}
+
+		w.Header().Set("Location", "/tasks/"+id)
+		writeJSON(w, http.StatusAccepted, map[string]string{"id": id})
+	})
+
+	m.HandleFunc("/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/tasks/")
+		if id == "dead" {
+			writeJSON(w, http.StatusOK, q.DeadLetters())
+			return
+		}
+		info, ok := q.Get(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	})
+
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/retry"
+)
+
+type report struct {
+	User string `json:"user"`
+}
+
+func postTask(t *testing.T, srv *httptest.Server, body string) *http.Response {
+	resp, err := srv.Client().Post(srv.URL+"/tasks", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func getInfo(t *testing.T, srv *httptest.Server, path string) Info[report] {
+	resp, err := srv.Client().Get(srv.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var info Info[report]
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	return info
+}
+
+func TestTaskHandler(t *testing.T) {
+	generated := make(chan string, 10)
+	q := newTestQueue(t, func(_ context.Context, r report) error {
+		if r.User == "nobody" {
+			return retry.Permanent(errors.New("no such user"))
+		}
+		generated <- r.User
+		return nil
+	}, Options{})
+	srv := httptest.NewServer(newTaskHandler(q))
+	t.Cleanup(srv.Close)
+
+	resp := postTask(t, srv, `{"user":"gopher"}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	loc := resp.Header.Get("Location")
+	assert.Equal(t, "/tasks/1", loc)
+
+	assert.Equal(t, "gopher", <-generated)
+	require.Eventually(t, func() bool { return getInfo(t, srv, loc).State == Done }, time.Second, time.Millisecond)
+	assert.Equal(t, report{User: "gopher"}, getInfo(t, srv, loc).Payload)
+
+	// a task that fails shows up in the dead letters
+	resp = postTask(t, srv, `{"user":"nobody"}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	loc = resp.Header.Get("Location")
+	require.Eventually(t, func() bool { return getInfo(t, srv, loc).State == Dead }, time.Second, time.Millisecond)
+
+	deadResp, err := srv.Client().Get(srv.URL + "/tasks/dead")
+	require.NoError(t, err)
+	defer deadResp.Body.Close()
+	var dead []Info[report]
+	require.NoError(t, json.NewDecoder(deadResp.Body).Decode(&dead))
+	require.Len(t, dead, 1)
+	assert.Equal(t, "no such user", dead[0].Err)
+}
+
+func TestTaskHandlerErrors(t *testing.T) {
+	release := make(chan struct{})
+	q := newTestQueue(t, func(context.Context, report) error {
+		<-release
+		return nil
+	}, Options{Workers: 1, Buffer: 1})
+	defer close(release)
+	srv := httptest.NewServer(newTaskHandler(q))
+	t.Cleanup(srv.Close)
+
+	assert.Equal(t, http.StatusBadRequest, postTask(t, srv, `{"usr":"typo"}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, postTask(t, srv, `not json`).StatusCode)
+
+	resp, err := srv.Client().Get(srv.URL + "/tasks/404")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = srv.Client().Get(srv.URL + "/tasks")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// one running, one buffered, then the queue pushes back
+	require.Equal(t, http.StatusAccepted, postTask(t, srv, `{"user":"a"}`).StatusCode)
+	waitForState(t, q, "1", Running)
+	require.Equal(t, http.StatusAccepted, postTask(t, srv, `{"user":"b"}`).StatusCode)
+
+	full := postTask(t, srv, `{"user":"c"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, full.StatusCode)
+	assert.Equal(t, "1", full.Header.Get("Retry-After"))
+}
@@ -0,0 +1,363 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/retry"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// A Queue takes work off the request path: a handler enqueues a task and
+// returns straight away, and a fixed pool of workers gets through the tasks
+// in the background. A failed task is retried after a growing delay, and one
+// that keeps failing ends up on the dead letter list for a human to look at
+// rather than being retried forever or silently dropped.
+//
+// Everything lives in memory, so tasks don't survive a restart - that needs
+// a database or a broker behind the same interface
+
+// Func does the work for one task. Returning an error retries it, unless
+// the Retry policy says otherwise - retry.Permanent sends it straight to the
+// dead letters
+type Func[T any] func(ctx context.Context, payload T) error
+
+// Options configures a Queue. The zero value is usable
+type Options struct {
+	Workers int          // default 4
+	Buffer  int          // tasks waiting for a worker before Enqueue returns ErrFull, default 100
+	Retry   retry.Policy // attempts, backoff and which errors to retry. Its Clock is ignored
+	Clock   clock.Clock  // default the real clock
+
+	// Retain is how long a finished task can still be looked up with Get,
+	// default 10 minutes. After that it's forgotten, or a long running
+	// queue would hold on to every task it ever ran. Dead letters are kept
+	// until the queue goes, since somebody needs to look at them
+	Retain time.Duration
+}
+
+// State is where a task is in its life
+type State string
+
+const (
+	Queued   State = "queued"
+	Running  State = "running"
+	Retrying State = "retrying" // failed, waiting out its backoff
+	Done     State = "done"
+	Dead     State = "dead"
+)
+
+var (
+	ErrFull     = errors.New("queue: full")
+	ErrClosed   = errors.New("queue: shut down")
+	ErrShutdown = errors.New("queue: abandoned at shutdown")
+)
+
+// Info describes a task
+type Info[T any] struct {
+	ID       string `json:"id"`
+	Payload  T      `json:"payload"`
+	State    State  `json:"state"`
+	Attempts int    `json:"attempts"`
+	Err      string `json:"error,omitempty"` // the last failure
+}
+
+type task[T any] struct {
+	seq      uint64
+	id       string
+	payload  T
+	state    State
+	attempts int
+	err      error
+	doneAt   time.Time
+}
+
+func (t *task[T]) info() Info[T] {
+	i := Info[T]{ID: t.id, Payload: t.payload, State: t.state, Attempts: t.attempts}
+	if t.err != nil {
+		i.Err = t.err.Error()
+	}
+	return i
+}
+
+// Queue is a generic in-memory task queue. Create one with New
+type Queue[T any] struct {
+	fn   Func[T]
+	opts Options
+
+	ready chan *task[T]
+
+	// ctx is handed to Func and cancelled when Shutdown gives up waiting;
+	// stop tells workers and backoff timers to quit
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	wg     sync.WaitGroup // workers and backoff timers
+
+	mu          sync.Mutex
+	seq         uint64
+	tasks       map[string]*task[T]
+	done        []string // finished tasks still in tasks, oldest first
+	dead        []string
+	outstanding int // not yet done or dead
+	closed      bool
+	drained     chan struct{} // closed once closed and outstanding hits 0
+}
+
+// New starts the workers. Call Shutdown to stop them
+func New[T any](fn Func[T], opts Options) *Queue[T] {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 100
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.New()
+	}
+	if opts.Retain <= 0 {
+		opts.Retain = 10 * time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue[T]{
+		fn:      fn,
+		opts:    opts,
+		ready:   make(chan *task[T], opts.Buffer),
+		ctx:     ctx,
+		cancel:  cancel,
+		stop:    make(chan struct{}),
+		tasks:   make(map[string]*task[T]),
+		drained: make(chan struct{}),
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue adds a task and returns its id. It never blocks: a full queue is
+// ErrFull, which a handler can turn into a 503 so clients back off
+func (q *Queue[T]) Enqueue(payload T) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return "", ErrClosed
+	}
+	q.evict()
+
+	q.seq++
+	t := &task[T]{seq: q.seq, id: strconv.FormatUint(q.seq, 10), payload: payload, state: Queued}
+	select {
+	case q.ready <- t:
+	default:
+		return "", ErrFull
+	}
+
+	q.tasks[t.id] = t
+	q.outstanding++
+	return t.id, nil
+}
+
+// Get returns a task by id
+func (q *Queue[T]) Get(id string) (Info[T], bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t, ok := q.tasks[id]
+	if !ok {
+		return Info[T]{}, false
+	}
+	return t.info(), true
+}
+
+// DeadLetters returns the tasks that ran out of attempts, oldest first
+func (q *Queue[T]) DeadLetters() []Info[T] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make([]Info[T], 0, len(q.dead))
+	for _, id := range q.dead {
+		out = append(out, q.tasks[id].info())
+	}
+	return out
+}
+
+// Shutdown stops accepting tasks and waits for the ones already accepted to
+// finish, retries included. If ctx ends first, running tasks have their
+// context cancelled, and anything left over is dead lettered with
+// ErrShutdown so it's accounted for rather than lost
+func (q *Queue[T]) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		q.checkDrained()
+	}
+	q.mu.Unlock()
+
+	var err error
+	select {
+	case <-q.drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	select {
+	case <-q.stop:
+	default:
+		close(q.stop)
+	}
+	q.mu.Unlock()
+	q.cancel()
+	q.wg.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var left []*task[T]
+	for _, t := range q.tasks {
+		if t.state != Done && t.state != Dead {
+			left = append(left, t)
+		}
+	}
+	sort.Slice(left, func(i, j int) bool { return left[i].seq < left[j].seq })
+	for _, t := range left {
+		t.err = ErrShutdown
+		q.bury(t)
+	}
+	return err
+}
+
+func (q *Queue[T]) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case t := <-q.ready:
+			// select picks at random when both are ready - don't start
+			// anything new once stopped
+			select {
+			case <-q.stop:
+				return
+			default:
+			}
+			q.run(t)
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+func (q *Queue[T]) run(t *task[T]) {
+	q.mu.Lock()
+	t.state = Running
+	t.attempts++
+	q.mu.Unlock()
+
+	err := q.call(t.payload)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t.err = err
+	switch {
+	case err == nil:
+		t.state = Done
+		t.doneAt = q.opts.Clock.Now()
+		q.done = append(q.done, t.id)
+		q.evict()
+		q.finish()
+	case !q.opts.Retry.ShouldRetry(err), t.attempts >= q.opts.Retry.Attempts():
+		q.bury(t)
+	default:
+		q.retryLater(t)
+	}
+}
+
+// call runs the Func, turning a panic into an error so one bad task can't
+// take a worker down with it
+func (q *Queue[T]) call(payload T) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("queue: task panicked: %v", v)
+		}
+	}()
+	return q.fn(q.ctx, payload)
+}
+
+// retryLater waits out the backoff on its own goroutine, leaving the worker
+// free for other tasks in the meantime. That's why the queue uses the
+// policy's Delay rather than retry.Retry, which would hold the worker for the
+// whole wait. q.mu must be held
+func (q *Queue[T]) retryLater(t *task[T]) {
+	select {
+	case <-q.stop:
+		q.bury(t)
+		return
+	default:
+	}
+
+	t.state = Retrying
+	wait := q.opts.Clock.After(q.opts.Retry.Delay(t.attempts))
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		select {
+		case <-wait:
+		case <-q.stop:
+			return // Shutdown dead letters it
+		}
+
+		q.mu.Lock()
+		t.state = Queued
+		q.mu.Unlock()
+
+		select {
+		case q.ready <- t:
+		case <-q.stop:
+		}
+	}()
+}
+
+// evict forgets finished tasks older than Retain. They finish in order, so
+// the old ones are all at the front of done. q.mu must be held
+func (q *Queue[T]) evict() {
+	cutoff := q.opts.Clock.Now().Add(-q.opts.Retain)
+	n := 0
+	for n < len(q.done) && !q.tasks[q.done[n]].doneAt.After(cutoff) {
+		delete(q.tasks, q.done[n])
+		n++
+	}
+	q.done = q.done[n:]
+}
+
+// bury moves a task to the dead letters. q.mu must be held
+func (q *Queue[T]) bury(t *task[T]) {
+	t.state = Dead
+	q.dead = append(q.dead, t.id)
+	q.finish()
+}
+
+// finish counts a task as settled. q.mu must be held
+func (q *Queue[T]) finish() {
+	q.outstanding--
+	q.checkDrained()
+}
+
+func (q *Queue[T]) checkDrained() {
+	if q.closed && q.outstanding == 0 {
+		select {
+		case <-q.drained:
+		default:
+			close(q.drained)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/retry"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"go.uber.org/goleak"
+)
+
+// newTestQueue makes sure every queue is shut down when its test ends
+func newTestQueue[T any](t *testing.T, fn Func[T], opts Options) *Queue[T] {
+	q := New(fn, opts)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		q.Shutdown(ctx)
+	})
+	return q
+}
+
+func waitForState[T any](t *testing.T, q *Queue[T], id string, want State) Info[T] {
+	t.Helper()
+	var info Info[T]
+	require.Eventually(t, func() bool {
+		info, _ = q.Get(id)
+		return info.State == want
+	}, time.Second, time.Millisecond, "task %s never reached %s", id, want)
+	return info
+}
+
+func TestProcessesTasks(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[int]bool{}
+	q := newTestQueue(t, func(_ context.Context, n int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[n] = true
+		return nil
+	}, Options{Workers: 3})
+
+	var ids []string
+	for i := 0; i < 20; i++ {
+		id, err := q.Enqueue(i)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.NoError(t, q.Shutdown(context.Background()))
+
+	assert.Len(t, seen, 20)
+	for _, id := range ids {
+		info, ok := q.Get(id)
+		require.True(t, ok)
+		assert.Equal(t, Done, info.State)
+		assert.Equal(t, 1, info.Attempts)
+	}
+	assert.Empty(t, q.DeadLetters())
+
+	_, err := q.Enqueue(99)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestRetriesWithBackoff(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	var calls atomic.Int32
+	q := newTestQueue(t, func(context.Context, string) error {
+		if calls.Add(1) < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	}, Options{Retry: retry.Policy{Initial: time.Second}, Clock: clk})
+
+	id, err := q.Enqueue("job")
+	require.NoError(t, err)
+
+	info := waitForState(t, q, id, Retrying)
+	assert.Equal(t, 1, info.Attempts)
+	assert.Equal(t, "flaky", info.Err)
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	info = waitForState(t, q, id, Retrying)
+	assert.Equal(t, 2, info.Attempts)
+
+	// the second backoff is twice as long
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	info, _ = q.Get(id)
+	assert.Equal(t, Retrying, info.State)
+	clk.Advance(time.Second)
+
+	info = waitForState(t, q, id, Done)
+	assert.Equal(t, 3, info.Attempts)
+	assert.Empty(t, info.Err)
+}
+
+func TestForgetsFinishedTasks(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	q := newTestQueue(t, func(_ context.Context, kind string) error {
+		if kind == "fail" {
+			return retry.Permanent(errors.New("bad input"))
+		}
+		return nil
+	}, Options{Workers: 1, Retain: time.Minute, Clock: clk})
+
+	old, err := q.Enqueue("ok")
+	require.NoError(t, err)
+	failed, err := q.Enqueue("fail")
+	require.NoError(t, err)
+	waitForState(t, q, old, Done)
+	waitForState(t, q, failed, Dead)
+
+	clk.Advance(59 * time.Second)
+	recent, err := q.Enqueue("ok")
+	require.NoError(t, err)
+	waitForState(t, q, recent, Done)
+	_, ok := q.Get(old)
+	assert.True(t, ok, "still within Retain")
+
+	// a minute after it finished, the next Enqueue forgets it - but not
+	// the dead letter, or the one that finished later
+	clk.Advance(time.Second)
+	_, err = q.Enqueue("ok")
+	require.NoError(t, err)
+	_, ok = q.Get(old)
+	assert.False(t, ok)
+	_, ok = q.Get(failed)
+	assert.True(t, ok)
+	assert.Len(t, q.DeadLetters(), 1)
+	_, ok = q.Get(recent)
+	assert.True(t, ok)
+}
+
+func TestDeadLetters(t *testing.T) {
+	q := newTestQueue(t, func(_ context.Context, kind string) error {
+		switch kind {
+		case "permanent":
+			return retry.Permanent(errors.New("bad input"))
+		case "panic":
+			panic("boom")
+		default:
+			return errors.New("always fails")
+		}
+	}, Options{Workers: 1, Retry: retry.Policy{MaxAttempts: 2, Initial: time.Nanosecond}})
+
+	for _, kind := range []string{"transient", "permanent", "panic"} {
+		_, err := q.Enqueue(kind)
+		require.NoError(t, err)
+	}
+	require.NoError(t, q.Shutdown(context.Background()))
+
+	byPayload := map[string]Info[string]{}
+	for _, d := range q.DeadLetters() {
+		assert.Equal(t, Dead, d.State)
+		byPayload[d.Payload] = d
+	}
+	require.Len(t, byPayload, 3)
+
+	assert.Equal(t, 2, byPayload["transient"].Attempts)
+	assert.Equal(t, "always fails", byPayload["transient"].Err)
+	assert.Equal(t, 1, byPayload["permanent"].Attempts, "permanent errors aren't retried")
+	assert.Equal(t, 2, byPayload["panic"].Attempts)
+	assert.Contains(t, byPayload["panic"].Err, "boom")
+}
+
+func TestEnqueueFull(t *testing.T) {
+	release := make(chan struct{})
+	q := newTestQueue(t, func(context.Context, int) error {
+		<-release
+		return nil
+	}, Options{Workers: 1, Buffer: 1})
+	defer close(release)
+
+	first, err := q.Enqueue(1)
+	require.NoError(t, err)
+	waitForState(t, q, first, Running)
+
+	_, err = q.Enqueue(2)
+	require.NoError(t, err, "waits in the buffer")
+	_, err = q.Enqueue(3)
+	assert.ErrorIs(t, err, ErrFull)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	q := New(func(ctx context.Context, n int) error {
+		<-ctx.Done() // only finishes when cancelled
+		return ctx.Err()
+	}, Options{Workers: 1})
+
+	first, err := q.Enqueue(1)
+	require.NoError(t, err)
+	waitForState(t, q, first, Running)
+	_, err = q.Enqueue(2)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, q.Shutdown(ctx), context.DeadlineExceeded)
+
+	dead := q.DeadLetters()
+	require.Len(t, dead, 2)
+	assert.Equal(t, 1, dead[0].Payload)
+	assert.Equal(t, context.Canceled.Error(), dead[0].Err, "the running task saw its context cancelled")
+	assert.Equal(t, 2, dead[1].Payload)
+	assert.Equal(t, ErrShutdown.Error(), dead[1].Err)
+	assert.Equal(t, 0, dead[1].Attempts, "never started")
+}
@@ -0,0 +1,273 @@
+package quick
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+)
+
+// An example-based test checks the cases somebody thought of. A property
+// test states something that should hold for every input - decode(encode(x))
+// is x, the cache never holds more than its capacity - and lets a generator
+// go looking for the input where it doesn't. It finds the cases nobody
+// thought of: the NaN, the invalid UTF-8, the empty slice that comes back
+// nil.
+//
+// Two ways to write them in Go:
+//
+//   - testing/quick, in the standard library. quick.Check calls a func with
+//     random arguments built by reflection and reports the first set that
+//     returns false. It's frozen - the package doc says so - and it has no
+//     shrinking: the counterexample it reports is whatever random mess it
+//     happened to try, a 40-rune name and 17 tags when one field was the
+//     problem
+//   - pgregory.net/rapid, which is Hypothesis for Go. Generators are values
+//     that compose (SliceOf, Custom, StringMatching), and when a property
+//     fails rapid shrinks the input - smaller numbers, shorter slices, fewer
+//     steps - until it can't without the failure going away. What gets
+//     reported is close to the smallest input that fails
+//
+// Either way, a property test is only as good as its generator. Random
+// unicode strings almost never share a prefix, so a trie tested with them
+// never exercises the interesting paths - draw keys from a small alphabet
+// instead. And a random failure is only useful if it can be run again:
+// testing/quick takes a *rand.Rand in its Config, so seed it and log the
+// seed, and rapid prints a -rapid.seed flag (and saves a failfile under
+// testdata/rapid) that replays the failing run exactly.
+//
+// For the stateful types - the LRU, the trie - the property is "it behaves
+// like a model": a deliberately dumb implementation that's obviously
+// right, run through the same random sequence of operations. rapid's
+// T.Repeat does the sequencing, and shrinks it to the shortest sequence
+// that still goes wrong
+
+/*
+ *
+ * codecs
+ *
+ */
+
+// record is the value round-tripped through every codec. Its fields are all
+// exported so testing/quick can fill them in and gob and JSON can see them
+type record struct {
+	ID     uint64
+	Name   string
+	Score  float64
+	Tags   []string
+	Active bool
+}
+
+// jsonRoundTrip encodes r as JSON and decodes it again. It can't be the
+// identity: JSON has no NaN or infinities, so those are an error, and its
+// strings are UTF-8, so invalid bytes come back as U+FFFD
+func jsonRoundTrip(r record) (record, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return record{}, err
+	}
+	var out record
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
+
+// gobRoundTrip is the same through gob, which carries any float and any
+// bytes in a string - but doesn't send empty slices at all, so Tags
+// []string{} comes back nil
+func gobRoundTrip(r record) (record, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(r); err != nil {
+		return record{}, err
+	}
+	var out record
+	err := gob.NewDecoder(&buf).Decode(&out)
+	return out, err
+}
+
+// The binary format is hand rolled, like the records in concepts/io:
+//
+//	uvarint ID
+//	uvarint len(Name), Name
+//	8 bytes Score, big-endian IEEE 754 bits
+//	uvarint len(Tags), then uvarint len(tag), tag for each
+//	1 byte Active
+//
+// Encoding the bits keeps every float exactly, NaN payloads included. A
+// count of zero tags can't say whether they were nil or empty, so they
+// come back nil, as from gob
+
+var errShortRecord = errors.New("record: short buffer")
+
+// appendRecord appends r's encoding to dst
+func appendRecord(dst []byte, r record) []byte {
+	dst = binary.AppendUvarint(dst, r.ID)
+	dst = appendString(dst, r.Name)
+	dst = binary.BigEndian.AppendUint64(dst, math.Float64bits(r.Score))
+	dst = binary.AppendUvarint(dst, uint64(len(r.Tags)))
+	for _, tag := range r.Tags {
+		dst = appendString(dst, tag)
+	}
+	if r.Active {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+func appendString(dst []byte, s string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// readRecord decodes one record from the front of b and returns the rest.
+// b may be anything - a truncated record, or garbage - and the answer is
+// an error, never a panic or a huge allocation
+func readRecord(b []byte) (record, []byte, error) {
+	var r record
+	var err error
+	if r.ID, b, err = readUvarint(b); err != nil {
+		return record{}, nil, err
+	}
+	if r.Name, b, err = readString(b); err != nil {
+		return record{}, nil, err
+	}
+	if len(b) < 8 {
+		return record{}, nil, errShortRecord
+	}
+	r.Score, b = math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:]
+
+	n, b, err := readUvarint(b)
+	if err != nil {
+		return record{}, nil, err
+	}
+	// every tag takes at least its length byte, so a count bigger than
+	// what's left is a lie - and believing it would allocate whatever a
+	// corrupt header asks for
+	if n > uint64(len(b)) {
+		return record{}, nil, errShortRecord
+	}
+	if n > 0 {
+		r.Tags = make([]string, n)
+	}
+	for i := range r.Tags {
+		if r.Tags[i], b, err = readString(b); err != nil {
+			return record{}, nil, err
+		}
+	}
+
+	if len(b) < 1 {
+		return record{}, nil, errShortRecord
+	}
+	switch b[0] {
+	case 0:
+	case 1:
+		r.Active = true
+	default:
+		return record{}, nil, errors.New("record: bad bool")
+	}
+	return r, b[1:], nil
+}
+
+func readUvarint(b []byte) (uint64, []byte, error) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, nil, errShortRecord
+	}
+	return v, b[n:], nil
+}
+
+func readString(b []byte) (string, []byte, error) {
+	n, b, err := readUvarint(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if n > uint64(len(b)) {
+		return "", nil, errShortRecord
+	}
+	return string(b[:n]), b[n:], nil
+}
+
+// appendRecordV0 is the first draft of the format, kept for the tests to
+// catch: it writes ID as 32 bits, which every example anyone wrote by hand
+// fits in. A property test finds the ID that doesn't, and rapid shrinks
+// it to exactly 1<<32
+func appendRecordV0(dst []byte, r record) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(r.ID))
+	return appendRecord(dst, record{Name: r.Name, Score: r.Score, Tags: r.Tags, Active: r.Active})
+}
+
+func readRecordV0(b []byte) (record, []byte, error) {
+	if len(b) < 4 {
+		return record{}, nil, errShortRecord
+	}
+	id := binary.BigEndian.Uint32(b)
+	r, rest, err := readRecord(b[4:])
+	r.ID = uint64(id)
+	return r, rest, err
+}
+
+/*
+ *
+ * models
+ *
+ */
+
+// lruModel is the LRU from concepts/lru written the slow, obvious way: keys
+// in a slice, most recently used first. Every operation is O(n), and
+// there's no list or map to keep in step with each other - which is where
+// the real one could go wrong
+type lruModel struct {
+	capacity int
+	keys     []int
+	values   map[int]int
+}
+
+func newLRUModel(capacity int) *lruModel {
+	return &lruModel{capacity: capacity, values: map[int]int{}}
+}
+
+func (m *lruModel) get(k int) (int, bool) {
+	v, ok := m.values[k]
+	if ok {
+		m.touch(k)
+	}
+	return v, ok
+}
+
+func (m *lruModel) put(k, v int) {
+	if _, ok := m.values[k]; !ok && len(m.keys) == m.capacity {
+		oldest := m.keys[len(m.keys)-1]
+		m.keys = m.keys[:len(m.keys)-1]
+		delete(m.values, oldest)
+	}
+	m.values[k] = v
+	m.touch(k)
+}
+
+func (m *lruModel) delete(k int) bool {
+	_, ok := m.values[k]
+	if ok {
+		delete(m.values, k)
+		m.keys = slices.DeleteFunc(m.keys, func(x int) bool { return x == k })
+	}
+	return ok
+}
+
+// touch moves k to the front
+func (m *lruModel) touch(k int) {
+	m.keys = slices.DeleteFunc(m.keys, func(x int) bool { return x == k })
+	m.keys = slices.Insert(m.keys, 0, k)
+}
+
+// longestPrefix is the model for Trie.LongestPrefix: try every key. It
+// returns the length of the longest key that s starts with
+func longestPrefix(keys []string, s string) (n int, ok bool) {
+	for _, k := range keys {
+		if len(k) <= len(s) && s[:len(k)] == k && (!ok || len(k) > n) {
+			n, ok = len(k), true
+		}
+	}
+	return n, ok
+}
@@ -0,0 +1,451 @@
+package quick
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+	"testing/quick"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"pgregory.net/rapid"
+
+	"github.com/thorntonmc/go-practice/concepts/lru"
+	"github.com/thorntonmc/go-practice/pkg/trie"
+)
+
+/*
+ *
+ * testing/quick
+ *
+ */
+
+// quickConfig seeds testing/quick from QUICK_SEED, or the clock, and logs
+// the seed so a failure can be run again with QUICK_SEED set
+func quickConfig(t *testing.T) *quick.Config {
+	seed := time.Now().UnixNano()
+	if s := os.Getenv("QUICK_SEED"); s != "" {
+		var err error
+		seed, err = strconv.ParseInt(s, 10, 64)
+		require.NoError(t, err)
+	}
+	t.Logf("QUICK_SEED=%d", seed)
+	return &quick.Config{MaxCount: 500, Rand: rand.New(rand.NewSource(seed))}
+}
+
+func TestQuickBinaryRoundTrip(t *testing.T) {
+	// quick builds each record by reflection: random uint64, random
+	// unicode Name, up to 50 random Tags - and sometimes an empty Tags,
+	// which comes back nil
+	roundTrip := func(r record) bool {
+		got, rest, err := readRecord(appendRecord(nil, r))
+		return err == nil && len(rest) == 0 && cmp.Equal(got, r, sameRecord)
+	}
+	assert.NoError(t, quick.Check(roundTrip, quickConfig(t)))
+}
+
+func TestQuickGarbage(t *testing.T) {
+	// any bytes at all: an error is fine, a panic isn't. A []byte from
+	// quick is up to 50 random bytes, which mostly fail on the first
+	// length - the rapid version below does better
+	noPanic := func(b []byte) bool {
+		readRecord(b)
+		return true
+	}
+	assert.NoError(t, quick.Check(noPanic, quickConfig(t)))
+}
+
+func TestQuickCheckEqual(t *testing.T) {
+	// CheckEqual runs two funcs on the same random arguments and wants the
+	// same results - here the trie against the brute force model
+	fromTrie := func(keys []string, s string) (int, bool) {
+		var tr trie.Trie[byte, bool]
+		for _, k := range keys {
+			tr.Put([]byte(k), true)
+		}
+		n, _, ok := tr.LongestPrefix([]byte(s))
+		return n, ok
+	}
+
+	// with quick's own strings it passes, and proves little: random
+	// unicode keys never prefix each other, so the answer is always "no".
+	// Values replaces the generator with one drawing from "ab"
+	cfg := quickConfig(t)
+	cfg.Values = func(args []reflect.Value, r *rand.Rand) {
+		keys := make([]string, r.Intn(6))
+		for i := range keys {
+			keys[i] = randomAB(r, 4)
+		}
+		args[0] = reflect.ValueOf(keys)
+		args[1] = reflect.ValueOf(randomAB(r, 6))
+	}
+	assert.NoError(t, quick.CheckEqual(fromTrie, longestPrefix, cfg))
+}
+
+func randomAB(r *rand.Rand, max int) string {
+	b := make([]byte, r.Intn(max+1))
+	for i := range b {
+		b[i] = "ab"[r.Intn(2)]
+	}
+	return string(b)
+}
+
+func TestQuickNoShrinking(t *testing.T) {
+	roundTrip := func(r record) bool {
+		got, _, err := readRecordV0(appendRecordV0(nil, r))
+		return err == nil && got.ID == r.ID
+	}
+
+	// a fixed seed makes the run - and the counterexample - the same every
+	// time. quick's random uint64s are nearly all over 32 bits, so the
+	// first try fails, with whatever else it happened to generate
+	check := func() *quick.CheckError {
+		err := quick.Check(roundTrip, &quick.Config{Rand: rand.New(rand.NewSource(1))})
+		var ce *quick.CheckError
+		require.True(t, errors.As(err, &ce), "want a CheckError, got %v", err)
+		return ce
+	}
+	ce := check()
+	assert.Equal(t, 1, ce.Count)
+	bad := ce.In[0].(record)
+	assert.Greater(t, bad.ID, uint64(math.MaxUint32))
+	assert.True(t, bad.Name != "" || len(bad.Tags) > 0, "noise in the fields that don't matter: %+v", bad)
+
+	assert.Equal(t, ce.In, check().In, "same seed, same counterexample")
+}
+
+/*
+ *
+ * rapid
+ *
+ */
+
+// sameRecord is equality as the codecs can keep it: NaN is NaN, and no
+// tags is no tags whether they're nil or empty
+var sameRecord = cmp.Options{cmpopts.EquateNaNs(), cmpopts.EquateEmpty()}
+
+// recordGen builds records field by field. The name is arbitrary bytes a
+// quarter of the time - rapid.String is always valid UTF-8 - and the score
+// can be anything rapid.Float64 likes, NaN and infinities included
+var recordGen = rapid.Custom(func(t *rapid.T) record {
+	r := record{
+		ID:     rapid.Uint64().Draw(t, "id"),
+		Name:   rapid.String().Draw(t, "name"),
+		Score:  rapid.Float64().Draw(t, "score"),
+		Tags:   rapid.SliceOfN(rapid.String(), 0, 5).Draw(t, "tags"),
+		Active: rapid.Bool().Draw(t, "active"),
+	}
+	if rapid.IntRange(0, 3).Draw(t, "raw") == 0 {
+		r.Name = string(rapid.SliceOf(rapid.Byte()).Draw(t, "rawName"))
+	}
+	if rapid.Bool().Draw(t, "special") {
+		r.Score = rapid.SampledFrom([]float64{math.NaN(), math.Inf(1), math.Inf(-1), math.Copysign(0, -1)}).Draw(t, "specialScore")
+	}
+	return r
+})
+
+func TestRapidBinaryRoundTrip(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		r := recordGen.Draw(t, "r")
+		got, rest, err := readRecord(appendRecord(nil, r))
+		require.NoError(t, err)
+		assert.Empty(t, rest)
+		// bits, not ==, so NaN counts as itself and -0 isn't 0
+		assert.Equal(t, math.Float64bits(r.Score), math.Float64bits(got.Score))
+		assert.True(t, cmp.Equal(r, got, sameRecord), cmp.Diff(r, got, sameRecord))
+	})
+}
+
+func TestRapidBinaryStream(t *testing.T) {
+	// records back to back come apart where they were put together
+	rapid.Check(t, func(t *rapid.T) {
+		rs := rapid.SliceOfN(recordGen, 0, 8).Draw(t, "rs")
+		var b []byte
+		for _, r := range rs {
+			b = appendRecord(b, r)
+		}
+		for i := range rs {
+			var err error
+			var got record
+			got, b, err = readRecord(b)
+			require.NoError(t, err, "record %d", i)
+			assert.True(t, cmp.Equal(rs[i], got, sameRecord), "record %d: %s", i, cmp.Diff(rs[i], got, sameRecord))
+		}
+		assert.Empty(t, b)
+	})
+}
+
+func TestRapidGarbage(t *testing.T) {
+	// a valid record with a few bytes changed or cut off the end is closer
+	// to real corruption than random bytes, and gets past the first length
+	rapid.Check(t, func(t *rapid.T) {
+		b := appendRecord(nil, recordGen.Draw(t, "r"))
+		for _, i := range rapid.SliceOfN(rapid.IntRange(0, len(b)-1), 0, 3).Draw(t, "flips") {
+			b[i] = rapid.Byte().Draw(t, "byte")
+		}
+		b = b[:rapid.IntRange(0, len(b)).Draw(t, "cut")]
+		readRecord(b)
+	})
+}
+
+func TestRapidJSON(t *testing.T) {
+	// the property says what JSON actually guarantees, rather than a
+	// round trip it doesn't
+	rapid.Check(t, func(t *rapid.T) {
+		r := recordGen.Draw(t, "r")
+		got, err := jsonRoundTrip(r)
+
+		if math.IsNaN(r.Score) || math.IsInf(r.Score, 0) {
+			assert.ErrorContains(t, err, "unsupported value")
+			return
+		}
+		require.NoError(t, err)
+		if !utf8.ValidString(r.Name) {
+			assert.NotEqual(t, r.Name, got.Name)
+			assert.True(t, utf8.ValidString(got.Name))
+			assert.Contains(t, got.Name, "�")
+			got.Name = r.Name
+		}
+		assert.Equal(t, r, got)
+	})
+}
+
+func TestRapidGob(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		r := recordGen.Draw(t, "r")
+		got, err := gobRoundTrip(r)
+		require.NoError(t, err)
+
+		// gob keeps every float and every byte, but an empty slice isn't
+		// sent, so it comes back nil - equal only if empty counts as empty
+		assert.True(t, cmp.Equal(r, got, sameRecord), cmp.Diff(r, got, sameRecord))
+		if r.Tags != nil && len(r.Tags) == 0 {
+			assert.Nil(t, got.Tags)
+		}
+	})
+}
+
+/*
+ *
+ * shrinking
+ *
+ */
+
+// capture is a rapid.TB that keeps failures to itself, so a test can make
+// a property fail on purpose and look at what rapid reports
+type capture struct {
+	*testing.T
+	failed bool
+	msgs   []string
+}
+
+func (c *capture) Logf(string, ...any)            {}
+func (c *capture) Log(...any)                     {}
+func (c *capture) Errorf(format string, a ...any) { c.Error(fmt.Sprintf(format, a...)) }
+func (c *capture) Error(a ...any)                 { c.failed = true; c.msgs = append(c.msgs, fmt.Sprint(a...)) }
+func (c *capture) Fatalf(format string, a ...any) { c.Errorf(format, a...) }
+func (c *capture) Fatal(a ...any)                 { c.Error(a...) }
+func (c *capture) Fail()                          { c.failed = true }
+func (c *capture) FailNow()                       { c.failed = true }
+func (c *capture) Failed() bool                   { return c.failed }
+
+// failQuietly runs a property that's meant to fail, from a fixed seed.
+// Shrinking is a search, and from some starting points it stops short of
+// the smallest input - the seed makes it land in the same place every run.
+// And rapid saves every failure under testdata/rapid to replay it later,
+// which for a failure that's the point of the test would be litter
+func failQuietly(t *testing.T, prop func(*rapid.T)) *capture {
+	for name, value := range map[string]string{"rapid.seed": "1", "rapid.nofailfile": "true"} {
+		name, old := name, flag.Lookup(name).Value.String()
+		require.NoError(t, flag.Set(name, value))
+		t.Cleanup(func() { flag.Set(name, old) })
+	}
+
+	c := &capture{T: t}
+	rapid.Check(c, prop)
+	return c
+}
+
+func TestRapidShrinksV0(t *testing.T) {
+	// the same bug testing/quick found above. rapid finds it, then shrinks:
+	// every field that doesn't matter goes to its simplest value, and the
+	// one that does goes to the smallest that still fails. The run it
+	// reports last is the shrunk one
+	var last record
+	c := failQuietly(t, func(t *rapid.T) {
+		r := recordGen.Draw(t, "r")
+		got, _, err := readRecordV0(appendRecordV0(nil, r))
+		if err != nil || got.ID != r.ID {
+			last = r
+			t.Fatalf("ID %d came back %d", r.ID, got.ID)
+		}
+	})
+
+	require.True(t, c.failed)
+	assert.Equal(t, uint64(1<<32), last.ID, "the smallest ID that doesn't fit in 32 bits")
+	// and nothing else. Score isn't checked: what counts as the simplest
+	// float is up to rapid
+	assert.Empty(t, last.Name)
+	assert.Empty(t, last.Tags)
+	assert.False(t, last.Active)
+	// and how to run exactly this again
+	assert.Regexp(t, `-rapid\.seed=\d+`, c.msgs[0])
+	assert.Contains(t, c.msgs[0], "ID 4294967296 came back 0")
+}
+
+func TestRapidShrinksSequences(t *testing.T) {
+	// shrinking works on whole sequences too. This "cache" forgets
+	// everything on its fourth distinct key - rapid cuts whatever long
+	// random run found that down to four puts and the get that notices
+	var last []string
+	c := failQuietly(t, func(t *rapid.T) {
+		var steps []string
+		seen := map[int]bool{}
+		stored := map[int]bool{}
+		t.Repeat(map[string]func(*rapid.T){
+			"put": func(t *rapid.T) {
+				k := rapid.IntRange(0, 9).Draw(t, "k")
+				steps = append(steps, fmt.Sprint("put ", k))
+				if seen[k] = true; len(seen) == 4 {
+					clear(stored)
+				}
+				stored[k] = true
+			},
+			"get": func(t *rapid.T) {
+				k := rapid.IntRange(0, 9).Draw(t, "k")
+				steps = append(steps, fmt.Sprint("get ", k))
+				if seen[k] && !stored[k] {
+					last = steps
+					t.Fatalf("lost %d", k)
+				}
+			},
+		})
+	})
+
+	require.True(t, c.failed)
+	require.Len(t, last, 5, "%v", last)
+	assert.Equal(t, "get", last[4][:3])
+}
+
+/*
+ *
+ * models
+ *
+ */
+
+func TestRapidLRU(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		capacity := rapid.IntRange(1, 5).Draw(t, "capacity")
+		c := lru.New[int, int](capacity)
+		m := newLRUModel(capacity)
+		// few keys, so gets hit and puts replace and evict
+		key := rapid.IntRange(0, 2*capacity)
+
+		t.Repeat(map[string]func(*rapid.T){
+			"put": func(t *rapid.T) {
+				k, v := key.Draw(t, "k"), rapid.Int().Draw(t, "v")
+				c.Put(k, v)
+				m.put(k, v)
+			},
+			"get": func(t *rapid.T) {
+				k := key.Draw(t, "k")
+				v, ok := c.Get(k)
+				mv, mok := m.get(k)
+				require.Equal(t, mok, ok, "Get(%d)", k)
+				require.Equal(t, mv, v, "Get(%d)", k)
+			},
+			"delete": func(t *rapid.T) {
+				k := key.Draw(t, "k")
+				require.Equal(t, m.delete(k), c.Delete(k), "Delete(%d)", k)
+			},
+			// "" runs after every step: the invariants
+			"": func(t *rapid.T) {
+				require.LessOrEqual(t, c.Len(), capacity)
+				keys := c.Keys()
+				require.True(t, slices.Equal(m.keys, keys), "keys %v, model %v", keys, m.keys)
+			},
+		})
+	})
+}
+
+func TestRapidTrie(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		var tr trie.Trie[byte, int]
+		m := map[string]int{}
+		// from "ab", so keys share prefixes and one is often a prefix of
+		// another. The empty key is a key too
+		key := rapid.StringMatching(`[ab]{0,4}`)
+
+		t.Repeat(map[string]func(*rapid.T){
+			"put": func(t *rapid.T) {
+				k, v := key.Draw(t, "k"), rapid.Int().Draw(t, "v")
+				_, had := m[k]
+				m[k] = v
+				require.Equal(t, had, tr.Put([]byte(k), v), "Put(%q)", k)
+			},
+			"get": func(t *rapid.T) {
+				k := key.Draw(t, "k")
+				v, ok := tr.Get([]byte(k))
+				mv, mok := m[k]
+				require.Equal(t, mok, ok, "Get(%q)", k)
+				require.Equal(t, mv, v, "Get(%q)", k)
+			},
+			"delete": func(t *rapid.T) {
+				k := key.Draw(t, "k")
+				_, had := m[k]
+				delete(m, k)
+				require.Equal(t, had, tr.Delete([]byte(k)), "Delete(%q)", k)
+			},
+			"longestPrefix": func(t *rapid.T) {
+				s := rapid.StringMatching(`[ab]{0,6}`).Draw(t, "s")
+				n, v, ok := tr.LongestPrefix([]byte(s))
+				mn, mok := longestPrefix(mapKeys(m), s)
+				require.Equal(t, mok, ok, "LongestPrefix(%q)", s)
+				require.Equal(t, mn, n, "LongestPrefix(%q)", s)
+				if ok {
+					require.Equal(t, m[s[:n]], v)
+				}
+			},
+			"walkPrefix": func(t *rapid.T) {
+				p := key.Draw(t, "p")
+				var got, want []string
+				tr.WalkPrefix([]byte(p), func(k []byte, v int) bool {
+					got = append(got, string(k))
+					return true
+				})
+				for k := range m {
+					if len(k) >= len(p) && k[:len(p)] == p {
+						want = append(want, k)
+					}
+				}
+				sort.Strings(got)
+				sort.Strings(want)
+				require.Equal(t, want, got, "WalkPrefix(%q)", p)
+			},
+			"": func(t *rapid.T) {
+				require.Equal(t, len(m), tr.Len())
+			},
+		})
+	})
+}
+
+func mapKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,123 @@
+package raceconditions
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// A data race is two goroutines touching the same memory at the same time,
+// with at least one of them writing, and nothing ordering the two. The result
+// isn't just a wrong number now and then - the Go memory model makes no
+// promises at all about a racy program.
+//
+// The race detector finds them while the code runs: go test -race. It only
+// sees races that actually happen during the run, so the tests have to
+// exercise the concurrent paths.
+//
+// Each race below comes with a fixed version. The tests for the fixed ones
+// always run, the ones for the buggy ones only with the racy build tag:
+//
+//	go test -race ./concepts/raceconditions/...             # passes
+//	go test -race -tags racy ./concepts/raceconditions/...  # fails, on purpose
+
+/*
+ *
+ * the unsynchronized counter
+ *
+ */
+
+// n++ is a read, an add and a write. Two goroutines can both read 5 and both
+// write 6
+type racyCounter struct {
+	n int
+}
+
+func (c *racyCounter) Inc()       { c.n++ }
+func (c *racyCounter) Value() int { return c.n }
+
+// An atomic makes the read-add-write a single indivisible step. A mutex would
+// work just as well, and is the answer once there's more than one field
+type counter struct {
+	n int64
+}
+
+func (c *counter) Inc()       { atomic.AddInt64(&c.n, 1) }
+func (c *counter) Value() int { return int(atomic.LoadInt64(&c.n)) }
+
+/*
+ *
+ * check-then-act
+ *
+ */
+
+// Maps aren't safe for concurrent use at all - this can crash with
+// "concurrent map writes". But even with each map operation locked on its own,
+// the check and the act are separate steps: two goroutines can both see the
+// key is missing and both call create
+type racyRegistry struct {
+	items  map[string]int
+	create func(string) int
+}
+
+func (r *racyRegistry) GetOrCreate(key string) int {
+	if v, ok := r.items[key]; ok {
+		return v
+	}
+	v := r.create(key)
+	r.items[key] = v
+	return v
+}
+
+// The fix holds one lock across both the check and the act
+type registry struct {
+	mu     sync.Mutex
+	items  map[string]int
+	create func(string) int
+}
+
+func (r *registry) GetOrCreate(key string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.items[key]; ok {
+		return v
+	}
+	v := r.create(key)
+	r.items[key] = v
+	return v
+}
+
+/*
+ *
+ * lazy initialization
+ *
+ */
+
+// The classic "if it's nil, make it" races on the nil check, and can run init
+// more than once
+type racyLazy struct {
+	config map[string]string
+	init   func() map[string]string
+}
+
+func (l *racyLazy) Get() map[string]string {
+	if l.config == nil {
+		l.config = l.init()
+	}
+	return l.config
+}
+
+// sync.Once runs init exactly once, and every caller of Do waits for it to
+// finish - so they all see the result
+type lazy struct {
+	once   sync.Once
+	config map[string]string
+	init   func() map[string]string
+}
+
+func (l *lazy) Get() map[string]string {
+	l.once.Do(func() {
+		l.config = l.init()
+	})
+	return l.config
+}
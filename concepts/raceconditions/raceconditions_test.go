@@ -0,0 +1,66 @@
+package raceconditions
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const goroutines = 50
+
+// concurrently calls fn from many goroutines, all released at once to make
+// the interleaving as likely as possible
+func concurrently(fn func(i int)) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+}
+
+func TestCounter(t *testing.T) {
+	var c counter
+	concurrently(func(int) {
+		for j := 0; j < 100; j++ {
+			c.Inc()
+		}
+	})
+	assert.Equal(t, goroutines*100, c.Value())
+}
+
+func TestRegistry(t *testing.T) {
+	var creates int32
+	r := &registry{items: map[string]int{}, create: func(k string) int {
+		atomic.AddInt32(&creates, 1)
+		n, _ := strconv.Atoi(k)
+		return n
+	}}
+
+	concurrently(func(i int) {
+		r.GetOrCreate(strconv.Itoa(i % 5))
+	})
+	assert.Equal(t, int32(5), creates)
+}
+
+func TestLazy(t *testing.T) {
+	var inits int32
+	l := &lazy{init: func() map[string]string {
+		atomic.AddInt32(&inits, 1)
+		return map[string]string{"env": "test"}
+	}}
+
+	concurrently(func(int) {
+		assert.Equal(t, "test", l.Get()["env"])
+	})
+	assert.Equal(t, int32(1), inits)
+}
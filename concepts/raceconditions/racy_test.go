@@ -0,0 +1,42 @@
+//go:build racy
+
+package raceconditions
+
+import (
+	"strconv"
+	"testing"
+)
+
+// These tests are supposed to fail under -race. Without -race they may well
+// pass, which is exactly why races are dangerous
+
+func TestRacyCounter(t *testing.T) {
+	var c racyCounter
+	concurrently(func(int) {
+		for j := 0; j < 100; j++ {
+			c.Inc()
+		}
+	})
+	t.Logf("counted %d of %d", c.Value(), goroutines*100)
+}
+
+func TestRacyRegistry(t *testing.T) {
+	r := &racyRegistry{items: map[string]int{}, create: func(k string) int {
+		n, _ := strconv.Atoi(k)
+		return n
+	}}
+
+	concurrently(func(i int) {
+		r.GetOrCreate(strconv.Itoa(i % 5))
+	})
+}
+
+func TestRacyLazy(t *testing.T) {
+	l := &racyLazy{init: func() map[string]string {
+		return map[string]string{"env": "test"}
+	}}
+
+	concurrently(func(int) {
+		_ = l.Get()["env"]
+	})
+}
@@ -0,0 +1,257 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/lru"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// Two common ways to say "at most N requests per period", which differ in
+// how they treat bursts:
+//
+//   - a token bucket holds up to burst tokens and refills at a steady rate.
+//     Each request takes a token. A client that's been quiet can spend its
+//     whole bucket at once, then is held to the refill rate - bursty, but
+//     the long run average is exact
+//   - a sliding window counts requests in the last period. A fixed window
+//     (count per calendar minute) lets a client make N requests at 0:59 and
+//     N more at 1:00; sliding the window smooths that edge away
+//
+// Both answer Allow with whether the request may go ahead and, if not, how
+// long until one would - what a 429's Retry-After header wants
+
+// Limiter is what both algorithms implement
+type Limiter interface {
+	Allow() (ok bool, retryAfter time.Duration)
+}
+
+/*
+ *
+ * token bucket
+ *
+ */
+
+// TokenBucket is safe for concurrent use
+type TokenBucket struct {
+	rate  float64 // tokens per second
+	burst float64
+	clk   clock.Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket allows rate requests per second on average, and up to burst
+// at once. The bucket starts full. It panics if rate isn't positive: a bucket
+// that never refills would work out its Retry-After by dividing by zero, and
+// say to wait forever - or a negative time
+func NewTokenBucket(rate float64, burst int, clk clock.Clock) *TokenBucket {
+	if !(rate > 0) {
+		panic(fmt.Sprintf("ratelimit: token bucket rate must be positive, got %v", rate))
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		clk:    clk,
+		tokens: float64(burst),
+		last:   clk.Now(),
+	}
+}
+
+// Allow takes a token if there is one. There's no background goroutine
+// topping the bucket up: each call works out how many tokens the time since
+// the last call has earned, capped at burst
+func (b *TokenBucket) Allow() (bool, time.Duration) {
+	return b.AllowN(1)
+}
+
+// AllowN takes n tokens if there are that many, or none. Tokens don't have
+// to mean requests: count bytes and the bucket limits bandwidth, see
+// throttle.go. More than burst never fits, however long the wait
+func (b *TokenBucket) AllowN(n int) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clk.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	need := float64(n)
+	if b.tokens >= need {
+		b.tokens -= need
+		return true, 0
+	}
+	wait := (need - b.tokens) / b.rate
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
+
+// ErrExceedsBurst is WaitN being asked for more tokens than the bucket holds
+var ErrExceedsBurst = errors.New("ratelimit: more tokens than the burst")
+
+// WaitN blocks until it can take n tokens, or ctx is done. Waiters aren't
+// queued: whoever asks first after the bucket refills gets in, so under
+// contention a big request can lose out to small ones
+func (b *TokenBucket) WaitN(ctx context.Context, n int) error {
+	if float64(n) > b.burst {
+		return fmt.Errorf("%w: %d > %v", ErrExceedsBurst, n, b.burst)
+	}
+	for {
+		ok, wait := b.AllowN(n)
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.clk.After(wait):
+		}
+	}
+}
+
+/*
+ *
+ * sliding window
+ *
+ */
+
+// SlidingWindow approximates a true sliding window with two fixed windows:
+// the count for the current one, and the previous one's count weighted by
+// how much of it still overlaps the sliding window. 40% of the way into the
+// current minute, the estimate is
+//
+//	previous * 0.6 + current
+//
+// Keeping a timestamp per request (a sliding log) would be exact, but costs
+// memory per request rather than two integers. The approximation assumes
+// the previous window's requests were spread evenly, which is close enough
+// in practice
+type SlidingWindow struct {
+	limit  uint64
+	window time.Duration
+	clk    clock.Clock
+
+	mu          sync.Mutex
+	start       time.Time // of the current fixed window
+	prev, count uint64
+}
+
+// NewSlidingWindow allows limit requests in any window long period
+func NewSlidingWindow(limit int, window time.Duration, clk clock.Clock) *SlidingWindow {
+	if limit < 1 {
+		limit = 1
+	}
+	return &SlidingWindow{
+		limit:  uint64(limit),
+		window: window,
+		clk:    clk,
+		start:  clk.Now(),
+	}
+}
+
+func (w *SlidingWindow) Allow() (bool, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.clk.Now()
+	w.advance(now)
+	elapsed := uint64(now.Sub(w.start))
+	win := uint64(w.window)
+
+	// allowed if prev*(window-elapsed)/window + count + 1 <= limit. Kept in
+	// integers, multiplied through by window, since floats get the exact
+	// boundary wrong - and in 128 bits, since nanoseconds times a count can
+	// overflow 64
+	if w.count < w.limit && mulLE(w.prev, win-elapsed, w.limit-w.count-1, win) {
+		w.count++
+		return true, 0
+	}
+	return false, w.retryAfter(now, elapsed)
+}
+
+// advance rolls the fixed windows forward to the one containing now
+func (w *SlidingWindow) advance(now time.Time) {
+	passed := now.Sub(w.start) / w.window
+	switch {
+	case passed <= 0:
+		return
+	case passed == 1:
+		w.prev = w.count
+	default:
+		w.prev = 0 // a whole window went by with nothing
+	}
+	w.count = 0
+	w.start = w.start.Add(passed * w.window)
+}
+
+// retryAfter solves the Allow condition for the earliest time it holds
+func (w *SlidingWindow) retryAfter(now time.Time, elapsed uint64) time.Duration {
+	win := uint64(w.window)
+
+	if w.count < w.limit {
+		// the previous window's weight has to fall far enough:
+		// prev*(window-e) <= (limit-count-1)*window
+		room := w.limit - w.count - 1
+		e := win - room*win/w.prev
+		return time.Duration(e - elapsed)
+	}
+
+	// this window is full by itself, so wait for the next one, where this
+	// window's count is the one decaying
+	room := w.limit - 1
+	e := win - room*win/w.count
+	return time.Duration(win-elapsed) + time.Duration(e)
+}
+
+// mulLE reports whether a*b <= c*d without overflowing
+func mulLE(a, b, c, d uint64) bool {
+	hi1, lo1 := bits.Mul64(a, b)
+	hi2, lo2 := bits.Mul64(c, d)
+	return hi1 < hi2 || hi1 == hi2 && lo1 <= lo2
+}
+
+/*
+ *
+ * per client
+ *
+ */
+
+// Keyed gives every key - usually a client IP or API key - its own Limiter,
+// created on first use. The limiters live in an LRU so a flood of distinct
+// keys can't grow memory without bound; a key evicted and seen again starts
+// with a fresh limiter, which is the price of the bound
+type Keyed struct {
+	newLimiter func() Limiter
+
+	mu       sync.Mutex
+	limiters *lru.Cache[string, Limiter]
+}
+
+// NewKeyed keeps up to capacity limiters made by newLimiter
+func NewKeyed(capacity int, newLimiter func() Limiter) *Keyed {
+	return &Keyed{newLimiter: newLimiter, limiters: lru.New[string, Limiter](capacity)}
+}
+
+// Allow checks key's limiter. It has the signature the httplimit.RateLimit
+// middleware wants
+func (k *Keyed) Allow(key string) (bool, time.Duration) {
+	k.mu.Lock()
+	l, ok := k.limiters.Get(key)
+	if !ok {
+		l = k.newLimiter()
+		k.limiters.Put(key, l)
+	}
+	k.mu.Unlock()
+
+	return l.Allow()
+}
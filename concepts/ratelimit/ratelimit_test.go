@@ -0,0 +1,244 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"github.com/thorntonmc/go-practice/pkg/httplimit"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// allowed counts how many of n calls get through
+func allowed(l Limiter, n int) int {
+	got := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := l.Allow(); ok {
+			got++
+		}
+	}
+	return got
+}
+
+func TestTokenBucket(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	b := NewTokenBucket(4, 3, clk) // a token every 250ms
+
+	assert.Equal(t, 3, allowed(b, 3), "starts full")
+	ok, wait := b.Allow()
+	assert.False(t, ok)
+	assert.Equal(t, 250*time.Millisecond, wait)
+
+	// half a token
+	clk.Advance(125 * time.Millisecond)
+	ok, wait = b.Allow()
+	assert.False(t, ok)
+	assert.Equal(t, 125*time.Millisecond, wait)
+
+	clk.Advance(125 * time.Millisecond)
+	assert.Equal(t, 1, allowed(b, 5))
+
+	// a long quiet spell only refills up to burst
+	clk.Advance(time.Hour)
+	assert.Equal(t, 3, allowed(b, 10))
+}
+
+func TestTokenBucketLongRunRate(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	b := NewTokenBucket(4, 3, clk)
+
+	// hammer it every 10ms for 10s: the burst, then 4 a second
+	got := 0
+	for i := 0; i < 1000; i++ {
+		got += allowed(b, 1)
+		clk.Advance(10 * time.Millisecond)
+	}
+	assert.InDelta(t, 3+40, got, 1)
+}
+
+func TestTokenBucketRate(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	for _, rate := range []float64{0, -1, math.NaN()} {
+		assert.Panics(t, func() { NewTokenBucket(rate, 1, clk) }, "%v", rate)
+	}
+	assert.NotPanics(t, func() { NewTokenBucket(0.001, 1, clk) })
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	w := NewSlidingWindow(10, time.Minute, clk)
+
+	assert.Equal(t, 10, allowed(w, 10))
+	ok, wait := w.Allow()
+	assert.False(t, ok)
+	// the next window starts in 60s, then the full previous one has to
+	// decay to 9 - another 6s
+	assert.Equal(t, 66*time.Second, wait)
+
+	clk.Advance(time.Minute)
+	ok, wait = w.Allow()
+	assert.False(t, ok, "the previous window still counts in full")
+	assert.Equal(t, 6*time.Second, wait)
+
+	// exactly on the boundary: 10*(54/60) + 0 + 1 = 10
+	clk.Advance(6 * time.Second)
+	assert.Equal(t, 1, allowed(w, 5))
+
+	ok, wait = w.Allow()
+	assert.False(t, ok)
+	assert.Equal(t, 6*time.Second, wait, "10*(1-e/60) + 1 + 1 <= 10 at e=12s")
+	clk.Advance(6 * time.Second)
+	assert.Equal(t, 1, allowed(w, 5))
+
+	// two whole windows of quiet forget everything
+	clk.Advance(2 * time.Minute)
+	assert.Equal(t, 10, allowed(w, 20))
+}
+
+// A fixed window would let a client spend its limit at 0:59 and again at
+// 1:00. The sliding window doesn't
+func TestSlidingWindowBoundary(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	w := NewSlidingWindow(10, time.Minute, clk)
+
+	clk.Advance(59 * time.Second)
+	assert.Equal(t, 10, allowed(w, 10))
+	clk.Advance(time.Second)
+	assert.Equal(t, 0, allowed(w, 10))
+
+	// halfway through, half the previous window has slid out
+	clk.Advance(30 * time.Second)
+	assert.Equal(t, 5, allowed(w, 10))
+}
+
+func TestMulLE(t *testing.T) {
+	big := uint64(1) << 63
+	assert.True(t, mulLE(big, 2, big, 2))
+	assert.True(t, mulLE(big, 2, big, 3))
+	assert.False(t, mulLE(big, 3, big, 2), "needs the high bits")
+	assert.True(t, mulLE(0, 5, 0, 1))
+}
+
+func TestKeyed(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	k := NewKeyed(2, func() Limiter { return NewTokenBucket(1, 2, clk) })
+
+	allow := func(key string, n int) int {
+		got := 0
+		for i := 0; i < n; i++ {
+			if ok, _ := k.Allow(key); ok {
+				got++
+			}
+		}
+		return got
+	}
+
+	assert.Equal(t, 2, allow("a", 5))
+	assert.Equal(t, 2, allow("b", 5), "each key has its own bucket")
+	assert.Equal(t, 0, allow("a", 1))
+
+	// a third key evicts the least recently used, b, which comes back fresh
+	assert.Equal(t, 2, allow("c", 5))
+	assert.Equal(t, 2, allow("b", 5))
+}
+
+// TestUnderLoad puts each limiter behind the middleware and fires 100
+// concurrent requests at the same instant. Both let exactly 10 through -
+// the difference shows half a second later
+func TestUnderLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		limiter   func(clock.Clock) Limiter
+		halfLater int
+	}{
+		{"token bucket", func(clk clock.Clock) Limiter { return NewTokenBucket(10, 10, clk) }, 5},
+		{"sliding window", func(clk clock.Clock) Limiter { return NewSlidingWindow(10, time.Second, clk) }, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(epoch)
+			keyed := NewKeyed(100, func() Limiter { return tt.limiter(clk) })
+			h := httplimit.RateLimit(keyed, httplimit.ClientIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			srv := httptest.NewServer(h)
+			defer srv.Close()
+
+			burst := func(n int) (ok, limited int32) {
+				var wg sync.WaitGroup
+				for i := 0; i < n; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						resp, err := srv.Client().Get(srv.URL)
+						if err != nil {
+							return
+						}
+						resp.Body.Close()
+						if resp.StatusCode == http.StatusOK {
+							atomic.AddInt32(&ok, 1)
+						} else if resp.StatusCode == http.StatusTooManyRequests {
+							atomic.AddInt32(&limited, 1)
+						}
+					}()
+				}
+				wg.Wait()
+				return ok, limited
+			}
+
+			ok, limited := burst(100)
+			assert.Equal(t, int32(10), ok)
+			assert.Equal(t, int32(90), limited)
+
+			clk.Advance(500 * time.Millisecond)
+			ok, _ = burst(20)
+			assert.Equal(t, int32(tt.halfLater), ok)
+		})
+	}
+}
+
+func BenchmarkAllow(b *testing.B) {
+	limiters := map[string]Limiter{
+		"token-bucket":   NewTokenBucket(1e9, 1e9, clock.New()),
+		"sliding-window": NewSlidingWindow(1e9, time.Second, clock.New()),
+	}
+	for name, l := range limiters {
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					l.Allow()
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkKeyed(b *testing.B) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprint("10.0.", i/256, ".", i%256)
+	}
+
+	for name, newLimiter := range map[string]func() Limiter{
+		"token-bucket":   func() Limiter { return NewTokenBucket(100, 100, clock.New()) },
+		"sliding-window": func() Limiter { return NewSlidingWindow(100, time.Second, clock.New()) },
+	} {
+		b.Run(name, func(b *testing.B) {
+			k := NewKeyed(len(keys), newLimiter)
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					k.Allow(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
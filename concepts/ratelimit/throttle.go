@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+/*
+ *
+ * throttled readers and writers
+ *
+ */
+
+// A token bucket doesn't care what a token is. Make each one a byte and the
+// rate is bytes per second: a reader or writer takes as many tokens as it
+// moves bytes, and waits when the bucket runs dry. That's bandwidth
+// throttling, the thing behind a download manager's speed limit, or a test
+// that wants to see how a server copes with a client on a bad connection.
+//
+// The burst is the most that goes through in one go, so it's also how big
+// the chunks are: a 32KB Write through a bucket with a 4KB burst becomes
+// eight 4KB writes, spaced out. A smaller burst is smoother, a bigger one
+// is fewer, larger writes. Bandwidth picks a tenth of a second's worth.
+//
+// One bucket can be shared by several readers and writers, and then it caps
+// their total - every download from a server together, say - rather than
+// each on its own
+
+// Bandwidth is a bucket for bytesPerSecond, with a burst of a tenth of a
+// second's worth
+func Bandwidth(bytesPerSecond int, clk clock.Clock) *TokenBucket {
+	return NewTokenBucket(float64(bytesPerSecond), bytesPerSecond/10, clk)
+}
+
+// ThrottledReader reads from r no faster than its bucket allows
+type ThrottledReader struct {
+	ctx context.Context
+	r   io.Reader
+	b   *TokenBucket
+}
+
+// NewThrottledReader stops waiting, and Read returns ctx's error, once ctx
+// is done - a slow download shouldn't outlive the request it's for
+func NewThrottledReader(ctx context.Context, r io.Reader, b *TokenBucket) *ThrottledReader {
+	return &ThrottledReader{ctx: ctx, r: r, b: b}
+}
+
+// Read reads at most a burst's worth, and then waits until the bucket has
+// paid for what it got. Charging after the read means paying for what was
+// actually read, not what was asked for
+func (t *ThrottledReader) Read(p []byte) (int, error) {
+	if max := int(t.b.burst); len(p) > max {
+		p = p[:max]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.b.WaitN(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// ThrottledWriter writes to w no faster than its bucket allows
+type ThrottledWriter struct {
+	ctx context.Context
+	w   io.Writer
+	b   *TokenBucket
+}
+
+// NewThrottledWriter stops waiting, and Write returns ctx's error, once ctx
+// is done
+func NewThrottledWriter(ctx context.Context, w io.Writer, b *TokenBucket) *ThrottledWriter {
+	return &ThrottledWriter{ctx: ctx, w: w, b: b}
+}
+
+// Write waits for tokens for each burst sized chunk of p before writing it
+func (t *ThrottledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), int(t.b.burst))]
+		if err := t.b.WaitN(t.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := t.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
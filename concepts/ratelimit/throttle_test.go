@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+func TestAllowN(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	b := NewTokenBucket(100, 50, clk)
+
+	ok, _ := b.AllowN(30)
+	assert.True(t, ok)
+	ok, wait := b.AllowN(30)
+	assert.False(t, ok, "all or nothing")
+	assert.Equal(t, 100*time.Millisecond, wait, "10 short at 100 a second")
+	ok, _ = b.AllowN(20)
+	assert.True(t, ok, "a failed AllowN took nothing")
+
+	err := b.WaitN(context.Background(), 51)
+	assert.ErrorIs(t, err, ErrExceedsBurst)
+}
+
+func TestWaitN(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	b := NewTokenBucket(100, 50, clk)
+	require.NoError(t, b.WaitN(context.Background(), 50))
+
+	done := make(chan error)
+	go func() { done <- b.WaitN(context.Background(), 25) }()
+	clk.BlockUntil(1)
+	clk.Advance(249 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("WaitN returned early")
+	default:
+	}
+	clk.Advance(time.Millisecond)
+	require.NoError(t, <-done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- b.WaitN(ctx, 25) }()
+	clk.BlockUntil(1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+// timedWriter records the fake time of each write
+type timedWriter struct {
+	clk    clock.Clock
+	buf    bytes.Buffer
+	writes []time.Duration
+	sizes  []int
+}
+
+func (w *timedWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, w.clk.Now().Sub(epoch))
+	w.sizes = append(w.sizes, len(p))
+	return w.buf.Write(p)
+}
+
+// drive advances clk by step each time something waits on it, n times
+func drive(clk *clock.Fake, n int, step time.Duration) {
+	for i := 0; i < n; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(step)
+	}
+}
+
+func TestThrottledWriter(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	b := Bandwidth(1000, clk) // 1000 bytes a second, 100 at a time
+	out := &timedWriter{clk: clk}
+	w := NewThrottledWriter(context.Background(), out, b)
+
+	data := strings.Repeat("x", 1000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := w.Write([]byte(data))
+		assert.NoError(t, err)
+		assert.Equal(t, 1000, n)
+	}()
+	// the first 100 bytes are in the bucket already, the other 900 take
+	// 100ms each
+	drive(clk, 9, 100*time.Millisecond)
+	<-done
+
+	assert.Equal(t, data, out.buf.String())
+	assert.Equal(t, []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 100}, out.sizes)
+	for i, at := range out.writes {
+		assert.Equal(t, time.Duration(i)*100*time.Millisecond, at, "write %d", i)
+	}
+	assert.Zero(t, clk.Waiters())
+}
+
+func TestThrottledReader(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	r := NewThrottledReader(context.Background(), strings.NewReader(strings.Repeat("y", 550)), Bandwidth(1000, clk))
+
+	done := make(chan []byte)
+	go func() {
+		got, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		done <- got
+	}()
+	// six reads: 100 free, then four more at 100ms each and 50 at 50ms
+	drive(clk, 4, 100*time.Millisecond)
+	drive(clk, 1, 50*time.Millisecond)
+	got := <-done
+	assert.Len(t, got, 550)
+	assert.Equal(t, 450*time.Millisecond, clk.Now().Sub(epoch))
+}
+
+func TestThrottledShared(t *testing.T) {
+	// two writers on one bucket share its rate
+	clk := clock.NewFake(epoch)
+	b := Bandwidth(1000, clk)
+	out := &timedWriter{clk: clk}
+	w1 := NewThrottledWriter(context.Background(), out, b)
+	w2 := NewThrottledWriter(context.Background(), out, b)
+
+	_, err := w1.Write(make([]byte, 100))
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w2.Write(make([]byte, 100))
+	}()
+	drive(clk, 1, 100*time.Millisecond)
+	<-done
+	assert.Equal(t, []time.Duration{0, 100 * time.Millisecond}, out.writes, "w2 waited for what w1 spent")
+}
+
+func TestThrottledCancel(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &timedWriter{clk: clk}
+	w := NewThrottledWriter(ctx, out, Bandwidth(1000, clk))
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		n, err := w.Write(make([]byte, 250))
+		done <- result{n, err}
+	}()
+	drive(clk, 1, 100*time.Millisecond)
+	clk.BlockUntil(1)
+	cancel()
+
+	res := <-done
+	assert.ErrorIs(t, res.err, context.Canceled)
+	assert.Equal(t, 200, res.n, "what was written before the cancel is counted")
+	assert.Equal(t, 200, out.buf.Len())
+
+	r := NewThrottledReader(ctx, strings.NewReader(strings.Repeat("z", 300)), Bandwidth(1000, clk))
+	buf := make([]byte, 300)
+	n, err := r.Read(buf)
+	assert.NoError(t, err, "the bucket starts full")
+	assert.Equal(t, 100, n, "a read is cut to the burst")
+	n, err = r.Read(buf)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 100, n, "bytes read before the wait is cut short are still returned")
+}
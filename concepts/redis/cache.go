@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache-aside is the usual way to put a cache in front of something slow:
+// look in the cache, and on a miss load from the source and store the
+// result for next time. The source stays the truth, the cache can be
+// flushed at any moment and everything still works, just slower.
+//
+// The trap is the stampede: a popular key expires, and every request that
+// misses at that moment goes to the source at once. Cache guards against it
+// two ways:
+//
+//   - singleflight, see concepts/singleflight: concurrent misses on a key
+//     in this process share one load. Several processes can still each load
+//     once, which is usually fine - stopping that needs a lock in Redis
+//   - jitter on the TTL: keys written together (after a deploy, say) would
+//     otherwise all expire together
+//
+// Redis being down shouldn't take the service down with it, so a cache
+// error is treated as a miss and the source is asked directly.
+//
+// A load shared by several callers can't use any one caller's context: the
+// first caller giving up would fail everyone else waiting on it. The load
+// runs detached, under its own timeout, and each caller stops waiting when
+// its own context is done
+
+// Cache stores values of type T as JSON under a key prefix
+type Cache[T any] struct {
+	client *Client
+	prefix string
+	ttl    time.Duration
+	jitter float64 // the fraction of ttl that's randomized, in [0, 1)
+
+	loadTimeout time.Duration
+
+	flight singleflight.Group
+	stats  struct{ hits, misses, loads, errors atomic.Int64 }
+}
+
+// CacheOption changes a Cache's defaults
+type CacheOption func(*cacheOptions)
+
+type cacheOptions struct {
+	loadTimeout time.Duration
+}
+
+// WithLoadTimeout limits how long a load may take, 10 seconds by default.
+// The load doesn't end when its callers give up, so this is what does
+func WithLoadTimeout(d time.Duration) CacheOption {
+	return func(o *cacheOptions) { o.loadTimeout = d }
+}
+
+// NewCache returns a cache whose entries live for ttl, give or take
+// jitter*ttl. A jitter of 0.1 spreads expiry over ±10%. It's kept in
+// [0, 1): a jitter of 1 or more could make an expiry of 0, which Redis
+// takes as never
+func NewCache[T any](client *Client, prefix string, ttl time.Duration, jitter float64, opts ...CacheOption) *Cache[T] {
+	o := cacheOptions{loadTimeout: 10 * time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !(jitter > 0) {
+		jitter = 0 // negative, or NaN
+	}
+	jitter = min(jitter, math.Nextafter(1, 0))
+	return &Cache[T]{client: client, prefix: prefix, ttl: ttl, jitter: jitter, loadTimeout: o.loadTimeout}
+}
+
+// GetOrLoad returns the cached value for key, or calls load and caches what
+// it returns. Errors from load aren't cached, the next call tries again.
+//
+// load gets ctx's values but not its cancellation, see above. GetOrLoad
+// returns ctx's error as soon as ctx is done, and the load carries on for
+// whoever else is waiting, and to fill the cache
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	if v, ok := c.get(ctx, key); ok {
+		return v, nil
+	}
+
+	ch := c.flight.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.loadTimeout)
+		defer cancel()
+
+		// another caller may have finished loading between our miss and
+		// getting here
+		if v, ok := c.get(ctx, key); ok {
+			return v, nil
+		}
+
+		c.stats.loads.Add(1)
+		v, err := load(ctx)
+		if err != nil {
+			return v, err
+		}
+		c.set(ctx, key, v)
+		return v, nil
+	})
+
+	var zero T
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return zero, r.Err
+		}
+		return r.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Invalidate drops key, for after the source has changed
+func (c *Cache[T]) Invalidate(ctx context.Context, key string) error {
+	_, err := c.client.Del(ctx, c.prefix+key)
+	return err
+}
+
+// CacheStats counts what the cache has done. Errors are Redis failures that
+// were treated as misses
+type CacheStats struct {
+	Hits, Misses, Loads, Errors int64
+}
+
+func (c *Cache[T]) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.stats.hits.Load(),
+		Misses: c.stats.misses.Load(),
+		Loads:  c.stats.loads.Load(),
+		Errors: c.stats.errors.Load(),
+	}
+}
+
+func (c *Cache[T]) get(ctx context.Context, key string) (T, bool) {
+	var v T
+	b, err := c.client.Get(ctx, c.prefix+key)
+	switch {
+	case errors.Is(err, ErrMiss):
+		c.stats.misses.Add(1)
+		return v, false
+	case err != nil:
+		c.stats.errors.Add(1)
+		return v, false
+	}
+
+	// an entry that doesn't decode - written by an older version of T,
+	// say - is a miss, and gets overwritten by the load
+	if err := json.Unmarshal(b, &v); err != nil {
+		c.stats.misses.Add(1)
+		return v, false
+	}
+	c.stats.hits.Add(1)
+	return v, true
+}
+
+func (c *Cache[T]) set(ctx context.Context, key string, v T) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if err := c.client.Set(ctx, c.prefix+key, b, c.expiry()); err != nil {
+		c.stats.errors.Add(1)
+	}
+}
+
+// expiry is ttl moved by up to ±jitter*ttl. Never less than a millisecond,
+// Redis's resolution, since 0 would be no expiry at all
+func (c *Cache[T]) expiry() time.Duration {
+	if c.jitter == 0 {
+		return c.ttl
+	}
+	spread := float64(c.ttl) * c.jitter
+	return max(c.ttl+time.Duration((rand.Float64()*2-1)*spread), time.Millisecond)
+}
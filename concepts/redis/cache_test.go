@@ -0,0 +1,199 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestCacheAside(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestClient(t)
+	cache := NewCache[user](c, "user:", time.Minute, 0)
+
+	var loads int
+	load := func(ctx context.Context) (user, error) {
+		loads++
+		return user{ID: 1, Name: "ada"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		got, err := cache.GetOrLoad(ctx, "1", load)
+		require.NoError(t, err)
+		assert.Equal(t, user{ID: 1, Name: "ada"}, got)
+	}
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, `{"id":1,"name":"ada"}`, stored(t, srv, "user:1"))
+
+	srv.FastForward(time.Minute)
+	_, err := cache.GetOrLoad(ctx, "1", load)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loads, "expired, loaded again")
+
+	require.NoError(t, cache.Invalidate(ctx, "1"))
+	_, err = cache.GetOrLoad(ctx, "1", load)
+	require.NoError(t, err)
+	assert.Equal(t, 3, loads)
+}
+
+// stored is what's in Redis at key, looked at from the server side
+func stored(t *testing.T, srv *miniredis.Miniredis, key string) string {
+	t.Helper()
+	v, err := srv.Get(key)
+	require.NoError(t, err)
+	return v
+}
+
+func TestCacheLoadErrorsNotCached(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+	cache := NewCache[user](c, "user:", time.Minute, 0)
+
+	boom := errors.New("db down")
+	_, err := cache.GetOrLoad(ctx, "1", func(context.Context) (user, error) { return user{}, boom })
+	assert.ErrorIs(t, err, boom)
+
+	got, err := cache.GetOrLoad(ctx, "1", func(context.Context) (user, error) { return user{ID: 1}, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.ID)
+}
+
+func TestCacheStampede(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+	cache := NewCache[user](c, "user:", time.Minute, 0)
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (user, error) {
+		loads.Add(1)
+		<-release
+		return user{ID: 1}, nil
+	}
+
+	const callers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := cache.GetOrLoad(ctx, "1", load)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, got.ID)
+		}()
+	}
+
+	// wait for the load to start, give the rest time to pile up behind
+	// it, then let it finish
+	require.Eventually(t, func() bool { return loads.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestCacheRedisDown(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestClient(t)
+	cache := NewCache[user](c, "user:", time.Minute, 0)
+	srv.Close()
+
+	// the cache is an optimisation, the source still answers
+	got, err := cache.GetOrLoad(ctx, "1", func(context.Context) (user, error) { return user{ID: 1}, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.ID)
+	assert.Equal(t, int64(3), cache.Stats().Errors, "both gets, before and inside singleflight, and the set")
+}
+
+func TestCacheUndecodable(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestClient(t)
+	cache := NewCache[user](c, "user:", time.Minute, 0)
+	require.NoError(t, srv.Set("user:1", "not json"))
+
+	got, err := cache.GetOrLoad(ctx, "1", func(context.Context) (user, error) { return user{ID: 1}, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.ID)
+	assert.Equal(t, `{"id":1,"name":""}`, stored(t, srv, "user:1"), "overwritten")
+}
+
+func TestExpiryJitter(t *testing.T) {
+	cache := NewCache[user](nil, "", 100*time.Second, 0.1)
+	for i := 0; i < 1000; i++ {
+		d := cache.expiry()
+		assert.GreaterOrEqual(t, d, 90*time.Second)
+		assert.LessOrEqual(t, d, 110*time.Second)
+	}
+
+	// out of range is clamped into [0, 1), so there's always an expiry
+	for _, jitter := range []float64{-1, math.NaN()} {
+		assert.Equal(t, 100*time.Second, NewCache[user](nil, "", 100*time.Second, jitter).expiry(), jitter)
+	}
+	for _, jitter := range []float64{1, 5} {
+		cache := NewCache[user](nil, "", 100*time.Second, jitter)
+		assert.Less(t, cache.jitter, 1.0)
+		for i := 0; i < 1000; i++ {
+			d := cache.expiry()
+			assert.Positive(t, d)
+			assert.Less(t, d, 200*time.Second)
+		}
+	}
+}
+
+func TestCacheLoadOutlivesCaller(t *testing.T) {
+	c, srv := newTestClient(t)
+	cache := NewCache[user](c, "user:", time.Minute, 0, WithLoadTimeout(time.Hour))
+
+	var once sync.Once
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loadErr := make(chan error, 2)
+	load := func(ctx context.Context) (user, error) {
+		once.Do(func() { close(started) })
+		<-release
+		loadErr <- ctx.Err()
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok, "the load has its own timeout")
+		assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Minute)
+		return user{ID: 1}, nil
+	}
+
+	// the caller that starts the load gives up on it
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := cache.GetOrLoad(ctx, "1", load)
+		first <- err
+	}()
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled, "without waiting for the load")
+
+	// someone else waiting on the same load still gets it. A miss for each
+	// caller, and one for the load looking again
+	second := make(chan user)
+	go func() {
+		got, err := cache.GetOrLoad(context.Background(), "1", load)
+		assert.NoError(t, err)
+		second <- got
+	}()
+	require.Eventually(t, func() bool { return cache.Stats().Misses == 3 }, time.Second, time.Millisecond)
+	close(release)
+	assert.Equal(t, 1, (<-second).ID)
+	assert.NoError(t, <-loadErr, "cancelling the first caller didn't cancel the load")
+	assert.Equal(t, `{"id":1,"name":""}`, stored(t, srv, "user:1"))
+}
@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Redis is a shared in-memory key/value server, usually reached for as a
+// cache in front of something slower, a counter or rate limiter several
+// instances of a service can agree on, or a lightweight pub/sub channel.
+// go-redis is the client most Go code uses: a *goredis.Client is a
+// connection pool, safe for concurrent use, and like http.Client or
+// *sql.DB one is enough for the whole program.
+//
+// Client wraps it with the few operations the rest of the package needs,
+// mostly to deal with one quirk up front: a missing key isn't an empty
+// string, it's the error goredis.Nil. Client turns that into ErrMiss,
+// which callers can check with errors.Is without importing go-redis
+
+// ErrMiss is returned for a key that doesn't exist, or has expired
+var ErrMiss = errors.New("redis: key not found")
+
+// Options is the subset of goredis.Options worth thinking about
+type Options struct {
+	Addr     string // host:port
+	Password string
+	DB       int
+
+	// go-redis' defaults are 5s to dial and 3s per read or write. A cache
+	// that takes seconds to answer is worse than no cache, so keep these
+	// well under the request timeouts of whatever's calling
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// PoolSize defaults to 10 connections per CPU
+	PoolSize int
+}
+
+type Client struct {
+	rdb *goredis.Client
+}
+
+// New creates a client. Like sql.Open it doesn't connect, use Ping to
+// check the server is there
+func New(opts Options) *Client {
+	return &Client{rdb: goredis.NewClient(&goredis.Options{
+		Addr:         opts.Addr,
+		Password:     opts.Password,
+		DB:           opts.DB,
+		DialTimeout:  opts.DialTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		PoolSize:     opts.PoolSize,
+	})}
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
+func (c *Client) Close() error {
+	return c.rdb.Close()
+}
+
+// Raw is the underlying go-redis client, for everything not wrapped here
+func (c *Client) Raw() *goredis.Client {
+	return c.rdb
+}
+
+// Get returns the value at key, or ErrMiss
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := c.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, ErrMiss
+	}
+	return b, err
+}
+
+// Set stores value at key. A ttl of 0 means it never expires
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+// Del removes keys, reporting how many existed
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	return c.rdb.Del(ctx, keys...).Result()
+}
+
+// Incr adds one to the counter at key and returns the new value. It's
+// atomic on the server, so any number of processes can share a counter -
+// the first Incr on a missing key starts it at 1. When the key is new the
+// window is set too, in the same round trip: MULTI/EXEC (TxPipelined) runs
+// both commands as one, so a crash between them can't leave a counter that
+// never expires
+func (c *Client) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	var incr *goredis.IntCmd
+	_, err := c.rdb.TxPipelined(ctx, func(p goredis.Pipeliner) error {
+		incr = p.Incr(ctx, key)
+		p.ExpireNX(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// miniredis is a Redis server written in Go, running in the test process.
+// It speaks the real protocol, so go-redis can't tell the difference, and
+// FastForward moves its clock so TTLs can be tested without sleeping
+func newTestClient(t *testing.T) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	c := New(Options{Addr: srv.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return c, srv
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestClient(t)
+	require.NoError(t, c.Ping(ctx))
+
+	_, err := c.Get(ctx, "greeting")
+	assert.ErrorIs(t, err, ErrMiss)
+
+	require.NoError(t, c.Set(ctx, "greeting", []byte("hello"), time.Minute))
+	got, err := c.Get(ctx, "greeting")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+
+	srv.FastForward(time.Minute)
+	_, err = c.Get(ctx, "greeting")
+	assert.ErrorIs(t, err, ErrMiss, "expired")
+
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), 0))
+	n, err := c.Del(ctx, "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestIncr(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestClient(t)
+
+	for want := int64(1); want <= 3; want++ {
+		n, err := c.Incr(ctx, "hits", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, want, n)
+	}
+
+	// the window was set by the first Incr, later ones don't extend it
+	srv.FastForward(30 * time.Second)
+	_, err := c.Incr(ctx, "hits", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, srv.TTL("hits"))
+
+	srv.FastForward(30 * time.Second)
+	n, err := c.Incr(ctx, "hits", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "a new window")
+}
+
+func TestServerDown(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.Close()
+
+	_, err := c.Get(context.Background(), "x")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrMiss)
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+)
+
+// Redis pub/sub is fire and forget: a message goes to whoever is subscribed
+// to the channel right now, and is gone. No history, no acknowledgements -
+// a subscriber that's disconnected for a moment misses what was sent
+// meanwhile. That's fine for live updates, which is what the SSE example in
+// concepts/net/http streams.
+//
+// A pubsub.Bus only reaches subscribers in the same process. With several
+// instances of a service behind a load balancer, a browser's SSE stream is
+// on one instance, and the event it wants may be published on another.
+// Bridge joins them up: every instance subscribes to the Redis channel and
+// republishes onto its own Bus, so the sseHandler there doesn't need to
+// know Redis exists
+
+// Publish sends msg to everyone subscribed to channel, on any instance. It
+// reports how many Redis subscribers received it
+func (c *Client) Publish(ctx context.Context, channel, msg string) (int64, error) {
+	return c.rdb.Publish(ctx, channel, msg).Result()
+}
+
+// Bridge forwards messages from a Redis channel onto topic on bus until ctx
+// is cancelled. It returns once subscribed, so a message published after
+// Bridge returns is delivered, and runs the forwarding in the background.
+// The returned channel is closed when that stops
+func (c *Client) Bridge(ctx context.Context, channel string, bus *pubsub.Bus[string], topic string) (<-chan struct{}, error) {
+	sub := c.rdb.Subscribe(ctx, channel)
+
+	// Subscribe returns before the server has confirmed, Receive waits
+	// for the confirmation
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer sub.Close()
+
+		// Channel reconnects by itself if the connection drops, and is
+		// closed by sub.Close
+		msgs := sub.Channel()
+		for {
+			select {
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				if _, err := bus.Publish(ctx, topic, msg.Payload); errors.Is(err, pubsub.ErrClosed) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done, nil
+}
@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/pubsub"
+)
+
+func TestBridge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, _ := newTestClient(t)
+
+	// what the SSE handler would do: subscribe to the local bus
+	bus := pubsub.New[string]()
+	sub := bus.Subscribe("events", pubsub.WithBuffer(4))
+
+	done, err := c.Bridge(ctx, "events", bus, "events")
+	require.NoError(t, err)
+
+	// another instance publishing to Redis
+	n, err := c.Publish(ctx, "events", "todo 1 completed")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	select {
+	case msg := <-sub.C:
+		assert.Equal(t, "todo 1 completed", msg)
+	case <-time.After(2 * time.Second):
+		t.Fatal("message never arrived on the bus")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Bridge didn't stop")
+	}
+}
@@ -0,0 +1,210 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// Most failures talking to another service are brief - a dropped
+// connection, a deploy, a moment of overload - so trying again a little later
+// usually works. Doing that well takes more than a loop:
+//
+//   - back off: wait longer after each failure, so a struggling service
+//     gets room to recover instead of more load
+//   - jitter: randomize the waits. A thousand clients that failed together
+//     and back off identically will all retry together, and fail together
+//   - give up: after some number of attempts, or some amount of time, the
+//     caller needs an answer more than another try
+//   - classify: a 404 or a validation error will fail the same way every
+//     time, retrying it just wastes the wait
+//
+// Policy describes all four, and Retry and Do apply it to a function
+
+// Policy configures retries. The zero value makes 3 attempts - the first
+// try and 2 retries - waiting 100ms then 200ms, with no jitter
+type Policy struct {
+	// MaxAttempts counts the first try, default 3
+	MaxAttempts int
+	// Initial is the wait after the first failure, default 100ms. Each later
+	// wait is Multiplier (default 2) times longer, up to Max (default 10s)
+	Initial    time.Duration
+	Multiplier float64
+	Max        time.Duration
+	// Jitter takes up to this fraction off each wait at random: 0.5 turns a
+	// 1s wait into anything between 0.5s and 1s. It must be between 0 and 1
+	Jitter float64
+	// MaxElapsed stops retrying once another wait would go past this much
+	// time since the first attempt, default 1 minute. Negative means no
+	// limit
+	MaxElapsed time.Duration
+	// MaxRetryAfter caps the wait a RetryAfterError asks for, default 1
+	// minute. The server says how long, but it doesn't get to park the
+	// caller for an hour
+	MaxRetryAfter time.Duration
+	// Retryable decides which errors are worth retrying. The default
+	// retries everything except Permanent errors and context errors
+	Retryable func(error) bool
+	// Clock defaults to the real one
+	Clock clock.Clock
+
+	// rand is rand.Float64, swapped out in tests to pin the jitter
+	rand func() float64
+}
+
+// Permanent marks an error that retrying won't fix. Retry stops straight away
+// and returns err
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// RetryAfterError is an error that knows how long to wait - a 429 or 503
+// with a Retry-After header, say. Its wait replaces the backoff for that
+// attempt
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+// Delay is how long to wait after the attempt'th failure (counting from 1),
+// jitter included
+func (p Policy) Delay(attempt int) time.Duration {
+	p = p.withDefaults()
+
+	d := float64(p.Initial)
+	for i := 1; i < attempt && d < float64(p.Max); i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.Max) {
+		d = float64(p.Max)
+	}
+	if p.Jitter > 0 {
+		d -= d * min(p.Jitter, 1) * p.rand()
+	}
+	return time.Duration(d)
+}
+
+// Validate reports settings that can't be made to work. Retry and Do check
+// it before the first attempt
+func (p Policy) Validate() error {
+	if !(p.Jitter >= 0 && p.Jitter <= 1) {
+		return fmt.Errorf("retry: jitter %v is outside [0, 1]", p.Jitter)
+	}
+	return nil
+}
+
+// Attempts is MaxAttempts with the default applied
+func (p Policy) Attempts() int {
+	return p.withDefaults().MaxAttempts
+}
+
+// ShouldRetry reports whether the policy considers err retryable
+func (p Policy) ShouldRetry(err error) bool {
+	if err == nil || IsPermanent(err) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.Initial <= 0 {
+		p.Initial = 100 * time.Millisecond
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Max <= 0 {
+		p.Max = 10 * time.Second
+	}
+	if p.MaxElapsed == 0 {
+		p.MaxElapsed = time.Minute
+	}
+	if p.MaxRetryAfter <= 0 {
+		p.MaxRetryAfter = time.Minute
+	}
+	if p.Clock == nil {
+		p.Clock = clock.New()
+	}
+	if p.rand == nil {
+		p.rand = rand.Float64
+	}
+	return p
+}
+
+// Retry calls fn until it succeeds, returns an error the policy won't retry,
+// runs out of attempts or time, or ctx is done. The error returned wraps
+// fn's last error. An invalid policy is an error before fn is called at all
+func Retry(ctx context.Context, p Policy, fn func() error) error {
+	_, err := Do(ctx, p, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+// Do is Retry for functions that return a value
+func Do[T any](ctx context.Context, p Policy, fn func() (T, error)) (T, error) {
+	if err := p.Validate(); err != nil {
+		var zero T
+		return zero, err
+	}
+	p = p.withDefaults()
+	start := p.Clock.Now()
+
+	for attempt := 1; ; attempt++ {
+		v, err := fn()
+		if err == nil {
+			return v, nil
+		}
+
+		var zero T
+		if !p.ShouldRetry(err) {
+			var perm permanentError
+			if errors.As(err, &perm) {
+				err = perm.err
+			}
+			return zero, err
+		}
+		if attempt >= p.MaxAttempts {
+			return zero, fmt.Errorf("retry: gave up after %d attempts: %w", attempt, err)
+		}
+
+		wait := p.Delay(attempt)
+		var ra RetryAfterError
+		if errors.As(err, &ra) && ra.RetryAfter() > 0 {
+			wait = min(ra.RetryAfter(), p.MaxRetryAfter)
+		}
+		if p.MaxElapsed > 0 && p.Clock.Now().Add(wait).Sub(start) > p.MaxElapsed {
+			return zero, fmt.Errorf("retry: gave up after %d attempts and %s: %w", attempt, p.Clock.Now().Sub(start), err)
+		}
+
+		select {
+		case <-p.Clock.After(wait):
+		case <-ctx.Done():
+			return zero, fmt.Errorf("retry: %w after %d attempts: %w", ctx.Err(), attempt, err)
+		}
+	}
+}
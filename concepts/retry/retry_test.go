@@ -0,0 +1,233 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// stepClock jumps forward by whatever it's asked to wait, straight away, and
+// remembers the waits - Retry runs synchronously with no real sleeping
+type stepClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *stepClock) Now() time.Time { return c.now }
+
+func (c *stepClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+var errFlaky = errors.New("flaky")
+
+// failing returns a function that fails n times, then succeeds
+func failing(n int, err error) (fn func() error, calls *int) {
+	calls = new(int)
+	return func() error {
+		*calls++
+		if *calls <= n {
+			return err
+		}
+		return nil
+	}, calls
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	clk := &stepClock{}
+	fn, calls := failing(2, errFlaky)
+
+	require.NoError(t, Retry(context.Background(), Policy{Clock: clk}, fn))
+	assert.Equal(t, 3, *calls)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, clk.waits)
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	clk := &stepClock{}
+	fn, calls := failing(10, errFlaky)
+
+	err := Retry(context.Background(), Policy{MaxAttempts: 4, Clock: clk}, fn)
+	assert.ErrorIs(t, err, errFlaky)
+	assert.Contains(t, err.Error(), "gave up after 4 attempts")
+	assert.Equal(t, 4, *calls)
+	assert.Len(t, clk.waits, 3, "no wait after the last attempt")
+}
+
+func TestDelay(t *testing.T) {
+	p := Policy{Initial: 100 * time.Millisecond, Max: time.Second}
+	for attempt, want := range map[int]time.Duration{
+		1:   100 * time.Millisecond,
+		2:   200 * time.Millisecond,
+		3:   400 * time.Millisecond,
+		4:   800 * time.Millisecond,
+		5:   time.Second,
+		100: time.Second,
+	} {
+		assert.Equal(t, want, p.Delay(attempt), "attempt %d", attempt)
+	}
+
+	p.Multiplier = 3
+	assert.Equal(t, 900*time.Millisecond, p.Delay(3))
+}
+
+func TestJitter(t *testing.T) {
+	p := Policy{Initial: time.Second, Jitter: 0.5}
+
+	p.rand = func() float64 { return 0 }
+	assert.Equal(t, time.Second, p.Delay(1))
+	p.rand = func() float64 { return 0.5 }
+	assert.Equal(t, 750*time.Millisecond, p.Delay(1))
+	p.rand = func() float64 { return 0.999999 }
+	assert.InDelta(t, 500*time.Millisecond, p.Delay(1), float64(time.Millisecond), "never less than half")
+
+	// with the real random source every wait lands in range
+	p.rand = nil
+	for i := 0; i < 100; i++ {
+		d := p.Delay(2)
+		assert.True(t, d > time.Second && d <= 2*time.Second, "%s out of range", d)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	clk := &stepClock{}
+	errBad := errors.New("bad input")
+	fn, calls := failing(10, Permanent(errBad))
+
+	err := Retry(context.Background(), Policy{Clock: clk}, fn)
+	assert.Equal(t, errBad, err, "unwrapped for the caller")
+	assert.Equal(t, 1, *calls)
+	assert.Empty(t, clk.waits)
+
+	assert.Nil(t, Permanent(nil))
+	assert.True(t, IsPermanent(Permanent(errBad)))
+	assert.False(t, IsPermanent(errBad))
+}
+
+func TestRetryable(t *testing.T) {
+	errTemporary := errors.New("temporary")
+	p := Policy{
+		Clock:     &stepClock{},
+		Retryable: func(err error) bool { return errors.Is(err, errTemporary) },
+	}
+
+	fn, calls := failing(1, errTemporary)
+	require.NoError(t, Retry(context.Background(), p, fn))
+	assert.Equal(t, 2, *calls)
+
+	fn, calls = failing(1, errFlaky)
+	assert.Equal(t, errFlaky, Retry(context.Background(), p, fn))
+	assert.Equal(t, 1, *calls)
+
+	// by default a context error is the caller giving up, not a failure
+	fn, calls = failing(1, context.DeadlineExceeded)
+	assert.ErrorIs(t, Retry(context.Background(), Policy{Clock: &stepClock{}}, fn), context.DeadlineExceeded)
+	assert.Equal(t, 1, *calls)
+}
+
+func TestMaxElapsed(t *testing.T) {
+	clk := &stepClock{}
+	fn, calls := failing(10, errFlaky)
+
+	p := Policy{Initial: time.Second, MaxAttempts: 10, MaxElapsed: 2500 * time.Millisecond, Clock: clk}
+	err := Retry(context.Background(), p, fn)
+	assert.ErrorIs(t, err, errFlaky)
+	assert.Equal(t, 2, *calls, "a second wait of 2s would end past 2.5s")
+	assert.Equal(t, []time.Duration{time.Second}, clk.waits)
+}
+
+type retryAfter time.Duration
+
+func (r retryAfter) Error() string             { return "slow down" }
+func (r retryAfter) RetryAfter() time.Duration { return time.Duration(r) }
+
+func TestRetryAfter(t *testing.T) {
+	clk := &stepClock{}
+	fn, _ := failing(1, retryAfter(5*time.Second))
+
+	require.NoError(t, Retry(context.Background(), Policy{Clock: clk}, fn))
+	assert.Equal(t, []time.Duration{5 * time.Second}, clk.waits)
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	clk := &stepClock{}
+	fn, _ := failing(2, retryAfter(24*time.Hour))
+
+	require.NoError(t, Retry(context.Background(), Policy{Clock: clk, MaxElapsed: -1}, fn))
+	assert.Equal(t, []time.Duration{time.Minute, time.Minute}, clk.waits, "capped at the default")
+
+	clk = &stepClock{}
+	fn, _ = failing(1, retryAfter(24*time.Hour))
+	require.NoError(t, Retry(context.Background(), Policy{Clock: clk, MaxRetryAfter: 5 * time.Second}, fn))
+	assert.Equal(t, []time.Duration{5 * time.Second}, clk.waits)
+}
+
+func TestDefaultMaxElapsed(t *testing.T) {
+	clk := &stepClock{}
+	fn, calls := failing(100, errFlaky)
+
+	// the waits ramp up to 10s, and a minute runs out a few of those later,
+	// long before 100 attempts
+	err := Retry(context.Background(), Policy{Clock: clk, MaxAttempts: 100}, fn)
+	assert.ErrorIs(t, err, errFlaky)
+	assert.Contains(t, err.Error(), "gave up after")
+	assert.Less(t, *calls, 100)
+
+	var total time.Duration
+	for _, w := range clk.waits {
+		total += w
+	}
+	assert.LessOrEqual(t, total, time.Minute)
+}
+
+func TestValidate(t *testing.T) {
+	for _, jitter := range []float64{0, 0.5, 1} {
+		assert.NoError(t, Policy{Jitter: jitter}.Validate(), jitter)
+	}
+	for _, jitter := range []float64{-0.1, 1.5, math.NaN()} {
+		p := Policy{Jitter: jitter, Clock: &stepClock{}}
+		assert.Error(t, p.Validate(), jitter)
+
+		fn, calls := failing(0, nil)
+		assert.ErrorContains(t, Retry(context.Background(), p, fn), "jitter")
+		assert.Zero(t, *calls, "fn isn't called")
+	}
+}
+
+func TestRetryContextCancelled(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	fn, calls := failing(10, errFlaky)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Retry(ctx, Policy{Clock: clk}, fn) }()
+
+	clk.BlockUntil(1)
+	cancel()
+	err := <-done
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, errFlaky, "the last failure is kept too")
+	assert.Equal(t, 1, *calls)
+}
+
+func TestDo(t *testing.T) {
+	n := 0
+	v, err := Do(context.Background(), Policy{Clock: &stepClock{}}, func() (int, error) {
+		n++
+		if n < 2 {
+			return 0, errFlaky
+		}
+		return 42, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 42, v)
+}
@@ -0,0 +1,249 @@
+package runtime
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The runtime package is the window into the scheduler, the GC and the
+// goroutines themselves. Most programs never need it, but a few pieces are
+// worth knowing: how many threads run Go code, how to see what every
+// goroutine is doing, and why finalizers are almost never the answer
+
+/*
+ *
+ * runtime stats
+ *
+ */
+
+// GOMAXPROCS is how many OS threads can run Go code at once. It defaults to
+// the number of CPUs (and since Go 1.25, the container's CPU limit if that's
+// lower). runtime.GOMAXPROCS(0) reads it without changing it
+type stats struct {
+	GoVersion    string `json:"go_version"`
+	GOOS         string `json:"goos"`
+	GOARCH       string `json:"goarch"`
+	NumCPU       int    `json:"num_cpu"`
+	GOMAXPROCS   int    `json:"gomaxprocs"`
+	NumGoroutine int    `json:"num_goroutine"`
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	NumGC        uint32 `json:"num_gc"`
+}
+
+func readStats() stats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	return stats{
+		GoVersion:    runtime.Version(),
+		GOOS:         runtime.GOOS,
+		GOARCH:       runtime.GOARCH,
+		NumCPU:       runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumGoroutine: runtime.NumGoroutine(),
+		HeapAlloc:    ms.HeapAlloc,
+		NumGC:        ms.NumGC,
+	}
+}
+
+/*
+ *
+ * goroutine dumps
+ *
+ */
+
+// Sending a Go program SIGQUIT (ctrl-\) makes it print every goroutine's stack
+// and exit. That's great for a hung program on your laptop, less great in
+// production where you want the stacks but not the exit. The same dump is
+// available from code:
+//
+//   - runtime.Stack(buf, true) fills buf with every goroutine's stack, in the
+//     same format as the SIGQUIT dump
+//   - pprof.Lookup("goroutine").WriteTo(w, 2) writes that same format,
+//     debug=1 groups identical stacks with a count, which is far easier to
+//     read when there are thousands of goroutines
+
+// goroutineStacks returns the stacks of all goroutines. runtime.Stack
+// truncates to the buffer it's given, so keep doubling until it fits
+func goroutineStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// writeGoroutines writes the dump, grouped unless full is set
+func writeGoroutines(w io.Writer, full bool) error {
+	debug := 1
+	if full {
+		debug = 2
+	}
+	return pprof.Lookup("goroutine").WriteTo(w, debug)
+}
+
+// adminHandler exposes the stats and dumps over HTTP. Mount it on a separate
+// port or behind auth - stacks leak a lot about the program's internals
+//
+//	GET /debug/stats              runtime stats as JSON
+//	GET /debug/goroutines         grouped goroutine dump
+//	GET /debug/goroutines?full=1  SIGQUIT-style dump of every goroutine
+func adminHandler() http.Handler {
+	m := http.NewServeMux()
+
+	m.HandleFunc("/debug/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(readStats())
+	})
+
+	m.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := writeGoroutines(w, r.URL.Query().Get("full") == "1"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	return m
+}
+
+/*
+ *
+ * Gosched
+ *
+ */
+
+// runtime.Gosched yields the thread so other goroutines can run. Before Go
+// 1.14 a tight loop with no function calls could hog a thread forever, so
+// spin loops needed it. The scheduler now preempts goroutines asynchronously,
+// so Gosched is only a politeness - and a spin loop is still the wrong tool,
+// a channel or sync.Cond would block without burning a CPU
+
+// spinUntil busy-waits for ready, yielding each time round
+func spinUntil(ready *atomic.Bool) int {
+	spins := 0
+	for !ready.Load() {
+		spins++
+		runtime.Gosched()
+	}
+	return spins
+}
+
+// takeTurns runs two goroutines that each record their name n times, yielding
+// after each one. With GOMAXPROCS=1 the yield usually hands the thread to the
+// other goroutine, so the output tends to alternate - but usually, not always.
+// Nothing about Gosched is a synchronization guarantee
+func takeTurns(n int) []string {
+	prev := runtime.GOMAXPROCS(1)
+	defer runtime.GOMAXPROCS(prev)
+
+	var (
+		mu  sync.Mutex
+		out []string
+		wg  sync.WaitGroup
+	)
+	for _, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				mu.Lock()
+				out = append(out, name)
+				mu.Unlock()
+				runtime.Gosched()
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	return out
+}
+
+/*
+ *
+ * finalizers
+ *
+ */
+
+// runtime.SetFinalizer runs a function when the GC finds an object
+// unreachable. It looks like a destructor, it isn't one:
+//
+//   - there's no promise it ever runs - not before exit, not at any particular
+//     time, only "at some point after the object becomes unreachable"
+//   - all finalizers run one at a time on a single goroutine, so a slow one
+//     holds up every other
+//   - the finalizer gets the object, so it can resurrect it by storing it
+//     somewhere, and the object's memory isn't freed until the next cycle
+//   - objects in a reference cycle with finalizers are never collected
+//   - the object can become unreachable earlier than you'd think, while a
+//     method that uses one of its fields is still running - runtime.KeepAlive
+//     exists for exactly that
+//
+// The one reasonable use is a safety net: close explicitly, and have the
+// finalizer flag (or clean up) anything that was forgotten. os.File does this.
+// Go 1.24's runtime.AddCleanup fixes the resurrection and cycle problems and
+// is the better choice on new enough Go
+
+type resource struct {
+	name   string
+	closed bool
+	leaks  *leakLog
+}
+
+// leakLog records resources that were garbage collected without being closed
+type leakLog struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (l *leakLog) add(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.names = append(l.names, name)
+}
+
+func (l *leakLog) Names() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.names...)
+}
+
+func openResource(name string, leaks *leakLog) *resource {
+	r := &resource{name: name, leaks: leaks}
+	runtime.SetFinalizer(r, func(r *resource) {
+		if !r.closed {
+			r.leaks.add(r.name)
+		}
+	})
+	return r
+}
+
+// Close is the real cleanup. It clears the finalizer since there's nothing
+// left for it to do, which also saves the GC a cycle
+func (r *resource) Close() {
+	r.closed = true
+	runtime.SetFinalizer(r, nil)
+}
+
+// collectUntil keeps forcing GC cycles until done reports true or the timeout
+// passes. One runtime.GC isn't enough: finalizers are queued by one cycle and
+// run afterwards on their own goroutine
+func collectUntil(done func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if done() {
+			return true
+		}
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	return done()
+}
@@ -0,0 +1,99 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStats(t *testing.T) {
+	s := readStats()
+
+	assert.Equal(t, runtime.Version(), s.GoVersion)
+	assert.Equal(t, runtime.GOMAXPROCS(0), s.GOMAXPROCS)
+	assert.GreaterOrEqual(t, s.NumCPU, 1)
+	assert.GreaterOrEqual(t, s.NumGoroutine, 1)
+}
+
+func TestGoroutineStacks(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+
+	dump := string(goroutineStacks())
+	assert.Contains(t, dump, "goroutine ")
+	assert.Contains(t, dump, "TestGoroutineStacks")
+}
+
+func TestAdminHandler(t *testing.T) {
+	srv := httptest.NewServer(adminHandler())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/debug/stats")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var s stats
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&s))
+	assert.Equal(t, runtime.GOOS, s.GOOS)
+
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"", "goroutine profile: total"},
+		{"?full=1", "[running]"},
+	} {
+		res, err := http.Get(srv.URL + "/debug/goroutines" + tc.query)
+		require.NoError(t, err)
+
+		var body bytes.Buffer
+		_, err = body.ReadFrom(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, body.String(), tc.want)
+	}
+}
+
+func TestSpinUntil(t *testing.T) {
+	var ready atomic.Bool
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		ready.Store(true)
+	}()
+
+	assert.Greater(t, spinUntil(&ready), 0)
+}
+
+func TestTakeTurns(t *testing.T) {
+	out := takeTurns(50)
+
+	// the order isn't guaranteed, only that everything ran
+	assert.Len(t, out, 100)
+	assert.Equal(t, 50, strings.Count(strings.Join(out, ""), "a"))
+}
+
+func TestFinalizerFlagsLeaks(t *testing.T) {
+	leaks := &leakLog{}
+
+	func() {
+		closed := openResource("closed", leaks)
+		closed.Close()
+		_ = openResource("forgotten", leaks)
+	}()
+
+	found := collectUntil(func() bool { return len(leaks.Names()) > 0 }, 2*time.Second)
+	require.True(t, found, "finalizer never ran - which the runtime is allowed to do")
+	assert.Equal(t, []string{"forgotten"}, leaks.Names())
+}
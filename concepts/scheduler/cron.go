@@ -0,0 +1,216 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule says when a job runs next. Next must return a time strictly after
+// t, or the zero time if the job never runs again
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Every runs a job at a fixed interval
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+/*
+ *
+ * cron
+ *
+ */
+
+// A cron expression has five fields:
+//
+//	minute  hour  day-of-month  month  day-of-week
+//	0-59    0-23  1-31          1-12   0-7 (0 and 7 are both Sunday)
+//
+// and each field is a comma separated list of
+//
+//	*       every value
+//	5       one value
+//	1-5     a range
+//	*/15    every 15th value
+//	0-30/10 every 10th value in a range
+//
+// So "*/15 * * * *" is every quarter hour and "0 9 * * 1-5" is 9am on
+// weekdays. Names (JAN, MON) and the other extensions some crons have aren't
+// supported, only the @hourly style shortcuts below
+
+var macros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+var errCron = errors.New("scheduler: bad cron expression")
+
+// bits is a set of small integers, one bit each - every field fits in 64
+type bits uint64
+
+func (b bits) has(n int) bool { return b&(1<<uint(n)) != 0 }
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+type cron struct {
+	minute, hour, dom, month, dow bits
+
+	// with both day fields restricted, cron runs when either matches -
+	// "0 0 1 * 1" is the 1st of the month and every Monday
+	domStar, dowStar bool
+}
+
+// ParseCron parses a five field cron expression or one of the @ shortcuts
+func ParseCron(expr string) (Schedule, error) {
+	if m, ok := macros[expr]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("%w %q: want 5 fields, got %d", errCron, expr, len(parts))
+	}
+
+	var sets [5]bits
+	for i, p := range parts {
+		b, err := parseField(p, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %s: %v", errCron, expr, fields[i].name, err)
+		}
+		sets[i] = b
+	}
+
+	c := &cron{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+	}
+	if c.dow.has(7) {
+		c.dow |= 1 // 7 is another way of writing Sunday
+	}
+	return c, nil
+}
+
+func parseField(s string, f field) (bits, error) {
+	var b bits
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, z, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(z); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %q goes backwards", rng)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if hasStep {
+				hi = f.max // "5/15" means 5, 20, 35, 50
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			b |= 1 << uint(v)
+		}
+	}
+	return b, nil
+}
+
+func (f field) value(s string) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a number", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%d is outside %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// cronHorizon bounds the search for expressions that can never match, like
+// the 30th of February
+const cronHorizon = 5 * 366 * 24 * time.Hour
+
+// Next walks forward from t, jumping a whole month, day or hour whenever that
+// part doesn't match rather than checking every minute. Times are in t's
+// location, so a scheduler on UTC and one on local time disagree about when
+// 9am is
+func (c *cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.Add(cronHorizon)
+
+	for t.Before(limit) {
+		y, mo, d := t.Date()
+		switch {
+		case !c.month.has(int(mo)):
+			t = time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+		case !c.hour.has(t.Hour()):
+			t = time.Date(y, mo, d, t.Hour()+1, 0, 0, 0, loc)
+		case !c.minute.has(t.Minute()):
+			t = time.Date(y, mo, d, t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	dom := c.dom.has(t.Day())
+	dow := c.dow.has(int(t.Weekday()))
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronNext(t *testing.T) {
+	// 2024-03-15 is a Friday
+	from := time.Date(2024, 3, 15, 10, 7, 30, 0, time.UTC)
+	at := func(mo time.Month, d, h, m int) time.Time { return time.Date(2024, mo, d, h, m, 0, 0, time.UTC) }
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", at(3, 15, 10, 8)},
+		{"*/15 * * * *", at(3, 15, 10, 15)},
+		{"5/15 * * * *", at(3, 15, 10, 20)},
+		{"0,30 * * * *", at(3, 15, 10, 30)},
+		{"7 * * * *", at(3, 15, 11, 7)},
+		{"0 9 * * *", at(3, 16, 9, 0)},
+		{"0 9 * * 1-5", at(3, 18, 9, 0)},
+		{"0 0 * * 0", at(3, 17, 0, 0)},
+		{"0 0 * * 7", at(3, 17, 0, 0)},
+		{"30 2 1 * *", at(4, 1, 2, 30)},
+		{"0 0 1 1 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 1", at(3, 18, 12, 0)}, // both day fields set: either matches
+		{"0-10/5 8-9 * * *", at(3, 16, 8, 0)},
+		{"@hourly", at(3, 15, 11, 0)},
+		{"@daily", at(3, 16, 0, 0)},
+		{"@weekly", at(3, 17, 0, 0)},
+		{"@monthly", at(4, 1, 0, 0)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseCron(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, s.Next(from))
+		})
+	}
+}
+
+func TestCronNextIsStrictlyAfter(t *testing.T) {
+	s, err := ParseCron("0 * * * *")
+	require.NoError(t, err)
+
+	on := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, on.Add(time.Hour), s.Next(on))
+}
+
+func TestCronNever(t *testing.T) {
+	s, err := ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, s.Next(time.Now()).IsZero())
+}
+
+func TestCronLocation(t *testing.T) {
+	s, err := ParseCron("0 9 * * *")
+	require.NoError(t, err)
+
+	est := time.FixedZone("EST", -5*60*60)
+	got := s.Next(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).In(est))
+	assert.Equal(t, time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC), got.UTC(), "9am in the schedule's zone")
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@never",
+	} {
+		_, err := ParseCron(expr)
+		assert.ErrorIs(t, err, errCron, expr)
+	}
+}
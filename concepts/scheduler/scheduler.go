@@ -0,0 +1,258 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// Scheduler runs named jobs on Schedules. Each job gets two goroutines: a
+// ticker that sleeps until the job is next due, and a worker that runs it.
+// Splitting them means a slow run never makes the ticker miss its time -
+// whether the tick then runs, waits or is dropped is the job's Overlap
+// policy.
+//
+// A panicking job is recovered and reported to OnPanic, and keeps its
+// schedule; the other jobs never notice
+type Scheduler struct {
+	clk clock.Clock
+
+	// OnPanic is called with the job's name and the recovered value. The
+	// default logs it with a stack trace
+	OnPanic func(job string, v any)
+
+	// randInt63n is rand.Int63n, swapped out in tests to pin the jitter
+	randInt63n func(n int64) int64
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	running bool
+}
+
+// Overlap decides what happens when a job comes due while its last run is
+// still going
+type Overlap int
+
+const (
+	// Skip drops the tick. Right for jobs where only the latest run matters,
+	// like refreshing a cache
+	Skip Overlap = iota
+	// Queue runs it once the current run finishes, up to queueDepth waiting
+	// runs - beyond that ticks are dropped anyway, or a job that's always
+	// slower than its interval would queue forever
+	Queue
+)
+
+const queueDepth = 16
+
+var (
+	ErrDuplicateJob = errors.New("scheduler: job already added")
+	ErrRunning      = errors.New("scheduler: can't add jobs while running")
+)
+
+// JobOption configures a single job
+type JobOption func(*job)
+
+// WithOverlap sets the job's Overlap policy. The default is Skip
+func WithOverlap(o Overlap) JobOption {
+	return func(j *job) { j.overlap = o }
+}
+
+// WithJitter delays each run by a random amount up to d. A fleet of servers
+// running "0 * * * *" would otherwise all hit the database at the same second
+func WithJitter(d time.Duration) JobOption {
+	return func(j *job) { j.jitter = d }
+}
+
+// JobStats counts what happened to a job's ticks
+type JobStats struct {
+	Runs    uint64 // finished, including ones that panicked
+	Skipped uint64 // dropped by the overlap policy
+	Panics  uint64
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       func(context.Context)
+	overlap  Overlap
+	jitter   time.Duration
+
+	runs chan struct{}
+	busy atomic.Bool // a run is in progress or waiting, for Skip
+
+	nRuns, nSkipped, nPanics atomic.Uint64
+}
+
+// New returns a Scheduler using clk for all its timing
+func New(clk clock.Clock) *Scheduler {
+	return &Scheduler{
+		clk:        clk,
+		randInt63n: rand.Int63n,
+		jobs:       make(map[string]*job),
+	}
+}
+
+// Add registers fn to run on sched. Jobs have to be added before Run
+func (s *Scheduler) Add(name string, sched Schedule, fn func(ctx context.Context), opts ...JobOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return ErrRunning
+	}
+	if _, ok := s.jobs[name]; ok {
+		return ErrDuplicateJob
+	}
+
+	j := &job{name: name, schedule: sched, fn: fn}
+	for _, opt := range opts {
+		opt(j)
+	}
+	depth := 1
+	if j.overlap == Queue {
+		depth = queueDepth
+	}
+	j.runs = make(chan struct{}, depth)
+
+	s.jobs[name] = j
+	return nil
+}
+
+// Stats returns the counters for the named job
+func (s *Scheduler) Stats(name string) (JobStats, bool) {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return JobStats{}, false
+	}
+	return JobStats{
+		Runs:    j.nRuns.Load(),
+		Skipped: j.nSkipped.Load(),
+		Panics:  j.nPanics.Load(),
+	}, true
+}
+
+// Run starts every job and blocks until ctx is done. Jobs get a context
+// derived from ctx, so a long job can notice shutdown. Run waits for
+// in-flight runs to return - queued ones are dropped - then returns ctx.Err()
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	s.running = true
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(2)
+		go func(j *job) {
+			defer wg.Done()
+			s.tick(ctx, j)
+		}(j)
+		go func(j *job) {
+			defer wg.Done()
+			s.work(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+
+	return ctx.Err()
+}
+
+// tick sleeps until each due time and hands the run to the worker
+func (s *Scheduler) tick(ctx context.Context, j *job) {
+	due := s.clk.Now()
+	for {
+		// following on from the last due time rather than from now keeps
+		// jitter and slow wake-ups from drifting an interval schedule. If the
+		// clock jumped past it, start again from now instead of firing a
+		// burst of catch-up runs
+		now := s.clk.Now()
+		due = j.schedule.Next(due)
+		if due.Before(now) {
+			due = j.schedule.Next(now)
+		}
+		if due.IsZero() {
+			return
+		}
+
+		select {
+		case <-s.clk.After(due.Add(s.jitter(j)).Sub(now)):
+		case <-ctx.Done():
+			return
+		}
+		s.dispatch(j)
+	}
+}
+
+func (s *Scheduler) jitter(j *job) time.Duration {
+	if j.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(s.randInt63n(int64(j.jitter)))
+}
+
+// dispatch never blocks the ticker: a tick the policy can't take is counted
+// and dropped
+func (s *Scheduler) dispatch(j *job) {
+	if j.overlap == Skip && !j.busy.CompareAndSwap(false, true) {
+		j.nSkipped.Add(1)
+		return
+	}
+	select {
+	case j.runs <- struct{}{}:
+	default:
+		j.nSkipped.Add(1)
+	}
+}
+
+func (s *Scheduler) work(ctx context.Context, j *job) {
+	for {
+		select {
+		case <-j.runs:
+			// select picks at random when both are ready, so check again
+			// rather than start a run after shutdown
+			if ctx.Err() != nil {
+				return
+			}
+			s.run(ctx, j)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	defer func() {
+		if v := recover(); v != nil {
+			j.nPanics.Add(1)
+			s.onPanic(j.name, v)
+		}
+		j.busy.Store(false)
+		j.nRuns.Add(1)
+	}()
+	j.fn(ctx)
+}
+
+func (s *Scheduler) onPanic(name string, v any) {
+	if s.OnPanic != nil {
+		s.OnPanic(name, v)
+		return
+	}
+	log.Printf("scheduler: job %q panicked: %v\n%s", name, v, debug.Stack())
+}
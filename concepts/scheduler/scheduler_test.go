@@ -0,0 +1,236 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// start runs s in the background, returning a cancel that stops it and
+// returns Run's error
+func start(t *testing.T, s *Scheduler) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	stopped := false
+	stop := func() error {
+		if stopped {
+			return nil
+		}
+		stopped = true
+		cancel()
+		return <-done
+	}
+	t.Cleanup(func() { stop() })
+	return stop
+}
+
+func stats(t *testing.T, s *Scheduler, name string) JobStats {
+	st, ok := s.Stats(name)
+	require.True(t, ok)
+	return st
+}
+
+func TestEvery(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := New(clk)
+
+	ran := make(chan time.Time, 10)
+	require.NoError(t, s.Add("tick", Every(time.Minute), func(context.Context) { ran <- clk.Now() }))
+	start(t, s)
+
+	for i := 1; i <= 3; i++ {
+		clk.BlockUntil(1)
+		assert.Empty(t, ran)
+		clk.Advance(time.Minute)
+		assert.Equal(t, time.Unix(0, 0).Add(time.Duration(i)*time.Minute), <-ran)
+	}
+	assert.Eventually(t, func() bool { return stats(t, s, "tick").Runs == 3 }, time.Second, time.Millisecond)
+}
+
+func TestCronJob(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 3, 15, 10, 7, 0, 0, time.UTC))
+	s := New(clk)
+
+	sched, err := ParseCron("*/15 * * * *")
+	require.NoError(t, err)
+	ran := make(chan time.Time, 10)
+	require.NoError(t, s.Add("quarterly", sched, func(context.Context) { ran <- clk.Now() }))
+	start(t, s)
+
+	clk.BlockUntil(1)
+	clk.Advance(8 * time.Minute)
+	assert.Equal(t, time.Date(2024, 3, 15, 10, 15, 0, 0, time.UTC), <-ran)
+
+	clk.BlockUntil(1)
+	clk.Advance(15 * time.Minute)
+	assert.Equal(t, time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC), <-ran)
+}
+
+func TestPanicIsolation(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := New(clk)
+
+	panics := make(chan any, 10)
+	s.OnPanic = func(job string, v any) {
+		assert.Equal(t, "bad", job)
+		panics <- v
+	}
+
+	good := make(chan struct{}, 10)
+	require.NoError(t, s.Add("bad", Every(time.Minute), func(context.Context) { panic("boom") }))
+	require.NoError(t, s.Add("good", Every(time.Minute), func(context.Context) { good <- struct{}{} }))
+	start(t, s)
+
+	for i := 0; i < 2; i++ {
+		clk.BlockUntil(2)
+		clk.Advance(time.Minute)
+		assert.Equal(t, "boom", <-panics)
+		<-good
+	}
+
+	assert.Eventually(t, func() bool {
+		st := stats(t, s, "bad")
+		return st.Runs == 2 && st.Panics == 2
+	}, time.Second, time.Millisecond, "the panicking job keeps its schedule")
+	assert.Equal(t, uint64(0), stats(t, s, "good").Panics)
+}
+
+// blockingJob signals when it starts and waits to be released
+func blockingJob() (fn func(context.Context), started chan struct{}, release chan struct{}) {
+	started = make(chan struct{}, 100)
+	release = make(chan struct{}, 100)
+	return func(context.Context) {
+		started <- struct{}{}
+		<-release
+	}, started, release
+}
+
+func TestOverlapSkip(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := New(clk)
+
+	fn, started, release := blockingJob()
+	require.NoError(t, s.Add("slow", Every(time.Minute), fn))
+	start(t, s)
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	<-started
+
+	// due again while the first run is still going
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	assert.Eventually(t, func() bool { return stats(t, s, "slow").Skipped == 1 }, time.Second, time.Millisecond)
+
+	release <- struct{}{}
+	assert.Eventually(t, func() bool { return stats(t, s, "slow").Runs == 1 }, time.Second, time.Millisecond)
+
+	// idle again, so the next tick runs
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	<-started
+	release <- struct{}{}
+	assert.Eventually(t, func() bool { return stats(t, s, "slow").Runs == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(1), stats(t, s, "slow").Skipped)
+}
+
+func TestOverlapQueue(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := New(clk)
+
+	var concurrent, maxConcurrent atomic.Int32
+	fn, started, release := blockingJob()
+	require.NoError(t, s.Add("slow", Every(time.Minute), func(ctx context.Context) {
+		n := concurrent.Add(1)
+		if n > maxConcurrent.Load() {
+			maxConcurrent.Store(n)
+		}
+		defer concurrent.Add(-1)
+		fn(ctx)
+	}, WithOverlap(Queue)))
+	start(t, s)
+
+	for i := 0; i < 3; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+	}
+	<-started
+
+	for i := 0; i < 3; i++ {
+		release <- struct{}{}
+	}
+	assert.Eventually(t, func() bool { return stats(t, s, "slow").Runs == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(0), stats(t, s, "slow").Skipped)
+	assert.Equal(t, int32(1), maxConcurrent.Load(), "queued runs still go one at a time")
+}
+
+func TestJitter(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := New(clk)
+	s.randInt63n = func(n int64) int64 { return n / 2 }
+
+	ran := make(chan time.Time, 10)
+	require.NoError(t, s.Add("jittery", Every(time.Minute), func(context.Context) { ran <- clk.Now() },
+		WithJitter(10*time.Second)))
+	start(t, s)
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	clk.BlockUntil(1)
+	assert.Empty(t, ran, "not due until the jitter has passed")
+
+	clk.Advance(5 * time.Second)
+	assert.Equal(t, time.Unix(65, 0), <-ran)
+
+	// the next run follows on from the schedule, not from the jittered time
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	assert.Equal(t, time.Unix(125, 0), <-ran)
+}
+
+func TestShutdownWaitsForRunningJobs(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := New(clk)
+
+	started := make(chan struct{})
+	var finished atomic.Bool
+	require.NoError(t, s.Add("long", Every(time.Minute), func(ctx context.Context) {
+		close(started)
+		<-ctx.Done() // notices shutdown through its context
+		finished.Store(true)
+	}))
+	stop := start(t, s)
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	<-started
+
+	assert.ErrorIs(t, stop(), context.Canceled)
+	assert.True(t, finished.Load(), "Run returned before the job did")
+}
+
+func TestAdd(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := New(clk)
+	noop := func(context.Context) {}
+
+	require.NoError(t, s.Add("a", Every(time.Minute), noop))
+	assert.ErrorIs(t, s.Add("a", Every(time.Minute), noop), ErrDuplicateJob)
+
+	stop := start(t, s)
+	clk.BlockUntil(1)
+	assert.ErrorIs(t, s.Add("b", Every(time.Minute), noop), ErrRunning)
+
+	stop()
+	assert.NoError(t, s.Add("b", Every(time.Minute), noop), "fine again once stopped")
+
+	_, ok := s.Stats("missing")
+	assert.False(t, ok)
+}
@@ -0,0 +1,128 @@
+package semaphore
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// A semaphore bounds how many goroutines can do something at once. Starting a
+// goroutine per URL is cheap, but opening a thousand connections to the same
+// server at once is rude at best and a self-inflicted outage at worst.
+//
+// There are two common ways to write one in Go
+
+/*
+ *
+ * a buffered channel
+ *
+ */
+
+// The channel's capacity is the limit. Acquiring is sending into it, which
+// blocks once it's full, releasing is receiving from it. There's no ordering
+// between blocked senders, whoever the scheduler wakes first wins
+type chanSemaphore chan struct{}
+
+func newChanSemaphore(n int) chanSemaphore {
+	return make(chanSemaphore, n)
+}
+
+func (s chanSemaphore) Acquire(ctx context.Context) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s chanSemaphore) Release() {
+	<-s
+}
+
+/*
+ *
+ * golang.org/x/sync/semaphore
+ *
+ */
+
+// semaphore.Weighted lets each caller take more than one unit, for when some
+// work costs more than others (a big download counting for 4 small ones).
+// Waiters are served first come first served: a large request at the front of
+// the queue isn't starved by a stream of small ones slipping past it
+type weightedSemaphore struct {
+	*semaphore.Weighted
+}
+
+func newWeightedSemaphore(n int64) weightedSemaphore {
+	return weightedSemaphore{semaphore.NewWeighted(n)}
+}
+
+func (s weightedSemaphore) Acquire(ctx context.Context) error {
+	return s.Weighted.Acquire(ctx, 1)
+}
+
+func (s weightedSemaphore) Release() {
+	s.Weighted.Release(1)
+}
+
+/*
+ *
+ * bounding outbound requests
+ *
+ */
+
+type limiter interface {
+	Acquire(ctx context.Context) error
+	Release()
+}
+
+// fetchStatuses GETs every URL concurrently, with at most lim's capacity in
+// flight at once. The goroutines all start straight away, and queue up on the
+// semaphore - not the server
+func fetchStatuses(ctx context.Context, c *http.Client, urls []string, lim limiter) ([]int, error) {
+	statuses := make([]int, len(urls))
+	errs := make([]error, len(urls))
+
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+
+			if err := lim.Acquire(ctx); err != nil {
+				errs[i] = err
+				return
+			}
+			defer lim.Release()
+
+			statuses[i], errs[i] = status(ctx, c, url)
+		}(i, url)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return statuses, err
+		}
+	}
+
+	return statuses, nil
+}
+
+func status(ctx context.Context, c *http.Client, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,131 @@
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// When a popular cache entry expires, every request that misses on it goes
+// upstream at the same time - the "thundering herd". singleflight makes
+// concurrent callers asking for the same key share one call instead.
+
+/*
+ *
+ * the hand-rolled version
+ *
+ */
+
+// call is one in-flight function call. Callers that arrive while it's running
+// wait on wg and then read val and err
+type call struct {
+	wg   sync.WaitGroup
+	val  interface{}
+	err  error
+	dups int
+}
+
+// Group has the same Do method as golang.org/x/sync/singleflight.Group, so
+// the two are interchangeable
+type Group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// Do runs fn once for every set of concurrent callers using the same key.
+// shared reports whether the result was handed to more than one caller
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = map[string]*call{}
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+
+	// the key is removed before waking the waiters, so the next caller after
+	// this point starts a fresh call rather than getting a stale result
+	g.mu.Lock()
+	delete(g.m, key)
+	shared = c.dups > 0
+	g.mu.Unlock()
+	c.wg.Done()
+
+	return c.val, c.err, shared
+}
+
+/*
+ *
+ * using it
+ *
+ */
+
+// doer is satisfied by both *Group and *singleflight.Group
+type doer interface {
+	Do(key string, fn func() (interface{}, error)) (interface{}, error, bool)
+}
+
+// Fetcher GETs URLs, sharing the response body between concurrent requests
+// for the same URL
+type Fetcher struct {
+	client *http.Client
+	group  doer
+}
+
+// NewFetcher uses golang.org/x/sync/singleflight, which is what you'd reach
+// for in real code
+func NewFetcher(client *http.Client) *Fetcher {
+	return &Fetcher{client: client, group: &singleflight.Group{}}
+}
+
+// newHandRolledFetcher is the same thing on top of our own Group
+func newHandRolledFetcher(client *http.Client) *Fetcher {
+	return &Fetcher{client: client, group: &Group{}}
+}
+
+// Fetch returns the body of url. Note the context of whichever caller got
+// there first is the one used for the upstream request - if it's cancelled,
+// everyone waiting on it gets the error too
+func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	v, err, _ := f.group.Do(url, func() (interface{}, error) {
+		return f.fetch(ctx, url)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]byte), nil
+}
+
+func (f *Fetcher) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,120 @@
+package singleflight
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/httputil"
+)
+
+func TestFetcherCallsUpstreamOnce(t *testing.T) {
+	fetchers := map[string]func(*http.Client) *Fetcher{
+		"x/sync":      NewFetcher,
+		"hand-rolled": newHandRolledFetcher,
+	}
+
+	for name, newFetcher := range fetchers {
+		t.Run(name, func(t *testing.T) {
+			var hits int32
+			release := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&hits, 1)
+				<-release
+				w.Write([]byte("expensive"))
+			}))
+			defer srv.Close()
+
+			f := newFetcher(srv.Client())
+
+			const callers = 20
+			var started, done sync.WaitGroup
+			bodies := make([][]byte, callers)
+			errs := make([]error, callers)
+			for i := 0; i < callers; i++ {
+				started.Add(1)
+				done.Add(1)
+				go func(i int) {
+					defer done.Done()
+					started.Done()
+					bodies[i], errs[i] = f.Fetch(context.Background(), srv.URL)
+				}(i)
+			}
+
+			// hold the upstream response until every other caller has
+			// joined the in-flight call
+			started.Wait()
+			assert.Eventually(t, func() bool { return atomic.LoadInt32(&hits) == 1 }, time.Second, time.Millisecond)
+			assert.Eventually(t, func() bool { return waitingInDo() == callers-1 }, 5*time.Second, time.Millisecond)
+			close(release)
+			done.Wait()
+
+			assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+			for i := range bodies {
+				assert.NoError(t, errs[i])
+				assert.Equal(t, "expensive", string(bodies[i]))
+			}
+		})
+	}
+}
+
+// waitingInDo counts goroutines blocked waiting for another caller's call
+// in a Group's Do. x/sync's Group has no way to ask who has joined a call,
+// but both Groups wait on a sync.WaitGroup inside Do, which shows up in the
+// goroutine's stack - and a caller waiting there has definitely joined
+func waitingInDo() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	n := 0
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, "sync.(*WaitGroup).Wait") && strings.Contains(g, "singleflight.(*Group).Do") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestGroupSequentialCallsAreNotShared(t *testing.T) {
+	var g Group
+	calls := 0
+	fn := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	v, _, shared := g.Do("k", fn)
+	assert.Equal(t, 1, v)
+	assert.False(t, shared)
+
+	v, _, shared = g.Do("k", fn)
+	assert.Equal(t, 2, v)
+	assert.False(t, shared)
+}
+
+func TestFetchErrorStatus(t *testing.T) {
+	cassette, err := httputil.LoadCassette(filepath.Join("testdata", "bad_gateway.json"))
+	require.NoError(t, err)
+	// recording the replay counts what was sent to it
+	up := httputil.NewRecorder(cassette.Transport())
+
+	_, err = NewFetcher(&http.Client{Transport: up}).Fetch(context.Background(), "http://upstream.test/")
+	assert.ErrorContains(t, err, "502 Bad Gateway")
+	assert.Len(t, up.Cassette.Interactions, 1)
+}
@@ -0,0 +1,119 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+/*
+ *
+ * migrations
+ *
+ */
+
+// embed lets us ship the .sql files inside the binary. The directive below
+// fills migrations with every file matching the pattern at compile time, so
+// there's nothing to copy around at deploy time
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// schema_migrations records which files have already been applied. The version
+// is the file name, which is why the files are prefixed with a zero padded number -
+// sorting the names sorts the migrations
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    TEXT PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Migrate applies every embedded migration that hasn't been applied yet.
+// Running it twice is safe, the second run finds nothing to do
+func Migrate(ctx context.Context, db *sql.DB) error {
+	return MigrateFS(ctx, db, migrations)
+}
+
+// MigrateFS applies the migrations/*.sql files in fsys. It takes an fs.FS
+// rather than the embed.FS directly, so tests can hand it an fstest.MapFS
+// with a broken migration in it, and other packages can bring their own
+// migrations - concepts/integrationtest has a set written for Postgres
+func MigrateFS(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	if _, err := db.ExecContext(ctx, createSchemaMigrations); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	names, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		if applied[version] {
+			continue
+		}
+
+		stmt, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		if err := applyMigration(ctx, db, version, string(stmt)); err != nil {
+			return fmt.Errorf("applying migration %s: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+func appliedVersions(ctx context.Context, db *sql.DB) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// Each migration runs in its own transaction together with the insert into
+// schema_migrations. Either both happen or neither does, so a failure halfway
+// through a file never leaves the version marked as applied
+func applyMigration(ctx context.Context, db *sql.DB, version, stmt string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback after a successful Commit is a no-op, so it's always safe to defer
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+
+	// $1 rather than ?, it's the one placeholder both sqlite and postgres take
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,98 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func versions(t *testing.T, db *sql.DB) []string {
+	rows, err := db.Query("SELECT version FROM schema_migrations ORDER BY version")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var v string
+		require.NoError(t, rows.Scan(&v))
+		out = append(out, v)
+	}
+
+	return out
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	require.NoError(t, err)
+
+	return n == 1
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	require.NoError(t, Migrate(ctx, db))
+	first := versions(t, db)
+	assert.Equal(t, []string{"0001_create_todos", "0002_index_todos_user_id"}, first)
+
+	require.NoError(t, Migrate(ctx, db))
+	assert.Equal(t, first, versions(t, db))
+}
+
+func TestMigrateFailureMidway(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	fsys := fstest.MapFS{
+		"migrations/0001_first.sql":  {Data: []byte("CREATE TABLE first (id INTEGER)")},
+		"migrations/0002_broken.sql": {Data: []byte("CREATE TABLE second (id INTEGER); NOT VALID SQL")},
+		"migrations/0003_third.sql":  {Data: []byte("CREATE TABLE third (id INTEGER)")},
+	}
+
+	err := MigrateFS(ctx, db, fsys)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "0002_broken")
+
+	// 0001 stays applied, 0002 is rolled back entirely, 0003 never runs
+	assert.Equal(t, []string{"0001_first"}, versions(t, db))
+	assert.True(t, tableExists(t, db, "first"))
+	assert.False(t, tableExists(t, db, "second"))
+	assert.False(t, tableExists(t, db, "third"))
+
+	// fixing the file and re-running picks up where we left off
+	fsys["migrations/0002_broken.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE second (id INTEGER)")}
+	require.NoError(t, MigrateFS(ctx, db, fsys))
+	assert.Equal(t, []string{"0001_first", "0002_broken", "0003_third"}, versions(t, db))
+}
+
+func TestTodoRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, filepath.Join(t.TempDir(), "todo.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	id, err := insertTodo(ctx, db, todo{UserID: 1, Title: "learn database/sql"})
+	require.NoError(t, err)
+
+	got, err := getTodo(ctx, db, id)
+	require.NoError(t, err)
+	assert.Equal(t, todo{ID: id, UserID: 1, Title: "learn database/sql"}, got)
+
+	_, err = getTodo(ctx, db, id+1)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
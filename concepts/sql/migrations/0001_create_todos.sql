@@ -0,0 +1,6 @@
+CREATE TABLE todos (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id   INTEGER NOT NULL,
+	title     TEXT    NOT NULL,
+	completed BOOLEAN NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1 @@
+CREATE INDEX todos_user_id ON todos (user_id);
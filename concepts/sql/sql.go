@@ -0,0 +1,66 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+
+	// database/sql is only the interface, a driver registers itself by name
+	// in its init function, which is why it's imported for side effects only
+	_ "modernc.org/sqlite"
+)
+
+// database/sql provides a generic interface around SQL databases. *sql.DB is
+// not a single connection, it's a pool, and like http.Client you only need one
+// for your whole program
+
+// Open returns a pool for the sqlite database at dsn, with the schema migrated
+func Open(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// sql.Open doesn't actually connect, PingContext does
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+type todo struct {
+	ID        int64
+	UserID    int64
+	Title     string
+	Completed bool
+}
+
+// Always use the Context variants of Exec and Query, so a cancelled request
+// stops its query too
+func insertTodo(ctx context.Context, db *sql.DB, t todo) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		"INSERT INTO todos (user_id, title, completed) VALUES (?, ?, ?)",
+		t.UserID, t.Title, t.Completed)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+// QueryRowContext defers any error until Scan, which returns sql.ErrNoRows
+// when nothing matched
+func getTodo(ctx context.Context, db *sql.DB, id int64) (todo, error) {
+	var t todo
+	err := db.QueryRowContext(ctx,
+		"SELECT id, user_id, title, completed FROM todos WHERE id = ?", id).
+		Scan(&t.ID, &t.UserID, &t.Title, &t.Completed)
+
+	return t, err
+}
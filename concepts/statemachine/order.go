@@ -0,0 +1,93 @@
+package statemachine
+
+import (
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+/*
+ *
+ * an order's lifecycle
+ *
+ */
+
+// An order goes
+//
+//	pending --pay--> paid --ship--> shipped --deliver--> delivered
+//	   |              |                                      |
+//	 cancel         cancel                                 refund
+//	   v              v                                      v
+//	cancelled      refunded <--------------------------------+
+//
+// Shipping needs an address, and a refund has to come within the return
+// window. Everything not drawn is an error
+
+type OrderState string
+
+const (
+	Pending   OrderState = "pending"
+	Paid      OrderState = "paid"
+	Shipped   OrderState = "shipped"
+	Delivered OrderState = "delivered"
+	Cancelled OrderState = "cancelled"
+	Refunded  OrderState = "refunded"
+)
+
+type OrderEvent string
+
+const (
+	Pay     OrderEvent = "pay"
+	Ship    OrderEvent = "ship"
+	Deliver OrderEvent = "deliver"
+	Cancel  OrderEvent = "cancel"
+	Refund  OrderEvent = "refund"
+)
+
+const returnWindow = 30 * 24 * time.Hour
+
+type order struct {
+	ID      string
+	Total   int64 // cents
+	Address string
+
+	PaidAt      time.Time
+	DeliveredAt time.Time
+	RefundedAmt int64
+	History     []Transition[OrderState, OrderEvent]
+
+	clk clock.Clock
+	fsm *Machine[OrderState, OrderEvent, *order]
+}
+
+var orderTable = NewTable[OrderState, OrderEvent, *order]().
+	Permit(Pending, Pay, Paid).
+	Permit(Pending, Cancel, Cancelled).
+	Permit(Paid, Ship, Shipped, hasAddress).
+	Permit(Paid, Cancel, Refunded). // cancelling after paying means giving the money back
+	Permit(Shipped, Deliver, Delivered).
+	Permit(Delivered, Refund, Refunded, withinReturnWindow).
+	OnEnter(Paid, func(_ Transition[OrderState, OrderEvent], o *order) { o.PaidAt = o.clk.Now() }).
+	OnEnter(Delivered, func(_ Transition[OrderState, OrderEvent], o *order) { o.DeliveredAt = o.clk.Now() }).
+	OnEnter(Refunded, func(_ Transition[OrderState, OrderEvent], o *order) { o.RefundedAmt = o.Total }).
+	OnTransition(func(t Transition[OrderState, OrderEvent], o *order) { o.History = append(o.History, t) })
+
+func hasAddress(o *order) bool { return o.Address != "" }
+
+func withinReturnWindow(o *order) bool {
+	return o.clk.Now().Sub(o.DeliveredAt) <= returnWindow
+}
+
+func newOrder(id string, total int64, clk clock.Clock) *order {
+	o := &order{ID: id, Total: total, clk: clk}
+	o.fsm = NewMachine(orderTable, Pending)
+	return o
+}
+
+func (o *order) State() OrderState { return o.fsm.State() }
+
+func (o *order) Pay() error     { return o.fsm.Fire(Pay, o) }
+func (o *order) Ship() error    { return o.fsm.Fire(Ship, o) }
+func (o *order) Deliver() error { return o.fsm.Fire(Deliver, o) }
+func (o *order) Cancel() error  { return o.fsm.Fire(Cancel, o) }
+func (o *order) Refund() error  { return o.fsm.Fire(Refund, o) }
@@ -0,0 +1,183 @@
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// A finite state machine is a fixed set of states, and a table saying which
+// event moves you from which state to which. Writing that table down
+// explicitly, instead of scattering "if status == X" checks through the
+// code, means every legal move is in one place and every other move is an
+// error by default - an order can't be shipped twice because nobody wrote
+// down Shipped + ship.
+//
+// On top of the bare table:
+//
+//   - guards: a transition can have conditions, checked in order. If an
+//     event has several transitions from the same state, the first whose
+//     guards all pass wins - "failure moves closed to open, but only once
+//     there have been five"
+//   - entry and exit hooks: run when a state is entered or left, which is
+//     where side effects like recording a timestamp belong. Transitions
+//     back to the same state don't run them, nothing was entered or left
+//
+// The machine is generic over the state type S, the event type E and C,
+// whatever the guards and hooks need to see - usually a pointer to the thing
+// whose state this is
+
+var (
+	ErrInvalidTransition = errors.New("statemachine: invalid transition")
+	ErrGuardRejected     = errors.New("statemachine: rejected by guard")
+)
+
+// Transition is one move through the table
+type Transition[S, E comparable] struct {
+	From  S
+	Event E
+	To    S
+}
+
+// Hook runs on entering or leaving a state
+type Hook[S, E comparable, C any] func(t Transition[S, E], c C)
+
+// Guard decides whether a transition may happen
+type Guard[C any] func(c C) bool
+
+type key[S, E comparable] struct {
+	from  S
+	event E
+}
+
+type rule[S comparable, C any] struct {
+	to     S
+	guards []Guard[C]
+}
+
+// Table holds the transitions and hooks. Build it once, typically in a
+// package level var, and share it between every Machine using it - it must
+// not be changed once machines are running
+type Table[S, E comparable, C any] struct {
+	rules map[key[S, E]][]rule[S, C]
+	enter map[S][]Hook[S, E, C]
+	exit  map[S][]Hook[S, E, C]
+	any   []Hook[S, E, C]
+}
+
+func NewTable[S, E comparable, C any]() *Table[S, E, C] {
+	return &Table[S, E, C]{
+		rules: make(map[key[S, E]][]rule[S, C]),
+		enter: make(map[S][]Hook[S, E, C]),
+		exit:  make(map[S][]Hook[S, E, C]),
+	}
+}
+
+// Permit allows event to move from one state to another when every guard
+// passes. Transitions for the same state and event are tried in the order
+// they were added
+func (t *Table[S, E, C]) Permit(from S, event E, to S, guards ...Guard[C]) *Table[S, E, C] {
+	k := key[S, E]{from, event}
+	t.rules[k] = append(t.rules[k], rule[S, C]{to: to, guards: guards})
+	return t
+}
+
+// OnEnter runs fn whenever the machine moves into s from another state
+func (t *Table[S, E, C]) OnEnter(s S, fn Hook[S, E, C]) *Table[S, E, C] {
+	t.enter[s] = append(t.enter[s], fn)
+	return t
+}
+
+// OnExit runs fn whenever the machine moves out of s to another state
+func (t *Table[S, E, C]) OnExit(s S, fn Hook[S, E, C]) *Table[S, E, C] {
+	t.exit[s] = append(t.exit[s], fn)
+	return t
+}
+
+// OnTransition runs fn after every successful transition, including ones
+// back to the same state - handy for logging or an audit trail
+func (t *Table[S, E, C]) OnTransition(fn Hook[S, E, C]) *Table[S, E, C] {
+	t.any = append(t.any, fn)
+	return t
+}
+
+// resolve finds where event takes the machine from s
+func (t *Table[S, E, C]) resolve(s S, event E, c C) (S, error) {
+	rules, ok := t.rules[key[S, E]{s, event}]
+	if !ok {
+		return s, fmt.Errorf("%w: %v in state %v", ErrInvalidTransition, event, s)
+	}
+
+next:
+	for _, r := range rules {
+		for _, g := range r.guards {
+			if !g(c) {
+				continue next
+			}
+		}
+		return r.to, nil
+	}
+	return s, fmt.Errorf("%w: %v in state %v", ErrGuardRejected, event, s)
+}
+
+// Machine is one thing moving through a Table's states
+type Machine[S, E comparable, C any] struct {
+	table *Table[S, E, C]
+
+	mu    sync.Mutex
+	state S
+}
+
+// NewMachine starts a machine in initial. No entry hook runs for it
+func NewMachine[S, E comparable, C any](t *Table[S, E, C], initial S) *Machine[S, E, C] {
+	return &Machine[S, E, C]{table: t, state: initial}
+}
+
+// State is the current state
+func (m *Machine[S, E, C]) State() S {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Can reports whether Fire would succeed
+func (m *Machine[S, E, C]) Can(event E, c C) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.table.resolve(m.state, event, c)
+	return err == nil
+}
+
+// Fire applies event. On success the exit hooks of the old state run, then
+// the state changes, then the entry hooks of the new one and finally the
+// OnTransition hooks. On error nothing happens at all.
+//
+// Hooks run with the machine locked, so they mustn't call Fire themselves
+func (m *Machine[S, E, C]) Fire(event E, c C) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	to, err := m.table.resolve(m.state, event, c)
+	if err != nil {
+		return err
+	}
+
+	tr := Transition[S, E]{From: m.state, Event: event, To: to}
+	changed := tr.From != tr.To
+	if changed {
+		for _, h := range m.table.exit[tr.From] {
+			h(tr, c)
+		}
+	}
+	m.state = to
+	if changed {
+		for _, h := range m.table.enter[tr.To] {
+			h(tr, c)
+		}
+	}
+	for _, h := range m.table.any {
+		h(tr, c)
+	}
+	return nil
+}
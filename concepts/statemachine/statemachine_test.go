@@ -0,0 +1,168 @@
+package statemachine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+type light string
+type signal string
+
+func TestGuardsTriedInOrder(t *testing.T) {
+	type counter struct{ n int }
+	table := NewTable[light, signal, *counter]().
+		Permit("green", "tick", "yellow", func(c *counter) bool { return c.n >= 3 }).
+		Permit("green", "tick", "green")
+
+	m := NewMachine(table, light("green"))
+	c := &counter{}
+	for c.n = 0; c.n < 3; c.n++ {
+		require.NoError(t, m.Fire("tick", c))
+		assert.Equal(t, light("green"), m.State())
+	}
+	require.NoError(t, m.Fire("tick", c))
+	assert.Equal(t, light("yellow"), m.State())
+}
+
+func TestGuardRejected(t *testing.T) {
+	table := NewTable[light, signal, bool]().
+		Permit("red", "go", "green", func(ok bool) bool { return ok })
+
+	m := NewMachine(table, light("red"))
+	assert.False(t, m.Can("go", false))
+	assert.ErrorIs(t, m.Fire("go", false), ErrGuardRejected)
+	assert.Equal(t, light("red"), m.State())
+
+	assert.True(t, m.Can("go", true))
+	assert.NoError(t, m.Fire("go", true))
+
+	err := m.Fire("go", true)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+	assert.Contains(t, err.Error(), "go in state green")
+}
+
+func TestHookOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Hook[light, signal, struct{}] {
+		return func(tr Transition[light, signal], _ struct{}) {
+			calls = append(calls, name+" "+string(tr.From)+"->"+string(tr.To))
+		}
+	}
+	table := NewTable[light, signal, struct{}]().
+		Permit("red", "go", "green").
+		Permit("green", "stay", "green").
+		OnExit("red", record("exit")).
+		OnEnter("green", record("enter")).
+		OnExit("green", record("exit green")).
+		OnTransition(record("any"))
+
+	m := NewMachine(table, light("red"))
+	require.NoError(t, m.Fire("go", struct{}{}))
+	require.NoError(t, m.Fire("stay", struct{}{}))
+
+	assert.Equal(t, []string{
+		"exit red->green",
+		"enter red->green",
+		"any red->green",
+		"any green->green", // staying put skips entry and exit
+	}, calls)
+}
+
+/*
+ *
+ * orders
+ *
+ */
+
+var allOrderStates = []OrderState{Pending, Paid, Shipped, Delivered, Cancelled, Refunded}
+var allOrderEvents = []OrderEvent{Pay, Ship, Deliver, Cancel, Refund}
+
+// TestOrderTransitionTable tries every event in every state. Anything not
+// listed must be rejected, so adding a transition without updating this
+// table fails the test
+func TestOrderTransitionTable(t *testing.T) {
+	want := map[OrderState]map[OrderEvent]OrderState{
+		Pending:   {Pay: Paid, Cancel: Cancelled},
+		Paid:      {Ship: Shipped, Cancel: Refunded},
+		Shipped:   {Deliver: Delivered},
+		Delivered: {Refund: Refunded},
+		Cancelled: {},
+		Refunded:  {},
+	}
+
+	epoch := time.Unix(0, 0)
+	for _, from := range allOrderStates {
+		for _, ev := range allOrderEvents {
+			// an order that passes every guard
+			o := &order{Total: 100, Address: "1 Go Way", DeliveredAt: epoch, clk: clock.NewFake(epoch)}
+			o.fsm = NewMachine(orderTable, from)
+
+			err := o.fsm.Fire(ev, o)
+			if to, ok := want[from][ev]; ok {
+				assert.NoError(t, err, "%s + %s", from, ev)
+				assert.Equal(t, to, o.State(), "%s + %s", from, ev)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidTransition, "%s + %s", from, ev)
+				assert.Equal(t, from, o.State(), "%s + %s", from, ev)
+			}
+		}
+	}
+}
+
+func TestOrderHappyPath(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	o := newOrder("o-1", 2599, clk)
+	o.Address = "1 Go Way"
+
+	require.NoError(t, o.Pay())
+	clk.Advance(time.Hour)
+	require.NoError(t, o.Ship())
+	clk.Advance(48 * time.Hour)
+	require.NoError(t, o.Deliver())
+
+	assert.Equal(t, Delivered, o.State())
+	assert.Equal(t, time.Unix(0, 0), o.PaidAt)
+	assert.Equal(t, time.Unix(0, 0).Add(49*time.Hour), o.DeliveredAt)
+	assert.Equal(t, []Transition[OrderState, OrderEvent]{
+		{Pending, Pay, Paid},
+		{Paid, Ship, Shipped},
+		{Shipped, Deliver, Delivered},
+	}, o.History)
+
+	assert.ErrorIs(t, o.Pay(), ErrInvalidTransition, "can't pay twice")
+	assert.Len(t, o.History, 3, "failed events aren't recorded")
+}
+
+func TestOrderGuards(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+
+	o := newOrder("o-2", 500, clk)
+	require.NoError(t, o.Pay())
+	assert.ErrorIs(t, o.Ship(), ErrGuardRejected, "no address")
+	o.Address = "1 Go Way"
+	require.NoError(t, o.Ship())
+	require.NoError(t, o.Deliver())
+
+	clk.Advance(returnWindow + time.Second)
+	assert.ErrorIs(t, o.Refund(), ErrGuardRejected, "outside the return window")
+	assert.Equal(t, int64(0), o.RefundedAmt)
+}
+
+func TestOrderCancel(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+
+	unpaid := newOrder("o-3", 500, clk)
+	require.NoError(t, unpaid.Cancel())
+	assert.Equal(t, Cancelled, unpaid.State())
+	assert.Equal(t, int64(0), unpaid.RefundedAmt)
+
+	paid := newOrder("o-4", 500, clk)
+	require.NoError(t, paid.Pay())
+	require.NoError(t, paid.Cancel())
+	assert.Equal(t, Refunded, paid.State())
+	assert.Equal(t, int64(500), paid.RefundedAmt, "the entry hook refunds it")
+}
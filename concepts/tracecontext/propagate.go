@@ -0,0 +1,100 @@
+package tracecontext
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Span identifies the piece of work a request is, within its trace
+type Span struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Parent is the caller's span, zero when this span started the trace
+	Parent SpanID
+	Flags  Flags
+	State  State
+}
+
+// Traceparent is the header to send on a request made as part of s
+func (s Span) Traceparent() string {
+	return Parent{TraceID: s.TraceID, SpanID: s.SpanID, Flags: s.Flags}.String()
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, s Span) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// FromContext returns the current span, if there is one
+func FromContext(ctx context.Context) (Span, bool) {
+	s, ok := ctx.Value(ctxKey{}).(Span)
+	return s, ok
+}
+
+// Start returns a span for an incoming request: a child of the caller's
+// span if the headers name a valid one, the root of a new trace if not.
+// New traces are sampled - a real tracer would decide here, and the flag
+// tells everyone downstream what was decided
+func Start(h http.Header) Span {
+	p, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		// a bad or missing traceparent means tracestate can't be trusted
+		// either, so both are dropped
+		return Span{TraceID: NewTraceID(), SpanID: NewSpanID(), Flags: FlagSampled}
+	}
+
+	s := Span{TraceID: p.TraceID, SpanID: NewSpanID(), Parent: p.SpanID, Flags: p.Flags}
+	if st, err := ParseTracestate(strings.Join(h.Values(TracestateHeader), ",")); err == nil {
+		s.State = st
+	}
+	return s
+}
+
+// Inject sets the headers for a request made as part of s
+func Inject(h http.Header, s Span) {
+	h.Set(TraceparentHeader, s.Traceparent())
+	if s.State.Len() > 0 {
+		h.Set(TracestateHeader, s.State.String())
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// Middleware starts a span for every request and puts it in the request's
+// context, where handlers, loggers and Transport find it. The trace id is
+// echoed back in a response header too, which makes it easy for a client
+// to quote when reporting a problem
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := Start(r.Header)
+		w.Header().Set("Trace-Id", s.TraceID.String())
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), s)))
+	})
+}
+
+// Transport sends the current span along with outgoing requests. It uses
+// the span from the request's context as the parent-id directly; a full
+// tracer would start a client span for the call and send that instead,
+// which is what otelhttp does
+type Transport struct {
+	Base http.RoundTripper // http.DefaultTransport if nil
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	s, ok := FromContext(r.Context())
+	if !ok {
+		return base.RoundTrip(r)
+	}
+
+	// a RoundTripper mustn't change the request it was given
+	r = r.Clone(r.Context())
+	Inject(r.Header, s)
+	return base.RoundTrip(r)
+}
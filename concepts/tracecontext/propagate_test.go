@@ -0,0 +1,134 @@
+package tracecontext
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hop is two services: the frontend handles a request by calling the
+// backend through Transport. Each remembers the span its request had
+type hop struct {
+	mu                sync.Mutex
+	frontend, backend Span
+	backendHeaders    http.Header
+
+	front *httptest.Server
+}
+
+func newHop(t *testing.T) *hop {
+	h := &hop{}
+
+	back := httptest.NewServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, _ := FromContext(r.Context())
+		h.mu.Lock()
+		h.backend, h.backendHeaders = s, r.Header.Clone()
+		h.mu.Unlock()
+	})))
+	t.Cleanup(back.Close)
+
+	client := &http.Client{Transport: &Transport{}}
+	h.front = httptest.NewServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, _ := FromContext(r.Context())
+		h.mu.Lock()
+		h.frontend = s
+		h.mu.Unlock()
+
+		// the request must carry the context, or the transport has no
+		// span to send
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, back.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	})))
+	t.Cleanup(h.front.Close)
+	return h
+}
+
+func (h *hop) get(t *testing.T, header http.Header) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, h.front.URL, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return resp
+}
+
+func TestPropagationStartsATrace(t *testing.T) {
+	h := newHop(t)
+	resp := h.get(t, nil)
+
+	assert.True(t, h.frontend.TraceID.IsValid())
+	assert.False(t, h.frontend.Parent.IsValid(), "the frontend started the trace")
+	assert.Equal(t, h.frontend.TraceID.String(), resp.Header.Get("Trace-Id"))
+
+	assert.Equal(t, h.frontend.TraceID, h.backend.TraceID, "one trace across both")
+	assert.Equal(t, h.frontend.SpanID, h.backend.Parent, "the backend's parent is the frontend")
+	assert.NotEqual(t, h.frontend.SpanID, h.backend.SpanID)
+	assert.True(t, h.backend.Flags.Sampled())
+}
+
+func TestPropagationContinuesATrace(t *testing.T) {
+	h := newHop(t)
+	h.get(t, http.Header{
+		"Traceparent": {example},
+		"Tracestate":  {"rojo=00f067aa0ba902b7", "congo=t61rcWkgMzE"},
+	})
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", h.frontend.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", h.frontend.Parent.String())
+	assert.Equal(t, h.frontend.TraceID, h.backend.TraceID)
+	assert.Equal(t, h.frontend.SpanID, h.backend.Parent)
+
+	// tracestate isn't ours, but it's passed on, both headers as one
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", h.backendHeaders.Get("Tracestate"))
+	assert.Equal(t, h.backend.State, h.frontend.State)
+}
+
+func TestPropagationKeepsFlags(t *testing.T) {
+	h := newHop(t)
+	h.get(t, http.Header{"Traceparent": {example[:53] + "00"}})
+
+	assert.False(t, h.frontend.Flags.Sampled())
+	assert.False(t, h.backend.Flags.Sampled(), "an unsampled trace stays unsampled downstream")
+}
+
+func TestPropagationRestartsOnGarbage(t *testing.T) {
+	h := newHop(t)
+	h.get(t, http.Header{
+		"Traceparent": {"00-not-a-real-header"},
+		"Tracestate":  {"rojo=1"},
+	})
+
+	assert.True(t, h.frontend.TraceID.IsValid())
+	assert.False(t, h.frontend.Parent.IsValid())
+	assert.Zero(t, h.frontend.State.Len(), "tracestate goes with a bad traceparent")
+	assert.Empty(t, h.backendHeaders.Get("Tracestate"))
+	assert.Equal(t, h.frontend.TraceID, h.backend.TraceID)
+}
+
+func TestTransportDoesNotModifyRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	s := Start(http.Header{})
+	req, _ := http.NewRequestWithContext(NewContext(context.Background(), s), http.MethodGet, srv.URL, nil)
+	resp, err := (&http.Client{Transport: &Transport{}}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, req.Header.Get(TraceparentHeader))
+}
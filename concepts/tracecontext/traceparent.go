@@ -0,0 +1,288 @@
+package tracecontext
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// concepts/tracing leaves propagation to OpenTelemetry. Underneath, it's
+// two HTTP headers defined by the W3C Trace Context spec, and nothing
+// stops a service doing it by hand:
+//
+//	traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+//	             │  │                                │                └ flags, 01 = sampled
+//	             │  │                                └ parent-id, the caller's span
+//	             │  └ trace-id, the same for every span in the trace
+//	             └ version
+//
+//	tracestate: congo=t61rcWkgMzE,rojo=00f067aa0ba902b7
+//
+// traceparent is all that's needed to join a trace. tracestate carries
+// vendor specific extras alongside, a list of key=value pairs that a
+// service passes on even when it doesn't understand them.
+//
+// A service receiving a request keeps the trace-id, takes the parent-id
+// as its parent, and makes up a new ID for its own span. When it calls
+// another service it sends its own span's ID as that request's parent-id,
+// and so the chain continues. IDs come from crypto/rand: the spec asks for
+// them to be random, and they must never collide across a whole fleet
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+var (
+	ErrMalformed   = errors.New("tracecontext: malformed traceparent")
+	ErrBadVersion  = errors.New("tracecontext: unsupported traceparent version")
+	ErrInvalidID   = errors.New("tracecontext: all-zero trace or parent id")
+	ErrBadState    = errors.New("tracecontext: malformed tracestate")
+	errTooManyKeys = fmt.Errorf("%w: more than %d entries", ErrBadState, maxStateEntries)
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// NewTraceID and NewSpanID return random IDs. crypto/rand doesn't fail on
+// any platform Go supports, and an ID that might repeat is worse than no
+// ID, so a failure panics
+func NewTraceID() TraceID {
+	var t TraceID
+	mustRead(t[:])
+	return t
+}
+
+func NewSpanID() SpanID {
+	var s SpanID
+	mustRead(s[:])
+	return s
+}
+
+func mustRead(b []byte) {
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(fmt.Sprintf("tracecontext: reading random bytes: %v", err))
+		}
+		// all zeros means invalid, so in the unlikely event, go again
+		for _, c := range b {
+			if c != 0 {
+				return
+			}
+		}
+	}
+}
+
+// Flags is the traceparent's trace-flags byte. Sampled is the only flag
+// defined so far; the rest must be passed along untouched
+type Flags byte
+
+const FlagSampled Flags = 0x01
+
+func (f Flags) Sampled() bool { return f&FlagSampled != 0 }
+
+// Parent is what a traceparent header says: whose request this is
+type Parent struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   Flags
+}
+
+// String formats p as a version 00 traceparent
+func (p Parent) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", p.TraceID, p.SpanID, byte(p.Flags))
+}
+
+// ParseTraceparent parses a traceparent header. Versions after 00 are
+// read as if they were 00, as the spec says to, as long as the fields
+// everyone agrees on are where they should be - a newer version may only
+// add fields on the end. Version ff is never valid
+func ParseTraceparent(s string) (Parent, error) {
+	// version 00 is exactly 55 characters: 2+1+32+1+16+1+2
+	if len(s) < 55 {
+		return Parent{}, ErrMalformed
+	}
+	version, err := hexByte(s[0:2])
+	if err != nil || s[2] != '-' {
+		return Parent{}, ErrMalformed
+	}
+	switch {
+	case version == 0xff:
+		return Parent{}, ErrBadVersion
+	case version == 0 && len(s) != 55:
+		return Parent{}, ErrMalformed
+	case version > 0 && len(s) > 55 && s[55] != '-':
+		return Parent{}, ErrMalformed
+	}
+
+	var p Parent
+	if s[35] != '-' || s[52] != '-' {
+		return Parent{}, ErrMalformed
+	}
+	if err := hexInto(p.TraceID[:], s[3:35]); err != nil {
+		return Parent{}, err
+	}
+	if err := hexInto(p.SpanID[:], s[36:52]); err != nil {
+		return Parent{}, err
+	}
+	flags, err := hexByte(s[53:55])
+	if err != nil {
+		return Parent{}, ErrMalformed
+	}
+	p.Flags = Flags(flags)
+
+	if !p.TraceID.IsValid() || !p.SpanID.IsValid() {
+		return Parent{}, ErrInvalidID
+	}
+	return p, nil
+}
+
+// hexInto decodes lowercase hex only, as the spec requires
+func hexInto(dst []byte, s string) error {
+	if strings.ToLower(s) != s {
+		return ErrMalformed
+	}
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
+
+func hexByte(s string) (byte, error) {
+	var b [1]byte
+	err := hexInto(b[:], s)
+	return b[0], err
+}
+
+/*
+ *
+ * tracestate
+ *
+ */
+
+const maxStateEntries = 32
+
+// State is a parsed tracestate: vendor entries, most recently updated
+// first. The zero value is empty and ready to use
+type State struct {
+	entries []stateEntry
+}
+
+type stateEntry struct{ key, value string }
+
+// ParseTracestate parses a tracestate header. Several headers are joined
+// with commas first, which is what http.Header.Values then strings.Join
+// gives. A malformed list is thrown away whole, as the spec says
+func ParseTracestate(s string) (State, error) {
+	var st State
+	seen := map[string]bool{}
+	for _, member := range strings.Split(s, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue // empty members are allowed, and ignored
+		}
+		key, value, ok := strings.Cut(member, "=")
+		if !ok || !validKey(key) || !validValue(value) {
+			return State{}, fmt.Errorf("%w: %q", ErrBadState, member)
+		}
+		if seen[key] {
+			return State{}, fmt.Errorf("%w: %q appears twice", ErrBadState, key)
+		}
+		seen[key] = true
+		st.entries = append(st.entries, stateEntry{key, value})
+	}
+	if len(st.entries) > maxStateEntries {
+		return State{}, errTooManyKeys
+	}
+	return st, nil
+}
+
+// Get returns key's value
+func (s State) Get(key string) (string, bool) {
+	for _, e := range s.entries {
+		if e.key == key {
+			return e.value, true
+		}
+	}
+	return "", false
+}
+
+// Put returns a State with key set to value and moved to the front, which
+// is what a vendor does to its own entry when its service handles a
+// request. If that makes too many entries, the oldest is dropped
+func (s State) Put(key, value string) (State, error) {
+	if !validKey(key) || !validValue(value) {
+		return s, fmt.Errorf("%w: %s=%s", ErrBadState, key, value)
+	}
+	out := State{entries: make([]stateEntry, 0, len(s.entries)+1)}
+	out.entries = append(out.entries, stateEntry{key, value})
+	for _, e := range s.entries {
+		if e.key != key {
+			out.entries = append(out.entries, e)
+		}
+	}
+	if len(out.entries) > maxStateEntries {
+		out.entries = out.entries[:maxStateEntries]
+	}
+	return out, nil
+}
+
+func (s State) Len() int { return len(s.entries) }
+
+func (s State) String() string {
+	parts := make([]string, len(s.entries))
+	for i, e := range s.entries {
+		parts[i] = e.key + "=" + e.value
+	}
+	return strings.Join(parts, ",")
+}
+
+// validKey allows the spec's simple keys, lowercase and digits plus _-*/,
+// and multi-tenant ones, tenant@system
+func validKey(k string) bool {
+	tenant, system, multi := strings.Cut(k, "@")
+	if !multi {
+		return len(k) <= 256 && keyChars(k, true)
+	}
+	return len(tenant) <= 241 && keyChars(tenant, false) && len(system) <= 14 && keyChars(system, true)
+}
+
+func keyChars(s string, letterFirst bool) bool {
+	if s == "" {
+		return false
+	}
+	if letterFirst && (s[0] < 'a' || s[0] > 'z') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("_-*/", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// validValue allows up to 256 printable ASCII characters except comma and
+// equals, not ending in a space
+func validValue(v string) bool {
+	if v == "" || len(v) > 256 || v[len(v)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package tracecontext
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the example from the spec
+const example = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	p, err := ParseTraceparent(example)
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", p.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", p.SpanID.String())
+	assert.True(t, p.Flags.Sampled())
+	assert.Equal(t, example, p.String())
+
+	tests := []struct {
+		name string
+		in   string
+		want error
+	}{
+		{"empty", "", ErrMalformed},
+		{"too short", example[:54], ErrMalformed},
+		{"version 00 too long", example + "-00", ErrMalformed},
+		{"uppercase", strings.ToUpper(example), ErrMalformed},
+		{"wrong separator", strings.Replace(example, "-", "_", 1), ErrMalformed},
+		{"not hex", "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", ErrMalformed},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ErrInvalidID},
+		{"zero parent id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", ErrInvalidID},
+		{"version ff", "ff" + example[2:], ErrBadVersion},
+		{"future version, extra junk", "cc" + example[2:] + "x", ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTraceparent(tt.in)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	t.Run("future version with more fields", func(t *testing.T) {
+		p, err := ParseTraceparent("cc" + example[2:] + "-what-the-future-holds")
+		require.NoError(t, err)
+		assert.Equal(t, "00f067aa0ba902b7", p.SpanID.String())
+	})
+
+	t.Run("unknown flags survive", func(t *testing.T) {
+		p, err := ParseTraceparent(example[:53] + "09")
+		require.NoError(t, err)
+		assert.True(t, p.Flags.Sampled())
+		assert.Equal(t, example[:53]+"09", p.String())
+	})
+}
+
+func TestNewIDs(t *testing.T) {
+	seen := map[TraceID]bool{}
+	for i := 0; i < 1000; i++ {
+		id := NewTraceID()
+		require.True(t, id.IsValid())
+		require.False(t, seen[id])
+		seen[id] = true
+	}
+	assert.True(t, NewSpanID().IsValid())
+}
+
+func TestTracestate(t *testing.T) {
+	st, err := ParseTracestate("rojo=00f067aa0ba902b7, congo=t61rcWkgMzE,, tenant@vendor=x")
+	require.NoError(t, err)
+	assert.Equal(t, 3, st.Len())
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE,tenant@vendor=x", st.String())
+
+	v, ok := st.Get("congo")
+	assert.True(t, ok)
+	assert.Equal(t, "t61rcWkgMzE", v)
+
+	// updating an entry moves it to the front
+	st, err = st.Put("congo", "new")
+	require.NoError(t, err)
+	assert.Equal(t, "congo=new,rojo=00f067aa0ba902b7,tenant@vendor=x", st.String())
+
+	for _, bad := range []string{
+		"Upper=1",
+		"novalue",
+		"k=v=w",
+		"dup=1,dup=2",
+		"1starts-with-digit=x",
+		"k=tab\tinside",
+	} {
+		_, err := ParseTracestate(bad)
+		assert.ErrorIs(t, err, ErrBadState, bad)
+	}
+
+	var many []string
+	for i := 0; i < 33; i++ {
+		many = append(many, fmt.Sprintf("k%d=v", i))
+	}
+	_, err = ParseTracestate(strings.Join(many, ","))
+	assert.ErrorIs(t, err, ErrBadState)
+
+	t.Run("put drops the oldest when full", func(t *testing.T) {
+		st, err := ParseTracestate(strings.Join(many[:32], ","))
+		require.NoError(t, err)
+		st, err = st.Put("mine", "1")
+		require.NoError(t, err)
+		assert.Equal(t, 32, st.Len())
+		_, ok := st.Get("k31")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/thorntonmc/go-practice/apps/todo"
+	jsonconcept "github.com/thorntonmc/go-practice/concepts/json"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer, so a span can be traced back to the
+// code that made it
+const instrumentation = "github.com/thorntonmc/go-practice/concepts/tracing"
+
+/*
+ *
+ * the todo service
+ *
+ */
+
+// NewHandler serves GET and POST /todos, traced. otelhttp starts a server
+// span for each request - carrying on the caller's trace if a traceparent
+// came in - and the handlers add children for the repository and JSON
+func NewHandler(repo todo.TodoRepository, tp trace.TracerProvider) http.Handler {
+	s := &service{
+		repo:   NewTracedRepository(repo, tp),
+		tracer: tp.Tracer(instrumentation),
+	}
+
+	m := http.NewServeMux()
+	handle(m, "/todos", http.HandlerFunc(s.todos))
+	return otelhttp.NewHandler(m, "todo",
+		otelhttp.WithTracerProvider(tp),
+		otelhttp.WithPropagators(propagator),
+	)
+}
+
+// handle registers h, renaming the request's span after the route once
+// it's known. otelhttp starts the span before the mux has picked a route,
+// so it can only name it after the operation; naming it after the raw
+// path instead would make a new span name for every todo id
+func handle(m *http.ServeMux, route string, h http.Handler) {
+	m.Handle(route, otelhttp.WithRouteTag(route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetName(r.Method + " " + route)
+		h.ServeHTTP(w, r)
+	})))
+}
+
+type service struct {
+	repo   todo.TodoRepository
+	tracer trace.Tracer
+}
+
+func (s *service) todos(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		todos, err := s.repo.List(ctx)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		s.encode(ctx, w, http.StatusOK, todos)
+
+	case http.MethodPost:
+		t, err := s.decode(ctx, r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if t, err = s.repo.Create(ctx, t); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		s.encode(ctx, w, http.StatusCreated, t)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// decode and encode get spans of their own. They're usually quick, but a
+// big body or a slow client makes them the slow part, and without a span
+// that time would just be unexplained gap in the parent
+func (s *service) decode(ctx context.Context, body io.Reader) (todo.Todo, error) {
+	_, span := s.tracer.Start(ctx, "json.decode")
+	defer span.End()
+
+	t, err := jsonconcept.Decode[todo.Todo](body, jsonconcept.DisallowUnknownFields(), jsonconcept.MaxBytes(64<<10))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid body")
+	}
+	return t, err
+}
+
+func (s *service) encode(ctx context.Context, w http.ResponseWriter, status int, v any) {
+	_, span := s.tracer.Start(ctx, "json.encode")
+	defer span.End()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "encoding failed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	span.SetAttributes(attribute.Int("json.bytes", len(b)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+/*
+ *
+ * calling it
+ *
+ */
+
+// NewClient returns a client whose requests get a client span each, with
+// traceparent set so the server joins the same trace. The request's
+// context has to carry the current span - http.NewRequestWithContext,
+// never plain http.NewRequest, or the trace breaks here
+func NewClient(tp trace.TracerProvider) *http.Client {
+	return &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport,
+			otelhttp.WithTracerProvider(tp),
+			otelhttp.WithPropagators(propagator),
+		),
+	}
+}
+
+// NewGateway serves GET /summary by asking the todo service at todoURL
+// for the list - a second service, so a trace has a hop to cross
+func NewGateway(todoURL string, client *http.Client, tp trace.TracerProvider) http.Handler {
+	m := http.NewServeMux()
+	handle(m, "/summary", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		todos, err := fetchTodos(r.Context(), client, todoURL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		done := 0
+		for _, t := range todos {
+			if t.Completed {
+				done++
+			}
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int("todo.count", len(todos)))
+		fmt.Fprintf(w, "%d of %d done\n", done, len(todos))
+	}))
+	return otelhttp.NewHandler(m, "gateway",
+		otelhttp.WithTracerProvider(tp),
+		otelhttp.WithPropagators(propagator),
+	)
+}
+
+func fetchTodos(ctx context.Context, client *http.Client, baseURL string) ([]todo.Todo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/todos", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("todo service: %s", resp.Status)
+	}
+	var todos []todo.Todo
+	if err := json.NewDecoder(resp.Body).Decode(&todos); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/thorntonmc/go-practice/apps/todo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedRepository wraps a todo.TodoRepository with a span per call. It's
+// a decorator: it satisfies the same interface as what it wraps, so
+// neither the handlers nor the repository underneath know tracing is
+// happening
+type TracedRepository struct {
+	next   todo.TodoRepository
+	tracer trace.Tracer
+}
+
+func NewTracedRepository(next todo.TodoRepository, tp trace.TracerProvider) *TracedRepository {
+	return &TracedRepository{next: next, tracer: tp.Tracer(instrumentation)}
+}
+
+// start begins a client span - the repository is, from here, a remote
+// database - named after the method
+func (r *TracedRepository) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return r.tracer.Start(ctx, "TodoRepository."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, attribute.String("db.operation", method))...),
+	)
+}
+
+// end records err on the span. A missing todo is an answer, not a failure,
+// so it's noted but doesn't mark the span as errored
+func end(span trace.Span, err error) {
+	switch {
+	case errors.Is(err, todo.ErrNotFound):
+		span.SetAttributes(attribute.Bool("todo.found", false))
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (r *TracedRepository) List(ctx context.Context) ([]todo.Todo, error) {
+	ctx, span := r.start(ctx, "List")
+	todos, err := r.next.List(ctx)
+	span.SetAttributes(attribute.Int("todo.count", len(todos)))
+	end(span, err)
+	return todos, err
+}
+
+func (r *TracedRepository) Get(ctx context.Context, id int64) (todo.Todo, error) {
+	ctx, span := r.start(ctx, "Get", attribute.Int64("todo.id", id))
+	t, err := r.next.Get(ctx, id)
+	end(span, err)
+	return t, err
+}
+
+func (r *TracedRepository) Create(ctx context.Context, t todo.Todo) (todo.Todo, error) {
+	ctx, span := r.start(ctx, "Create")
+	t, err := r.next.Create(ctx, t)
+	span.SetAttributes(attribute.Int64("todo.id", t.ID))
+	end(span, err)
+	return t, err
+}
+
+func (r *TracedRepository) Update(ctx context.Context, t todo.Todo) error {
+	ctx, span := r.start(ctx, "Update", attribute.Int64("todo.id", t.ID))
+	err := r.next.Update(ctx, t)
+	end(span, err)
+	return err
+}
+
+func (r *TracedRepository) Delete(ctx context.Context, id int64) error {
+	ctx, span := r.start(ctx, "Delete", attribute.Int64("todo.id", id))
+	err := r.next.Delete(ctx, id)
+	end(span, err)
+	return err
+}
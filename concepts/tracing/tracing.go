@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// A trace follows one request through everything it touches. Each piece of
+// work is a span - a name, a start and end time, some attributes - and
+// spans point at their parent, so one request becomes a tree:
+//
+//	GET /summary                    gateway, server span
+//	└── HTTP GET                    gateway, client span
+//	    └── GET /todos              todo service, server span
+//	        ├── TodoRepository.List
+//	        └── json.encode
+//
+// Within a process the current span rides along in the context.Context,
+// so starting a span from a ctx makes it a child of whatever's in there.
+// Between processes it rides in a header, traceparent (see concepts/
+// tracecontext for the format): the client side writes it, the server
+// side reads it and carries on the same trace.
+//
+// OpenTelemetry splits this up:
+//
+//   - the API (go.opentelemetry.io/otel/trace) is what instrumented code
+//     calls - Tracer, Start, End. Libraries only ever depend on this, and
+//     with no SDK behind it every call is a no-op
+//   - the SDK's TracerProvider decides what's kept (the sampler) and
+//     where it goes (span processors and exporters). Only main sets it up
+//   - otelhttp instruments net/http from outside: a handler wrapper that
+//     starts a server span per request, and a RoundTripper that starts a
+//     client span and injects traceparent
+//
+// The provider is passed in explicitly everywhere here rather than set
+// with otel.SetTracerProvider, for the same reason as concepts/di: the
+// tests each get their own, recording to memory
+
+// propagator is W3C trace context: the traceparent and tracestate headers
+var propagator = propagation.TraceContext{}
+
+// NewProvider returns a TracerProvider for service. Pass how spans leave
+// it - sdktrace.WithBatcher(exporter) in a real service, so exporting
+// happens in the background in batches, or WithSyncer/WithSpanProcessor in
+// tests so spans are there to look at the moment they end. Callers must
+// Shutdown the provider, which flushes anything still batched
+func NewProvider(service string, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(service),
+		attribute.String("example", "go-practice"),
+	)
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		// follow the caller's decision if there is one, so a trace isn't
+		// half recorded. Sample everything otherwise, fine for an example;
+		// a busy service would use TraceIDRatioBased here
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	}, opts...)
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// Stdout is an exporter printing each span as indented JSON, the quickest
+// way to see what's being recorded without running a collector
+func Stdout(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w), stdouttrace.WithPrettyPrint())
+}
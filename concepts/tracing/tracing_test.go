@@ -0,0 +1,220 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/apps/todo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newRecorded returns a provider for service whose spans land in rec as
+// soon as they end
+func newRecorded(t *testing.T, service string, rec *tracetest.SpanRecorder) *sdktrace.TracerProvider {
+	tp := NewProvider(service, sdktrace.WithSpanProcessor(rec))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return tp
+}
+
+// tree draws the recorded spans as an indented tree, children in the order
+// they started, so a test can compare the whole shape at once
+func tree(spans []sdktrace.ReadOnlySpan) string {
+	children := map[trace.SpanID][]sdktrace.ReadOnlySpan{}
+	var roots []sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.Parent().IsValid() {
+			children[s.Parent().SpanID()] = append(children[s.Parent().SpanID()], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+
+	var b strings.Builder
+	var draw func(spans []sdktrace.ReadOnlySpan, depth int)
+	draw = func(spans []sdktrace.ReadOnlySpan, depth int) {
+		sort.Slice(spans, func(i, j int) bool { return spans[i].StartTime().Before(spans[j].StartTime()) })
+		for _, s := range spans {
+			b.WriteString(strings.Repeat("  ", depth) + s.Name() + "\n")
+			draw(children[s.SpanContext().SpanID()], depth+1)
+		}
+	}
+	draw(roots, 0)
+	return b.String()
+}
+
+func find(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name() == name {
+			return s
+		}
+	}
+	t.Fatalf("no span named %q", name)
+	return nil
+}
+
+func attr(s sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range s.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// resourceService is the service.name the span's provider was set up with
+func resourceService(s sdktrace.ReadOnlySpan) string {
+	v, _ := s.Resource().Set().Value("service.name")
+	return v.AsString()
+}
+
+func TestServerSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := newRecorded(t, "todo", rec)
+	srv := httptest.NewServer(NewHandler(todo.NewMemoryRepository(), tp))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Post(srv.URL+"/todos", "application/json", strings.NewReader(`{"title": "trace it"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	spans := rec.Ended()
+	assert.Equal(t, strings.Join([]string{
+		"POST /todos",
+		"  json.decode",
+		"  TodoRepository.Create",
+		"  json.encode",
+	}, "\n")+"\n", tree(spans))
+
+	server := find(t, spans, "POST /todos")
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, "/todos", attr(server, "http.route").AsString())
+	assert.Equal(t, int64(http.StatusCreated), attr(server, "http.status_code").AsInt64())
+
+	create := find(t, spans, "TodoRepository.Create")
+	assert.Equal(t, trace.SpanKindClient, create.SpanKind())
+	assert.Equal(t, int64(1), attr(create, "todo.id").AsInt64())
+	assert.Equal(t, "todo", resourceService(create))
+}
+
+// One request to the gateway, one trace across both services: the todo
+// service's spans hang off the gateway's client span, because the
+// traceparent header told it to
+func TestPropagation(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+
+	repo := todo.NewMemoryRepository()
+	repo.Create(context.Background(), todo.Todo{Title: "a", Completed: true})
+	repo.Create(context.Background(), todo.Todo{Title: "b"})
+	backend := httptest.NewServer(NewHandler(repo, newRecorded(t, "todo", rec)))
+	t.Cleanup(backend.Close)
+
+	gwTP := newRecorded(t, "gateway", rec)
+	gateway := httptest.NewServer(NewGateway(backend.URL, NewClient(gwTP), gwTP))
+	t.Cleanup(gateway.Close)
+
+	resp, err := http.Get(gateway.URL + "/summary")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "1 of 2 done\n", string(body))
+
+	spans := rec.Ended()
+	assert.Equal(t, strings.Join([]string{
+		"GET /summary",
+		"  HTTP GET",
+		"    GET /todos",
+		"      TodoRepository.List",
+		"      json.encode",
+	}, "\n")+"\n", tree(spans))
+
+	traceID := spans[0].SpanContext().TraceID()
+	for _, s := range spans {
+		assert.Equal(t, traceID, s.SpanContext().TraceID(), "%s is in a different trace", s.Name())
+	}
+	assert.Equal(t, "gateway", resourceService(find(t, spans, "HTTP GET")))
+	assert.Equal(t, "todo", resourceService(find(t, spans, "GET /todos")))
+	assert.True(t, find(t, spans, "GET /todos").Parent().IsRemote(), "its parent came over the wire")
+}
+
+// an incoming traceparent is joined rather than starting a new trace
+func TestJoinsCallersTrace(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	srv := httptest.NewServer(NewHandler(todo.NewMemoryRepository(), newRecorded(t, "todo", rec)))
+	t.Cleanup(srv.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/todos", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	server := find(t, rec.Ended(), "GET /todos")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+}
+
+type failingRepository struct{ todo.TodoRepository }
+
+var errDBDown = errors.New("database is down")
+
+func (failingRepository) List(context.Context) ([]todo.Todo, error) { return nil, errDBDown }
+
+func TestErrorsAreRecorded(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	srv := httptest.NewServer(NewHandler(failingRepository{}, newRecorded(t, "todo", rec)))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/todos")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spans := rec.Ended()
+	list := find(t, spans, "TodoRepository.List")
+	assert.Equal(t, codes.Error, list.Status().Code)
+	require.Len(t, list.Events(), 1)
+	assert.Equal(t, "exception", list.Events()[0].Name)
+
+	// otelhttp marks server spans as errors for 5xx
+	assert.Equal(t, codes.Error, find(t, spans, "GET /todos").Status().Code)
+}
+
+func TestNotFoundIsNotAnError(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	repo := NewTracedRepository(todo.NewMemoryRepository(), newRecorded(t, "todo", rec))
+
+	_, err := repo.Get(context.Background(), 42)
+	require.ErrorIs(t, err, todo.ErrNotFound)
+
+	get := find(t, rec.Ended(), "TodoRepository.Get")
+	assert.Equal(t, codes.Unset, get.Status().Code)
+	assert.False(t, attr(get, "todo.found").AsBool())
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var out bytes.Buffer
+	exp, err := Stdout(&out)
+	require.NoError(t, err)
+	tp := NewProvider("todo", sdktrace.WithSyncer(exp))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "hello")
+	span.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+
+	assert.Contains(t, out.String(), `"Name": "hello"`)
+	assert.Contains(t, out.String(), span.SpanContext().TraceID().String())
+}
@@ -0,0 +1,271 @@
+package versioning
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/thorntonmc/go-practice/apps/todo"
+	jsonconcept "github.com/thorntonmc/go-practice/concepts/json"
+	"github.com/thorntonmc/go-practice/pkg/router"
+)
+
+// Once an API has clients, changing the shape of a response breaks them.
+// Versioning lets the old shape and the new one be served side by side
+// while clients move over. There are two common ways for a client to say
+// which it wants:
+//
+//   - in the path: /v1/todos and /v2/todos. Obvious, easy to try with curl
+//     and to route, cache and log. But a URL is supposed to name a
+//     resource, and todo 7 is the same todo whichever way it's written down
+//   - in the Accept header: Accept: application/vnd.todo.v2+json on /todos.
+//     The URL stays the resource and the header picks a representation,
+//     which is what content negotiation is for (GitHub's API does this).
+//     Harder to poke at by hand, and caches must be told with Vary: Accept
+//     that the same URL can have two different responses
+//
+// Both handlers here serve the same TODO repository in the same two
+// versions - only how the version is chosen differs. A request that
+// doesn't say gets v1: a client written before versioning existed was
+// written against v1, and changing what it gets would break it.
+//
+// v1 responses carry a Deprecation header, so clients can find out before
+// v1 goes away rather than after
+
+// Version is a major version of the API
+type Version int
+
+const (
+	V1 Version = 1
+	V2 Version = 2
+
+	// Default is the version for a request that doesn't ask for one
+	Default = V1
+	// Latest is the newest version
+	Latest = V2
+)
+
+// mediaTypePrefix and mediaTypeSuffix make up a version's media type,
+// application/vnd.todo.v2+json
+const (
+	mediaTypePrefix = "application/vnd.todo.v"
+	mediaTypeSuffix = "+json"
+)
+
+// MediaType is the Accept and Content-Type value for v
+func (v Version) MediaType() string {
+	return mediaTypePrefix + strconv.Itoa(int(v)) + mediaTypeSuffix
+}
+
+func (v Version) supported() bool { return v >= V1 && v <= Latest }
+
+// PathHandler serves each version under its own prefix:
+//
+//	GET  /v1/todos, /v2/todos       list
+//	POST /v1/todos, /v2/todos       create
+//	GET  /v1/todos/{id}, /v2/...    fetch one
+//
+// An unknown version is just a path that doesn't exist, a 404
+func PathHandler(repo todo.TodoRepository, logger *log.Logger) http.Handler {
+	a := &api{repo: repo, log: logger}
+	r := router.New()
+	for _, v := range []Version{V1, V2} {
+		v := v
+		base := "/v" + strconv.Itoa(int(v)) + "/todos"
+		c := codecFor(v, base)
+		r.HandleFunc("GET "+base, func(w http.ResponseWriter, r *http.Request) { a.list(w, r, v, c) })
+		r.HandleFunc("POST "+base, func(w http.ResponseWriter, r *http.Request) { a.create(w, r, v, c, base) })
+		r.HandleFunc("GET "+base+"/{id}", func(w http.ResponseWriter, r *http.Request) { a.get(w, r, v, c) })
+	}
+	return r
+}
+
+// HeaderHandler serves both versions at the same paths, picking one from
+// the Accept header:
+//
+//	GET  /todos       list
+//	POST /todos       create
+//	GET  /todos/{id}  fetch one
+//
+// Asking only for versions that don't exist is a 406
+func HeaderHandler(repo todo.TodoRepository, logger *log.Logger) http.Handler {
+	a := &api{repo: repo, log: logger}
+	const base = "/todos"
+	codecs := map[Version]codec{V1: codecFor(V1, base), V2: codecFor(V2, base)}
+
+	// negotiated wraps a handler with content negotiation, passing it the
+	// version chosen
+	negotiated := func(h func(w http.ResponseWriter, r *http.Request, v Version, c codec)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// whatever the outcome, it depended on Accept
+			w.Header().Add("Vary", "Accept")
+			v, ok := Negotiate(r.Header.Get("Accept"))
+			if !ok {
+				writeJSON(w, http.StatusNotAcceptable, "application/json", map[string]string{
+					"error": fmt.Sprintf("supported versions are %s and %s", V1.MediaType(), V2.MediaType()),
+				})
+				return
+			}
+			h(w, r, v, codecs[v])
+		}
+	}
+
+	r := router.New()
+	r.Handle("GET "+base, negotiated(a.list))
+	r.Handle("POST "+base, negotiated(func(w http.ResponseWriter, r *http.Request, v Version, c codec) {
+		a.create(w, r, v, c, base)
+	}))
+	r.Handle("GET "+base+"/{id}", negotiated(a.get))
+	return r
+}
+
+func codecFor(v Version, base string) codec {
+	if v == V1 {
+		return v1{}
+	}
+	return v2{base: base}
+}
+
+// Negotiate picks a version from an Accept header. The media range with
+// the highest q that names a supported version wins, ties going to the
+// first. A generic JSON type or a wildcard means Default, and so does no
+// header at all. ok is false when nothing acceptable is on offer
+func Negotiate(accept string) (v Version, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return Default, true
+	}
+
+	best := -1.0
+	for _, r := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 || q <= best {
+			continue // q=0 means "not this one"
+		}
+
+		var candidate Version
+		switch mt {
+		case "application/json", "application/*", "*/*":
+			candidate = Default
+		default:
+			n, found := strings.CutPrefix(mt, mediaTypePrefix)
+			if !found || !strings.HasSuffix(n, mediaTypeSuffix) {
+				continue
+			}
+			i, err := strconv.Atoi(strings.TrimSuffix(n, mediaTypeSuffix))
+			if err != nil || !Version(i).supported() {
+				continue
+			}
+			candidate = Version(i)
+		}
+		v, best = candidate, q
+	}
+	return v, best > 0
+}
+
+/*
+ *
+ * handlers, shared by every version
+ *
+ */
+
+type api struct {
+	repo todo.TodoRepository
+	log  *log.Logger
+}
+
+func (a *api) list(w http.ResponseWriter, r *http.Request, v Version, c codec) {
+	todos, err := a.repo.List(r.Context())
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+	respond(w, http.StatusOK, v, c.list(todos))
+}
+
+func (a *api) get(w http.ResponseWriter, r *http.Request, v Version, c codec) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		a.writeError(w, r, todo.ErrNotFound)
+		return
+	}
+	t, err := a.repo.Get(r.Context(), id)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+	respond(w, http.StatusOK, v, c.todo(t))
+}
+
+func (a *api) create(w http.ResponseWriter, r *http.Request, v Version, c codec, base string) {
+	t, err := c.decodeNew(r.Body)
+	if err == nil {
+		err = t.Validate()
+	}
+	if err != nil {
+		a.writeError(w, r, badRequest(err))
+		return
+	}
+	if t, err = a.repo.Create(r.Context(), t); err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", base+"/"+strconv.FormatInt(t.ID, 10))
+	respond(w, http.StatusCreated, v, c.todo(t))
+}
+
+// respond writes body labelled with its version. Deprecation is the IETF
+// header for "this still works, but stop using it"
+func respond(w http.ResponseWriter, status int, v Version, body any) {
+	if v < Latest {
+		w.Header().Set("Deprecation", "true")
+	}
+	writeJSON(w, status, v.MediaType(), body)
+}
+
+// requestError marks an error as the client's fault, as in apps/todo
+type requestError struct{ err error }
+
+func (e requestError) Error() string { return e.err.Error() }
+func (e requestError) Unwrap() error { return e.err }
+
+func badRequest(err error) error { return requestError{err} }
+
+func writeJSON(w http.ResponseWriter, status int, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError is apps/todo's: errors are the same shape in every version,
+// which keeps a client's error handling working across an upgrade
+func (a *api) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		re requestError
+		de *jsonconcept.DecodeError
+	)
+	switch {
+	case errors.As(err, &de), errors.Is(err, jsonconcept.ErrTooLarge):
+		jsonconcept.WriteDecodeError(w, err)
+	case errors.Is(err, todo.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, "application/json", map[string]string{"error": err.Error()})
+	case errors.As(err, &re):
+		writeJSON(w, http.StatusBadRequest, "application/json", map[string]string{"error": err.Error()})
+	default:
+		a.log.Printf("versioning: %s %s: %v", r.Method, r.URL.Path, err)
+		writeJSON(w, http.StatusInternalServerError, "application/json", map[string]string{"error": http.StatusText(http.StatusInternalServerError)})
+	}
+}
@@ -0,0 +1,170 @@
+package versioning
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/apps/todo"
+)
+
+func seeded(t *testing.T) *todo.MemoryRepository {
+	t.Helper()
+	repo := todo.NewMemoryRepository()
+	for _, td := range []todo.Todo{{Title: "write tests", Completed: true}, {Title: "ship v2"}} {
+		_, err := repo.Create(context.Background(), td)
+		require.NoError(t, err)
+	}
+	return repo
+}
+
+func do(h http.Handler, method, path, accept, body string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// The wire formats are pinned byte for byte: a v1 client was written
+// against exactly these bytes, and a change that breaks this test breaks it
+
+const (
+	v1List = `[{"id":1,"title":"write tests","completed":true},{"id":2,"title":"ship v2","completed":false}]` + "\n"
+	v1One  = `{"id":2,"title":"ship v2","completed":false}` + "\n"
+
+	v2ListTemplate = `{"items":[` +
+		`{"id":"1","title":"write tests","status":"done","_links":{"self":"BASE/1"}},` +
+		`{"id":"2","title":"ship v2","status":"open","_links":{"self":"BASE/2"}}` +
+		`],"count":2}` + "\n"
+	v2OneTemplate = `{"id":"2","title":"ship v2","status":"open","_links":{"self":"BASE/2"}}` + "\n"
+)
+
+func v2Wire(template, base string) string { return strings.ReplaceAll(template, "BASE", base) }
+
+func TestPathVersioning(t *testing.T) {
+	h := PathHandler(seeded(t), log.New(io.Discard, "", 0))
+
+	rec := do(h, "GET", "/v1/todos", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, v1List, rec.Body.String())
+	assert.Equal(t, "application/vnd.todo.v1+json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+
+	rec = do(h, "GET", "/v2/todos", "", "")
+	assert.Equal(t, v2Wire(v2ListTemplate, "/v2/todos"), rec.Body.String())
+	assert.Equal(t, "application/vnd.todo.v2+json", rec.Header().Get("Content-Type"))
+	assert.Empty(t, rec.Header().Get("Deprecation"))
+
+	assert.Equal(t, v1One, do(h, "GET", "/v1/todos/2", "", "").Body.String())
+	assert.Equal(t, v2Wire(v2OneTemplate, "/v2/todos"), do(h, "GET", "/v2/todos/2", "", "").Body.String())
+
+	assert.Equal(t, http.StatusNotFound, do(h, "GET", "/v3/todos", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(h, "GET", "/todos", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(h, "GET", "/v2/todos/99", "", "").Code)
+}
+
+func TestHeaderVersioning(t *testing.T) {
+	h := HeaderHandler(seeded(t), log.New(io.Discard, "", 0))
+
+	for _, accept := range []string{"", "application/json", "*/*", "application/vnd.todo.v1+json"} {
+		rec := do(h, "GET", "/todos", accept, "")
+		assert.Equal(t, http.StatusOK, rec.Code, accept)
+		assert.Equal(t, v1List, rec.Body.String(), "Accept: %s gets v1", accept)
+		assert.Equal(t, "application/vnd.todo.v1+json", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+	}
+
+	rec := do(h, "GET", "/todos", "application/vnd.todo.v2+json", "")
+	assert.Equal(t, v2Wire(v2ListTemplate, "/todos"), rec.Body.String())
+	assert.Equal(t, "application/vnd.todo.v2+json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, v2Wire(v2OneTemplate, "/todos"), do(h, "GET", "/todos/2", "application/vnd.todo.v2+json", "").Body.String())
+
+	rec = do(h, "GET", "/todos", "application/vnd.todo.v3+json", "")
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+	assert.Contains(t, rec.Body.String(), "application/vnd.todo.v2+json")
+}
+
+func TestCreate(t *testing.T) {
+	logs := &bytes.Buffer{}
+	path := PathHandler(todo.NewMemoryRepository(), log.New(logs, "", 0))
+	header := HeaderHandler(todo.NewMemoryRepository(), log.New(logs, "", 0))
+
+	rec := do(path, "POST", "/v1/todos", "", `{"title":" one ","completed":true}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "/v1/todos/1", rec.Header().Get("Location"))
+	assert.Equal(t, `{"id":1,"title":"one","completed":true}`+"\n", rec.Body.String())
+
+	rec = do(path, "POST", "/v2/todos", "", `{"title":"two"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "/v2/todos/2", rec.Header().Get("Location"))
+	assert.Equal(t, `{"id":"2","title":"two","status":"open","_links":{"self":"/v2/todos/2"}}`+"\n", rec.Body.String())
+
+	rec = do(header, "POST", "/todos", "application/vnd.todo.v2+json", `{"title":"three","status":"done"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "/todos/1", rec.Header().Get("Location"))
+	assert.Equal(t, `{"id":"1","title":"three","status":"done","_links":{"self":"/todos/1"}}`+"\n", rec.Body.String())
+
+	// each version's request body is its own: v1's completed is unknown to
+	// v2, and v2's status to v1
+	for _, tc := range []struct {
+		h          http.Handler
+		path, body string
+		accept     string
+		want       string
+	}{
+		{path, "/v2/todos", `{"title":"x","completed":true}`, "", "completed"},
+		{path, "/v1/todos", `{"title":"x","status":"done"}`, "", "status"},
+		{path, "/v2/todos", `{"title":"x","status":"finished"}`, "", `status must be \"open\" or \"done\", got \"finished\"`},
+		{path, "/v1/todos", `{"title":"  "}`, "", "title is required"},
+		{header, "/todos", `{"title":"x","status":"done"}`, "", "status"},
+	} {
+		rec := do(tc.h, "POST", tc.path, tc.accept, tc.body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, tc.body)
+		assert.Contains(t, rec.Body.String(), tc.want, tc.body)
+	}
+	assert.Empty(t, logs.String(), "client errors aren't logged")
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   Version
+		ok     bool
+	}{
+		{"", V1, true},
+		{"application/json", V1, true},
+		{"text/html, */*;q=0.1", V1, true},
+		{"application/vnd.todo.v2+json", V2, true},
+		{"application/vnd.todo.v1+json;q=0.5, application/vnd.todo.v2+json", V2, true},
+		{"application/vnd.todo.v2+json;q=0.5, application/vnd.todo.v1+json", V1, true},
+		{"application/vnd.todo.v2+json, application/vnd.todo.v1+json", V2, true},
+		{"application/vnd.todo.v9+json, application/vnd.todo.v2+json;q=0.1", V2, true},
+		{"application/vnd.todo.v2+json;q=0", 0, false},
+		{"application/vnd.todo.v3+json", 0, false},
+		{"application/vnd.todo.vtwo+json", 0, false},
+		{"text/html", 0, false},
+		{"application/vnd.todo.v2+json;q=high", 0, false},
+	} {
+		v, ok := Negotiate(tc.accept)
+		assert.Equal(t, tc.ok, ok, tc.accept)
+		if tc.ok {
+			assert.Equal(t, tc.want, v, tc.accept)
+		}
+	}
+}
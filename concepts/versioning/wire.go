@@ -0,0 +1,155 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/thorntonmc/go-practice/apps/todo"
+	jsonconcept "github.com/thorntonmc/go-practice/concepts/json"
+)
+
+// Each version has its own wire types, and todo.Todo - the domain type -
+// has none of its own opinions about JSON anymore. The handlers work on
+// todo.Todo and only convert at the edge, so adding v3 is new types and a
+// codec, not another if in every handler.
+//
+// What changed between the two, and the struct tags that do it:
+//
+//   - the id is a string in v2 (`json:"id,string"`). JavaScript numbers
+//     lose precision past 2^53, and an int64 id will get there eventually
+//   - completed bool became status "open" or "done", which has room for
+//     "archived" later without another breaking change
+//   - every todo carries a link to itself, under _links
+//   - the list is an object, {"items": [...], "count": n}, rather than a
+//     bare array - there's nowhere to add paging to an array
+//
+// Adding a field is not a breaking change, as long as clients ignore ones
+// they don't know - which encoding/json does by default. Renaming,
+// removing, or changing a type is, and that's what a new version is for
+
+// maxBodyBytes caps request bodies, as in apps/todo
+const maxBodyBytes = 64 << 10
+
+// codec converts between todo.Todo and one version's wire format
+type codec interface {
+	todo(t todo.Todo) any
+	list(ts []todo.Todo) any
+	decodeNew(r io.Reader) (todo.Todo, error)
+}
+
+/*
+ *
+ * v1
+ *
+ */
+
+type todoV1 struct {
+	ID        int64  `json:"id"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+}
+
+type newTodoV1 struct {
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+}
+
+type v1 struct{}
+
+func (v1) todo(t todo.Todo) any {
+	return todoV1{ID: t.ID, Title: t.Title, Completed: t.Completed}
+}
+
+func (c v1) list(ts []todo.Todo) any {
+	out := make([]any, len(ts)) // [] rather than null when empty
+	for i, t := range ts {
+		out[i] = c.todo(t)
+	}
+	return out
+}
+
+func (v1) decodeNew(r io.Reader) (todo.Todo, error) {
+	n, err := jsonconcept.Decode[newTodoV1](r, jsonconcept.DisallowUnknownFields(), jsonconcept.MaxBytes(maxBodyBytes))
+	return todo.Todo{Title: n.Title, Completed: n.Completed}, err
+}
+
+/*
+ *
+ * v2
+ *
+ */
+
+const (
+	statusOpen = "open"
+	statusDone = "done"
+)
+
+type todoV2 struct {
+	ID     int64   `json:"id,string"`
+	Title  string  `json:"title"`
+	Status string  `json:"status"`
+	Links  linksV2 `json:"_links"`
+}
+
+type linksV2 struct {
+	Self string `json:"self"`
+}
+
+type listV2 struct {
+	Items []todoV2 `json:"items"`
+	Count int      `json:"count"`
+}
+
+// newTodoV2's status is optional, a new todo is open
+type newTodoV2 struct {
+	Title  string `json:"title"`
+	Status string `json:"status,omitempty"`
+}
+
+// errBadStatus is a client error, see writeError
+var errBadStatus = errors.New(`status must be "open" or "done"`)
+
+// v2's base is the collection's path, for the self links - it differs
+// between path and header versioning
+type v2 struct{ base string }
+
+func (c v2) todo(t todo.Todo) any { return c.toV2(t) }
+
+func (c v2) toV2(t todo.Todo) todoV2 {
+	status := statusOpen
+	if t.Completed {
+		status = statusDone
+	}
+	return todoV2{
+		ID:     t.ID,
+		Title:  t.Title,
+		Status: status,
+		Links:  linksV2{Self: c.base + "/" + strconv.FormatInt(t.ID, 10)},
+	}
+}
+
+func (c v2) list(ts []todo.Todo) any {
+	l := listV2{Items: make([]todoV2, len(ts)), Count: len(ts)}
+	for i, t := range ts {
+		l.Items[i] = c.toV2(t)
+	}
+	return l
+}
+
+func (v2) decodeNew(r io.Reader) (todo.Todo, error) {
+	n, err := jsonconcept.Decode[newTodoV2](r, jsonconcept.DisallowUnknownFields(), jsonconcept.MaxBytes(maxBodyBytes))
+	if err != nil {
+		return todo.Todo{}, err
+	}
+	t := todo.Todo{Title: n.Title}
+	switch n.Status {
+	case "", statusOpen:
+	case statusDone:
+		t.Completed = true
+	default:
+		return t, fmt.Errorf("%w, got %q", errBadStatus, n.Status)
+	}
+	return t, nil
+}
@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/retry"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// Event is what gets delivered. ID is unique per event and stays the same
+// across retries, which is what lets the receiver drop duplicates
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Endpoint is a subscriber: where to send, and the secret to sign with
+type Endpoint struct {
+	URL    string
+	Secret []byte
+}
+
+// Attempt is one try at delivering an event, for the delivery log. Status
+// is 0 when no response came back
+type Attempt struct {
+	EventID  string
+	URL      string
+	Attempt  int
+	At       time.Time
+	Duration time.Duration
+	Status   int
+	Err      string
+}
+
+// Log stores delivery attempts, so "did they get it?" has an answer
+type Log interface {
+	Record(a Attempt)
+}
+
+// MemoryLog is a Log in a slice
+type MemoryLog struct {
+	mu       sync.Mutex
+	attempts []Attempt
+}
+
+func (l *MemoryLog) Record(a Attempt) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.attempts = append(l.attempts, a)
+}
+
+// For returns the attempts made for an event, oldest first
+func (l *MemoryLog) For(eventID string) []Attempt {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var out []Attempt
+	for _, a := range l.attempts {
+		if a.EventID == eventID {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Dispatcher delivers events to endpoints, retrying failures under a
+// retry.Policy
+type Dispatcher struct {
+	client *http.Client
+	policy retry.Policy
+	log    Log
+	clock  clock.Clock
+}
+
+// NewDispatcher returns a dispatcher. The client should have a timeout -
+// a receiver that never answers shouldn't hold a delivery forever. The
+// policy's own clock drives the waits between attempts
+func NewDispatcher(client *http.Client, policy retry.Policy, log Log, clk clock.Clock) *Dispatcher {
+	return &Dispatcher{client: client, policy: policy, log: log, clock: clk}
+}
+
+// statusError is a non-2xx response
+type statusError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string             { return "webhook: receiver answered " + strconv.Itoa(e.status) }
+func (e *statusError) RetryAfter() time.Duration { return e.retryAfter }
+
+// Deliver sends ev to ep until it's accepted with a 2xx, the policy gives
+// up, or ctx is done. Each attempt is signed afresh, so a retry an hour
+// later still passes the receiver's timestamp check.
+//
+// 4xx answers mean the receiver rejected the request itself - retrying the
+// same bytes won't help - so they're permanent, except 408 and 429. A 429
+// or 503 with Retry-After sets the next wait, up to the policy's
+// MaxRetryAfter
+func (d *Dispatcher) Deliver(ctx context.Context, ep Endpoint, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	attempt := 0
+	return retry.Retry(ctx, d.policy, func() error {
+		attempt++
+		return d.attempt(ctx, ep, ev.ID, body, attempt)
+	})
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, ep Endpoint, id string, body []byte, n int) error {
+	start := d.clock.Now()
+	a := Attempt{EventID: id, URL: ep.URL, Attempt: n, At: start}
+	defer func() { d.log.Record(a) }()
+
+	var err error
+	a.Status, err = d.post(ctx, ep, id, body, start)
+	a.Duration = d.clock.Now().Sub(start)
+	if err != nil {
+		a.Err = err.Error()
+	}
+	return err
+}
+
+// post makes one request, returning the status (0 without a response) and
+// an error classified for the retry policy
+func (d *Dispatcher) post(ctx context.Context, ep Endpoint, id string, body []byte, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, retry.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Webhook-Id", id)
+	req.Header.Set(SignatureHeader, Sign(ep.Secret, now, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain a little so the connection can be reused, but don't read a
+	// huge body nobody asked for
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+
+	serr := &statusError{status: resp.StatusCode}
+	if s, err := strconv.ParseInt(resp.Header.Get("Retry-After"), 10, 64); err == nil && s > 0 {
+		// the policy caps the wait at its MaxRetryAfter, however long the
+		// receiver asks for. Past what a Duration holds is capped here
+		// first, so it can't wrap around negative
+		serr.retryAfter = time.Duration(min(s, math.MaxInt64/int64(time.Second))) * time.Second
+	}
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return resp.StatusCode, serr
+	case resp.StatusCode < 500:
+		return resp.StatusCode, retry.Permanent(serr)
+	}
+	return resp.StatusCode, serr
+}
+
+// IsRejected reports whether err is the receiver refusing the event with a
+// 4xx, as opposed to being unreachable or failing
+func IsRejected(err error) bool {
+	var serr *statusError
+	return errors.As(err, &serr) && serr.status >= 400 && serr.status < 500
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/concepts/retry"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// stepClock skips every wait straight away and remembers it, so retries
+// run without sleeping and the test can check the backoff
+type stepClock struct {
+	waits []time.Duration
+}
+
+func (c *stepClock) Now() time.Time { return now }
+
+func (c *stepClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	ch <- now
+	return ch
+}
+
+// flaky answers with each status in turn, then 204 forever
+func flaky(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(statuses) {
+			if statuses[n-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "30")
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newTestDispatcher(srv *httptest.Server) (*Dispatcher, *MemoryLog, *stepClock) {
+	log := &MemoryLog{}
+	waits := &stepClock{}
+	policy := retry.Policy{MaxAttempts: 4, Initial: time.Second, Clock: waits}
+	return NewDispatcher(srv.Client(), policy, log, clock.NewFake(now)), log, waits
+}
+
+var event = Event{ID: "evt_1", Type: "todo.completed", Time: now, Data: []byte(`{"id":1}`)}
+
+func statuses(attempts []Attempt) []int {
+	var out []int
+	for _, a := range attempts {
+		out = append(out, a.Status)
+	}
+	return out
+}
+
+func TestDeliverRetries(t *testing.T) {
+	srv, calls := flaky(t, 500, 502)
+	d, log, waits := newTestDispatcher(srv)
+
+	require.NoError(t, d.Deliver(context.Background(), Endpoint{URL: srv.URL, Secret: secret}, event))
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, []int{500, 502, 204}, statuses(log.For("evt_1")))
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, waits.waits)
+}
+
+func TestDeliverRetryAfter(t *testing.T) {
+	srv, _ := flaky(t, 429)
+	d, _, waits := newTestDispatcher(srv)
+
+	require.NoError(t, d.Deliver(context.Background(), Endpoint{URL: srv.URL, Secret: secret}, event))
+	assert.Equal(t, []time.Duration{30 * time.Second}, waits.waits)
+}
+
+func TestDeliverRetryAfterIsCapped(t *testing.T) {
+	for _, retryAfter := range []string{"86400", "99999999999999999"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+		d, _, waits := newTestDispatcher(srv)
+		d.policy.MaxRetryAfter = 5 * time.Minute
+		d.policy.MaxElapsed = -1
+
+		err := d.Deliver(context.Background(), Endpoint{URL: srv.URL, Secret: secret}, event)
+		assert.ErrorContains(t, err, "gave up after 4 attempts", retryAfter)
+		assert.Equal(t, []time.Duration{5 * time.Minute, 5 * time.Minute, 5 * time.Minute}, waits.waits, retryAfter)
+	}
+}
+
+func TestDeliverRejected(t *testing.T) {
+	srv, calls := flaky(t, 401)
+	d, log, _ := newTestDispatcher(srv)
+
+	err := d.Deliver(context.Background(), Endpoint{URL: srv.URL, Secret: secret}, event)
+	assert.True(t, IsRejected(err))
+	assert.Equal(t, int32(1), calls.Load(), "a 4xx isn't retried")
+	assert.Equal(t, []int{401}, statuses(log.For("evt_1")))
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	srv, _ := flaky(t, 500, 500, 500, 500, 500)
+	d, log, _ := newTestDispatcher(srv)
+
+	err := d.Deliver(context.Background(), Endpoint{URL: srv.URL, Secret: secret}, event)
+	assert.ErrorContains(t, err, "gave up after 4 attempts")
+	assert.Len(t, log.For("evt_1"), 4)
+}
+
+func TestDeliverUnreachable(t *testing.T) {
+	srv, _ := flaky(t)
+	srv.Close()
+	d, log, _ := newTestDispatcher(srv)
+
+	err := d.Deliver(context.Background(), Endpoint{URL: srv.URL, Secret: secret}, event)
+	assert.Error(t, err)
+	assert.False(t, IsRejected(err))
+
+	attempts := log.For("evt_1")
+	require.Len(t, attempts, 4)
+	assert.Zero(t, attempts[0].Status)
+	assert.NotEmpty(t, attempts[0].Err)
+}
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/thorntonmc/go-practice/concepts/lru"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// Receiver is the other end: an http.Handler that verifies signatures,
+// drops duplicates and hands each event to a function once.
+//
+// Delivery is at-least-once - the sender can't tell a lost request from a
+// lost response, so it retries both - and the event ID is how the receiver
+// notices. Seen IDs are kept in an LRU with a TTL, long enough to cover
+// the sender's retries, small enough to bound memory. A receiver with more
+// than one instance would keep them somewhere shared instead, a database
+// unique constraint or Redis SET NX
+type Receiver struct {
+	secret    []byte
+	handle    func(ctx context.Context, ev Event) error
+	clock     clock.Clock
+	seen      *lru.Cache[string, struct{}]
+	Tolerance time.Duration // how old a signature may be, 5 minutes by default
+	MaxBytes  int64         // largest body accepted, 1MB by default
+}
+
+// NewReceiver returns a receiver calling handle for each new event. IDs are
+// remembered for window, up to capacity of them
+func NewReceiver(secret []byte, handle func(ctx context.Context, ev Event) error, window time.Duration, capacity int, clk clock.Clock) *Receiver {
+	return &Receiver{
+		secret:    secret,
+		handle:    handle,
+		clock:     clk,
+		seen:      lru.NewWithTTL[string, struct{}](capacity, window, clk),
+		Tolerance: 5 * time.Minute,
+		MaxBytes:  1 << 20,
+	}
+}
+
+// ServeHTTP answers 2xx for anything the sender shouldn't send again -
+// including duplicates - and 5xx when handling failed and a retry might
+// work. A bad signature is a 401, and the sender won't retry it
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the signature covers the exact bytes, so read them before decoding
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, rc.MaxBytes))
+	if err != nil {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := Verify(rc.secret, r.Header.Get(SignatureHeader), body, rc.clock.Now(), rc.Tolerance); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var ev Event
+	if err := json.Unmarshal(body, &ev); err != nil || ev.ID == "" {
+		http.Error(w, "bad event", http.StatusBadRequest)
+		return
+	}
+
+	if _, dup := rc.seen.Get(ev.ID); dup {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// only marked seen once handled: a failure gets another go on retry.
+	// Two copies arriving at once can both get here, so handle should
+	// still be idempotent - this just makes duplicates rare
+	if err := rc.handle(r.Context(), ev); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, "handling failed", status)
+		return
+	}
+	rc.seen.Put(ev.ID, struct{}{})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// handled counts how often each event reached the receiver's handler
+type handled struct {
+	mu   sync.Mutex
+	byID map[string]int
+	err  error // returned once, then cleared
+}
+
+func (h *handled) handle(ctx context.Context, ev Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.err; err != nil {
+		h.err = nil
+		return err
+	}
+	h.byID[ev.ID]++
+	return nil
+}
+
+func newTestReceiver() (*Receiver, *handled) {
+	h := &handled{byID: map[string]int{}}
+	return NewReceiver(secret, h.handle, 24*time.Hour, 1000, clock.NewFake(now)), h
+}
+
+func TestReceiverDeduplicates(t *testing.T) {
+	rc, h := newTestReceiver()
+
+	// the receiver handles the event but the sender never hears back, as
+	// if the response was lost on the way - so it sends it again
+	var lost atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		rc.ServeHTTP(rec, r)
+		if lost.CompareAndSwap(false, true) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(rec.Code)
+	}))
+	defer srv.Close()
+
+	d, log, _ := newTestDispatcher(srv)
+	require.NoError(t, d.Deliver(context.Background(), Endpoint{URL: srv.URL, Secret: secret}, event))
+
+	assert.Equal(t, []int{502, 200}, statuses(log.For("evt_1")), "the retry is acknowledged as a duplicate")
+	assert.Equal(t, map[string]int{"evt_1": 1}, h.byID)
+}
+
+func TestReceiverHandlerFails(t *testing.T) {
+	rc, h := newTestReceiver()
+	h.err = errors.New("db down")
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d, log, _ := newTestDispatcher(srv)
+	require.NoError(t, d.Deliver(context.Background(), Endpoint{URL: srv.URL, Secret: secret}, event))
+
+	assert.Equal(t, []int{500, 204}, statuses(log.For("evt_1")), "not marked seen until handled")
+	assert.Equal(t, 1, h.byID["evt_1"])
+}
+
+func TestReceiverRejects(t *testing.T) {
+	rc, h := newTestReceiver()
+	body := `{"id":"evt_1","type":"x"}`
+
+	post := func(header, body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+		if header != "" {
+			r.Header.Set(SignatureHeader, header)
+		}
+		w := httptest.NewRecorder()
+		rc.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("", body))
+	assert.Equal(t, http.StatusUnauthorized, post(Sign([]byte("wrong"), now, []byte(body)), body))
+	assert.Equal(t, http.StatusUnauthorized, post(Sign(secret, now.Add(-time.Hour), []byte(body)), body), "replay")
+	assert.Equal(t, http.StatusBadRequest, post(Sign(secret, now, []byte("{}")), "{}"), "no id")
+	assert.Equal(t, http.StatusNoContent, post(Sign(secret, now, []byte(body)), body))
+	assert.Equal(t, map[string]int{"evt_1": 1}, h.byID, "only the good one got through")
+
+	w := httptest.NewRecorder()
+	rc.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hook", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
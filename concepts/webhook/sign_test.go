@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	secret = []byte("whsec_test")
+	now    = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	header := Sign(secret, now, body)
+	assert.True(t, strings.HasPrefix(header, "t=1714564800,v1="))
+
+	tests := []struct {
+		name   string
+		secret []byte
+		header string
+		body   string
+		now    time.Time
+		want   error
+	}{
+		{"valid", secret, header, string(body), now, nil},
+		{"a little later", secret, header, string(body), now.Add(4 * time.Minute), nil},
+		{"tampered body", secret, header, `{"id":"evt_2"}`, now, ErrBadSignature},
+		{"wrong secret", []byte("other"), header, string(body), now, ErrBadSignature},
+		{"replayed later", secret, header, string(body), now.Add(time.Hour), ErrStale},
+		{"from the future", secret, header, string(body), now.Add(-time.Hour), ErrStale},
+		{"no signature", secret, "t=1714564800", string(body), now, ErrMalformedSignature},
+		{"no timestamp", secret, "v1=abcd", string(body), now, ErrMalformedSignature},
+		{"not hex", secret, "t=1714564800,v1=zz", string(body), now, ErrMalformedSignature},
+		{"empty", secret, "", string(body), now, ErrMalformedSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, []byte(tt.body), tt.now, 5*time.Minute)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestVerifyDuringRotation(t *testing.T) {
+	body := []byte("{}")
+	old := Sign([]byte("old"), now, body)
+	current := Sign([]byte("new"), now, body)
+	_, newSig, _ := strings.Cut(current, ",")
+
+	// the sender signs with both while receivers move to the new secret
+	header := old + "," + newSig
+	assert.NoError(t, Verify([]byte("old"), header, body, now, time.Minute))
+	assert.NoError(t, Verify([]byte("new"), header, body, now, time.Minute))
+}
@@ -0,0 +1,157 @@
+package yaml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// gopkg.in/yaml.v3 works like encoding/json: struct tags pick the keys, and
+// Marshal/Unmarshal or an Encoder/Decoder do the work. YAML has a few things
+// JSON doesn't though - anchors, several documents in one stream, comments -
+// and its "be helpful" defaults can surprise: a typo'd key is silently
+// ignored, and in YAML 1.1 parsers `no` meant false (v3 only treats
+// true/false as booleans, thankfully)
+
+type service struct {
+	Name     string        `yaml:"name"`
+	Image    string        `yaml:"image"`
+	Replicas int           `yaml:"replicas"`
+	Timeout  time.Duration `yaml:"timeout"` // "5s" works, yaml.v3 parses durations
+	Env      []string      `yaml:"env,omitempty"`
+	Ports    []int         `yaml:"ports,flow,omitempty"` // flow writes [80, 443]
+}
+
+/*
+ *
+ * anchors and aliases
+ *
+ */
+
+// &name marks a node, *name refers back to it, and the << merge key copies a
+// map's keys into another map, where later keys override. It's YAML's way of
+// not repeating yourself:
+const anchorsYAML = `
+defaults: &defaults
+  image: app:latest
+  replicas: 2
+  timeout: 5s
+
+services:
+  - <<: *defaults
+    name: web
+    ports: [80, 443]
+  - <<: *defaults
+    name: worker
+    replicas: 5
+`
+
+func decodeServices(data []byte) ([]service, error) {
+	var doc struct {
+		Services []service `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Services, nil
+}
+
+/*
+ *
+ * multiple documents
+ *
+ */
+
+// A single stream can hold several documents separated by ---, which is how
+// Kubernetes manifests are usually shipped. yaml.Unmarshal only reads the
+// first, a Decoder reads them in a loop until io.EOF
+func decodeAll(r io.Reader) ([]service, error) {
+	d := yaml.NewDecoder(r)
+
+	var out []service
+	for {
+		var s service
+		err := d.Decode(&s)
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, s)
+	}
+}
+
+// encodeAll writes each service as its own document
+func encodeAll(services []service) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	for _, s := range services {
+		if err := enc.Encode(s); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+ *
+ * strict mode
+ *
+ */
+
+// By default unknown keys are dropped, so `replica: 3` (no s) decodes without
+// complaint and leaves Replicas at 0. KnownFields(true) makes it an error -
+// always worth turning on for config files
+func decodeStrict(data []byte) (service, error) {
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+
+	var s service
+	err := d.Decode(&s)
+	return s, err
+}
+
+/*
+ *
+ * nodes
+ *
+ */
+
+// Decoding into a struct loses comments and key order. Decoding into a
+// yaml.Node keeps the whole tree, so a tool can change one value and write
+// the file back with everything else intact
+func setReplicas(data []byte, replicas int) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("yaml: expected a mapping")
+	}
+
+	m := root.Content[0]
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == "replicas" {
+			if err := m.Content[i+1].Encode(replicas); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
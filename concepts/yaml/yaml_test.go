@@ -0,0 +1,80 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	in := service{Name: "web", Image: "app:1", Replicas: 3, Timeout: 1500 * time.Millisecond, Ports: []int{80, 443}}
+
+	b, err := yaml.Marshal(in)
+	require.NoError(t, err)
+	assert.Equal(t, "name: web\nimage: app:1\nreplicas: 3\ntimeout: 1.5s\nports: [80, 443]\n", string(b))
+
+	var out service
+	require.NoError(t, yaml.Unmarshal(b, &out))
+	assert.Equal(t, in, out)
+}
+
+func TestAnchors(t *testing.T) {
+	services, err := decodeServices([]byte(anchorsYAML))
+	require.NoError(t, err)
+
+	assert.Equal(t, []service{
+		{Name: "web", Image: "app:latest", Replicas: 2, Timeout: 5 * time.Second, Ports: []int{80, 443}},
+		{Name: "worker", Image: "app:latest", Replicas: 5, Timeout: 5 * time.Second},
+	}, services)
+}
+
+func TestMultiDocument(t *testing.T) {
+	in := []service{{Name: "a", Replicas: 1}, {Name: "b", Replicas: 2}, {Name: "c", Replicas: 3}}
+
+	b, err := encodeAll(in)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(b), "---"))
+
+	out, err := decodeAll(strings.NewReader(string(b)))
+	require.NoError(t, err)
+	assert.Equal(t, in, out)
+
+	// the documents before a broken one still come back
+	out, err = decodeAll(strings.NewReader("name: a\n---\nname: [\n"))
+	assert.Error(t, err)
+	assert.Len(t, out, 1)
+}
+
+func TestStrict(t *testing.T) {
+	typo := []byte("name: web\nreplica: 3\n")
+
+	var lax service
+	require.NoError(t, yaml.Unmarshal(typo, &lax))
+	assert.Equal(t, 0, lax.Replicas, "the typo is silently dropped")
+
+	_, err := decodeStrict(typo)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field replica not found")
+
+	s, err := decodeStrict([]byte("name: web\nreplicas: 3\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.Replicas)
+
+	_, err = decodeStrict([]byte("replicas: lots\n"))
+	assert.Error(t, err)
+}
+
+func TestSetReplicasKeepsComments(t *testing.T) {
+	in := "# the web tier\nname: web # public facing\nreplicas: 2\nimage: app:1\n"
+
+	out, err := setReplicas([]byte(in), 6)
+	require.NoError(t, err)
+	assert.Equal(t, "# the web tier\nname: web # public facing\nreplicas: 6\nimage: app:1\n", string(out))
+
+	_, err = setReplicas([]byte("- a\n- b\n"), 1)
+	assert.Error(t, err)
+}
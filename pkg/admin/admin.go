@@ -0,0 +1,178 @@
+// Package admin serves a process's vital signs as JSON: uptime, goroutines,
+// memory, what it was built from, and whatever counters the app publishes.
+// It's meant for a port of its own that only operators can reach, see
+// server.Admin - build info and memory figures are no business of the
+// public internet's
+package admin
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// Stats is the JSON served. Every field is always there, so a dashboard can
+// rely on the shape; Build is null only when the binary has no build info
+type Stats struct {
+	App        string                     `json:"app"`
+	StartedAt  time.Time                  `json:"started_at"`
+	Uptime     float64                    `json:"uptime_seconds"`
+	Goroutines int                        `json:"goroutines"`
+	GOMAXPROCS int                        `json:"gomaxprocs"`
+	Memory     Memory                     `json:"memstats"`
+	Build      *Build                     `json:"build"`
+	Counters   map[string]json.RawMessage `json:"counters"`
+}
+
+// Memory is the part of runtime.MemStats worth watching, in bytes
+type Memory struct {
+	Alloc        uint64    `json:"alloc"`       // live heap objects
+	TotalAlloc   uint64    `json:"total_alloc"` // ever allocated, only goes up
+	Sys          uint64    `json:"sys"`         // from the OS, all told
+	HeapInuse    uint64    `json:"heap_inuse"`
+	HeapObjects  uint64    `json:"heap_objects"`
+	NumGC        uint32    `json:"num_gc"`
+	PauseTotalNs uint64    `json:"pause_total_ns"`
+	LastGC       time.Time `json:"last_gc"`
+}
+
+// Build is what debug.ReadBuildInfo says about the binary: the module it
+// was built from, and settings like vcs.revision when built from a checkout
+type Build struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Main      Module            `json:"main"`
+	Deps      []Module          `json:"deps"`
+	Settings  map[string]string `json:"settings"`
+}
+
+// Module is one module in the build
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+}
+
+// Handler serves Stats. Its zero value isn't usable, see New
+type Handler struct {
+	app      string
+	clk      clock.Clock
+	start    time.Time
+	build    *Build
+	counters map[string]expvar.Var
+}
+
+type Option func(*Handler)
+
+// WithClock sets the clock uptime is measured with. The default is the
+// real one
+func WithClock(clk clock.Clock) Option {
+	return func(h *Handler) { h.clk = clk }
+}
+
+// WithCounter publishes v under counters, as name. Anything from the expvar
+// package will do: an *expvar.Int the app increments, an *expvar.Map of
+// them, or an expvar.Func that works the value out when asked. The Var
+// needn't be registered with expvar.Publish, so an app can have both
+// without them clashing
+func WithCounter(name string, v expvar.Var) Option {
+	return func(h *Handler) { h.counters[name] = v }
+}
+
+// New returns a Handler for the app called app. Uptime counts from here,
+// so call it at startup
+func New(app string, opts ...Option) *Handler {
+	h := &Handler{app: app, clk: clock.New(), counters: map[string]expvar.Var{}}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.start = h.clk.Now()
+	// the build can't change while the process runs, so it's read once
+	if info, ok := debug.ReadBuildInfo(); ok {
+		h.build = buildFrom(info)
+	}
+	return h
+}
+
+func buildFrom(info *debug.BuildInfo) *Build {
+	b := &Build{
+		GoVersion: info.GoVersion,
+		Path:      info.Path,
+		Main:      Module{Path: info.Main.Path, Version: info.Main.Version, Sum: info.Main.Sum},
+		Deps:      []Module{},
+		Settings:  map[string]string{},
+	}
+	for _, d := range info.Deps {
+		// a replaced module's code comes from the replacement
+		if d.Replace != nil {
+			d = d.Replace
+		}
+		b.Deps = append(b.Deps, Module{Path: d.Path, Version: d.Version, Sum: d.Sum})
+	}
+	sort.Slice(b.Deps, func(i, j int) bool { return b.Deps[i].Path < b.Deps[j].Path })
+	for _, s := range info.Settings {
+		b.Settings[s.Key] = s.Value
+	}
+	return b
+}
+
+// Stats reads them now. runtime.ReadMemStats stops the world for a moment,
+// which is nothing at the rate anyone polls an admin endpoint, but is why
+// this isn't something to call per request
+func (h *Handler) Stats() Stats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	s := Stats{
+		App:        h.app,
+		StartedAt:  h.start,
+		Uptime:     h.clk.Now().Sub(h.start).Seconds(),
+		Goroutines: runtime.NumGoroutine(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Memory: Memory{
+			Alloc:        ms.Alloc,
+			TotalAlloc:   ms.TotalAlloc,
+			Sys:          ms.Sys,
+			HeapInuse:    ms.HeapInuse,
+			HeapObjects:  ms.HeapObjects,
+			NumGC:        ms.NumGC,
+			PauseTotalNs: ms.PauseTotalNs,
+		},
+		Build:    h.build,
+		Counters: make(map[string]json.RawMessage, len(h.counters)),
+	}
+	if ms.LastGC > 0 {
+		s.Memory.LastGC = time.Unix(0, int64(ms.LastGC)).UTC()
+	}
+	// a Var's String is its value as JSON, so it goes in as it is
+	for name, v := range h.counters {
+		s.Counters[name] = json.RawMessage(v.String())
+	}
+	return s
+}
+
+// ServeHTTP answers GET with the stats
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// marshalled before anything is written, so a Var with broken JSON is
+	// a 500 rather than half a response
+	body, err := json.MarshalIndent(h.Stats(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(append(body, '\n'))
+}
@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+var started = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func get(t *testing.T, h http.Handler) map[string]any {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/stats", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return body
+}
+
+func keys(m map[string]any) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+func TestSchema(t *testing.T) {
+	clk := clock.NewFake(started)
+	requests := new(expvar.Int)
+	requests.Add(3)
+	h := New("files",
+		WithClock(clk),
+		WithCounter("requests", requests),
+		WithCounter("used_bytes", expvar.Func(func() any { return 1024 })),
+	)
+	clk.Advance(90 * time.Second)
+
+	body := get(t, h)
+	assert.ElementsMatch(t, []string{
+		"app", "started_at", "uptime_seconds", "goroutines", "gomaxprocs", "memstats", "build", "counters",
+	}, keys(body))
+
+	assert.Equal(t, "files", body["app"])
+	assert.Equal(t, "2024-05-01T12:00:00Z", body["started_at"])
+	assert.Equal(t, 90.0, body["uptime_seconds"])
+	assert.GreaterOrEqual(t, body["goroutines"], 1.0)
+	assert.Equal(t, float64(runtime.GOMAXPROCS(0)), body["gomaxprocs"])
+
+	mem, ok := body["memstats"].(map[string]any)
+	require.True(t, ok, "memstats is an object")
+	assert.ElementsMatch(t, []string{
+		"alloc", "total_alloc", "sys", "heap_inuse", "heap_objects", "num_gc", "pause_total_ns", "last_gc",
+	}, keys(mem))
+	for _, k := range []string{"alloc", "total_alloc", "sys"} {
+		assert.Greater(t, mem[k], 0.0, k)
+	}
+
+	assert.Equal(t, map[string]any{"requests": 3.0, "used_bytes": 1024.0}, body["counters"])
+
+	// counters are read when asked for, not when published
+	requests.Add(1)
+	assert.Equal(t, 4.0, get(t, h)["counters"].(map[string]any)["requests"])
+}
+
+func TestBuild(t *testing.T) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Skip("no build info in this binary")
+	}
+
+	build, ok := get(t, New("test"))["build"].(map[string]any)
+	require.True(t, ok, "build is an object")
+	assert.ElementsMatch(t, []string{"go_version", "path", "main", "deps", "settings"}, keys(build))
+	assert.Equal(t, runtime.Version(), build["go_version"])
+	assert.Equal(t, info.Path, build["path"])
+	assert.IsType(t, map[string]any{}, build["main"])
+	assert.IsType(t, []any{}, build["deps"])
+	assert.IsType(t, map[string]any{}, build["settings"])
+}
+
+func TestBuildFrom(t *testing.T) {
+	b := buildFrom(&debug.BuildInfo{
+		GoVersion: "go1.21.0",
+		Path:      "example.com/app/cmd/app",
+		Main:      debug.Module{Path: "example.com/app", Version: "(devel)"},
+		Deps: []*debug.Module{
+			{Path: "example.com/z", Version: "v1.0.0", Sum: "h1:z"},
+			{Path: "example.com/a", Version: "v1.0.0", Replace: &debug.Module{Path: "example.com/fork", Version: "v1.0.1"}},
+		},
+		Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "abc123"}, {Key: "GOOS", Value: "linux"}},
+	})
+	assert.Equal(t, Module{Path: "example.com/app", Version: "(devel)"}, b.Main)
+	assert.Equal(t, []Module{
+		{Path: "example.com/fork", Version: "v1.0.1"},
+		{Path: "example.com/z", Version: "v1.0.0", Sum: "h1:z"},
+	}, b.Deps, "replacements in place of what they replace, sorted")
+	assert.Equal(t, map[string]string{"vcs.revision": "abc123", "GOOS": "linux"}, b.Settings)
+}
+
+func TestNoCounters(t *testing.T) {
+	assert.Equal(t, map[string]any{}, get(t, New("empty"))["counters"], "an empty object, not null")
+}
+
+func TestMethods(t *testing.T) {
+	h := New("app")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/stats", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/debug/stats", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// broken is a Var whose String isn't JSON
+type broken struct{}
+
+func (broken) String() string { return "{not json" }
+
+func TestBrokenCounter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	New("app", WithCounter("broken", broken{})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/stats", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `"app"`, "no half-written stats")
+}
@@ -0,0 +1,145 @@
+// Package checksum hashes data with sha256 as it streams past, and writes
+// files that are either complete and correct or not there at all
+package checksum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrMismatch is wrapped by every error about a sum not being the one
+// expected
+var ErrMismatch = errors.New("checksum: mismatch")
+
+// HashingReader hashes everything read through it. It's io.TeeReader into
+// a hash, with the count and the expected sum built in
+type HashingReader struct {
+	r    io.Reader
+	h    hash.Hash
+	n    int64
+	want string
+}
+
+// NewHashingReader hashes what's read from r
+func NewHashingReader(r io.Reader) *HashingReader {
+	return &HashingReader{r: r, h: sha256.New()}
+}
+
+// NewVerifyingReader hashes what's read from r and checks it against want,
+// a hex sha256. Reaching the end with a different sum returns an error
+// wrapping ErrMismatch instead of io.EOF, so a corrupted stream can't pass
+// for a short, good one.
+//
+// The bytes before that have been returned already. Anything that acts on
+// them as they arrive needs to be able to throw them away again - write
+// them somewhere temporary, say, as WriteFileAtomicWithChecksum does
+func NewVerifyingReader(r io.Reader, want string) *HashingReader {
+	return &HashingReader{r: r, h: sha256.New(), want: want}
+}
+
+func (h *HashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	// hash.Hash's Write never fails
+	h.h.Write(p[:n])
+	h.n += int64(n)
+	if err == io.EOF && h.want != "" {
+		if err := check(h.want, h.Sum()); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// Sum is the hex sha256 of what's been read so far
+func (h *HashingReader) Sum() string { return hex.EncodeToString(h.h.Sum(nil)) }
+
+// N is how many bytes have been read
+func (h *HashingReader) N() int64 { return h.n }
+
+// HashingWriter hashes everything written through it to w
+type HashingWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+// NewHashingWriter hashes what's written to w. Only bytes w accepted are
+// hashed, so after a short write the sum still matches what w has
+func NewHashingWriter(w io.Writer) *HashingWriter {
+	return &HashingWriter{w: w, h: sha256.New()}
+}
+
+func (h *HashingWriter) Write(p []byte) (int, error) {
+	n, err := h.w.Write(p)
+	h.h.Write(p[:n])
+	h.n += int64(n)
+	return n, err
+}
+
+// Sum is the hex sha256 of what's been written so far
+func (h *HashingWriter) Sum() string { return hex.EncodeToString(h.h.Sum(nil)) }
+
+// N is how many bytes have been written
+func (h *HashingWriter) N() int64 { return h.n }
+
+func check(want, got string) error {
+	if want != got {
+		return fmt.Errorf("%w: want %s, got %s", ErrMismatch, want, got)
+	}
+	return nil
+}
+
+// WriteFileAtomicWithChecksum copies r to path, returning the hex sha256 of
+// what it wrote and how many bytes that was. With want set to a hex sha256,
+// anything else is an error wrapping ErrMismatch and path is left alone.
+//
+// It's written to a temporary file in path's directory, synced, and only
+// then renamed to path. A rename within a directory is atomic, so anyone
+// looking sees the old file or the new one, never half of it - whether the
+// copy fails, the sum's wrong or the machine crashes. A crash can still
+// leave the temporary file behind, named after path with a .tmp- suffix.
+//
+// The file is created the way os.CreateTemp does it, readable and writable
+// by its owner only
+func WriteFileAtomicWithChecksum(path string, r io.Reader, want string) (sum string, n int64, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	hw := NewHashingWriter(tmp)
+	if _, err := io.Copy(hw, r); err != nil {
+		return "", hw.N(), err
+	}
+	sum = hw.Sum()
+	if want != "" {
+		if err := check(want, sum); err != nil {
+			return sum, hw.N(), err
+		}
+	}
+
+	// the bytes have to be on disk before the rename makes them visible,
+	// or a crash could leave path naming a file with nothing in it
+	if err := tmp.Sync(); err != nil {
+		return "", hw.N(), err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", hw.N(), err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", hw.N(), err
+	}
+	return sum, hw.N(), nil
+}
@@ -0,0 +1,172 @@
+package checksum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+const data = "the quick brown fox jumps over the lazy dog"
+
+// corrupt flips a bit in the byte at i as it goes past, the way a bad
+// network card or disk would
+type corrupt struct {
+	r   io.Reader
+	i   int
+	pos int
+}
+
+func (c *corrupt) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.i >= c.pos && c.i < c.pos+n {
+		p[c.i-c.pos] ^= 1
+	}
+	c.pos += n
+	return n, err
+}
+
+func TestHashingReader(t *testing.T) {
+	r := NewHashingReader(iotest.OneByteReader(strings.NewReader(data)))
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(b))
+	assert.Equal(t, sum(data), r.Sum())
+	assert.Equal(t, int64(len(data)), r.N())
+
+	// Sum part way through is the sum of what's been read
+	r = NewHashingReader(strings.NewReader(data))
+	io.CopyN(io.Discard, r, 9)
+	assert.Equal(t, sum(data[:9]), r.Sum())
+}
+
+func TestVerifyingReader(t *testing.T) {
+	b, err := io.ReadAll(NewVerifyingReader(iotest.HalfReader(strings.NewReader(data)), sum(data)))
+	require.NoError(t, err)
+	assert.Equal(t, data, string(b))
+
+	// a flipped bit anywhere is caught, at the end
+	for i := 0; i < len(data); i++ {
+		_, err := io.ReadAll(NewVerifyingReader(&corrupt{r: strings.NewReader(data), i: i}, sum(data)))
+		require.ErrorIs(t, err, ErrMismatch, "bit flipped at %d", i)
+	}
+
+	// so is a stream cut short, which would otherwise look like a clean EOF
+	_, err = io.ReadAll(NewVerifyingReader(strings.NewReader(data[:20]), sum(data)))
+	assert.ErrorIs(t, err, ErrMismatch)
+	assert.ErrorContains(t, err, "want "+sum(data)+", got "+sum(data[:20]))
+
+	// other errors come through as they are
+	boom := errors.New("boom")
+	_, err = io.ReadAll(NewVerifyingReader(io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(boom)), sum(data)))
+	assert.ErrorIs(t, err, boom)
+	assert.NotErrorIs(t, err, ErrMismatch)
+}
+
+// shortWriter takes n bytes and then fails
+type shortWriter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (s *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > s.n {
+		s.buf.Write(p[:s.n])
+		n := s.n
+		s.n = 0
+		return n, io.ErrShortWrite
+	}
+	s.n -= len(p)
+	return s.buf.Write(p)
+}
+
+func TestHashingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewHashingWriter(&buf)
+	_, err := io.Copy(w, iotest.HalfReader(strings.NewReader(data)))
+	require.NoError(t, err)
+	assert.Equal(t, sum(data), w.Sum())
+	assert.Equal(t, int64(len(data)), w.N())
+
+	sw := &shortWriter{n: 10}
+	w = NewHashingWriter(sw)
+	n, err := w.Write([]byte(data))
+	assert.ErrorIs(t, err, io.ErrShortWrite)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, sum(sw.buf.String()), w.Sum(), "only what got through is hashed")
+}
+
+func TestWriteFileAtomicWithChecksum(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fox.txt")
+
+	got, n, err := WriteFileAtomicWithChecksum(path, strings.NewReader(data), sum(data))
+	require.NoError(t, err)
+	assert.Equal(t, sum(data), got)
+	assert.Equal(t, int64(len(data)), n)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(b))
+
+	// no expected sum: whatever arrives is written, and its sum returned
+	got, _, err = WriteFileAtomicWithChecksum(path, strings.NewReader("replaced"), "")
+	require.NoError(t, err)
+	assert.Equal(t, sum("replaced"), got)
+	b, _ = os.ReadFile(path)
+	assert.Equal(t, "replaced", string(b))
+	assertOnly(t, dir, "fox.txt")
+}
+
+func TestWriteFileAtomicMismatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fox.txt")
+	require.NoError(t, os.WriteFile(path, []byte("the old one"), 0o644))
+
+	got, _, err := WriteFileAtomicWithChecksum(path, &corrupt{r: strings.NewReader(data), i: 7}, sum(data))
+	assert.ErrorIs(t, err, ErrMismatch)
+	assert.NotEqual(t, sum(data), got, "the sum of what did arrive")
+
+	b, _ := os.ReadFile(path)
+	assert.Equal(t, "the old one", string(b), "a bad copy never replaces a good one")
+	assertOnly(t, dir, "fox.txt")
+}
+
+func TestWriteFileAtomicReadError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fox.txt")
+
+	boom := errors.New("connection reset")
+	_, _, err := WriteFileAtomicWithChecksum(path, io.MultiReader(strings.NewReader("half"), iotest.ErrReader(boom)), "")
+	assert.ErrorIs(t, err, boom)
+	assert.NoFileExists(t, path)
+	assertOnly(t, dir)
+
+	_, _, err = WriteFileAtomicWithChecksum(filepath.Join(dir, "missing", "fox.txt"), strings.NewReader(data), "")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// assertOnly checks dir holds exactly names - no temporary files left over
+func assertOnly(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	got := []string{}
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	assert.ElementsMatch(t, append([]string{}, names...), got)
+}
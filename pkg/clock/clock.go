@@ -0,0 +1,122 @@
+// Package clock lets code that depends on time be driven by a fake clock in
+// tests, instead of sleeping and hoping
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the subset of the time package the rest of the repo uses
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// New returns a Clock backed by the time package
+func New() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Fake is a Clock that only moves when Advance is called
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+	changed chan struct{}
+}
+
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFake returns a Fake clock set to t
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t, changed: make(chan struct{})}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// After returns a channel that receives once the clock has been advanced by d
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+
+	f.waiters = append(f.waiters, waiter{deadline: f.now.Add(d), ch: ch})
+	f.notify()
+
+	return ch
+}
+
+// Advance moves the clock forward by d, firing every After whose deadline
+// has been reached, earliest first
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+
+	sort.Slice(f.waiters, func(i, j int) bool {
+		return f.waiters[i].deadline.Before(f.waiters[j].deadline)
+	})
+
+	remaining := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.deadline.After(f.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- f.now
+	}
+	f.waiters = remaining
+	f.notify()
+}
+
+// Waiters is the number of After channels that haven't fired yet
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+// BlockUntil waits until at least n After channels are pending. Tests use it
+// to know a goroutine has reached its wait before calling Advance
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mu.Lock()
+		if len(f.waiters) >= n {
+			f.mu.Unlock()
+			return
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		<-changed
+	}
+}
+
+// notify wakes anyone in BlockUntil. f.mu must be held
+func (f *Fake) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
@@ -0,0 +1,48 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAdvance(t *testing.T) {
+	f := NewFake(start)
+	assert.Equal(t, start, f.Now())
+
+	ch := f.After(time.Minute)
+	assert.Equal(t, 1, f.Waiters())
+
+	f.Advance(30 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("fired early")
+	default:
+	}
+
+	f.Advance(30 * time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-ch)
+	assert.Equal(t, 0, f.Waiters())
+}
+
+func TestFakeAfterZero(t *testing.T) {
+	f := NewFake(start)
+	assert.Equal(t, start, <-f.After(0))
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(start)
+	done := make(chan struct{})
+
+	go func() {
+		<-f.After(time.Second)
+		close(done)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+	<-done
+}
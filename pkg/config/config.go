@@ -0,0 +1,135 @@
+// Package config loads the settings the apps in this repo share. Values come
+// from defaults, then a YAML file, then environment variables named by each
+// field's env tag, each overriding the one before
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server Server `yaml:"server"`
+}
+
+// Server holds the *http.Server settings, see server.FromConfig
+type Server struct {
+	Addr              string        `yaml:"addr" env:"SERVER_ADDR"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES"`
+	// AdminAddr is where the admin endpoints listen, see server.Admin.
+	// Empty turns them off
+	AdminAddr string `yaml:"admin_addr" env:"SERVER_ADMIN_ADDR"`
+}
+
+// Default is the configuration before any file or environment variable is
+// applied
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    64 << 10,
+			// loopback only, so it takes a deliberate change to expose it
+			AdminAddr: "localhost:6060",
+		},
+	}
+}
+
+// LookupFunc finds an environment variable, os.LookupEnv in real use
+type LookupFunc func(key string) (string, bool)
+
+// Load builds a Config from the defaults, the YAML file at path (skipped
+// when path is empty) and the environment. The file is decoded strictly, so a
+// misspelt key is an error rather than a silently ignored setting
+func Load(path string, lookup LookupFunc) (Config, error) {
+	c := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return c, fmt.Errorf("config: %w", err)
+		}
+		if err := decodeYAML(data, &c); err != nil {
+			return c, fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(&c, lookup); err != nil {
+		return c, fmt.Errorf("config: %w", err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return c, fmt.Errorf("config: %w", err)
+	}
+	return c, nil
+}
+
+// decodeYAML decodes over the top of c, so keys missing from the file keep
+// their current values
+func decodeYAML(data []byte, c *Config) error {
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+
+	if err := d.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyEnv sets whichever fields have their env tag's variable set, see
+// pkg/envconfig
+func applyEnv(c *Config, lookup LookupFunc) error {
+	if lookup == nil {
+		return nil
+	}
+	return envconfig.Process(envconfig.LookupFunc(lookup), c)
+}
+
+// Validate reports every problem at once rather than just the first, in
+// the order of the fields, so the same config always gets the same message
+func (c Config) Validate() error {
+	var errs []error
+	s := c.Server
+
+	if s.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	for _, d := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read_header_timeout", s.ReadHeaderTimeout},
+		{"read_timeout", s.ReadTimeout},
+		{"write_timeout", s.WriteTimeout},
+		{"idle_timeout", s.IdleTimeout},
+	} {
+		if d.d <= 0 {
+			errs = append(errs, fmt.Errorf("server.%s must be positive, got %v", d.name, d.d))
+		}
+	}
+	if s.ReadTimeout > 0 && s.ReadHeaderTimeout > s.ReadTimeout {
+		errs = append(errs, errors.New("server.read_header_timeout can't be longer than server.read_timeout"))
+	}
+	if s.MaxHeaderBytes <= 0 {
+		errs = append(errs, fmt.Errorf("server.max_header_bytes must be positive, got %d", s.MaxHeaderBytes))
+	}
+	if s.AdminAddr != "" && s.AdminAddr == s.Addr {
+		errs = append(errs, errors.New("server.admin_addr can't be the same as server.addr"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	return path
+}
+
+func env(vars map[string]string) LookupFunc {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	c, err := Load("", nil)
+	require.NoError(t, err)
+	assert.Equal(t, Default(), c)
+	assert.NoError(t, Default().Validate())
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  addr: ":9000"
+  read_timeout: 10s
+  idle_timeout: 1m
+`)
+
+	c, err := Load(path, env(map[string]string{
+		"SERVER_READ_TIMEOUT": "20s",
+		"UNRELATED":           "ignored",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, ":9000", c.Server.Addr, "file beats default")
+	assert.Equal(t, 20*time.Second, c.Server.ReadTimeout, "env beats file")
+	assert.Equal(t, time.Minute, c.Server.IdleTimeout, "file beats default")
+	assert.Equal(t, 30*time.Second, c.Server.WriteTimeout, "default when nothing else sets it")
+
+	c, err = Load("", env(map[string]string{"SERVER_ADDR": ":7000", "SERVER_MAX_HEADER_BYTES": "1024"}))
+	require.NoError(t, err)
+	assert.Equal(t, ":7000", c.Server.Addr, "env beats default")
+	assert.Equal(t, 1024, c.Server.MaxHeaderBytes)
+
+	c, err = Load("", env(map[string]string{"SERVER_ADMIN_ADDR": ""}))
+	require.NoError(t, err)
+	assert.Empty(t, c.Server.AdminAddr, "set empty turns the admin port off")
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file string
+		env  map[string]string
+		want []string
+	}{
+		{"unknown key", "server:\n  adr: \":1\"\n", nil, []string{"field adr not found"}},
+		{"bad yaml", "server: [\n", nil, []string{"config.yaml"}},
+		{"bad env duration", "", map[string]string{"SERVER_IDLE_TIMEOUT": "forever", "SERVER_MAX_HEADER_BYTES": "lots"}, []string{"SERVER_IDLE_TIMEOUT", "SERVER_MAX_HEADER_BYTES"}},
+		{"invalid values", "server:\n  addr: \"\"\n  write_timeout: -1s\n  read_header_timeout: 1m\n", nil, []string{"server.addr is required", "server.write_timeout must be positive", "read_header_timeout can't be longer"}},
+		{"admin on the same port", "server:\n  addr: \":9000\"\n  admin_addr: \":9000\"\n", nil, []string{"server.admin_addr can't be the same"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := ""
+			if tc.file != "" {
+				path = writeFile(t, tc.file)
+			}
+
+			_, err := Load(path, env(tc.env))
+			require.Error(t, err)
+			for _, want := range tc.want {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"), nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidateOrder(t *testing.T) {
+	c := Default()
+	c.Server.Addr = ""
+	c.Server.IdleTimeout = 0
+	c.Server.ReadTimeout = -time.Second
+	c.Server.WriteTimeout = 0
+	c.Server.MaxHeaderBytes = 0
+
+	// every time, not just most of the time
+	for i := 0; i < 20; i++ {
+		assert.EqualError(t, c.Validate(), strings.Join([]string{
+			"server.addr is required",
+			"server.read_timeout must be positive, got -1s",
+			"server.write_timeout must be positive, got 0s",
+			"server.idle_timeout must be positive, got 0s",
+			"server.max_header_bytes must be positive, got 0",
+		}, "\n"))
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	c, err := Load(writeFile(t, "# nothing here yet\n"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, Default(), c)
+}
@@ -0,0 +1,195 @@
+// Package csrf protects cookie-authenticated forms from cross-site request
+// forgery with the double-submit pattern. The middleware gives each browser
+// a random token in a cookie, and every state-changing request must send
+// the same token back in a form field or header. Another site can make the
+// browser send the cookie, but can't read it, so it can't put the matching
+// token in the form.
+//
+// Plain double submit has a gap: anyone who can set a cookie for the site -
+// a sibling subdomain, a man in the middle on plain http - can plant a
+// cookie and a form that agree. So each token is signed, with a secret only
+// the server knows, together with the session it was issued for. A planted
+// token fails the signature, and a token from before login stops working
+// once the session changes.
+//
+//	protect := csrf.Middleware(secret, csrf.SessionID(sessionOf), csrf.Exempt("/webhooks/"))
+//
+// and in a template, given csrf.TemplateField(r) as .CSRF:
+//
+//	<form method="post">{{ .CSRF }} ... </form>
+//
+// JavaScript sends the token in the X-CSRF-Token header instead, reading it
+// from the cookie, which is deliberately not HttpOnly: the token isn't a
+// secret from the page, only from other sites
+package csrf
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+const (
+	CookieName = "csrf_token"
+	HeaderName = "X-CSRF-Token"
+	FieldName  = "csrf_token"
+)
+
+var (
+	ErrNoToken  = errors.New("csrf token missing")
+	ErrBadToken = errors.New("csrf token invalid")
+)
+
+type options struct {
+	exempt    []string
+	sessionID func(*http.Request) string
+}
+
+type Option func(*options)
+
+// Exempt skips checking requests to paths. A path ending in / covers
+// everything under it, as with http.ServeMux. Webhooks and other
+// endpoints called by servers rather than browsers belong here - they
+// authenticate some other way and never have the cookie
+func Exempt(paths ...string) Option {
+	return func(o *options) { o.exempt = append(o.exempt, paths...) }
+}
+
+// SessionID ties tokens to the session f returns for a request. Without
+// it, tokens are tied to nothing but the browser's cookie
+func SessionID(f func(*http.Request) string) Option {
+	return func(o *options) { o.sessionID = f }
+}
+
+// Middleware checks the token on every request that isn't GET, HEAD,
+// OPTIONS or TRACE, which mustn't change anything and so can come from
+// anywhere. A request without a valid token cookie for its session gets a
+// new one. Failures are a 403
+func Middleware(secret []byte, opts ...Option) func(http.Handler) http.Handler {
+	o := options{sessionID: func(*http.Request) string { return "" }}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	secret = bytes.Clone(secret)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := o.sessionID(r)
+			token := ""
+			if c, err := r.Cookie(CookieName); err == nil && valid(secret, session, c.Value) {
+				token = c.Value
+			}
+
+			if !safe(r.Method) && !o.exempted(r.URL.Path) {
+				if err := check(r, token); err != nil {
+					http.Error(w, err.Error(), http.StatusForbidden)
+					return
+				}
+			}
+
+			if token == "" {
+				token = issue(secret, session)
+				http.SetCookie(w, &http.Cookie{
+					Name:     CookieName,
+					Value:    token,
+					Path:     "/",
+					Secure:   true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, token)))
+		})
+	}
+}
+
+func safe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func (o *options) exempted(path string) bool {
+	for _, p := range o.exempt {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// check compares the submitted token with the cookie's, which has already
+// been verified - an empty cookie token means there wasn't a good one
+func check(r *http.Request, cookie string) error {
+	sent := r.Header.Get(HeaderName)
+	if sent == "" {
+		sent = r.PostFormValue(FieldName)
+	}
+	switch {
+	case sent == "" || cookie == "":
+		return ErrNoToken
+	case subtle.ConstantTimeCompare([]byte(sent), []byte(cookie)) != 1:
+		return ErrBadToken
+	}
+	return nil
+}
+
+var b64 = base64.RawURLEncoding
+
+// issue makes a token: a random nonce and a signature over the session
+// and the nonce
+func issue(secret []byte, session string) string {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err) // crypto/rand doesn't fail on any platform Go supports
+	}
+	return b64.EncodeToString(nonce) + "." + b64.EncodeToString(sign(secret, session, nonce))
+}
+
+func valid(secret []byte, session, token string) bool {
+	enc, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	nonce, err := b64.DecodeString(enc)
+	if err != nil {
+		return false
+	}
+	sig, err := b64.DecodeString(encSig)
+	return err == nil && hmac.Equal(sig, sign(secret, session, nonce))
+}
+
+func sign(secret []byte, session string, nonce []byte) []byte {
+	m := hmac.New(sha256.New, secret)
+	// the length first, so session "a" + nonce "bc" can't sign the same
+	// bytes as session "ab" + nonce "c"
+	m.Write(binary.BigEndian.AppendUint64(nil, uint64(len(session))))
+	m.Write([]byte(session))
+	m.Write(nonce)
+	return m.Sum(nil)
+}
+
+type tokenKey struct{}
+
+// Token is the request's token, for a handler behind Middleware to put in
+// a page or a JSON response. Empty outside the middleware
+func Token(r *http.Request) string {
+	t, _ := r.Context().Value(tokenKey{}).(string)
+	return t
+}
+
+// TemplateField is a hidden form input carrying the token, ready to drop
+// into an html/template
+func TemplateField(r *http.Request) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + FieldName + `" value="` + template.HTMLEscapeString(Token(r)) + `">`)
+}
@@ -0,0 +1,192 @@
+package csrf
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/golden"
+)
+
+var secret = []byte("test secret")
+
+// handler renders a form on GET and says ok to anything that gets through
+func handler(t *testing.T, opts ...Option) http.Handler {
+	form := template.Must(template.New("form").Parse(`<form method="post">{{ .CSRF }}<button>go</button></form>`))
+	return Middleware(secret, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			require.NoError(t, form.Execute(w, map[string]any{"CSRF": TemplateField(r)}))
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+}
+
+type request struct {
+	method, path string
+	cookie       string // the csrf cookie, if set
+	session      string // the X-Session header, see sessionFromHeader
+	form         url.Values
+	header       string // the X-CSRF-Token header, if set
+}
+
+func (rq request) do(h http.Handler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(rq.method, rq.path, strings.NewReader(rq.form.Encode()))
+	if rq.form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if rq.cookie != "" {
+		req.AddCookie(&http.Cookie{Name: CookieName, Value: rq.cookie})
+	}
+	if rq.session != "" {
+		req.Header.Set("X-Session", rq.session)
+	}
+	if rq.header != "" {
+		req.Header.Set(HeaderName, rq.header)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func cookieFrom(rec *httptest.ResponseRecorder) string {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == CookieName {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func TestFormRoundTrip(t *testing.T) {
+	h := handler(t)
+
+	rec := request{method: "GET", path: "/"}.do(h)
+	require.Equal(t, http.StatusOK, rec.Code)
+	token := cookieFrom(rec)
+	require.NotEmpty(t, token)
+	assert.Equal(t, `<form method="post"><input type="hidden" name="csrf_token" value="`+token+`"><button>go</button></form>`, rec.Body.String())
+
+	c := rec.Result().Cookies()[0]
+	assert.True(t, c.Secure)
+	assert.False(t, c.HttpOnly, "JavaScript reads it for the header")
+	assert.Equal(t, http.SameSiteLaxMode, c.SameSite)
+
+	rec = request{method: "GET", path: "/", cookie: token}.do(h)
+	assert.Empty(t, cookieFrom(rec), "a good cookie is kept")
+
+	rec = request{method: "POST", path: "/", cookie: token, form: url.Values{FieldName: {token}}}.do(h)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+
+	rec = request{method: "DELETE", path: "/", cookie: token, header: token}.do(h)
+	assert.Equal(t, http.StatusOK, rec.Code, "the header works as well as the form")
+}
+
+// TestTemplateGolden renders a whole page, the way an app would use the
+// field: html/template escapes what the user typed for where it lands, and
+// leaves TemplateField alone because it's template.HTML. The token is
+// random, so it's scrubbed before comparing
+func TestTemplateGolden(t *testing.T) {
+	page := template.Must(template.New("page").Parse(`<form method="post" action="/comments">
+  {{ .CSRF }}
+  <textarea name="body">{{ .Draft }}</textarea>
+  <a href="/users?name={{ .User }}">{{ .User }}</a>
+  <button>post</button>
+</form>
+`))
+	h := Middleware(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, page.Execute(w, map[string]any{
+			"CSRF":  TemplateField(r),
+			"Draft": "</textarea><script>alert(1)</script>",
+			"User":  "Ann & Bob",
+		}))
+	}))
+
+	rec := request{method: "GET", path: "/"}.do(h)
+	require.Equal(t, http.StatusOK, rec.Code)
+	golden.Assert(t, rec.Body.Bytes(), "form.golden",
+		golden.Scrub(regexp.MustCompile(`name="`+FieldName+`" value="[^"]*"`), `name="`+FieldName+`" value="TOKEN"`))
+}
+
+func TestRejected(t *testing.T) {
+	h := handler(t)
+	token := cookieFrom(request{method: "GET", path: "/"}.do(h))
+	other := cookieFrom(request{method: "GET", path: "/"}.do(h))
+	forged := issue([]byte("attacker's secret"), "")
+
+	for name, tc := range map[string]struct {
+		rq   request
+		want error
+	}{
+		"no token at all":       {request{method: "POST", path: "/"}, ErrNoToken},
+		"cookie but no field":   {request{method: "POST", path: "/", cookie: token, form: url.Values{"title": {"x"}}}, ErrNoToken},
+		"field but no cookie":   {request{method: "POST", path: "/", form: url.Values{FieldName: {token}}}, ErrNoToken},
+		"mismatched":            {request{method: "POST", path: "/", cookie: token, form: url.Values{FieldName: {other}}}, ErrBadToken},
+		"mismatched header":     {request{method: "PUT", path: "/", cookie: token, header: other}, ErrBadToken},
+		"truncated":             {request{method: "POST", path: "/", cookie: token, header: token[:len(token)-1]}, ErrBadToken},
+		"planted cookie":        {request{method: "POST", path: "/", cookie: forged, header: forged}, ErrNoToken},
+		"garbage cookie":        {request{method: "PATCH", path: "/", cookie: "garbage", header: "garbage"}, ErrNoToken},
+		"exempt only when told": {request{method: "POST", path: "/webhooks/stripe"}, ErrNoToken},
+	} {
+		rec := tc.rq.do(h)
+		assert.Equal(t, http.StatusForbidden, rec.Code, name)
+		assert.Equal(t, tc.want.Error()+"\n", rec.Body.String(), name)
+	}
+
+	for _, method := range []string{"GET", "HEAD", "OPTIONS", "TRACE"} {
+		assert.Equal(t, http.StatusOK, request{method: method, path: "/"}.do(h).Code, method)
+	}
+}
+
+func TestExempt(t *testing.T) {
+	h := handler(t, Exempt("/webhooks/", "/ping"))
+
+	assert.Equal(t, http.StatusOK, request{method: "POST", path: "/webhooks/stripe"}.do(h).Code)
+	assert.Equal(t, http.StatusOK, request{method: "POST", path: "/ping"}.do(h).Code)
+	assert.Equal(t, http.StatusForbidden, request{method: "POST", path: "/ping/more"}.do(h).Code, "no trailing slash, exact match only")
+	assert.Equal(t, http.StatusForbidden, request{method: "POST", path: "/webhooks"}.do(h).Code)
+}
+
+func sessionFromHeader(r *http.Request) string { return r.Header.Get("X-Session") }
+
+func TestPerSession(t *testing.T) {
+	h := handler(t, SessionID(sessionFromHeader))
+
+	anon := cookieFrom(request{method: "GET", path: "/"}.do(h))
+	alice := cookieFrom(request{method: "GET", path: "/", session: "alice-session"}.do(h))
+	assert.NotEqual(t, anon, alice)
+
+	rec := request{method: "POST", path: "/", session: "alice-session", cookie: alice, header: alice}.do(h)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// a token from before login, or from someone else's session, is
+	// refused - and replaced, ready for the next form
+	rec = request{method: "POST", path: "/", session: "alice-session", cookie: anon, header: anon}.do(h)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = request{method: "POST", path: "/", session: "mallory-session", cookie: alice, header: alice}.do(h)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = request{method: "GET", path: "/", session: "alice-session", cookie: anon}.do(h)
+	fresh := cookieFrom(rec)
+	require.NotEmpty(t, fresh, "logging in gets a new token")
+	assert.Contains(t, rec.Body.String(), fresh)
+	assert.Equal(t, http.StatusOK, request{method: "POST", path: "/", session: "alice-session", cookie: fresh, header: fresh}.do(h).Code)
+}
+
+func TestToken(t *testing.T) {
+	assert.Empty(t, Token(httptest.NewRequest("GET", "/", nil)), "outside the middleware")
+
+	var seen string
+	h := Middleware(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { seen = Token(r) }))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, cookieFrom(rec), seen)
+}
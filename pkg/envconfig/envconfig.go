@@ -0,0 +1,215 @@
+// Package envconfig fills a struct in from environment variables, as its
+// field tags describe.
+//
+// Reading config from the environment by hand is a wall of os.Getenv,
+// strconv and if-err-return. Struct tags can describe the same thing:
+//
+//	type config struct {
+//		Port    int           `env:"PORT,default=8000"`
+//		DBURL   string        `env:"DATABASE_URL,required"`
+//		Timeout time.Duration `env:"TIMEOUT,default=5s"`
+//		Hosts   []string      `env:"HOSTS"` // comma separated
+//	}
+//
+// and Process fills the struct in with reflect - the same idea as the
+// popular kelseyhightower/envconfig, in about two hundred lines.
+//
+// default= takes the rest of the tag, commas and all, so it goes last:
+// `env:"HOSTS,required,default=a.example.com,b.example.com"`
+package envconfig
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LookupFunc finds an environment variable, os.LookupEnv in real use. Taking
+// it as a parameter keeps tests away from the real environment
+type LookupFunc func(key string) (string, bool)
+
+var (
+	ErrRequired    = errors.New("required but not set")
+	ErrUnsupported = errors.New("unsupported field type")
+	ErrBadTag      = errors.New("bad env tag")
+	errNotStruct   = errors.New("envconfig: want a non-nil pointer to a struct")
+)
+
+// FieldError says which field and variable a problem came from
+type FieldError struct {
+	Field string // Go path, e.g. "Server.Port"
+	Var   string
+	Err   error
+}
+
+func (e *FieldError) Error() string { return fmt.Sprintf("%s (%s): %v", e.Var, e.Field, e.Err) }
+func (e *FieldError) Unwrap() error { return e.Err }
+
+type tag struct {
+	name       string
+	def        string
+	hasDefault bool
+	required   bool
+}
+
+// parseTag splits an env tag into the variable's name and its options. An
+// option it doesn't know is an error rather than ignored, so a typo like
+// "requird" doesn't quietly make a field optional
+func parseTag(s string) (tag, error) {
+	name, opts, _ := strings.Cut(s, ",")
+	t := tag{name: name}
+	if name == "" {
+		return t, fmt.Errorf("%w: no variable name", ErrBadTag)
+	}
+	for opts != "" {
+		// a default is the rest of the tag, since the value itself may
+		// have commas in it - a list, say
+		if def, ok := strings.CutPrefix(opts, "default="); ok {
+			t.def, t.hasDefault = def, true
+			break
+		}
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		switch opt {
+		case "required":
+			t.required = true
+		default:
+			return t, fmt.Errorf("%w: unknown option %q", ErrBadTag, opt)
+		}
+	}
+	return t, nil
+}
+
+// Process sets the tagged fields of the struct v points to. Fields without
+// an env tag are left alone, except nested structs, which are walked too.
+// A variable that's set wins over default=, and a field with neither keeps
+// whatever value it already had - so Process can layer on top of defaults
+// set in code. Every problem is reported, not just the first
+func Process(lookup LookupFunc, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errNotStruct
+	}
+
+	var errs []error
+	process(lookup, rv.Elem(), "", &errs)
+	return errors.Join(errs...)
+}
+
+func process(lookup LookupFunc, rv reflect.Value, prefix string, errs *[]error) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fv := rv.Field(i)
+
+		raw, ok := f.Tag.Lookup("env")
+		if !ok {
+			if f.Type.Kind() == reflect.Struct && !isTextUnmarshaler(fv) {
+				process(lookup, fv, prefix+f.Name+".", errs)
+			}
+			continue
+		}
+
+		t, err := parseTag(raw)
+		fieldErr := func(err error) {
+			*errs = append(*errs, &FieldError{Field: prefix + f.Name, Var: t.name, Err: err})
+		}
+		if err != nil {
+			fieldErr(err)
+			continue
+		}
+
+		value, set := lookup(t.name)
+		switch {
+		case set:
+		case t.hasDefault:
+			value = t.def
+		case t.required:
+			fieldErr(ErrRequired)
+			continue
+		default:
+			continue
+		}
+
+		if err := setValue(fv, value); err != nil {
+			fieldErr(err)
+		}
+	}
+}
+
+func isTextUnmarshaler(v reflect.Value) bool {
+	_, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses s into v according to v's type
+func setValue(v reflect.Value, s string) error {
+	// anything that can parse itself gets to - net.IP, time.Time, custom types
+	if v.CanAddr() {
+		if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return tu.UnmarshalText([]byte(s))
+		}
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var parts []string
+		if s != "" {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setValue(slice.Index(i), strings.TrimSpace(p)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("%w %s", ErrUnsupported, v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package envconfig
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) LookupFunc {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+type database struct {
+	URL      string `env:"DATABASE_URL,required"`
+	MaxConns uint8  `env:"DATABASE_MAX_CONNS,default=10"`
+}
+
+type appConfig struct {
+	Port     int           `env:"PORT,default=8000"`
+	Debug    bool          `env:"DEBUG"`
+	Timeout  time.Duration `env:"TIMEOUT,default=5s"`
+	Ratio    float64       `env:"RATIO,default=0.5"`
+	Hosts    []string      `env:"HOSTS"`
+	Ports    []int         `env:"EXTRA_PORTS"`
+	BindIP   net.IP        `env:"BIND_IP,default=127.0.0.1"`
+	Name     string        `env:"NAME"`
+	DB       database
+	internal string `env:"INTERNAL"`
+}
+
+func TestProcess(t *testing.T) {
+	c := appConfig{Name: "kept"}
+	err := Process(env(map[string]string{
+		"DEBUG":        "true",
+		"TIMEOUT":      "1m30s",
+		"HOSTS":        "a.example.com, b.example.com",
+		"EXTRA_PORTS":  "81,0x1bb",
+		"DATABASE_URL": "postgres://localhost/app",
+		"INTERNAL":     "ignored",
+	}), &c)
+	require.NoError(t, err)
+
+	assert.Equal(t, appConfig{
+		Port:    8000,
+		Debug:   true,
+		Timeout: 90 * time.Second,
+		Ratio:   0.5,
+		Hosts:   []string{"a.example.com", "b.example.com"},
+		Ports:   []int{81, 443},
+		BindIP:  net.ParseIP("127.0.0.1"),
+		Name:    "kept",
+		DB:      database{URL: "postgres://localhost/app", MaxConns: 10},
+	}, c)
+}
+
+func TestSetBeatsDefault(t *testing.T) {
+	var c appConfig
+	require.NoError(t, Process(env(map[string]string{"PORT": "9000", "DATABASE_URL": "x"}), &c))
+	assert.Equal(t, 9000, c.Port)
+
+	// set but empty still counts as set
+	require.NoError(t, Process(env(map[string]string{"HOSTS": "", "DATABASE_URL": "x"}), &c))
+	assert.Empty(t, c.Hosts)
+}
+
+func TestErrors(t *testing.T) {
+	var c appConfig
+	err := Process(env(map[string]string{
+		"PORT":               "eighty",
+		"DATABASE_MAX_CONNS": "300",
+		"EXTRA_PORTS":        "80,x",
+		"BIND_IP":            "not-an-ip",
+	}), &c)
+	require.Error(t, err)
+
+	assert.ErrorIs(t, err, ErrRequired)
+	for _, want := range []string{
+		"PORT (Port)",
+		"DATABASE_URL (DB.URL): required but not set",
+		"DATABASE_MAX_CONNS (DB.MaxConns)",
+		"EXTRA_PORTS (Ports): element 1",
+		"BIND_IP (BindIP)",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	var fe *FieldError
+	require.True(t, errors.As(err, &fe))
+	assert.Equal(t, "PORT", fe.Var)
+}
+
+func TestTag(t *testing.T) {
+	var c struct {
+		Hosts []string `env:"HOSTS,required,default=a.example.com,b.example.com"`
+		Greet string   `env:"GREET,default=hello, world"`
+		Empty string   `env:"EMPTY,default="`
+	}
+	c.Empty = "overwritten"
+	require.NoError(t, Process(env(nil), &c))
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, c.Hosts)
+	assert.Equal(t, "hello, world", c.Greet)
+	assert.Equal(t, "", c.Empty)
+
+	// a misspelt option is an error, not a field that's quietly optional
+	var bad struct {
+		Port   int    `env:"PORT,requird"`
+		Name   string `env:"NAME,required,dflt=x"`
+		NoName string `env:",required"`
+	}
+	err := Process(env(map[string]string{"PORT": "80", "NAME": "x"}), &bad)
+	assert.ErrorIs(t, err, ErrBadTag)
+	for _, want := range []string{
+		`PORT (Port): bad env tag: unknown option "requird"`,
+		`NAME (Name): bad env tag: unknown option "dflt=x"`,
+		` (NoName): bad env tag: no variable name`,
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+	assert.Zero(t, bad.Port, "a field with a bad tag isn't set")
+}
+
+func TestUnsupported(t *testing.T) {
+	var c struct {
+		M map[string]string `env:"M"`
+	}
+	err := Process(env(map[string]string{"M": "a=b"}), &c)
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	var notStruct int
+	assert.ErrorIs(t, Process(env(nil), &notStruct), errNotStruct)
+	assert.ErrorIs(t, Process(env(nil), appConfig{}), errNotStruct)
+}
@@ -0,0 +1,122 @@
+package flags
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a Provider reading a YAML file of flags by name:
+//
+//	new-checkout:
+//	  enabled: true
+//	  rollout: 25
+//	dark-mode:
+//	  enabled: true
+//
+// Watch rereads it every so often, and a change takes effect without a
+// restart. This polls rather than using fsnotify: it's one small file,
+// reading it every few seconds costs nothing, and polling also sees changes
+// fsnotify can miss - an editor that saves by renaming a new file over the
+// old one, or a Kubernetes ConfigMap swapping a symlink
+type File struct {
+	path   string
+	logger *log.Logger
+	set    atomic.Pointer[Set]
+	last   []byte // contents last loaded, only touched by reload
+
+	// what reload last complained about, also only touched by reload. A
+	// bad file is polled every few seconds until somebody fixes it, and
+	// saying so once per change is enough
+	bad     []byte
+	readErr string
+}
+
+// Open reads the flags at path. A missing or bad file is an error here, at
+// startup, rather than a service running with every flag off
+func Open(path string, logger *log.Logger) (*File, error) {
+	f := &File{path: path, logger: logger}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("flags: %w", err)
+	}
+	s, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("flags: %s: %w", path, err)
+	}
+	f.set.Store(&s)
+	f.last = data
+	return f, nil
+}
+
+func (f *File) Snapshot() Set { return *f.set.Load() }
+
+// Watch checks the file every interval until ctx is done. A file that's
+// gone, or doesn't parse, is logged and the last good flags are kept - a
+// typo in the middle of a rollout shouldn't turn it off
+func (f *File) Watch(ctx context.Context, interval time.Duration, clk clock.Clock) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clk.After(interval):
+		}
+		f.reload()
+	}
+}
+
+// reload reads the file and swaps in its flags if the contents changed.
+// Comparing contents rather than the modification time catches two saves
+// within the filesystem's timestamp resolution. A file that can't be read
+// or parsed is logged when that first happens, not on every poll after
+func (f *File) reload() {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if err.Error() != f.readErr {
+			f.readErr = err.Error()
+			f.logger.Printf("flags: keeping the last good flags: %v", err)
+		}
+		return
+	}
+	f.readErr = ""
+	if bytes.Equal(data, f.last) {
+		f.bad = nil
+		return
+	}
+	if f.bad != nil && bytes.Equal(data, f.bad) {
+		return
+	}
+	s, err := parse(data)
+	if err != nil {
+		f.bad = data
+		f.logger.Printf("flags: keeping the last good flags: %s: %v", f.path, err)
+		return
+	}
+	f.set.Store(&s)
+	f.last, f.bad = data, nil
+	f.logger.Printf("flags: reloaded %d flags from %s", len(s), f.path)
+}
+
+// parse decodes strictly, so "rolout: 50" is an error rather than a flag
+// quietly on for everyone
+func parse(data []byte) (Set, error) {
+	s := Set{}
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+	if err := d.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,134 @@
+package flags
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// syncBuffer is a log destination the watcher goroutine and the test can
+// share
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	writeFile(t, path, `
+new-checkout:
+  enabled: true
+  rollout: 25
+dark-mode:
+  enabled: true
+`)
+	f, err := Open(path, log.New(&bytes.Buffer{}, "", 0))
+	require.NoError(t, err)
+	assert.Equal(t, Set{
+		"new-checkout": {Enabled: true, Rollout: rollout(25)},
+		"dark-mode":    {Enabled: true},
+	}, f.Snapshot())
+
+	for name, contents := range map[string]string{
+		"unknown field": "a:\n  enabled: true\n  rolout: 50\n",
+		"bad rollout":   "a:\n  enabled: true\n  rollout: 150\n",
+		"not yaml":      "a: [",
+	} {
+		writeFile(t, path, contents)
+		_, err := Open(path, nil)
+		assert.Error(t, err, name)
+	}
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.yaml"), nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	writeFile(t, path, "dark-mode:\n  enabled: false\n")
+	var logs syncBuffer
+	f, err := Open(path, log.New(&logs, "", 0))
+	require.NoError(t, err)
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.Watch(ctx, 5*time.Second, clk)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// tick waits for the watcher to be waiting, moves the clock on and
+	// waits for it to be waiting again - by then it has reloaded
+	tick := func() {
+		clk.BlockUntil(1)
+		clk.Advance(5 * time.Second)
+		clk.BlockUntil(1)
+	}
+	on := func() bool { return f.Snapshot()["dark-mode"].Enabled }
+
+	old := f.Snapshot()
+	writeFile(t, path, "dark-mode:\n  enabled: true\n")
+	assert.False(t, on(), "nothing changes between polls")
+	tick()
+	assert.True(t, on())
+	assert.False(t, old["dark-mode"].Enabled, "a reload doesn't change a snapshot already taken")
+	assert.Contains(t, logs.String(), "reloaded 1 flags")
+
+	// a broken file keeps the last good flags, and says so once rather
+	// than every poll until it's fixed
+	complaints := func() int { return strings.Count(logs.String(), "keeping the last good flags") }
+	writeFile(t, path, "dark-mode:\n  enabled: maybe\n")
+	tick()
+	tick()
+	assert.True(t, on())
+	assert.Equal(t, 1, complaints())
+
+	// broken differently is worth saying again
+	writeFile(t, path, "dark-mode:\n  enabled: perhaps\n")
+	tick()
+	assert.Equal(t, 2, complaints())
+
+	require.NoError(t, os.Remove(path))
+	tick()
+	tick()
+	assert.True(t, on())
+	assert.Equal(t, 3, complaints())
+
+	// and the fixed file is picked up again
+	writeFile(t, path, "dark-mode:\n  enabled: false\n")
+	tick()
+	assert.False(t, on())
+}
@@ -0,0 +1,165 @@
+// Package flags turns features on and off without a deploy. A flag is
+// either on or off for everyone, or rolled out to a percentage of users:
+// each user is put in a bucket from 0 to 9999 by hashing their ID with the
+// flag's name, and sees the feature if their bucket is under the rollout.
+// The hash means a user gets the same answer on every request and every
+// instance, raising the percentage only ever adds users, and being in the
+// first 10% of one flag says nothing about another.
+//
+// Flags come from a Provider - a fixed Set, or a File that reloads itself
+// when it changes - and Middleware puts them in each request's context
+// along with the user, for handlers to ask with Enabled
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+)
+
+// Flag is one feature's setting
+type Flag struct {
+	// Enabled false turns the feature off for everyone, whatever Rollout says
+	Enabled bool `yaml:"enabled"`
+	// Rollout is the percentage of users who see it, 0 to 100 with up to
+	// two decimal places. nil is everyone
+	Rollout *float64 `yaml:"rollout"`
+}
+
+// Validate checks the rollout is a percentage
+func (f Flag) Validate() error {
+	if f.Rollout != nil && (*f.Rollout < 0 || *f.Rollout > 100) {
+		return fmt.Errorf("rollout must be between 0 and 100, got %v", *f.Rollout)
+	}
+	return nil
+}
+
+// buckets is how finely a rollout can be set, 10000 is steps of 0.01%
+const buckets = 10000
+
+// Bucket is where userID falls for the named flag, 0 to 9999. It's
+// exported so a support tool can say why someone does or doesn't see a
+// feature
+func Bucket(name, userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0}) // so "ab"+"c" and "a"+"bc" hash differently
+	h.Write([]byte(userID))
+	return int(h.Sum32() % buckets)
+}
+
+// On reports whether the flag is on for userID. A partial rollout is off
+// for an anonymous user, "" - there's nothing to bucket them by, and a
+// feature flickering on and off between their requests is worse than not
+// seeing it
+func (f Flag) On(name, userID string) bool {
+	switch {
+	case !f.Enabled:
+		return false
+	case f.Rollout == nil || *f.Rollout >= 100:
+		return true
+	case userID == "":
+		return false
+	}
+	return float64(Bucket(name, userID)) < *f.Rollout*buckets/100
+}
+
+// Set is every flag by name. A flag that isn't in the set is off
+type Set map[string]Flag
+
+// Validate reports the first bad flag, by name
+func (s Set) Validate() error {
+	for _, name := range s.names() {
+		if name == "" {
+			return errors.New("a flag has no name")
+		}
+		if err := s[name].Validate(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s Set) names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Snapshot lets a fixed Set be a Provider
+func (s Set) Snapshot() Set { return s }
+
+// Provider hands out the current flags. The Set it returns must not be
+// changed afterwards, a reload makes a new one
+type Provider interface {
+	Snapshot() Set
+}
+
+/*
+ *
+ * per request
+ *
+ */
+
+type userKey struct{}
+type setKey struct{}
+
+// WithUser records the user flags are evaluated for
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserFrom returns the user set by WithUser, "" if there isn't one
+func UserFrom(ctx context.Context) string {
+	id, _ := ctx.Value(userKey{}).(string)
+	return id
+}
+
+// WithSet puts flags in ctx, Middleware does it for each request
+func WithSet(ctx context.Context, s Set) context.Context {
+	return context.WithValue(ctx, setKey{}, s)
+}
+
+// Enabled reports whether the named flag is on for the context's user.
+// With no flags in the context everything is off, so a handler called
+// outside the middleware gets the old behaviour rather than a half-launched
+// feature
+func Enabled(ctx context.Context, name string) bool {
+	s, _ := ctx.Value(setKey{}).(Set)
+	f, ok := s[name]
+	return ok && f.On(name, UserFrom(ctx))
+}
+
+// All evaluates every flag for the context's user, for a handler to send
+// to a frontend that needs to know too
+func All(ctx context.Context) map[string]bool {
+	s, _ := ctx.Value(setKey{}).(Set)
+	user := UserFrom(ctx)
+	all := make(map[string]bool, len(s))
+	for name, f := range s {
+		all[name] = f.On(name, user)
+	}
+	return all
+}
+
+// Middleware takes one snapshot of the flags per request, so a reload
+// halfway through can't show a user half of a feature, and records the
+// user that user returns - from a session, or a header set by whatever
+// authenticated the request
+func Middleware(p Provider, user func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithSet(r.Context(), p.Snapshot())
+			if id := user(r); id != "" {
+				ctx = WithUser(ctx, id)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package flags
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rollout(pct float64) *float64 { return &pct }
+
+func users(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("user-%d", i)
+	}
+	return ids
+}
+
+func TestBucketIsDeterministic(t *testing.T) {
+	// pinned, so a change to the hash - which would reshuffle who sees
+	// every rolled out feature - fails here first
+	assert.Equal(t, 5649, Bucket("new-checkout", "user-1"))
+	assert.Equal(t, 5784, Bucket("dark-mode", "user-1"))
+
+	for _, id := range users(1000) {
+		b := Bucket("new-checkout", id)
+		require.GreaterOrEqual(t, b, 0)
+		require.Less(t, b, buckets)
+	}
+}
+
+func TestRollout(t *testing.T) {
+	ids := users(10000)
+	count := func(name string, f Flag) int {
+		n := 0
+		for _, id := range ids {
+			if f.On(name, id) {
+				n++
+			}
+		}
+		return n
+	}
+
+	for _, pct := range []float64{1, 10, 25, 50, 90} {
+		got := float64(count("new-checkout", Flag{Enabled: true, Rollout: rollout(pct)}))
+		assert.InDelta(t, pct/100*float64(len(ids)), got, 0.02*float64(len(ids)), "%v%%", pct)
+	}
+	assert.Equal(t, 0, count("f", Flag{Enabled: true, Rollout: rollout(0)}))
+	assert.Equal(t, len(ids), count("f", Flag{Enabled: true, Rollout: rollout(100)}))
+	assert.Equal(t, len(ids), count("f", Flag{Enabled: true}))
+	assert.Equal(t, 0, count("f", Flag{Enabled: false}), "off beats rollout")
+	assert.Equal(t, 0, count("f", Flag{Enabled: false, Rollout: rollout(100)}))
+
+	t.Run("raising the rollout only adds users", func(t *testing.T) {
+		for _, id := range ids {
+			at10 := Flag{Enabled: true, Rollout: rollout(10)}.On("f", id)
+			at20 := Flag{Enabled: true, Rollout: rollout(20)}.On("f", id)
+			require.False(t, at10 && !at20, id)
+		}
+	})
+
+	t.Run("flags bucket independently", func(t *testing.T) {
+		half := Flag{Enabled: true, Rollout: rollout(50)}
+		both := 0
+		for _, id := range ids {
+			if half.On("a", id) && half.On("b", id) {
+				both++
+			}
+		}
+		// independent halves overlap on about a quarter, the same hash
+		// for both would be a half
+		assert.InDelta(t, len(ids)/4, both, 0.02*float64(len(ids)))
+	})
+
+	t.Run("anonymous users only see features on for everyone", func(t *testing.T) {
+		assert.False(t, Flag{Enabled: true, Rollout: rollout(99)}.On("f", ""))
+		assert.True(t, Flag{Enabled: true}.On("f", ""))
+	})
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Set{"a": {Enabled: true, Rollout: rollout(12.5)}}.Validate())
+	assert.EqualError(t, Set{"a": {Rollout: rollout(101)}}.Validate(), "a: rollout must be between 0 and 100, got 101")
+	assert.Error(t, Set{"a": {Rollout: rollout(-1)}}.Validate())
+	assert.Error(t, Set{"": {}}.Validate())
+}
+
+func TestMiddleware(t *testing.T) {
+	set := Set{
+		"everyone": {Enabled: true},
+		"nobody":   {Enabled: false},
+		"some":     {Enabled: true, Rollout: rollout(50)},
+	}
+	h := Middleware(set, func(r *http.Request) string { return r.Header.Get("X-User") })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %v %v", UserFrom(r.Context()), Enabled(r.Context(), "everyone"), All(r.Context()))
+		}))
+
+	get := func(user string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		b, _ := io.ReadAll(rec.Body)
+		return string(b)
+	}
+
+	// find one user either side of the 50% line
+	var in, out string
+	for _, id := range users(100) {
+		if set["some"].On("some", id) {
+			in = id
+		} else {
+			out = id
+		}
+	}
+	require.NotEmpty(t, in)
+	require.NotEmpty(t, out)
+
+	assert.Equal(t, in+" true map[everyone:true nobody:false some:true]", get(in))
+	assert.Equal(t, out+" true map[everyone:true nobody:false some:false]", get(out))
+	assert.Equal(t, " true map[everyone:true nobody:false some:false]", get(""))
+}
+
+func TestEnabledOutsideMiddleware(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.False(t, Enabled(req.Context(), "anything"))
+	assert.Empty(t, All(req.Context()))
+}
@@ -0,0 +1,145 @@
+// Package golden compares test output against files in testdata, so a test
+// of something with a lot of output - a rendered page, an API response, a
+// report - is one line, and a change to that output shows up as a diff in
+// review:
+//
+//	golden.Assert(t, rendered, "form.golden")
+//
+// compares rendered with testdata/form.golden. When the output is meant to
+// change, run the tests with -update to rewrite the files, and read the
+// diff before committing it:
+//
+//	go test ./pkg/csrf -run Golden -update
+//
+// JSON() compares JSON by content instead of bytes, and Scrub hides the
+// parts of the output that are different every run
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// update is -update. Registering it here means a test binary gets it by
+// importing the package, and no test declares its own
+var update = flag.Bool("update", false, "rewrite golden files in testdata instead of comparing against them")
+
+type options struct {
+	json   bool
+	scrubs []scrub
+}
+
+type scrub struct {
+	re   *regexp.Regexp
+	with []byte
+}
+
+// Option changes how Assert compares
+type Option func(*options)
+
+// JSON normalizes got and the golden file before comparing them: indented
+// two spaces, object keys sorted, numbers as they were written. Formatting
+// and key order stop mattering, and the file is readable
+func JSON() Option {
+	return func(o *options) { o.json = true }
+}
+
+// Scrub replaces every match of re in got with with, as regexp.ReplaceAll
+// does, before anything else - for tokens, timestamps and IDs that change
+// every run. The golden file holds the replacement
+func Scrub(re *regexp.Regexp, with string) Option {
+	return func(o *options) { o.scrubs = append(o.scrubs, scrub{re, []byte(with)}) }
+}
+
+// Assert fails t unless got matches testdata/name, printing a diff when it
+// doesn't. With -update it writes got to the file instead, creating it and
+// testdata as needed
+func Assert(t testing.TB, got []byte, name string, opts ...Option) {
+	t.Helper()
+
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, s := range o.scrubs {
+		got = s.re.ReplaceAll(got, s.with)
+	}
+	if o.json {
+		var err error
+		if got, err = normalizeJSON(got); err != nil {
+			t.Fatalf("golden: %s: got isn't JSON: %v", name, err)
+			return
+		}
+	}
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("golden: %v", err)
+			return
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("golden: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden: %v - run the test with -update to create it", err)
+		return
+	}
+	if o.json {
+		// the file is normally written normalized already, but one edited
+		// by hand needn't be
+		if want, err = normalizeJSON(want); err != nil {
+			t.Fatalf("golden: %s isn't JSON: %v", path, err)
+			return
+		}
+	}
+
+	if !bytes.Equal(want, got) {
+		t.Errorf("golden: output differs from %s (-want +got):\n%s\nrun the test with -update if the change is intended",
+			path, cmp.Diff(lines(want), lines(got)))
+	}
+}
+
+// lines splits b for diffing. go-cmp diffs a slice element by element,
+// which for lines is what a reader wants: only the lines that changed,
+// with runs of unchanged ones elided
+func lines(b []byte) []string {
+	return strings.Split(string(b), "\n")
+}
+
+// normalizeJSON re-encodes b through the generic form. Maps encode with
+// their keys sorted, json.Number keeps each number's digits as they were,
+// and escaping HTML would only make the file harder to read
+func normalizeJSON(b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("more than one value")
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
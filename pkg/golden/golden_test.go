@@ -0,0 +1,135 @@
+package golden
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests check what -update does, so they mustn't be subject to it:
+// go test ./... -update would otherwise write their mistakes into the
+// fixtures they compare against
+func TestMain(m *testing.M) {
+	flag.Parse()
+	*update = false
+	os.Exit(m.Run())
+}
+
+// fakeTB records failures instead of failing the real test
+type fakeTB struct {
+	testing.TB
+	errors, fatals []string
+}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Fatalf(format string, args ...any) {
+	f.fatals = append(f.fatals, fmt.Sprintf(format, args...))
+}
+
+func TestMatch(t *testing.T) {
+	fake := &fakeTB{TB: t}
+	Assert(fake, []byte("line one\nline two\n"), "plain.golden")
+	assert.Empty(t, fake.errors)
+	assert.Empty(t, fake.fatals)
+}
+
+func TestMismatch(t *testing.T) {
+	fake := &fakeTB{TB: t}
+	Assert(fake, []byte("line one\nline 2\n"), "plain.golden")
+	require.Len(t, fake.errors, 1)
+
+	msg := fake.errors[0]
+	assert.Contains(t, msg, filepath.Join("testdata", "plain.golden"))
+	assert.Contains(t, msg, "-update")
+	// go-cmp's layout isn't stable, so only the lines that changed
+	assert.Regexp(t, `-.*line two`, msg)
+	assert.Regexp(t, `\+.*line 2`, msg)
+	assert.NotRegexp(t, `[-+].*line one`, msg)
+}
+
+func TestMissing(t *testing.T) {
+	fake := &fakeTB{TB: t}
+	Assert(fake, []byte("x"), "nope.golden")
+	require.Len(t, fake.fatals, 1)
+	assert.Contains(t, fake.fatals[0], "run the test with -update to create it")
+}
+
+func TestUpdate(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	*update = true
+	t.Cleanup(func() {
+		*update = false
+		os.Chdir(wd)
+	})
+
+	// the directories are made as needed, and nothing is compared
+	fake := &fakeTB{TB: t}
+	Assert(fake, []byte(`{"b":1,"a":2}`), "sub/new.golden", JSON())
+	assert.Empty(t, fake.errors)
+	assert.Empty(t, fake.fatals)
+
+	b, err := os.ReadFile(filepath.Join("testdata", "sub", "new.golden"))
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  \"a\": 2,\n  \"b\": 1\n}\n", string(b), "written normalized")
+
+	*update = false
+	Assert(fake, []byte(`{"a":2,"b":1}`), "sub/new.golden", JSON())
+	assert.Empty(t, fake.errors)
+}
+
+func TestJSON(t *testing.T) {
+	// doc.golden is written by hand, in another order and layout
+	fake := &fakeTB{TB: t}
+	Assert(fake, []byte(`{"html":"<b>","a":{"y":null,"z":true},"b":[1.0,2]}`), "doc.golden", JSON())
+	assert.Empty(t, fake.errors)
+
+	// numbers are compared as written: 1 isn't 1.0
+	Assert(fake, []byte(`{"html":"<b>","a":{"y":null,"z":true},"b":[1,2]}`), "doc.golden", JSON())
+	require.Len(t, fake.errors, 1)
+	assert.Regexp(t, `\+.*1,`, fake.errors[0])
+
+	// without JSON() it's bytes
+	fake = &fakeTB{TB: t}
+	Assert(fake, []byte(`{"html":"<b>","a":{"y":null,"z":true},"b":[1.0,2]}`), "doc.golden")
+	assert.Len(t, fake.errors, 1)
+}
+
+func TestNotJSON(t *testing.T) {
+	for _, got := range []string{`{"a":`, `{} {}`, `<html>`} {
+		fake := &fakeTB{TB: t}
+		Assert(fake, []byte(got), "doc.golden", JSON())
+		require.Len(t, fake.fatals, 1, got)
+		assert.Contains(t, fake.fatals[0], "got isn't JSON", got)
+	}
+
+	fake := &fakeTB{TB: t}
+	Assert(fake, []byte(`{}`), "plain.golden", JSON())
+	require.Len(t, fake.fatals, 1)
+	assert.Contains(t, fake.fatals[0], "plain.golden isn't JSON")
+}
+
+func TestScrub(t *testing.T) {
+	token := regexp.MustCompile(`value="[^"]*"`)
+	for _, got := range []string{`<input value="abc123">`, `<input value="zzz">`} {
+		fake := &fakeTB{TB: t}
+		Assert(fake, []byte(got+"\n"), "scrubbed.golden", Scrub(token, `value="TOKEN"`))
+		assert.Empty(t, fake.errors, got)
+	}
+
+	// scrubbing happens before normalizing, so it works on JSON as written
+	fake := &fakeTB{TB: t}
+	Assert(fake, []byte(`{"a":{"y":null,"z":true},"b":[1.0,2],"html":"<i>"}`), "doc.golden",
+		JSON(), Scrub(regexp.MustCompile(`<i>`), `<b>`))
+	assert.Empty(t, fake.errors)
+}
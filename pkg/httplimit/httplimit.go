@@ -0,0 +1,104 @@
+// Package httplimit has middleware that puts upper bounds on what a client
+// can make the server read, and how often
+package httplimit
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/ip"
+)
+
+// MaxBytes limits request bodies to n bytes.
+//
+// Requests that declare a bigger Content-Length are rejected with a 413 before
+// the handler runs. Bodies without a length (chunked) can only be caught while
+// reading, so the body is wrapped with http.MaxBytesReader - reads past n fail
+// with *http.MaxBytesError, and the server closes the connection afterwards
+// instead of draining the rest. Handlers should check for it with IsTooLarge
+func MaxBytes(n int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsTooLarge reports whether err came from reading past a MaxBytes limit
+func IsTooLarge(err error) bool {
+	var mbe *http.MaxBytesError
+	return errors.As(err, &mbe)
+}
+
+// MaxHeaders rejects requests with more than count header values, or whose
+// header names and values add up to more than size bytes, with a 431.
+//
+// http.Server.MaxHeaderBytes is the real defence, it stops reading the
+// request before the headers are even parsed, but it's one limit for the whole
+// server. This lets a group of routes be stricter than the rest
+func MaxHeaders(count, size int) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, bytes := 0, 0
+			for name, values := range r.Header {
+				for _, v := range values {
+					n++
+					bytes += len(name) + len(v)
+				}
+			}
+
+			if n > count || bytes > size {
+				http.Error(w, http.StatusText(http.StatusRequestHeaderFieldsTooLarge), http.StatusRequestHeaderFieldsTooLarge)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Limiter decides whether the client identified by key may make another
+// request now, and if not, how long until it may. concepts/ratelimit has
+// token bucket and sliding window implementations
+type Limiter interface {
+	Allow(key string) (ok bool, retryAfter time.Duration)
+}
+
+// RateLimit turns away requests l doesn't allow with a 429 and a Retry-After
+// header, rounded up to whole seconds as the header requires. key picks who
+// is being limited; ClientIP is the usual choice
+func RateLimit(l Limiter, key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, retryAfter := l.Allow(key(r))
+			if !ok {
+				secs := int(math.Ceil(retryAfter.Seconds()))
+				if secs < 1 {
+					secs = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(secs))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP keys requests by the client's address. Behind a proxy or load
+// balancer the connection is from the proxy, and every client would share
+// one limit - put pkg/ip's RealIP in front, and this uses the address
+// it found instead
+func ClientIP(r *http.Request) string {
+	return ip.ClientIP(r)
+}
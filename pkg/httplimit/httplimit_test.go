@@ -0,0 +1,160 @@
+package httplimit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/pkg/ip"
+)
+
+// echo reads the whole body and writes back its length
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	b, err := io.ReadAll(r.Body)
+	if IsTooLarge(err) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.Write([]byte(strconv.Itoa(len(b))))
+})
+
+func TestMaxBytes(t *testing.T) {
+	h := MaxBytes(10)(echo)
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"under the limit", "hello", false, http.StatusOK},
+		{"exactly the limit", "0123456789", false, http.StatusOK},
+		{"declared too large", "0123456789a", false, http.StatusRequestEntityTooLarge},
+		{"chunked too large", strings.Repeat("a", 100), true, http.StatusRequestEntityTooLarge},
+		{"chunked under the limit", "hello", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestMaxBytesOverTheWire(t *testing.T) {
+	srv := httptest.NewServer(MaxBytes(1024)(echo))
+	defer srv.Close()
+
+	// io.MultiReader hides the length, so the client sends it chunked
+	body := io.MultiReader(strings.NewReader(strings.Repeat("a", 1<<20)))
+	resp, err := http.Post(srv.URL, "text/plain", body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestMaxHeaders(t *testing.T) {
+	h := MaxHeaders(3, 64)(echo)
+
+	tests := []struct {
+		name    string
+		headers map[string][]string
+		want    int
+	}{
+		{"few small headers", map[string][]string{"A": {"1"}, "B": {"2"}}, http.StatusOK},
+		{"too many values", map[string][]string{"A": {"1", "2"}, "B": {"3", "4"}}, http.StatusRequestHeaderFieldsTooLarge},
+		{"too many bytes", map[string][]string{"A": {strings.Repeat("x", 64)}}, http.StatusRequestHeaderFieldsTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header = tt.headers
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+// allowFirst lets each key through n times
+type allowFirst struct {
+	n    int
+	seen map[string]int
+}
+
+func (a *allowFirst) Allow(key string) (bool, time.Duration) {
+	a.seen[key]++
+	if a.seen[key] > a.n {
+		return false, 1500 * time.Millisecond
+	}
+	return true, 0
+}
+
+func TestRateLimit(t *testing.T) {
+	lim := &allowFirst{n: 2, seen: map[string]int{}}
+	h := RateLimit(lim, ClientIP)(echo)
+
+	request := func(addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("10.0.0.1:1000").Code)
+	assert.Equal(t, http.StatusOK, request("10.0.0.1:2000").Code, "same client, different port")
+
+	w := request("10.0.0.1:3000")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"), "rounded up")
+
+	assert.Equal(t, http.StatusOK, request("10.0.0.2:1000").Code, "other clients have their own limit")
+	assert.Equal(t, 3, lim.seen["10.0.0.1"], "keyed by host only")
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "[::1]:8080"
+	assert.Equal(t, "::1", ClientIP(r))
+
+	r.RemoteAddr = "not an address"
+	assert.Equal(t, "not an address", ClientIP(r))
+}
+
+func TestRateLimitBehindProxy(t *testing.T) {
+	trusted, err := ip.ParseTrusted("10.0.0.0/8")
+	assert.NoError(t, err)
+	lim := &allowFirst{n: 1, seen: map[string]int{}}
+	h := ip.RealIP(trusted, ip.XForwardedFor)(RateLimit(lim, ClientIP)(echo))
+
+	request := func(xff string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1000"
+		r.Header.Set("X-Forwarded-For", xff)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("203.0.113.7"))
+	assert.Equal(t, http.StatusOK, request("203.0.113.8"), "not every client behind the proxy shares one limit")
+	assert.Equal(t, http.StatusTooManyRequests, request("1.2.3.4, 203.0.113.7"), "a forged entry doesn't buy a fresh one")
+	assert.Zero(t, lim.seen["10.0.0.1"])
+}
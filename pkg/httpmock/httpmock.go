@@ -0,0 +1,209 @@
+// Package httpmock builds fake HTTP servers for client tests out of canned
+// responses, instead of every test writing its own httptest handler
+package httpmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server is an httptest.Server that answers with the stubs registered with On.
+// Requests no stub matches fail the test
+type Server struct {
+	*httptest.Server
+	t testing.TB
+
+	mu    sync.Mutex
+	stubs []*Stub
+	calls []Call
+}
+
+// Call is a request the server received
+type Call struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// New starts a server that's closed when the test finishes
+func New(t testing.TB) *Server {
+	s := &Server{t: t}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// On registers a stub for method and path. An empty method matches any.
+// When several stubs match a request, the first one that hasn't used up its
+// Times wins, so a sequence of responses is set up by registering in order:
+//
+//	srv.On("GET", "/todos").Status(503).Times(2)
+//	srv.On("GET", "/todos").JSON(todos)
+func (s *Server) On(method, path string) *Stub {
+	st := &Stub{method: method, path: path, status: http.StatusOK, header: http.Header{}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stubs = append(s.stubs, st)
+
+	return st
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	st := s.match(r)
+	s.mu.Unlock()
+
+	if st == nil {
+		s.t.Errorf("httpmock: unexpected request %s %s", r.Method, r.URL.Path)
+		http.Error(w, "httpmock: no stub for request", http.StatusNotImplemented)
+		return
+	}
+
+	st.serve(w, r)
+}
+
+// match must be called with s.mu held
+func (s *Server) match(r *http.Request) *Stub {
+	for _, st := range s.stubs {
+		if st.path != r.URL.Path || (st.method != "" && st.method != r.Method) {
+			continue
+		}
+		if st.times > 0 && st.hits >= st.times {
+			continue
+		}
+		st.hits++
+		return st
+	}
+
+	return nil
+}
+
+// Calls returns every request received so far
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// CallCount is the number of requests received for method and path
+func (s *Server) CallCount(method, path string) int {
+	n := 0
+	for _, c := range s.Calls() {
+		if c.Method == method && c.Path == path {
+			n++
+		}
+	}
+
+	return n
+}
+
+// AssertCalled fails the test unless method and path were requested exactly n times
+func (s *Server) AssertCalled(method, path string, n int) bool {
+	s.t.Helper()
+
+	if got := s.CallCount(method, path); got != n {
+		s.t.Errorf("httpmock: %s %s called %d times, want %d", method, path, got, n)
+		return false
+	}
+
+	return true
+}
+
+// Stub is a canned response. Its methods return the stub so they can be chained
+type Stub struct {
+	method, path string
+
+	status  int
+	header  http.Header
+	body    []byte
+	latency time.Duration
+	drop    bool
+	times   int
+	hits    int
+}
+
+func (st *Stub) Status(code int) *Stub {
+	st.status = code
+	return st
+}
+
+func (st *Stub) Header(key, value string) *Stub {
+	st.header.Add(key, value)
+	return st
+}
+
+func (st *Stub) Body(body string) *Stub {
+	st.body = []byte(body)
+	return st
+}
+
+// JSON sets the body to v encoded as JSON, and the matching Content-Type
+func (st *Stub) JSON(v interface{}) *Stub {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("httpmock: encoding stub body: %v", err))
+	}
+
+	st.body = b
+	st.header.Set("Content-Type", "application/json")
+	return st
+}
+
+// Latency delays the response by d, or until the client gives up
+func (st *Stub) Latency(d time.Duration) *Stub {
+	st.latency = d
+	return st
+}
+
+// Drop closes the connection without sending a response, so the client sees
+// a transport error rather than a status code
+func (st *Stub) Drop() *Stub {
+	st.drop = true
+	return st
+}
+
+// Times limits how many requests this stub answers, after which the next
+// matching stub takes over. Zero means no limit
+func (st *Stub) Times(n int) *Stub {
+	st.times = n
+	return st
+}
+
+func (st *Stub) serve(w http.ResponseWriter, r *http.Request) {
+	if st.latency > 0 {
+		select {
+		case <-time.After(st.latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if st.drop {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	for k, v := range st.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(st.status)
+	w.Write(st.body)
+}
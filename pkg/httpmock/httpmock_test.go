@@ -0,0 +1,102 @@
+package httpmock
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, c *http.Client, url string) (*http.Response, string) {
+	resp, err := c.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(b)
+}
+
+func TestCannedResponse(t *testing.T) {
+	srv := New(t)
+	srv.On(http.MethodGet, "/todos/1").
+		Header("X-Request-Id", "abc").
+		JSON(map[string]interface{}{"id": 1, "title": "mock things"})
+
+	resp, body := get(t, srv.Client(), srv.URL+"/todos/1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "abc", resp.Header.Get("X-Request-Id"))
+	assert.JSONEq(t, `{"id":1,"title":"mock things"}`, body)
+	srv.AssertCalled(http.MethodGet, "/todos/1", 1)
+}
+
+func TestSequence(t *testing.T) {
+	srv := New(t)
+	srv.On(http.MethodGet, "/flaky").Status(http.StatusServiceUnavailable).Times(2)
+	srv.On(http.MethodGet, "/flaky").Body("finally")
+
+	var codes []int
+	for i := 0; i < 4; i++ {
+		resp, _ := get(t, srv.Client(), srv.URL+"/flaky")
+		codes = append(codes, resp.StatusCode)
+	}
+
+	assert.Equal(t, []int{503, 503, 200, 200}, codes)
+	assert.Equal(t, 4, srv.CallCount(http.MethodGet, "/flaky"))
+}
+
+func TestRecordsCalls(t *testing.T) {
+	srv := New(t)
+	srv.On(http.MethodPost, "/todos").Status(http.StatusCreated)
+
+	resp, err := srv.Client().Post(srv.URL+"/todos", "text/plain", strings.NewReader("buy milk"))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	calls := srv.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "buy milk", string(calls[0].Body))
+	assert.Equal(t, "text/plain", calls[0].Header.Get("Content-Type"))
+}
+
+func TestDrop(t *testing.T) {
+	srv := New(t)
+	srv.On("", "/broken").Drop()
+
+	_, err := srv.Client().Get(srv.URL + "/broken")
+	assert.Error(t, err)
+}
+
+func TestLatency(t *testing.T) {
+	srv := New(t)
+	srv.On(http.MethodGet, "/slow").Latency(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/slow", nil)
+
+	_, err := srv.Client().Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestUnexpectedRequestFails(t *testing.T) {
+	fake := &fakeTB{TB: t}
+	srv := New(fake)
+
+	resp, _ := get(t, srv.Client(), srv.URL+"/nope")
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	assert.True(t, fake.failed)
+}
+
+// fakeTB records Errorf instead of failing the real test
+type fakeTB struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fakeTB) Errorf(string, ...interface{}) { f.failed = true }
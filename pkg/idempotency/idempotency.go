@@ -0,0 +1,145 @@
+// Package idempotency makes retried POSTs safe. A client sends the same
+// Idempotency-Key header with every attempt of one logical request, and only
+// the first attempt reaches the handler - the rest get its stored response
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+)
+
+// Header is the request header carrying the key
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses that came from the store rather than
+// the handler
+const ReplayedHeader = "Idempotent-Replayed"
+
+// Response is everything needed to write a response again
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store keeps responses by key. Implementations must be safe for concurrent use
+type Store interface {
+	// Get returns the response stored under key, if any
+	Get(ctx context.Context, key string) (*Response, bool, error)
+	// Lock claims key for a request in flight. It returns false if the key is
+	// already claimed
+	Lock(ctx context.Context, key string) (bool, error)
+	// Put stores the response for key and releases the lock
+	Put(ctx context.Context, key string, resp *Response) error
+	// Unlock releases the lock without storing anything, so the request can be
+	// tried again
+	Unlock(ctx context.Context, key string) error
+}
+
+// Middleware replays stored responses for POST requests carrying an
+// Idempotency-Key. A duplicate arriving while the original is still being
+// handled gets a 409, the client should retry it later.
+//
+// Server errors aren't stored, so a request that failed on our side can be
+// retried with the same key. Neither are panics: the key is unlocked on the
+// way out, and the panic carries on up to net/http
+func Middleware(store Store) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" || r.Method != http.MethodPost {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			if resp, ok, err := store.Get(ctx, key); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			} else if ok {
+				replay(w, resp)
+				return
+			}
+
+			locked, err := store.Lock(ctx, key)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if !locked {
+				// the original may have finished between Get and Lock, in which
+				// case there's a response to replay rather than a conflict
+				if resp, ok, err := store.Get(ctx, key); err == nil && ok {
+					replay(w, resp)
+					return
+				}
+				http.Error(w, "a request with this Idempotency-Key is already in progress", http.StatusConflict)
+				return
+			}
+
+			// the request context may already be cancelled by the time we're
+			// done, but the store still needs updating or the key stays locked
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			returned := false
+			defer func() {
+				if !returned {
+					store.Unlock(context.Background(), key)
+				}
+			}()
+			h.ServeHTTP(rec, r)
+			returned = true
+
+			if rec.status >= http.StatusInternalServerError {
+				store.Unlock(context.Background(), key)
+				return
+			}
+			store.Put(context.Background(), key, rec.response())
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, resp *Response) {
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// recorder passes everything through to the real ResponseWriter, keeping a
+// copy of the status, headers and body on the way
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+	// headers can't change once they're written, so this is what the client saw
+	r.header = r.ResponseWriter.Header().Clone()
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) response() *Response {
+	if !r.wroteHeader {
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	return &Response{Status: r.status, Header: r.header, Body: r.body.Bytes()}
+}
@@ -0,0 +1,205 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// counter creates a "resource" per call, so replays are easy to spot
+type counter struct {
+	calls  int32
+	status int
+	block  chan struct{}
+}
+
+func (c *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := atomic.AddInt32(&c.calls, 1)
+	if c.block != nil {
+		<-c.block
+	}
+	w.Header().Set("Location", fmt.Sprintf("/todos/%d", n))
+	status := c.status
+	if status == 0 {
+		status = http.StatusCreated
+	}
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "todo %d", n)
+}
+
+func post(h http.Handler, key string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/todos", nil)
+	if key != "" {
+		r.Header.Set(Header, key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func newTestHandler(t *testing.T, h http.Handler) (http.Handler, *clock.Fake) {
+	clk := clock.NewFake(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore(time.Hour, clk)
+	t.Cleanup(store.Close)
+	return Middleware(store)(h), clk
+}
+
+func TestReplay(t *testing.T) {
+	c := &counter{}
+	h, _ := newTestHandler(t, c)
+
+	first := post(h, "abc")
+	second := post(h, "abc")
+
+	assert.Equal(t, int32(1), c.calls)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "/todos/1", second.Header().Get("Location"))
+	assert.Equal(t, "true", second.Header().Get(ReplayedHeader))
+	assert.Empty(t, first.Header().Get(ReplayedHeader))
+
+	// a different key is a different request
+	assert.Equal(t, "todo 2", post(h, "def").Body.String())
+}
+
+func TestNoKeyPassesThrough(t *testing.T) {
+	c := &counter{}
+	h, _ := newTestHandler(t, c)
+
+	post(h, "")
+	post(h, "")
+	assert.Equal(t, int32(2), c.calls)
+}
+
+func TestServerErrorsAreNotStored(t *testing.T) {
+	c := &counter{status: http.StatusServiceUnavailable}
+	h, _ := newTestHandler(t, c)
+
+	post(h, "abc")
+	c.status = 0
+	w := post(h, "abc")
+
+	assert.Equal(t, int32(2), c.calls)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestKeysExpire(t *testing.T) {
+	c := &counter{}
+	h, clk := newTestHandler(t, c)
+
+	post(h, "abc")
+	clk.Advance(time.Hour)
+	post(h, "abc")
+
+	assert.Equal(t, int32(2), c.calls)
+}
+
+func TestConcurrentDuplicates(t *testing.T) {
+	c := &counter{block: make(chan struct{})}
+	h, _ := newTestHandler(t, c)
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- post(h, "abc") }()
+
+	// wait until the first request is inside the handler
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&c.calls) == 1 }, time.Second, time.Millisecond)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = post(h, "abc").Code
+		}(i)
+	}
+	wg.Wait()
+	for _, code := range codes {
+		assert.Equal(t, http.StatusConflict, code)
+	}
+
+	close(c.block)
+	assert.Equal(t, http.StatusCreated, (<-first).Code)
+
+	// once it's done, duplicates are replayed
+	w := post(h, "abc")
+	assert.Equal(t, "true", w.Header().Get(ReplayedHeader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&c.calls))
+}
+
+func TestPanicUnlocks(t *testing.T) {
+	c := &counter{}
+	panics := true
+	h, _ := newTestHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if panics {
+			panic("boom")
+		}
+		c.ServeHTTP(w, r)
+	}))
+
+	assert.PanicsWithValue(t, "boom", func() { post(h, "abc") })
+
+	// the key wasn't left locked, so the retry runs instead of getting a 409
+	panics = false
+	w := post(h, "abc")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, int32(1), c.calls)
+}
+
+// lateStore is a Store whose Lock loses to a request that finishes in
+// between, which is what happens when a duplicate arrives just as the
+// original is done
+type lateStore struct {
+	*MemoryStore
+}
+
+func (s lateStore) Lock(ctx context.Context, key string) (bool, error) {
+	s.Put(ctx, key, &Response{Status: http.StatusCreated, Body: []byte("todo 1")})
+	return false, nil
+}
+
+func TestDuplicateAfterOriginalFinishes(t *testing.T) {
+	store := NewMemoryStore(time.Hour, clock.New())
+	t.Cleanup(store.Close)
+	c := &counter{}
+
+	w := post(Middleware(lateStore{store})(c), "abc")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "todo 1", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get(ReplayedHeader))
+	assert.Equal(t, int32(0), c.calls)
+}
+
+func TestJanitor(t *testing.T) {
+	clk := clock.NewFake(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore(time.Hour, clk)
+	t.Cleanup(store.Close)
+	ctx := context.Background()
+
+	store.Lock(ctx, "done")
+	store.Put(ctx, "done", &Response{Status: http.StatusCreated})
+	store.Lock(ctx, "in flight")
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Hour)
+
+	// nobody asks for "done" again, but it goes anyway. "in flight" has no
+	// response yet and stays locked
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		_, ok := store.entries["done"]
+		return !ok
+	}, time.Second, time.Millisecond)
+	locked, err := store.Lock(ctx, "in flight")
+	assert.NoError(t, err)
+	assert.False(t, locked)
+}
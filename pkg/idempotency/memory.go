@@ -0,0 +1,109 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// MemoryStore is a Store for a single process. Keys are forgotten ttl after
+// their response was stored: a janitor sweeps them out every ttl, so keys
+// nobody sends again don't pile up. Close stops it
+type MemoryStore struct {
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type memoryEntry struct {
+	resp    *Response // nil while the request is in flight
+	expires time.Time
+}
+
+func NewMemoryStore(ttl time.Duration, clk clock.Clock) *MemoryStore {
+	s := &MemoryStore{ttl: ttl, clock: clk, entries: map[string]memoryEntry{}, stop: make(chan struct{})}
+	go s.janitor()
+	return s
+}
+
+// Close stops the janitor goroutine. It's safe to call more than once
+func (s *MemoryStore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *MemoryStore) janitor() {
+	for {
+		select {
+		case <-s.clock.After(s.ttl):
+			s.deleteExpired()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// deleteExpired drops stored responses past their ttl. Keys still in flight
+// are left alone, their request will Put or Unlock them
+func (s *MemoryStore) deleteExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	for k, e := range s.entries {
+		if e.resp != nil && !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (*Response, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.resp == nil {
+		return nil, false, nil
+	}
+	if !s.clock.Now().Before(e.expires) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+
+	return e.resp, true, nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if ok && (e.resp == nil || s.clock.Now().Before(e.expires)) {
+		return false, nil
+	}
+
+	s.entries[key] = memoryEntry{}
+	return true, nil
+}
+
+func (s *MemoryStore) Put(_ context.Context, key string, resp *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryEntry{resp: resp, expires: s.clock.Now().Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Unlock(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
@@ -0,0 +1,231 @@
+// Package ip finds the address of the client behind a request that came
+// through proxies.
+//
+// Behind a load balancer or reverse proxy, the connection a server sees is
+// from the proxy, and the client's address arrives in a header the proxy
+// adds: X-Forwarded-For, or the standard Forwarded (RFC 7239). Each proxy
+// on the way appends the address it got the request from:
+//
+//	X-Forwarded-For: <client>, <proxy 1>, <proxy 2>
+//
+// The catch is that the client can send the header too, with anything in
+// it, and proxies append to it rather than replace it. So only the right
+// end of the list - what our own proxies wrote - can be believed. The
+// address to use is found by walking from the right, past every hop that
+// is one of our proxies: the first one that isn't is the client, or at
+// least the closest untrusted party to us. Everything to its left is
+// whatever that party chose to say.
+//
+// And the header is only looked at at all if the connection itself came
+// from a trusted proxy. A client connecting directly can write any header
+// it likes.
+//
+// Getting this wrong matters. A rate limiter keyed on a spoofable address
+// limits nobody - every request claims a fresh one - and an audit log
+// records whatever an attacker wanted it to
+package ip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Trusted is the networks our proxies are in
+type Trusted []netip.Prefix
+
+// ParseTrusted reads CIDRs - "10.0.0.0/8", "2001:db8::/32" - or single
+// addresses, which trust just that host
+func ParseTrusted(cidrs ...string) (Trusted, error) {
+	t := make(Trusted, 0, len(cidrs))
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			a, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("ip: trusted proxy %q: %w", s, err)
+			}
+			t = append(t, netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("ip: trusted proxy %q: %w", s, err)
+		}
+		t = append(t, p.Masked())
+	}
+	return t, nil
+}
+
+func (t Trusted) contains(a netip.Addr) bool {
+	for _, p := range t {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header is the header our proxies write the client's address in. It's
+// configuration, never worked out from the request: a proxy appends to the
+// header it writes and passes every other one through untouched, so if we
+// believed Forwarded whenever it was there, a client behind a proxy that
+// writes X-Forwarded-For could send its own Forwarded and be whoever it
+// liked
+type Header int
+
+const (
+	XForwardedFor Header = iota
+	Forwarded
+)
+
+// ParseHeader reads a header name, "X-Forwarded-For" or "Forwarded", in any
+// case
+func ParseHeader(s string) (Header, error) {
+	switch http.CanonicalHeaderKey(strings.TrimSpace(s)) {
+	case "X-Forwarded-For":
+		return XForwardedFor, nil
+	case "Forwarded":
+		return Forwarded, nil
+	}
+	return 0, fmt.Errorf("ip: proxy header %q: want X-Forwarded-For or Forwarded", s)
+}
+
+func (h Header) String() string {
+	if h == Forwarded {
+		return "Forwarded"
+	}
+	return "X-Forwarded-For"
+}
+
+// Resolve finds the client's address for a request that arrived from peer
+// with headers h, reading the addresses from the header from. The other
+// one is ignored
+func (t Trusted) Resolve(peer netip.Addr, h http.Header, from Header) netip.Addr {
+	peer = peer.Unmap()
+	if !t.contains(peer) {
+		return peer
+	}
+
+	var hops []string
+	if from == Forwarded {
+		hops = forwardedFor(h.Values("Forwarded"))
+	} else {
+		// several X-Forwarded-For lines are one list, in order
+		for _, line := range h.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(line, ",")...)
+		}
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, ok := parseHop(hops[i])
+		if !ok {
+			// something garbled or hidden ("unknown", "_proxy3"). Whoever
+			// wrote it is the last hop we know anything about
+			return client
+		}
+		client = a
+		if !t.contains(a) {
+			return a
+		}
+	}
+	// every hop was one of ours: the request started inside
+	return client
+}
+
+// forwardedFor pulls the for= of each element of the Forwarded headers:
+//
+//	Forwarded: for=192.0.2.60;proto=https, for="[2001:db8::17]:4711"
+func forwardedFor(lines []string) []string {
+	var hops []string
+	for _, line := range lines {
+		for _, elem := range strings.Split(line, ",") {
+			hop := "" // an element without for= is a hop we can't place
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(k, "for") {
+					hop = strings.Trim(v, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseHop reads one address, with or without a port, IPv6 with or
+// without brackets
+func parseHop(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if a, err := netip.ParseAddr(s); err == nil {
+		return a.Unmap(), true
+	}
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	if a, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")); err == nil {
+		return a.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+/*
+ *
+ * middleware
+ *
+ */
+
+type addrKey struct{}
+
+// RealIP resolves each request's client address from header from and
+// stores it in the context, for FromContext and ClientIP. r.RemoteAddr is
+// left alone - it is still the peer, which is worth having in a log next to
+// the client
+func RealIP(t Trusted, from Header) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, ok := peerAddr(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			client := t.Resolve(peer, r.Header, from)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), addrKey{}, client)))
+		})
+	}
+}
+
+func peerAddr(r *http.Request) (netip.Addr, bool) {
+	if ap, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	// RemoteAddr has no port in some tests and unusual listeners
+	a, err := netip.ParseAddr(r.RemoteAddr)
+	return a.Unmap(), err == nil
+}
+
+// FromContext is the client address RealIP found
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	a, ok := ctx.Value(addrKey{}).(netip.Addr)
+	return a, ok
+}
+
+// ClientIP is the client's address as a string: RealIP's answer if it ran,
+// or else the connection's address. It fits httplimit.RateLimit as a key
+func ClientIP(r *http.Request) string {
+	if a, ok := FromContext(r.Context()); ok {
+		return a.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
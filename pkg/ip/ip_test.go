@@ -0,0 +1,252 @@
+package ip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func trusted(t *testing.T) Trusted {
+	t.Helper()
+	tr, err := ParseTrusted("10.0.0.0/8", "192.168.1.1", "fd00::/8")
+	require.NoError(t, err)
+	return tr
+}
+
+func TestParseTrusted(t *testing.T) {
+	tr := trusted(t)
+	assert.Equal(t, Trusted{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.1/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	}, tr)
+
+	tr, err := ParseTrusted("10.1.2.3/8", " ", "::ffff:172.16.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, Trusted{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("172.16.0.1/32")}, tr)
+
+	for _, bad := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0"} {
+		_, err := ParseTrusted(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	for in, want := range map[string]Header{
+		"X-Forwarded-For": XForwardedFor,
+		"x-forwarded-for": XForwardedFor,
+		"Forwarded":       Forwarded,
+		" forwarded ":     Forwarded,
+	} {
+		got, err := ParseHeader(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+		assert.Equal(t, http.CanonicalHeaderKey(strings.TrimSpace(in)), got.String())
+	}
+
+	for _, bad := range []string{"", "X-Real-IP", "auto"} {
+		_, err := ParseHeader(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tr := trusted(t)
+	for _, tc := range []struct {
+		name    string
+		peer    string
+		from    Header
+		headers map[string][]string
+		want    string
+	}{
+		{
+			name: "direct, no headers",
+			peer: "203.0.113.7",
+			want: "203.0.113.7",
+		},
+		{
+			name:    "direct client claiming to be someone else",
+			peer:    "203.0.113.7",
+			headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "direct client claiming to be a proxy",
+			peer:    "203.0.113.7",
+			from:    Forwarded,
+			headers: map[string][]string{"Forwarded": {"for=10.0.0.5"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "through our proxy",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {"203.0.113.7"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "through our proxy, with a spoofed entry in front",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.7"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "spoofing one of our own proxies doesn't get past the real client",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {"10.9.9.9, 203.0.113.7"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "through two of our proxies",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.7, 192.168.1.1"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "across several header lines",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4", "203.0.113.7, 10.0.0.3"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "garbage appended by a client is where belief stops",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {"203.0.113.7, not-an-ip, 10.0.0.3"}},
+			want:    "10.0.0.3",
+		},
+		{
+			name:    "an empty header",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {""}},
+			want:    "10.0.0.2",
+		},
+		{
+			name:    "a request from inside",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {"10.0.0.9"}},
+			want:    "10.0.0.9",
+		},
+		{
+			name:    "with a port",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {"203.0.113.7:51234"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "IPv6",
+			peer:    "fd00::1",
+			headers: map[string][]string{"X-Forwarded-For": {"2001:db8::7"}},
+			want:    "2001:db8::7",
+		},
+		{
+			name:    "IPv4 mapped into IPv6",
+			peer:    "::ffff:10.0.0.2",
+			headers: map[string][]string{"X-Forwarded-For": {"::ffff:203.0.113.7"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "Forwarded",
+			peer:    "10.0.0.2",
+			from:    Forwarded,
+			headers: map[string][]string{"Forwarded": {`for=1.2.3.4, for=203.0.113.7;proto=https;by=10.0.0.2`}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "Forwarded, IPv6 quoted with a port",
+			peer:    "10.0.0.2",
+			from:    Forwarded,
+			headers: map[string][]string{"Forwarded": {`For="[2001:db8:cafe::17]:4711"`}},
+			want:    "2001:db8:cafe::17",
+		},
+		{
+			// our proxy writes X-Forwarded-For and passes the client's
+			// Forwarded through as it came
+			name:    "a spoofed Forwarded when the proxy writes X-Forwarded-For",
+			peer:    "10.0.0.2",
+			headers: map[string][]string{"Forwarded": {"for=1.2.3.4"}, "X-Forwarded-For": {"203.0.113.7"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "a spoofed X-Forwarded-For when the proxy writes Forwarded",
+			peer:    "10.0.0.2",
+			from:    Forwarded,
+			headers: map[string][]string{"Forwarded": {"for=203.0.113.7"}, "X-Forwarded-For": {"1.2.3.4"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "no Forwarded when that's the one configured",
+			peer:    "10.0.0.2",
+			from:    Forwarded,
+			headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4"}},
+			want:    "10.0.0.2",
+		},
+		{
+			name:    "Forwarded with an obfuscated hop",
+			peer:    "10.0.0.2",
+			from:    Forwarded,
+			headers: map[string][]string{"Forwarded": {"for=203.0.113.7, for=_hidden, for=10.0.0.3"}},
+			want:    "10.0.0.3",
+		},
+		{
+			name:    "Forwarded element without for",
+			peer:    "10.0.0.2",
+			from:    Forwarded,
+			headers: map[string][]string{"Forwarded": {"for=203.0.113.7, proto=https"}},
+			want:    "10.0.0.2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, vs := range tc.headers {
+				for _, v := range vs {
+					h.Add(k, v)
+				}
+			}
+			got := tr.Resolve(netip.MustParseAddr(tc.peer), h, tc.from)
+			assert.Equal(t, tc.want, got.String())
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	var got string
+	var gotOK bool
+	h := RealIP(trusted(t), XForwardedFor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a netip.Addr
+		a, gotOK = FromContext(r.Context())
+		got = a.String()
+		if gotOK {
+			assert.Equal(t, got, ClientIP(r))
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:4000"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 203.0.113.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, gotOK)
+	assert.Equal(t, "203.0.113.7", got)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "[2001:db8::9]:4000"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "2001:db8::9", got)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "@"
+	gotOK = true
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.False(t, gotOK, "a peer that isn't an address, a unix socket say, is left alone")
+}
+
+func TestClientIPWithoutRealIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	assert.Equal(t, "203.0.113.7", ClientIP(req))
+}
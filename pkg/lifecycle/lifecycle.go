@@ -0,0 +1,231 @@
+// Package lifecycle starts the parts of an app in order and stops them in
+// reverse. Anything that outlives a request - the HTTP server, queue
+// workers, a database pool - is a Hook, and the order they're added in is
+// their dependency order: the pool before the workers that use it, the
+// workers before the server that feeds them. Stopping goes the other way, so
+// the server stops taking requests before the workers go, and the workers
+// finish before the pool closes under them.
+//
+//	lc := lifecycle.New(logger)
+//	lc.Append(lifecycle.Hook{Name: "db", Stop: func(context.Context) error { return db.Close() }})
+//	lc.Append(lifecycle.HTTPServer("http", srv))
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+//	defer stop()
+//	err := lc.Run(ctx)
+//
+// Run returns once everything has stopped: after ctx is cancelled, or after
+// one part fails, which brings the rest down with it
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Hook is one part of the app. Every field but Name is optional
+type Hook struct {
+	Name string
+
+	// Start gets the part ready and returns: connect, bind a port, load a
+	// cache. The next hook doesn't start until it has. An error stops
+	// everything already started and fails Run
+	Start func(ctx context.Context) error
+
+	// Run is the part's ongoing work - serving, consuming a queue - and
+	// blocks until it's over. It starts once Start returns, and its ctx is
+	// cancelled when the hook is stopped. Returning an error stops the
+	// whole app; returning nil just means this part is done
+	Run func(ctx context.Context) error
+
+	// Stop is told to wrap up, with ctx expiring after the stop timeout.
+	// For parts whose Run watches its ctx, cancelling that is often all the
+	// stopping needed and Stop can be nil
+	Stop func(ctx context.Context) error
+
+	// StopTimeout is how long this hook gets to stop, Stop and Run both.
+	// Zero means the Lifecycle's default
+	StopTimeout time.Duration
+}
+
+// Lifecycle runs a list of hooks
+type Lifecycle struct {
+	hooks   []Hook
+	timeout time.Duration
+	logger  *log.Logger
+}
+
+type Option func(*Lifecycle)
+
+// WithStopTimeout sets how long each hook gets to stop, unless the hook
+// says otherwise. The default is 10 seconds
+func WithStopTimeout(d time.Duration) Option {
+	return func(l *Lifecycle) { l.timeout = d }
+}
+
+func New(logger *log.Logger, opts ...Option) *Lifecycle {
+	l := &Lifecycle{timeout: 10 * time.Second, logger: logger}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// Append adds h after the hooks added so far: it starts after them and
+// stops before them
+func (l *Lifecycle) Append(h Hook) {
+	l.hooks = append(l.hooks, h)
+}
+
+// running is a started hook
+type running struct {
+	Hook
+	cancel context.CancelFunc // cancels Run's ctx
+	done   chan struct{}      // closed when Run returns, or straight away without one
+	err    error              // what Run returned, once done is closed
+}
+
+// ErrStopTimeout is returned, wrapped with the hook's name, for a hook that
+// didn't stop in time. Run moves on to the next one regardless: a hook stuck
+// stopping shouldn't keep the rest from getting their turn
+var ErrStopTimeout = errors.New("didn't stop in time")
+
+// Run starts every hook in order, waits for ctx to be cancelled or a Run to
+// fail, and then stops the started hooks in reverse order. Cancelling ctx is
+// the normal way to stop and isn't an error. What is returned is the
+// failure that brought the app down, if any, joined with any errors
+// stopping
+func (l *Lifecycle) Run(ctx context.Context) error {
+	// the group's context is cancelled by ctx or the first Run to fail,
+	// either of which means it's time to stop. Each Run gets its own
+	// context instead, so they can be stopped one at a time
+	g, gctx := errgroup.WithContext(ctx)
+
+	var started []*running
+	var startErr error
+	for _, h := range l.hooks {
+		if gctx.Err() != nil {
+			break
+		}
+		l.logger.Printf("lifecycle: starting %s", h.Name)
+		if h.Start != nil {
+			if err := h.Start(gctx); err != nil {
+				startErr = fmt.Errorf("lifecycle: starting %s: %w", h.Name, err)
+				break
+			}
+		}
+
+		runCtx, cancel := context.WithCancel(context.Background())
+		r := &running{Hook: h, cancel: cancel, done: make(chan struct{})}
+		started = append(started, r)
+		if h.Run == nil {
+			close(r.done)
+			continue
+		}
+		g.Go(func() error {
+			defer close(r.done)
+			err := r.Run(runCtx)
+			// a Run returning its ctx's error was stopped, which is fine
+			if err != nil && !(errors.Is(err, context.Canceled) && runCtx.Err() != nil) {
+				r.err = fmt.Errorf("lifecycle: %s: %w", r.Name, err)
+			}
+			return r.err
+		})
+	}
+
+	if startErr == nil {
+		<-gctx.Done()
+	}
+
+	var stopErrs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		if err := l.stop(started[i]); err != nil {
+			l.logger.Print(err)
+			stopErrs = append(stopErrs, err)
+		}
+	}
+
+	// not g.Wait: it would wait for a Run that's stuck, and those have
+	// been given up on already
+	errs := []error{startErr}
+	for _, r := range started {
+		select {
+		case <-r.done:
+			errs = append(errs, r.err)
+		default:
+		}
+	}
+	return errors.Join(append(errs, stopErrs...)...)
+}
+
+// stop cancels r's Run, calls its Stop and waits for both, for at most its
+// timeout
+func (l *Lifecycle) stop(r *running) error {
+	timeout := r.StopTimeout
+	if timeout == 0 {
+		timeout = l.timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	l.logger.Printf("lifecycle: stopping %s", r.Name)
+	r.cancel()
+
+	stopped := make(chan error, 1)
+	go func() {
+		if r.Stop == nil {
+			stopped <- nil
+			return
+		}
+		stopped <- r.Stop(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("lifecycle: stopping %s: %w", r.Name, ErrStopTimeout)
+	}
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return fmt.Errorf("lifecycle: stopping %s: %w", r.Name, ErrStopTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("lifecycle: stopping %s: %w", r.Name, err)
+	}
+	return nil
+}
+
+// HTTPServer is a hook for srv. Start binds the port, so an address in use
+// fails at startup rather than once everything else is running. Stop is
+// srv.Shutdown, which lets requests in flight finish
+func HTTPServer(name string, srv *http.Server) Hook {
+	var ln net.Listener
+	return Hook{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			addr := srv.Addr
+			if addr == "" {
+				addr = ":http"
+			}
+			var err error
+			ln, err = (&net.ListenConfig{}).Listen(ctx, "tcp", addr)
+			return err
+		},
+		Run: func(context.Context) error {
+			if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+		Stop: srv.Shutdown,
+	}
+}
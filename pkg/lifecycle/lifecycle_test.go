@@ -0,0 +1,293 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var quiet = log.New(io.Discard, "", 0)
+
+// events records what the hooks did, in order
+type events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (e *events) add(s string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, s)
+}
+
+func (e *events) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.list...)
+}
+
+// hook records its start and stop, and runs until it's cancelled
+func (e *events) hook(name string) Hook {
+	return Hook{
+		Name: name,
+		Start: func(context.Context) error {
+			e.add("start " + name)
+			return nil
+		},
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			e.add("run " + name + " returned")
+			return ctx.Err()
+		},
+		Stop: func(context.Context) error {
+			e.add("stop " + name)
+			return nil
+		},
+	}
+}
+
+// stopOrder is the hooks in the order they stopped. Within a hook, Run is
+// cancelled and Stop called at the same time, so "stop x" and "run x
+// returned" come in either order, but never mixed up with another hook's
+func stopOrder(list []string) []string {
+	var order []string
+	for _, ev := range list {
+		f := strings.Fields(ev)
+		if f[0] == "start" {
+			continue
+		}
+		if name := f[1]; len(order) == 0 || order[len(order)-1] != name {
+			order = append(order, name)
+		}
+	}
+	return order
+}
+
+// run starts lc in the background, returning a func to stop it and get
+// what Run returned
+func run(lc *Lifecycle) (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- lc.Run(ctx) }()
+	return func() error {
+		cancel()
+		select {
+		case err := <-errc:
+			return err
+		case <-time.After(5 * time.Second):
+			return errors.New("Run never returned")
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	var e events
+	lc := New(quiet)
+	lc.Append(e.hook("db"))
+	lc.Append(e.hook("workers"))
+	lc.Append(e.hook("http"))
+
+	stop := run(lc)
+	assert.Eventually(t, func() bool { return len(e.get()) == 3 }, time.Second, time.Millisecond)
+	assert.NoError(t, stop(), "cancelling is how it's meant to stop")
+
+	assert.ElementsMatch(t, []string{
+		"start db", "start workers", "start http",
+		"stop http", "run http returned",
+		"stop workers", "run workers returned",
+		"stop db", "run db returned",
+	}, e.get())
+	assert.Equal(t, []string{"start db", "start workers", "start http"}, e.get()[:3])
+	// each hook is stopped, Run and all, before the next one starts
+	// stopping
+	assert.Equal(t, []string{"http", "workers", "db"}, stopOrder(e.get()))
+}
+
+func TestStartFails(t *testing.T) {
+	var e events
+	lc := New(quiet)
+	lc.Append(e.hook("db"))
+	broken := e.hook("workers")
+	broken.Start = func(context.Context) error { return errors.New("no queue") }
+	lc.Append(broken)
+	lc.Append(e.hook("http"))
+
+	err := lc.Run(context.Background())
+	assert.EqualError(t, err, "lifecycle: starting workers: no queue")
+	assert.ElementsMatch(t, []string{"start db", "stop db", "run db returned"}, e.get(), "what started is stopped, the rest never start")
+}
+
+func TestRunFails(t *testing.T) {
+	var e events
+	lc := New(quiet)
+	lc.Append(e.hook("db"))
+	crash := make(chan struct{})
+	workers := e.hook("workers")
+	workers.Run = func(ctx context.Context) error {
+		select {
+		case <-crash:
+			return errors.New("lost the queue")
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	lc.Append(workers)
+	lc.Append(e.hook("http"))
+
+	errc := make(chan error)
+	go func() { errc <- lc.Run(context.Background()) }()
+	assert.Eventually(t, func() bool { return len(e.get()) == 3 }, time.Second, time.Millisecond)
+	close(crash)
+
+	select {
+	case err := <-errc:
+		assert.EqualError(t, err, "lifecycle: workers: lost the queue")
+	case <-time.After(5 * time.Second):
+		t.Fatal("a failed Run didn't stop the rest")
+	}
+	assert.ElementsMatch(t, []string{
+		"start db", "start workers", "start http",
+		"stop http", "run http returned",
+		"stop workers",
+		"stop db", "run db returned",
+	}, e.get())
+	assert.Equal(t, []string{"http", "workers", "db"}, stopOrder(e.get()))
+}
+
+func TestRunDone(t *testing.T) {
+	// a Run that returns nil is finished, nothing else stops
+	var e events
+	lc := New(quiet)
+	lc.Append(Hook{Name: "migrate", Run: func(context.Context) error { e.add("migrated"); return nil }})
+	lc.Append(e.hook("http"))
+
+	stop := run(lc)
+	assert.Eventually(t, func() bool { return len(e.get()) == 2 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(t, e.get(), 2)
+	assert.NoError(t, stop())
+}
+
+func TestStopTimeout(t *testing.T) {
+	var e events
+	lc := New(quiet, WithStopTimeout(time.Second))
+	lc.Append(e.hook("db"))
+
+	stuck := e.hook("workers")
+	stuck.StopTimeout = 20 * time.Millisecond
+	stuck.Run = func(context.Context) error {
+		select {} // ignores being cancelled
+	}
+	lc.Append(stuck)
+
+	slow := e.hook("http")
+	slow.StopTimeout = 20 * time.Millisecond
+	slow.Stop = func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	lc.Append(slow)
+
+	stop := run(lc)
+	assert.Eventually(t, func() bool { return len(e.get()) == 3 }, time.Second, time.Millisecond)
+	start := time.Now()
+	err := stop()
+
+	assert.ErrorIs(t, err, ErrStopTimeout)
+	assert.ErrorContains(t, err, "lifecycle: stopping http: didn't stop in time")
+	assert.ErrorContains(t, err, "lifecycle: stopping workers: didn't stop in time")
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "each hook's own timeout applies, not the default")
+	assert.ElementsMatch(t, []string{
+		"start db", "start workers", "start http",
+		"run http returned", // its Stop hung, but cancelling Run still worked
+		"stop workers",
+		"stop db", "run db returned",
+	}, e.get())
+	assert.Equal(t, []string{"http", "workers", "db"}, stopOrder(e.get()), "the stuck ones are given up on, and db still gets stopped")
+}
+
+func TestStopError(t *testing.T) {
+	var e events
+	lc := New(quiet)
+	lc.Append(e.hook("db"))
+	h := e.hook("http")
+	h.Stop = func(context.Context) error { return errors.New("boom") }
+	lc.Append(h)
+
+	stop := run(lc)
+	assert.Eventually(t, func() bool { return len(e.get()) == 2 }, time.Second, time.Millisecond)
+	assert.EqualError(t, stop(), "lifecycle: stopping http: boom")
+	assert.Contains(t, e.get(), "stop db", "an error doesn't stop the rest stopping")
+}
+
+func TestHTTPServer(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	// a free port, for Start to bind again
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	srv := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-release
+			io.WriteString(w, "finished")
+		}),
+	}
+	lc := New(quiet)
+	lc.Append(HTTPServer("http", srv))
+	stop := run(lc)
+	require.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", addr)
+		if err == nil {
+			c.Close()
+		}
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	got := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		got <- string(b)
+	}()
+	<-entered
+
+	stopped := make(chan error)
+	go func() { stopped <- stop() }()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, "finished", <-got, "the request in flight finishes")
+	assert.NoError(t, <-stopped, "ErrServerClosed is how Serve returns after Shutdown, not a failure")
+}
+
+func TestHTTPServerAddrInUse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	lc := New(quiet)
+	lc.Append(HTTPServer("http", &http.Server{Addr: l.Addr().String()}))
+	err = lc.Run(context.Background())
+	assert.ErrorContains(t, err, "lifecycle: starting http")
+	assert.ErrorContains(t, err, "address already in use")
+}
@@ -0,0 +1,155 @@
+package listparams
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Apply pages through items in memory, the way a database would with
+// WHERE, ORDER BY and LIMIT: filter, sort, skip past the cursor or offset,
+// then take Limit. next is the cursor for the page after, nil on the last
+// page. It's for small collections and tests - a real store should do this
+// in its query, seeking to the cursor with an index
+func (s *Schema[T]) Apply(items []T, p Params) (page []T, next *Cursor, err error) {
+	var kept []T
+	for _, it := range items {
+		if s.matches(it, p.Filters) {
+			kept = append(kept, it)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return s.compareItems(kept[i], kept[j], p.Sort) < 0 })
+
+	start := min(p.Offset, len(kept))
+	if p.Cursor != nil {
+		after, err := s.parseAfter(p.Cursor.After, p.Sort)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the first item past the cursor's key. The item the cursor was made
+		// from may be gone, which doesn't matter: its key is still a place
+		// in the order
+		start = sort.Search(len(kept), func(i int) bool { return s.compareKey(kept[i], after, p.Sort) > 0 })
+	}
+	end := len(kept)
+	if p.Limit > 0 {
+		end = min(start+p.Limit, len(kept))
+	}
+	page = kept[start:end]
+
+	if end < len(kept) && len(page) > 0 {
+		last := page[len(page)-1]
+		next = &Cursor{Sort: FormatSort(p.Sort)}
+		for _, sk := range p.Sort {
+			next.After = append(next.After, formatValue(s.Fields[sk.Field].Get(last)))
+		}
+	}
+	return page, next, nil
+}
+
+func (s *Schema[T]) matches(it T, filters []Filter) bool {
+	for _, f := range filters {
+		v := s.Fields[f.Field].Get(it)
+		c := compare(v, f.Value)
+		var ok bool
+		switch f.Op {
+		case Eq:
+			ok = c == 0
+		case Ne:
+			ok = c != 0
+		case Lt:
+			ok = c < 0
+		case Le:
+			ok = c <= 0
+		case Gt:
+			ok = c > 0
+		case Ge:
+			ok = c >= 0
+		case Contains:
+			a, _ := v.(string)
+			b, _ := f.Value.(string)
+			ok = strings.Contains(strings.ToLower(a), strings.ToLower(b))
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compareItems orders a and b by sorts
+func (s *Schema[T]) compareItems(a, b T, sorts []Sort) int {
+	for _, sk := range sorts {
+		get := s.Fields[sk.Field].Get
+		if c := compare(get(a), get(b)); c != 0 {
+			if sk.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+// compareKey orders it against a cursor's key, already parsed
+func (s *Schema[T]) compareKey(it T, key []any, sorts []Sort) int {
+	for i, sk := range sorts {
+		if c := compare(s.Fields[sk.Field].Get(it), key[i]); c != 0 {
+			if sk.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+// parseAfter parses a cursor's key back to each field's kind. Parse has
+// already checked there's one value per sort field
+func (s *Schema[T]) parseAfter(after []string, sorts []Sort) ([]any, error) {
+	key := make([]any, len(sorts))
+	for i, sk := range sorts {
+		v, err := parseValue(s.Fields[sk.Field].Kind, after[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidCursor, sk.Field, err)
+		}
+		key[i] = v
+	}
+	return key, nil
+}
+
+// compare orders two values of the same kind, false before true
+func compare(a, b any) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		b := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case b:
+			return -1
+		}
+		return 1
+	}
+	panic(fmt.Sprintf("listparams: unsupported value %T", a))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
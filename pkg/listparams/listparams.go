@@ -0,0 +1,314 @@
+// Package listparams parses the query parameters of a list endpoint -
+// paging, sorting and filtering - into Params, checked against a Schema of
+// what the resource allows:
+//
+//	GET /todos?limit=20&sort=-completed,title&filter=title:contains:milk
+//	GET /todos?limit=20&cursor=eyJzIjoiaWQiLCJhIjpbIjIwIl19.V2m4...
+//
+// Two kinds of paging are supported. limit and offset are simple and let a
+// client jump to page 7, but each page is a fresh count from the start, so
+// an insert or delete between requests shifts everything and an item gets
+// skipped or seen twice - and a database still has to walk past every
+// skipped row. A cursor instead remembers where the last page ended, as the
+// sort key of its last item, and the next page starts after that key.
+// Nothing is skipped or repeated however the data changes, and a database
+// can seek straight to it with an index. Cursors are opaque to the client
+// and signed (see Codec), so nobody builds their own.
+//
+// Every sort ends with the schema's Tiebreak field, something unique like
+// the id. Without it, items with equal sort keys have no fixed order, and
+// a cursor pointing between two of them is ambiguous
+package listparams
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Kind is a field's type, for parsing filter values and comparing
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Bool
+)
+
+// Op is a filter comparison
+type Op string
+
+const (
+	Eq       Op = "eq"
+	Ne       Op = "ne"
+	Lt       Op = "lt"
+	Le       Op = "le"
+	Gt       Op = "gt"
+	Ge       Op = "ge"
+	Contains Op = "contains" // strings only, ignoring case
+)
+
+// Field describes one field of T: its kind, whether lists can be sorted by
+// it, which filters it allows, and how to read it from a T. Get must
+// return a string, int64 or bool to match Kind
+type Field[T any] struct {
+	Kind     Kind
+	Sortable bool
+	Filters  []Op
+	Get      func(T) any
+}
+
+// Schema is everything a list endpoint allows. Anything not in it is
+// rejected, so a client can't sort by an unindexed column or filter on a
+// field it shouldn't see
+type Schema[T any] struct {
+	Fields map[string]Field[T]
+
+	// Tiebreak is a unique field that ends every sort, see the package doc
+	Tiebreak string
+	// DefaultSort applies when the request has no sort. Tiebreak if empty
+	DefaultSort []Sort
+
+	// DefaultLimit applies when the request has no limit. 0 is no limit, so
+	// every item comes back unless the client asks to page
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// Sort is one sort key
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Filter keeps items whose Field compares to Value with Op. Value has been
+// parsed to the field's kind
+type Filter struct {
+	Field string
+	Op    Op
+	Value any
+}
+
+// Params is a parsed and checked list request. Only one of Offset and
+// Cursor is ever set
+type Params struct {
+	Limit   int // 0 is no limit
+	Offset  int
+	Cursor  *Cursor
+	Sort    []Sort // always ends with the schema's Tiebreak
+	Filters []Filter
+}
+
+// Error is a problem with one query parameter
+type Error struct {
+	Param  string
+	Reason string
+}
+
+func (e *Error) Error() string { return e.Param + ": " + e.Reason }
+
+// Parse reads limit, offset, cursor, sort and filter from q. codec checks
+// cursors, and may be nil if the endpoint doesn't offer them. Every problem
+// is reported, each as an *Error, joined together
+func (s *Schema[T]) Parse(q url.Values, codec *Codec) (Params, error) {
+	var errs []error
+	bad := func(param, format string, args ...any) {
+		errs = append(errs, &Error{Param: param, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	p := Params{Limit: s.DefaultLimit}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > s.MaxLimit {
+			bad("limit", "must be a number from 1 to %d", s.MaxLimit)
+		}
+		p.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			bad("offset", "must be a number, 0 or more")
+		}
+		p.Offset = n
+	}
+
+	if v := q.Get("sort"); v != "" {
+		seen := map[string]bool{}
+		for _, key := range strings.Split(v, ",") {
+			sk := Sort{Field: key}
+			if strings.HasPrefix(key, "-") {
+				sk = Sort{Field: key[1:], Desc: true}
+			}
+			switch f, ok := s.Fields[sk.Field]; {
+			case !ok || !f.Sortable:
+				bad("sort", "can't sort by %q, only %s", sk.Field, strings.Join(s.sortable(), ", "))
+			case seen[sk.Field]:
+				bad("sort", "%q is given twice", sk.Field)
+			}
+			seen[sk.Field] = true
+			p.Sort = append(p.Sort, sk)
+		}
+	} else {
+		p.Sort = append(p.Sort, s.DefaultSort...)
+	}
+	p.Sort = s.withTiebreak(p.Sort)
+
+	for _, expr := range q["filter"] {
+		f, err := s.parseFilter(expr)
+		if err != nil {
+			bad("filter", "%v", err)
+			continue
+		}
+		p.Filters = append(p.Filters, f)
+	}
+
+	if v := q.Get("cursor"); v != "" && codec == nil {
+		bad("cursor", "isn't supported here")
+	} else if v != "" {
+		c, err := codec.Decode(v)
+		switch {
+		case err != nil:
+			// cursors don't expire, so it's been tampered with, or signed
+			// with another secret - an instance without a shared one, say
+			bad("cursor", "isn't valid: it was altered, or signed with another secret")
+		case q.Has("offset"):
+			bad("cursor", "can't be used with offset")
+		case q.Has("sort") && c.Sort != FormatSort(p.Sort):
+			// a cursor is a position in one particular order
+			bad("cursor", "was made for sort=%s", c.Sort)
+		default:
+			sorts, err := s.parseSort(c.Sort)
+			if err != nil || len(c.After) != len(sorts) {
+				bad("cursor", "doesn't fit the fields this endpoint sorts by")
+				break
+			}
+			p.Sort, p.Cursor = sorts, &c
+		}
+	}
+
+	return p, errors.Join(errs...)
+}
+
+// parseSort reads a sort back from a cursor, where it was written by
+// FormatSort
+func (s *Schema[T]) parseSort(v string) ([]Sort, error) {
+	var sorts []Sort
+	for _, key := range strings.Split(v, ",") {
+		sk := Sort{Field: key}
+		if strings.HasPrefix(key, "-") {
+			sk = Sort{Field: key[1:], Desc: true}
+		}
+		if _, ok := s.Fields[sk.Field]; !ok {
+			return nil, fmt.Errorf("unknown field %q", sk.Field)
+		}
+		sorts = append(sorts, sk)
+	}
+	return sorts, nil
+}
+
+// FormatSort writes a sort the way the sort parameter takes it,
+// "-completed,title,id"
+func FormatSort(sorts []Sort) string {
+	keys := make([]string, len(sorts))
+	for i, sk := range sorts {
+		keys[i] = sk.Field
+		if sk.Desc {
+			keys[i] = "-" + sk.Field
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+func (s *Schema[T]) withTiebreak(sorts []Sort) []Sort {
+	for _, sk := range sorts {
+		if sk.Field == s.Tiebreak {
+			return sorts
+		}
+	}
+	return append(sorts, Sort{Field: s.Tiebreak})
+}
+
+func (s *Schema[T]) sortable() []string {
+	var names []string
+	for _, name := range sortedKeys(s.Fields) {
+		if s.Fields[name].Sortable {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseFilter reads field:op:value. The value is everything after the
+// second colon, so it can have colons of its own
+func (s *Schema[T]) parseFilter(expr string) (Filter, error) {
+	parts := strings.SplitN(expr, ":", 3)
+	if len(parts) != 3 {
+		return Filter{}, fmt.Errorf("%q should be field:op:value", expr)
+	}
+	name, op, raw := parts[0], Op(parts[1]), parts[2]
+
+	f, ok := s.Fields[name]
+	if !ok || len(f.Filters) == 0 {
+		return Filter{}, fmt.Errorf("can't filter on %q", name)
+	}
+	allowed := false
+	for _, o := range f.Filters {
+		allowed = allowed || o == op
+	}
+	if !allowed {
+		ops := make([]string, len(f.Filters))
+		for i, o := range f.Filters {
+			ops[i] = string(o)
+		}
+		return Filter{}, fmt.Errorf("%s can't use %q, only %s", name, op, strings.Join(ops, ", "))
+	}
+
+	v, err := parseValue(f.Kind, raw)
+	if err != nil {
+		return Filter{}, fmt.Errorf("%s: %v", name, err)
+	}
+	return Filter{Field: name, Op: op, Value: v}, nil
+}
+
+func parseValue(k Kind, raw string) (any, error) {
+	switch k {
+	case Int:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a whole number", raw)
+		}
+		return n, nil
+	case Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't true or false", raw)
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	panic(fmt.Sprintf("listparams: unsupported value %T", v))
+}
+
+// NextURL is u with its cursor replaced and any offset removed, for a Link
+// header or a "next" field
+func NextURL(u *url.URL, cursor string) string {
+	next := *u
+	q := next.Query()
+	q.Del("offset")
+	q.Set("cursor", cursor)
+	next.RawQuery = q.Encode()
+	return next.RequestURI()
+}
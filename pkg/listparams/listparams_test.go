@@ -0,0 +1,232 @@
+package listparams
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	ID   int64
+	Name string
+	Done bool
+}
+
+var schema = &Schema[item]{
+	Fields: map[string]Field[item]{
+		"id":   {Kind: Int, Sortable: true, Filters: []Op{Eq, Lt, Gt}, Get: func(it item) any { return it.ID }},
+		"name": {Kind: String, Sortable: true, Filters: []Op{Eq, Contains}, Get: func(it item) any { return it.Name }},
+		"done": {Kind: Bool, Filters: []Op{Eq}, Get: func(it item) any { return it.Done }},
+	},
+	Tiebreak:     "id",
+	DefaultLimit: 3,
+	MaxLimit:     10,
+}
+
+var codec = NewCodec([]byte("test secret"))
+
+func query(t *testing.T, raw string) url.Values {
+	t.Helper()
+	q, err := url.ParseQuery(raw)
+	require.NoError(t, err)
+	return q
+}
+
+func items(n int) []item {
+	out := make([]item, n)
+	for i := range out {
+		out[i] = item{ID: int64(i + 1), Name: fmt.Sprintf("item %c", 'a'+i%5), Done: i%2 == 0}
+	}
+	return out
+}
+
+func ids(its []item) []int64 {
+	out := make([]int64, len(its))
+	for i, it := range its {
+		out[i] = it.ID
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	p, err := schema.Parse(url.Values{}, codec)
+	require.NoError(t, err)
+	assert.Equal(t, Params{Limit: 3, Sort: []Sort{{Field: "id"}}}, p)
+
+	p, err = schema.Parse(query(t, "limit=5&offset=10&sort=-name&filter=done:eq:true&filter=name:contains:a:b"), codec)
+	require.NoError(t, err)
+	assert.Equal(t, Params{
+		Limit:  5,
+		Offset: 10,
+		Sort:   []Sort{{Field: "name", Desc: true}, {Field: "id"}},
+		Filters: []Filter{
+			{Field: "done", Op: Eq, Value: true},
+			{Field: "name", Op: Contains, Value: "a:b"},
+		},
+	}, p)
+
+	p, err = schema.Parse(query(t, "sort=-id,name"), codec)
+	require.NoError(t, err)
+	assert.Equal(t, []Sort{{Field: "id", Desc: true}, {Field: "name"}}, p.Sort, "the tiebreak isn't added twice")
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"limit=0", []string{"limit: must be a number from 1 to 10"}},
+		{"limit=11", []string{"limit: must be a number from 1 to 10"}},
+		{"limit=x&offset=-1", []string{"limit: must be", "offset: must be a number, 0 or more"}},
+		{"sort=done", []string{`sort: can't sort by "done", only id, name`}},
+		{"sort=name,-name", []string{`sort: "name" is given twice`}},
+		{"filter=name", []string{`filter: "name" should be field:op:value`}},
+		{"filter=secret:eq:x", []string{`filter: can't filter on "secret"`}},
+		{"filter=done:lt:true", []string{`filter: done can't use "lt", only eq`}},
+		{"filter=id:gt:seven", []string{`filter: id: "seven" isn't a whole number`}},
+		{"filter=done:eq:maybe", []string{`filter: done: "maybe" isn't true or false`}},
+		{"cursor=nonsense", []string{"cursor: isn't valid"}},
+	} {
+		_, err := schema.Parse(query(t, tc.query), codec)
+		require.Error(t, err, tc.query)
+		for _, want := range tc.want {
+			assert.Contains(t, err.Error(), want, tc.query)
+		}
+		var pe *Error
+		assert.True(t, errors.As(err, &pe), tc.query)
+	}
+
+	_, err := schema.Parse(query(t, "cursor=abc"), nil)
+	assert.EqualError(t, err, "cursor: isn't supported here")
+}
+
+func TestCursorCodec(t *testing.T) {
+	c := Cursor{Sort: "-name,id", After: []string{"item c", "3"}}
+	s := codec.Encode(c)
+	got, err := codec.Decode(s)
+	require.NoError(t, err)
+	assert.Equal(t, c, got)
+
+	payload, sig, _ := strings.Cut(s, ".")
+	forged := b64.EncodeToString([]byte(`{"s":"-name,id","a":["item z","9"]}`))
+	for name, bad := range map[string]string{
+		"forged payload":    forged + "." + sig,
+		"no signature":      payload,
+		"empty signature":   payload + ".",
+		"truncated":         s[:len(s)-2],
+		"not base64":        "!!!." + sig,
+		"other secret":      NewCodec([]byte("another secret")).Encode(c),
+		"signed, not json":  b64.EncodeToString([]byte("nope")) + "." + b64.EncodeToString(codec.sign([]byte("nope"))),
+		"empty":             "",
+		"only the dot":      ".",
+		"signature swapped": sig + "." + payload,
+	} {
+		_, err := codec.Decode(bad)
+		assert.ErrorIs(t, err, ErrInvalidCursor, name)
+	}
+}
+
+func TestApply(t *testing.T) {
+	all := items(10)
+
+	page, next, err := schema.Apply(all, Params{Limit: 3, Sort: []Sort{{Field: "id"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, ids(page))
+	require.NotNil(t, next)
+	assert.Equal(t, Cursor{Sort: "id", After: []string{"3"}}, *next)
+
+	page, next, err = schema.Apply(all, Params{Limit: 3, Offset: 8, Sort: []Sort{{Field: "id"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{9, 10}, ids(page))
+	assert.Nil(t, next, "the last page has no next")
+
+	page, _, err = schema.Apply(all, Params{Limit: 10, Offset: 20, Sort: []Sort{{Field: "id"}}})
+	require.NoError(t, err)
+	assert.Empty(t, page)
+
+	page, next, err = schema.Apply(all, Params{Offset: 2, Sort: []Sort{{Field: "id"}}})
+	require.NoError(t, err)
+	assert.Len(t, page, 8, "no limit is the rest")
+	assert.Nil(t, next)
+
+	// names repeat every 5 items, so the tiebreak decides within a name
+	page, _, err = schema.Apply(all, Params{Limit: 4, Sort: []Sort{{Field: "name", Desc: true}, {Field: "id"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{5, 10, 4, 9}, ids(page))
+
+	p, err := schema.Parse(query(t, "limit=10&filter=done:eq:true&filter=name:contains:ITEM&filter=id:gt:2"), codec)
+	require.NoError(t, err)
+	page, _, err = schema.Apply(all, p)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 5, 7, 9}, ids(page))
+}
+
+func TestCursorPaging(t *testing.T) {
+	all := items(10)
+
+	// page through by name descending, adding and removing items between
+	// pages. Every item that was there throughout is seen exactly once
+	seen := map[int64]int{}
+	p, err := schema.Parse(query(t, "sort=-name&limit=3"), codec)
+	require.NoError(t, err)
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 10, "paging never ended")
+		page, next, err := schema.Apply(all, p)
+		require.NoError(t, err)
+		for _, it := range page {
+			seen[it.ID]++
+		}
+		if next == nil {
+			break
+		}
+
+		// something sorting before where we are, which offset paging would
+		// have shifted everything by
+		all = append(all, item{ID: int64(100 + pages), Name: "item z"})
+		if pages == 1 {
+			all = all[1:] // id 1 goes, it's on a later page
+		}
+
+		q := query(t, "sort=-name&limit=3")
+		q.Set("cursor", codec.Encode(*next))
+		p, err = schema.Parse(q, codec)
+		require.NoError(t, err)
+	}
+
+	for id := int64(2); id <= 10; id++ {
+		assert.Equal(t, 1, seen[id], "item %d", id)
+	}
+	assert.Zero(t, seen[1], "deleted before its page")
+}
+
+func TestCursorMismatch(t *testing.T) {
+	cur := codec.Encode(Cursor{Sort: "-name,id", After: []string{"item c", "3"}})
+
+	p, err := schema.Parse(url.Values{"cursor": {cur}}, codec)
+	require.NoError(t, err, "a cursor brings its own sort")
+	assert.Equal(t, []Sort{{Field: "name", Desc: true}, {Field: "id"}}, p.Sort)
+
+	_, err = schema.Parse(url.Values{"cursor": {cur}, "sort": {"name"}}, codec)
+	assert.EqualError(t, err, "cursor: was made for sort=-name,id")
+
+	_, err = schema.Parse(url.Values{"cursor": {cur}, "offset": {"3"}}, codec)
+	assert.EqualError(t, err, "cursor: can't be used with offset")
+
+	short := codec.Encode(Cursor{Sort: "-name,id", After: []string{"item c"}})
+	_, err = schema.Parse(url.Values{"cursor": {short}}, codec)
+	assert.EqualError(t, err, "cursor: doesn't fit the fields this endpoint sorts by")
+
+	_, err = schema.Parse(url.Values{"cursor": {"made.up"}}, codec)
+	assert.EqualError(t, err, "cursor: isn't valid: it was altered, or signed with another secret")
+}
+
+func TestNextURL(t *testing.T) {
+	u, err := url.Parse("/todos?offset=20&limit=5&sort=-title")
+	require.NoError(t, err)
+	assert.Equal(t, "/todos?cursor=abc.def&limit=5&sort=-title", NextURL(u, "abc.def"))
+}
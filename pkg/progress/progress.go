@@ -0,0 +1,203 @@
+// Package progress counts the bytes going through a Reader or Writer, for
+// progress bars, transfer logs and throughput numbers
+package progress
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// Func is called with the total bytes so far
+type Func func(total int64)
+
+// Option configures a CountingReader or CountingWriter
+type Option func(*counter)
+
+// OnProgress sets the callback. With neither EveryBytes nor EveryInterval
+// it's called after every Read or Write that moved any bytes.
+//
+// Calls never overlap, even when several goroutines share a CountingWriter,
+// and the totals they see never go down. They do block the Read or Write
+// that triggered them, so anything slow belongs on another goroutine
+func OnProgress(fn Func) Option {
+	return func(c *counter) { c.fn = fn }
+}
+
+// EveryBytes calls back each time the total passes another multiple of n.
+// One big Write that passes several only calls back once
+func EveryBytes(n int64) Option {
+	return func(c *counter) { c.every = n }
+}
+
+// EveryInterval calls back on the first Read or Write at least d after the
+// last call. It's driven by the reads and writes, not a timer, so a
+// transfer that stalls goes quiet too
+func EveryInterval(d time.Duration) Option {
+	return func(c *counter) { c.interval = d }
+}
+
+// WithClock sets the clock EveryInterval goes by
+func WithClock(clk clock.Clock) Option {
+	return func(c *counter) { c.clk = clk }
+}
+
+// counter is the part CountingReader and CountingWriter share. n is only
+// touched atomically, so N can be called from anywhere - a goroutine
+// drawing a progress bar, say - without a lock. The rest only matters when
+// there's a callback, and mu guards it
+type counter struct {
+	n        atomic.Int64
+	fn       Func
+	every    int64
+	interval time.Duration
+	clk      clock.Clock
+
+	mu       sync.Mutex
+	next     int64 // the total that's due a call for EveryBytes
+	last     time.Time
+	reported int64
+}
+
+func newCounter(opts []Option) *counter {
+	c := &counter{clk: clock.New()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.next = c.every
+	c.last = c.clk.Now()
+	return c
+}
+
+func (c *counter) add(n int64) {
+	if n <= 0 {
+		return
+	}
+	c.n.Add(n)
+	if c.fn == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// load the total again under the lock rather than use what Add
+	// returned. Another goroutine's Add may have got in since, and if it's
+	// already been reported, this would go backwards
+	total := c.n.Load()
+	if total == c.reported {
+		return
+	}
+
+	due := c.every <= 0 && c.interval <= 0
+	if c.every > 0 && total >= c.next {
+		due = true
+	}
+	var now time.Time
+	if c.interval > 0 {
+		now = c.clk.Now()
+		if now.Sub(c.last) >= c.interval {
+			due = true
+		}
+	}
+	if due {
+		c.report(total, now)
+	}
+}
+
+// report calls back with total. c.mu must be held
+func (c *counter) report(total int64, now time.Time) {
+	c.fn(total)
+	c.reported = total
+	if c.every > 0 {
+		c.next = total - total%c.every + c.every
+	}
+	if c.interval > 0 {
+		c.last = now
+	}
+}
+
+// finish calls back with the final total, unless the last call already had
+// it, so a progress display always ends on the real number
+func (c *counter) finish() {
+	if c.fn == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if total := c.n.Load(); total != c.reported {
+		c.report(total, c.clk.Now())
+	}
+}
+
+// N is the bytes counted so far
+func (c *counter) N() int64 { return c.n.Load() }
+
+// CountingReader counts the bytes read through it
+type CountingReader struct {
+	r io.Reader
+	*counter
+}
+
+// NewCountingReader counts what's read from r. Reaching the end of r, or
+// an error, calls back with the final total
+func NewCountingReader(r io.Reader, opts ...Option) *CountingReader {
+	return &CountingReader{r: r, counter: newCounter(opts)}
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.add(int64(n))
+	if err != nil {
+		c.finish()
+	}
+	return n, err
+}
+
+// CountingWriter counts the bytes written through it. Several goroutines
+// can share one, to add up what they all wrote, as long as w is fine with
+// that too - io.Discard is
+type CountingWriter struct {
+	w io.Writer
+	*counter
+}
+
+// NewCountingWriter counts what's written to w. A writer doesn't know when
+// it's had the last Write, so call Done for the final callback
+func NewCountingWriter(w io.Writer, opts ...Option) *CountingWriter {
+	return &CountingWriter{w: w, counter: newCounter(opts)}
+}
+
+// Write counts the bytes w took, which may be fewer than len(p) if it failed
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.add(int64(n))
+	return n, err
+}
+
+// ReadFrom hands src to w's own ReadFrom when it has one, which is how
+// io.Copy to a net/http response sends a file with sendfile instead of
+// copying it through a buffer. w reports how much it took only once it's
+// done, so the count, and any callback, comes in one step at the end.
+// Without a ReadFrom on w, it's io.Copy through Write
+func (c *CountingWriter) ReadFrom(src io.Reader) (int64, error) {
+	rf, ok := c.w.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(writerOnly{c}, src)
+	}
+	n, err := rf.ReadFrom(src)
+	c.add(n)
+	return n, err
+}
+
+// writerOnly hides ReadFrom, so io.Copy doesn't come straight back to it
+type writerOnly struct {
+	io.Writer
+}
+
+// Done calls back with the total, if the last call didn't already have it
+func (c *CountingWriter) Done() {
+	c.finish()
+}
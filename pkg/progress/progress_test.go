@@ -0,0 +1,246 @@
+package progress
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorntonmc/go-practice/pkg/clock"
+)
+
+// calls records what a Func was called with
+type calls struct {
+	mu     sync.Mutex
+	totals []int64
+}
+
+func (c *calls) fn(total int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.totals = append(c.totals, total)
+}
+
+func (c *calls) get() []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int64(nil), c.totals...)
+}
+
+func TestCountingReader(t *testing.T) {
+	var got calls
+	r := NewCountingReader(iotest.HalfReader(strings.NewReader(strings.Repeat("x", 100))), OnProgress(got.fn), EveryBytes(30))
+
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Len(t, b, 100)
+	assert.Equal(t, int64(100), r.N())
+
+	totals := got.get()
+	require.NotEmpty(t, totals)
+	assert.Equal(t, int64(100), totals[len(totals)-1], "EOF always gets a call")
+	for i, total := range totals[:len(totals)-1] {
+		// one call for each multiple of 30 passed, and no more
+		assert.Equal(t, int64(i+1), total/30, "call %d at %d", i, total)
+	}
+}
+
+func TestEveryCall(t *testing.T) {
+	var got calls
+	r := NewCountingReader(iotest.OneByteReader(strings.NewReader("abc")), OnProgress(got.fn))
+	_, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, got.get(), "and no repeat of 3 at the end")
+}
+
+func TestReaderError(t *testing.T) {
+	var got calls
+	boom := errors.New("boom")
+	r := NewCountingReader(io.MultiReader(strings.NewReader("abcde"), iotest.ErrReader(boom)), OnProgress(got.fn), EveryBytes(100))
+	_, err := io.ReadAll(r)
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, []int64{5}, got.get(), "an error ends it too")
+}
+
+func TestEveryBytesBigWrite(t *testing.T) {
+	var got calls
+	w := NewCountingWriter(io.Discard, OnProgress(got.fn), EveryBytes(10))
+
+	w.Write(make([]byte, 35))
+	w.Write(make([]byte, 4))
+	w.Write(make([]byte, 1))
+	w.Write(make([]byte, 9))
+	assert.Equal(t, []int64{35, 40}, got.get(), "35 passes three multiples in one go, but it's one call")
+
+	w.Done()
+	w.Done()
+	assert.Equal(t, []int64{35, 40, 49}, got.get())
+}
+
+func TestEveryInterval(t *testing.T) {
+	var got calls
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	w := NewCountingWriter(io.Discard, OnProgress(got.fn), EveryInterval(time.Second), WithClock(clk))
+
+	w.Write(make([]byte, 10))
+	clk.Advance(999 * time.Millisecond)
+	w.Write(make([]byte, 10))
+	assert.Empty(t, got.get())
+
+	clk.Advance(time.Millisecond)
+	w.Write(make([]byte, 10))
+	assert.Equal(t, []int64{30}, got.get())
+
+	clk.Advance(5 * time.Second)
+	assert.Equal(t, []int64{30}, got.get(), "no writes, no calls")
+	w.Write(make([]byte, 1))
+	w.Write(make([]byte, 1))
+	assert.Equal(t, []int64{30, 31}, got.get(), "and the second is measured from the last call")
+}
+
+func TestEveryBytesOrInterval(t *testing.T) {
+	var got calls
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	w := NewCountingWriter(io.Discard, OnProgress(got.fn), EveryBytes(100), EveryInterval(time.Second), WithClock(clk))
+
+	w.Write(make([]byte, 150))
+	clk.Advance(time.Second)
+	w.Write(make([]byte, 10))
+	w.Write(make([]byte, 40))
+	assert.Equal(t, []int64{150, 160, 200}, got.get(), "whichever comes first")
+}
+
+func TestWriterCountsWhatWasWritten(t *testing.T) {
+	var sb strings.Builder
+	w := NewCountingWriter(&limited{w: &sb, n: 3})
+	n, err := w.Write([]byte("hello"))
+	assert.Error(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, int64(3), w.N())
+}
+
+// limited takes n bytes, then fails
+type limited struct {
+	w io.Writer
+	n int
+}
+
+func (l *limited) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		n, _ := l.w.Write(p[:l.n])
+		l.n = 0
+		return n, errors.New("full")
+	}
+	l.n -= len(p)
+	return l.w.Write(p)
+}
+
+// readerFrom is a Writer with a ReadFrom, like a net/http response
+type readerFrom struct {
+	strings.Builder
+	calls int
+}
+
+func (r *readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	r.calls++
+	return io.Copy(&r.Builder, src)
+}
+
+func TestWriterReadFrom(t *testing.T) {
+	var got calls
+	dst := &readerFrom{}
+	w := NewCountingWriter(dst, OnProgress(got.fn))
+	// a LimitedReader, as ServeContent copies from. A strings.Reader would
+	// take over with its WriteTo
+	n, err := io.Copy(w, io.LimitReader(strings.NewReader("hello, world"), 100))
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), n)
+	assert.Equal(t, 1, dst.calls, "passed through to the destination's ReadFrom")
+	assert.Equal(t, "hello, world", dst.String())
+	assert.Equal(t, int64(12), w.N())
+	assert.Equal(t, []int64{12}, got.get())
+
+	// without one, it's plain Writes
+	var sb strings.Builder
+	w = NewCountingWriter(&sb, EveryBytes(5))
+	n, err = w.ReadFrom(iotest.OneByteReader(strings.NewReader("hello, world")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), n)
+	assert.Equal(t, "hello, world", sb.String())
+	assert.Equal(t, int64(12), w.N())
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	var got calls
+	w := NewCountingWriter(io.Discard, OnProgress(got.fn), EveryBytes(1000))
+
+	const workers, writes = 8, 500
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(size int) {
+			defer wg.Done()
+			p := make([]byte, size)
+			for j := 0; j < writes; j++ {
+				w.Write(p)
+			}
+		}(i + 1)
+	}
+	wg.Wait()
+	w.Done()
+
+	want := int64(writes * workers * (workers + 1) / 2)
+	assert.Equal(t, want, w.N(), "no lost counts")
+	totals := got.get()
+	assert.Equal(t, want, totals[len(totals)-1])
+	for i := 1; i < len(totals); i++ {
+		assert.Greater(t, totals[i], totals[i-1], "totals only go up")
+		assert.Greater(t, totals[i]/1000, totals[i-1]/1000, "one call per multiple at most")
+	}
+}
+
+func TestConcurrentRead(t *testing.T) {
+	// one goroutine reads while others watch N, the way a progress bar
+	// would. The race detector checks nothing's read unsafely
+	pr, pw := io.Pipe()
+	r := NewCountingReader(pr)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last int64
+			for {
+				n := r.N()
+				assert.GreaterOrEqual(t, n, last)
+				last = n
+				select {
+				case <-done:
+					return
+				default:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			pw.Write(make([]byte, 100))
+		}
+		pw.Close()
+	}()
+	b, err := io.ReadAll(r)
+	close(done)
+	wg.Wait()
+	require.NoError(t, err)
+	assert.Len(t, b, 10000)
+	assert.Equal(t, int64(10000), r.N())
+}
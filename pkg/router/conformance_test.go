@@ -0,0 +1,115 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The conformance cases run against both the router and, in
+// servemux_test.go, Go 1.22's http.ServeMux. The patterns are picked so
+// ServeMux accepts them all - it panics on pairs where neither is more
+// specific, see TestPrecedence for where the two differ
+
+var conformancePatterns = []string{
+	"/{$}",
+	"GET /items/{id}",
+	"DELETE /items/{id}",
+	"GET /items/special",
+	"POST /items",
+	"/files/{path...}",
+	"/static/",
+	"GET /b/{bucket}/o/{object...}",
+	"GET /users/{user}/posts/{post}",
+}
+
+var paramNames = []string{"id", "path", "bucket", "object", "user", "post"}
+
+type conformanceCase struct {
+	method   string
+	path     string
+	status   int
+	pattern  string
+	params   map[string]string
+	allow    string
+	location string
+}
+
+var conformanceCases = []conformanceCase{
+	{method: "GET", path: "/", status: 200, pattern: "/{$}"},
+	{method: "GET", path: "/nope", status: 404},
+
+	{method: "GET", path: "/items/42", status: 200, pattern: "GET /items/{id}", params: map[string]string{"id": "42"}},
+	{method: "HEAD", path: "/items/42", status: 200, pattern: "GET /items/{id}", params: map[string]string{"id": "42"}},
+	{method: "DELETE", path: "/items/42", status: 200, pattern: "DELETE /items/{id}", params: map[string]string{"id": "42"}},
+	{method: "PUT", path: "/items/42", status: 405, allow: "DELETE, GET, HEAD"},
+	{method: "GET", path: "/items/special", status: 200, pattern: "GET /items/special"},
+	{method: "GET", path: "/items/a%2Fb", status: 200, pattern: "GET /items/{id}", params: map[string]string{"id": "a/b"}},
+	{method: "GET", path: "/items/42/more", status: 404},
+
+	{method: "POST", path: "/items", status: 200, pattern: "POST /items"},
+	{method: "GET", path: "/items", status: 405, allow: "POST"},
+
+	{method: "GET", path: "/files/a/b/c.txt", status: 200, pattern: "/files/{path...}", params: map[string]string{"path": "a/b/c.txt"}},
+	{method: "PUT", path: "/files/a", status: 200, pattern: "/files/{path...}", params: map[string]string{"path": "a"}},
+	{method: "GET", path: "/files/", status: 200, pattern: "/files/{path...}"},
+	{method: "GET", path: "/files", status: 307, location: "/files/"},
+
+	{method: "GET", path: "/static/css/site.css", status: 200, pattern: "/static/"},
+	{method: "GET", path: "/static", status: 307, location: "/static/"},
+
+	{method: "GET", path: "/b/photos/o/2024/cat.jpg", status: 200, pattern: "GET /b/{bucket}/o/{object...}", params: map[string]string{"bucket": "photos", "object": "2024/cat.jpg"}},
+	{method: "GET", path: "/users/7/posts/9", status: 200, pattern: "GET /users/{user}/posts/{post}", params: map[string]string{"user": "7", "post": "9"}},
+
+	{method: "GET", path: "/static/../items/42", status: 307, location: "/items/42"},
+	{method: "GET", path: "/items//42", status: 307, location: "/items/42"},
+}
+
+// runConformance registers conformancePatterns with handle, each handler
+// reporting its pattern and parameters through param, and checks every
+// case against h
+func runConformance(t *testing.T, h http.Handler, handle func(string, http.Handler), param func(*http.Request, string) string) {
+	for _, pattern := range conformancePatterns {
+		pattern := pattern
+		handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			params := map[string]string{}
+			for _, name := range paramNames {
+				if v := param(r, name); v != "" {
+					params[name] = v
+				}
+			}
+			w.Header().Set("X-Pattern", pattern)
+			_ = json.NewEncoder(w).Encode(params)
+		}))
+	}
+
+	for _, tt := range conformanceCases {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			require.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.pattern, w.Header().Get("X-Pattern"))
+			assert.Equal(t, tt.allow, w.Header().Get("Allow"))
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+
+			if tt.status == http.StatusOK && tt.method != http.MethodHead {
+				var params map[string]string
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&params))
+				if tt.params == nil {
+					tt.params = map[string]string{}
+				}
+				assert.Equal(t, tt.params, params)
+			}
+		})
+	}
+}
+
+func TestConformance(t *testing.T) {
+	r := New()
+	runConformance(t, r, r.Handle, Param)
+}
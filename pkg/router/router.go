@@ -0,0 +1,447 @@
+// Package router is a small HTTP router with method matching, path
+// parameters, wildcards and middleware groups. Its patterns look like Go
+// 1.22's http.ServeMux ones - "GET /items/{id}", "/files/{path...}",
+// "/{$}" - so the two can be compared case by case, which the tests do.
+//
+// Routes are stored in a trie.Trie keyed by path segment. A
+// request walks it one segment at a time, trying a literal match first,
+// then a {param}, then a {rest...} wildcard, and backing up to try the next
+// kind when a branch leads nowhere. That order is the precedence: literal
+// beats parameter beats wildcard, segment by segment from the left.
+// ServeMux's rule is "the most specific pattern wins" and it refuses to
+// register two patterns where neither is more specific, like "/a/{x}" and
+// "/{y}/b". The router accepts those and picks "/a/{x}" for "/a/b", since
+// the literal comes first
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/thorntonmc/go-practice/pkg/trie"
+)
+
+// Middleware wraps a handler, the same shape as everywhere else in the repo
+type Middleware func(http.Handler) http.Handler
+
+type segKind uint8
+
+const (
+	literal segKind = iota
+	param           // {name}, one segment
+	rest            // {name...}, or a trailing slash: the rest of the path
+	end             // {$}, the path ends with a slash here
+)
+
+// seg is a trie key. Keying on the kind as well as the text keeps a literal
+// segment that happens to look like "{id}" apart from a parameter
+type seg struct {
+	kind segKind
+	lit  string
+}
+
+// endpoint is what a pattern's path leads to: a handler per method. The
+// empty method matches any
+type endpoint struct {
+	pattern  string
+	names    []string // parameter names in order, for filling in Params
+	handlers map[string]http.Handler
+}
+
+// Router dispatches requests to the handlers registered for them. Create
+// one with New
+type Router struct {
+	root   Group
+	routes trie.Trie[seg, *endpoint]
+
+	// NotFound and MethodNotAllowed replace the default plain text
+	// responses. MethodNotAllowed is called with Allow already set
+	NotFound         http.Handler
+	MethodNotAllowed http.Handler
+}
+
+func New() *Router {
+	r := &Router{}
+	r.root = Group{router: r}
+	return r
+}
+
+// The router is the root group, these are its methods
+
+func (r *Router) Use(mw ...Middleware)                  { r.root.Use(mw...) }
+func (r *Router) Group(prefix string) *Group            { return r.root.Group(prefix) }
+func (r *Router) Route(prefix string, fn func(*Group))  { r.root.Route(prefix, fn) }
+func (r *Router) Handle(pattern string, h http.Handler) { r.root.Handle(pattern, h) }
+
+func (r *Router) HandleFunc(pattern string, h func(http.ResponseWriter, *http.Request)) {
+	r.root.HandleFunc(pattern, h)
+}
+
+/*
+ *
+ * registering
+ *
+ */
+
+// Group is a set of routes sharing a path prefix and middleware
+type Group struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+	sealed     bool // routes have been added, Use would be too late
+}
+
+// Use adds middleware for the group's routes, outermost first. Middleware is
+// applied when a route is added, so it has to come first - Use after Handle
+// panics rather than quietly missing routes
+func (g *Group) Use(mw ...Middleware) {
+	if g.sealed {
+		panic("router: Use must be called before the group's routes are added")
+	}
+	g.middleware = append(g.middleware, mw...)
+}
+
+// Group returns a child group under prefix, with this group's middleware
+// and any it adds itself
+func (g *Group) Group(prefix string) *Group {
+	g.sealed = true
+	return &Group{
+		router:     g.router,
+		prefix:     g.prefix + strings.TrimSuffix(prefix, "/"),
+		middleware: append([]Middleware(nil), g.middleware...),
+	}
+}
+
+// Route calls fn with a child group under prefix, for laying routes out in
+// blocks
+func (g *Group) Route(prefix string, fn func(g *Group)) {
+	fn(g.Group(prefix))
+}
+
+// Handle registers h for pattern, "[METHOD ]/path". It panics on a pattern
+// that doesn't parse, or one already registered for the same method, like
+// http.ServeMux does - both are programming errors, found at startup
+func (g *Group) Handle(pattern string, h http.Handler) {
+	method, p, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, p = "", pattern
+	}
+	p = g.prefix + strings.TrimLeft(p, " ")
+
+	segs, names, err := parse(p)
+	if err != nil {
+		panic(fmt.Sprintf("router: pattern %q: %v", pattern, err))
+	}
+
+	for i := len(g.middleware) - 1; i >= 0; i-- {
+		h = g.middleware[i](h)
+	}
+	g.sealed = true
+
+	e, ok := g.router.routes.Get(segs)
+	if !ok {
+		e = &endpoint{pattern: p, names: names, handlers: map[string]http.Handler{}}
+		g.router.routes.Put(segs, e)
+	}
+	if _, dup := e.handlers[method]; dup {
+		panic(fmt.Sprintf("router: pattern %q registered twice", pattern))
+	}
+	if !equalNames(e.names, names) {
+		panic(fmt.Sprintf("router: pattern %q has different parameter names to %q", pattern, e.pattern))
+	}
+	e.handlers[method] = h
+}
+
+func (g *Group) HandleFunc(pattern string, h func(http.ResponseWriter, *http.Request)) {
+	g.Handle(pattern, http.HandlerFunc(h))
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parse turns "/b/{bucket}/o/{name...}" into trie keys and the parameter
+// names. A trailing slash is an anonymous wildcard, as with ServeMux: "/a/"
+// matches /a/ and everything below it
+func parse(p string) ([]seg, []string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, nil, fmt.Errorf("must start with /")
+	}
+
+	var (
+		segs  []seg
+		names []string
+	)
+	parts := strings.Split(p[1:], "/")
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch {
+		case part == "" && last:
+			segs = append(segs, seg{kind: rest})
+		case part == "{$}":
+			if !last {
+				return nil, nil, fmt.Errorf("{$} must be at the end")
+			}
+			segs = append(segs, seg{kind: end})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name, dots := strings.CutSuffix(part[1:len(part)-1], "...")
+			if !validName(name) {
+				return nil, nil, fmt.Errorf("bad parameter name %q", name)
+			}
+			for _, n := range names {
+				if n == name {
+					return nil, nil, fmt.Errorf("parameter %q used twice", name)
+				}
+			}
+			names = append(names, name)
+			if dots {
+				if !last {
+					return nil, nil, fmt.Errorf("{%s...} must be at the end", name)
+				}
+				segs = append(segs, seg{kind: rest})
+			} else {
+				segs = append(segs, seg{kind: param})
+			}
+		case strings.ContainsAny(part, "{}"):
+			return nil, nil, fmt.Errorf("a parameter must be a whole segment")
+		default:
+			segs = append(segs, seg{kind: literal, lit: part})
+		}
+	}
+	return segs, names, nil
+}
+
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !(r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || i > 0 && '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ *
+ * matching
+ *
+ */
+
+type paramsKey struct{}
+
+// Param returns the value of the path parameter name for r, "" if there's
+// no such parameter. Values are unescaped, so "/files/a%2Fb" gives "a/b"
+// for "/files/{name}"
+func Param(r *http.Request, name string) string {
+	ps, _ := r.Context().Value(paramsKey{}).(*params)
+	if ps == nil {
+		return ""
+	}
+	for i, n := range ps.names {
+		if n == name {
+			return ps.values[i]
+		}
+	}
+	return ""
+}
+
+// Pattern returns the pattern that matched r, for logging and metrics -
+// "/users/{id}" groups far better than every user's own path
+func Pattern(r *http.Request) string {
+	ps, _ := r.Context().Value(paramsKey{}).(*params)
+	if ps == nil {
+		return ""
+	}
+	return ps.pattern
+}
+
+type params struct {
+	pattern string
+	names   []string
+	values  []string
+}
+
+// match is a search in progress for one request
+type match struct {
+	method  string
+	segs    []string
+	values  []string // captured so far
+	allowed map[string]bool
+
+	found   *endpoint
+	handler http.Handler
+	result  []string
+}
+
+// walk tries to match segs[i:] below n, literal first, then parameter,
+// then wildcard, backtracking when a branch fails. A path that matches but
+// for the wrong method isn't a match - a less specific pattern may still
+// take it - but its methods are remembered for a 405
+func (m *match) walk(n *trie.Node[seg, *endpoint], i int) bool {
+	if i == len(m.segs) {
+		return m.accept(n)
+	}
+
+	s := m.segs[i]
+	if s == "" && i == len(m.segs)-1 && m.try(n.Child(seg{kind: end}), nil) {
+		return true
+	}
+	if child := n.Child(seg{kind: literal, lit: s}); child != nil && m.walk(child, i+1) {
+		return true
+	}
+	if child := n.Child(seg{kind: param}); child != nil && s != "" {
+		m.values = append(m.values, s)
+		if m.walk(child, i+1) {
+			return true
+		}
+		m.values = m.values[:len(m.values)-1]
+	}
+	return m.try(n.Child(seg{kind: rest}), []string{strings.Join(m.segs[i:], "/")})
+}
+
+// try accepts n as the end of the match, capturing value when there is one
+func (m *match) try(n *trie.Node[seg, *endpoint], value []string) bool {
+	if n == nil {
+		return false
+	}
+	m.values = append(m.values, value...)
+	if m.accept(n) {
+		return true
+	}
+	m.values = m.values[:len(m.values)-len(value)]
+	return false
+}
+
+func (m *match) accept(n *trie.Node[seg, *endpoint]) bool {
+	e, ok := n.Value()
+	if !ok {
+		return false
+	}
+
+	h := e.handlers[m.method]
+	if h == nil && m.method == http.MethodHead {
+		h = e.handlers[http.MethodGet]
+	}
+	if h == nil {
+		h = e.handlers[""]
+	}
+	if h == nil {
+		for method := range e.handlers {
+			m.allowed[method] = true
+		}
+		return false
+	}
+
+	m.found, m.handler = e, h
+	// an anonymous trailing slash captured a value no name asked for
+	m.result = append([]string(nil), m.values[:len(e.names)]...)
+	return true
+}
+
+// lookup finds the handler for method and an escaped path. Splitting
+// before unescaping means "a%2Fb" stays one segment
+func (r *Router) lookup(method, escaped string) (*match, bool) {
+	segs := strings.Split(escaped[1:], "/")
+	for i, s := range segs {
+		if u, err := url.PathUnescape(s); err == nil {
+			segs[i] = u
+		}
+	}
+	m := &match{method: method, segs: segs, allowed: map[string]bool{}}
+	return m, m.walk(r.routes.Root(), 0)
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p := req.URL.Path
+	if p == "" || p[0] != '/' {
+		p = "/" + p
+	}
+
+	// like ServeMux, send unclean paths to their clean version
+	if clean := cleanPath(p); clean != p {
+		redirect(w, req, clean)
+		return
+	}
+
+	escaped := req.URL.EscapedPath()
+	if escaped == "" || escaped[0] != '/' {
+		escaped = "/" + escaped
+	}
+
+	m, ok := r.lookup(req.Method, escaped)
+	if ok {
+		ps := &params{pattern: m.found.pattern, names: m.found.names, values: m.result}
+		req = req.WithContext(context.WithValue(req.Context(), paramsKey{}, ps))
+		m.handler.ServeHTTP(w, req)
+		return
+	}
+
+	if len(m.allowed) > 0 {
+		r.methodNotAllowed(w, req, m.allowed)
+		return
+	}
+
+	// only "/a/" is registered, so "/a" is sent there
+	if !strings.HasSuffix(p, "/") {
+		if _, ok := r.lookup(req.Method, escaped+"/"); ok {
+			redirect(w, req, p+"/")
+			return
+		}
+	}
+
+	if r.NotFound != nil {
+		r.NotFound.ServeHTTP(w, req)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+func (r *Router) methodNotAllowed(w http.ResponseWriter, req *http.Request, allowed map[string]bool) {
+	if allowed[http.MethodGet] {
+		allowed[http.MethodHead] = true
+	}
+	methods := make([]string, 0, len(allowed))
+	for m := range allowed {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+
+	if r.MethodNotAllowed != nil {
+		r.MethodNotAllowed.ServeHTTP(w, req)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// cleanPath is path.Clean, but keeps a trailing slash - it's meaningful here
+func cleanPath(p string) string {
+	clean := path.Clean(p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+// redirect uses a 307 rather than a 301, so a POST to "/items/" from
+// "/items" stays a POST - recent ServeMux versions do the same
+func redirect(w http.ResponseWriter, r *http.Request, p string) {
+	u := *r.URL
+	u.Path, u.RawPath = p, ""
+	http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+}
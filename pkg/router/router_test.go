@@ -0,0 +1,179 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+// reply answers with its own name, and the pattern the router matched
+func reply(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name + " " + Pattern(r)))
+	})
+}
+
+func TestPrecedence(t *testing.T) {
+	r := New()
+	// ServeMux panics on these two, neither is more specific than the other
+	r.Handle("/a/{x}", reply("param"))
+	r.Handle("/{y}/b", reply("literal first"))
+	// and these, one has a method, the other a more specific path
+	r.Handle("GET /c/{x}", reply("method"))
+	r.Handle("/c/d", reply("path"))
+	r.Handle("/e/{rest...}", reply("rest"))
+	r.Handle("/e/{x}/f", reply("param"))
+
+	assert.Equal(t, "param /a/{x}", get(r, "GET", "/a/b").Body.String())
+	assert.Equal(t, "literal first /{y}/b", get(r, "GET", "/z/b").Body.String())
+	assert.Equal(t, "path /c/d", get(r, "GET", "/c/d").Body.String())
+	assert.Equal(t, "method /c/{x}", get(r, "GET", "/c/e").Body.String())
+
+	// backtracking: the param branch leads nowhere for /e/x/g, so the
+	// wildcard gets it
+	assert.Equal(t, "param /e/{x}/f", get(r, "GET", "/e/x/f").Body.String())
+	assert.Equal(t, "rest /e/{rest...}", get(r, "GET", "/e/x/g").Body.String())
+}
+
+func TestMethodFallsThrough(t *testing.T) {
+	r := New()
+	r.Handle("GET /items/{id}", reply("get"))
+	r.Handle("/items/", reply("any"))
+
+	// the more specific pattern doesn't take POST, so the subtree does
+	assert.Equal(t, "any /items/", get(r, "POST", "/items/1").Body.String())
+	assert.Equal(t, "get /items/{id}", get(r, "GET", "/items/1").Body.String())
+}
+
+func TestGroups(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	r := New()
+	r.Use(tag("log"))
+	r.Handle("GET /health", reply("health"))
+
+	r.Route("/api", func(api *Group) {
+		api.Use(tag("auth"))
+		api.Handle("GET /users/{id}", reply("user"))
+
+		admin := api.Group("/admin/")
+		admin.Use(tag("admin"))
+		admin.HandleFunc("POST /reset", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("reset " + Pattern(r)))
+		})
+	})
+
+	tests := []struct {
+		method, path string
+		body         string
+		calls        []string
+	}{
+		{"GET", "/health", "health /health", []string{"log"}},
+		{"GET", "/api/users/1", "user /api/users/{id}", []string{"log", "auth"}},
+		{"POST", "/api/admin/reset", "reset /api/admin/reset", []string{"log", "auth", "admin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			calls = nil
+			assert.Equal(t, tt.body, get(r, tt.method, tt.path).Body.String())
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+
+	// middleware only wraps routes, a 404 doesn't go through it
+	calls = nil
+	assert.Equal(t, http.StatusNotFound, get(r, "GET", "/api/nope").Code)
+	assert.Empty(t, calls)
+}
+
+func TestUseAfterHandlePanics(t *testing.T) {
+	r := New()
+	r.Handle("/", reply("root"))
+	assert.Panics(t, func() { r.Use(func(h http.Handler) http.Handler { return h }) })
+
+	// a child group has its own middleware list, so it's fine there
+	g := New().Group("/api")
+	g.Use(func(h http.Handler) http.Handler { return h })
+}
+
+func TestBadPatternsPanic(t *testing.T) {
+	for _, pattern := range []string{
+		"items",
+		"/items/{id",
+		"/items/x{id}",
+		"/items/{}",
+		"/items/{1d}",
+		"/items/{rest...}/more",
+		"/{$}/more",
+		"/{a}/{a}",
+	} {
+		t.Run(pattern, func(t *testing.T) {
+			assert.Panics(t, func() { New().Handle(pattern, reply("")) })
+		})
+	}
+
+	t.Run("duplicate", func(t *testing.T) {
+		r := New()
+		r.Handle("GET /items/{id}", reply(""))
+		r.Handle("POST /items/{id}", reply(""))
+		assert.Panics(t, func() { r.Handle("GET /items/{id}", reply("")) })
+		// same route under another name would make Param ambiguous
+		assert.Panics(t, func() { r.Handle("PUT /items/{key}", reply("")) })
+	})
+}
+
+func TestCustomErrors(t *testing.T) {
+	r := New()
+	r.Handle("GET /items", reply("items"))
+	r.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+	})
+	r.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"allowed: `+w.Header().Get("Allow")+`"}`, http.StatusMethodNotAllowed)
+	})
+
+	w := get(r, "GET", "/nope")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"not found"}`, strings.TrimSpace(w.Body.String()))
+
+	w = get(r, "DELETE", "/items")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, `{"error":"allowed: GET, HEAD"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestParamOutsideRouter(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.Empty(t, Param(req, "id"))
+	assert.Empty(t, Pattern(req))
+}
+
+func BenchmarkRouter(b *testing.B) {
+	r := New()
+	for _, p := range conformancePatterns {
+		r.Handle(p, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	}
+	req := httptest.NewRequest("GET", "/b/photos/o/2024/cat.jpg", nil)
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
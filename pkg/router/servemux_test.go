@@ -0,0 +1,18 @@
+//go:build go1.23
+
+//go:debug httpmuxgo121=0
+
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+// go.mod says go 1.21, which keeps ServeMux on its old matching rules. The
+// debug setting above switches this test binary to the 1.22 ones, so the
+// same cases can check the router against the real thing
+func TestConformanceServeMux(t *testing.T) {
+	m := http.NewServeMux()
+	runConformance(t, m, m.Handle, (*http.Request).PathValue)
+}
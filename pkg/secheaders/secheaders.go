@@ -0,0 +1,152 @@
+// Package secheaders sets the response headers that tell a browser to lock a
+// page down: where scripts may load from, to always use https, not to guess
+// content types, not to be framed. None of them fix a bug, but each turns a
+// class of bug - an XSS hole, a downgrade to http, clickjacking - from an
+// exploit into a blocked request.
+//
+// Middleware sets a Policy on every response, and Override changes it for
+// one route. The handler itself has the last word: a header it sets is
+// never overwritten.
+//
+//	r.Use(secheaders.Middleware(secheaders.Default()))
+//	r.Handle("GET /embed", secheaders.Override(func(p *secheaders.Policy) {
+//		p.FrameOptions = "" // this one is meant to be framed
+//		p.CSP = "frame-ancestors https://partner.example"
+//	})(embed))
+package secheaders
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Policy is the headers to set. An empty field leaves its header out
+type Policy struct {
+	// CSP is the Content-Security-Policy: where scripts, styles, images and
+	// so on may come from. The default allows only the page's own origin,
+	// so an injected <script src=evil> or inline script won't run
+	CSP string
+	// CSPReportOnly sends CSP as Content-Security-Policy-Report-Only: the
+	// browser reports what it would have blocked (to the policy's report-uri
+	// or report-to) but blocks nothing. Tightening a CSP on a live site
+	// goes report-only first, or it breaks whatever was missed
+	CSPReportOnly bool
+
+	// HSTS is how long the browser should use https only, never trying
+	// http - which a network attacker could intercept - first. Zero leaves
+	// the header out. Browsers ignore it over plain http, so it's harmless
+	// there, but once sent it sticks for the whole max-age
+	HSTS                  time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// FrameOptions is X-Frame-Options, DENY or SAMEORIGIN. CSP's
+	// frame-ancestors replaces it in modern browsers
+	FrameOptions string
+	// NoSniff sets X-Content-Type-Options: nosniff, so a browser believes
+	// Content-Type instead of guessing - and running an upload as script
+	NoSniff        bool
+	ReferrerPolicy string
+	// CrossOriginOpenerPolicy stops pages this one opens, or is opened by,
+	// from holding a reference to its window
+	CrossOriginOpenerPolicy string
+	PermissionsPolicy       string
+}
+
+// Default suits a site serving its own pages and API, and nothing else.
+// HSTS is a year, without preload - getting onto browsers' preload lists
+// is a commitment to be made on purpose
+func Default() Policy {
+	return Policy{
+		CSP:                     "default-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'; form-action 'self'",
+		HSTS:                    365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:   true,
+		FrameOptions:            "DENY",
+		NoSniff:                 true,
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		CrossOriginOpenerPolicy: "same-origin",
+		PermissionsPolicy:       "camera=(), microphone=(), geolocation=()",
+	}
+}
+
+const (
+	cspHeader           = "Content-Security-Policy"
+	cspReportOnlyHeader = "Content-Security-Policy-Report-Only"
+)
+
+// headers is every header a Policy controls, with its value, "" to leave
+// it out
+func (p Policy) headers() map[string]string {
+	h := map[string]string{
+		cspHeader:                    "",
+		cspReportOnlyHeader:          "",
+		"Strict-Transport-Security":  "",
+		"X-Frame-Options":            p.FrameOptions,
+		"X-Content-Type-Options":     "",
+		"Referrer-Policy":            p.ReferrerPolicy,
+		"Cross-Origin-Opener-Policy": p.CrossOriginOpenerPolicy,
+		"Permissions-Policy":         p.PermissionsPolicy,
+	}
+	if p.CSPReportOnly {
+		h[cspReportOnlyHeader] = p.CSP
+	} else {
+		h[cspHeader] = p.CSP
+	}
+	if p.HSTS > 0 {
+		v := "max-age=" + strconv.FormatInt(int64(p.HSTS/time.Second), 10)
+		if p.HSTSIncludeSubdomains {
+			v += "; includeSubDomains"
+		}
+		if p.HSTSPreload {
+			v += "; preload"
+		}
+		h["Strict-Transport-Security"] = v
+	}
+	if p.NoSniff {
+		h["X-Content-Type-Options"] = "nosniff"
+	}
+	return h
+}
+
+// apply replaces whatever the headers p controls were set to
+func (p Policy) apply(h http.Header) {
+	for name, v := range p.headers() {
+		if v == "" {
+			h.Del(name)
+		} else {
+			h.Set(name, v)
+		}
+	}
+}
+
+type policyKey struct{}
+
+// Middleware sets p's headers before the handler runs, so anything the
+// handler sets itself wins
+func Middleware(p Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.apply(w.Header())
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), policyKey{}, p)))
+		})
+	}
+}
+
+// Override changes the policy for the routes it wraps: f gets a copy of
+// the policy Middleware set - or Default, outside Middleware - and what it
+// leaves replaces it. Overrides nest, the innermost applying last
+func Override(f func(p *Policy)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := r.Context().Value(policyKey{}).(Policy)
+			if !ok {
+				p = Default()
+			}
+			f(&p)
+			p.apply(w.Header())
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), policyKey{}, p)))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package secheaders
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thorntonmc/go-practice/pkg/router"
+)
+
+func get(h http.Handler, path string) http.Header {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec.Header()
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestDefault(t *testing.T) {
+	h := get(Middleware(Default())(ok), "/")
+
+	assert.Equal(t, "default-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'; form-action 'self'", h.Get("Content-Security-Policy"))
+	assert.Empty(t, h.Values("Content-Security-Policy-Report-Only"))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", h.Get("Strict-Transport-Security"))
+	assert.Equal(t, "DENY", h.Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", h.Get("Referrer-Policy"))
+	assert.Equal(t, "same-origin", h.Get("Cross-Origin-Opener-Policy"))
+	assert.Equal(t, "camera=(), microphone=(), geolocation=()", h.Get("Permissions-Policy"))
+	assert.Len(t, h, 7)
+}
+
+func TestPolicy(t *testing.T) {
+	p := Policy{
+		CSP:           "default-src 'self'; report-uri /csp-reports",
+		CSPReportOnly: true,
+		HSTS:          2 * time.Hour,
+		HSTSPreload:   true,
+	}
+	h := get(Middleware(p)(ok), "/")
+	assert.Equal(t, "default-src 'self'; report-uri /csp-reports", h.Get("Content-Security-Policy-Report-Only"))
+	assert.Empty(t, h.Values("Content-Security-Policy"), "report-only enforces nothing")
+	assert.Equal(t, "max-age=7200; preload", h.Get("Strict-Transport-Security"))
+	assert.Len(t, h, 2, "empty fields leave their headers out")
+
+	h = get(Middleware(Policy{})(ok), "/")
+	assert.Empty(t, h)
+}
+
+func TestPrecedence(t *testing.T) {
+	// the handler beats the route's override, which beats the default
+	r := router.New()
+	r.Use(Middleware(Default()))
+	r.Handle("GET /", ok)
+	r.Handle("GET /embed", Override(func(p *Policy) {
+		p.FrameOptions = ""
+		p.CSP = "frame-ancestors https://partner.example"
+	})(ok))
+	r.Handle("GET /embed/custom", Override(func(p *Policy) { p.FrameOptions = "" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "frame-ancestors *")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+	})))
+	r.Handle("GET /trial", Override(func(p *Policy) {
+		p.CSP += "; script-src 'self' https://cdn.example"
+		p.CSPReportOnly = true
+	})(ok))
+
+	h := get(r, "/")
+	assert.Equal(t, "DENY", h.Get("X-Frame-Options"))
+
+	h = get(r, "/embed")
+	assert.Empty(t, h.Values("X-Frame-Options"), "removed by the override")
+	assert.Equal(t, "frame-ancestors https://partner.example", h.Get("Content-Security-Policy"))
+	assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"), "the rest of the default stays")
+
+	h = get(r, "/embed/custom")
+	assert.Equal(t, []string{"frame-ancestors *"}, h.Values("Content-Security-Policy"))
+	assert.Equal(t, "no-referrer", h.Get("Referrer-Policy"))
+	assert.Empty(t, h.Values("X-Frame-Options"))
+
+	h = get(r, "/trial")
+	assert.Empty(t, h.Values("Content-Security-Policy"), "the enforced policy moves to report-only")
+	assert.Equal(t, Default().CSP+"; script-src 'self' https://cdn.example", h.Get("Content-Security-Policy-Report-Only"))
+}
+
+func TestOverrideNesting(t *testing.T) {
+	inner := Override(func(p *Policy) { p.ReferrerPolicy = "no-referrer" })(ok)
+	outer := Override(func(p *Policy) {
+		p.ReferrerPolicy = "same-origin"
+		p.HSTS = 0
+	})(inner)
+
+	h := get(Middleware(Default())(outer), "/")
+	assert.Equal(t, "no-referrer", h.Get("Referrer-Policy"), "the innermost applies last")
+	assert.Empty(t, h.Values("Strict-Transport-Security"), "and starts from the outer one's policy")
+
+	h = get(inner, "/")
+	assert.Equal(t, "no-referrer", h.Get("Referrer-Policy"))
+	assert.Equal(t, "DENY", h.Get("X-Frame-Options"), "outside Middleware, overrides start from Default")
+}
@@ -0,0 +1,62 @@
+// Package server builds the *http.Server the apps in this repo run on, so
+// they all get the same timeouts
+package server
+
+import (
+	"net/http"
+
+	"github.com/thorntonmc/go-practice/pkg/config"
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+// New returns a server for handler listening on addr, with the default
+// settings from config.Default.
+//
+// Every timeout is set, because the zero value for each is "wait forever".
+// ReadHeaderTimeout is the one that matters for slow-loris attacks: a client
+// opens lots of connections and sends its headers a byte at a time, each one
+// tying up a goroutine and a file descriptor. ReadTimeout would also catch it,
+// but it includes the body, so it has to be long enough for the slowest
+// legitimate upload. ReadHeaderTimeout can be short, no honest client takes
+// seconds to send a few hundred bytes of headers.
+//
+// MaxHeaderBytes caps how much of the request line and headers the server
+// will read at all
+func New(addr string, handler http.Handler) *http.Server {
+	c := config.Default().Server
+	c.Addr = addr
+	return FromConfig(c, handler)
+}
+
+// FromConfig returns a server built from loaded settings, so they can be
+// tuned per deployment without a rebuild
+func FromConfig(c config.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              c.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+}
+
+// Admin returns a server for the admin endpoints on c.AdminAddr, or nil
+// when that's empty and they're turned off:
+//
+//	GET /debug/stats  stats, see pkg/admin
+//	GET /version      the build, see pkg/version
+//
+// It gets the same timeouts as the app's own server, and a mux of its own,
+// so nothing on the public port can reach it by accident
+func Admin(c config.Server, stats http.Handler) *http.Server {
+	if c.AdminAddr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/stats", stats)
+	mux.Handle("/version", version.Handler())
+	c.Addr = c.AdminAddr
+	return FromConfig(c, mux)
+}
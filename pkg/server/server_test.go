@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorntonmc/go-practice/pkg/config"
+)
+
+func startTestServer(t *testing.T, tweak func(*http.Server)) string {
+	s := New("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	tweak(s)
+
+	srv := httptest.NewUnstartedServer(s.Handler)
+	srv.Config = s
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return srv.Listener.Addr().String()
+}
+
+func TestSlowHeadersAreCutOff(t *testing.T) {
+	addr := startTestServer(t, func(s *http.Server) {
+		s.ReadHeaderTimeout = 50 * time.Millisecond
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// start a request and never finish the headers
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nX-Slow: "))
+	require.NoError(t, err)
+
+	// the server hangs up on us, possibly after a 408, well before our
+	// own deadline runs out
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	var ne net.Error
+	assert.False(t, errors.As(err, &ne) && ne.Timeout(), "server should hang up, not leave us waiting")
+}
+
+func TestOversizedHeadersAreRejected(t *testing.T) {
+	addr := startTestServer(t, func(s *http.Server) {
+		s.MaxHeaderBytes = 1024
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr, nil)
+	req.Header.Set("X-Big", strings.Repeat("a", 8<<10))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+}
+
+func TestFromConfig(t *testing.T) {
+	c := config.Default().Server
+	c.Addr = ":9999"
+	c.IdleTimeout = time.Minute
+
+	s := FromConfig(c, http.NotFoundHandler())
+	assert.Equal(t, ":9999", s.Addr)
+	assert.Equal(t, time.Minute, s.IdleTimeout)
+	assert.Equal(t, c.ReadHeaderTimeout, s.ReadHeaderTimeout)
+
+	// New is the defaults with an address
+	assert.Equal(t, 5*time.Second, New(":1", nil).ReadHeaderTimeout)
+	assert.Equal(t, 64<<10, New(":1", nil).MaxHeaderBytes)
+}
+
+func TestAdmin(t *testing.T) {
+	c := config.Default().Server
+	c.AdminAddr = ""
+	assert.Nil(t, Admin(c, http.NotFoundHandler()), "off when there's no address")
+
+	c.AdminAddr = "localhost:7000"
+	c.IdleTimeout = time.Minute
+	s := Admin(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stats"))
+	}))
+	require.NotNil(t, s)
+	assert.Equal(t, "localhost:7000", s.Addr)
+	assert.Equal(t, time.Minute, s.IdleTimeout, "the app's timeouts")
+
+	for path, want := range map[string]int{"/debug/stats": http.StatusOK, "/version": http.StatusOK, "/": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		s.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, want, rec.Code, path)
+	}
+}
@@ -0,0 +1,156 @@
+// Package trie is a generic trie. A trie (from retrieval, said "try")
+// stores keys that are sequences - strings as bytes, paths as segments - by
+// sharing their prefixes: "team" and "tea" are the same three nodes, then
+// "m" for one of them. Looking up a key walks one node per element, so it
+// costs the length of the key whatever the number of keys, and it can
+// answer questions a map can't:
+//
+//   - every key starting with a prefix (autocomplete)
+//   - the longest stored key that's a prefix of some input (routing, IP
+//     lookups)
+package trie
+
+// Trie is generic over the element type K, so the same code does
+// Trie[byte, V] for strings and Trie[string, V] for path segments. The zero
+// value is an empty trie
+type Trie[K comparable, V any] struct {
+	root Node[K, V]
+	size int
+}
+
+// Node is one position in a Trie. The router in pkg/router walks nodes
+// itself, to try path parameters when a literal segment doesn't match
+type Node[K comparable, V any] struct {
+	children map[K]*Node[K, V]
+	value    V
+	hasValue bool
+}
+
+// Child returns the node below n for k, or nil
+func (n *Node[K, V]) Child(k K) *Node[K, V] {
+	if n == nil {
+		return nil
+	}
+	return n.children[k]
+}
+
+// Value returns the value stored at n, if a key ends here
+func (n *Node[K, V]) Value() (V, bool) {
+	if n == nil {
+		var zero V
+		return zero, false
+	}
+	return n.value, n.hasValue
+}
+
+// Root is where every key starts
+func (t *Trie[K, V]) Root() *Node[K, V] { return &t.root }
+
+// Len is the number of keys stored
+func (t *Trie[K, V]) Len() int { return t.size }
+
+// Put stores v under key, and reports whether it replaced a value
+func (t *Trie[K, V]) Put(key []K, v V) bool {
+	n := &t.root
+	for _, k := range key {
+		child := n.children[k]
+		if child == nil {
+			if n.children == nil {
+				n.children = map[K]*Node[K, V]{}
+			}
+			child = &Node[K, V]{}
+			n.children[k] = child
+		}
+		n = child
+	}
+
+	replaced := n.hasValue
+	n.value, n.hasValue = v, true
+	if !replaced {
+		t.size++
+	}
+	return replaced
+}
+
+func (t *Trie[K, V]) find(key []K) *Node[K, V] {
+	n := &t.root
+	for _, k := range key {
+		if n = n.children[k]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+func (t *Trie[K, V]) Get(key []K) (V, bool) {
+	return t.find(key).Value()
+}
+
+// Delete removes key, and the nodes that were only there for it
+func (t *Trie[K, V]) Delete(key []K) bool {
+	// remember the path down, to prune on the way back up
+	path := make([]*Node[K, V], 0, len(key)+1)
+	n := &t.root
+	path = append(path, n)
+	for _, k := range key {
+		if n = n.children[k]; n == nil {
+			return false
+		}
+		path = append(path, n)
+	}
+	if !n.hasValue {
+		return false
+	}
+
+	var zero V
+	n.value, n.hasValue = zero, false
+	t.size--
+
+	for i := len(key); i > 0 && !path[i].hasValue && len(path[i].children) == 0; i-- {
+		delete(path[i-1].children, key[i-1])
+	}
+	return true
+}
+
+// LongestPrefix finds the longest stored key that key starts with, and
+// returns its length and value
+func (t *Trie[K, V]) LongestPrefix(key []K) (n int, v V, ok bool) {
+	node := &t.root
+	if node.hasValue {
+		v, ok = node.value, true
+	}
+	for i, k := range key {
+		if node = node.children[k]; node == nil {
+			break
+		}
+		if node.hasValue {
+			n, v, ok = i+1, node.value, true
+		}
+	}
+	return n, v, ok
+}
+
+// WalkPrefix calls fn for every key starting with prefix, until fn returns
+// false. Children are kept in a map, so the order is unspecified - sort
+// the results if it matters. The key passed to fn is only valid during the
+// call
+func (t *Trie[K, V]) WalkPrefix(prefix []K, fn func(key []K, v V) bool) {
+	n := t.find(prefix)
+	if n == nil {
+		return
+	}
+	key := append(make([]K, 0, len(prefix)+16), prefix...)
+	walk(n, key, fn)
+}
+
+func walk[K comparable, V any](n *Node[K, V], key []K, fn func([]K, V) bool) bool {
+	if n.hasValue && !fn(key, n.value) {
+		return false
+	}
+	for k, child := range n.children {
+		if !walk(child, append(key, k), fn) {
+			return false
+		}
+	}
+	return true
+}
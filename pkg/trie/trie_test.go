@@ -0,0 +1,133 @@
+package trie
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sinkInt int
+
+func TestTrie(t *testing.T) {
+	var tr Trie[byte, int]
+	assert.False(t, tr.Put([]byte("tea"), 1))
+	assert.False(t, tr.Put([]byte("team"), 2))
+	assert.False(t, tr.Put([]byte("ten"), 3))
+	assert.True(t, tr.Put([]byte("tea"), 10), "replaced")
+	assert.Equal(t, 3, tr.Len())
+
+	v, ok := tr.Get([]byte("tea"))
+	assert.True(t, ok)
+	assert.Equal(t, 10, v)
+	_, ok = tr.Get([]byte("te"))
+	assert.False(t, ok, "a prefix isn't a key")
+	_, ok = tr.Get([]byte("teams"))
+	assert.False(t, ok)
+
+	assert.False(t, tr.Delete([]byte("te")))
+	assert.True(t, tr.Delete([]byte("team")))
+	assert.False(t, tr.Delete([]byte("team")))
+	assert.Equal(t, 2, tr.Len())
+	assert.Nil(t, tr.Root().Child('t').Child('e').Child('a').Child('m'), "pruned")
+	_, ok = tr.Get([]byte("tea"))
+	assert.True(t, ok, "the shorter key survives")
+
+	assert.True(t, tr.Delete([]byte("tea")))
+	assert.True(t, tr.Delete([]byte("ten")))
+	assert.Empty(t, tr.Root().children)
+}
+
+func TestTrieEmptyKey(t *testing.T) {
+	var tr Trie[byte, string]
+	tr.Put(nil, "root")
+	v, ok := tr.Get([]byte{})
+	assert.True(t, ok)
+	assert.Equal(t, "root", v)
+
+	n, v, ok := tr.LongestPrefix([]byte("anything"))
+	assert.True(t, ok)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, "root", v)
+}
+
+func TestLongestPrefix(t *testing.T) {
+	var tr Trie[string, string]
+	tr.Put([]string{"api"}, "api")
+	tr.Put([]string{"api", "users"}, "users")
+
+	tests := []struct {
+		path  string
+		n     int
+		value string
+		ok    bool
+	}{
+		{"api/users/42", 2, "users", true},
+		{"api/users", 2, "users", true},
+		{"api/orders", 1, "api", true},
+		{"static/app.js", 0, "", false},
+	}
+	for _, tt := range tests {
+		n, v, ok := tr.LongestPrefix(strings.Split(tt.path, "/"))
+		assert.Equal(t, tt.n, n, tt.path)
+		assert.Equal(t, tt.value, v, tt.path)
+		assert.Equal(t, tt.ok, ok, tt.path)
+	}
+}
+
+func TestWalkPrefix(t *testing.T) {
+	var tr Trie[byte, struct{}]
+	for _, w := range strings.Fields("go gopher golang gone good rust ruby") {
+		tr.Put([]byte(w), struct{}{})
+	}
+
+	complete := func(prefix string) []string {
+		var got []string
+		tr.WalkPrefix([]byte(prefix), func(k []byte, _ struct{}) bool {
+			got = append(got, string(k))
+			return true
+		})
+		sort.Strings(got)
+		return got
+	}
+	assert.Equal(t, []string{"go", "golang", "gone", "good", "gopher"}, complete("go"))
+	assert.Equal(t, []string{"gone"}, complete("gon"))
+	assert.Equal(t, []string{"ruby", "rust"}, complete("ru"))
+	assert.Empty(t, complete("x"))
+	assert.Len(t, complete(""), 7)
+
+	count := 0
+	tr.WalkPrefix(nil, func([]byte, struct{}) bool {
+		count++
+		return count < 3
+	})
+	assert.Equal(t, 3, count, "stops when fn returns false")
+}
+
+func BenchmarkTrie(b *testing.B) {
+	var tr Trie[string, int]
+	m := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		path := fmt.Sprintf("api/v%d/resource%d/items", i%3, i)
+		tr.Put(strings.Split(path, "/"), i)
+		m[path] = i
+	}
+	key := "api/v1/resource500/items"
+	segs := strings.Split(key, "/")
+
+	b.Run("trie", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			v, _ := tr.Get(segs)
+			sinkInt += v
+		}
+	})
+	// a map is faster for exact lookups - the trie earns its keep on
+	// prefix questions a map can't answer
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sinkInt += m[key]
+		}
+	})
+}
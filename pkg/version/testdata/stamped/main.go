@@ -0,0 +1,14 @@
+// stamped prints its version as JSON, for TestLdflags to build with and
+// without -ldflags
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/thorntonmc/go-practice/pkg/version"
+)
+
+func main() {
+	json.NewEncoder(os.Stdout).Encode(version.Get())
+}
@@ -0,0 +1,171 @@
+// Package version says which build of a program is running. Release builds
+// stamp it with -ldflags:
+//
+//	go build -ldflags "\
+//	  -X github.com/thorntonmc/go-practice/pkg/version.version=v1.4.0 \
+//	  -X github.com/thorntonmc/go-practice/pkg/version.commit=$(git rev-parse HEAD) \
+//	  -X github.com/thorntonmc/go-practice/pkg/version.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/todo
+//
+// Anything left unstamped falls back to what the go command records by
+// itself, read with debug.ReadBuildInfo: the module version for go install
+// pkg@v1.4.0, and the commit and its time for a build in a git checkout.
+// A plain go run gets "devel"
+package version
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set by -ldflags -X. They have to be package level string variables -
+// -X can't set a constant, or anything but a string - and are unexported so
+// nothing but the linker changes them
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info is a build's identity
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // built with uncommitted changes
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns this binary's Info
+func Get() Info {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		bi = nil
+	}
+	return resolve(stamp{version: version, commit: commit, date: date}, bi)
+}
+
+// stamp is what -ldflags set
+type stamp struct {
+	version, commit, date string
+}
+
+// resolve fills in Info from s, then from bi where s is empty. bi is nil
+// for a binary built without module support
+func resolve(s stamp, bi *debug.BuildInfo) Info {
+	i := Info{Version: s.version, Commit: s.commit, Date: s.date, GoVersion: runtime.Version()}
+	if bi != nil {
+		// "(devel)" is what the main module gets when there's no version
+		// to give it, which says nothing
+		if i.Version == "" && bi.Main.Version != "(devel)" {
+			i.Version = bi.Main.Version
+		}
+		if i.Commit == "" {
+			for _, set := range bi.Settings {
+				switch set.Key {
+				case "vcs.revision":
+					i.Commit = set.Value
+				case "vcs.time":
+					if i.Date == "" {
+						i.Date = set.Value
+					}
+				case "vcs.modified":
+					i.Modified = set.Value == "true"
+				}
+			}
+		}
+		if bi.GoVersion != "" {
+			i.GoVersion = bi.GoVersion
+		}
+	}
+	if i.Version == "" {
+		i.Version = "devel"
+	}
+	return i
+}
+
+// String is the version, then what's known of where it came from:
+//
+//	v1.4.0 (3f2c1a9b7e4d, 2024-05-01T12:00:00Z, modified) go1.21.0
+func (i Info) String() string {
+	var details []string
+	if i.Commit != "" {
+		details = append(details, i.Commit[:min(len(i.Commit), 12)])
+	}
+	if i.Date != "" {
+		details = append(details, i.Date)
+	}
+	if i.Modified {
+		details = append(details, "modified")
+	}
+
+	s := i.Version
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s + " " + i.GoVersion
+}
+
+// AddFlag adds -version to fs. Set, the program should print its name and
+// Get, and exit 0 without doing anything else
+func AddFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("version", false, "print the version and exit")
+}
+
+// Handler serves Get as JSON
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Get())
+	})
+}
+
+/*
+ *
+ * User-Agent
+ *
+ */
+
+// UserAgent is name/version, as a program calling itself name should
+// introduce itself to the servers it calls
+func UserAgent(name string) string {
+	return name + "/" + Get().Version
+}
+
+// Transport sends requests with base, or http.DefaultTransport if it's nil,
+// setting User-Agent to UserAgent(name) on any that don't have one. The
+// server at the other end can then tell which program - and which build of
+// it - is calling, rather than seeing Go-http-client/1.1 from all of them
+func Transport(name string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &userAgentTransport{ua: UserAgent(name), base: base}
+}
+
+type userAgentTransport struct {
+	ua   string
+	base http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Header["User-Agent"]; ok {
+		return t.base.RoundTrip(req)
+	}
+	// a RoundTripper mustn't change the request it's given, the caller may
+	// still be using it
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.ua)
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections passes through to base. http.Client looks for it on
+// its Transport, and wrapping would hide it otherwise
+func (t *userAgentTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,160 @@
+package version
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildInfo(mainVersion string, settings ...string) *debug.BuildInfo {
+	bi := &debug.BuildInfo{GoVersion: "go1.21.5", Main: debug.Module{Path: "github.com/thorntonmc/go-practice", Version: mainVersion}}
+	for i := 0; i+1 < len(settings); i += 2 {
+		bi.Settings = append(bi.Settings, debug.BuildSetting{Key: settings[i], Value: settings[i+1]})
+	}
+	return bi
+}
+
+func TestResolve(t *testing.T) {
+	checkout := buildInfo("(devel)", "vcs.revision", "3f2c1a9b7e4d5c6b", "vcs.time", "2024-05-01T12:00:00Z", "vcs.modified", "true")
+
+	for _, tc := range []struct {
+		name  string
+		stamp stamp
+		bi    *debug.BuildInfo
+		want  Info
+	}{
+		{
+			"nothing at all", stamp{}, nil,
+			Info{Version: "devel", GoVersion: runtime.Version()},
+		},
+		{
+			"go run", stamp{}, buildInfo("(devel)"),
+			Info{Version: "devel", GoVersion: "go1.21.5"},
+		},
+		{
+			"go install @version", stamp{}, buildInfo("v1.4.0"),
+			Info{Version: "v1.4.0", GoVersion: "go1.21.5"},
+		},
+		{
+			"built in a checkout", stamp{}, checkout,
+			Info{Version: "devel", Commit: "3f2c1a9b7e4d5c6b", Date: "2024-05-01T12:00:00Z", Modified: true, GoVersion: "go1.21.5"},
+		},
+		{
+			"ldflags win", stamp{version: "v2.0.0", commit: "abc", date: "2024-06-01"}, checkout,
+			Info{Version: "v2.0.0", Commit: "abc", Date: "2024-06-01", GoVersion: "go1.21.5"},
+		},
+		{
+			"ldflags version only", stamp{version: "v2.0.0"}, checkout,
+			Info{Version: "v2.0.0", Commit: "3f2c1a9b7e4d5c6b", Date: "2024-05-01T12:00:00Z", Modified: true, GoVersion: "go1.21.5"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, resolve(tc.stamp, tc.bi))
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "devel go1.21.5", Info{Version: "devel", GoVersion: "go1.21.5"}.String())
+	assert.Equal(t,
+		"v1.4.0 (3f2c1a9b7e4d, 2024-05-01T12:00:00Z, modified) go1.21.5",
+		Info{Version: "v1.4.0", Commit: "3f2c1a9b7e4d5c6b", Date: "2024-05-01T12:00:00Z", Modified: true, GoVersion: "go1.21.5"}.String(),
+		"the commit shortened")
+	assert.Equal(t, "v1.4.0 (abc) go1.21.5", Info{Version: "v1.4.0", Commit: "abc", GoVersion: "go1.21.5"}.String())
+}
+
+func TestAddFlag(t *testing.T) {
+	for _, args := range [][]string{{"-version"}, {"--version"}} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		v := AddFlag(fs)
+		require.NoError(t, fs.Parse(args))
+		assert.True(t, *v, args[0])
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var got Info
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, Get(), got)
+}
+
+func TestTransport(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("User-Agent"))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: Transport("linkcheck", nil)}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, req.Header.Get("User-Agent"), "the caller's request is left alone")
+
+	req.Header.Set("User-Agent", "custom/1.0")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []string{"linkcheck/" + Get().Version, "custom/1.0"}, got)
+	assert.True(t, strings.HasPrefix(UserAgent("x"), "x/"))
+
+	// http.Client.CloseIdleConnections finds it through the wrapper
+	_, ok := client.Transport.(interface{ CloseIdleConnections() })
+	assert.True(t, ok)
+}
+
+// TestLdflags builds a program with and without -ldflags, to check the -X
+// names in the package doc really are the variables
+func TestLdflags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+
+	run := func(ldflags string) Info {
+		t.Helper()
+		bin := filepath.Join(t.TempDir(), "stamped")
+		build := exec.Command(gobin, "build", "-o", bin, "-ldflags", ldflags, "./testdata/stamped")
+		out, err := build.CombinedOutput()
+		require.NoError(t, err, string(out))
+
+		out, err = exec.Command(bin).Output()
+		require.NoError(t, err)
+		var i Info
+		require.NoError(t, json.Unmarshal(out, &i))
+		return i
+	}
+
+	const pkg = "github.com/thorntonmc/go-practice/pkg/version"
+	stamped := run("-X " + pkg + ".version=v9.9.9 -X " + pkg + ".commit=0123456789abcdef -X " + pkg + ".date=2024-05-01T12:00:00Z")
+	assert.Equal(t, "v9.9.9", stamped.Version)
+	assert.Equal(t, "0123456789abcdef", stamped.Commit)
+	assert.Equal(t, "2024-05-01T12:00:00Z", stamped.Date)
+	assert.False(t, stamped.Modified, "nothing said, when the commit came from ldflags")
+
+	// unstamped, whatever the go command recorded: a pseudo-version or
+	// devel, depending on the go version and whether this is a checkout
+	plain := run("")
+	assert.NotEqual(t, "v9.9.9", plain.Version)
+	assert.NotEmpty(t, plain.Version)
+	assert.Equal(t, runtime.Version(), plain.GoVersion)
+}